@@ -0,0 +1,432 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const (
+	bazelWorkspaceFile = "WORKSPACE"
+	// bazelDepsFile is the conventional name of the file, loaded from the
+	// WORKSPACE, which declares a repository's Go dependencies.
+	bazelDepsFile = "deps.bzl"
+)
+
+var (
+	bazelGoRepositoryRe = regexp.MustCompile(`\bgo_repository\s*\(`)
+	bazelLoadRe         = regexp.MustCompile(`\bload\s*\(\s*"([^"]+)"`)
+)
+
+// bazelImporter imports the go_repository rules of a Bazel WORKSPACE into the
+// dep configuration format.
+type bazelImporter struct {
+	rules []bazelGoRepository
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newBazelImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *bazelImporter {
+	return &bazelImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// bazelGoRepository holds the attributes of a go_repository rule which are
+// relevant to dep.
+type bazelGoRepository struct {
+	name       string
+	importPath string
+	commit     string
+	tag        string
+	remote     string
+}
+
+func (b *bazelImporter) Name() string {
+	return "bazel"
+}
+
+func (b *bazelImporter) HasDepMetadata(dir string) bool {
+	files, err := bazelFiles(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, f := range files {
+		src, err := ioutil.ReadFile(f)
+		if err == nil && bazelGoRepositoryRe.Match(stripBazelComments(string(src))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bazelImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := b.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b.convert(pr)
+}
+
+// load the go_repository rules of the WORKSPACE, and of the deps.bzl files it
+// loads.
+func (b *bazelImporter) load(projectDir string) error {
+	b.logger.Println("Detected bazel configuration files...")
+	files, err := bazelFiles(projectDir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if b.verbose {
+			b.logger.Printf("  Loading %s", f)
+		}
+		src, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s", f)
+		}
+
+		rules, errs := parseGoRepositoryRules(string(src))
+		for _, err := range errs {
+			b.logger.Printf("  Warning: Skipping %s\n", err)
+		}
+		b.rules = append(b.rules, rules...)
+	}
+
+	return nil
+}
+
+// bazelFiles returns the WORKSPACE file in dir, followed by the deps.bzl files
+// in the same repository which it loads. An error is returned when there is no
+// WORKSPACE file.
+func bazelFiles(dir string) ([]string, error) {
+	workspace := filepath.Join(dir, bazelWorkspaceFile)
+	if exists, _ := fs.IsRegular(workspace); !exists {
+		return nil, errors.Errorf("%s does not exist", workspace)
+	}
+	src, err := ioutil.ReadFile(workspace)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read %s", workspace)
+	}
+
+	files := []string{workspace}
+	seen := make(map[string]bool)
+	for _, m := range bazelLoadRe.FindAllStringSubmatch(string(stripBazelComments(string(src))), -1) {
+		f, ok := localBazelLabelPath(m[1])
+		if !ok || path.Base(f) != bazelDepsFile || seen[f] {
+			continue
+		}
+		seen[f] = true
+
+		f = filepath.Join(dir, filepath.FromSlash(f))
+		if exists, _ := fs.IsRegular(f); exists {
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+// localBazelLabelPath returns the path, relative to the repository root, of
+// the file referenced by a label such as //third_party:deps.bzl. Labels of
+// other repositories (@repo//...) are not local.
+func localBazelLabelPath(label string) (string, bool) {
+	if strings.HasPrefix(label, ":") {
+		return label[1:], true
+	}
+	if !strings.HasPrefix(label, "//") {
+		return "", false
+	}
+
+	label = strings.TrimPrefix(label, "//")
+	i := strings.Index(label, ":")
+	if i < 0 {
+		return "", false
+	}
+	return path.Join(label[:i], label[i+1:]), true
+}
+
+// stripBazelComments blanks out the comments of a Starlark source, leaving
+// the contents of string literals alone.
+func stripBazelComments(src string) []byte {
+	out := []byte(src)
+	var quote byte
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote || c == '\n' {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		}
+	}
+	return out
+}
+
+// parseGoRepositoryRules returns the go_repository rules declared in src,
+// along with an error for each rule which could not be parsed.
+func parseGoRepositoryRules(src string) ([]bazelGoRepository, []error) {
+	stripped := stripBazelComments(src)
+
+	var rules []bazelGoRepository
+	var errs []error
+	for _, loc := range bazelGoRepositoryRe.FindAllIndex(stripped, -1) {
+		args, ok := bazelCallArgs(stripped[loc[1]:])
+		if !ok {
+			errs = append(errs, errors.New("a go_repository rule which is not terminated"))
+			continue
+		}
+
+		rule, err := parseGoRepositoryArgs(args)
+		if err != nil {
+			name := rule.name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			errs = append(errs, errors.Wrapf(err, "go_repository rule %s", name))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, errs
+}
+
+// bazelCallArgs splits the arguments of a call, whose opening parenthesis has
+// already been consumed, on the commas separating them.
+func bazelCallArgs(src []byte) ([]string, bool) {
+	var args []string
+	var quote byte
+	depth := 0
+	start := 0
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' && depth == 0:
+			args = append(args, string(src[start:i]))
+			return args, true
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, string(src[start:i]))
+			start = i + 1
+		}
+	}
+	return nil, false
+}
+
+// parseGoRepositoryArgs extracts the attributes dep needs from the keyword
+// arguments of a go_repository rule. Those attributes must be string literals;
+// other attributes are ignored.
+func parseGoRepositoryArgs(args []string) (bazelGoRepository, error) {
+	var rule bazelGoRepository
+	var unparsable []string
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(arg[:i])
+
+		var dst *string
+		switch key {
+		case "name":
+			dst = &rule.name
+		case "importpath":
+			dst = &rule.importPath
+		case "commit":
+			dst = &rule.commit
+		case "tag":
+			dst = &rule.tag
+		case "remote":
+			dst = &rule.remote
+		default:
+			continue
+		}
+
+		v, ok := bazelStringLiteral(strings.TrimSpace(arg[i+1:]))
+		if !ok {
+			unparsable = append(unparsable, key)
+			continue
+		}
+		*dst = v
+	}
+
+	if len(unparsable) > 0 {
+		return rule, errors.Errorf("%s must be a string literal", strings.Join(unparsable, ", "))
+	}
+	if rule.importPath == "" {
+		return rule, errors.New("importpath is required")
+	}
+	if rule.commit == "" && rule.tag == "" {
+		return rule, errors.New("either commit or tag is required")
+	}
+	return rule, nil
+}
+
+// bazelStringLiteral returns the value of a single or double quoted string
+// literal.
+func bazelStringLiteral(s string) (string, bool) {
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || s[len(s)-1] != s[0] {
+		return "", false
+	}
+	v := s[1 : len(s)-1]
+	if strings.ContainsAny(v, `\`+s[:1]) {
+		return "", false
+	}
+	return v, true
+}
+
+// convert the go_repository rules into dep configuration files.
+func (b *bazelImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	b.logger.Println("Converting from WORKSPACE ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	seen := make(map[gps.ProjectRoot]bool)
+	for _, rule := range b.rules {
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := b.sm.DeduceProjectRoot(rule.importPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+
+		pi := gps.ProjectIdentifier{
+			ProjectRoot: ip,
+			Source:      alternateSource(ip, rule.remote),
+		}
+
+		pc, err := b.buildProjectConstraint(pi, rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pc.Constraint != nil {
+			manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Source: pi.Source, Constraint: pc.Constraint}
+		}
+
+		if lp, ok := b.buildLockedProject(pi, rule, manifest); ok {
+			lock.P = append(lock.P, lp)
+		}
+	}
+
+	return manifest, lock, nil
+}
+
+// buildProjectConstraint uses the rule's tag to create a project constraint.
+// Rules pinned to a commit are constrained by the version matching it instead,
+// if there is one.
+func (b *bazelImporter) buildProjectConstraint(pi gps.ProjectIdentifier, rule bazelGoRepository) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+
+	if rule.tag != "" {
+		pc.Constraint = inferImportedConstraint(rule.tag, pi, b.sm, b.logger)
+		if pc.Constraint == nil {
+			return pc, nil
+		}
+	} else {
+		revision := gps.Revision(rule.commit)
+		version, err := lookupVersionForLockedProject(pi, nil, revision, b.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			b.logger.Println(err.Error())
+			return pc, nil
+		}
+		pc.Constraint = getProjectPropertiesFromVersion(version).Constraint
+		if pc.Constraint == nil {
+			return pc, nil
+		}
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(b.logger)
+
+	return
+}
+
+// buildLockedProject creates a lock project for the rule's commit, or the
+// revision its tag currently points to. When the tag can't be found, the
+// project is left for the solver to pick, and false is returned.
+func (b *bazelImporter) buildLockedProject(pi gps.ProjectIdentifier, rule bazelGoRepository, manifest *dep.Manifest) (gps.LockedProject, bool) {
+	var version gps.Version
+
+	if rule.commit != "" {
+		pp := manifest.Constraints[pi.ProjectRoot]
+		v, err := lookupVersionForLockedProject(pi, pp.Constraint, gps.Revision(rule.commit), b.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			b.logger.Println(err.Error())
+		}
+		version = v
+	} else {
+		versions, err := b.sm.ListVersions(pi)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			b.logger.Println(errors.Wrapf(err, "Unable to lookup the revision of %s in %s. Skipping the lock for this project.", rule.tag, pi.ProjectRoot).Error())
+			return gps.LockedProject{}, false
+		}
+		for _, pv := range versions {
+			if pv.String() == rule.tag {
+				version = pv
+				break
+			}
+		}
+		if version == nil {
+			return gps.LockedProject{}, false
+		}
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(b.logger)
+
+	return lp, true
+}
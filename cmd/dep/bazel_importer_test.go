@@ -0,0 +1,333 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestBazelConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		rules []bazelGoRepository
+	}{
+		"commit": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]bazelGoRepository{
+				{
+					name:       "com_github_sdboyer_deptest",
+					importPath: "github.com/sdboyer/deptest",
+					// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+					commit: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+		"tag": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^0.8.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v0.8.0",
+				wantLockCount:      1,
+			},
+			[]bazelGoRepository{
+				{
+					name:       "com_github_sdboyer_deptest",
+					importPath: "github.com/sdboyer/deptest",
+					tag:        "v0.8.0",
+				},
+			},
+		},
+		"alternate remote": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantSourceRepo: "https://github.com/carolynvs/deptest",
+				wantConstraint: "^0.8.1",
+				wantRevision:   gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+				wantVersion:    "v0.8.1",
+				wantLockCount:  1,
+			},
+			[]bazelGoRepository{
+				{
+					name:       "com_github_sdboyer_deptest",
+					importPath: "github.com/sdboyer/deptest",
+					remote:     "https://github.com/carolynvs/deptest",
+					commit:     "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+				},
+			},
+		},
+		"duplicate rules": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "^0.8.1",
+				wantRevision:   gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+				wantLockCount:  1,
+			},
+			[]bazelGoRepository{
+				{
+					name:       "com_github_sdboyer_deptest",
+					importPath: "github.com/sdboyer/deptest",
+					commit:     "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+				},
+				{
+					name:       "com_github_sdboyer_deptest_foo",
+					importPath: "github.com/sdboyer/deptest/foo",
+					commit:     "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+				},
+			},
+		},
+		"unknown tag": {
+			importConverterTestCase{
+				projectRoot:   "github.com/sdboyer/deptest",
+				wantLockCount: 0,
+			},
+			[]bazelGoRepository{
+				{
+					name:       "com_github_sdboyer_deptest",
+					importPath: "github.com/sdboyer/deptest",
+					tag:        "v9.9.9",
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := newBazelImporter(discardLogger, true, sm)
+			b.rules = testCase.rules
+
+			testCase.exec(t, b)
+		})
+	}
+}
+
+func TestBazelConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, bazelWorkspaceFile), "bazel/WORKSPACE")
+	h.TempCopy(filepath.Join(testProjectRoot, bazelDepsFile), "bazel/deps.bzl")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	b := newBazelImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !b.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect the bazel WORKSPACE file")
+	}
+
+	m, l, err := b.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "bazel/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestBazelConfig_Load(t *testing.T) {
+	// Same as the rules in cmd/dep/testdata/bazel, except for those which are
+	// commented out or can't be parsed.
+	wantRules := []bazelGoRepository{
+		{
+			name:       "com_github_sdboyer_deptest",
+			importPath: "github.com/sdboyer/deptest",
+			commit:     "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+		},
+		{
+			name:       "com_github_sdboyer_deptestdos",
+			importPath: "github.com/sdboyer/deptestdos",
+			tag:        "v2.0.0",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempCopy(filepath.Join(testProjectRoot, bazelWorkspaceFile), "bazel/WORKSPACE")
+	h.TempCopy(filepath.Join(testProjectRoot, bazelDepsFile), "bazel/deps.bzl")
+
+	output := &bytes.Buffer{}
+	b := newBazelImporter(log.New(output, "", 0), false, nil)
+	err := b.load(h.Path(testProjectRoot))
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if !reflect.DeepEqual(b.rules, wantRules) {
+		t.Fatalf("Expected the rules to be loaded as:\n\t(WNT): %+v\n\t(GOT): %+v", wantRules, b.rules)
+	}
+
+	wantWarning := "Warning: Skipping go_repository rule com_github_carolynvs_deptest: commit must be a string literal"
+	if !strings.Contains(output.String(), wantWarning) {
+		t.Errorf("Expected the unparsable rule to be reported as %q, got:\n%s", wantWarning, output.String())
+	}
+}
+
+func TestBazelConfig_HasDepMetadata(t *testing.T) {
+	testCases := map[string]struct {
+		workspace string
+		deps      string
+		want      bool
+	}{
+		"no workspace": {
+			want: false,
+		},
+		"workspace without go_repository rules": {
+			workspace: `workspace(name = "com_github_golang_notexist")`,
+			want:      false,
+		},
+		"rule in workspace": {
+			workspace: `go_repository(name = "a", importpath = "github.com/sdboyer/deptest", tag = "v1.0.0")`,
+			want:      true,
+		},
+		"rule in deps.bzl": {
+			workspace: `load("//:deps.bzl", "go_dependencies")`,
+			deps:      `go_repository(name = "a", importpath = "github.com/sdboyer/deptest", tag = "v1.0.0")`,
+			want:      true,
+		},
+		"deps.bzl not loaded": {
+			workspace: `workspace(name = "com_github_golang_notexist")`,
+			deps:      `go_repository(name = "a", importpath = "github.com/sdboyer/deptest", tag = "v1.0.0")`,
+			want:      false,
+		},
+		"commented rule": {
+			workspace: `# go_repository(name = "a", importpath = "github.com/sdboyer/deptest", tag = "v1.0.0")`,
+			want:      false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			h.TempDir("project")
+			if tc.workspace != "" {
+				h.TempFile(filepath.Join("project", bazelWorkspaceFile), tc.workspace)
+			}
+			if tc.deps != "" {
+				h.TempFile(filepath.Join("project", bazelDepsFile), tc.deps)
+			}
+
+			b := newBazelImporter(discardLogger, false, nil)
+			if got := b.HasDepMetadata(h.Path("project")); got != tc.want {
+				t.Fatalf("Expected HasDepMetadata to be %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseGoRepositoryRules(t *testing.T) {
+	src := `
+go_repository(
+    name = "ok",
+    importpath = "github.com/sdboyer/deptest",
+    commit = 'ff2948a2ac8f538c4ecd55962e919d1e13e74baf',
+    remote = "https://github.com/carolynvs/deptest",
+    vcs = "git",
+    patches = ["//:fix(windows).patch"],
+)
+go_repository(name = "noimportpath", commit = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+go_repository(name = "nopin", importpath = "github.com/sdboyer/deptest")
+go_repository(name = "variable", importpath = IMPORTPATH, tag = "v1.0.0")
+go_repository(name = "unterminated", importpath = "github.com/sdboyer/deptest"
+`
+	wantRules := []bazelGoRepository{
+		{
+			name:       "ok",
+			importPath: "github.com/sdboyer/deptest",
+			commit:     "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+			remote:     "https://github.com/carolynvs/deptest",
+		},
+	}
+	wantErrs := []string{
+		"go_repository rule noimportpath: importpath is required",
+		"go_repository rule nopin: either commit or tag is required",
+		"go_repository rule variable: importpath must be a string literal",
+		"a go_repository rule which is not terminated",
+	}
+
+	rules, errs := parseGoRepositoryRules(src)
+	if !reflect.DeepEqual(rules, wantRules) {
+		t.Errorf("Expected the rules to be parsed as:\n\t(WNT): %+v\n\t(GOT): %+v", wantRules, rules)
+	}
+
+	var gotErrs []string
+	for _, err := range errs {
+		gotErrs = append(gotErrs, err.Error())
+	}
+	if !equalSlice(gotErrs, wantErrs) {
+		t.Errorf("Expected the errors:\n\t%s\ngot:\n\t%s", strings.Join(wantErrs, "\n\t"), strings.Join(gotErrs, "\n\t"))
+	}
+}
+
+func TestLocalBazelLabelPath(t *testing.T) {
+	testCases := map[string]string{
+		"//:deps.bzl":                "deps.bzl",
+		":deps.bzl":                  "deps.bzl",
+		"//third_party/go:deps.bzl":  "third_party/go/deps.bzl",
+		"@bazel_gazelle//:deps.bzl":  "",
+		"//third_party/go/deps.bzl":  "",
+		"@io_bazel_rules_go//go:def": "",
+	}
+
+	for label, want := range testCases {
+		got, ok := localBazelLabelPath(label)
+		if ok != (want != "") || got != want {
+			t.Errorf("localBazelLabelPath(%q) = %q, %t; want %q", label, got, ok, want)
+		}
+	}
+}
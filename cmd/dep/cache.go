@@ -0,0 +1,203 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const cacheShortHelp = `Inspect and clean the cache of sources`
+const cacheLongHelp = `
+Cache manages the sources dep keeps in its cache, $GOPATH/pkg/dep/sources, so
+that they needn't be fetched anew for every project. The cache is kept under
+the dir given by -cachedir or $DEPCACHEDIR instead, if set. A read-only cache
+given by -readonly-cachedir or $DEPREADONLYCACHEDIR isn't managed; sources
+copied from it are.
+
+  dep cache list
+    List each cached source, with the size of its files and when dep last
+    used it.
+
+  dep cache size
+    Print the total size of the cached sources.
+
+  dep cache clean [-older-than <age>] [<source> ...]
+    Remove cached sources: all of them, or those dep hasn't used for longer
+    than the age given, e.g. 90d or 12h, or those of the import paths or
+    URLs given, or both. They're fetched anew when they're needed again.
+
+Sizes don't include the files which symlinks in the sources point to. Other dep
+processes may use the cache meanwhile; clean waits for any of them using a
+source to be done with it before removing it.
+`
+
+type cacheCommand struct{}
+
+func (cmd *cacheCommand) Name() string      { return "cache" }
+func (cmd *cacheCommand) Args() string      { return "list|size|clean [flags] [<source> ...]" }
+func (cmd *cacheCommand) ShortHelp() string { return cacheShortHelp }
+func (cmd *cacheCommand) LongHelp() string  { return cacheLongHelp }
+func (cmd *cacheCommand) Hidden() bool      { return false }
+
+func (cmd *cacheCommand) Register(fs *flag.FlagSet) {}
+
+func (cmd *cacheCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) == 0 {
+		return errors.New("cache needs a subcommand: list, size or clean")
+	}
+
+	sub, args := args[0], args[1:]
+	var olderThan time.Duration
+	switch sub {
+	case "list", "size":
+		if len(args) > 0 {
+			return errors.Errorf("cache %s takes no arguments", sub)
+		}
+	case "clean":
+		fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+		fs.SetOutput(&bytes.Buffer{})
+		age := fs.String("older-than", "", "only remove the sources which weren't used for longer than this, e.g. 90d")
+		if err := fs.Parse(args); err != nil {
+			return errors.Wrap(err, "cache clean")
+		}
+		args = fs.Args()
+		if *age != "" {
+			var err error
+			if olderThan, err = parseAge(*age); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("unknown cache subcommand %q, must be list, size or clean", sub)
+	}
+
+	// The source manager removes each source under its lock, so that no
+	// other dep process is using it meanwhile.
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	cached, err := sm.CachedSources()
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "list":
+		ctx.Out.Print(formatCachedSources(cached))
+	case "size":
+		var total int64
+		for _, cs := range cached {
+			total += cs.Size
+		}
+		ctx.Out.Printf("%s in %d sources\n", formatSize(total), len(cached))
+	case "clean":
+		removed, err := cleanCache(sm, cached, args, olderThan, time.Now())
+		if err != nil {
+			return err
+		}
+		var freed int64
+		for _, cs := range removed {
+			if ctx.Verbose {
+				ctx.Err.Printf("Removed %s\n", cs.Name)
+			}
+			freed += cs.Size
+		}
+		ctx.Out.Printf("Removed %d sources, freeing %s\n", len(removed), formatSize(freed))
+	}
+	return nil
+}
+
+// cleanCache removes the sources from cached which match any of sources, or
+// all of them if there are none, and which weren't accessed for olderThan
+// before now, if it's set. It returns the sources removed. A source which
+// matches nothing is an error, so that a mistyped one isn't silently kept.
+func cleanCache(sm *gps.SourceMgr, cached []gps.CachedSource, sources []string, olderThan time.Duration, now time.Time) ([]gps.CachedSource, error) {
+	for _, s := range sources {
+		var found bool
+		for _, cs := range cached {
+			found = found || cs.Matches(s)
+		}
+		if !found {
+			return nil, errors.Errorf("%s is not in the cache", s)
+		}
+	}
+
+	var removed []gps.CachedSource
+	for _, cs := range cached {
+		if olderThan > 0 && now.Sub(cs.LastAccess) <= olderThan {
+			continue
+		}
+		if len(sources) > 0 {
+			var match bool
+			for _, s := range sources {
+				match = match || cs.Matches(s)
+			}
+			if !match {
+				continue
+			}
+		}
+		if err := sm.RemoveCachedSource(cs); err != nil {
+			return removed, errors.Wrapf(err, "removing %s from the cache", cs.Name)
+		}
+		removed = append(removed, cs)
+	}
+	return removed, nil
+}
+
+// parseAge parses an age like 90d, in days, or anything time.ParseDuration
+// does, like 12h.
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.Errorf("invalid age %q, must be e.g. 90d or 12h", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid age %q, must be e.g. 90d or 12h", s)
+	}
+	return d, nil
+}
+
+func formatCachedSources(cached []gps.CachedSource) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tSIZE\tLAST ACCESS")
+	for _, cs := range cached {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", cs.Name, formatSize(cs.Size), cs.LastAccess.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// formatSize returns the size of n bytes in the largest unit it's at least one
+// of, e.g. 1.5 MB.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, units := float64(n)/unit, "KMGT"
+	for size >= unit && len(units) > 1 {
+		size, units = size/unit, units[1:]
+	}
+	return fmt.Sprintf("%.1f %cB", size, units[0])
+}
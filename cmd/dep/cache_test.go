@@ -0,0 +1,108 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"90d": 90 * 24 * time.Hour,
+		"0d":  0,
+		"12h": 12 * time.Hour,
+	}
+	for s, want := range cases {
+		if got, err := parseAge(s); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "d", "-1d", "90", "ninetyd", "-1h"} {
+		if _, err := parseAge(s); err == nil {
+			t.Errorf("Expected an error parsing the age %q", s)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KB",
+		1536:            "1.5 KB",
+		5 * 1024 * 1024: "5.0 MB",
+		3 << 40:         "3.0 TB",
+		2048 << 40:      "2048.0 TB",
+	}
+	for n, want := range cases {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestCleanCache(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	now := time.Now()
+	sources := map[string]time.Duration{
+		"https---github.com-foo-old":    100 * 24 * time.Hour,
+		"https---github.com-foo-recent": time.Hour,
+		"https---github.com-foo-other":  200 * 24 * time.Hour,
+	}
+	h.TempDir("cache")
+	for name, age := range sources {
+		h.TempFile(filepath.Join("cache", "sources", name, "file"), "content")
+		then := now.Add(-age)
+		if err := os.Chtimes(h.Path(filepath.Join("cache", "sources", name)), then, then); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sm, err := gps.NewSourceManager(h.Path("cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	list := func() []gps.CachedSource {
+		cached, err := sm.CachedSources()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cached
+	}
+
+	if _, err := cleanCache(sm, list(), []string{"github.com/foo/missing"}, 0, now); err == nil {
+		t.Error("Expected an error cleaning a source which isn't in the cache")
+	}
+	if len(list()) != 3 {
+		t.Fatal("Expected nothing to be removed when a source isn't in the cache")
+	}
+
+	removed, err := cleanCache(sm, list(), []string{"github.com/foo/old", "github.com/foo/recent"}, 90*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Unexpected error cleaning the cache: %s", err)
+	}
+	if len(removed) != 1 || removed[0].Name != "https---github.com-foo-old" {
+		t.Errorf("Expected only the old source to be removed, got %v", removed)
+	}
+
+	removed, err = cleanCache(sm, list(), nil, 0, now)
+	if err != nil {
+		t.Fatalf("Unexpected error cleaning the cache: %s", err)
+	}
+	if len(removed) != 2 || len(list()) != 0 {
+		t.Errorf("Expected all the remaining sources to be removed, got %v", removed)
+	}
+}
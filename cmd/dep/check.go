@@ -0,0 +1,183 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const checkShortHelp = `Check that vendor/ and Gopkg.lock are in sync`
+const checkLongHelp = `
+Check verifies that the project's vendor/ directory holds what Gopkg.lock
+records, and that Gopkg.lock is in sync with Gopkg.toml and the project's
+imports. It stays off the network, so it can be run as part of CI to prove
+that the vendor/ of a change corresponds to its Gopkg.lock.
+
+Each locked project is digested as it is in vendor/, and compared to the
+digest Gopkg.lock records for it, which dep ensure writes whenever it vendors
+the project. Check fails, listing them, if any projects are missing from
+vendor/ or were modified since, or if vendor/ holds anything which isn't a
+locked project. Projects locked by an older dep, which didn't record digests,
+are listed as unverifiable, but don't fail the check; a dep ensure -vendor-only
+records them. Projects in the noverify list of Gopkg.toml, e.g. because they're
+patched locally, are skipped, and entries of it which aren't locked are warned
+about. Check ends with the number of projects which failed, were skipped and
+are ok.
+
+Check is always -strict: problems found in Gopkg.toml, such as unknown fields
+which are likely typos, fail it, rather than being warned about.
+`
+
+type checkCommand struct{}
+
+func (cmd *checkCommand) Name() string      { return "check" }
+func (cmd *checkCommand) Args() string      { return "" }
+func (cmd *checkCommand) ShortHelp() string { return checkShortHelp }
+func (cmd *checkCommand) LongHelp() string  { return checkLongHelp }
+func (cmd *checkCommand) Hidden() bool      { return false }
+
+func (cmd *checkCommand) Register(fs *flag.FlagSet) {}
+
+func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("check takes no arguments")
+	}
+	ctx.Strict = true
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("%s must exist for check to know what vendor/ should hold", dep.LockName)
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
+	defer sm.Release()
+
+	params := p.MakeParams()
+	params.RootPackageTree, err = p.ParseRootPackageTree()
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+	if ctx.Verbose {
+		params.TraceLogger = ctx.Err
+	}
+
+	// The solver is only prepared, to hash its inputs, never run.
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "could not set up solver for input hashing")
+	}
+	inSync := bytes.Equal(s.HashInputs(), p.Lock.InputHash())
+	if !inSync {
+		ctx.Out.Printf("%s is out of sync with %s and the project's imports\n", dep.LockName, dep.ManifestName)
+	}
+
+	for _, pr := range unlockedNoVerify(p.Manifest, p.Lock) {
+		ctx.Err.Printf("Warning: %s is in the noverify list of %s, but is not in %s\n", pr, dep.ManifestName, dep.LockName)
+	}
+
+	verified, err := checkVendor(ctx.Out, filepath.Join(p.AbsRoot, "vendor"), p.Lock, p.Manifest.NoVerifyProjects())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !inSync && !verified:
+		return errors.Errorf("%s is out of sync, and vendor/ does not match it", dep.LockName)
+	case !inSync:
+		return errors.Errorf("%s is out of sync; run dep ensure to update it", dep.LockName)
+	case !verified:
+		return errors.Errorf("vendor/ does not match %s; run dep ensure -vendor-only to restore it", dep.LockName)
+	}
+	return nil
+}
+
+// checkVendor verifies the vendor dir vpath against l, reporting each
+// project which doesn't match, can't be verified, or is skipped as it's in
+// noverify, each path which doesn't belong to a locked project, and the
+// counts of those which failed, were skipped and are ok to out. It reports
+// whether vpath matches l, which unverifiable and skipped projects don't count
+// against.
+func checkVendor(out *log.Logger, vpath string, l *dep.Lock, noverify map[gps.ProjectRoot]bool) (bool, error) {
+	statuses, extraneous, err := dep.VerifyVendor(vpath, l)
+	if err != nil {
+		return false, err
+	}
+
+	roots := make([]string, 0, len(statuses))
+	for pr := range statuses {
+		roots = append(roots, string(pr))
+	}
+	sort.Strings(roots)
+
+	var failed, skipped, ok, unverifiable int
+	for _, pr := range roots {
+		if noverify[gps.ProjectRoot(pr)] {
+			out.Printf("%s: skipped, as it is in the noverify list of %s\n", pr, dep.ManifestName)
+			skipped++
+			continue
+		}
+		switch statuses[gps.ProjectRoot(pr)] {
+		case dep.VendorOK:
+			ok++
+		case dep.VendorMissing:
+			out.Printf("%s: missing from vendor/\n", pr)
+			failed++
+		case dep.VendorModified:
+			out.Printf("%s: modified in vendor/ since dep wrote it\n", pr)
+			failed++
+		case dep.VendorUnverifiable:
+			out.Printf("%s: unverifiable, %s records no digest for it\n", pr, dep.LockName)
+			unverifiable++
+		}
+	}
+	for _, path := range extraneous {
+		out.Printf("vendor/%s: not part of any project in %s\n", path, dep.LockName)
+	}
+
+	summary := fmt.Sprintf("%d failed, %d skipped, %d ok", failed, skipped, ok)
+	if unverifiable > 0 {
+		summary += fmt.Sprintf(", %d unverifiable", unverifiable)
+	}
+	if len(extraneous) > 0 {
+		summary += fmt.Sprintf("; %d extraneous paths", len(extraneous))
+	}
+	out.Printf("vendor/: %s\n", summary)
+	return failed == 0 && len(extraneous) == 0, nil
+}
+
+// unlockedNoVerify returns the entries of the noverify list of m which aren't
+// the roots of any project in l, sorted.
+func unlockedNoVerify(m *dep.Manifest, l *dep.Lock) []string {
+	locked := make(map[gps.ProjectRoot]bool, len(l.Projects()))
+	for _, lp := range l.Projects() {
+		locked[lp.Ident().ProjectRoot] = true
+	}
+
+	var unlocked []string
+	for _, pr := range m.NoVerify {
+		if !locked[gps.ProjectRoot(pr)] {
+			unlocked = append(unlocked, pr)
+		}
+	}
+	sort.Strings(unlocked)
+	return unlocked
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestCheckVendor(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("vendor/github.com/sdboyer/deptest/deptest.go", "package deptest")
+	h.TempFile("vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos")
+	vpath := h.Path("vendor")
+
+	digest, err := fs.DigestTree(filepath.Join(vpath, "github.com", "sdboyer", "deptest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp := func(root string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(root)}, gps.Revision("rev"), nil)
+	}
+	l := &dep.Lock{
+		P:       []gps.LockedProject{lp("github.com/sdboyer/deptest"), lp("github.com/sdboyer/deptestdos")},
+		Digests: map[gps.ProjectRoot]string{"github.com/sdboyer/deptest": digest},
+	}
+
+	// A project without a digest is reported, but can't fail the check.
+	var buf bytes.Buffer
+	verified, err := checkVendor(log.New(&buf, "", 0), vpath, l, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("expected vendor/ to be verified, with only an unverifiable project")
+	}
+	want := "github.com/sdboyer/deptestdos: unverifiable, Gopkg.lock records no digest for it\n" +
+		"vendor/: 0 failed, 0 skipped, 1 ok, 1 unverifiable\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n\t(GOT): %q\n\t(WNT): %q", buf.String(), want)
+	}
+
+	l.Digests["github.com/sdboyer/deptestdos"] = "modified"
+	l.P = append(l.P, lp("github.com/sdboyer/deptesttres"))
+	h.TempFile("vendor/github.com/sdboyer/stray/stray.go", "package stray")
+	buf.Reset()
+	verified, err = checkVendor(log.New(&buf, "", 0), vpath, l, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		t.Error("expected vendor/ not to be verified")
+	}
+	want = "github.com/sdboyer/deptestdos: modified in vendor/ since dep wrote it\n" +
+		"github.com/sdboyer/deptesttres: missing from vendor/\n" +
+		"vendor/github.com/sdboyer/stray: not part of any project in Gopkg.lock\n" +
+		"vendor/: 2 failed, 0 skipped, 1 ok; 1 extraneous paths\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n\t(GOT): %q\n\t(WNT): %q", buf.String(), want)
+	}
+
+	// Projects in noverify are skipped rather than failed.
+	h.Must(os.RemoveAll(h.Path("vendor/github.com/sdboyer/stray")))
+	noverify := map[gps.ProjectRoot]bool{"github.com/sdboyer/deptestdos": true, "github.com/sdboyer/deptesttres": true}
+	buf.Reset()
+	verified, err = checkVendor(log.New(&buf, "", 0), vpath, l, noverify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("expected vendor/ to be verified, with the failing projects skipped")
+	}
+	want = "github.com/sdboyer/deptestdos: skipped, as it is in the noverify list of Gopkg.toml\n" +
+		"github.com/sdboyer/deptesttres: skipped, as it is in the noverify list of Gopkg.toml\n" +
+		"vendor/: 0 failed, 2 skipped, 1 ok\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n\t(GOT): %q\n\t(WNT): %q", buf.String(), want)
+	}
+}
+
+func TestUnlockedNoVerify(t *testing.T) {
+	m := &dep.Manifest{NoVerify: []string{"github.com/foo/gone", "github.com/foo/bar", "github.com/foo/bar/sub"}}
+	l := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.Revision("rev"), nil),
+	}}
+
+	want := []string{"github.com/foo/bar/sub", "github.com/foo/gone"}
+	if got := unlockedNoVerify(m, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected unlocked noverify entries:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
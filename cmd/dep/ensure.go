@@ -5,14 +5,21 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"flag"
+	"fmt"
 	"go/build"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/Masterminds/semver"
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/gps/paths"
@@ -40,6 +47,54 @@ may be passed to bypass these checks; -vendor-only will allow an out-of-date
 Gopkg.lock to populate vendor/, and -no-vendor will update Gopkg.lock (if
 needed), but never touch vendor/.
 
+Ensure records a digest of each project it writes to vendor/, in
+vendor/.dep-manifest. Projects which are still at their locked revision and
+match their digest are not written out again, and if that's all of them,
+vendor/ is left untouched. Pass -force-vendor to write every project anew.
+The digests are recorded in Gopkg.lock too, so that dep check can verify that
+vendor/ matches it.
+
+If a project in vendor/ no longer matches its digest because it was modified,
+e.g. patched by hand to work around a bug, ensure lists the modified projects
+and asks before overwriting them, or fails if it can't ask because stdin isn't
+a terminal. Pass -force-vendor to overwrite them without asking, or
+-keep-modified to leave them as they are while updating the rest of vendor/.
+
+Ensure fails without writing vendor/ if two of the projects or packages it
+would write there differ only in case, as github.com/Sirupsen/logrus and
+github.com/sirupsen/logrus do; they'd collide on case-insensitive filesystems.
+Packages whose import comments, as in package foo // import "example.com/foo",
+name other paths than those they're vendored under are warned about, as they're
+likely imported by the wrong paths; pass -strict to fail instead.
+
+Projects are exported to vendor/ concurrently, as many at once as there are
+CPUs; -export-workers sets how many. Exports from the same source still
+happen one at a time.
+
+With -v, ensure reports on stderr each source it fetches, the solve and how
+many attempts it took, and each project it exports to vendor/, along with how
+long each took, then the total time spent in each of these phases.
+
+Pass -override, as many times as needed, to override a dependency for this run
+only, as an [[override]] in Gopkg.toml would, without editing it; this can
+help when debugging a failure to solve. Gopkg.lock and vendor/ are written
+from the resulting solution, so a plain ensure afterwards solves again
+without the override.
+
+Constraints and overrides of Gopkg.toml which have no effect on the solution,
+e.g. those on projects which are no longer imported, are warned about.
+
+Pass -dry-run, or -n, to solve as usual but only list the projects which would
+be added to, removed from or changed in Gopkg.lock, and how many projects
+vendor/ would be written with, without writing either. Ensure then exits with
+status 2 if anything would change, and 0 otherwise, so it can be used to check
+that Gopkg.lock is up to date, e.g. in CI. Combine it with -update to see what
+updating would do.
+
+If Gopkg.toml has a [prune] section, -dry-run also lists, by project, what
+pruning the projects already in vendor/ would remove from them, and how many
+files and bytes that would reclaim.
+
 The effect of passing project spec arguments varies slightly depending on the
 combination of flags that are passed.
 
@@ -62,15 +117,20 @@ dep ensure
 
 dep ensure -vendor-only
 
-    Write vendor/ from an exising Gopkg.lock file, without first verifying that
-    the lock is in sync with imports and Gopkg.toml. (This may be useful for
-    e.g. strategically layering a Docker images)
+    Write vendor/ from an exising Gopkg.lock file, without solving. Only the
+    locked revisions are fetched, and anything in vendor/ which isn't in the
+    lock is removed. (This may be useful for e.g. strategically layering a
+    Docker images) If the lock is out of sync with imports and Gopkg.toml, a
+    warning is printed; pass -strict to fail instead.
 
 dep ensure -add github.com/pkg/foo github.com/pkg/foo/bar
 
     Introduce one or more dependencies, at their newest version, ensuring that
     specific packages are present in Gopkg.lock and vendor/. Also, append a
-    corresponding constraint to Gopkg.toml.
+    corresponding constraint to Gopkg.toml: a caret constraint on the release
+    that was picked (e.g. ^1.2.0), or its branch if it has no releases. It
+    goes after the last constraint there is, and the rest of Gopkg.toml,
+    comments included, is left as it was.
 
     Note: packages introduced in this way will disappear on the next "dep
     ensure" if an import statement is not added first.
@@ -92,8 +152,25 @@ dep ensure -add github.com/pkg/foo:git.internal.com/alt/foo
 dep ensure -update github.com/pkg/foo github.com/pkg/bar
 
     Update a list of dependencies to the latest versions allowed by Gopkg.toml,
-    ignoring any versions recorded in Gopkg.lock. Write the results to
-    Gopkg.lock and vendor/.
+    ignoring any versions recorded in Gopkg.lock. Every other dependency stays
+    at its locked version. Packages may be named in place of their projects.
+    Write the results to Gopkg.lock and vendor/, and list the projects whose
+    versions changed.
+
+dep ensure -update -patch github.com/pkg/foo
+
+    Update a dependency only as far as the newest patch release of the version
+    recorded in Gopkg.lock (~x.y.z), or with -minor the newest minor release
+    (^x.y.0). Dependencies locked to a branch or a revision are skipped.
+    Gopkg.toml is not modified. Without named dependencies, this applies to
+    every dependency.
+
+dep ensure -update -branches
+
+    Update only the dependencies which Gopkg.toml constrains to a branch, to
+    the current tip of that branch. Every other dependency stays at its
+    locked version. Dependencies whose branch no longer exists upstream are
+    reported and left alone.
 
 dep ensure -update
 
@@ -106,11 +183,30 @@ dep ensure -update -no-vendor
 
     As above, but only modify Gopkg.lock; leave vendor/ unchanged.
 
+dep ensure -keep-modified
+
+    Ensure everything is in sync as usual, except for any projects which have
+    been modified in vendor/ since dep wrote them, which are left as they are.
+
+dep ensure -override github.com/pkg/foo@master
+
+    Temporarily override github.com/pkg/foo to its master branch, as an
+    [[override]] in Gopkg.toml would, without modifying Gopkg.toml. Like
+    -add, it accepts branches, semver ranges and revisions, and an alternate
+    source.
+
+dep ensure -trace-file=trace.json -trace-format=json
+
+    Ensure as usual, writing each step the solver takes, such as a version it
+    rejects along with the constraints it conflicts with, to trace.json as a
+    JSON object per line. Without -trace-format=json, the trace is written as
+    -v prints it.
+
 `
 
 func (cmd *ensureCommand) Name() string { return "ensure" }
 func (cmd *ensureCommand) Args() string {
-	return "[-update | -add] [-no-vendor | -vendor-only] [-dry-run] [<spec>...]"
+	return "[-update | -add] [-no-vendor | -vendor-only] [-force-vendor | -keep-modified] [-override <spec>] [-dry-run] [<spec>...]"
 }
 func (cmd *ensureCommand) ShortHelp() string { return ensureShortHelp }
 func (cmd *ensureCommand) LongHelp() string  { return ensureLongHelp }
@@ -119,20 +215,47 @@ func (cmd *ensureCommand) Hidden() bool      { return false }
 func (cmd *ensureCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.examples, "examples", false, "print detailed usage examples")
 	fs.BoolVar(&cmd.update, "update", false, "update the named dependencies (or all, if none are named) in Gopkg.lock to the latest allowed by Gopkg.toml")
+	fs.BoolVar(&cmd.patch, "patch", false, "with -update, only allow patch releases of the currently locked versions")
+	fs.BoolVar(&cmd.minor, "minor", false, "with -update, only allow minor or patch releases of the currently locked versions")
+	fs.BoolVar(&cmd.branches, "branches", false, "with -update, only update the dependencies constrained to a branch, to its tip")
 	fs.BoolVar(&cmd.add, "add", false, "add new dependencies, or populate Gopkg.toml with constraints for existing dependencies")
 	fs.BoolVar(&cmd.vendorOnly, "vendor-only", false, "populate vendor/ from Gopkg.lock without updating it first")
+	fs.BoolVar(&cmd.strict, "strict", false, "fail instead of warning when Gopkg.toml has problems or vendored packages' import comments disagree with their paths, or, with -vendor-only, when Gopkg.lock is out of sync")
 	fs.BoolVar(&cmd.noVendor, "no-vendor", false, "update Gopkg.lock (if needed), but do not update vendor/")
-	fs.BoolVar(&cmd.dryRun, "dry-run", false, "only report the changes that would be made")
+	fs.BoolVar(&cmd.forceVendor, "force-vendor", false, "write every project to vendor/, even those that are unchanged or were modified there")
+	fs.IntVar(&cmd.exportWorkers, "export-workers", runtime.NumCPU(), "number of projects to export to vendor/ at once")
+	fs.IntVar(&cmd.prefetchWorkers, "prefetch-workers", defaultPrefetchWorkers, "number of projects to list the versions of at once before solving; 0 to skip this, e.g. to save memory")
+	fs.BoolVar(&cmd.keepModified, "keep-modified", false, "leave projects which were modified in vendor/ as they are, only writing the others")
+	fs.Var(&cmd.overrides, "override", "override a dependency for this run only, as <import path>[:alt source URL][@<constraint>]; may be repeated")
+	fs.BoolVar(&cmd.dryRun, "dry-run", false, "only report the changes that would be made, exiting with status 2 if there are any")
+	fs.BoolVar(&cmd.dryRun, "n", false, "shorthand for -dry-run")
+	cmd.trace.register(fs)
 }
 
 type ensureCommand struct {
-	examples   bool
-	update     bool
-	add        bool
-	noVendor   bool
-	vendorOnly bool
-	dryRun     bool
-	overrides  stringSlice
+	examples        bool
+	update          bool
+	patch           bool
+	minor           bool
+	branches        bool
+	add             bool
+	noVendor        bool
+	forceVendor     bool
+	keepModified    bool
+	exportWorkers   int
+	prefetchWorkers int
+	vendorOnly      bool
+	strict          bool
+	dryRun          bool
+	overrides       stringSlice
+	trace           traceOptions
+
+	// progress reports the fetching, solving and writing done with -v.
+	progress *progress
+
+	// confirm asks whether to go ahead with something, confirmOnTerminal if
+	// it's nil. Stubbed by tests.
+	confirm func(ctx *dep.Ctx, question string) bool
 }
 
 func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -145,6 +268,10 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
+	// The -strict of ensure takes the place of the global one, so it makes
+	// problems found in Gopkg.toml errors too.
+	ctx.Strict = ctx.Strict || cmd.strict
+
 	p, err := ctx.LoadProject()
 	if err != nil {
 		return err
@@ -155,18 +282,31 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
 	defer sm.Release()
 
+	if len(cmd.overrides) > 0 {
+		if p.Manifest, err = cmd.applyOverrides(ctx, p.Manifest, sm); err != nil {
+			return err
+		}
+	}
+
 	params := p.MakeParams()
+	closeTrace, err := cmd.trace.apply(ctx, &params)
+	if err != nil {
+		return err
+	}
+	defer closeTrace()
 	if ctx.Verbose {
-		params.TraceLogger = ctx.Err
+		cmd.progress = newProgress(ctx.Err)
+		defer cmd.progress.summarize()
 	}
 
 	if cmd.vendorOnly {
 		return cmd.runVendorOnly(ctx, args, p, sm, params)
 	}
 
-	params.RootPackageTree, err = pkgtree.ListPackages(p.ResolvedAbsRoot, string(p.ImportRoot))
+	params.RootPackageTree, err = p.ParseRootPackageTree()
 	if err != nil {
 		return errors.Wrap(err, "ensure ListPackage for project")
 	}
@@ -174,6 +314,9 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 	if err := checkErrors(params.RootPackageTree.Packages); err != nil {
 		return err
 	}
+	if ctx.Verbose {
+		printRootImports(ctx.Err, p, params.RootPackageTree)
+	}
 
 	if cmd.add {
 		return cmd.runAdd(ctx, args, p, sm, params)
@@ -184,10 +327,30 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 }
 
 func (cmd *ensureCommand) validateFlags() error {
+	if err := cmd.trace.validate(); err != nil {
+		return err
+	}
+
 	if cmd.add && cmd.update {
 		return errors.New("cannot pass both -add and -update")
 	}
 
+	if cmd.patch || cmd.minor {
+		if !cmd.update {
+			return errors.New("-patch and -minor only restrict -update; pass them along with it")
+		}
+		if cmd.branches {
+			return errors.New("-branches only updates dependencies constrained to a branch, which -patch and -minor don't apply to; cannot pass them together")
+		}
+		if cmd.patch && cmd.minor {
+			return errors.New("cannot pass both -patch and -minor")
+		}
+	}
+
+	if cmd.branches && !cmd.update {
+		return errors.New("-branches only restricts -update; pass them along with it")
+	}
+
 	if cmd.vendorOnly {
 		if cmd.update {
 			return errors.New("-vendor-only makes -update a no-op; cannot pass them together")
@@ -196,13 +359,55 @@ func (cmd *ensureCommand) validateFlags() error {
 			return errors.New("-vendor-only makes -add a no-op; cannot pass them together")
 		}
 		if cmd.noVendor {
-			// TODO(sdboyer) can't think of anything not snarky right now
-			return errors.New("really?")
+			return errors.New("-vendor-only populates vendor/ and -no-vendor skips it; cannot pass them together")
+		}
+		if len(cmd.overrides) > 0 {
+			return errors.New("-vendor-only does not solve, so -override would have no effect; cannot pass them together")
+		}
+	}
+	if cmd.exportWorkers < 0 {
+		return errors.New("-export-workers cannot be negative")
+	}
+	if cmd.prefetchWorkers < 0 {
+		return errors.New("-prefetch-workers cannot be negative")
+	}
+	if cmd.forceVendor && cmd.noVendor {
+		return errors.New("-force-vendor writes vendor/ and -no-vendor skips it; cannot pass them together")
+	}
+	if cmd.keepModified {
+		if cmd.noVendor {
+			return errors.New("-keep-modified only applies when writing vendor/, which -no-vendor skips; cannot pass them together")
+		}
+		if cmd.forceVendor {
+			return errors.New("-force-vendor overwrites modified projects in vendor/ and -keep-modified keeps them; cannot pass them together")
 		}
 	}
 	return nil
 }
 
+// vendorBehavior returns when vendor/ should be written after solving: never
+// with -no-vendor, always and in full with -force-vendor, otherwise whenever
+// the lock changes.
+func (cmd *ensureCommand) vendorBehavior() dep.VendorBehavior {
+	if cmd.noVendor {
+		return dep.VendorNever
+	}
+	if cmd.forceVendor {
+		return dep.VendorForce
+	}
+	return dep.VendorOnChanged
+}
+
+// populateVendorBehavior returns how vendor/ should be written from a lock
+// which isn't changing: only the projects which differ from their recorded
+// digests, unless -force-vendor was passed.
+func (cmd *ensureCommand) populateVendorBehavior() dep.VendorBehavior {
+	if cmd.forceVendor {
+		return dep.VendorForce
+	}
+	return dep.VendorAlways
+}
+
 func (cmd *ensureCommand) runDefault(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
 	// Bare ensure doesn't take any args.
 	if len(args) != 0 {
@@ -233,43 +438,409 @@ func (cmd *ensureCommand) runDefault(ctx *dep.Ctx, args []string, p *dep.Project
 		}
 
 		if ctx.Verbose {
-			ctx.Out.Printf("%s was already in sync with imports and %s, recreating vendor/ directory", dep.LockName, dep.ManifestName)
+			ctx.Out.Printf("%s was already in sync with imports and %s, checking vendor/ directory", dep.LockName, dep.ManifestName)
 		}
 
-		// TODO(sdboyer) The desired behavior at this point is to determine
-		// whether it's necessary to write out vendor, or if it's already
-		// consistent with the lock. However, we haven't yet determined what
-		// that "verification" is supposed to look like (#121); in the meantime,
-		// we unconditionally write out vendor/ so that `dep ensure`'s behavior
-		// is maximally compatible with what it will eventually become.
-		sw, err := dep.NewSafeWriter(nil, p.Lock, p.Lock, dep.VendorAlways)
+		// The writer compares vendor/ with the digests recorded when it was
+		// last written, and only exports the projects which differ from the
+		// lock, if any. Prune options aren't among the inputs to the solver,
+		// so the lock is updated if only they changed in the manifest.
+		newLock := *p.Lock
+		newLock.SetPruneOptions(p.Manifest.PruneOptions)
+		sw, err := dep.NewSafeWriter(nil, p.Lock, &newLock, cmd.populateVendorBehavior())
 		if err != nil {
 			return err
 		}
 
+		warnUnusedConstraints(ctx, p, params.RootPackageTree, p.Lock.Projects())
 		if cmd.dryRun {
 			ctx.Out.Printf("Would have populated vendor/ directory from %s", dep.LockName)
-			return nil
+			return printVendorPruneDryRun(ctx.Out, filepath.Join(p.AbsRoot, "vendor"), &newLock)
 		}
 
-		return errors.WithMessage(sw.Write(p.AbsRoot, sm, true), "grouped write of manifest, lock and vendor")
+		return errors.WithMessage(cmd.write(ctx, sw, p, sm, true), "grouped write of manifest, lock and vendor")
 	}
 
-	solution, err := solver.Solve()
+	prefetch(ctx.Context, sm, p, params.RootPackageTree, cmd.prefetchWorkers, cmd.progress)
+	solution, err := cmd.progress.solve(ctx.Context, solver)
 	if err != nil {
 		handleAllTheFailuresOfTheWorld(err)
+		printUnresolvedChains(ctx, sm, p, params.RootPackageTree, err)
 		return errors.Wrap(err, "ensure Solve()")
 	}
+	warnUnusedConstraints(ctx, p, params.RootPackageTree, solution.Projects())
+
+	newLock := dep.LockFromSolution(solution)
+	newLock.SetPruneOptions(p.Manifest.PruneOptions)
+	if cmd.dryRun {
+		return cmd.printVendorDryRun(ctx.Out, p, newLock)
+	}
 
-	sw, err := dep.NewSafeWriter(nil, p.Lock, dep.LockFromSolution(solution), dep.VendorOnChanged)
+	sw, err := dep.NewSafeWriter(nil, p.Lock, newLock, cmd.vendorBehavior())
 	if err != nil {
 		return err
 	}
-	if cmd.dryRun {
-		return sw.PrintPreparedActions(ctx.Out)
+	return errors.Wrap(cmd.write(ctx, sw, p, sm, false), "grouped write of manifest, lock and vendor")
+}
+
+// write writes out sw for the project p, timing it as the writing phase and
+// reporting each project exported to vendor/ with -v. Projects which were
+// modified in vendor/ are kept with -keep-modified, or if they're in the
+// noverify list of the manifest; otherwise they are only overwritten once
+// that's confirmed.
+func (cmd *ensureCommand) write(ctx *dep.Ctx, sw *dep.SafeWriter, p *dep.Project, sm gps.SourceManager, examples bool) error {
+	if cmd.progress != nil {
+		sw.ExportProgress = cmd.progress.export
+	}
+	defer cmd.progress.phase("writing")()
+
+	sw.ExportWorkers = cmd.exportWorkers
+	sw.KeepModified = cmd.keepModified
+	sw.NoVerify = p.Manifest.NoVerifyProjects()
+	skipped := make(map[gps.ProjectRoot]bool)
+	sw.Skipped = func(pr gps.ProjectRoot) {
+		// Write is called again once overwriting is confirmed.
+		if skipped[pr] {
+			return
+		}
+		skipped[pr] = true
+		ctx.Err.Printf("Skipping verification of %s, which is in the noverify list of %s; it was modified in vendor/ and is kept as it is\n", pr, dep.ManifestName)
+	}
+	sw.ImportComments = importCommentsChecker(ctx, ctx.Strict)
+	err := sw.Write(p.AbsRoot, sm, examples)
+	merr, ok := err.(*dep.ModifiedVendorError)
+	if !ok {
+		return err
+	}
+
+	ctx.Err.Println("Warning: these projects were modified in vendor/ since dep wrote them, and would be overwritten:")
+	for _, pr := range merr.Projects {
+		ctx.Err.Printf("  %s\n", pr)
+	}
+	confirm := cmd.confirm
+	if confirm == nil {
+		confirm = confirmOnTerminal
+	}
+	if !confirm(ctx, "Overwrite them?") {
+		return errors.New("modified projects in vendor/ were not overwritten; pass -force-vendor to overwrite them, or -keep-modified to leave them as they are")
+	}
+	sw.OverwriteModified = true
+	return sw.Write(p.AbsRoot, sm, examples)
+}
+
+// importCommentsChecker returns a dep.SafeWriter.ImportComments which warns of
+// the packages whose import comments disagree with the paths they're vendored
+// under, or, if strict, fails with them.
+func importCommentsChecker(ctx *dep.Ctx, strict bool) func([]dep.ImportCommentMismatch) error {
+	return func(mismatches []dep.ImportCommentMismatch) error {
+		var buf bytes.Buffer
+		for _, m := range mismatches {
+			fmt.Fprintf(&buf, "\n\t%s has the import comment %q", m.ImportPath, m.Comment)
+		}
+		if strict {
+			return errors.Errorf("these packages would be vendored under paths other than their import comments name:%s\nimport them by the paths their comments name instead", buf.String())
+		}
+		ctx.Err.Printf("Warning: these packages are vendored under paths other than their import comments name, and are likely imported by the wrong paths:%s\n", buf.String())
+		return nil
+	}
+}
+
+// confirmOnTerminal asks question on ctx.Err, and reports whether it's
+// answered yes on stdin. Without a terminal to ask on, e.g. in CI, nothing is
+// confirmed.
+func confirmOnTerminal(ctx *dep.Ctx, question string) bool {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	ctx.Err.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// applyOverrides returns a copy of the manifest m with the overrides passed
+// with -override added, in place of any it has on the same projects. They
+// only last for this run, so a notice is printed for each of them.
+func (cmd *ensureCommand) applyOverrides(ctx *dep.Ctx, m *dep.Manifest, sm gps.SourceManager) (*dep.Manifest, error) {
+	om := *m
+	om.Ovr = make(gps.ProjectConstraints, len(m.Ovr)+len(cmd.overrides))
+	for pr, pp := range m.Ovr {
+		om.Ovr[pr] = pp
+	}
+
+	for _, arg := range cmd.overrides {
+		pc, _, err := getProjectConstraint(arg, sm)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid -override %q", arg)
+		}
+
+		om.Ovr[pc.Ident.ProjectRoot] = gps.ProjectProperties{
+			Source:     pc.Ident.Source,
+			Constraint: pc.Constraint,
+		}
+
+		var what []string
+		if !gps.IsAny(pc.Constraint) {
+			what = append(what, pc.Constraint.String())
+		}
+		if pc.Ident.Source != "" {
+			what = append(what, "from "+pc.Ident.Source)
+		}
+		if len(what) == 0 {
+			what = append(what, "any version")
+		}
+		ctx.Err.Printf("NOTICE: Temporarily overriding %s (%s) for this run only; %s is unchanged.\n", pc.Ident.ProjectRoot, strings.Join(what, ", "), dep.ManifestName)
+	}
+	return &om, nil
+}
+
+// restrictUpdateLevel returns a copy of the project's manifest in which the
+// constraints on the projects being updated, or on every locked project if
+// none were named, are narrowed per -patch or -minor around their locked
+// versions. Projects which aren't locked to a semver release are left alone,
+// and listed as skipped.
+func (cmd *ensureCommand) restrictUpdateLevel(ctx *dep.Ctx, p *dep.Project, roots []gps.ProjectRoot) *dep.Manifest {
+	m := *p.Manifest
+	m.Constraints = make(gps.ProjectConstraints, len(p.Manifest.Constraints))
+	for pr, pp := range p.Manifest.Constraints {
+		m.Constraints[pr] = pp
+	}
+	m.Ovr = make(gps.ProjectConstraints, len(p.Manifest.Ovr))
+	for pr, pp := range p.Manifest.Ovr {
+		m.Ovr[pr] = pp
+	}
+
+	targets := make(map[gps.ProjectRoot]bool)
+	for _, pr := range roots {
+		targets[pr] = true
+	}
+
+	for _, lp := range p.Lock.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if len(targets) > 0 && !targets[pr] {
+			continue
+		}
+
+		c, ok := updateLevelConstraint(lp.Version(), cmd.minor)
+		if !ok {
+			ctx.Err.Printf("Skipping %s, which is locked to %s rather than a semver release\n", pr, formatLockedVersion(lp))
+			continue
+		}
+
+		// An override, or a constraint for a direct dependency, is narrowed.
+		// Otherwise the project is transitive, and only an override can
+		// reach it; the locked version already satisfies what the other
+		// projects require of it, and the range kept around it is small.
+		if pp, has := m.Ovr[pr]; has {
+			m.Ovr[pr] = intersectProperties(pp, c)
+		} else if pp, has := m.Constraints[pr]; has {
+			m.Constraints[pr] = intersectProperties(pp, c)
+		} else {
+			m.Ovr[pr] = gps.ProjectProperties{Source: lp.Ident().Source, Constraint: c}
+		}
+	}
+
+	return &m
+}
+
+// intersectProperties narrows the constraint of pp by c.
+func intersectProperties(pp gps.ProjectProperties, c gps.Constraint) gps.ProjectProperties {
+	if pp.Constraint == nil {
+		pp.Constraint = c
+	} else {
+		pp.Constraint = pp.Constraint.Intersect(c)
+	}
+	return pp
+}
+
+// updateLevelConstraint returns the constraint to which -patch or -minor
+// restricts a project locked at v: ~x.y.z for -patch and ^x.y.0 for -minor.
+// It returns false if v isn't a semver release.
+func updateLevelConstraint(v gps.Version, minor bool) (gps.Constraint, bool) {
+	if pv, ok := v.(gps.PairedVersion); ok {
+		v = pv.Unpair()
+	}
+	if v == nil || v.Type() != gps.IsSemver {
+		return nil, false
+	}
+
+	sv, err := semver.NewVersion(v.String())
+	if err != nil {
+		return nil, false
+	}
+
+	body := fmt.Sprintf("~%d.%d.%d", sv.Major(), sv.Minor(), sv.Patch())
+	if minor {
+		body = fmt.Sprintf("^%d.%d.0", sv.Major(), sv.Minor())
+	}
+	c, err := gps.NewSemverConstraint(body)
+	if err != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// dryRunPendingError is returned by -dry-run when ensure would have changed
+// something. dep then exits with status 2, so that a dry run can guard against
+// a stale lock or vendor/ in CI.
+type dryRunPendingError struct{}
+
+func (dryRunPendingError) Error() string {
+	return "changes are pending, run dep ensure without -dry-run to apply them"
+}
+
+func (dryRunPendingError) ExitCode() int { return 2 }
+
+// printDryRun reports what writing newLock over the lock of p would change:
+// the projects added to, removed from or changed in the lock, and how many
+// projects would be written to vendor/. It returns a dryRunPendingError if
+// anything would change.
+func (cmd *ensureCommand) printDryRun(out *log.Logger, p *dep.Project, newLock *dep.Lock) error {
+	oldLock := p.Lock
+	if oldLock != nil {
+		diff := gps.DiffLocks(oldLock, newLock)
+		if diff == nil {
+			out.Printf("%s is up to date, nothing would be changed\n", dep.LockName)
+			return nil
+		}
+		if diff.HashDiff != nil && len(diff.Add) == 0 && len(diff.Remove) == 0 && len(diff.Modify) == 0 {
+			out.Printf("Would have updated the inputs-digest of %s, but no locked projects\n", dep.LockName)
+			return dryRunPendingError{}
+		}
+	}
+
+	out.Printf("Would have written the following changes to %s:\n", dep.LockName)
+	printLockChanges(out, oldLock, newLock)
+	if !cmd.noVendor {
+		// Projects still in vendor/ at their locked revision, or kept there
+		// as they were modified, are carried over rather than written again.
+		sw, err := dep.NewSafeWriter(nil, oldLock, newLock, cmd.vendorBehavior())
+		if err != nil {
+			return err
+		}
+		sw.KeepModified = cmd.keepModified
+		sw.NoVerify = p.Manifest.NoVerifyProjects()
+		out.Printf("Would have written %d project(s) to vendor/\n", len(sw.VendorProjectsToWrite(p.AbsRoot)))
 	}
+	return dryRunPendingError{}
+}
 
-	return errors.Wrap(sw.Write(p.AbsRoot, sm, false), "grouped write of manifest, lock and vendor")
+// printVendorDryRun reports, as printDryRun does, what writing newLock over
+// the lock of p would change, then what pruning vendor/ would remove.
+func (cmd *ensureCommand) printVendorDryRun(out *log.Logger, p *dep.Project, newLock *dep.Lock) error {
+	err := cmd.printDryRun(out, p, newLock)
+	if cmd.noVendor {
+		return err
+	}
+	if perr := printVendorPruneDryRun(out, filepath.Join(p.AbsRoot, "vendor"), newLock); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// printVendorPruneDryRun lists what pruning the projects in the vendor dir
+// vpath with the options l records for them would remove. Projects which
+// aren't in vpath yet are left out, as are those which aren't pruned.
+func printVendorPruneDryRun(out *log.Logger, vpath string, l *dep.Lock) error {
+	if len(l.PruneOpts) == 0 {
+		return nil
+	}
+
+	pruned := make(map[gps.ProjectRoot]gps.PruneResult)
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		po := l.PruneOptionsFor(pr)
+		dir := filepath.Join(vpath, filepath.FromSlash(string(pr)))
+		if po == 0 {
+			continue
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		r, err := gps.CalculatePrune(dir, lp, po)
+		if err != nil {
+			return errors.Wrapf(err, "could not calculate what pruning %s would remove", pr)
+		}
+		pruned[pr] = r
+	}
+	printPruneSummary(out, pruned, true)
+	return nil
+}
+
+// printLockChanges logs the projects whose version differs between the old
+// and new locks, one per line, leaving out those which didn't change. A nil
+// oldLock is treated as empty.
+func printLockChanges(out *log.Logger, oldLock, newLock *dep.Lock) {
+	if oldLock == nil {
+		oldLock = &dep.Lock{}
+	}
+	diff := gps.DiffLocks(oldLock, newLock)
+	if diff == nil {
+		return
+	}
+
+	oldProjects := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, lp := range oldLock.Projects() {
+		oldProjects[lp.Ident().ProjectRoot] = lp
+	}
+	newProjects := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, lp := range newLock.Projects() {
+		newProjects[lp.Ident().ProjectRoot] = lp
+	}
+
+	for _, pd := range diff.Add {
+		out.Printf("Added %s at %s\n", pd.Name, formatLockedVersion(newProjects[pd.Name]))
+	}
+	for _, pd := range diff.Remove {
+		out.Printf("Removed %s\n", pd.Name)
+	}
+	for _, pd := range diff.Modify {
+		if pd.Version == nil && pd.Branch == nil && pd.Revision == nil {
+			if len(pd.Packages) > 0 {
+				out.Printf("Changed the packages used from %s\n", pd.Name)
+			}
+			if pd.VCS != nil || pd.URL != nil || pd.DefaultBranch != nil {
+				out.Printf("Changed the origin of %s to %s\n", pd.Name, formatOrigin(newProjects[pd.Name].Origin()))
+			}
+			continue
+		}
+		out.Printf("Updated %s from %s to %s\n", pd.Name, formatLockedVersion(oldProjects[pd.Name]), formatLockedVersion(newProjects[pd.Name]))
+	}
+}
+
+// formatLockedVersion returns the version and abbreviated revision of lp,
+// e.g. "v1.0.0 (ff2948a)".
+func formatLockedVersion(lp gps.LockedProject) string {
+	rev, branch, version := gps.VersionComponentStrings(lp.Version())
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	switch {
+	case version != "":
+		return fmt.Sprintf("%s (%s)", version, rev)
+	case branch != "":
+		return fmt.Sprintf("branch %s (%s)", branch, rev)
+	default:
+		return rev
+	}
+}
+
+// formatOrigin returns the type and URL of the source of a locked project, and
+// its default branch if it's recorded, e.g. "git https://github.com/foo/bar
+// (default branch master)".
+func formatOrigin(o gps.ProjectOrigin) string {
+	s := strings.TrimSpace(o.VCS + " " + o.URL)
+	if s == "" {
+		s = "unknown"
+	}
+	if o.DefaultBranch != "" {
+		s += fmt.Sprintf(" (default branch %s)", o.DefaultBranch)
+	}
+	return s
 }
 
 func (cmd *ensureCommand) runVendorOnly(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
@@ -280,9 +851,31 @@ func (cmd *ensureCommand) runVendorOnly(ctx *dep.Ctx, args []string, p *dep.Proj
 	if p.Lock == nil {
 		return errors.Errorf("no %s exists from which to populate vendor/", dep.LockName)
 	}
+
+	// Only the inputs hash is needed to tell whether the lock is in sync, so
+	// the solver is prepared, which is cheap and stays off the network, but
+	// never run.
+	var err error
+	params.RootPackageTree, err = p.ParseRootPackageTree()
+	if err != nil {
+		return errors.Wrap(err, "ensure ListPackage for project")
+	}
+	solver, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "prepare solver")
+	}
+	if !bytes.Equal(p.Lock.InputHash(), solver.HashInputs()) {
+		if cmd.strict {
+			return errors.Errorf("%s is out of sync with %s and the project's imports; run a plain dep ensure to update it before -vendor-only", dep.LockName, dep.ManifestName)
+		}
+		ctx.Err.Printf("\nWARNING: %s is out of sync with %s and the project's imports.\n", dep.LockName, dep.ManifestName)
+		ctx.Err.Printf("vendor/ is populated from %s as it is; run a plain dep ensure to update it.\n\n", dep.LockName)
+	}
+
 	// Pass the same lock as old and new so that the writer will observe no
-	// difference and choose not to write it out.
-	sw, err := dep.NewSafeWriter(nil, p.Lock, p.Lock, dep.VendorAlways)
+	// difference and choose not to write it out, unless the digests it
+	// records of vendor/ change.
+	sw, err := dep.NewSafeWriter(nil, p.Lock, p.Lock, cmd.populateVendorBehavior())
 	if err != nil {
 		return err
 	}
@@ -292,7 +885,7 @@ func (cmd *ensureCommand) runVendorOnly(ctx *dep.Ctx, args []string, p *dep.Proj
 		return nil
 	}
 
-	return errors.WithMessage(sw.Write(p.AbsRoot, sm, true), "grouped write of manifest, lock and vendor")
+	return errors.WithMessage(cmd.write(ctx, sw, p, sm, true), "grouped write of manifest, lock and vendor")
 }
 
 func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
@@ -318,43 +911,72 @@ func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project,
 		return errors.Errorf("%s and %s are out of sync. Run a plain dep ensure to resync them before attempting to -update", dep.ManifestName, dep.LockName)
 	}
 
-	// When -update is specified without args, allow every dependency to change
-	// versions, regardless of the lock file.
-	if len(args) == 0 {
+	var branchRoots []gps.ProjectRoot
+	if cmd.branches {
+		if len(args) != 0 {
+			return errors.New("-branches updates every dependency constrained to a branch; it takes no spec arguments")
+		}
+		branchRoots = cmd.branchProjects(ctx, p, sm)
+		if len(branchRoots) == 0 {
+			ctx.Out.Println("No dependencies constrained to a branch to update")
+			return nil
+		}
+		params.ToChange = branchRoots
+	} else if len(args) == 0 {
+		// When -update is specified without args, allow every dependency to
+		// change versions, regardless of the lock file.
 		params.ChangeAll = true
 	}
 
 	// Allow any of specified project versions to change, regardless of the lock
-	// file.
+	// file. Every argument is checked before solving, so that all the bad ones
+	// can be reported at once.
+	var errs []string
+	toChange := make(map[gps.ProjectRoot]bool)
 	for _, arg := range args {
 		// Ensure the provided path has a deducible project root
 		// TODO(sdboyer) do these concurrently
-		pc, path, err := getProjectConstraint(arg, sm)
+		pc, _, err := getProjectConstraint(arg, sm)
 		if err != nil {
-			// TODO(sdboyer) return all errors, not just the first one we encounter
 			// TODO(sdboyer) ensure these errors are contextualized in a sensible way for -update
-			return err
-		}
-		if path != string(pc.Ident.ProjectRoot) {
-			// TODO(sdboyer): does this really merit an abortive error?
-			return errors.Errorf("%s is not a project root, try %s instead", path, pc.Ident.ProjectRoot)
+			errs = append(errs, err.Error())
+			continue
 		}
 
 		if !p.Lock.HasProjectWithRoot(pc.Ident.ProjectRoot) {
-			return errors.Errorf("%s is not present in %s, cannot -update it", pc.Ident.ProjectRoot, dep.LockName)
+			errs = append(errs, fmt.Sprintf("%s is not present in %s, cannot -update it", pc.Ident.ProjectRoot, dep.LockName))
+			continue
 		}
 
 		if pc.Ident.Source != "" {
-			return errors.Errorf("cannot specify alternate sources on -update (%s)", pc.Ident.Source)
+			errs = append(errs, fmt.Sprintf("cannot specify alternate sources on -update (%s)", pc.Ident.Source))
+			continue
 		}
 
 		if !gps.IsAny(pc.Constraint) {
 			// TODO(sdboyer) constraints should be allowed to allow solves that
 			// target particular versions while remaining within declared constraints
-			return errors.Errorf("version constraint %s passed for %s, but -update follows constraints declared in %s, not CLI arguments", pc.Constraint, pc.Ident.ProjectRoot, dep.ManifestName)
+			errs = append(errs, fmt.Sprintf("version constraint %s passed for %s, but -update follows constraints declared in %s, not CLI arguments", pc.Constraint, pc.Ident.ProjectRoot, dep.ManifestName))
+			continue
+		}
+
+		// Subpackages unlock the project they belong to.
+		if !toChange[pc.Ident.ProjectRoot] {
+			toChange[pc.Ident.ProjectRoot] = true
+			params.ToChange = append(params.ToChange, pc.Ident.ProjectRoot)
 		}
+	}
 
-		params.ToChange = append(params.ToChange, gps.ProjectRoot(arg))
+	switch len(errs) {
+	case 0:
+	case 1:
+		return errors.New(errs[0])
+	default:
+		return errors.Errorf("invalid -update arguments:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+
+	if cmd.patch || cmd.minor {
+		params.Manifest = cmd.restrictUpdateLevel(ctx, p, params.ToChange)
 	}
 
 	// Re-prepare a solver now that our params are complete.
@@ -362,24 +984,157 @@ func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project,
 	if err != nil {
 		return errors.Wrap(err, "fastpath solver prepare")
 	}
-	solution, err := solver.Solve()
+	prefetch(ctx.Context, sm, p, params.RootPackageTree, cmd.prefetchWorkers, cmd.progress)
+	solution, err := cmd.progress.solve(ctx.Context, solver)
 	if err != nil {
 		// TODO(sdboyer) special handling for warning cases as described in spec
 		// - e.g., named projects did not upgrade even though newer versions
 		// were available.
 		handleAllTheFailuresOfTheWorld(err)
+		printUnresolvedChains(ctx, sm, p, params.RootPackageTree, err)
 		return errors.Wrap(err, "ensure Solve()")
 	}
 
-	sw, err := dep.NewSafeWriter(nil, p.Lock, dep.LockFromSolution(solution), dep.VendorOnChanged)
+	newLock := dep.LockFromSolution(solution)
+	newLock.SetPruneOptions(p.Manifest.PruneOptions)
+	if cmd.patch || cmd.minor {
+		// The restricted constraints only existed for this solve; the lock
+		// still reflects the manifest on disk.
+		newLock.SolveMeta.InputsDigest = p.Lock.SolveMeta.InputsDigest
+	}
+	if cmd.dryRun {
+		return cmd.printVendorDryRun(ctx.Out, p, newLock)
+	}
+
+	sw, err := dep.NewSafeWriter(nil, p.Lock, newLock, cmd.vendorBehavior())
 	if err != nil {
 		return err
 	}
-	if cmd.dryRun {
-		return sw.PrintPreparedActions(ctx.Out)
+
+	if err := cmd.write(ctx, sw, p, sm, false); err != nil {
+		return errors.Wrap(err, "grouped write of manifest, lock and vendor")
+	}
+
+	if cmd.branches {
+		printBranchUpdates(ctx.Out, sm.RevisionTime, p.Lock, newLock, branchRoots)
+	} else {
+		printLockChanges(ctx.Out, p.Lock, newLock)
+	}
+	return nil
+}
+
+// branchProjects returns the locked projects which the manifest constrains to
+// a branch, and so which -update -branches moves to the tip of it. Those whose
+// branch can't be found upstream any more are reported and left alone.
+func (cmd *ensureCommand) branchProjects(ctx *dep.Ctx, p *dep.Project, sm gps.SourceManager) []gps.ProjectRoot {
+	var roots []gps.ProjectRoot
+	for _, lp := range p.Lock.Projects() {
+		id := lp.Ident()
+		branch, ok := branchConstraint(p.Manifest, id.ProjectRoot)
+		if !ok {
+			continue
+		}
+
+		versions, err := sm.ListVersions(id)
+		if err != nil {
+			ctx.Err.Printf("Skipping %s, as its versions could not be listed: %s\n", id.ProjectRoot, err)
+			continue
+		}
+		exists := false
+		for _, v := range versions {
+			if v.Type() == gps.IsBranch && v.String() == branch {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			ctx.Err.Printf("Skipping %s, as its branch %s no longer exists upstream\n", id.ProjectRoot, branch)
+			continue
+		}
+
+		roots = append(roots, id.ProjectRoot)
+	}
+	return roots
+}
+
+// branchConstraint returns the branch which the manifest m constrains the
+// project pr to, by an override or else a constraint, if it's a branch.
+func branchConstraint(m *dep.Manifest, pr gps.ProjectRoot) (string, bool) {
+	pp, has := m.Ovr[pr]
+	if !has {
+		pp, has = m.Constraints[pr]
+	}
+	if !has {
+		return "", false
+	}
+	if v, ok := pp.Constraint.(gps.Version); ok && v.Type() == gps.IsBranch {
+		return v.String(), true
+	}
+	return "", false
+}
+
+// printBranchUpdates logs the old and new revisions, and their commit dates,
+// of the projects in roots which -update -branches moved to the tip of their
+// branch, followed by the changes to any other projects. revisionTime looks up
+// when a revision was committed.
+func printBranchUpdates(out *log.Logger, revisionTime func(gps.ProjectIdentifier, gps.Revision) (time.Time, error), oldLock, newLock *dep.Lock, roots []gps.ProjectRoot) {
+	oldProjects := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, lp := range oldLock.Projects() {
+		oldProjects[lp.Ident().ProjectRoot] = lp
+	}
+	newProjects := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, lp := range newLock.Projects() {
+		newProjects[lp.Ident().ProjectRoot] = lp
+	}
+
+	updated := make(map[gps.ProjectRoot]bool, len(roots))
+	for _, pr := range roots {
+		updated[pr] = true
+		olp := oldProjects[pr]
+		nlp, has := newProjects[pr]
+		if !has {
+			out.Printf("Removed %s\n", pr)
+			continue
+		}
+
+		oldRev, _, _ := gps.VersionComponentStrings(olp.Version())
+		newRev, branch, _ := gps.VersionComponentStrings(nlp.Version())
+		if oldRev == newRev {
+			out.Printf("%s is at the tip of branch %s already, %s\n", pr, branch, formatRevisionDate(revisionTime, nlp.Ident(), gps.Revision(newRev)))
+			continue
+		}
+		out.Printf("Updated %s on branch %s from %s to %s\n", pr, branch,
+			formatRevisionDate(revisionTime, olp.Ident(), gps.Revision(oldRev)),
+			formatRevisionDate(revisionTime, nlp.Ident(), gps.Revision(newRev)))
+	}
+
+	// Anything else which changed did so as a result, e.g. because the new
+	// tips of the branches import more projects.
+	others := func(l *dep.Lock) *dep.Lock {
+		ol := &dep.Lock{}
+		for _, lp := range l.Projects() {
+			if !updated[lp.Ident().ProjectRoot] {
+				ol.P = append(ol.P, lp)
+			}
+		}
+		return ol
 	}
+	printLockChanges(out, others(oldLock), others(newLock))
+}
 
-	return errors.Wrap(sw.Write(p.AbsRoot, sm, false), "grouped write of manifest, lock and vendor")
+// formatRevisionDate returns the abbreviated revision r of the project id,
+// with the date it was committed if that can be found, e.g.
+// "ff2948a (2017-05-31)".
+func formatRevisionDate(revisionTime func(gps.ProjectIdentifier, gps.Revision) (time.Time, error), id gps.ProjectIdentifier, r gps.Revision) string {
+	short := string(r)
+	if len(short) > 7 {
+		short = short[:7]
+	}
+	t, err := revisionTime(id, r)
+	if err != nil {
+		return short
+	}
+	return fmt.Sprintf("%s (%s)", short, t.UTC().Format("2006-01-02"))
 }
 
 func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
@@ -405,7 +1160,7 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 		return errors.Errorf("%s and %s are out of sync. Run a plain dep ensure to resync them before attempting to -add", dep.ManifestName, dep.LockName)
 	}
 
-	rm, _ := params.RootPackageTree.ToReachMap(true, true, false, p.Manifest.IgnoredPackages())
+	rm, _ := params.RootPackageTree.ToReachMap(true, !p.Manifest.ExcludeTests, false, p.Manifest.IgnoredPackages())
 
 	// TODO(sdboyer) re-enable this once we ToReachMap() intelligently filters out normally-excluded (_*, .*), dirs from errmap
 	//rm, errmap := params.RootPackageTree.ToReachMap(true, true, false, p.Manifest.IgnoredPackages())
@@ -568,10 +1323,12 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	if err != nil {
 		return errors.Wrap(err, "fastpath solver prepare")
 	}
-	solution, err := solver.Solve()
+	prefetch(ctx.Context, sm, p, params.RootPackageTree, cmd.prefetchWorkers, cmd.progress)
+	solution, err := cmd.progress.solve(ctx.Context, solver)
 	if err != nil {
 		// TODO(sdboyer) detect if the failure was specifically about some of the -add arguments
 		handleAllTheFailuresOfTheWorld(err)
+		printUnresolvedChains(ctx, sm, p, params.RootPackageTree, err)
 		return errors.Wrap(err, "ensure Solve()")
 	}
 
@@ -580,6 +1337,10 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	appender := &dep.Manifest{
 		Constraints: make(gps.ProjectConstraints),
 	}
+	solved := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, lp := range solution.Projects() {
+		solved[lp.Ident().ProjectRoot] = lp
+	}
 	for pr, instr := range addInstructions {
 		for path := range instr.ephReq {
 			reqlist = append(reqlist, path)
@@ -590,8 +1351,14 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 				Source:     instr.id.Source,
 				Constraint: instr.constraint,
 			}
-			//} else {
-			// TODO(sdboyer) hoist a constraint into the manifest from the lock
+		} else if instr.typ&isInManifest == 0 {
+			// No constraint was given, so hoist one from the version the
+			// solver picked: a caret constraint for a release, or the branch.
+			if lp, has := solved[pr]; has {
+				if pp := getProjectPropertiesFromVersion(lp.Version()); pp.Constraint != nil {
+					appender.Constraints[pr] = pp
+				}
+			}
 		}
 	}
 
@@ -601,27 +1368,44 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	}
 	sort.Strings(reqlist)
 
-	sw, err := dep.NewSafeWriter(nil, p.Lock, dep.LockFromSolution(solution), dep.VendorOnChanged)
-	if err != nil {
+	newLock := dep.LockFromSolution(solution)
+	newLock.SetPruneOptions(p.Manifest.PruneOptions)
+	if cmd.dryRun {
+		if len(appender.Constraints) > 0 {
+			ctx.Out.Printf("Would have appended the following to %s:\n%s\n", dep.ManifestName, extra)
+		}
+		err := cmd.printVendorDryRun(ctx.Out, p, newLock)
+		if err == nil && len(appender.Constraints) > 0 {
+			return dryRunPendingError{}
+		}
 		return err
 	}
 
-	if cmd.dryRun {
-		return sw.PrintPreparedActions(ctx.Out)
+	sw, err := dep.NewSafeWriter(nil, p.Lock, newLock, cmd.vendorBehavior())
+	if err != nil {
+		return err
 	}
 
-	if err := errors.Wrap(sw.Write(p.AbsRoot, sm, true), "grouped write of manifest, lock and vendor"); err != nil {
+	if err := errors.Wrap(cmd.write(ctx, sw, p, sm, true), "grouped write of manifest, lock and vendor"); err != nil {
 		return err
 	}
 
-	// FIXME(sdboyer) manifest writes ABSOLUTELY need verification - follow up!
-	f, err := os.OpenFile(filepath.Join(p.AbsRoot, dep.ManifestName), os.O_APPEND|os.O_WRONLY, 0666)
+	// The new constraints are edited into the manifest, leaving the rest of
+	// it, comments and all, as it was.
+	mpath := filepath.Join(p.AbsRoot, dep.ManifestName)
+	orig, err := ioutil.ReadFile(mpath)
 	if err != nil {
-		return errors.Wrapf(err, "opening %s failed", dep.ManifestName)
+		return errors.Wrapf(err, "reading %s failed", dep.ManifestName)
 	}
-
-	if _, err := f.Write(extra); err != nil {
-		f.Close()
+	edited, err := dep.EditManifest(orig, func(m *dep.Manifest) {
+		for pr, pp := range appender.Constraints {
+			m.Constraints[pr] = pp
+		}
+	})
+	if err != nil {
+		return errors.Wrapf(err, "editing %s failed", dep.ManifestName)
+	}
+	if err := ioutil.WriteFile(mpath, edited, 0666); err != nil {
 		return errors.Wrapf(err, "writing to %s failed", dep.ManifestName)
 	}
 
@@ -648,7 +1432,7 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 		}
 	}
 
-	return errors.Wrapf(f.Close(), "closing %s", dep.ManifestName)
+	return nil
 }
 
 type stringSlice []string
@@ -703,6 +1487,25 @@ func getProjectConstraint(arg string, sm gps.SourceManager) (gps.ProjectConstrai
 	return gps.ProjectConstraint{Ident: pi, Constraint: c}, arg, nil
 }
 
+// warnUnusedConstraints warns about the constraints and overrides of the
+// manifest which have no effect on the solved projects lps.
+func warnUnusedConstraints(ctx *dep.Ctx, p *dep.Project, ptree pkgtree.PackageTree, lps []gps.LockedProject) {
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.ExcludeTests, false, p.Manifest.IgnoredPackages())
+	imported := make(map[string]bool)
+	for _, ip := range rm.FlattenFn(paths.IsStandardImportPath) {
+		imported[ip] = true
+	}
+
+	unused := findUnusedConstraints(p.Manifest, lps, imported)
+	if len(unused) == 0 {
+		return
+	}
+	ctx.Err.Printf("Warning: %s has constraints or overrides which have no effect:\n", dep.ManifestName)
+	for _, uc := range unused {
+		ctx.Err.Printf("  %s on %s: %s\n", uc.kind(), uc.ProjectRoot, uc.Reason)
+	}
+}
+
 func checkErrors(m map[string]pkgtree.PackageOrErr) error {
 	var (
 		buildErrors []string
@@ -5,12 +5,24 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"go/build"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
 )
 
 func TestInvalidEnsureFlagCombinations(t *testing.T) {
@@ -39,6 +51,79 @@ func TestInvalidEnsureFlagCombinations(t *testing.T) {
 	}
 	ec.noVendor = false
 
+	ec.vendorOnly = false
+	for _, other := range []*bool{&ec.update, &ec.add} {
+		ec.noVendor, *other = true, true
+		if err := ec.validateFlags(); err != nil {
+			t.Errorf("-no-vendor should compose with -update and -add, got %s", err)
+		}
+		if ec.vendorBehavior() != dep.VendorNever {
+			t.Error("-no-vendor should never write vendor/")
+		}
+		*other = false
+	}
+	ec.noVendor = false
+
+	ec.patch = true
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-patch without -update should fail validation")
+	}
+
+	ec.update, ec.minor = true, true
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-patch with -minor should fail validation")
+	}
+	ec.update, ec.patch, ec.minor = false, false, false
+
+	ec.branches = true
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-branches without -update should fail validation")
+	}
+	ec.update, ec.minor = true, true
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-branches with -minor should fail validation")
+	}
+	ec.minor = false
+	if err := ec.validateFlags(); err != nil {
+		t.Errorf("-branches with -update should pass validation, got %s", err)
+	}
+	ec.update, ec.branches = false, false
+
+	ec.keepModified = true
+	if err := ec.validateFlags(); err != nil {
+		t.Errorf("-keep-modified should pass validation, got %s", err)
+	}
+	for _, other := range []*bool{&ec.noVendor, &ec.forceVendor} {
+		*other = true
+		if err := ec.validateFlags(); err == nil {
+			t.Error("-keep-modified with -no-vendor or -force-vendor should fail validation")
+		}
+		*other = false
+	}
+	ec.keepModified = false
+
+	ec.exportWorkers = -1
+	if err := ec.validateFlags(); err == nil {
+		t.Error("a negative -export-workers should fail validation")
+	}
+	ec.exportWorkers = 0
+
+	ec.strict = true
+	if err := ec.validateFlags(); err != nil {
+		t.Errorf("-strict without -vendor-only should pass validation, got %s", err)
+	}
+	ec.vendorOnly = true
+	if err := ec.validateFlags(); err != nil {
+		t.Errorf("-strict with -vendor-only should pass validation, got %s", err)
+	}
+	ec.strict = false
+
+	ec.overrides = stringSlice{"github.com/sdboyer/deptest@master"}
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-vendor-only with -override should fail validation")
+	}
+	ec.overrides = nil
+
 	// Also verify that the plain ensure path takes no args. This is a shady
 	// test, as lots of other things COULD return errors, and we don't check
 	// anything other than the error being non-nil. For now, it works well
@@ -53,6 +138,23 @@ func TestInvalidEnsureFlagCombinations(t *testing.T) {
 	}
 }
 
+func TestEnsureStrictManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("src/example.com/proj/Gopkg.toml", "[[constraint]]\n  name = \"github.com/sdboyer/deptest\"\n  verison = \"1.0.0\"\n")
+
+	ctx := newTestContext(h)
+	h.Must(ctx.SetPaths(h.Path("src/example.com/proj"), h.Path(".")))
+	cmd := &ensureCommand{strict: true}
+	err := cmd.Run(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "found 1 problems") {
+		t.Fatalf("Expected -strict to fail on the problem in Gopkg.toml, got %v", err)
+	}
+	if !ctx.Strict {
+		t.Error("Expected -strict to make the context strict")
+	}
+}
+
 func TestCheckErrors(t *testing.T) {
 	tt := []struct {
 		name        string
@@ -111,3 +213,486 @@ func TestCheckErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestPrintLockChanges(t *testing.T) {
+	deptest := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+	deptestdos := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}
+	dos := gps.NewLockedProject(deptestdos, gps.NewVersion("v2.0.0").Pair("5c607206be5decd28e6263ffffdcee067266015e"), []string{"."})
+
+	oldLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, gps.NewVersion("v0.8.0").Pair("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+			dos,
+		},
+	}
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, gps.NewVersion("v1.0.0").Pair("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"), []string{"."}),
+			dos.WithOrigin(gps.ProjectOrigin{VCS: "git", URL: "https://github.com/sdboyer/deptestdos"}),
+		},
+	}
+
+	var buf bytes.Buffer
+	printLockChanges(log.New(&buf, "", 0), oldLock, newLock)
+
+	want := "Updated github.com/sdboyer/deptest from v0.8.0 (ff2948a) to v1.0.0 (3f4c3be)\n" +
+		"Changed the origin of github.com/sdboyer/deptestdos to git https://github.com/sdboyer/deptestdos\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected lock changes:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+}
+
+func TestBranchConstraint(t *testing.T) {
+	m := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest":     {Constraint: gps.NewBranch("master")},
+			"github.com/sdboyer/deptestdos":  {Constraint: gps.NewBranch("master")},
+			"github.com/sdboyer/deptesttres": {Constraint: gps.NewVersion("v1.0.0")},
+		},
+		Ovr: gps.ProjectConstraints{
+			"github.com/sdboyer/deptestdos": {Constraint: gps.Revision("5c607206be5decd28e6263ffffdcee067266015e")},
+			"github.com/carolynvs/deptest":  {Constraint: gps.NewBranch("dev")},
+		},
+	}
+
+	cases := []struct {
+		pr     gps.ProjectRoot
+		branch string
+		ok     bool
+	}{
+		{"github.com/sdboyer/deptest", "master", true},
+		{"github.com/sdboyer/deptestdos", "", false}, // Overridden to a revision.
+		{"github.com/sdboyer/deptesttres", "", false},
+		{"github.com/carolynvs/deptest", "dev", true},
+		{"github.com/golang/notexist", "", false},
+	}
+	for _, c := range cases {
+		branch, ok := branchConstraint(m, c.pr)
+		if branch != c.branch || ok != c.ok {
+			t.Errorf("branchConstraint(%s) = %q, %v, want %q, %v", c.pr, branch, ok, c.branch, c.ok)
+		}
+	}
+}
+
+func TestPrintBranchUpdates(t *testing.T) {
+	deptest := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+	deptestdos := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}
+	deptesttres := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptesttres"}
+	tres := gps.NewLockedProject(deptesttres, gps.NewBranch("master").Pair("54aaeb0023e1f3dcf5f98f31dd8c565457945a12"), []string{"."})
+
+	oldLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, gps.NewBranch("master").Pair("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+			gps.NewLockedProject(deptestdos, gps.NewVersion("v2.0.0").Pair("5c607206be5decd28e6263ffffdcee067266015e"), []string{"."}),
+			tres,
+		},
+	}
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, gps.NewBranch("master").Pair("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"), []string{"."}),
+			gps.NewLockedProject(deptestdos, gps.NewVersion("v2.1.0").Pair("a0196baa11ea047dd65037287451d36b861b00ea"), []string{"."}),
+			tres,
+		},
+	}
+
+	revisionTime := func(id gps.ProjectIdentifier, r gps.Revision) (time.Time, error) {
+		switch r {
+		case "ff2948a2ac8f538c4ecd55962e919d1e13e74baf":
+			return time.Date(2017, 5, 31, 12, 0, 0, 0, time.UTC), nil
+		case "3f4c3bea144e112a69bbe5d8d01c1b09a544253f":
+			return time.Date(2017, 7, 2, 12, 0, 0, 0, time.UTC), nil
+		}
+		return time.Time{}, errors.New("no such revision")
+	}
+
+	var buf bytes.Buffer
+	printBranchUpdates(log.New(&buf, "", 0), revisionTime, oldLock, newLock, []gps.ProjectRoot{"github.com/sdboyer/deptest", "github.com/sdboyer/deptesttres"})
+
+	want := "Updated github.com/sdboyer/deptest on branch master from ff2948a (2017-05-31) to 3f4c3be (2017-07-02)\n" +
+		"github.com/sdboyer/deptesttres is at the tip of branch master already, 54aaeb0\n" +
+		"Updated github.com/sdboyer/deptestdos from v2.0.0 (5c60720) to v2.1.0 (a0196ba)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected branch updates:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+}
+
+func TestRestrictUpdateLevel(t *testing.T) {
+	direct := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+	transitive := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}
+	branch := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptesttres"}
+
+	caret, _ := gps.NewSemverConstraint("^1.0.0")
+	p := &dep.Project{
+		Manifest: &dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				direct.ProjectRoot: {Constraint: caret},
+			},
+		},
+		Lock: &dep.Lock{
+			P: []gps.LockedProject{
+				gps.NewLockedProject(direct, gps.NewVersion("v1.2.3").Pair("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+				gps.NewLockedProject(transitive, gps.NewVersion("v0.4.1").Pair("5c607206be5decd28e6263ffffdcee067266015e"), []string{"."}),
+				gps.NewLockedProject(branch, gps.NewBranch("master").Pair("54aaeb0023e1f3dcf5f98f31dd8c565457945a12"), []string{"."}),
+			},
+		},
+	}
+
+	var errBuf bytes.Buffer
+	ctx := &dep.Ctx{Err: log.New(&errBuf, "", 0)}
+
+	cmd := &ensureCommand{update: true, patch: true}
+	m := cmd.restrictUpdateLevel(ctx, p, nil)
+
+	checks := []struct {
+		pc      gps.ProjectConstraints
+		pr      gps.ProjectRoot
+		match   string
+		noMatch string
+	}{
+		{m.Constraints, direct.ProjectRoot, "v1.2.9", "v1.3.0"},
+		{m.Ovr, transitive.ProjectRoot, "v0.4.5", "v0.5.0"},
+	}
+	for _, c := range checks {
+		pp, has := c.pc[c.pr]
+		if !has {
+			t.Errorf("Expected a restricted constraint for %s", c.pr)
+			continue
+		}
+		if !pp.Constraint.Matches(gps.NewVersion(c.match)) {
+			t.Errorf("Expected the constraint %s for %s to allow %s", pp.Constraint, c.pr, c.match)
+		}
+		if pp.Constraint.Matches(gps.NewVersion(c.noMatch)) {
+			t.Errorf("Expected the constraint %s for %s to disallow %s", pp.Constraint, c.pr, c.noMatch)
+		}
+	}
+
+	if _, has := m.Ovr[branch.ProjectRoot]; has {
+		t.Errorf("Expected %s, locked to a branch, to be skipped", branch.ProjectRoot)
+	}
+	if !strings.Contains(errBuf.String(), "Skipping github.com/sdboyer/deptesttres") {
+		t.Errorf("Expected %s to be listed as skipped, got %q", branch.ProjectRoot, errBuf.String())
+	}
+
+	// The project's own manifest must be left untouched.
+	if p.Manifest.Constraints[direct.ProjectRoot].Constraint.String() != caret.String() || len(p.Manifest.Ovr) != 0 {
+		t.Errorf("Expected the project manifest not to be modified, got %+v", p.Manifest)
+	}
+
+	cmd = &ensureCommand{update: true, minor: true}
+	m = cmd.restrictUpdateLevel(ctx, p, []gps.ProjectRoot{direct.ProjectRoot})
+	pp := m.Constraints[direct.ProjectRoot]
+	if !pp.Constraint.Matches(gps.NewVersion("v1.9.0")) || pp.Constraint.Matches(gps.NewVersion("v2.0.0")) {
+		t.Errorf("Expected -minor to restrict %s to ^1.2.0, got %s", direct.ProjectRoot, pp.Constraint)
+	}
+	if _, has := m.Ovr[transitive.ProjectRoot]; has {
+		t.Errorf("Expected only the named project to be restricted, but %s was too", transitive.ProjectRoot)
+	}
+}
+
+func TestPrintDryRun(t *testing.T) {
+	deptest := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+	oldLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, gps.NewVersion("v0.8.0").Pair("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		},
+	}
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, gps.NewVersion("v1.0.0").Pair("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"), []string{"."}),
+		},
+	}
+
+	// deptestdos is already in vendor/ at its locked revision, so it's carried
+	// over rather than written again.
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("empty")
+	h.TempFile("vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos")
+	digest, err := fs.DigestTree(h.Path("vendor/github.com/sdboyer/deptestdos"))
+	h.Must(err)
+	h.TempFile("vendor/"+dep.VendorDigestsName, "github.com/sdboyer/deptestdos 5c607206be5decd28e6263ffffdcee067266015e "+digest+"\n")
+	deptestdos := gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.NewVersion("v2.0.0").Pair("5c607206be5decd28e6263ffffdcee067266015e"), []string{"."})
+	oldVendored := &dep.Lock{P: append(oldLock.Projects(), deptestdos)}
+	newVendored := &dep.Lock{P: append(newLock.Projects(), deptestdos)}
+
+	cases := map[string]struct {
+		cmd              ensureCommand
+		oldLock, newLock *dep.Lock
+		root             string
+		want             string
+		pending          bool
+	}{
+		"unchanged": {
+			oldLock: oldLock,
+			newLock: oldLock,
+			want:    "Gopkg.lock is up to date, nothing would be changed\n",
+		},
+		"changed": {
+			oldLock: oldLock,
+			newLock: newLock,
+			want: "Would have written the following changes to Gopkg.lock:\n" +
+				"Updated github.com/sdboyer/deptest from v0.8.0 (ff2948a) to v1.0.0 (3f4c3be)\n" +
+				"Would have written 1 project(s) to vendor/\n",
+			pending: true,
+		},
+		"changed with unchanged projects in vendor": {
+			oldLock: oldVendored,
+			newLock: newVendored,
+			root:    h.Path("."),
+			want: "Would have written the following changes to Gopkg.lock:\n" +
+				"Updated github.com/sdboyer/deptest from v0.8.0 (ff2948a) to v1.0.0 (3f4c3be)\n" +
+				"Would have written 1 project(s) to vendor/\n",
+			pending: true,
+		},
+		"new lock without vendor": {
+			cmd:     ensureCommand{noVendor: true},
+			newLock: newLock,
+			want: "Would have written the following changes to Gopkg.lock:\n" +
+				"Added github.com/sdboyer/deptest at v1.0.0 (3f4c3be)\n",
+			pending: true,
+		},
+	}
+
+	for name, tc := range cases {
+		var buf bytes.Buffer
+		root := tc.root
+		if root == "" {
+			root = h.Path("empty")
+		}
+		p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}, Lock: tc.oldLock}
+		err := tc.cmd.printDryRun(log.New(&buf, "", 0), p, tc.newLock)
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s: unexpected dry run output:\n\t(GOT): %q\n\t(WNT): %q", name, got, tc.want)
+		}
+		_, pending := err.(dryRunPendingError)
+		if pending != tc.pending {
+			t.Errorf("%s: expected pending changes to be %t, got error %v", name, tc.pending, err)
+		}
+		if pending && err.(exitCoder).ExitCode() != 2 {
+			t.Errorf("%s: expected pending changes to exit with status 2", name)
+		}
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	sm, err := gps.NewSourceManager(h.Path("cache"))
+	h.Must(err)
+	defer sm.Release()
+
+	const rev = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+	m := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest": {Constraint: gps.NewBranch("master")},
+		},
+		Ovr: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest":    {Constraint: gps.NewBranch("master")},
+			"github.com/sdboyer/deptestdos": {Constraint: gps.NewBranch("master")},
+		},
+	}
+
+	var buf bytes.Buffer
+	ctx := &dep.Ctx{Err: log.New(&buf, "", 0)}
+	ec := &ensureCommand{overrides: stringSlice{
+		"github.com/sdboyer/deptest/subpkg@" + rev,
+		"github.com/sdboyer/deptesttres:github.com/carolynvs/deptesttres",
+	}}
+	om, err := ec.applyOverrides(ctx, m, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := gps.ProjectConstraints{
+		"github.com/sdboyer/deptest":     {Constraint: gps.Revision(rev)},
+		"github.com/sdboyer/deptestdos":  {Constraint: gps.NewBranch("master")},
+		"github.com/sdboyer/deptesttres": {Source: "github.com/carolynvs/deptesttres", Constraint: gps.Any()},
+	}
+	if len(om.Ovr) != len(want) {
+		t.Fatalf("expected overrides %v, got %v", want, om.Ovr)
+	}
+	for pr, pp := range want {
+		got := om.Ovr[pr]
+		if got.Source != pp.Source || got.Constraint.String() != pp.Constraint.String() {
+			t.Errorf("expected override %v on %s, got %v", pp, pr, got)
+		}
+	}
+
+	if len(m.Ovr) != 2 || m.Ovr["github.com/sdboyer/deptest"].Constraint.String() != "master" {
+		t.Errorf("expected the original manifest to be left alone, got %v", m.Ovr)
+	}
+	if om.Constraints["github.com/sdboyer/deptest"].Constraint.String() != "master" {
+		t.Errorf("expected constraints to be left alone, got %v", om.Constraints)
+	}
+	if got := strings.Count(buf.String(), "NOTICE: Temporarily overriding"); got != 2 {
+		t.Errorf("expected a notice for each override, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteModifiedVendor(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	h.TempFile("project/vendor/github.com/sdboyer/deptest/deptest.go", "package deptest")
+	root := h.Path("project")
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}}
+	file := filepath.Join(root, "vendor", "github.com", "sdboyer", "deptest", "deptest.go")
+
+	sm, err := gps.NewSourceManager(h.Path("cache"))
+	h.Must(err)
+	defer sm.Release()
+
+	const rev = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+	l := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v0.8.0").Pair(rev), []string{"."}),
+	}}
+	digest, err := fs.DigestTree(filepath.Dir(file))
+	h.Must(err)
+	h.TempFile(filepath.Join("project", "vendor", dep.VendorDigestsName), "github.com/sdboyer/deptest "+rev+" "+digest)
+
+	// Work around an upstream bug by hand.
+	h.TempFile("project/vendor/github.com/sdboyer/deptest/deptest.go", "package deptest // patched")
+
+	var buf bytes.Buffer
+	ctx := &dep.Ctx{Err: log.New(&buf, "", 0)}
+	var asked string
+	ec := &ensureCommand{confirm: func(ctx *dep.Ctx, question string) bool {
+		asked = question
+		return false
+	}}
+
+	sw, err := dep.NewSafeWriter(nil, nil, l, ec.populateVendorBehavior())
+	h.Must(err)
+	if err := ec.write(ctx, sw, p, sm, false); err == nil {
+		t.Fatal("expected declining to overwrite modified projects to fail")
+	}
+	if asked == "" {
+		t.Fatal("expected to be asked whether to overwrite modified projects")
+	}
+	wantWarning := "Warning: these projects were modified in vendor/ since dep wrote them, and would be overwritten:\n  github.com/sdboyer/deptest\n"
+	if got := buf.String(); got != wantWarning {
+		t.Fatalf("unexpected warning:\n\t(GOT): %q\n\t(WNT): %q", got, wantWarning)
+	}
+
+	// With -keep-modified, nothing is asked, and the patch survives.
+	asked, ec.keepModified = "", true
+	sw, err = dep.NewSafeWriter(nil, nil, l, ec.populateVendorBehavior())
+	h.Must(err)
+	h.Must(ec.write(ctx, sw, p, sm, false))
+	if asked != "" {
+		t.Fatal("expected not to be asked anything with -keep-modified")
+	}
+	b, err := ioutil.ReadFile(file)
+	h.Must(err)
+	if !strings.Contains(string(b), "patched") {
+		t.Fatalf("expected the patched file to be kept, got %q", b)
+	}
+
+	// Projects in the noverify list are kept too, and reported as skipped.
+	buf.Reset()
+	ec.keepModified = false
+	p.Manifest.NoVerify = []string{"github.com/sdboyer/deptest"}
+	sw, err = dep.NewSafeWriter(nil, nil, l, ec.populateVendorBehavior())
+	h.Must(err)
+	h.Must(ec.write(ctx, sw, p, sm, false))
+	if asked != "" {
+		t.Fatal("expected not to be asked anything about a project in noverify")
+	}
+	b, err = ioutil.ReadFile(file)
+	h.Must(err)
+	if !strings.Contains(string(b), "patched") {
+		t.Fatalf("expected the patched file in noverify to be kept, got %q", b)
+	}
+	if !strings.Contains(buf.String(), "Skipping verification of github.com/sdboyer/deptest") {
+		t.Fatalf("expected the project in noverify to be reported as skipped, got %q", buf.String())
+	}
+}
+
+// TestSvnSourceRoundTrip ensures, and checks the status of, a project which
+// depends on a tag of a Subversion repository, then restores its vendor dir
+// from the lock.
+func TestSvnSourceRoundTrip(t *testing.T) {
+	for _, b := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(b); err != nil {
+			t.Skipf("%s is not installed", b)
+		}
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("svn")
+	run := func(dir, cmd string, args ...string) {
+		c := exec.Command(cmd, args...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("%s %v failed: %s\n%s", cmd, args, err, out)
+		}
+	}
+
+	// The repository has the package pkg in trunk, tagged v1.0.0.
+	h.TempFile("svn/wc/trunk/pkg/pkg.go", "package pkg\n")
+	h.TempDir("svn/wc/branches")
+	h.TempDir("svn/wc/tags")
+	run(h.Path("svn"), "svnadmin", "create", "repo")
+	u := "file://" + filepath.ToSlash(h.Path("svn/repo"))
+	run(h.Path("svn"), "svn", "import", "-q", "-m", "Add trunk", "wc", u)
+	run(h.Path("svn"), "svn", "copy", "-q", "-m", "Tag v1.0.0", u+"/trunk", u+"/tags/v1.0.0")
+
+	h.TempFile("src/example.com/proj/main.go", "package main\n\nimport _ \"example.com/legacy/pkg\"\n\nfunc main() {}\n")
+	h.TempFile("src/example.com/proj/Gopkg.toml", fmt.Sprintf("[[constraint]]\n  name = \"example.com/legacy\"\n  source = %q\n  version = \"1.0.0\"\n", u))
+	proj := h.Path("src/example.com/proj")
+	env := append(os.Environ(), "GOPATH="+h.Path("."))
+	dep := func(args ...string) string {
+		var stdout, stderr bytes.Buffer
+		if err := runMain("dep", args, &stdout, &stderr, proj, env); err != nil {
+			t.Fatalf("dep %v failed: %s\n%s", args, err, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	dep("ensure")
+	h.MustExist(filepath.Join(proj, "vendor/example.com/legacy/pkg/pkg.go"))
+	h.MustNotExist(filepath.Join(proj, "vendor/example.com/legacy/.svn"))
+	lock, err := ioutil.ReadFile(filepath.Join(proj, "Gopkg.lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`revision = "2"`, `version = "v1.0.0"`, fmt.Sprintf("source = %q", u)} {
+		if !strings.Contains(string(lock), want) {
+			t.Errorf("Expected the lock to contain %s, got:\n%s", want, lock)
+		}
+	}
+
+	if out := dep("status"); !strings.Contains(out, "example.com/legacy") {
+		t.Errorf("Expected the status of example.com/legacy, got:\n%s", out)
+	}
+
+	h.Must(os.RemoveAll(filepath.Join(proj, "vendor")))
+	dep("ensure", "-vendor-only")
+	h.MustExist(filepath.Join(proj, "vendor/example.com/legacy/pkg/pkg.go"))
+}
+
+func TestImportCommentsChecker(t *testing.T) {
+	mismatches := []dep.ImportCommentMismatch{
+		{ImportPath: "github.com/Sirupsen/logrus", Comment: "github.com/sirupsen/logrus"},
+	}
+
+	var errBuf bytes.Buffer
+	ctx := &dep.Ctx{Err: log.New(&errBuf, "", 0)}
+	if err := importCommentsChecker(ctx, false)(mismatches); err != nil {
+		t.Fatalf("Expected only a warning without -strict, got %s", err)
+	}
+	if got := errBuf.String(); !strings.Contains(got, `github.com/Sirupsen/logrus has the import comment "github.com/sirupsen/logrus"`) {
+		t.Errorf("Expected a warning naming the package and its comment, got %q", got)
+	}
+
+	errBuf.Reset()
+	err := importCommentsChecker(ctx, true)(mismatches)
+	if err == nil || !strings.Contains(err.Error(), `github.com/Sirupsen/logrus has the import comment "github.com/sirupsen/logrus"`) {
+		t.Errorf("Expected an error naming the package and its comment with -strict, got %v", err)
+	}
+	if errBuf.Len() > 0 {
+		t.Errorf("Expected no warning with -strict, got %q", errBuf.String())
+	}
+}
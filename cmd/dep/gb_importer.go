@@ -0,0 +1,243 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const gbManifestPath = "vendor" + string(os.PathSeparator) + "manifest"
+
+// gbImporter imports gb configuration into the dep configuration format.
+type gbImporter struct {
+	manifest gbManifest
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGbImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gbImporter {
+	return &gbImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gbManifest is the structure of the vendor/manifest file written by gb.
+type gbManifest struct {
+	Version      int            `json:"version"`
+	Dependencies []gbDependency `json:"dependencies"`
+}
+
+type gbDependency struct {
+	Importpath string `json:"importpath"`
+	Repository string `json:"repository"`
+	Revision   string `json:"revision"`
+	Branch     string `json:"branch"`
+}
+
+func (g *gbImporter) Name() string {
+	return "gb"
+}
+
+func (g *gbImporter) HasDepMetadata(dir string) bool {
+	// gvt writes its manifest to the same location, but without a top-level
+	// version; see gvtImporter.
+	versioned, err := isVersionedVendorManifest(filepath.Join(dir, gbManifestPath))
+	return err == nil && versioned
+}
+
+func (g *gbImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the gb manifest file.
+func (g *gbImporter) load(projectDir string) error {
+	g.logger.Println("Detected gb manifest file...")
+	j := filepath.Join(projectDir, gbManifestPath)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", j)
+	}
+	jb, err := ioutil.ReadFile(j)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", j)
+	}
+	err = json.Unmarshal(jb, &g.manifest)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", j)
+	}
+
+	return nil
+}
+
+// convert the gb manifest into dep configuration files.
+func (g *gbImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from gb manifest...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, pkg := range g.manifest.Dependencies {
+		// Importpath must not be empty
+		if pkg.Importpath == "" {
+			err := errors.New("Invalid gb configuration, importpath is required")
+			return nil, nil, err
+		}
+
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := g.sm.DeduceProjectRoot(pkg.Importpath)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkg.Importpath = string(ip)
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, pkg.Importpath) {
+			continue
+		}
+
+		// Revision must not be empty
+		if pkg.Revision == "" {
+			err := errors.New("Invalid gb configuration, revision is required")
+			return nil, nil, err
+		}
+
+		pi := gps.ProjectIdentifier{
+			ProjectRoot: ip,
+			Source:      alternateSource(ip, pkg.Repository),
+		}
+
+		pc, err := g.buildProjectConstraint(pi, pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pc.Constraint != nil {
+			manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Source: pi.Source, Constraint: pc.Constraint}
+		}
+
+		lp := g.buildLockedProject(pi, pkg, manifest)
+		lock.P = append(lock.P, lp)
+	}
+
+	return manifest, lock, nil
+}
+
+// buildProjectConstraint uses the provided dependency's branch to create a
+// project constraint. When gb recorded a detached checkout (HEAD) rather than
+// a branch, the constraint is inferred from the version matching the locked
+// revision, if there is one.
+func (g *gbImporter) buildProjectConstraint(pi gps.ProjectIdentifier, pkg gbDependency) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+
+	if pkg.Branch != "" && pkg.Branch != "HEAD" {
+		pc.Constraint = gps.NewBranch(pkg.Branch)
+	} else {
+		revision := gps.Revision(pkg.Revision)
+		version, err := lookupVersionForLockedProject(pi, nil, revision, g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+			return pc, nil
+		}
+		pc.Constraint = getProjectPropertiesFromVersion(version).Constraint
+		if pc.Constraint == nil {
+			return pc, nil
+		}
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return pc, nil
+}
+
+// buildLockedProject uses the dependency's revision to create a lock project
+func (g *gbImporter) buildLockedProject(pi gps.ProjectIdentifier, pkg gbDependency, manifest *dep.Manifest) gps.LockedProject {
+	revision := gps.Revision(pkg.Revision)
+	pp := manifest.Constraints[pi.ProjectRoot]
+
+	version, err := lookupVersionForLockedProject(pi, pp.Constraint, revision, g.sm)
+	if err != nil {
+		// Only warn about the problem, it is not enough to warrant failing
+		g.logger.Println(err.Error())
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return lp
+}
+
+// isVersionedVendorManifest reports whether the vendor/manifest file at path
+// declares a top-level version, as gb's manifest does and gvt's does not.
+func isVersionedVendorManifest(path string) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return false, errors.Wrapf(err, "Unable to parse %s", path)
+	}
+	_, has := raw["version"]
+	return has, nil
+}
+
+// alternateSource returns repo if it points somewhere other than the location
+// deduced from the project root, or an empty string if it's merely another
+// way of spelling the default location (e.g. https://github.com/foo/bar.git
+// for github.com/foo/bar), or the GitHub repository a gopkg.in root is served
+// from.
+func alternateSource(pr gps.ProjectRoot, repo string) string {
+	if repoLocation(repo) == string(pr) {
+		return ""
+	}
+	return gopkginSource(pr, repo)
+}
+
+// gopkginSource returns repo, or an empty string if pr is on gopkg.in and repo
+// is the GitHub repository gopkg.in serves it from, so that the gopkg.in path
+// is kept, restricting the project to the major version it names.
+func gopkginSource(pr gps.ProjectRoot, repo string) string {
+	if gh, ok := gps.GopkginRepo(pr); ok && repoLocation(repo) == gh {
+		return ""
+	}
+	return repo
+}
+
+// repoLocation returns repo without its scheme, or a trailing slash or .git.
+func repoLocation(repo string) string {
+	if repo == "" {
+		return ""
+	}
+
+	loc := repo
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		loc = u.Host + u.Path
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(loc, "/"), ".git")
+}
@@ -0,0 +1,270 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestGbConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		manifest gbManifest
+	}{
+		"detached checkout": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			gbManifest{
+				Dependencies: []gbDependency{
+					{
+						Importpath: "github.com/sdboyer/deptest",
+						Repository: "https://github.com/sdboyer/deptest",
+						// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Branch:   "HEAD",
+					},
+				},
+			},
+		},
+		"branch": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "master",
+				wantRevision:   gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+				wantLockCount:  1,
+			},
+			gbManifest{
+				Dependencies: []gbDependency{
+					{
+						Importpath: "github.com/sdboyer/deptest",
+						Repository: "https://github.com/sdboyer/deptest.git",
+						Revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+						Branch:     "master",
+					},
+				},
+			},
+		},
+		"alternate source": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantSourceRepo: "https://github.com/carolynvs/deptest",
+				wantConstraint: "master",
+				wantRevision:   gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+				wantLockCount:  1,
+			},
+			gbManifest{
+				Dependencies: []gbDependency{
+					{
+						Importpath: "github.com/sdboyer/deptest",
+						Repository: "https://github.com/carolynvs/deptest",
+						Revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+						Branch:     "master",
+					},
+				},
+			},
+		},
+		"sub-packages": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "master",
+				wantLockCount:  1,
+			},
+			gbManifest{
+				Dependencies: []gbDependency{
+					{
+						Importpath: "github.com/sdboyer/deptest",
+						Repository: "https://github.com/sdboyer/deptest",
+						Revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+						Branch:     "master",
+					},
+					{
+						Importpath: "github.com/sdboyer/deptest/foo",
+						Repository: "https://github.com/sdboyer/deptest",
+						Revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+						Branch:     "master",
+					},
+				},
+			},
+		},
+		"bad input - empty import path": {
+			importConverterTestCase{
+				wantConvertErr: true,
+			},
+			gbManifest{
+				Dependencies: []gbDependency{{Importpath: ""}},
+			},
+		},
+		"bad input - empty revision": {
+			importConverterTestCase{
+				wantConvertErr: true,
+			},
+			gbManifest{
+				Dependencies: []gbDependency{
+					{
+						Importpath: "github.com/sdboyer/deptest",
+						Branch:     "master",
+					},
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGbImporter(discardLogger, true, sm)
+			g.manifest = testCase.manifest
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGbConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, gbManifestPath), "gb/manifest")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGbImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect the gb manifest file")
+	}
+
+	m, l, err := g.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "gb/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGbConfig_JsonLoad(t *testing.T) {
+	// This is same as cmd/dep/testdata/gb/manifest
+	wantDependencies := []gbDependency{
+		{
+			Importpath: "github.com/sdboyer/deptest",
+			Repository: "https://github.com/sdboyer/deptest",
+			Revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			Branch:     "HEAD",
+		},
+		{
+			Importpath: "github.com/sdboyer/deptestdos",
+			Repository: "https://github.com/sdboyer/deptestdos",
+			Revision:   "5c607206be5decd28e6263ffffdcee067266015e",
+			Branch:     "master",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, gbManifestPath), "gb/manifest")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	g := newGbImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if len(g.manifest.Dependencies) != len(wantDependencies) {
+		t.Fatalf("Expected %d dependencies, got %d", len(wantDependencies), len(g.manifest.Dependencies))
+	}
+	for i := range wantDependencies {
+		if g.manifest.Dependencies[i] != wantDependencies[i] {
+			t.Fatalf("Expected dependency %d to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", i, g.manifest.Dependencies[i], wantDependencies[i])
+		}
+	}
+}
+
+func TestAlternateSource(t *testing.T) {
+	pr := gps.ProjectRoot("github.com/sdboyer/deptest")
+	cases := map[string]string{
+		"":                                          "",
+		"https://github.com/sdboyer/deptest":        "",
+		"https://github.com/sdboyer/deptest.git":    "",
+		"git://github.com/sdboyer/deptest/":         "",
+		"github.com/sdboyer/deptest":                "",
+		"https://github.com/carolynvs/deptest":      "https://github.com/carolynvs/deptest",
+		"git@github.com:carolynvs/deptest.git":      "git@github.com:carolynvs/deptest.git",
+		"https://git.example.com/sdboyer/deptest":   "https://git.example.com/sdboyer/deptest",
+		"https://github.com/sdboyer/deptest/subdir": "https://github.com/sdboyer/deptest/subdir",
+	}
+
+	for repo, want := range cases {
+		if got := alternateSource(pr, repo); got != want {
+			t.Errorf("alternateSource(%q, %q) = %q, want %q", pr, repo, got, want)
+		}
+	}
+
+	// The repository a gopkg.in path is served from is no alternative.
+	pr = gps.ProjectRoot("gopkg.in/yaml.v2")
+	cases = map[string]string{
+		"https://github.com/go-yaml/yaml":     "",
+		"git@github.com:go-yaml/yaml.git":     "git@github.com:go-yaml/yaml.git",
+		"ssh://git@github.com/go-yaml/yaml":   "",
+		"https://github.com/carolynvs/yaml":   "https://github.com/carolynvs/yaml",
+		"https://gopkg.in/yaml.v2":            "",
+		"https://github.com/go-yaml/yaml/sub": "https://github.com/go-yaml/yaml/sub",
+	}
+	for repo, want := range cases {
+		if got := alternateSource(pr, repo); got != want {
+			t.Errorf("alternateSource(%q, %q) = %q, want %q", pr, repo, got, want)
+		}
+	}
+}
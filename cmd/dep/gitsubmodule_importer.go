@@ -0,0 +1,261 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const gitmodulesFile = ".gitmodules"
+
+// gitSubmoduleImporter imports dependencies vendored as git submodules into
+// the dep configuration format.
+type gitSubmoduleImporter struct {
+	submodules []gitSubmodule
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGitSubmoduleImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gitSubmoduleImporter {
+	return &gitSubmoduleImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gitSubmodule is a submodule declared in .gitmodules. The path is always
+// slash separated and relative to the project root; the revision is only
+// known once the submodule's checkout has been inspected.
+type gitSubmodule struct {
+	path     string
+	url      string
+	revision string
+}
+
+func (g *gitSubmoduleImporter) Name() string {
+	return "git submodules"
+}
+
+func (g *gitSubmoduleImporter) HasDepMetadata(dir string) bool {
+	f, err := os.Open(filepath.Join(dir, gitmodulesFile))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	submodules, err := parseGitmodules(f)
+	return err == nil && len(vendoredSubmodules(submodules)) > 0
+}
+
+func (g *gitSubmoduleImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the submodules under vendor/ declared in .gitmodules, along with the
+// revisions they have checked out.
+func (g *gitSubmoduleImporter) load(projectDir string) error {
+	g.logger.Println("Detected git submodules in vendor...")
+	p := filepath.Join(projectDir, gitmodulesFile)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", p)
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", p)
+	}
+	defer f.Close()
+
+	submodules, err := parseGitmodules(f)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", p)
+	}
+	submodules = vendoredSubmodules(submodules)
+
+	args := []string{"submodule", "status", "--"}
+	for _, s := range submodules {
+		args = append(args, s.path)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = projectDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to determine the status of git submodules: %s", out)
+	}
+
+	revisions, err := parseSubmoduleStatus(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range submodules {
+		s.revision = revisions[s.path]
+		if s.revision == "" {
+			g.logger.Printf("  Warning: Skipping submodule %s, it is not initialized. Run 'git submodule update --init' to import it.", s.path)
+			continue
+		}
+		g.submodules = append(g.submodules, s)
+	}
+
+	return nil
+}
+
+// parseGitmodules reads the submodule paths and urls from a .gitmodules file.
+func parseGitmodules(r io.Reader) ([]gitSubmodule, error) {
+	var submodules []gitSubmodule
+	var current *gitSubmodule
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			current = nil
+			if strings.HasPrefix(line, "[submodule ") {
+				submodules = append(submodules, gitSubmodule{})
+				current = &submodules[len(submodules)-1]
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid line in submodule configuration: %q", line)
+		}
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		switch strings.TrimSpace(kv[0]) {
+		case "path":
+			current.path = path.Clean(value)
+		case "url":
+			current.url = value
+		}
+	}
+
+	return submodules, scanner.Err()
+}
+
+// vendoredSubmodules filters out the submodules which aren't under vendor/.
+func vendoredSubmodules(submodules []gitSubmodule) []gitSubmodule {
+	var vendored []gitSubmodule
+	for _, s := range submodules {
+		if strings.HasPrefix(s.path, "vendor/") {
+			vendored = append(vendored, s)
+		}
+	}
+	return vendored
+}
+
+// parseSubmoduleStatus reads the output of git submodule status, returning
+// the checked out revision of each initialized submodule, keyed by path.
+func parseSubmoduleStatus(r io.Reader) (map[string]string, error) {
+	revisions := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		// Each line is a status character, the revision and the path,
+		// optionally followed by the output of git describe.
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			return nil, errors.Errorf("unexpected output from git submodule status: %q", line)
+		}
+
+		switch line[0] {
+		case '-':
+			// Not initialized
+		case 'U':
+			// Merge conflicts; there is no single revision to lock to
+		default:
+			revisions[fields[1]] = fields[0]
+		}
+	}
+
+	return revisions, scanner.Err()
+}
+
+// convert the git submodules into dep configuration files.
+func (g *gitSubmoduleImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from git submodules ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, s := range g.submodules {
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := g.sm.DeduceProjectRoot(strings.TrimPrefix(s.path, "vendor/"))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, string(ip)) {
+			continue
+		}
+
+		pi := gps.ProjectIdentifier{
+			ProjectRoot: ip,
+			Source:      alternateSource(ip, s.url),
+		}
+		revision := gps.Revision(s.revision)
+
+		// Submodules only record a revision, so try to find the version that
+		// corresponds to it and use that as the constraint.
+		version, err := lookupVersionForLockedProject(pi, nil, revision, g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+		} else {
+			pp := getProjectPropertiesFromVersion(version)
+			if pp.Constraint != nil {
+				pp.Source = pi.Source
+				manifest.Constraints[ip] = pp
+				pc := gps.ProjectConstraint{Ident: pi, Constraint: pp.Constraint}
+				f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+				f.LogFeedback(g.logger)
+			}
+		}
+
+		lp := gps.NewLockedProject(pi, version, nil)
+		f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+		f.LogFeedback(g.logger)
+		lock.P = append(lock.P, lp)
+	}
+
+	return manifest, lock, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestGitSubmoduleConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		submodules []gitSubmodule
+	}{
+		"submodule": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]gitSubmodule{
+				{
+					path: "vendor/github.com/sdboyer/deptest",
+					url:  "https://github.com/sdboyer/deptest.git",
+					// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+					revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+		"alternate source": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantSourceRepo: "https://github.com/carolynvs/deptest",
+				wantConstraint: "^1.0.0",
+				wantRevision:   gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantLockCount:  1,
+			},
+			[]gitSubmodule{
+				{
+					path:     "vendor/github.com/sdboyer/deptest",
+					url:      "https://github.com/carolynvs/deptest",
+					revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGitSubmoduleImporter(discardLogger, true, sm)
+			g.submodules = testCase.submodules
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGitSubmoduleConfig_Load(t *testing.T) {
+	test.NeedsGit(t)
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// Create a dependency repository, and a project which vendors it twice as
+	// a submodule: once checked out, and once left uninitialized.
+	git := func(dir string, args ...string) {
+		args = append([]string{"-c", "user.name=dep", "-c", "user.email=dep@example.com", "-c", "protocol.file.allow=always"}, args...)
+		h.RunGit(dir, args...)
+	}
+
+	h.TempDir("dependency")
+	depDir := h.Path("dependency")
+	git(depDir, "init")
+	h.TempFile(filepath.Join("dependency", "dep.go"), "package dependency\n")
+	git(depDir, "add", "dep.go")
+	git(depDir, "commit", "-m", "initial")
+	out, err := exec.Command("git", "-C", depDir, "rev-parse", "HEAD").Output()
+	h.Must(err)
+	wantRevision := strings.TrimSpace(string(out))
+
+	h.TempDir("project")
+	projectDir := h.Path("project")
+	git(projectDir, "init")
+	git(projectDir, "submodule", "add", depDir, "vendor/example.com/initialized")
+	git(projectDir, "submodule", "add", depDir, "vendor/example.com/uninitialized")
+	git(projectDir, "commit", "-m", "add submodules")
+	git(projectDir, "submodule", "deinit", "vendor/example.com/uninitialized")
+
+	output := &bytes.Buffer{}
+	g := newGitSubmoduleImporter(log.New(output, "", 0), false, nil)
+	if !g.HasDepMetadata(projectDir) {
+		t.Fatal("Expected the importer to detect the git submodules")
+	}
+
+	err = g.load(projectDir)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	wantSubmodules := []gitSubmodule{
+		{
+			path:     "vendor/example.com/initialized",
+			url:      depDir,
+			revision: wantRevision,
+		},
+	}
+	if !reflect.DeepEqual(g.submodules, wantSubmodules) {
+		t.Fatalf("Unexpected submodules.\n\t(GOT): %+v\n\t(WNT): %+v", g.submodules, wantSubmodules)
+	}
+
+	wantWarning := "Skipping submodule vendor/example.com/uninitialized, it is not initialized"
+	if !strings.Contains(output.String(), wantWarning) {
+		t.Fatalf("Expected output to contain %q, got:\n%s", wantWarning, output.String())
+	}
+}
+
+func TestGitSubmoduleConfig_ParseGitmodules(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "gitsubmodule", "gitmodules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	submodules, err := parseGitmodules(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []gitSubmodule{
+		{path: "vendor/github.com/sdboyer/deptest", url: "https://github.com/sdboyer/deptest.git"},
+		{path: "vendor/github.com/sdboyer/deptestdos", url: "git@github.com:carolynvs/deptestdos.git"},
+	}
+	if got := vendoredSubmodules(submodules); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected vendored submodules.\n\t(GOT): %+v\n\t(WNT): %+v", got, want)
+	}
+}
+
+func TestGitSubmoduleConfig_ParseStatus(t *testing.T) {
+	status := ` ff2948a2ac8f538c4ecd55962e919d1e13e74baf vendor/github.com/sdboyer/deptest (v1.0.0)
++5c607206be5decd28e6263ffffdcee067266015e vendor/github.com/sdboyer/deptestdos (heads/master)
+-3f4c3bea144e112a69bbe5d8d01c1b09a544253f vendor/github.com/sdboyer/deptesttres
+U0000000000000000000000000000000000000000 vendor/github.com/sdboyer/deptestquatro
+`
+
+	got, err := parseSubmoduleStatus(strings.NewReader(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"vendor/github.com/sdboyer/deptest":    "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+		"vendor/github.com/sdboyer/deptestdos": "5c607206be5decd28e6263ffffdcee067266015e",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected revisions.\n\t(GOT): %+v\n\t(WNT): %+v", got, want)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-yaml/yaml"
 	"github.com/golang/dep"
@@ -58,6 +59,7 @@ type glidePackage struct {
 	Name       string `yaml:"package"`
 	Reference  string `yaml:"version"`
 	Repository string `yaml:"repo"`
+	VCS        string `yaml:"vcs"`
 
 	// Unsupported fields that we will warn if used
 	Subpackages []string `yaml:"subpackages"`
@@ -69,6 +71,7 @@ type glideLockedPackage struct {
 	Name       string `yaml:"name"`
 	Reference  string `yaml:"version"`
 	Repository string `yaml:"repo"`
+	VCS        string `yaml:"vcs"`
 }
 
 func (g *glideImporter) Name() string {
@@ -150,13 +153,24 @@ func (g *glideImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 		if err != nil {
 			return nil, nil, err
 		}
+		if pc.Constraint == nil {
+			continue
+		}
 		manifest.Constraints[pc.Ident.ProjectRoot] = gps.ProjectProperties{Source: pc.Ident.Source, Constraint: pc.Constraint}
 	}
 	for _, pkg := range g.yaml.TestImports {
+		// A package which is also a regular import keeps that constraint
+		if _, ok := manifest.Constraints[gps.ProjectRoot(pkg.Name)]; ok {
+			continue
+		}
+
 		pc, err := g.buildProjectConstraint(pkg)
 		if err != nil {
 			return nil, nil, err
 		}
+		if pc.Constraint == nil {
+			continue
+		}
 		manifest.Constraints[pc.Ident.ProjectRoot] = gps.ProjectProperties{Source: pc.Ident.Source, Constraint: pc.Constraint}
 	}
 
@@ -168,6 +182,11 @@ func (g *glideImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 		}
 
 		for _, dir := range g.yaml.ExcludeDirs {
+			dir = path.Clean(filepath.ToSlash(dir))
+			if dir == "." || dir == ".." || path.IsAbs(dir) || strings.HasPrefix(dir, "../") {
+				g.logger.Printf("  Ignoring excludeDirs entry '%s', it is not a directory within the project.\n", dir)
+				continue
+			}
 			pkg := path.Join(projectName, dir)
 			manifest.Ignored = append(manifest.Ignored, pkg)
 		}
@@ -182,6 +201,11 @@ func (g *glideImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 			lock.P = append(lock.P, lp)
 		}
 		for _, pkg := range g.lock.TestImports {
+			// Check if it already existing in locked projects
+			if projectExistsInLock(lock, pkg.Name) {
+				continue
+			}
+
 			lp := g.buildLockedProject(pkg, manifest)
 			lock.P = append(lock.P, lp)
 		}
@@ -205,9 +229,12 @@ func (g *glideImporter) buildProjectConstraint(pkg glidePackage) (pc gps.Project
 		}
 	}
 
-	pc.Ident = gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pkg.Name), Source: pkg.Repository}
-	pc.Constraint, err = g.sm.InferConstraint(pkg.Reference, pc.Ident)
-	if err != nil {
+	g.warnUnsupportedVCS(pkg.Name, pkg.VCS)
+
+	pr := gps.ProjectRoot(pkg.Name)
+	pc.Ident = gps.ProjectIdentifier{ProjectRoot: pr, Source: gopkginSource(pr, pkg.Repository)}
+	pc.Constraint = inferImportedConstraint(pkg.Reference, pc.Ident, g.sm, g.logger)
+	if pc.Constraint == nil {
 		return
 	}
 
@@ -218,13 +245,22 @@ func (g *glideImporter) buildProjectConstraint(pkg glidePackage) (pc gps.Project
 }
 
 func (g *glideImporter) buildLockedProject(pkg glideLockedPackage, manifest *dep.Manifest) gps.LockedProject {
+	g.warnUnsupportedVCS(pkg.Name, pkg.VCS)
+
+	pr := gps.ProjectRoot(pkg.Name)
 	pi := gps.ProjectIdentifier{
-		ProjectRoot: gps.ProjectRoot(pkg.Name),
-		Source:      pkg.Repository,
+		ProjectRoot: pr,
+		Source:      gopkginSource(pr, pkg.Repository),
 	}
 	revision := gps.Revision(pkg.Reference)
 	pp := manifest.Constraints[pi.ProjectRoot]
 
+	// glide.lock doesn't always repeat the repo from glide.yaml, but the
+	// locked project must be fetched from the same place as the constraint.
+	if pi.Source == "" {
+		pi.Source = pp.Source
+	}
+
 	version, err := lookupVersionForLockedProject(pi, pp.Constraint, revision, g.sm)
 	if err != nil {
 		// Only warn about the problem, it is not enough to warrant failing
@@ -238,3 +274,13 @@ func (g *glideImporter) buildLockedProject(pkg glideLockedPackage, manifest *dep
 
 	return lp
 }
+
+// warnUnsupportedVCS logs a warning if the package's repo uses a vcs that dep
+// can't fetch from.
+func (g *glideImporter) warnUnsupportedVCS(name, vcs string) {
+	switch vcs {
+	case "", "git", "hg", "bzr", "svn":
+	default:
+		g.logger.Printf("  The %s package specified the %s vcs, but that isn't supported by dep, and will be ignored.\n", name, vcs)
+	}
+}
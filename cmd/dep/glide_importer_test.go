@@ -76,7 +76,56 @@ func TestGlideConfig_Convert(t *testing.T) {
 			wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
 			wantVersion:        "v1.0.0",
 		},
+		"alternate source": {
+			yaml: glideYaml{
+				Imports: []glidePackage{
+					{
+						Name:       "github.com/sdboyer/deptest",
+						Repository: "https://github.com/carolynvs/deptest",
+						VCS:        "git",
+						Reference:  "v1.0.0",
+					},
+				},
+			},
+			lock: &glideLock{
+				Imports: []glideLockedPackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			projectRoot:        "github.com/sdboyer/deptest",
+			wantSourceRepo:     "https://github.com/carolynvs/deptest",
+			matchPairedVersion: true,
+			wantConstraint:     "^1.0.0",
+			wantLockCount:      1,
+			wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			wantVersion:        "v1.0.0",
+		},
 		"test project": {
+			yaml: glideYaml{
+				TestImports: []glidePackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "v1.0.0",
+					},
+				},
+			},
+			lock: &glideLock{
+				TestImports: []glideLockedPackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			projectRoot:    "github.com/sdboyer/deptest",
+			wantLockCount:  1,
+			wantConstraint: "^1.0.0",
+			wantVersion:    "v1.0.0",
+		},
+		"project also a test project": {
 			yaml: glideYaml{
 				Imports: []glidePackage{
 					{
@@ -84,6 +133,12 @@ func TestGlideConfig_Convert(t *testing.T) {
 						Reference: "v1.0.0",
 					},
 				},
+				TestImports: []glidePackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "v0.8.0",
+					},
+				},
 			},
 			lock: &glideLock{
 				Imports: []glideLockedPackage{
@@ -92,6 +147,12 @@ func TestGlideConfig_Convert(t *testing.T) {
 						Reference: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
 					},
 				},
+				TestImports: []glideLockedPackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
 			},
 			projectRoot:    "github.com/sdboyer/deptest",
 			wantLockCount:  1,
@@ -114,6 +175,22 @@ func TestGlideConfig_Convert(t *testing.T) {
 			wantIgnoreCount:     1,
 			wantIgnoredPackages: []string{"github.com/golang/notexist/samples"},
 		},
+		"with nested exclude dirs": {
+			yaml: glideYaml{
+				ExcludeDirs: []string{"./samples/", "internal/testdata"},
+			},
+			projectRoot:         testGlideProjectRoot,
+			wantIgnoreCount:     2,
+			wantIgnoredPackages: []string{"github.com/golang/notexist/samples", "github.com/golang/notexist/internal/testdata"},
+		},
+		"exclude dir outside of the project": {
+			yaml: glideYaml{
+				ExcludeDirs: []string{"..", "../sibling", "."},
+			},
+			projectRoot:         testGlideProjectRoot,
+			wantIgnoreCount:     0,
+			wantIgnoredPackages: nil,
+		},
 		"exclude dir ignores mismatched package name": {
 			yaml: glideYaml{
 				Name:        "github.com/golang/mismatched-package-name",
@@ -194,6 +271,10 @@ func TestGlideConfig_Convert(t *testing.T) {
 				t.Fatalf("Expected manifest constraint to be %s, got %s", testCase.wantConstraint, v)
 			}
 
+			if d.Source != testCase.wantSourceRepo {
+				t.Fatalf("Expected manifest source to be %s, got '%s'", testCase.wantSourceRepo, d.Source)
+			}
+
 			p := lock.P[0]
 
 			if p.Ident().ProjectRoot != testCase.projectRoot {
@@ -234,6 +315,55 @@ func TestGlideConfig_Convert(t *testing.T) {
 	}
 }
 
+func TestGlideConfig_ConvertConstraintStyles(t *testing.T) {
+	wantConstraints := map[string]string{
+		importConstraintCaret: "^1.0.0",
+		importConstraintTilde: "~1.0.0",
+		importConstraintExact: "1.0.0",
+		importConstraintNone:  "",
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for style, wantConstraint := range wantConstraints {
+		t.Run(style, func(t *testing.T) {
+			g := newGlideImporter(discardLogger, true, sm)
+			g.yaml = glideYaml{
+				Imports: []glidePackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "v1.0.0",
+					},
+				},
+			}
+			g.lock = &glideLock{
+				Imports: []glideLockedPackage{
+					{
+						Name:      "github.com/sdboyer/deptest",
+						Reference: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			}
+
+			tc := importConverterTestCase{
+				projectRoot:     "github.com/sdboyer/deptest",
+				constraintStyle: style,
+				wantConstraint:  wantConstraint,
+				wantRevision:    gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:     "v1.0.0",
+				wantLockCount:   1,
+			}
+			tc.exec(t, g)
+		})
+	}
+}
+
 func TestGlideConfig_Import(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -313,13 +443,21 @@ func TestGlideConfig_Import_MissingLockFile(t *testing.T) {
 }
 
 func TestGlideConfig_Convert_WarnsForUnusedFields(t *testing.T) {
-	testCases := map[string]glidePackage{
-		"specified an os":   {OS: "windows"},
-		"specified an arch": {Arch: "i686"},
+	// Each case is named for the warning, which svn, as it's supported, doesn't
+	// get.
+	testCases := map[string]struct {
+		pkg         glidePackage
+		wantWarning bool
+	}{
+		"specified an os":         {glidePackage{OS: "windows"}, true},
+		"specified an arch":       {glidePackage{Arch: "i686"}, true},
+		"specified the svn vcs":   {glidePackage{VCS: "svn"}, false},
+		"specified the darcs vcs": {glidePackage{VCS: "darcs"}, true},
 	}
 
-	for wantWarning, pkg := range testCases {
-		t.Run(wantWarning, func(t *testing.T) {
+	for warning, testCase := range testCases {
+		pkg, wantWarning := testCase.pkg, testCase.wantWarning
+		t.Run(warning, func(t *testing.T) {
 			h := test.NewHelper(t)
 			defer h.Cleanup()
 
@@ -346,8 +484,8 @@ func TestGlideConfig_Convert_WarnsForUnusedFields(t *testing.T) {
 			}
 
 			warnings := verboseOutput.String()
-			if !strings.Contains(warnings, wantWarning) {
-				t.Errorf("Expected the output to include the warning '%s'", wantWarning)
+			if strings.Contains(warnings, warning) != wantWarning {
+				t.Errorf("Expected the output to include the warning '%s' to be %t, got:\n%s", warning, wantWarning, warnings)
 			}
 		})
 	}
@@ -0,0 +1,167 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const glockfile = "GLOCKFILE"
+
+// glockImporter imports glock configuration into the dep configuration format.
+type glockImporter struct {
+	packages []glockPackage
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGlockImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *glockImporter {
+	return &glockImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// glockPackage is a single dependency line of a GLOCKFILE.
+type glockPackage struct {
+	importPath string
+	revision   string
+}
+
+func (g *glockImporter) Name() string {
+	return "glock"
+}
+
+func (g *glockImporter) HasDepMetadata(dir string) bool {
+	path := filepath.Join(dir, glockfile)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (g *glockImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the GLOCKFILE. Lines are either "importpath revision" or, for commands
+// that glock should install, "cmd importpath"; the latter are skipped.
+func (g *glockImporter) load(projectDir string) error {
+	g.logger.Println("Detected glock configuration files...")
+	path := filepath.Join(projectDir, glockfile)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pkg, err := parseGlockLine(scanner.Text())
+		if err != nil {
+			return errors.Wrapf(err, "Unable to parse %s", path)
+		}
+		if pkg == nil {
+			continue
+		}
+		g.packages = append(g.packages, *pkg)
+	}
+
+	return errors.Wrapf(scanner.Err(), "Unable to read %s", path)
+}
+
+func parseGlockLine(line string) (*glockPackage, error) {
+	fields := strings.Fields(line)
+	switch len(fields) {
+	case 0:
+		return nil, nil
+	case 2:
+		if fields[0] == "cmd" {
+			return nil, nil
+		}
+		return &glockPackage{
+			importPath: fields[0],
+			revision:   fields[1],
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid glock configuration: %q", line)
+	}
+}
+
+// convert the glock packages into dep configuration files.
+func (g *glockImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from GLOCKFILE ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, pkg := range g.packages {
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := g.sm.DeduceProjectRoot(pkg.importPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, string(ip)) {
+			continue
+		}
+
+		pi := gps.ProjectIdentifier{ProjectRoot: ip}
+		revision := gps.Revision(pkg.revision)
+
+		// glock only records revisions, so try to find the version that
+		// corresponds to the revision and use that as the constraint.
+		version, err := lookupVersionForLockedProject(pi, nil, revision, g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+		} else {
+			pp := getProjectPropertiesFromVersion(version)
+			if pp.Constraint != nil {
+				pc := gps.ProjectConstraint{Ident: pi, Constraint: pp.Constraint}
+				manifest.Constraints[ip] = pp
+				f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+				f.LogFeedback(g.logger)
+			}
+		}
+
+		lp := gps.NewLockedProject(pi, version, nil)
+		f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+		f.LogFeedback(g.logger)
+		lock.P = append(lock.P, lp)
+	}
+
+	if g.verbose {
+		g.logger.Printf("  Imported %d project(s) from glock", len(lock.P))
+	}
+
+	return manifest, lock, nil
+}
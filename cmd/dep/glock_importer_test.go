@@ -0,0 +1,230 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestGlockConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		packages []glockPackage
+	}{
+		"package": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]glockPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+					revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+		"sub-packages": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]glockPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+				{
+					importPath: "github.com/sdboyer/deptest/foo",
+					revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGlockImporter(discardLogger, true, sm)
+			g.packages = testCase.packages
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGlockConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, glockfile), "glock/GLOCKFILE")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGlockImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect glock configuration file")
+	}
+
+	m, l, err := g.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "glock/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGlockConfig_ImportCount(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	verboseOutput := &bytes.Buffer{}
+	g := newGlockImporter(log.New(verboseOutput, "", 0), true, sm)
+	g.packages = []glockPackage{
+		{importPath: "github.com/sdboyer/deptest", revision: "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"},
+		{importPath: "github.com/sdboyer/deptestdos", revision: "5c607206be5decd28e6263ffffdcee067266015e"},
+		{importPath: "github.com/sdboyer/deptestdos/bar", revision: "5c607206be5decd28e6263ffffdcee067266015e"},
+	}
+
+	_, _, err = g.convert(testProjectRoot)
+	h.Must(err)
+
+	want := "Imported 2 project(s) from glock"
+	if !strings.Contains(verboseOutput.String(), want) {
+		t.Fatalf("Expected verbose output to contain %q, got:\n%s", want, verboseOutput.String())
+	}
+}
+
+func TestGlockConfig_Load(t *testing.T) {
+	// This is same as cmd/dep/testdata/glock/GLOCKFILE
+	wantPackages := []glockPackage{
+		{
+			importPath: "github.com/sdboyer/deptest",
+			revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+		},
+		{
+			importPath: "github.com/sdboyer/deptestdos",
+			revision:   "5c607206be5decd28e6263ffffdcee067266015e",
+		},
+		{
+			importPath: "github.com/sdboyer/deptestdos/bar",
+			revision:   "5c607206be5decd28e6263ffffdcee067266015e",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, glockfile), "glock/GLOCKFILE")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	g := newGlockImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if len(g.packages) != len(wantPackages) {
+		t.Fatalf("Expected %d packages, got %d", len(wantPackages), len(g.packages))
+	}
+	for i := range wantPackages {
+		if g.packages[i] != wantPackages[i] {
+			t.Fatalf("Expected package %d to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", i, g.packages[i], wantPackages[i])
+		}
+	}
+}
+
+func TestParseGlockLine(t *testing.T) {
+	testCases := map[string]struct {
+		line    string
+		want    *glockPackage
+		wantErr bool
+	}{
+		"dependency": {
+			line: "github.com/sdboyer/deptest 3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			want: &glockPackage{importPath: "github.com/sdboyer/deptest", revision: "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"},
+		},
+		"command": {
+			line: "cmd github.com/golang/lint/golint",
+		},
+		"blank": {
+			line: "   ",
+		},
+		"malformed": {
+			line:    "github.com/sdboyer/deptest",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseGlockLine(tc.line)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error state, wantErr %v, got %v", tc.wantErr, err)
+			}
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Fatalf("Expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -10,9 +10,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/golang/dep"
 	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
 	"github.com/pkg/errors"
 )
@@ -36,9 +38,15 @@ func newGodepImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *g
 }
 
 type godepJSON struct {
-	Imports []godepPackage `json:"Deps"`
+	Packages []string       `json:"Packages"`
+	Imports  []godepPackage `json:"Deps"`
 }
 
+// godepWorkspace is where godep vendored dependencies before Go supported the
+// vendor directory. With import path rewriting, imports of those dependencies
+// were prefixed with <root>/Godeps/_workspace/src/.
+const godepWorkspace = "Godeps/_workspace/src/"
+
 type godepPackage struct {
 	ImportPath string `json:"ImportPath"`
 	Rev        string `json:"Rev"`
@@ -50,12 +58,9 @@ func (g *godepImporter) Name() string {
 }
 
 func (g *godepImporter) HasDepMetadata(dir string) bool {
-	y := filepath.Join(dir, godepPath)
-	if _, err := os.Stat(y); err != nil {
-		return false
-	}
-
-	return true
+	// A plain Godeps file, rather than a directory, belongs to gpm.
+	exists, _ := fs.IsRegular(filepath.Join(dir, godepPath))
+	return exists
 }
 
 func (g *godepImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
@@ -93,6 +98,8 @@ func (g *godepImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 	}
 	lock := &dep.Lock{}
 
+	manifest.Required = g.requiredPackages(pr)
+
 	for _, pkg := range g.json.Imports {
 		// ImportPath must not be empty
 		if pkg.ImportPath == "" {
@@ -100,6 +107,8 @@ func (g *godepImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 			return nil, nil, err
 		}
 
+		pkg.ImportPath = unrewriteGodepImportPath(pkg.ImportPath)
+
 		// Obtain ProjectRoot. Required for avoiding sub-package imports.
 		ip, err := g.sm.DeduceProjectRoot(pkg.ImportPath)
 		if err != nil {
@@ -144,7 +153,9 @@ func (g *godepImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 			if err != nil {
 				return nil, nil, err
 			}
-			manifest.Constraints[pc.Ident.ProjectRoot] = gps.ProjectProperties{Constraint: pc.Constraint}
+			if pc.Constraint != nil {
+				manifest.Constraints[pc.Ident.ProjectRoot] = gps.ProjectProperties{Constraint: pc.Constraint}
+			}
 		}
 
 		lp := g.buildLockedProject(pkg, manifest)
@@ -154,12 +165,43 @@ func (g *godepImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, e
 	return manifest, lock, nil
 }
 
+// requiredPackages determines which of the packages that godep was asked to
+// save are external to the project. These were saved explicitly, e.g.
+// because they provide a tool, so they're required whether or not the
+// project imports them.
+func (g *godepImporter) requiredPackages(pr gps.ProjectRoot) []string {
+	var required []string
+	for _, pkg := range g.json.Packages {
+		if pkg == "." || strings.HasPrefix(pkg, "./") || strings.HasPrefix(pkg, "../") {
+			continue
+		}
+
+		pkg = unrewriteGodepImportPath(strings.TrimSuffix(pkg, "/..."))
+		if isPathPrefix(pkg, string(pr)) {
+			continue
+		}
+
+		required = append(required, pkg)
+	}
+
+	return required
+}
+
+// unrewriteGodepImportPath strips the Godeps workspace prefix from an import
+// path rewritten by godep.
+func unrewriteGodepImportPath(ip string) string {
+	if i := strings.Index(ip, "/"+godepWorkspace); i >= 0 {
+		return ip[i+len(godepWorkspace)+1:]
+	}
+	return ip
+}
+
 // buildProjectConstraint uses the provided package ImportPath and Comment to
 // create a project constraint
 func (g *godepImporter) buildProjectConstraint(pkg godepPackage) (pc gps.ProjectConstraint, err error) {
 	pc.Ident = gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pkg.ImportPath)}
-	pc.Constraint, err = g.sm.InferConstraint(pkg.Comment, pc.Ident)
-	if err != nil {
+	pc.Constraint = inferImportedConstraint(pkg.Comment, pc.Ident, g.sm, g.logger)
+	if pc.Constraint == nil {
 		return
 	}
 
@@ -80,6 +80,40 @@ func TestGodepConfig_Convert(t *testing.T) {
 			wantVersion:        "v1.0.0",
 			wantLockCount:      1,
 		},
+		"empty comment at the head of a branch": {
+			json: godepJSON{
+				Imports: []godepPackage{
+					{
+						ImportPath: "github.com/carolynvs/deptest-importers",
+						// This revision is the head of the v2 branch, and isn't tagged.
+						Rev: "45dcf5a09c64b48b6532a7ff2ca5e3db97ec3b46",
+					},
+				},
+			},
+			projectRoot:        gps.ProjectRoot("github.com/carolynvs/deptest-importers"),
+			matchPairedVersion: true,
+			wantConstraint:     "v2",
+			wantRevision:       gps.Revision("45dcf5a09c64b48b6532a7ff2ca5e3db97ec3b46"),
+			wantVersion:        "v2",
+			wantLockCount:      1,
+		},
+		"rewritten import path": {
+			json: godepJSON{
+				Imports: []godepPackage{
+					{
+						ImportPath: "github.com/golang/notexist/Godeps/_workspace/src/github.com/sdboyer/deptest",
+						// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+						Rev: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			projectRoot:        gps.ProjectRoot("github.com/sdboyer/deptest"),
+			matchPairedVersion: true,
+			wantConstraint:     "^1.0.0",
+			wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			wantVersion:        "v1.0.0",
+			wantLockCount:      1,
+		},
 		"bad input - empty package name": {
 			json: godepJSON{
 				Imports: []godepPackage{{ImportPath: ""}},
@@ -192,6 +226,49 @@ func TestGodepConfig_Convert(t *testing.T) {
 	}
 }
 
+func TestGodepConfig_ConvertConstraintStyles(t *testing.T) {
+	wantConstraints := map[string]string{
+		importConstraintCaret: "^1.0.0",
+		importConstraintTilde: "~1.0.0",
+		importConstraintExact: "1.0.0",
+		importConstraintNone:  "",
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for style, wantConstraint := range wantConstraints {
+		t.Run(style, func(t *testing.T) {
+			g := newGodepImporter(discardLogger, true, sm)
+			g.json = godepJSON{
+				Imports: []godepPackage{
+					{
+						ImportPath: "github.com/sdboyer/deptest",
+						// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+						Rev:     "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Comment: "v1.0.0",
+					},
+				},
+			}
+
+			tc := importConverterTestCase{
+				projectRoot:     "github.com/sdboyer/deptest",
+				constraintStyle: style,
+				wantConstraint:  wantConstraint,
+				wantRevision:    gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:     "v1.0.0",
+				wantLockCount:   1,
+			}
+			tc.exec(t, g)
+		})
+	}
+}
+
 func TestGodepConfig_Import(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -277,6 +354,85 @@ func TestGodepConfig_JsonLoad(t *testing.T) {
 	}
 }
 
+func TestGodepConfig_JsonLoadRewritten(t *testing.T) {
+	// This is same as cmd/dep/testdata/godep/Godeps-rewritten.json
+	wantJSON := godepJSON{
+		Packages: []string{"./...", "github.com/sdboyer/deptestdos/..."},
+		Imports: []godepPackage{
+			{
+				ImportPath: "github.com/golang/notexist/Godeps/_workspace/src/github.com/sdboyer/deptest",
+				Rev:        "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			},
+			{
+				ImportPath: "github.com/sdboyer/deptestdos",
+				Rev:        "5c607206be5decd28e6263ffffdcee067266015e",
+				Comment:    "v2.0.0",
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testGodepProjectRoot, godepPath), "godep/Godeps-rewritten.json")
+
+	projectRoot := h.Path(testGodepProjectRoot)
+
+	g := newGodepImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if !equalSlice(g.json.Packages, wantJSON.Packages) {
+		t.Fatalf("Expected packages to be equal. \n\t(GOT): %v\n\t(WNT): %v", g.json.Packages, wantJSON.Packages)
+	}
+	if !equalImports(g.json.Imports, wantJSON.Imports) {
+		t.Fatalf("Expected imports to be equal. \n\t(GOT): %v\n\t(WNT): %v", g.json.Imports, wantJSON.Imports)
+	}
+
+	if got, want := g.requiredPackages(testGodepProjectRoot), []string{"github.com/sdboyer/deptestdos"}; !equalSlice(got, want) {
+		t.Fatalf("Expected required packages to be %v, got %v", want, got)
+	}
+}
+
+func TestGodepConfig_RequiredPackages(t *testing.T) {
+	testCases := map[string]struct {
+		packages []string
+		want     []string
+	}{
+		"project packages": {
+			packages: []string{".", "./...", "./cmd/foo", "github.com/golang/notexist/...", "github.com/golang/notexist/cmd/foo"},
+		},
+		"external packages": {
+			packages: []string{"./...", "github.com/sdboyer/deptest/...", "github.com/sdboyer/deptestdos/cmd/tool"},
+			want:     []string{"github.com/sdboyer/deptest", "github.com/sdboyer/deptestdos/cmd/tool"},
+		},
+		"rewritten packages": {
+			packages: []string{"github.com/golang/notexist/Godeps/_workspace/src/github.com/sdboyer/deptest/..."},
+			want:     []string{"github.com/sdboyer/deptest"},
+		},
+		"similarly named project": {
+			packages: []string{"github.com/golang/notexistalso"},
+			want:     []string{"github.com/golang/notexistalso"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGodepImporter(discardLogger, false, nil)
+			g.json.Packages = tc.packages
+
+			got := g.requiredPackages(testGodepProjectRoot)
+			if !equalSlice(got, tc.want) {
+				t.Fatalf("Expected required packages to be %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
 func TestGodepConfig_ProjectExistsInLock(t *testing.T) {
 	lock := &dep.Lock{}
 	pi := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/sdboyer/deptest")}
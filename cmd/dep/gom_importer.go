@@ -0,0 +1,265 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const gomfile = "Gomfile"
+
+// gomImporter imports gom configuration into the dep configuration format.
+type gomImporter struct {
+	packages []gomPackage
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGomImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gomImporter {
+	return &gomImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gomPackage is a single gom declaration from a Gomfile. At most one of
+// commit, tag and branch is expected to be set.
+type gomPackage struct {
+	importPath string
+	commit     string
+	tag        string
+	branch     string
+}
+
+var (
+	// gomDeclRe matches a gom declaration, e.g.
+	//   gom 'github.com/foo/bar', :commit => 'abc123'
+	gomDeclRe = regexp.MustCompile(`^gom\s+(?:'([^']*)'|"([^"]*)")\s*(?:,(.*))?$`)
+	// gomOptionRe matches the options of a gom declaration, in either the
+	// hash rocket (:tag => 'v1') or the symbol key (tag: 'v1') syntax.
+	gomOptionRe = regexp.MustCompile(`(?::(\w+)\s*=>|\b(\w+):)\s*('[^']*'|"[^"]*"|\[[^\]]*\]|[^,\s]+)`)
+	// gomGroupRe matches the opening of a group block, e.g. group :test do
+	gomGroupRe = regexp.MustCompile(`^group\s+.*\bdo$`)
+)
+
+func (g *gomImporter) Name() string {
+	return "gom"
+}
+
+func (g *gomImporter) HasDepMetadata(dir string) bool {
+	path := filepath.Join(dir, gomfile)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (g *gomImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the Gomfile. Group blocks are flattened, so the packages they declare
+// are imported like any other.
+func (g *gomImporter) load(projectDir string) error {
+	g.logger.Println("Detected gom configuration files...")
+	path := filepath.Join(projectDir, gomfile)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "end" || gomGroupRe.MatchString(line) {
+			continue
+		}
+
+		pkg, err := g.parseDecl(line)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to parse %s, line %d", path, n)
+		}
+		g.packages = append(g.packages, pkg)
+	}
+
+	return errors.Wrapf(scanner.Err(), "Unable to read %s", path)
+}
+
+// parseDecl parses a single gom declaration. Options other than commit, tag
+// and branch have no equivalent in dep, so they're ignored with a warning.
+func (g *gomImporter) parseDecl(line string) (gomPackage, error) {
+	var pkg gomPackage
+
+	m := gomDeclRe.FindStringSubmatch(line)
+	if m == nil {
+		return pkg, errors.Errorf("invalid gom declaration: %q", line)
+	}
+	pkg.importPath = m[1] + m[2]
+	if pkg.importPath == "" {
+		return pkg, errors.Errorf("invalid gom declaration, import path is required: %q", line)
+	}
+
+	for _, om := range gomOptionRe.FindAllStringSubmatch(m[3], -1) {
+		key, value := om[1]+om[2], strings.Trim(om[3], `'"`)
+
+		switch key {
+		case "commit":
+			pkg.commit = value
+		case "tag":
+			pkg.tag = value
+		case "branch":
+			pkg.branch = value
+		default:
+			g.logger.Printf("  Warning: Ignoring unsupported gom option %q for %s", key, pkg.importPath)
+		}
+	}
+
+	return pkg, nil
+}
+
+// convert the gom packages into dep configuration files.
+func (g *gomImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from Gomfile ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	seen := make(map[gps.ProjectRoot]bool)
+	for _, pkg := range g.packages {
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := g.sm.DeduceProjectRoot(pkg.importPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+
+		pi := gps.ProjectIdentifier{ProjectRoot: ip}
+
+		pc, err := g.buildProjectConstraint(pi, pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pc.Constraint != nil {
+			manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Constraint: pc.Constraint}
+		}
+
+		if lp, ok := g.buildLockedProject(pi, pkg, manifest); ok {
+			lock.P = append(lock.P, lp)
+		}
+	}
+
+	return manifest, lock, nil
+}
+
+// buildProjectConstraint creates a project constraint from the package's tag
+// or branch. A package pinned to a commit is constrained by the version
+// matching that commit instead, if there is one.
+func (g *gomImporter) buildProjectConstraint(pi gps.ProjectIdentifier, pkg gomPackage) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+
+	switch {
+	case pkg.commit != "":
+		version, err := lookupVersionForLockedProject(pi, nil, gps.Revision(pkg.commit), g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+			return pc, nil
+		}
+		pc.Constraint = getProjectPropertiesFromVersion(version).Constraint
+	case pkg.tag != "":
+		pc.Constraint, err = g.sm.InferConstraint(pkg.tag, pi)
+		if err != nil {
+			return
+		}
+	case pkg.branch != "":
+		pc.Constraint = gps.NewBranch(pkg.branch)
+	}
+
+	if pc.Constraint == nil {
+		return pc, nil
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return pc, nil
+}
+
+// buildLockedProject creates a lock project for the package's commit, or the
+// revision its tag or branch currently points to. Packages that aren't pinned
+// at all are left for the solver to pick, and false is returned.
+func (g *gomImporter) buildLockedProject(pi gps.ProjectIdentifier, pkg gomPackage, manifest *dep.Manifest) (gps.LockedProject, bool) {
+	var version gps.Version
+
+	if pkg.commit != "" {
+		pp := manifest.Constraints[pi.ProjectRoot]
+		v, err := lookupVersionForLockedProject(pi, pp.Constraint, gps.Revision(pkg.commit), g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+		}
+		version = v
+	} else {
+		name := pkg.tag
+		if name == "" {
+			name = pkg.branch
+		}
+		if name == "" {
+			return gps.LockedProject{}, false
+		}
+
+		versions, err := g.sm.ListVersions(pi)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(errors.Wrapf(err, "Unable to lookup the revision of %s in %s. Skipping the lock for this project.", name, pi.ProjectRoot).Error())
+			return gps.LockedProject{}, false
+		}
+		for _, pv := range versions {
+			if pv.String() == name {
+				version = pv
+				break
+			}
+		}
+		if version == nil {
+			return gps.LockedProject{}, false
+		}
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return lp, true
+}
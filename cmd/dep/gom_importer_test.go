@@ -0,0 +1,273 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestGomConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		packages []gomPackage
+	}{
+		"commit": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]gomPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+					commit: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+		"tag": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^0.8.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v0.8.0",
+				wantLockCount:      1,
+			},
+			[]gomPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					tag:        "v0.8.0",
+				},
+			},
+		},
+		"branch": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "master",
+				wantVersion:        "master",
+				wantLockCount:      1,
+			},
+			[]gomPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					branch:     "master",
+				},
+			},
+		},
+		"unpinned": {
+			importConverterTestCase{
+				projectRoot:   "github.com/sdboyer/deptest",
+				wantLockCount: 0,
+			},
+			[]gomPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+				},
+			},
+		},
+		"sub-packages": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "^1.0.0",
+				wantLockCount:  1,
+			},
+			[]gomPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					commit:     "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+				{
+					importPath: "github.com/sdboyer/deptest/foo",
+					commit:     "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGomImporter(discardLogger, true, sm)
+			g.packages = testCase.packages
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGomConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, gomfile), "gom/Gomfile")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGomImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect gom configuration file")
+	}
+
+	m, l, err := g.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "gom/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGomConfig_Load(t *testing.T) {
+	// This is same as cmd/dep/testdata/gom/Gomfile
+	wantPackages := []gomPackage{
+		{
+			importPath: "github.com/sdboyer/deptest",
+			commit:     "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+		},
+		{
+			importPath: "github.com/sdboyer/deptest/foo",
+			commit:     "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+		},
+		{
+			importPath: "github.com/sdboyer/deptestdos",
+			tag:        "v2.0.0",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, gomfile), "gom/Gomfile")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	g := newGomImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if len(g.packages) != len(wantPackages) {
+		t.Fatalf("Expected %d packages, got %d", len(wantPackages), len(g.packages))
+	}
+	for i := range wantPackages {
+		if g.packages[i] != wantPackages[i] {
+			t.Fatalf("Expected package %d to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", i, g.packages[i], wantPackages[i])
+		}
+	}
+}
+
+func TestGomConfig_ParseDecl(t *testing.T) {
+	testCases := map[string]struct {
+		line        string
+		want        gomPackage
+		wantWarning string
+		wantErr     bool
+	}{
+		"no options": {
+			line: "gom 'github.com/sdboyer/deptest'",
+			want: gomPackage{importPath: "github.com/sdboyer/deptest"},
+		},
+		"commit": {
+			line: `gom "github.com/sdboyer/deptest", :commit => "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"`,
+			want: gomPackage{importPath: "github.com/sdboyer/deptest", commit: "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"},
+		},
+		"tag": {
+			line: "gom 'github.com/sdboyer/deptest', :tag => 'v1.0.0'",
+			want: gomPackage{importPath: "github.com/sdboyer/deptest", tag: "v1.0.0"},
+		},
+		"symbol key branch": {
+			line: "gom 'github.com/sdboyer/deptest', branch: 'master'",
+			want: gomPackage{importPath: "github.com/sdboyer/deptest", branch: "master"},
+		},
+		"unknown option": {
+			line:        "gom 'github.com/sdboyer/deptest', :goos => 'windows', :tag => 'v1.0.0'",
+			want:        gomPackage{importPath: "github.com/sdboyer/deptest", tag: "v1.0.0"},
+			wantWarning: `Ignoring unsupported gom option "goos"`,
+		},
+		"unknown array option": {
+			line:        "gom 'github.com/sdboyer/deptest', :goarch => ['amd64', '386'], :branch => 'master'",
+			want:        gomPackage{importPath: "github.com/sdboyer/deptest", branch: "master"},
+			wantWarning: `Ignoring unsupported gom option "goarch"`,
+		},
+		"not a declaration": {
+			line:    "gem 'github.com/sdboyer/deptest'",
+			wantErr: true,
+		},
+		"empty import path": {
+			line:    "gom ''",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			g := newGomImporter(log.New(output, "", 0), false, nil)
+
+			got, err := g.parseDecl(tc.line)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error state, wantErr %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got != tc.want {
+				t.Fatalf("Expected %+v, got %+v", tc.want, got)
+			}
+			if tc.wantWarning != "" && !strings.Contains(output.String(), tc.wantWarning) {
+				t.Fatalf("Expected output to contain %q, got %q", tc.wantWarning, output.String())
+			}
+		})
+	}
+}
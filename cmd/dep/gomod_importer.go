@@ -0,0 +1,393 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const (
+	gomodFile = "go.mod"
+	gosumFile = "go.sum"
+)
+
+// gomodImporter imports go module configuration into the dep configuration
+// format.
+type gomodImporter struct {
+	mod gomodFileData
+	sum map[string]bool
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGomodImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gomodImporter {
+	return &gomodImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gomodFileData holds the directives of a go.mod file which are relevant to
+// dep.
+type gomodFileData struct {
+	module   string
+	requires []gomodRequire
+	replaces []gomodReplace
+	excludes []gomodRequire
+}
+
+type gomodRequire struct {
+	path     string
+	version  string
+	indirect bool
+}
+
+// gomodReplace replaces a module, optionally only at oldVersion, with another
+// module or a local directory.
+type gomodReplace struct {
+	oldPath    string
+	oldVersion string
+	newPath    string
+	newVersion string
+}
+
+func (g *gomodImporter) Name() string {
+	return "go modules"
+}
+
+func (g *gomodImporter) HasDepMetadata(dir string) bool {
+	path := filepath.Join(dir, gomodFile)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (g *gomodImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the go.mod file, and go.sum if there is one.
+func (g *gomodImporter) load(projectDir string) error {
+	g.logger.Println("Detected go.mod configuration files...")
+	path := filepath.Join(projectDir, gomodFile)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", path)
+	}
+	defer f.Close()
+
+	g.mod, err = parseGomod(f)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", path)
+	}
+
+	sumPath := filepath.Join(projectDir, gosumFile)
+	sf, err := os.Open(sumPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", sumPath)
+	}
+	defer sf.Close()
+
+	if g.verbose {
+		g.logger.Printf("  Loading %s", sumPath)
+	}
+	g.sum, err = parseGosum(sf)
+	return errors.Wrapf(err, "Unable to parse %s", sumPath)
+}
+
+// parseGomod reads the module, require, replace and exclude directives from a
+// go.mod file, in both their single line and block forms.
+func parseGomod(r io.Reader) (gomodFileData, error) {
+	var mod gomodFileData
+	var block string
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		indirect := false
+		if i := strings.Index(line, "//"); i >= 0 {
+			indirect = strings.TrimSpace(line[i+2:]) == "indirect"
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		for i := range fields {
+			fields[i] = strings.Trim(fields[i], `"`)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		verb := block
+		if block == "" {
+			verb, fields = fields[0], fields[1:]
+			if len(fields) == 1 && fields[0] == "(" {
+				block = verb
+				continue
+			}
+		} else if fields[0] == ")" {
+			block = ""
+			continue
+		}
+
+		switch verb {
+		case "module":
+			if len(fields) != 1 {
+				return mod, errors.Errorf("line %d: usage: module path", n)
+			}
+			mod.module = fields[0]
+		case "require", "exclude":
+			if len(fields) != 2 {
+				return mod, errors.Errorf("line %d: usage: %s module/path v1.2.3", n, verb)
+			}
+			req := gomodRequire{path: fields[0], version: fields[1], indirect: indirect}
+			if verb == "require" {
+				mod.requires = append(mod.requires, req)
+			} else {
+				mod.excludes = append(mod.excludes, req)
+			}
+		case "replace":
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 1 || arrow > 2 || len(fields)-arrow-1 < 1 || len(fields)-arrow-1 > 2 {
+				return mod, errors.Errorf("line %d: usage: replace module/path [v1.2.3] => other/module v1.4 or replace module/path [v1.2.3] => ../local/directory", n)
+			}
+			rep := gomodReplace{oldPath: fields[0], newPath: fields[arrow+1]}
+			if arrow == 2 {
+				rep.oldVersion = fields[1]
+			}
+			if len(fields) == arrow+3 {
+				rep.newVersion = fields[arrow+2]
+			}
+			mod.replaces = append(mod.replaces, rep)
+		default:
+			// The go directive and anything added to go.mod since have no
+			// equivalent in dep.
+		}
+	}
+
+	return mod, scanner.Err()
+}
+
+// parseGosum reads the module versions recorded in a go.sum file, keyed by
+// "path version".
+func parseGosum(r io.Reader) (map[string]bool, error) {
+	sum := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, errors.Errorf("invalid go.sum line: %q", scanner.Text())
+		}
+		sum[fields[0]+" "+strings.TrimSuffix(fields[1], "/go.mod")] = true
+	}
+
+	return sum, scanner.Err()
+}
+
+// convert the go.mod directives into dep configuration files.
+func (g *gomodImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from go.mod ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, ex := range g.mod.excludes {
+		g.logger.Printf("  Warning: Ignoring the exclusion of %s@%s, it has no equivalent in dep", ex.path, ex.version)
+	}
+
+	for _, req := range g.mod.requires {
+		path, version := req.path, req.version
+		source := ""
+
+		if rep, ok := g.replacement(req); ok {
+			if isLocalModulePath(rep.newPath) {
+				g.logger.Printf("  Warning: Skipping %s, it is replaced by the local directory %s", req.path, rep.newPath)
+				continue
+			}
+			if rep.newPath != req.path {
+				source = rep.newPath
+			}
+			if rep.newVersion != "" {
+				version = rep.newVersion
+			}
+		}
+
+		if g.sum != nil && !g.sum[req.path+" "+req.version] {
+			g.logger.Printf("  Warning: %s@%s is missing from go.sum", req.path, req.version)
+		}
+
+		// Obtain ProjectRoot. Required for avoiding sub-package imports, and
+		// removes the major version suffix of modules at v2 or higher.
+		ip, err := g.sm.DeduceProjectRoot(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if isPathPrefix(string(pr), string(ip)) {
+			continue
+		}
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, string(ip)) {
+			continue
+		}
+
+		pi := gps.ProjectIdentifier{ProjectRoot: ip, Source: source}
+
+		if rev, ok := pseudoVersionRevision(version); ok {
+			g.convertRevision(pi, rev, manifest, lock)
+		} else {
+			err = g.convertVersion(pi, strings.TrimSuffix(version, "+incompatible"), manifest, lock)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return manifest, lock, nil
+}
+
+// replacement finds the replace directive which applies to req, if any.
+func (g *gomodImporter) replacement(req gomodRequire) (gomodReplace, bool) {
+	for _, rep := range g.mod.replaces {
+		if rep.oldPath == req.path && (rep.oldVersion == "" || rep.oldVersion == req.version) {
+			return rep, true
+		}
+	}
+	return gomodReplace{}, false
+}
+
+// convertVersion constrains the project to versions compatible with the
+// required semantic version, and locks it to that version.
+func (g *gomodImporter) convertVersion(pi gps.ProjectIdentifier, version string, manifest *dep.Manifest, lock *dep.Lock) error {
+	c, err := gps.NewSemverConstraintIC(version)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid version %s for %s", version, pi.ProjectRoot)
+	}
+
+	pc := gps.ProjectConstraint{Ident: pi, Constraint: c}
+	manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Source: pi.Source, Constraint: c}
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	versions, err := g.sm.ListVersions(pi)
+	if err != nil {
+		// Only warn about the problem, it is not enough to warrant failing
+		g.logger.Println(errors.Wrapf(err, "Unable to lookup the revision of %s in %s. Skipping the lock for this project.", version, pi.ProjectRoot).Error())
+		return nil
+	}
+	for _, v := range versions {
+		if v.String() == version {
+			lp := gps.NewLockedProject(pi, v, nil)
+			f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+			f.LogFeedback(g.logger)
+			lock.P = append(lock.P, lp)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// convertRevision locks the project to the revision of a pseudo-version. Those
+// only carry an abbreviated revision, so it's expanded from the project's
+// versions where possible.
+func (g *gomodImporter) convertRevision(pi gps.ProjectIdentifier, rev string, manifest *dep.Manifest, lock *dep.Lock) {
+	revision := gps.Revision(rev)
+	versions, err := g.sm.ListVersions(pi)
+	if err != nil {
+		// Only warn about the problem, it is not enough to warrant failing
+		g.logger.Println(errors.Wrapf(err, "Unable to lookup the version represented by %s in %s(%s). Falling back to locking the abbreviated revision.", rev, pi.ProjectRoot, pi.Source).Error())
+	}
+	for _, v := range versions {
+		if strings.HasPrefix(string(v.Revision()), rev) {
+			revision = v.Revision()
+			break
+		}
+	}
+
+	version, err := lookupVersionForLockedProject(pi, nil, revision, g.sm)
+	if err == nil {
+		pp := getProjectPropertiesFromVersion(version)
+		if pp.Constraint != nil {
+			pp.Source = pi.Source
+			manifest.Constraints[pi.ProjectRoot] = pp
+			pc := gps.ProjectConstraint{Ident: pi, Constraint: pp.Constraint}
+			f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+			f.LogFeedback(g.logger)
+		}
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+	lock.P = append(lock.P, lp)
+}
+
+// pseudoVersionRevision extracts the abbreviated revision from a go modules
+// pseudo-version, such as v0.0.0-20170915032832-14c0d48ead0c.
+func pseudoVersionRevision(version string) (string, bool) {
+	version = strings.TrimSuffix(version, "+incompatible")
+	i := strings.LastIndex(version, "-")
+	if i < 0 {
+		return "", false
+	}
+
+	rev := version[i+1:]
+	ts := version[:i]
+	if j := strings.LastIndexAny(ts, "-."); j >= 0 {
+		ts = ts[j+1:]
+	}
+	if len(rev) != 12 || len(ts) != 14 || strings.Trim(ts, "0123456789") != "" || strings.Trim(rev, "0123456789abcdef") != "" {
+		return "", false
+	}
+
+	return rev, true
+}
+
+// isLocalModulePath reports whether the target of a replace directive is a
+// directory on disk rather than a module.
+func isLocalModulePath(path string) bool {
+	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") || filepath.IsAbs(path) ||
+		path == "." || path == ".."
+}
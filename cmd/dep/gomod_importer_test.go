@@ -0,0 +1,302 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestGomodConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		mod gomodFileData
+	}{
+		"semver": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^0.8.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v0.8.0",
+				wantLockCount:      1,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: "github.com/sdboyer/deptest", version: "v0.8.0"}},
+			},
+		},
+		"incompatible major version": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptestdos",
+				matchPairedVersion: true,
+				wantConstraint:     "^2.0.0",
+				wantRevision:       gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+				wantVersion:        "v2.0.0",
+				wantLockCount:      1,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: "github.com/sdboyer/deptestdos", version: "v2.0.0+incompatible"}},
+			},
+		},
+		"pseudo-version": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: "github.com/sdboyer/deptest", version: "v0.0.0-20170502185457-ff2948a2ac8f"}},
+			},
+		},
+		"replace": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantSourceRepo: "github.com/carolynvs/deptest",
+				wantConstraint: "^1.0.0",
+				wantLockCount:  1,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: "github.com/sdboyer/deptest", version: "v0.8.0"}},
+				replaces: []gomodReplace{{oldPath: "github.com/sdboyer/deptest", newPath: "github.com/carolynvs/deptest", newVersion: "v1.0.0"}},
+			},
+		},
+		"replace with local directory": {
+			importConverterTestCase{
+				wantLockCount: 0,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: "github.com/sdboyer/deptest", version: "v0.8.0"}},
+				replaces: []gomodReplace{{oldPath: "github.com/sdboyer/deptest", newPath: "../deptest"}},
+			},
+		},
+		"exclude": {
+			importConverterTestCase{
+				wantLockCount: 0,
+			},
+			gomodFileData{
+				excludes: []gomodRequire{{path: "github.com/sdboyer/deptest", version: "v0.8.0"}},
+			},
+		},
+		"self": {
+			importConverterTestCase{
+				wantLockCount: 0,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: testProjectRoot + "/sub", version: "v1.0.0"}},
+			},
+		},
+		"bad input - invalid version": {
+			importConverterTestCase{
+				wantConvertErr: true,
+			},
+			gomodFileData{
+				requires: []gomodRequire{{path: "github.com/sdboyer/deptest", version: "latest"}},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGomodImporter(discardLogger, true, sm)
+			g.mod = testCase.mod
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGomodConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, gomodFile), "gomod/go.mod")
+	h.TempCopy(filepath.Join(testProjectRoot, gosumFile), "gomod/go.sum")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGomodImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect go.mod")
+	}
+
+	m, l, err := g.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "gomod/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGomodConfig_Load(t *testing.T) {
+	// This is same as cmd/dep/testdata/gomod/go.mod
+	wantMod := gomodFileData{
+		module: "github.com/golang/notexist",
+		requires: []gomodRequire{
+			{path: "github.com/sdboyer/deptest", version: "v0.8.1"},
+			{path: "github.com/sdboyer/deptestdos", version: "v2.0.0+incompatible", indirect: true},
+			{path: "github.com/example/local", version: "v1.0.0"},
+		},
+		replaces: []gomodReplace{
+			{oldPath: "github.com/example/local", newPath: "../local"},
+		},
+		excludes: []gomodRequire{
+			{path: "github.com/sdboyer/deptest", version: "v0.8.0"},
+		},
+	}
+	wantSum := map[string]bool{
+		"github.com/sdboyer/deptest v0.8.1":                 true,
+		"github.com/sdboyer/deptestdos v2.0.0+incompatible": true,
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, gomodFile), "gomod/go.mod")
+	h.TempCopy(filepath.Join(testProjectRoot, gosumFile), "gomod/go.sum")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	g := newGomodImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if !reflect.DeepEqual(g.mod, wantMod) {
+		t.Fatalf("Unexpected go.mod contents.\n\t(GOT): %+v\n\t(WNT): %+v", g.mod, wantMod)
+	}
+	if !reflect.DeepEqual(g.sum, wantSum) {
+		t.Fatalf("Unexpected go.sum contents.\n\t(GOT): %+v\n\t(WNT): %+v", g.sum, wantSum)
+	}
+}
+
+func TestGomodConfig_ParseReplace(t *testing.T) {
+	testCases := map[string]struct {
+		line    string
+		want    gomodReplace
+		wantErr bool
+	}{
+		"module": {
+			line: "replace github.com/sdboyer/deptest => github.com/carolynvs/deptest v1.0.0",
+			want: gomodReplace{oldPath: "github.com/sdboyer/deptest", newPath: "github.com/carolynvs/deptest", newVersion: "v1.0.0"},
+		},
+		"versioned": {
+			line: "replace github.com/sdboyer/deptest v0.8.0 => github.com/carolynvs/deptest v1.0.0",
+			want: gomodReplace{oldPath: "github.com/sdboyer/deptest", oldVersion: "v0.8.0", newPath: "github.com/carolynvs/deptest", newVersion: "v1.0.0"},
+		},
+		"local directory": {
+			line: "replace github.com/sdboyer/deptest => ./deptest",
+			want: gomodReplace{oldPath: "github.com/sdboyer/deptest", newPath: "./deptest"},
+		},
+		"missing target": {
+			line:    "replace github.com/sdboyer/deptest =>",
+			wantErr: true,
+		},
+		"missing arrow": {
+			line:    "replace github.com/sdboyer/deptest github.com/carolynvs/deptest",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mod, err := parseGomod(strings.NewReader(tc.line))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error state, wantErr %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if len(mod.replaces) != 1 || mod.replaces[0] != tc.want {
+				t.Fatalf("Expected %+v, got %+v", tc.want, mod.replaces)
+			}
+		})
+	}
+}
+
+func TestPseudoVersionRevision(t *testing.T) {
+	testCases := map[string]string{
+		"v0.0.0-20170502185457-ff2948a2ac8f":                "ff2948a2ac8f",
+		"v1.2.4-0.20170502185457-ff2948a2ac8f":              "ff2948a2ac8f",
+		"v1.2.3-pre.0.20170502185457-ff2948a2ac8f":          "ff2948a2ac8f",
+		"v2.0.1-0.20170502185457-ff2948a2ac8f+incompatible": "ff2948a2ac8f",
+		"v1.0.0":          "",
+		"v1.0.0-rc1":      "",
+		"v1.0.0-beta-123": "",
+	}
+
+	for version, want := range testCases {
+		got, ok := pseudoVersionRevision(version)
+		if ok != (want != "") || got != want {
+			t.Errorf("pseudoVersionRevision(%q) = %q, %v; want %q", version, got, ok, want)
+		}
+	}
+}
+
+func TestGomodConfig_OtherToolsTakePrecedence(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	a := newRootAnalyzer(false, ctx, nil, nil)
+
+	h.TempCopy(filepath.Join(testProjectRoot, gomodFile), "gomod/go.mod")
+	h.TempCopy(filepath.Join(testProjectRoot, glideYamlName), "glide/glide.yaml")
+
+	detected, err := a.detectImporters(h.Path(testProjectRoot), discardLogger)
+	h.Must(err)
+
+	if len(detected) != 1 || detected[0].Name() != "glide" {
+		t.Fatalf("Expected only the glide importer to be picked over go.mod, got %v", importerNames(detected))
+	}
+}
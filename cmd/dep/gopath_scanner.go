@@ -5,8 +5,7 @@
 package main
 
 import (
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -26,6 +25,10 @@ type gopathScanner struct {
 	directDeps map[string]bool
 	sm         gps.SourceManager
 
+	// noConstraints disables inferring constraints from the versions of the
+	// projects in GOPATH; they're only locked.
+	noConstraints bool
+
 	pd    projectData
 	origM *dep.Manifest
 	origL *dep.Lock
@@ -85,11 +88,13 @@ func (g *gopathScanner) InitializeRootManifestAndLock(rootM *dep.Manifest, rootL
 
 // Fill in gaps in the root manifest/lock with data found from the GOPATH.
 func (g *gopathScanner) overlay(rootM *dep.Manifest, rootL *dep.Lock) {
+	added := make(map[gps.ProjectRoot]bool)
 	for pkg, prj := range g.origM.Constraints {
 		if _, has := rootM.Constraints[pkg]; has {
 			continue
 		}
 		rootM.Constraints[pkg] = prj
+		added[pkg] = true
 		v := g.pd.ondisk[pkg]
 
 		pi := gps.ProjectIdentifier{ProjectRoot: pkg, Source: prj.Source}
@@ -113,13 +118,14 @@ func (g *gopathScanner) overlay(rootM *dep.Manifest, rootL *dep.Lock) {
 		rootL.P = append(rootL.P, lp)
 		lockedProjects[pkg] = true
 
-		if _, isDirect := g.directDeps[string(pkg)]; !isDirect {
+		if !g.pd.direct[pkg] {
 			f := fb.NewLockedProjectFeedback(lp, fb.DepTypeTransitive)
 			f.LogFeedback(g.ctx.Err)
 		}
 	}
 
-	// Identify projects whose version is unknown and will have to be solved for
+	// Identify projects whose version is unknown and will have to be solved
+	// for, falling back on the network for each of them.
 	var unlockedProjects []string
 	for pr := range g.pd.notondisk {
 		if _, isLocked := lockedProjects[pr]; isLocked {
@@ -127,10 +133,47 @@ func (g *gopathScanner) overlay(rootM *dep.Manifest, rootL *dep.Lock) {
 		}
 		unlockedProjects = append(unlockedProjects, string(pr))
 	}
-	if len(unlockedProjects) > 0 {
-		g.ctx.Err.Printf("Following dependencies were not found in GOPATH. "+
-			"Dep will use the most recent versions of these projects.\n  %s",
-			strings.Join(unlockedProjects, "\n  "))
+	sort.Strings(unlockedProjects)
+	for _, pr := range unlockedProjects {
+		g.ctx.Err.Printf("Note: %s %s; dep will use its most recent version instead.\n", pr, g.pd.notondisk[gps.ProjectRoot(pr)])
+	}
+
+	g.logInferredConstraints(rootM, added)
+}
+
+// logInferredConstraints summarizes how many of the direct dependencies found
+// in GOPATH were constrained by a tag or a branch they're checked out at, and
+// which weren't constrained, being only locked to their version in GOPATH.
+// added holds the projects whose inferred constraints were added to rootM;
+// those which rootM constrained already, e.g. from imported configuration,
+// are left out.
+func (g *gopathScanner) logInferredConstraints(rootM *dep.Manifest, added map[gps.ProjectRoot]bool) {
+	var tags, branches int
+	var none []string
+	for pr := range g.pd.direct {
+		if _, has := g.pd.ondisk[pr]; !has {
+			continue
+		}
+		if !added[pr] {
+			if _, has := rootM.Constraints[pr]; !has {
+				none = append(none, string(pr))
+			}
+			continue
+		}
+		if v, ok := rootM.Constraints[pr].Constraint.(gps.Version); ok && v.Type() == gps.IsBranch {
+			branches++
+		} else {
+			tags++
+		}
+	}
+	if tags+branches+len(none) == 0 {
+		return
+	}
+
+	g.ctx.Err.Printf("Inferred constraints from GOPATH: %d from tags, %d from branches, %d unconstrained\n", tags, branches, len(none))
+	if len(none) > 0 {
+		sort.Strings(none)
+		g.ctx.Err.Printf("  Locked to their version in GOPATH, without a constraint:\n    %s\n", strings.Join(none, "\n    "))
 	}
 }
 
@@ -165,7 +208,12 @@ func getProjectPropertiesFromVersion(v gps.Version) gps.ProjectProperties {
 	}
 
 	switch v.Type() {
-	case gps.IsBranch, gps.IsVersion:
+	case gps.IsBranch:
+		// The default branch is what's picked anyway without a constraint.
+		if !gps.IsDefaultBranch(v) {
+			pp.Constraint = v
+		}
+	case gps.IsVersion:
 		pp.Constraint = v
 	case gps.IsSemver:
 		c, err := gps.NewSemverConstraintIC(v.String())
@@ -178,10 +226,14 @@ func getProjectPropertiesFromVersion(v gps.Version) gps.ProjectProperties {
 	return pp
 }
 
+// notInGopath is why projects which aren't in GOPATH at all aren't on disk.
+const notInGopath = "was not found in any GOPATH entry"
+
 type projectData struct {
 	constraints  gps.ProjectConstraints          // constraints that could be found
 	dependencies map[gps.ProjectRoot][]string    // all dependencies (imports) found by project root
-	notondisk    map[gps.ProjectRoot]bool        // projects that were not found on disk
+	direct       map[gps.ProjectRoot]bool        // projects directly imported by the root project
+	notondisk    map[gps.ProjectRoot]string      // projects that were not found on disk, with why
 	ondisk       map[gps.ProjectRoot]gps.Version // projects that were found on disk
 }
 
@@ -189,8 +241,9 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 	constraints := make(gps.ProjectConstraints)
 	dependencies := make(map[gps.ProjectRoot][]string)
 	packages := make(map[string]bool)
-	notondisk := make(map[gps.ProjectRoot]bool)
+	notondisk := make(map[gps.ProjectRoot]string)
 	ondisk := make(map[gps.ProjectRoot]gps.Version)
+	direct := make(map[gps.ProjectRoot]bool)
 
 	var syncDepGroup sync.WaitGroup
 	syncDep := func(pr gps.ProjectRoot, sm gps.SourceManager) {
@@ -211,6 +264,7 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 		}
 
 		packages[ip] = true
+		direct[pr] = true
 		if _, has := dependencies[pr]; has {
 			dependencies[pr] = append(dependencies[pr], ip)
 			continue
@@ -221,16 +275,19 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 		dependencies[pr] = []string{ip}
 		abs, err := g.ctx.AbsForImport(string(pr))
 		if err != nil {
-			notondisk[pr] = true
+			notondisk[pr] = notInGopath
 			continue
 		}
 		v, err := gps.VCSVersion(abs)
 		if err != nil {
-			notondisk[pr] = true
+			notondisk[pr] = "is in GOPATH, but its version there can't be determined"
 			continue
 		}
 
 		ondisk[pr] = v
+		if g.noConstraints {
+			continue
+		}
 		pp := getProjectPropertiesFromVersion(v)
 		if pp.Constraint != nil || pp.Source != "" {
 			constraints[pr] = pp
@@ -265,21 +322,20 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 			// We already visited this project root earlier via some other
 			// pkg within it, and made the decision that it's not on disk.
 			// Respect that decision, and pop the stack.
-			if notondisk[pr] {
+			if notondisk[pr] != "" {
 				colors[pkg] = black
 				return nil
 			}
 
 			ptree, has := ptrees[pr]
 			if !has {
-				// It's fine if the root does not exist - it indicates that this
-				// project is not present in the workspace, and so we need to
-				// solve to deal with this dep.
-				r := filepath.Join(g.ctx.GOPATH, "src", string(pr))
-				fi, err := os.Stat(r)
-				if os.IsNotExist(err) || !fi.IsDir() {
+				// It's fine if the root does not exist in any GOPATH - it
+				// indicates that this project is not present in the workspace,
+				// and so we need to solve to deal with this dep.
+				r, err := g.ctx.AbsForImport(string(pr))
+				if err != nil {
 					colors[pkg] = black
-					notondisk[pr] = true
+					notondisk[pr] = notInGopath
 					return nil
 				}
 
@@ -288,20 +344,14 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 				// was found in the initial pass on direct imports. We know it's
 				// the former if there's no entry for it in the ondisk map.
 				if _, in := ondisk[pr]; !in {
-					abs, err := g.ctx.AbsForImport(string(pr))
-					if err != nil {
-						colors[pkg] = black
-						notondisk[pr] = true
-						return nil
-					}
-					v, err := gps.VCSVersion(abs)
+					v, err := gps.VCSVersion(r)
 					if err != nil {
 						// Even if we know it's on disk, errors are still
 						// possible when trying to deduce version. If we
 						// encounter such an error, just treat the project as
 						// not being on disk; the solver will work it out.
 						colors[pkg] = black
-						notondisk[pr] = true
+						notondisk[pr] = "is in GOPATH, but its version there can't be determined"
 						return nil
 					}
 					ondisk[pr] = v
@@ -327,7 +377,7 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 			if !ok {
 				colors[pkg] = black
 				// not on disk...
-				notondisk[pr] = true
+				notondisk[pr] = "is in GOPATH, but without the package " + pkg
 				return nil
 			}
 			if _, ok := errmap[pkg]; ok {
@@ -380,6 +430,7 @@ func (g *gopathScanner) scanGopathForDependencies() (projectData, error) {
 	pd := projectData{
 		constraints:  constraints,
 		dependencies: dependencies,
+		direct:       direct,
 		notondisk:    notondisk,
 		ondisk:       ondisk,
 	}
@@ -5,7 +5,12 @@
 package main
 
 import (
+	"bytes"
+	"log"
+	"os/exec"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/golang/dep"
@@ -120,6 +125,197 @@ func TestGopathScanner_OverlayLockProjects(t *testing.T) {
 	}
 }
 
+func TestGopathScanner_NonTagRevision(t *testing.T) {
+	test.NeedsGit(t)
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	var stderr bytes.Buffer
+	ctx.Err = log.New(&stderr, "", 0)
+
+	// testProject1 is checked out in GOPATH at a commit after its only tag,
+	// while testProject2 isn't in GOPATH at all.
+	git := newGopathRepo(t, h, testProject1)
+	git("tag", "v1.0.0")
+	h.TempFile("src/"+testProject1+"/other.go", "package deptest\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "second")
+	rev := git("rev-parse", "HEAD")
+	git("checkout", "-q", rev)
+
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	directDeps := map[string]bool{testProject1: true, testProject2: true}
+	gs := newGopathScanner(ctx, directDeps, newOfflineSourceManager(sm, nil))
+	rootM := &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
+	rootL := &dep.Lock{}
+	h.Must(gs.InitializeRootManifestAndLock(rootM, rootL))
+
+	if pp, has := rootM.Constraints[gps.ProjectRoot(testProject1)]; has {
+		t.Errorf("Expected no constraint on %s at a non-tag revision, got %v", testProject1, pp.Constraint)
+	}
+	if len(rootL.P) != 1 {
+		t.Fatalf("Expected only %s to be locked, got %v", testProject1, rootL.P)
+	}
+	if got, want := rootL.P[0].Version(), gps.Revision(rev); got != want {
+		t.Errorf("Expected %s to be locked to %s, got %s", testProject1, want, got)
+	}
+
+	wantNote := "Note: " + testProject2 + " " + notInGopath
+	if !strings.Contains(stderr.String(), wantNote) {
+		t.Errorf("Expected a note that %s falls back on the network, got:\n%s", testProject2, stderr.String())
+	}
+}
+
+func TestGopathScanner_InferConstraints(t *testing.T) {
+	test.NeedsGit(t)
+
+	const (
+		tagged   = "github.com/example/tagged"
+		branched = "github.com/example/branched"
+		atHEAD   = "github.com/example/athead"
+	)
+	cases := map[string]struct {
+		noConstraints bool
+		want          map[string]string
+		wantSummary   string
+	}{
+		"infer": {
+			want: map[string]string{
+				tagged:   "^1.0.0",
+				branched: "dev",
+			},
+			wantSummary: "Inferred constraints from GOPATH: 1 from tags, 1 from branches, 1 unconstrained\n" +
+				"  Locked to their version in GOPATH, without a constraint:\n" +
+				"    " + atHEAD + "\n",
+		},
+		"no constraints": {
+			noConstraints: true,
+			want:          map[string]string{},
+			wantSummary: "Inferred constraints from GOPATH: 0 from tags, 0 from branches, 3 unconstrained\n" +
+				"  Locked to their version in GOPATH, without a constraint:\n" +
+				"    " + atHEAD + "\n" +
+				"    " + branched + "\n" +
+				"    " + tagged + "\n",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			ctx := newTestContext(h)
+			var stderr bytes.Buffer
+			ctx.Err = log.New(&stderr, "", 0)
+
+			// tagged is checked out at a semver tag, branched on a branch
+			// other than its default one, and atHEAD on its default branch.
+			git := newGopathRepo(t, h, tagged)
+			git("tag", "v1.0.0")
+			git("checkout", "-q", "v1.0.0")
+			git = newGopathRepo(t, h, branched)
+			git("checkout", "-q", "-b", "dev")
+			git("update-ref", "refs/remotes/origin/dev", "HEAD")
+			newGopathRepo(t, h, atHEAD)
+
+			sm, err := ctx.SourceManager()
+			h.Must(err)
+			defer sm.Release()
+
+			directDeps := map[string]bool{tagged: true, branched + "/sub": true, atHEAD: true}
+			gs := newGopathScanner(ctx, directDeps, newOfflineSourceManager(sm, nil))
+			gs.noConstraints = c.noConstraints
+			rootM := &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
+			rootL := &dep.Lock{}
+			h.Must(gs.InitializeRootManifestAndLock(rootM, rootL))
+
+			got := make(map[string]string)
+			for pr, pp := range rootM.Constraints {
+				got[string(pr)] = pp.Constraint.String()
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("unexpected constraints:\n\t(GOT): %v\n\t(WNT): %v", got, c.want)
+			}
+			if len(rootL.P) != 3 {
+				t.Errorf("Expected all 3 projects to be locked, got %v", rootL.P)
+			}
+			if !strings.Contains(stderr.String(), c.wantSummary) {
+				t.Errorf("Expected the summary:\n%s\ngot:\n%s", c.wantSummary, stderr.String())
+			}
+		})
+	}
+}
+
+func TestGopathScanner_MultipleGOPATHs(t *testing.T) {
+	test.NeedsGit(t)
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// The project is in the first GOPATH entry, while testProject1 is in the
+	// second one, checked out at a tag.
+	ctx := newTestContext(h)
+	h.TempDir("first/src")
+	ctx.GOPATH = h.Path("first")
+	ctx.GOPATHs = []string{h.Path("first"), h.Path(".")}
+	git := newGopathRepo(t, h, testProject1)
+	git("tag", "v1.0.0")
+	git("checkout", "-q", "v1.0.0")
+
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	gs := newGopathScanner(ctx, map[string]bool{testProject1: true}, newOfflineSourceManager(sm, nil))
+	rootM := &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
+	rootL := &dep.Lock{}
+	h.Must(gs.InitializeRootManifestAndLock(rootM, rootL))
+
+	pp, has := rootM.Constraints[gps.ProjectRoot(testProject1)]
+	if !has {
+		t.Fatalf("Expected %s to be constrained from the second GOPATH entry", testProject1)
+	}
+	if got := pp.Constraint.String(); got != "^1.0.0" {
+		t.Errorf("Expected %s to be constrained to ^1.0.0, got %s", testProject1, got)
+	}
+	if len(rootL.P) != 1 || rootL.P[0].Version().String() != "v1.0.0" {
+		t.Errorf("Expected %s to be locked to v1.0.0, got %v", testProject1, rootL.P)
+	}
+}
+
+// newGopathRepo creates a git repo for the project at the import path ip in
+// the GOPATH of h, with a commit on master, which origin/HEAD points at as it
+// would in a clone. It returns a func to run git in the repo.
+func newGopathRepo(t *testing.T, h *test.Helper, ip string) func(args ...string) string {
+	h.TempFile("src/"+ip+"/"+path.Base(ip)+".go", "package "+path.Base(ip)+"\n")
+	h.TempFile("src/"+ip+"/sub/sub.go", "package sub\n")
+	dir := h.Path("src/" + ip)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("remote", "add", "origin", "https://"+ip)
+	git("config", "user.email", "dep@example.com")
+	git("config", "user.name", "dep")
+	git("checkout", "-q", "-b", "master")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	git("update-ref", "refs/remotes/origin/master", "HEAD")
+	git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/master")
+	return git
+}
+
 func TestContains(t *testing.T) {
 	t.Parallel()
 	a := []string{"a", "b", "abcd"}
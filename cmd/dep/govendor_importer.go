@@ -0,0 +1,245 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const govendorDir = "vendor"
+const govendorName = "vendor.json"
+
+// govendorImporter imports govendor configuration into the dep configuration format.
+type govendorImporter struct {
+	file govendorFile
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGovendorImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *govendorImporter {
+	return &govendorImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// govendorFile is the structure of the vendor.json file.
+type govendorFile struct {
+	RootPath string             `json:"rootPath"` // Import path of vendor folder
+	Ignore   string             `json:"ignore"`
+	Package  []*govendorPackage `json:"package"`
+}
+
+// govendorPackage represents each package in vendor.json.
+type govendorPackage struct {
+	// See the vendor spec for definitions.
+	Origin   string `json:"origin"`
+	Path     string `json:"path"`
+	Revision string `json:"revision"`
+	Version  string `json:"version"`
+}
+
+func (g *govendorImporter) Name() string {
+	return "govendor"
+}
+
+func (g *govendorImporter) HasDepMetadata(dir string) bool {
+	y := filepath.Join(dir, govendorDir, govendorName)
+	if _, err := os.Stat(y); err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (g *govendorImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the govendor configuration files.
+func (g *govendorImporter) load(projectDir string) error {
+	g.logger.Println("Detected govendor configuration file...")
+	v := filepath.Join(projectDir, govendorDir, govendorName)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", v)
+	}
+	vb, err := ioutil.ReadFile(v)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", v)
+	}
+	err = json.Unmarshal(vb, &g.file)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", v)
+	}
+
+	return nil
+}
+
+// convert the govendor configuration files into dep configuration files.
+func (g *govendorImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from vendor.json...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+
+	if len(g.file.Ignore) > 0 {
+		// Govendor has three use cases here
+		// 1. 'test' - special case for ignoring test files
+		// 2. build tags - any string without a slash (/) in it
+		// 3. path and path prefix - any string with a slash (/) in it.
+		// Dep doesn't support build tags right now, so only paths are
+		// converted into ignored packages.
+		for _, i := range strings.Fields(g.file.Ignore) {
+			if !strings.Contains(i, "/") {
+				g.logger.Printf("  Govendor was configured to ignore the %s build tag, but that isn't supported by dep yet, and will be ignored. See https://github.com/golang/dep/issues/291.\n", i)
+				continue
+			}
+
+			manifest.Ignored = append(manifest.Ignored, g.ignoredPackage(pr, i))
+		}
+	}
+
+	lock := &dep.Lock{}
+	for _, pkg := range g.file.Package {
+		// Path must not be empty
+		if pkg.Path == "" {
+			err := errors.New("Invalid govendor configuration, Path is required")
+			return nil, nil, err
+		}
+
+		// Packages beneath the project's own import path are part of the
+		// project itself, not dependencies, so they're ignored rather than
+		// locked.
+		if isPathPrefix(pkg.Path, string(pr)) {
+			if !contains(manifest.Ignored, pkg.Path) {
+				if g.verbose {
+					g.logger.Printf("  Ignoring %s, it is a package of the project itself", pkg.Path)
+				}
+				manifest.Ignored = append(manifest.Ignored, pkg.Path)
+			}
+			continue
+		}
+
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := g.sm.DeduceProjectRoot(pkg.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkg.Path = string(ip)
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, pkg.Path) {
+			continue
+		}
+
+		// Revision must not be empty
+		if pkg.Revision == "" {
+			err := errors.New("Invalid govendor configuration, Revision is required")
+			return nil, nil, err
+		}
+
+		if pkg.Version == "" {
+			// When no version is specified, try to get the corresponding version
+			pi := gps.ProjectIdentifier{
+				ProjectRoot: ip,
+				Source:      pkg.Origin,
+			}
+			revision := gps.Revision(pkg.Revision)
+			version, err := lookupVersionForLockedProject(pi, nil, revision, g.sm)
+			if err != nil {
+				// Only warn about the problem, it is not enough to warrant failing
+				g.logger.Println(err.Error())
+			} else {
+				pp := getProjectPropertiesFromVersion(version)
+				if pp.Constraint != nil {
+					pkg.Version = pp.Constraint.String()
+				}
+			}
+		}
+
+		if pkg.Version != "" {
+			// If there's a version, use it to create project constraint
+			pc, err := g.buildProjectConstraint(*pkg)
+			if err != nil {
+				return nil, nil, err
+			}
+			manifest.Constraints[pc.Ident.ProjectRoot] = gps.ProjectProperties{Source: pc.Ident.Source, Constraint: pc.Constraint}
+		}
+
+		lp := g.buildLockedProject(*pkg, manifest)
+		lock.P = append(lock.P, lp)
+	}
+
+	return manifest, lock, nil
+}
+
+// ignoredPackage converts a path from govendor's ignore field into an import
+// path suitable for the manifest's ignored list. Paths which don't already
+// name the project or an external package are relative to the project root.
+func (g *govendorImporter) ignoredPackage(pr gps.ProjectRoot, i string) string {
+	i = strings.TrimRight(i, "/")
+	if isPathPrefix(i, string(pr)) {
+		return i
+	}
+	if _, err := g.sm.DeduceProjectRoot(i); err == nil {
+		return i
+	}
+
+	return path.Join(string(pr), i)
+}
+
+// buildProjectConstraint uses the provided package Path, Origin and Version
+// to create a project constraint
+func (g *govendorImporter) buildProjectConstraint(pkg govendorPackage) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pkg.Path), Source: pkg.Origin}
+	pc.Constraint, err = g.sm.InferConstraint(pkg.Version, pc.Ident)
+	if err != nil {
+		return
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return
+}
+
+// buildLockedProject uses the package Revision and Version to create lock project
+func (g *govendorImporter) buildLockedProject(pkg govendorPackage, manifest *dep.Manifest) gps.LockedProject {
+	pi := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pkg.Path), Source: pkg.Origin}
+	revision := gps.Revision(pkg.Revision)
+	pp := manifest.Constraints[pi.ProjectRoot]
+
+	version, err := lookupVersionForLockedProject(pi, pp.Constraint, revision, g.sm)
+	if err != nil {
+		// Only warn about the problem, it is not enough to warrant failing
+		g.logger.Println(err.Error())
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return lp
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+const testGovendorProjectRoot = "github.com/golang/notexist"
+
+func TestGovendorConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		file                govendorFile
+		wantConvertErr      bool
+		matchPairedVersion  bool
+		projectRoot         gps.ProjectRoot
+		wantSourceRepo      string
+		wantConstraint      string
+		wantRevision        gps.Revision
+		wantVersion         string
+		wantLockCount       int
+		wantIgnoredPackages []string
+	}{
+		"project": {
+			file: govendorFile{
+				Package: []*govendorPackage{
+					{
+						Path: "github.com/sdboyer/deptest",
+						// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Version:  "v0.8.0",
+					},
+				},
+			},
+			projectRoot:        "github.com/sdboyer/deptest",
+			matchPairedVersion: true,
+			wantConstraint:     "^0.8.0",
+			wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			wantVersion:        "v0.8.0",
+			wantLockCount:      1,
+		},
+		"with origin": {
+			file: govendorFile{
+				Package: []*govendorPackage{
+					{
+						Path:     "github.com/sdboyer/deptest",
+						Origin:   "https://github.com/sdboyer/deptest.git",
+						Revision: "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+						Version:  "v0.8.1",
+					},
+				},
+			},
+			projectRoot:        "github.com/sdboyer/deptest",
+			wantSourceRepo:     "https://github.com/sdboyer/deptest.git",
+			matchPairedVersion: true,
+			wantConstraint:     "^0.8.1",
+			wantRevision:       gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+			wantVersion:        "v0.8.1",
+			wantLockCount:      1,
+		},
+		"empty version": {
+			file: govendorFile{
+				Package: []*govendorPackage{
+					{
+						Path: "github.com/sdboyer/deptest",
+						// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			projectRoot:        "github.com/sdboyer/deptest",
+			matchPairedVersion: true,
+			wantConstraint:     "^1.0.0",
+			wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			wantVersion:        "v1.0.0",
+			wantLockCount:      1,
+		},
+		"sub-packages": {
+			file: govendorFile{
+				Package: []*govendorPackage{
+					{
+						Path:     "github.com/sdboyer/deptest",
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+					{
+						Path:     "github.com/sdboyer/deptest/foo",
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			projectRoot:    "github.com/sdboyer/deptest",
+			wantLockCount:  1,
+			wantConstraint: "^1.0.0",
+			wantVersion:    "v1.0.0",
+		},
+		"ignored packages": {
+			file: govendorFile{
+				Ignore: "test github.com/sdboyer/deptest samples/",
+			},
+			wantIgnoredPackages: []string{
+				"github.com/sdboyer/deptest",
+				"github.com/golang/notexist/samples",
+			},
+		},
+		"ignores packages of the project itself": {
+			file: govendorFile{
+				Package: []*govendorPackage{
+					{
+						Path:     "github.com/golang/notexist/samples",
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			wantLockCount:       0,
+			wantIgnoredPackages: []string{"github.com/golang/notexist/samples"},
+		},
+		"ignores packages of the project itself once": {
+			file: govendorFile{
+				Ignore: "samples/",
+				Package: []*govendorPackage{
+					{
+						Path:     "github.com/golang/notexist/samples",
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+			wantLockCount:       0,
+			wantIgnoredPackages: []string{"github.com/golang/notexist/samples"},
+		},
+		"bad input - empty package path": {
+			file: govendorFile{
+				Package: []*govendorPackage{{Path: ""}},
+			},
+			wantConvertErr: true,
+		},
+		"bad input - empty revision": {
+			file: govendorFile{
+				Package: []*govendorPackage{
+					{
+						Path: "github.com/sdboyer/deptest",
+					},
+				},
+			},
+			wantConvertErr: true,
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGovendorImporter(discardLogger, true, sm)
+			g.file = testCase.file
+
+			manifest, lock, err := g.convert(testGovendorProjectRoot)
+			if err != nil {
+				if testCase.wantConvertErr {
+					return
+				}
+
+				t.Fatal(err)
+			}
+			if testCase.wantConvertErr {
+				t.Fatal("Expected the conversion to fail, but it did not")
+			}
+
+			if !equalSlice(manifest.Ignored, testCase.wantIgnoredPackages) {
+				t.Fatalf("Expected manifest to have ignore %s, got %s",
+					strings.Join(testCase.wantIgnoredPackages, ", "),
+					strings.Join(manifest.Ignored, ", "))
+			}
+
+			if len(lock.P) != testCase.wantLockCount {
+				t.Fatalf("Expected lock to have %d project(s), got %d",
+					testCase.wantLockCount,
+					len(lock.P))
+			}
+
+			// Constraints checks below. Skip if there is no want constraint.
+			if testCase.wantConstraint == "" {
+				return
+			}
+
+			d, ok := manifest.Constraints[testCase.projectRoot]
+			if !ok {
+				t.Fatalf("Expected the manifest to have a dependency for '%s' but got none",
+					testCase.projectRoot)
+			}
+
+			v := d.Constraint.String()
+			if v != testCase.wantConstraint {
+				t.Fatalf("Expected manifest constraint to be %s, got %s", testCase.wantConstraint, v)
+			}
+
+			p := lock.P[0]
+			if p.Ident().ProjectRoot != testCase.projectRoot {
+				t.Fatalf("Expected the lock to have a project for '%s' but got '%s'",
+					testCase.projectRoot,
+					p.Ident().ProjectRoot)
+			}
+
+			if p.Ident().Source != testCase.wantSourceRepo {
+				t.Fatalf("Expected locked source to be %s, got '%s'", testCase.wantSourceRepo, p.Ident().Source)
+			}
+
+			lv := p.Version()
+			lpv, ok := lv.(gps.PairedVersion)
+			if !ok {
+				if testCase.matchPairedVersion {
+					t.Fatalf("Expected locked version to be PairedVersion but got %T", lv)
+				}
+
+				return
+			}
+
+			ver := lpv.String()
+			if ver != testCase.wantVersion {
+				t.Fatalf("Expected locked version to be '%s', got %s", testCase.wantVersion, ver)
+			}
+
+			if testCase.wantRevision != "" {
+				rev := lpv.Revision()
+				if rev != testCase.wantRevision {
+					t.Fatalf("Expected locked revision to be '%s', got %s",
+						testCase.wantRevision,
+						rev)
+				}
+			}
+		})
+	}
+}
+
+func TestGovendorConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testGovendorProjectRoot))
+	h.TempCopy(filepath.Join(testGovendorProjectRoot, govendorDir, govendorName), "govendor/vendor.json")
+
+	projectRoot := h.Path(testGovendorProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGovendorImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect the govendor configuration file")
+	}
+
+	m, l, err := g.Import(projectRoot, testGovendorProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "govendor/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGovendorConfig_JsonLoad(t *testing.T) {
+	// This is same as cmd/dep/testdata/govendor/vendor.json
+	wantFile := govendorFile{
+		RootPath: "github.com/golang/notexist",
+		Ignore:   "test github.com/sdboyer/dep-test",
+		Package: []*govendorPackage{
+			{
+				Path:     "github.com/sdboyer/deptest",
+				Revision: "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			},
+			{
+				Path:     "github.com/sdboyer/deptestdos",
+				Revision: "5c607206be5decd28e6263ffffdcee067266015e",
+				Version:  "v2.0.0",
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testGovendorProjectRoot, govendorDir, govendorName), "govendor/vendor.json")
+
+	projectRoot := h.Path(testGovendorProjectRoot)
+
+	g := newGovendorImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if g.file.RootPath != wantFile.RootPath || g.file.Ignore != wantFile.Ignore {
+		t.Fatalf("Expected vendor file to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", g.file, wantFile)
+	}
+
+	if len(g.file.Package) != len(wantFile.Package) {
+		t.Fatalf("Expected %d packages, got %d", len(wantFile.Package), len(g.file.Package))
+	}
+	for i := range wantFile.Package {
+		if *g.file.Package[i] != *wantFile.Package[i] {
+			t.Fatalf("Expected package %d to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", i, *g.file.Package[i], *wantFile.Package[i])
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+// gpmFile is the plain text file gpm reads dependencies from. Not to be
+// confused with godep, which writes Godeps/Godeps.json; the two can't coexist
+// as one of them must be a directory.
+const gpmFile = "Godeps"
+
+// gpmImporter imports gpm configuration into the dep configuration format.
+type gpmImporter struct {
+	packages []gpmPackage
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGpmImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gpmImporter {
+	return &gpmImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gpmPackage is a single line of a gpm Godeps file. The version is either a
+// tag or a revision, and may be omitted to track the latest revision.
+type gpmPackage struct {
+	importPath string
+	version    string
+}
+
+func (g *gpmImporter) Name() string {
+	return "gpm"
+}
+
+func (g *gpmImporter) HasDepMetadata(dir string) bool {
+	// Godeps is a directory when it belongs to godep, so only a regular file
+	// is a gpm configuration.
+	isFile, err := fs.IsRegular(filepath.Join(dir, gpmFile))
+	return err == nil && isFile
+}
+
+func (g *gpmImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the gpm Godeps file.
+func (g *gpmImporter) load(projectDir string) error {
+	g.logger.Println("Detected gpm configuration files...")
+	path := filepath.Join(projectDir, gpmFile)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			g.packages = append(g.packages, gpmPackage{importPath: fields[0]})
+		case 2:
+			g.packages = append(g.packages, gpmPackage{importPath: fields[0], version: fields[1]})
+		default:
+			return errors.Errorf("Unable to parse %s, line %d: invalid config format: %q", path, n, scanner.Text())
+		}
+	}
+
+	return errors.Wrapf(scanner.Err(), "Unable to read %s", path)
+}
+
+// convert the gpm packages into dep configuration files.
+func (g *gpmImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from Godeps ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, pkg := range g.packages {
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := g.sm.DeduceProjectRoot(pkg.importPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, string(ip)) {
+			continue
+		}
+
+		// Without a version, gpm fetches the latest revision, so leave the
+		// project to the solver.
+		if pkg.version == "" {
+			continue
+		}
+
+		pi := gps.ProjectIdentifier{ProjectRoot: ip}
+
+		pc, err := g.buildProjectConstraint(pi, pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pc.Constraint != nil {
+			manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Constraint: pc.Constraint}
+		}
+
+		if lp, ok := g.buildLockedProject(pi, pkg, manifest); ok {
+			lock.P = append(lock.P, lp)
+		}
+	}
+
+	return manifest, lock, nil
+}
+
+// isGpmRevision reports whether a gpm version is a git revision, rather than
+// a tag.
+func isGpmRevision(version string) bool {
+	if len(version) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(version)
+	return err == nil
+}
+
+// buildProjectConstraint creates a project constraint from the package's tag.
+// A package pinned to a revision is constrained by the version matching that
+// revision instead, if there is one.
+func (g *gpmImporter) buildProjectConstraint(pi gps.ProjectIdentifier, pkg gpmPackage) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+
+	if isGpmRevision(pkg.version) {
+		version, err := lookupVersionForLockedProject(pi, nil, gps.Revision(pkg.version), g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+			return pc, nil
+		}
+		pc.Constraint = getProjectPropertiesFromVersion(version).Constraint
+		if pc.Constraint == nil {
+			return pc, nil
+		}
+	} else {
+		pc.Constraint, err = g.sm.InferConstraint(pkg.version, pi)
+		if err != nil {
+			return
+		}
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return pc, nil
+}
+
+// buildLockedProject creates a lock project for the package's revision, or the
+// revision its tag points to. If the tag can't be found, false is returned.
+func (g *gpmImporter) buildLockedProject(pi gps.ProjectIdentifier, pkg gpmPackage, manifest *dep.Manifest) (gps.LockedProject, bool) {
+	var version gps.Version
+
+	if isGpmRevision(pkg.version) {
+		pp := manifest.Constraints[pi.ProjectRoot]
+		v, err := lookupVersionForLockedProject(pi, pp.Constraint, gps.Revision(pkg.version), g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+		}
+		version = v
+	} else {
+		versions, err := g.sm.ListVersions(pi)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(errors.Wrapf(err, "Unable to lookup the revision of %s in %s. Skipping the lock for this project.", pkg.version, pi.ProjectRoot).Error())
+			return gps.LockedProject{}, false
+		}
+		for _, pv := range versions {
+			if pv.String() == pkg.version {
+				version = pv
+				break
+			}
+		}
+		if version == nil {
+			return gps.LockedProject{}, false
+		}
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return lp, true
+}
@@ -0,0 +1,224 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestGpmConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		packages []gpmPackage
+	}{
+		"revision": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]gpmPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+					version: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+		"tag": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^0.8.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v0.8.0",
+				wantLockCount:      1,
+			},
+			[]gpmPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					version:    "v0.8.0",
+				},
+			},
+		},
+		"no version": {
+			importConverterTestCase{
+				wantLockCount: 0,
+			},
+			[]gpmPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+				},
+			},
+		},
+		"sub-packages": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "^1.0.0",
+				wantLockCount:  1,
+			},
+			[]gpmPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					version:    "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+				{
+					importPath: "github.com/sdboyer/deptest/foo",
+					version:    "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGpmImporter(discardLogger, true, sm)
+			g.packages = testCase.packages
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGpmConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, gpmFile), "gpm/Godeps")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGpmImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect gpm configuration file")
+	}
+
+	m, l, err := g.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "gpm/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGpmConfig_Load(t *testing.T) {
+	// This is same as cmd/dep/testdata/gpm/Godeps
+	wantPackages := []gpmPackage{
+		{
+			importPath: "github.com/sdboyer/deptest",
+			version:    "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+		},
+		{
+			importPath: "github.com/sdboyer/deptest/foo",
+			version:    "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+		},
+		{
+			importPath: "github.com/sdboyer/deptestdos",
+			version:    "v2.0.0",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, gpmFile), "gpm/Godeps")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	g := newGpmImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if len(g.packages) != len(wantPackages) {
+		t.Fatalf("Expected %d packages, got %d", len(wantPackages), len(g.packages))
+	}
+	for i := range wantPackages {
+		if g.packages[i] != wantPackages[i] {
+			t.Fatalf("Expected package %d to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", i, g.packages[i], wantPackages[i])
+		}
+	}
+}
+
+func TestGpmConfig_DistinguishedFromGodep(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	a := newRootAnalyzer(false, ctx, nil, nil)
+
+	// gpm's Godeps file and godep's Godeps directory can't both exist, but
+	// each importer must only claim its own, godep's taking precedence.
+	h.TempCopy(filepath.Join("gpm", gpmFile), "gpm/Godeps")
+	h.TempCopy(filepath.Join("godep", godepPath), "godep/Godeps.json")
+
+	testCases := map[string]string{
+		"gpm":   "gpm",
+		"godep": "godep",
+	}
+
+	for dir, want := range testCases {
+		t.Run(dir, func(t *testing.T) {
+			var detected []string
+			for _, i := range a.importers(discardLogger) {
+				if i.HasDepMetadata(h.Path(dir)) {
+					detected = append(detected, i.Name())
+				}
+			}
+
+			if len(detected) != 1 || detected[0] != want {
+				t.Fatalf("Expected only the %s importer to detect its configuration, got %v", want, detected)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+const graphShortHelp = `Print the graph of the project's dependencies`
+const graphLongHelp = `
+Graph prints the graph of the dependencies of the project, at the versions
+they're locked to in Gopkg.lock. By default, each project is a node, with an
+edge to each project it imports packages from; pass -packages for the graph of
+the imports between packages instead. Only the packages which the project
+reaches through its imports, or requires in Gopkg.toml, are in the graph.
+
+The graph is printed in the GraphViz DOT format, e.g. for rendering with
+"dot -Tpng", or with -format=json as an adjacency list: an object with a key
+for each node, whose value is the sorted list of the nodes it has edges to.
+
+Pass -focus with the root of a project, or the import path of a package, to
+only print the paths from the root project to it. -reverse turns the edges of
+that graph around, to show what depends on it, starting from it.
+`
+
+type graphCommand struct {
+	packages bool
+	format   string
+	focus    string
+	reverse  bool
+}
+
+func (cmd *graphCommand) Name() string      { return "graph" }
+func (cmd *graphCommand) Args() string      { return "" }
+func (cmd *graphCommand) ShortHelp() string { return graphShortHelp }
+func (cmd *graphCommand) LongHelp() string  { return graphLongHelp }
+func (cmd *graphCommand) Hidden() bool      { return false }
+
+func (cmd *graphCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.packages, "packages", false, "graph the imports between packages rather than projects")
+	fs.StringVar(&cmd.format, "format", "dot", "output format: dot or json")
+	fs.StringVar(&cmd.focus, "focus", "", "only graph the paths from the root project to this project or package")
+	fs.BoolVar(&cmd.reverse, "reverse", false, "graph what depends on the -focus project or package")
+}
+
+func (cmd *graphCommand) validateFlags() error {
+	if cmd.format != "dot" && cmd.format != "json" {
+		return errors.Errorf("unknown format %q, must be dot or json", cmd.format)
+	}
+	if cmd.reverse && cmd.focus == "" {
+		return errors.New("-reverse can only be used with -focus")
+	}
+	return nil
+}
+
+func (cmd *graphCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.New("graph takes no arguments")
+	}
+	if err := cmd.validateFlags(); err != nil {
+		return err
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found. Run `dep ensure` to generate lock file", dep.LockName)
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
+	defer sm.Release()
+
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+
+	g := packageGraph(p, ptree, newImportGraph(sm, p, ptree).imports)
+	if !cmd.packages {
+		g = g.projects(p)
+	}
+
+	if cmd.focus != "" {
+		g, err = g.focus(cmd.focus)
+		if err != nil {
+			return err
+		}
+		if cmd.reverse {
+			g = g.reversed()
+		}
+	}
+
+	var buf bytes.Buffer
+	if cmd.format == "json" {
+		err = g.writeJSON(&buf)
+	} else {
+		g.writeDOT(&buf)
+	}
+	if err != nil {
+		return err
+	}
+	ctx.Out.Print(buf.String())
+	return nil
+}
+
+// depGraph is a directed graph of projects or packages, by name, with an edge
+// from each to those it imports. It may have cycles.
+type depGraph struct {
+	packages bool                       // Whether the nodes are packages, not projects
+	edges    map[string]map[string]bool // The nodes, with the edges from each
+	labels   map[string]string          // What's printed below a node's name, if anything
+}
+
+func newDepGraph(packages bool) *depGraph {
+	return &depGraph{
+		packages: packages,
+		edges:    make(map[string]map[string]bool),
+		labels:   make(map[string]string),
+	}
+}
+
+func (g *depGraph) addNode(n string) {
+	if _, has := g.edges[n]; !has {
+		g.edges[n] = make(map[string]bool)
+	}
+}
+
+func (g *depGraph) addEdge(from, to string) {
+	g.addNode(from)
+	g.addNode(to)
+	g.edges[from][to] = true
+}
+
+// nodes returns the nodes of the graph, sorted.
+func (g *depGraph) nodes() []string {
+	nodes := make([]string, 0, len(g.edges))
+	for n := range g.edges {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// targets returns the nodes of n, sorted, which n has edges to.
+func (g *depGraph) targets(n string) []string {
+	targets := make([]string, 0, len(g.edges[n]))
+	for t := range g.edges[n] {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// packageGraph follows the imports of the packages of the root project, and
+// those it requires, through the projects in its lock. imports returns the
+// imports of a package, or nil if they can't be determined. Standard library
+// and ignored packages are left out, as are those in no locked project.
+func packageGraph(p *dep.Project, ptree pkgtree.PackageTree, imports func(string) []string) *depGraph {
+	g := newDepGraph(true)
+	ignored := p.Manifest.IgnoredPackages()
+
+	var queue []string
+	for ip := range ptree.Packages {
+		if !pkgtree.IsIgnored(ip, ignored) {
+			queue = append(queue, ip)
+		}
+	}
+	for ip := range p.Manifest.RequiredPackages() {
+		queue = append(queue, ip)
+	}
+	sort.Strings(queue)
+
+	// Each package is only followed once, so that cycles are walked around
+	// once rather than forever.
+	seen := make(map[string]bool)
+	for _, ip := range queue {
+		seen[ip] = true
+		g.addNode(ip)
+	}
+	for len(queue) > 0 {
+		ip := queue[0]
+		queue = queue[1:]
+		for _, imp := range imports(ip) {
+			if paths.IsStandardImportPath(imp) || pkgtree.IsIgnored(imp, ignored) || projectOf(p, imp) == "" {
+				continue
+			}
+			g.addEdge(ip, imp)
+			if !seen[imp] {
+				seen[imp] = true
+				queue = append(queue, imp)
+			}
+		}
+	}
+
+	// Required packages which are in no locked project aren't really there.
+	for n := range g.edges {
+		if projectOf(p, n) == "" {
+			delete(g.edges, n)
+		}
+	}
+	return g
+}
+
+// projectOf returns the root of the project the package ip is in: either the
+// root project, or one of the projects in its lock. It's empty if ip is in
+// none of them.
+func projectOf(p *dep.Project, ip string) string {
+	if isPathPrefix(ip, string(p.ImportRoot)) {
+		return string(p.ImportRoot)
+	}
+
+	var root string
+	for _, lp := range p.Lock.Projects() {
+		pr := string(lp.Ident().ProjectRoot)
+		if len(pr) > len(root) && isPathPrefix(ip, pr) {
+			root = pr
+		}
+	}
+	return root
+}
+
+// projects collapses the package graph g into the graph of the projects the
+// packages are in, with an edge from a project to another when one of its
+// packages imports one of the other's. The locked projects are labeled with
+// their versions.
+func (g *depGraph) projects(p *dep.Project) *depGraph {
+	pg := newDepGraph(false)
+	for from, tos := range g.edges {
+		fp := projectOf(p, from)
+		pg.addNode(fp)
+		for to := range tos {
+			if tp := projectOf(p, to); tp != fp {
+				pg.addEdge(fp, tp)
+			}
+		}
+	}
+
+	for _, lp := range p.Lock.Projects() {
+		pr := string(lp.Ident().ProjectRoot)
+		if _, has := pg.edges[pr]; has {
+			pg.labels[pr] = formatVersion(lp.Version())
+		}
+	}
+	return pg
+}
+
+// focus returns the subgraph of g on the paths to focus: the project or
+// package focus names, and those which reach it through their edges. At the
+// package level, focus may be a project, for all of its packages; at the
+// project level, it may be a package, for the project it's in.
+func (g *depGraph) focus(focus string) (*depGraph, error) {
+	var queue []string
+	for n := range g.edges {
+		if isPathPrefix(n, focus) || (!g.packages && isPathPrefix(focus, n)) {
+			queue = append(queue, n)
+		}
+	}
+	if len(queue) == 0 {
+		return nil, errors.Errorf("%s is not in the graph of the project's dependencies", focus)
+	}
+
+	// Walk the edges backwards from focus, only once to each node, so that
+	// cycles end.
+	from := make(map[string][]string)
+	for f, tos := range g.edges {
+		for t := range tos {
+			from[t] = append(from[t], f)
+		}
+	}
+	keep := make(map[string]bool)
+	for _, n := range queue {
+		keep[n] = true
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, f := range from[n] {
+			if !keep[f] {
+				keep[f] = true
+				queue = append(queue, f)
+			}
+		}
+	}
+
+	fg := newDepGraph(g.packages)
+	for n := range keep {
+		fg.addNode(n)
+		for t := range g.edges[n] {
+			if keep[t] {
+				fg.addEdge(n, t)
+			}
+		}
+		if l, has := g.labels[n]; has {
+			fg.labels[n] = l
+		}
+	}
+	return fg, nil
+}
+
+// reversed returns g with all of its edges turned around.
+func (g *depGraph) reversed() *depGraph {
+	rg := newDepGraph(g.packages)
+	for from, tos := range g.edges {
+		rg.addNode(from)
+		for to := range tos {
+			rg.addEdge(to, from)
+		}
+	}
+	for n, l := range g.labels {
+		rg.labels[n] = l
+	}
+	return rg
+}
+
+// writeDOT writes g to w in the GraphViz DOT format, with the nodes and edges
+// in order.
+func (g *depGraph) writeDOT(w io.Writer) {
+	fmt.Fprint(w, "digraph {\n\tnode [shape=box];\n")
+	for _, n := range g.nodes() {
+		label := n
+		if l := g.labels[n]; l != "" {
+			label += "\n" + l
+		}
+		fmt.Fprintf(w, "\t%q [label=%q];\n", n, label)
+	}
+	for _, n := range g.nodes() {
+		for _, t := range g.targets(n) {
+			fmt.Fprintf(w, "\t%q -> %q;\n", n, t)
+		}
+	}
+	fmt.Fprint(w, "}\n")
+}
+
+// writeJSON writes g to w as a JSON adjacency list: an object with a key for
+// each node, whose value is the sorted list of the nodes it has edges to.
+func (g *depGraph) writeJSON(w io.Writer) error {
+	adj := make(map[string][]string, len(g.edges))
+	for n := range g.edges {
+		adj[n] = g.targets(n)
+	}
+
+	b, err := json.MarshalIndent(adj, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the graph")
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
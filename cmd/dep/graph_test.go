@@ -0,0 +1,139 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+// mkGraphProject returns a project importing github.com/foo/bar, whose
+// packages import each other in a cycle, and github.com/foo/baz, which
+// imports bar again, along with the imports of all of their packages.
+func mkGraphProject() (*dep.Project, pkgtree.PackageTree, func(string) []string) {
+	p := &dep.Project{
+		ImportRoot: "example.com/root",
+		Manifest: &dep.Manifest{
+			Ignored:  []string{"example.com/root/ignored"},
+			Required: []string{"github.com/foo/qux"},
+		},
+		Lock: &dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.NewVersion("v1.0.0").Pair("bar1"), nil),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/baz"}, gps.NewBranch("master").Pair("baz1"), nil),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/qux"}, gps.Revision("0123456789abcdef"), nil),
+		}},
+	}
+
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "example.com/root",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"example.com/root":         {},
+			"example.com/root/cmd":     {},
+			"example.com/root/ignored": {},
+		},
+	}
+
+	imports := map[string][]string{
+		"example.com/root":            {"fmt", "github.com/foo/bar"},
+		"example.com/root/cmd":        {"example.com/root", "github.com/foo/baz/sub"},
+		"example.com/root/ignored":    {"github.com/unlocked/pkg"},
+		"github.com/foo/bar":          {"github.com/foo/bar/internal"},
+		"github.com/foo/bar/internal": {"github.com/foo/bar", "os"},
+		"github.com/foo/baz/sub":      {"github.com/foo/bar", "github.com/unlocked/pkg"},
+	}
+	return p, ptree, func(ip string) []string { return imports[ip] }
+}
+
+func TestDepGraph(t *testing.T) {
+	cases := []struct {
+		name     string
+		packages bool
+		focus    string
+		reverse  bool
+		json     bool
+		golden   string
+	}{
+		{name: "projects", golden: "graph/projects.dot"},
+		{name: "packages", packages: true, golden: "graph/packages.dot"},
+		{name: "json", json: true, golden: "graph/projects.json"},
+		{name: "focus", focus: "github.com/foo/bar", golden: "graph/focus.dot"},
+		{name: "focus package", packages: true, focus: "github.com/foo/bar/internal", golden: "graph/focus_package.dot"},
+		{name: "reverse", focus: "github.com/foo/bar/internal", reverse: true, json: true, golden: "graph/reverse.json"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			p, ptree, imports := mkGraphProject()
+			g := packageGraph(p, ptree, imports)
+			if !c.packages {
+				g = g.projects(p)
+			}
+			if c.focus != "" {
+				var err error
+				if g, err = g.focus(c.focus); err != nil {
+					t.Fatalf("Unexpected error focusing on %s: %s", c.focus, err)
+				}
+				if c.reverse {
+					g = g.reversed()
+				}
+			}
+
+			var buf bytes.Buffer
+			if c.json {
+				if err := g.writeJSON(&buf); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				g.writeDOT(&buf)
+			}
+
+			got := buf.String()
+			want := h.GetTestFileString(c.golden)
+			if want != got {
+				if *test.UpdateGolden {
+					if err := h.WriteTestFile(c.golden, got); err != nil {
+						t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", c.golden))
+					}
+				} else {
+					t.Fatalf("want %s, got %s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDepGraphFocusMissing(t *testing.T) {
+	p, ptree, imports := mkGraphProject()
+	if _, err := packageGraph(p, ptree, imports).focus("github.com/unlocked/pkg"); err == nil {
+		t.Error("Expected an error focusing on a package which isn't in the graph")
+	}
+}
+
+func TestGraphValidateFlags(t *testing.T) {
+	cases := []struct {
+		cmd     graphCommand
+		wantErr bool
+	}{
+		{cmd: graphCommand{format: "dot"}},
+		{cmd: graphCommand{format: "json", focus: "github.com/foo/bar", reverse: true}},
+		{cmd: graphCommand{format: "svg"}, wantErr: true},
+		{cmd: graphCommand{format: "dot", reverse: true}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		if err := c.cmd.validateFlags(); (err != nil) != c.wantErr {
+			t.Errorf("validateFlags() for %+v: unexpected error %v", c.cmd, err)
+		}
+	}
+}
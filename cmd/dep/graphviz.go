@@ -21,6 +21,7 @@ type gvnode struct {
 	project  string
 	version  string
 	children []string
+	direct   bool // Whether the project is imported by the root project
 }
 
 func (g graphviz) New() *graphviz {
@@ -36,18 +37,19 @@ func (g graphviz) output() bytes.Buffer {
 
 	for _, gvp := range g.ps {
 		// Create node string
-		g.b.WriteString(fmt.Sprintf("\n\t%d [label=\"%s\"];", gvp.hash(), gvp.label()))
+		g.b.WriteString(fmt.Sprintf("\n\t%d [label=\"%s\"%s];", gvp.hash(), gvp.label(), gvp.style()))
 	}
 
 	// Store relations to avoid duplication
 	rels := make(map[string]bool)
 
-	// Create relations
+	// Create relations. Walk the nodes, rather than the hashes, so that the
+	// relations are written in the same order on every run.
 	for _, dp := range g.ps {
 		for _, bsc := range dp.children {
-			for pr, hsh := range g.h {
-				if isPathPrefix(bsc, pr) {
-					r := fmt.Sprintf("\n\t%d -> %d", g.h[dp.project], hsh)
+			for _, to := range g.ps {
+				if to.project != dp.project && isPathPrefix(bsc, to.project) {
+					r := fmt.Sprintf("\n\t%d -> %d", g.h[dp.project], g.h[to.project])
 
 					if _, ex := rels[r]; !ex {
 						g.b.WriteString(r + ";")
@@ -74,6 +76,13 @@ func (g *graphviz) createNode(project, version string, children []string) {
 	g.ps = append(g.ps, pr)
 }
 
+// createDirectNode creates the node of a project which is a direct dependency
+// of the root project, so that it stands out from the transitive ones.
+func (g *graphviz) createDirectNode(project, version string, children []string) {
+	g.createNode(project, version, children)
+	g.ps[len(g.ps)-1].direct = true
+}
+
 func (dp gvnode) hash() uint32 {
 	h := fnv.New32a()
 	h.Write([]byte(dp.project))
@@ -90,6 +99,13 @@ func (dp gvnode) label() string {
 	return strings.Join(label, "\\n")
 }
 
+func (dp gvnode) style() string {
+	if dp.direct {
+		return ", style=bold"
+	}
+	return ""
+}
+
 // isPathPrefix ensures that the literal string prefix is a path tree match and
 // guards against possibilities like this:
 //
@@ -81,3 +81,21 @@ func TestIsPathPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestDirectDependencies(t *testing.T) {
+	h := test.NewHelper(t)
+	h.Parallel()
+	defer h.Cleanup()
+
+	g := new(graphviz).New()
+
+	g.createNode("project", "", []string{"foo/sub"})
+	g.createDirectNode("foo", "master", []string{"bar", "foo/other"})
+	g.createNode("bar", "dev", []string{})
+
+	b := g.output()
+	want := h.GetTestFileString("graphviz/case3.dot")
+	if b.String() != want {
+		t.Fatalf("expected '%v', got '%v'", want, b.String())
+	}
+}
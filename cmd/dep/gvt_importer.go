@@ -0,0 +1,208 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const gvtPath = "vendor" + string(os.PathSeparator) + "manifest"
+
+// gvtImporter imports gvt configuration into the dep configuration format.
+type gvtImporter struct {
+	manifest gvtManifest
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGvtImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gvtImporter {
+	return &gvtImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gvtManifest is the structure of the vendor/manifest file written by gvt.
+type gvtManifest struct {
+	Deps []gvtPkg `json:"dependencies"`
+}
+
+type gvtPkg struct {
+	ImportPath string `json:"importpath"`
+	Repository string `json:"repository"`
+	Revision   string `json:"revision"`
+	Branch     string `json:"branch"`
+	Path       string `json:"path"`
+}
+
+func (g *gvtImporter) Name() string {
+	return "gvt"
+}
+
+func (g *gvtImporter) HasDepMetadata(dir string) bool {
+	y := filepath.Join(dir, gvtPath)
+	if exists, _ := fs.IsRegular(y); !exists {
+		return false
+	}
+
+	// gb writes a manifest to the same location; only claim the file when it
+	// lacks gb's top-level version.
+	versioned, err := isVersionedVendorManifest(y)
+	return err == nil && !versioned
+}
+
+func (g *gvtImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the gvt manifest file.
+func (g *gvtImporter) load(projectDir string) error {
+	g.logger.Println("Detected gvt configuration files...")
+	j := filepath.Join(projectDir, gvtPath)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", j)
+	}
+	jb, err := ioutil.ReadFile(j)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", j)
+	}
+	err = json.Unmarshal(jb, &g.manifest)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", j)
+	}
+
+	return nil
+}
+
+// convert the gvt manifest into dep configuration files.
+func (g *gvtImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	g.logger.Println("Converting from vendor/manifest ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, pkg := range g.manifest.Deps {
+		// ImportPath must not be empty
+		if pkg.ImportPath == "" {
+			err := errors.New("Invalid gvt configuration, ImportPath is required")
+			return nil, nil, err
+		}
+
+		// Revision must not be empty
+		if pkg.Revision == "" {
+			err := errors.New("Invalid gvt configuration, Revision is required")
+			return nil, nil, err
+		}
+
+		ip, err := g.projectRoot(pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, string(ip)) {
+			continue
+		}
+
+		pi := gps.ProjectIdentifier{
+			ProjectRoot: ip,
+			Source:      alternateSource(ip, pkg.Repository),
+		}
+
+		pc, err := g.buildProjectConstraint(pi, pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pc.Constraint != nil {
+			manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Source: pi.Source, Constraint: pc.Constraint}
+		}
+
+		lp := g.buildLockedProject(pi, pkg, manifest)
+		lock.P = append(lock.P, lp)
+	}
+
+	return manifest, lock, nil
+}
+
+// projectRoot determines the project root of a vendored package. gvt records
+// sub-path vendoring as the package's import path together with the path of
+// the package within its repository, so strip the latter before deducing.
+func (g *gvtImporter) projectRoot(pkg gvtPkg) (gps.ProjectRoot, error) {
+	ip := pkg.ImportPath
+	if p := strings.Trim(pkg.Path, "/"); p != "" {
+		ip = strings.TrimSuffix(strings.TrimSuffix(ip, p), "/")
+	}
+
+	return g.sm.DeduceProjectRoot(ip)
+}
+
+// buildProjectConstraint uses the provided package's branch to create a
+// project constraint. Packages tracking HEAD or the default branch, which gvt
+// may record as master whatever it's called, are constrained by the version
+// matching their revision instead, if there is one.
+func (g *gvtImporter) buildProjectConstraint(pi gps.ProjectIdentifier, pkg gvtPkg) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+
+	switch {
+	case pkg.Branch == "" || pkg.Branch == "HEAD" || tracksDefaultBranch(pi, pkg.Branch, g.sm):
+		revision := gps.Revision(pkg.Revision)
+		version, err := lookupVersionForLockedProject(pi, nil, revision, g.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			g.logger.Println(err.Error())
+			return pc, nil
+		}
+		pc.Constraint = getProjectPropertiesFromVersion(version).Constraint
+		if pc.Constraint == nil {
+			return pc, nil
+		}
+	default:
+		pc.Constraint = gps.NewBranch(pkg.Branch)
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return pc, nil
+}
+
+// buildLockedProject uses the package's revision to create a lock project
+func (g *gvtImporter) buildLockedProject(pi gps.ProjectIdentifier, pkg gvtPkg, manifest *dep.Manifest) gps.LockedProject {
+	revision := gps.Revision(pkg.Revision)
+	pp := manifest.Constraints[pi.ProjectRoot]
+
+	version, err := lookupVersionForLockedProject(pi, pp.Constraint, revision, g.sm)
+	if err != nil {
+		// Only warn about the problem, it is not enough to warrant failing
+		g.logger.Println(err.Error())
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(g.logger)
+
+	return lp
+}
@@ -0,0 +1,263 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestGvtConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		manifest gvtManifest
+	}{
+		"package with master branch": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			gvtManifest{
+				Deps: []gvtPkg{
+					{
+						ImportPath: "github.com/sdboyer/deptest",
+						// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Branch:   "master",
+					},
+				},
+			},
+		},
+		"package with non-master branch": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "v1",
+				wantRevision:   gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantLockCount:  1,
+			},
+			gvtManifest{
+				Deps: []gvtPkg{
+					{
+						ImportPath: "github.com/sdboyer/deptest",
+						Revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Branch:     "v1",
+					},
+				},
+			},
+		},
+		"package with HEAD branch": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			gvtManifest{
+				Deps: []gvtPkg{
+					{
+						ImportPath: "github.com/sdboyer/deptest",
+						Revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Branch:     "HEAD",
+					},
+				},
+			},
+		},
+		"sub-path vendoring": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantSourceRepo: "https://github.com/carolynvs/deptest",
+				wantConstraint: "v1",
+				wantRevision:   gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantLockCount:  1,
+			},
+			gvtManifest{
+				Deps: []gvtPkg{
+					{
+						ImportPath: "github.com/sdboyer/deptest/foo",
+						Repository: "https://github.com/carolynvs/deptest",
+						Revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Branch:     "v1",
+						Path:       "/foo",
+					},
+					{
+						ImportPath: "github.com/sdboyer/deptest/bar",
+						Repository: "https://github.com/carolynvs/deptest",
+						Revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+						Branch:     "v1",
+						Path:       "/bar",
+					},
+				},
+			},
+		},
+		"missing importpath": {
+			importConverterTestCase{
+				wantConvertErr: true,
+			},
+			gvtManifest{
+				Deps: []gvtPkg{
+					{
+						Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					},
+				},
+			},
+		},
+		"missing revision": {
+			importConverterTestCase{
+				wantConvertErr: true,
+			},
+			gvtManifest{
+				Deps: []gvtPkg{
+					{
+						ImportPath: "github.com/sdboyer/deptest",
+					},
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := newGvtImporter(discardLogger, true, sm)
+			g.manifest = testCase.manifest
+
+			testCase.exec(t, g)
+		})
+	}
+}
+
+func TestGvtConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, gvtPath), "gvt/manifest")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	g := newGvtImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !g.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect gvt configuration file")
+	}
+
+	m, l, err := g.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "gvt/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestGvtConfig_JsonLoad(t *testing.T) {
+	// This is same as cmd/dep/testdata/gvt/manifest
+	wantDeps := []gvtPkg{
+		{
+			ImportPath: "github.com/sdboyer/deptest",
+			Repository: "https://github.com/sdboyer/deptest",
+			Revision:   "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			Branch:     "master",
+		},
+		{
+			ImportPath: "github.com/sdboyer/deptestdos/bar",
+			Repository: "https://github.com/sdboyer/deptestdos",
+			Revision:   "5c607206be5decd28e6263ffffdcee067266015e",
+			Branch:     "HEAD",
+			Path:       "/bar",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, gvtPath), "gvt/manifest")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	g := newGvtImporter(ctx.Err, true, nil)
+	err := g.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if len(g.manifest.Deps) != len(wantDeps) {
+		t.Fatalf("Expected %d dependencies, got %d", len(wantDeps), len(g.manifest.Deps))
+	}
+	for i := range wantDeps {
+		if g.manifest.Deps[i] != wantDeps[i] {
+			t.Fatalf("Expected dependency %d to be equal. \n\t(GOT): %+v\n\t(WNT): %+v", i, g.manifest.Deps[i], wantDeps[i])
+		}
+	}
+}
+
+func TestGvtConfig_DistinguishedFromGb(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	gvt := newGvtImporter(discardLogger, false, nil)
+	gb := newGbImporter(discardLogger, false, nil)
+
+	h.TempCopy(filepath.Join("gvt", gvtPath), "gvt/manifest")
+	h.TempCopy(filepath.Join("gb", gbManifestPath), "gb/manifest")
+
+	if !gvt.HasDepMetadata(h.Path("gvt")) {
+		t.Error("Expected the gvt importer to detect a gvt manifest")
+	}
+	if gb.HasDepMetadata(h.Path("gvt")) {
+		t.Error("Expected the gb importer to not detect a gvt manifest")
+	}
+	if gvt.HasDepMetadata(h.Path("gb")) {
+		t.Error("Expected the gvt importer to not detect a gb manifest")
+	}
+	if !gb.HasDepMetadata(h.Path("gb")) {
+		t.Error("Expected the gb importer to detect a gb manifest")
+	}
+}
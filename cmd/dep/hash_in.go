@@ -5,18 +5,32 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
-	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/pkg/errors"
 )
 
+const hashinShortHelp = `Print the inputs hashed to tell whether the lock is in sync`
+const hashinLongHelp = `
+Print the data dep hashes to tell whether Gopkg.lock is in sync with
+Gopkg.toml and the project's imports, followed by the resulting digest.
+
+The data is printed in the order it's hashed, one element per line: the
+constraints, the imported and required packages, the ignored packages, the
+overrides, the source mirrors and the analyzer. The digest is the sha256 of
+the elements, without the newlines that separate them here. It's worked out
+just as ensure, check and status work it out, so running hash-inputs on two
+machines which disagree on whether the lock is in sync, and diffing the
+output, shows what they see differently.
+`
+
 func (cmd *hashinCommand) Name() string      { return "hash-inputs" }
 func (cmd *hashinCommand) Args() string      { return "" }
-func (cmd *hashinCommand) ShortHelp() string { return "" }
-func (cmd *hashinCommand) LongHelp() string  { return "" }
+func (cmd *hashinCommand) ShortHelp() string { return hashinShortHelp }
+func (cmd *hashinCommand) LongHelp() string  { return hashinLongHelp }
 func (cmd *hashinCommand) Hidden() bool      { return true }
 
 func (cmd *hashinCommand) Register(fs *flag.FlagSet) {}
@@ -34,18 +48,25 @@ func (hashinCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
 	defer sm.Release()
 
 	params := p.MakeParams()
-	params.RootPackageTree, err = pkgtree.ListPackages(p.ResolvedAbsRoot, string(p.ImportRoot))
+	params.RootPackageTree, err = p.ParseRootPackageTree()
 	if err != nil {
-		return errors.Wrap(err, "gps.ListPackages")
+		return errors.Wrap(err, "analysis of local packages failed")
 	}
 
 	s, err := gps.Prepare(params, sm)
 	if err != nil {
-		return errors.Wrap(err, "prepare solver")
+		return errors.Wrap(err, "could not set up solver for input hashing")
+	}
+
+	digest := s.HashInputs()
+	ctx.Out.Print(gps.HashingInputsAsString(s))
+	ctx.Out.Printf("inputs-digest = %x\n", digest)
+	if p.Lock != nil && !bytes.Equal(digest, p.Lock.InputHash()) {
+		ctx.Out.Printf("%s is out of sync: its inputs-digest is %x\n", dep.LockName, p.Lock.InputHash())
 	}
-	ctx.Out.Println(gps.HashingInputsAsString(s))
 	return nil
 }
@@ -0,0 +1,227 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// shortestImportChain returns the shortest chain of imports by which one of
+// starts, the first in order which can, imports a package for which isTarget
+// is true. imports returns the imports of a package, or nil if it is not to be
+// followed. The chain starts with the package from starts and ends with the
+// target, or is nil if no target can be reached.
+func shortestImportChain(starts []string, imports func(string) []string, isTarget func(string) bool) []string {
+	for _, start := range starts {
+		// Breadth first, remembering how each package was reached.
+		from := map[string]string{start: ""}
+		queue := []string{start}
+		for len(queue) > 0 {
+			pkg := queue[0]
+			queue = queue[1:]
+			for _, imp := range imports(pkg) {
+				if isTarget(imp) {
+					chain := []string{imp}
+					for ; pkg != ""; pkg = from[pkg] {
+						chain = append([]string{pkg}, chain...)
+					}
+					return chain
+				}
+				if _, seen := from[imp]; !seen {
+					from[imp] = pkg
+					queue = append(queue, imp)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// importGraph follows imports from the packages of the root project through
+// those of its dependencies, at the versions they are locked to, or are being
+// tried at by the solver.
+type importGraph struct {
+	sm       gps.SourceManager
+	root     pkgtree.PackageTree
+	ignored  map[string]bool
+	tests    bool // Whether the test imports of the root project are followed
+	ids      map[gps.ProjectRoot]gps.ProjectIdentifier
+	versions map[gps.ProjectRoot]gps.Version
+	trees    map[string]*pkgtree.PackageTree // by project root and version
+}
+
+func newImportGraph(sm gps.SourceManager, p *dep.Project, ptree pkgtree.PackageTree) *importGraph {
+	g := &importGraph{
+		sm:       sm,
+		root:     ptree,
+		ignored:  p.Manifest.IgnoredPackages(),
+		tests:    !p.Manifest.ExcludeTests,
+		ids:      make(map[gps.ProjectRoot]gps.ProjectIdentifier),
+		versions: make(map[gps.ProjectRoot]gps.Version),
+		trees:    make(map[string]*pkgtree.PackageTree),
+	}
+	if p.Lock != nil {
+		for _, lp := range p.Lock.Projects() {
+			g.ids[lp.Ident().ProjectRoot] = lp.Ident()
+			g.versions[lp.Ident().ProjectRoot] = lp.Version()
+		}
+	}
+	return g
+}
+
+// chain returns the shortest chain of imports from a package of the root
+// project to the unresolved import ui, or nil if there is none to be found.
+func (g *importGraph) chain(ui gps.UnresolvedImport) []string {
+	// The importer's version is the one the solver was trying when it found
+	// the import to be unresolvable.
+	if ui.Version != nil {
+		prev, had := g.versions[ui.Importer.ProjectRoot]
+		g.versions[ui.Importer.ProjectRoot] = ui.Version
+		defer func() {
+			if had {
+				g.versions[ui.Importer.ProjectRoot] = prev
+			} else {
+				delete(g.versions, ui.Importer.ProjectRoot)
+			}
+		}()
+	}
+
+	var starts []string
+	for pkg := range g.root.Packages {
+		if !pkgtree.IsIgnored(pkg, g.ignored) {
+			starts = append(starts, pkg)
+		}
+	}
+	sort.Strings(starts)
+
+	return shortestImportChain(starts, g.imports, func(imp string) bool {
+		return isPathPrefix(imp, ui.ImportPath)
+	})
+}
+
+// imports returns the imports of the package ip, including its test imports
+// if it's in the root project and its manifest doesn't exclude tests, or nil if
+// they can't be determined.
+func (g *importGraph) imports(ip string) []string {
+	if pkgtree.IsIgnored(ip, g.ignored) || paths.IsStandardImportPath(ip) {
+		return nil
+	}
+	if poe, ok := g.root.Packages[ip]; ok {
+		if poe.Err != nil {
+			return nil
+		}
+		if !g.tests {
+			return append([]string(nil), poe.P.Imports...)
+		}
+		return append(append([]string(nil), poe.P.Imports...), poe.P.TestImports...)
+	}
+
+	pr, err := g.sm.DeduceProjectRoot(ip)
+	if err != nil {
+		return nil
+	}
+	v, has := g.versions[pr]
+	if !has {
+		return nil
+	}
+
+	key := string(pr) + "@" + v.String()
+	ptree, has := g.trees[key]
+	if !has {
+		id, has := g.ids[pr]
+		if !has {
+			id = gps.ProjectIdentifier{ProjectRoot: pr}
+		}
+		if t, err := g.sm.ListPackages(id, v); err == nil {
+			ptree = &t
+		}
+		g.trees[key] = ptree
+	}
+	if ptree == nil {
+		return nil
+	}
+
+	poe, ok := ptree.Packages[ip]
+	if !ok || poe.Err != nil {
+		return nil
+	}
+	return poe.P.Imports
+}
+
+// unresolvedChain is an unresolved import, with the chain of imports by
+// which the root project reaches it, if one was found, and whether it's in
+// the required list of the manifest.
+type unresolvedChain struct {
+	ImportPath string
+	Chain      []string
+	Required   bool
+	Err        error // Why the package couldn't be used, if it was found
+}
+
+// findUnresolvedChains finds a chain of imports to each import which err, the
+// failure of a solve, reports could not be satisfied.
+func findUnresolvedChains(sm gps.SourceManager, p *dep.Project, ptree pkgtree.PackageTree, err error) []unresolvedChain {
+	unresolved := gps.UnresolvedImports(err)
+	if len(unresolved) == 0 {
+		return nil
+	}
+
+	g := newImportGraph(sm, p, ptree)
+	required := p.Manifest.RequiredPackages()
+	chains := make([]unresolvedChain, len(unresolved))
+	for i, ui := range unresolved {
+		chains[i] = unresolvedChain{
+			ImportPath: ui.ImportPath,
+			Chain:      g.chain(ui),
+			Required:   required[ui.ImportPath],
+			Err:        ui.Err,
+		}
+	}
+	return chains
+}
+
+// formatUnresolvedChains describes the chains of imports by which the
+// project reaches each of the imports that could not be resolved. Those which
+// nothing imports, but which are required by the manifest, are explained as
+// such, as required entries must be buildable packages, not just projects.
+func formatUnresolvedChains(chains []unresolvedChain) string {
+	if len(chains) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "The following imports could not be resolved:")
+	for _, c := range chains {
+		fmt.Fprintf(&buf, "\n  %s\n", c.ImportPath)
+		switch {
+		case len(c.Chain) == 0 && c.Required && c.Err != nil:
+			fmt.Fprintf(&buf, "    required by Gopkg.toml, but it is not a buildable package: %s\n", c.Err)
+		case len(c.Chain) == 0 && c.Required:
+			fmt.Fprintln(&buf, "    required by Gopkg.toml, but no such package was found; required entries must be packages, not just projects")
+		case len(c.Chain) == 0:
+			fmt.Fprintln(&buf, "    (no chain of imports from the project to it could be found)")
+		default:
+			fmt.Fprintf(&buf, "    %s\n", strings.Join(c.Chain, " -> "))
+		}
+	}
+	return buf.String()
+}
+
+// printUnresolvedChains reports on ctx.Err how the project reaches each of
+// the imports which err, the failure of a solve, reports could not be
+// satisfied.
+func printUnresolvedChains(ctx *dep.Ctx, sm gps.SourceManager, p *dep.Project, ptree pkgtree.PackageTree, err error) {
+	if out := formatUnresolvedChains(findUnresolvedChains(sm, p, ptree, err)); out != "" {
+		ctx.Err.Print(out)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestShortestImportChain(t *testing.T) {
+	graph := map[string][]string{
+		"myproj":                      {"fmt", "myproj/internal/util"},
+		"myproj/cmd/api":              {"github.com/foo/bar/client", "myproj/internal/util"},
+		"myproj/internal/util":        {"github.com/foo/bar"},
+		"github.com/foo/bar":          {"github.com/foo/bar/internal"},
+		"github.com/foo/bar/client":   {"github.com/gone/pkg"},
+		"github.com/foo/bar/internal": {"github.com/gone/pkg/sub"},
+	}
+	imports := func(pkg string) []string { return graph[pkg] }
+	target := func(ip string) func(string) bool {
+		return func(imp string) bool { return isPathPrefix(imp, ip) }
+	}
+
+	cases := []struct {
+		name   string
+		starts []string
+		target string
+		want   []string
+	}{
+		{
+			name:   "first start which can",
+			starts: []string{"myproj", "myproj/cmd/api"},
+			target: "github.com/gone/pkg",
+			want:   []string{"myproj", "myproj/internal/util", "github.com/foo/bar", "github.com/foo/bar/internal", "github.com/gone/pkg/sub"},
+		},
+		{
+			name:   "shortest from a start",
+			starts: []string{"myproj/cmd/api"},
+			target: "github.com/gone/pkg",
+			want:   []string{"myproj/cmd/api", "github.com/foo/bar/client", "github.com/gone/pkg"},
+		},
+		{
+			name:   "unreachable",
+			starts: []string{"myproj"},
+			target: "github.com/never/imported",
+			want:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shortestImportChain(tc.starts, imports, target(tc.target)); !equalSlice(got, tc.want) {
+				t.Fatalf("expected chain %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatUnresolvedChains(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	if got := formatUnresolvedChains(nil); got != "" {
+		t.Fatalf("expected no output without unresolved imports, got %q", got)
+	}
+
+	chains := []unresolvedChain{
+		{
+			ImportPath: "github.com/gone/pkg",
+			Chain:      []string{"myproj/cmd/api", "github.com/foo/bar/client", "github.com/gone/pkg"},
+		},
+		{
+			ImportPath: "github.com/sdboyer/deptest/missing",
+			Chain:      []string{"myproj", "github.com/sdboyer/deptest/missing"},
+		},
+		{
+			ImportPath: "github.com/unreachable/pkg",
+		},
+		{
+			ImportPath: "golang.org/x/tools",
+			Required:   true,
+			Err:        errors.New("no buildable Go source files in /cache/golang.org/x/tools"),
+		},
+		{
+			ImportPath: "golang.org/x/tools/cmd/nosuch",
+			Required:   true,
+		},
+	}
+
+	goldenFile := filepath.Join("ensure", "unresolved_chains.txt")
+	got := formatUnresolvedChains(chains)
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Errorf("Unexpected output for %s:\n\t(GOT):\n%s\n\t(WNT):\n%s", goldenFile, got, want)
+		}
+	}
+}
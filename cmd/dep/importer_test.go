@@ -0,0 +1,136 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+)
+
+const testProjectRoot = "github.com/golang/notexist"
+
+// converter is the part of an importer which is exercised by
+// importConverterTestCase: converting already loaded configuration into a
+// dep manifest and lock.
+type converter interface {
+	convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error)
+}
+
+// importConverterTestCase is a common set of validations applied to the result
+// of an importer converting from an external config format to dep's.
+type importConverterTestCase struct {
+	wantConvertErr     bool
+	matchPairedVersion bool
+	projectRoot        gps.ProjectRoot
+	wantSourceRepo     string
+	constraintStyle    string // Applied to the manifest as rootAnalyzer would, if set.
+	wantConstraint     string
+	wantRevision       gps.Revision
+	wantVersion        string
+	wantLockCount      int
+	wantIgnored        []string
+}
+
+// exec converts the configuration loaded into c on behalf of testProjectRoot,
+// and validates the resulting manifest and lock against the test case.
+func (tc importConverterTestCase) exec(t *testing.T, c converter) {
+	manifest, lock, err := c.convert(testProjectRoot)
+	if err != nil {
+		if tc.wantConvertErr {
+			return
+		}
+
+		t.Fatal(err)
+	}
+	if tc.wantConvertErr {
+		t.Fatal("Expected the conversion to fail, but it did not")
+	}
+
+	if tc.constraintStyle != "" {
+		a := &rootAnalyzer{constraintStyle: tc.constraintStyle}
+		if err := a.applyConstraintStyle(manifest); err != nil {
+			t.Fatal(err)
+		}
+		if tc.constraintStyle == importConstraintNone {
+			if _, ok := manifest.Constraints[tc.projectRoot]; ok {
+				t.Fatalf("Expected the manifest to not constrain '%s'", tc.projectRoot)
+			}
+		}
+	}
+
+	// Ignored projects checks.
+	if !equalSlice(manifest.Ignored, tc.wantIgnored) {
+		t.Fatalf("Expected manifest to have ignore %s, got %s",
+			strings.Join(tc.wantIgnored, ", "),
+			strings.Join(manifest.Ignored, ", "))
+	}
+
+	// Lock checks.
+	if lock != nil && len(lock.P) != tc.wantLockCount {
+		t.Fatalf("Expected lock to have %d project(s), got %d",
+			tc.wantLockCount,
+			len(lock.P))
+	}
+
+	if tc.wantConstraint != "" {
+		d, ok := manifest.Constraints[tc.projectRoot]
+		if !ok {
+			t.Fatalf("Expected the manifest to have a dependency for '%s' but got none",
+				tc.projectRoot)
+		}
+
+		v := d.Constraint.String()
+		if v != tc.wantConstraint {
+			t.Fatalf("Expected manifest constraint to be %s, got %s", tc.wantConstraint, v)
+		}
+
+		if d.Source != tc.wantSourceRepo {
+			t.Fatalf("Expected manifest source to be %s, got '%s'", tc.wantSourceRepo, d.Source)
+		}
+	}
+
+	// Locked project checks below. Skip if the lock is expected to be empty.
+	if tc.wantLockCount == 0 {
+		return
+	}
+
+	p := lock.P[0]
+	if p.Ident().ProjectRoot != tc.projectRoot {
+		t.Fatalf("Expected the lock to have a project for '%s' but got '%s'",
+			tc.projectRoot,
+			p.Ident().ProjectRoot)
+	}
+
+	if p.Ident().Source != tc.wantSourceRepo {
+		t.Fatalf("Expected locked source to be %s, got '%s'", tc.wantSourceRepo, p.Ident().Source)
+	}
+
+	lv := p.Version()
+	if tc.wantRevision != "" {
+		rev, _, _ := gps.VersionComponentStrings(lv)
+		if gps.Revision(rev) != tc.wantRevision {
+			t.Fatalf("Expected locked revision to be '%s', got %s",
+				tc.wantRevision,
+				rev)
+		}
+	}
+
+	lpv, ok := lv.(gps.PairedVersion)
+	if !ok {
+		if tc.matchPairedVersion {
+			t.Fatalf("Expected locked version to be PairedVersion but got %T", lv)
+		}
+
+		return
+	}
+
+	ver := lpv.String()
+	if tc.wantVersion != "" && ver != tc.wantVersion {
+		t.Fatalf("Expected locked version to be '%s', got %s", tc.wantVersion, ver)
+	}
+}
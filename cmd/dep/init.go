@@ -8,6 +8,7 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/golang/dep"
@@ -26,26 +27,57 @@ specified, use the current directory.
 
 When configuration for another dependency management tool is detected, it is
 imported into the initial manifest and lock. Use the -skip-tools flag to
-disable this behavior. The following external tools are supported: glide, godep.
+disable this behavior. When several tools are detected, their configuration is
+merged, the later tool winning where they disagree; use -importers to choose
+which tools are imported, and in which order. The following external tools are
+supported: glide, godep, govendor, gb, gvt, glock, vndr, gom, gpm. Git
+submodules under vendor/ and the go_repository rules of a Bazel WORKSPACE are
+imported too, and go.mod is imported when no other tool is detected.
+Configuration is looked for in root, unless another directory is passed with
+-from, e.g. the root of a repository containing several projects. Ignored
+packages named relative to that directory are re-rooted onto the project.
+Imported revisions which can no longer be found upstream are left out of the
+lock with a warning; pass -strict-import to fail instead.
+Imported versions are constrained with caret (^x.y.z) constraints by default.
+Use -import-constraint to choose tilde (~x.y.z) or exact (=x.y.z) constraints
+instead, or none to leave the imported projects unconstrained and rely on the
+lock alone.
 Any dependencies that are not constrained by external configuration use the
 GOPATH analysis below.
 
-By default, the dependencies are resolved over the network. A version will be
-selected from the versions available from the upstream source per the following
-algorithm:
+By default, or when -network is passed, the dependencies are resolved over the
+network, ignoring GOPATH entirely. A version will be selected from the versions
+available from the upstream source per the following algorithm:
 
  - Tags conforming to semver (sorted by semver rules)
  - Default branch(es) (sorted lexicographically)
  - Non-semver tags (sorted lexicographically)
 
 An alternate mode can be activated by passing -gopath. In this mode, the version
-of each dependency will reflect the current state of the GOPATH. If a dependency
-doesn't exist in the GOPATH, a version will be selected based on the above
-network version selection algorithm.
+of each dependency will reflect the current state of the GOPATH; when GOPATH
+lists several entries, they are searched in order, like the go tool does. If a
+dependency doesn't exist in the GOPATH, a version will be selected based on the above
+network version selection algorithm, and a note is printed for it. Constraints
+are inferred from the versions in GOPATH: a dependency checked out at a semver
+tag is constrained with a caret (^x.y.z) constraint, and one on a branch other
+than its default branch is constrained to that branch. Any other dependency,
+e.g. one checked out at a revision which is neither a tag nor a branch, is
+locked to its version without a constraint. How many constraints were inferred
+from tags and branches, and which dependencies were left unconstrained, is
+summarized. Pass -no-infer-constraints to lock the versions in GOPATH without
+constraining any of them. -gopath and -network can't be used together. Pass
+-v to print which strategy is used.
+
+The project's import path is inferred from where root is in GOPATH. For a
+project outside of GOPATH, pass it with -root-import instead; it's kept as the
+root of Gopkg.toml, so that other commands can find it too.
 
 A Gopkg.toml file will be written with inferred version constraints for all
 direct dependencies. Gopkg.lock will be written with precise versions, and
 vendor/ will be populated with the precise versions written to Gopkg.lock.
+
+Pass -dry-run to print the manifest and lock that would be written, along with
+where their projects came from, without writing anything to disk.
 `
 
 func (cmd *initCommand) Name() string      { return "init" }
@@ -58,12 +90,50 @@ func (cmd *initCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.noExamples, "no-examples", false, "don't include example in Gopkg.toml")
 	fs.BoolVar(&cmd.skipTools, "skip-tools", false, "skip importing configuration from other dependency managers")
 	fs.BoolVar(&cmd.gopath, "gopath", false, "search in GOPATH for dependencies")
+	fs.BoolVar(&cmd.network, "network", false, "ignore GOPATH and solve for the latest versions of dependencies")
+	fs.BoolVar(&cmd.noInferConstraints, "no-infer-constraints", false, "with -gopath, don't infer constraints from the versions in GOPATH")
+	fs.BoolVar(&cmd.strictImport, "strict-import", false, "fail if a revision imported from another dependency manager can't be found")
+	fs.BoolVar(&cmd.dryRun, "dry-run", false, "only report the manifest and lock that would be written")
+	fs.StringVar(&cmd.importConstraint, "import-constraint", importConstraintCaret, "style of constraint for imported versions: caret, tilde, exact or none")
+	fs.StringVar(&cmd.importers, "importers", "", "comma-separated list of the tools to import configuration from, in order (example: godep,glide)")
+	fs.StringVar(&cmd.from, "from", "", "directory to import the configuration of other dependency managers from, instead of root")
+	fs.StringVar(&cmd.rootImport, "root-import", "", "import path of the project, for projects outside of GOPATH (example: github.com/org/proj)")
+	fs.IntVar(&cmd.prefetchWorkers, "prefetch-workers", defaultPrefetchWorkers, "number of projects to list the versions of at once before solving; 0 to skip this, e.g. to save memory")
+	cmd.trace.register(fs)
+}
+
+// strategy describes where init gets the versions of dependencies from, in
+// the order it tries them.
+func (cmd *initCommand) strategy() string {
+	var from []string
+	if !cmd.skipTools {
+		from = append(from, "the configuration of other dependency managers")
+	}
+	if cmd.gopath {
+		from = append(from, "GOPATH, falling back on the network for projects not in it")
+	} else {
+		from = append(from, "the network, ignoring GOPATH")
+	}
+	return "from " + strings.Join(from, ", then ")
 }
 
 type initCommand struct {
-	noExamples bool
-	skipTools  bool
-	gopath     bool
+	noExamples   bool
+	skipTools    bool
+	gopath       bool
+	network      bool
+	strictImport bool
+	dryRun       bool
+
+	noInferConstraints bool
+
+	importConstraint string
+	importers        string
+	from             string
+	rootImport       string
+
+	prefetchWorkers int
+	trace           traceOptions
 }
 
 func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -71,6 +141,28 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Errorf("too many args (%d)", len(args))
 	}
 
+	if cmd.gopath && cmd.network {
+		return errors.New("cannot pass both -gopath and -network")
+	}
+	if cmd.network && ctx.NoNetwork {
+		return errors.New("cannot pass both -network and -no-network")
+	}
+	if cmd.noInferConstraints && !cmd.gopath {
+		return errors.New("-no-infer-constraints can only be used with -gopath")
+	}
+
+	switch cmd.importConstraint {
+	case importConstraintCaret, importConstraintTilde, importConstraintExact, importConstraintNone:
+	default:
+		return errors.Errorf("invalid -import-constraint %q, must be one of caret, tilde, exact or none", cmd.importConstraint)
+	}
+	if cmd.prefetchWorkers < 0 {
+		return errors.New("-prefetch-workers cannot be negative")
+	}
+	if err := cmd.trace.validate(); err != nil {
+		return err
+	}
+
 	var root string
 	if len(args) <= 0 {
 		root = ctx.WorkingDir
@@ -79,8 +171,24 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		if !filepath.IsAbs(args[0]) {
 			root = filepath.Join(ctx.WorkingDir, args[0])
 		}
-		if err := os.MkdirAll(root, os.FileMode(0777)); err != nil {
-			return errors.Errorf("unable to create directory %s , err %v", root, err)
+		if !cmd.dryRun {
+			if err := os.MkdirAll(root, os.FileMode(0777)); err != nil {
+				return errors.Errorf("unable to create directory %s , err %v", root, err)
+			}
+		}
+	}
+
+	var from string
+	if cmd.from != "" {
+		if cmd.skipTools {
+			return errors.New("-from cannot be used with -skip-tools")
+		}
+		from = cmd.from
+		if !filepath.IsAbs(from) {
+			from = filepath.Join(ctx.WorkingDir, from)
+		}
+		if _, err := fs.IsDir(from); err != nil {
+			return errors.Wrap(err, "invalid -from")
 		}
 	}
 
@@ -90,9 +198,11 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Wrap(err, "NewProject")
 	}
 
-	ctx.GOPATH, err = ctx.DetectProjectGOPATH(p)
-	if err != nil {
-		return errors.Wrapf(err, "ctx.DetectProjectGOPATH")
+	if err = ctx.ResolveProject(p, cmd.rootImport); err != nil {
+		if cmd.rootImport == "" {
+			return errors.Wrap(err, "pass -root-import with the import path of a project outside of GOPATH")
+		}
+		return err
 	}
 
 	mf := filepath.Join(root, dep.ManifestName)
@@ -116,12 +226,6 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Errorf("invalid state: manifest %q does not exist, but lock %q does", mf, lf)
 	}
 
-	ip, err := ctx.ImportForAbs(root)
-	if err != nil {
-		return errors.Wrap(err, "root project import")
-	}
-	p.ImportRoot = gps.ProjectRoot(ip)
-
 	sm, err := ctx.SourceManager()
 	if err != nil {
 		return errors.Wrap(err, "getSourceManager")
@@ -134,20 +238,32 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
+	if ctx.Verbose {
+		ctx.Err.Printf("Initializing %s %s\n", p.ImportRoot, cmd.strategy())
+	}
+
 	// Initialize with imported data, then fill in the gaps using the GOPATH
 	rootAnalyzer := newRootAnalyzer(cmd.skipTools, ctx, directDeps, sm)
+	rootAnalyzer.strictImport = cmd.strictImport
+	rootAnalyzer.constraintStyle = cmd.importConstraint
+	rootAnalyzer.importerOrder = parseImporterOrder(cmd.importers)
+	rootAnalyzer.importDir = from
 	p.Manifest, p.Lock, err = rootAnalyzer.InitializeRootManifestAndLock(root, p.ImportRoot)
 	if err != nil {
 		return err
 	}
+	p.Manifest.Root = cmd.rootImport
+	importedCount := countProjects(p.Manifest, p.Lock)
 
 	if cmd.gopath {
 		gs := newGopathScanner(ctx, directDeps, sm)
+		gs.noConstraints = cmd.noInferConstraints
 		err = gs.InitializeRootManifestAndLock(p.Manifest, p.Lock)
 		if err != nil {
 			return err
 		}
 	}
+	gopathCount := countProjects(p.Manifest, p.Lock) - importedCount
 
 	rootAnalyzer.skipTools = true // Don't import external config during solve for now
 	copyLock := *p.Lock           // Copy lock before solving. Use this to separate new lock projects from solved lock
@@ -160,16 +276,19 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		ProjectAnalyzer: rootAnalyzer,
 	}
 
-	if ctx.Verbose {
-		params.TraceLogger = ctx.Err
+	closeTrace, err := cmd.trace.apply(ctx, &params)
+	if err != nil {
+		return err
 	}
+	defer closeTrace()
 
 	s, err := gps.Prepare(params, sm)
 	if err != nil {
 		return errors.Wrap(err, "prepare solver")
 	}
 
-	soln, err := s.Solve()
+	prefetch(ctx.Context, sm, p, pkgT, cmd.prefetchWorkers, nil)
+	soln, err := s.Solve(ctx.Context)
 	if err != nil {
 		handleAllTheFailuresOfTheWorld(err)
 		return err
@@ -187,6 +306,23 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 
 	p.Lock.SolveMeta.InputsDigest = s.HashInputs()
 
+	if cmd.dryRun {
+		if len(rootAnalyzer.importedFrom) > 0 {
+			ctx.Err.Printf("Imported %d project(s) from %s.\n", importedCount, strings.Join(rootAnalyzer.importedFrom, ", "))
+		} else {
+			ctx.Err.Println("No configuration from other dependency managers was detected.")
+		}
+		if cmd.gopath {
+			ctx.Err.Printf("Inferred %d project(s) from GOPATH.\n", gopathCount)
+		}
+
+		sw, err := dep.NewSafeWriter(p.Manifest, nil, p.Lock, dep.VendorNever)
+		if err != nil {
+			return err
+		}
+		return sw.PrintPreparedActions(ctx.Out)
+	}
+
 	// Pass timestamp (yyyyMMddHHmmss format) as suffix to backup name.
 	vendorbak, err := dep.BackupVendor(vpath, time.Now().Format("20060102150405"))
 	if err != nil {
@@ -200,6 +336,7 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 	if err != nil {
 		return err
 	}
+	sw.ImportComments = importCommentsChecker(ctx, ctx.Strict)
 
 	if err := sw.Write(root, sm, !cmd.noExamples); err != nil {
 		return errors.Wrap(err, "safe write of manifest and lock")
@@ -208,8 +345,37 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 	return nil
 }
 
+// parseImporterOrder splits the comma-separated list of importer names passed
+// to -importers.
+func parseImporterOrder(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// countProjects returns the number of distinct projects which are either
+// constrained by m or locked in l.
+func countProjects(m *dep.Manifest, l *dep.Lock) int {
+	projects := make(map[gps.ProjectRoot]bool)
+	if m != nil {
+		for pr := range m.Constraints {
+			projects[pr] = true
+		}
+	}
+	if l != nil {
+		for _, lp := range l.P {
+			projects[lp.Ident().ProjectRoot] = true
+		}
+	}
+	return len(projects)
+}
+
 func getDirectDependencies(sm gps.SourceManager, p *dep.Project) (pkgtree.PackageTree, map[string]bool, error) {
-	pkgT, err := pkgtree.ListPackages(p.ResolvedAbsRoot, string(p.ImportRoot))
+	pkgT, err := p.ParseRootPackageTree()
 	if err != nil {
 		return pkgtree.PackageTree{}, nil, errors.Wrap(err, "gps.ListPackages")
 	}
@@ -39,3 +39,19 @@ func TestGetDirectDependencies_ConsolidatesRootProjects(t *testing.T) {
 		t.Fatalf("Expected direct dependencies to contain %s, got %v", wantpr, dd)
 	}
 }
+
+func TestInitStrategy(t *testing.T) {
+	cases := []struct {
+		cmd  initCommand
+		want string
+	}{
+		{initCommand{}, "from the configuration of other dependency managers, then the network, ignoring GOPATH"},
+		{initCommand{skipTools: true, network: true}, "from the network, ignoring GOPATH"},
+		{initCommand{gopath: true}, "from the configuration of other dependency managers, then GOPATH, falling back on the network for projects not in it"},
+	}
+	for _, c := range cases {
+		if got := c.cmd.strategy(); got != c.want {
+			t.Errorf("%+v: unexpected strategy:\n\t(GOT): %s\n\t(WNT): %s", c.cmd, got, c.want)
+		}
+	}
+}
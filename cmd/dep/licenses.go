@@ -0,0 +1,281 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/license"
+	"github.com/pkg/errors"
+)
+
+const licensesShortHelp = `Report the licenses of the dependencies`
+const licensesLongHelp = `
+Licenses reports the license of each project in Gopkg.lock, as detected from
+the LICENSE, COPYING or UNLICENSE files at its root, along with the file it was
+detected from so it can be checked. Licenses are recognized as MIT,
+Apache-2.0, BSD-2-Clause, BSD-3-Clause, MPL, GPL, LGPL, AGPL or Unlicense, and
+are otherwise Unknown; projects without a license file are reported as NONE.
+Those are listed first, so that they stand out.
+
+The license files are read from vendor/. The projects which aren't there, e.g.
+because the project doesn't commit vendor/, are exported from the source
+cache, at their locked versions, to be read.
+
+The report is a table by default; pass -json or -csv for the report in those
+formats. Pass -notices with the path of a file to also write the full texts of
+all the license files there, one after the other, e.g. to ship as the NOTICES
+of a binary.
+
+Pass -strict to fail if any project's license is Unknown or NONE, or if
+Gopkg.toml has problems.
+`
+
+// noLicense is reported as the license of projects without license files.
+const noLicense = "NONE"
+
+type licensesCommand struct {
+	json    bool
+	csv     bool
+	notices string
+	strict  bool
+}
+
+func (cmd *licensesCommand) Name() string      { return "licenses" }
+func (cmd *licensesCommand) Args() string      { return "" }
+func (cmd *licensesCommand) ShortHelp() string { return licensesShortHelp }
+func (cmd *licensesCommand) LongHelp() string  { return licensesLongHelp }
+func (cmd *licensesCommand) Hidden() bool      { return false }
+
+func (cmd *licensesCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.json, "json", false, "output in JSON format")
+	fs.BoolVar(&cmd.csv, "csv", false, "output in CSV format")
+	fs.StringVar(&cmd.notices, "notices", "", "also write the texts of all the license files to this file")
+	fs.BoolVar(&cmd.strict, "strict", false, "fail if any license is unknown or missing, or if Gopkg.toml has problems")
+}
+
+func (cmd *licensesCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.New("licenses takes no arguments")
+	}
+	if cmd.json && cmd.csv {
+		return errors.New("cannot pass both -json and -csv")
+	}
+
+	// The -strict of licenses takes the place of the global one, so it makes
+	// problems found in Gopkg.toml errors too.
+	ctx.Strict = ctx.Strict || cmd.strict
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found. Run `dep ensure` to generate lock file", dep.LockName)
+	}
+
+	// The source manager is only set up should a project have to be
+	// exported, as it's not needed for those in vendor/.
+	var sm *gps.SourceMgr
+	defer func() {
+		if sm != nil {
+			sm.Release()
+		}
+	}()
+	tmp, err := ioutil.TempDir("", "dep-licenses")
+	if err != nil {
+		return errors.Wrap(err, "creating a temporary dir to export projects to")
+	}
+	defer os.RemoveAll(tmp)
+	export := func(lp gps.LockedProject) (string, error) {
+		if sm == nil {
+			if sm, err = ctx.SourceManager(); err != nil {
+				return "", err
+			}
+			sm.UseDefaultSignalHandling()
+			sm.UseSourceMirrors(p.Manifest.Mirrors)
+		}
+		to := filepath.Join(tmp, filepath.FromSlash(string(lp.Ident().ProjectRoot)))
+		return to, sm.ExportProject(lp.Ident(), lp.Version(), to)
+	}
+
+	licenses, err := collectLicenses(p, export)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case cmd.json:
+		err = writeLicensesJSON(&buf, licenses)
+	case cmd.csv:
+		err = writeLicensesCSV(&buf, licenses)
+	default:
+		writeLicensesTable(&buf, licenses)
+	}
+	if err != nil {
+		return err
+	}
+	ctx.Out.Print(buf.String())
+
+	if cmd.notices != "" {
+		if err := writeNotices(cmd.notices, licenses); err != nil {
+			return err
+		}
+	}
+
+	if cmd.strict {
+		var bad int
+		for _, l := range licenses {
+			if l.unrecognized() {
+				bad++
+			}
+		}
+		if bad > 0 {
+			return errors.Errorf("%d license(s) are unknown or missing", bad)
+		}
+	}
+	return nil
+}
+
+// projectLicense is a license detected for a locked project, from one of its
+// license files, or the lack of one.
+type projectLicense struct {
+	ProjectRoot string
+	License     string // An SPDX identifier, license.Unknown or noLicense
+	File        string `json:",omitempty"` // In vendor/, or else relative to the project's root
+
+	path string // Where the file was read from
+}
+
+func (l projectLicense) unrecognized() bool {
+	return l.License == license.Unknown || l.License == noLicense
+}
+
+// collectLicenses detects the licenses of the projects in the lock of p, from
+// vendor/, or where export exports them to for those which aren't there. The
+// unknown and missing licenses come first, then the others, each by project.
+func collectLicenses(p *dep.Project, export func(gps.LockedProject) (string, error)) ([]projectLicense, error) {
+	var licenses []projectLicense
+	for _, lp := range p.Lock.Projects() {
+		pr := string(lp.Ident().ProjectRoot)
+		dir := filepath.Join(p.AbsRoot, "vendor", filepath.FromSlash(pr))
+		prefix := path.Join("vendor", pr)
+
+		found, err := license.Detect(dir)
+		if os.IsNotExist(err) {
+			if dir, err = export(lp); err != nil {
+				return nil, errors.Wrapf(err, "exporting %s to detect its license", pr)
+			}
+			prefix = pr
+			found, err = license.Detect(dir)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "detecting the license of %s", pr)
+		}
+
+		if len(found) == 0 {
+			licenses = append(licenses, projectLicense{ProjectRoot: pr, License: noLicense})
+		}
+		for _, l := range found {
+			licenses = append(licenses, projectLicense{
+				ProjectRoot: pr,
+				License:     l.Name,
+				File:        path.Join(prefix, l.File),
+				path:        filepath.Join(dir, l.File),
+			})
+		}
+	}
+
+	sort.Stable(byRecognition(licenses))
+	return licenses, nil
+}
+
+// byRecognition sorts the unrecognized licenses first, then by project, and
+// otherwise keeps the order of a project's license files.
+type byRecognition []projectLicense
+
+func (s byRecognition) Len() int      { return len(s) }
+func (s byRecognition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRecognition) Less(i, j int) bool {
+	if ui, uj := s[i].unrecognized(), s[j].unrecognized(); ui != uj {
+		return ui
+	}
+	return s[i].ProjectRoot < s[j].ProjectRoot
+}
+
+func writeLicensesTable(w io.Writer, licenses []projectLicense) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tLICENSE\tFILE")
+	for _, l := range licenses {
+		file := l.File
+		if file == "" {
+			file = "no license file found"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", l.ProjectRoot, l.License, file)
+	}
+	tw.Flush()
+}
+
+func writeLicensesJSON(w io.Writer, licenses []projectLicense) error {
+	if licenses == nil {
+		licenses = []projectLicense{}
+	}
+	b, err := json.MarshalIndent(licenses, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the licenses")
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func writeLicensesCSV(w io.Writer, licenses []projectLicense) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"ProjectRoot", "License", "File"})
+	for _, l := range licenses {
+		cw.Write([]string{l.ProjectRoot, l.License, l.File})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// noticesRule sets the header of each license apart in the notices.
+var noticesRule = strings.Repeat("=", 80)
+
+// writeNotices writes the texts of the license files of licenses to the file
+// at path, each after a header naming the project and license.
+func writeNotices(path string, licenses []projectLicense) error {
+	var buf bytes.Buffer
+	for _, l := range licenses {
+		if l.path == "" {
+			continue
+		}
+		text, err := ioutil.ReadFile(l.path)
+		if err != nil {
+			return errors.Wrapf(err, "reading the license of %s", l.ProjectRoot)
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "%s\n%s (%s)\n%s\n\n", noticesRule, l.ProjectRoot, l.License, noticesRule)
+		buf.Write(bytes.TrimRight(text, "\n"))
+		buf.WriteString("\n")
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, buf.Bytes(), 0666), "writing notices to %s", path)
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+const mitLicense = `Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software. The above copyright notice and this permission notice shall be
+included in all copies or substantial portions of the Software.
+`
+
+func TestCollectLicenses(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("root")
+	h.TempFile("root/vendor/github.com/foo/mit/LICENSE", mitLicense)
+	h.TempFile("root/vendor/github.com/foo/odd/COPYING", "All rights reserved.\n")
+	h.TempFile("root/vendor/github.com/foo/none/foo.go", "package foo\n")
+
+	mkLP := func(pr string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}, gps.Revision("rev"), nil)
+	}
+	p := &dep.Project{
+		AbsRoot: h.Path("root"),
+		Lock: &dep.Lock{P: []gps.LockedProject{
+			mkLP("github.com/foo/cached"),
+			mkLP("github.com/foo/mit"),
+			mkLP("github.com/foo/none"),
+			mkLP("github.com/foo/odd"),
+		}},
+	}
+
+	// Only the project which isn't in vendor/ is exported.
+	var exported []string
+	export := func(lp gps.LockedProject) (string, error) {
+		pr := string(lp.Ident().ProjectRoot)
+		exported = append(exported, pr)
+		h.TempFile(filepath.Join("export", pr, "LICENSE.txt"), mitLicense)
+		return h.Path(filepath.Join("export", pr)), nil
+	}
+
+	licenses, err := collectLicenses(p, export)
+	if err != nil {
+		t.Fatalf("Unexpected error collecting the licenses: %s", err)
+	}
+	if want := []string{"github.com/foo/cached"}; !reflect.DeepEqual(exported, want) {
+		t.Errorf("unexpected exported projects:\n\t(GOT): %v\n\t(WNT): %v", exported, want)
+	}
+
+	var buf bytes.Buffer
+	if err := writeLicensesCSV(&buf, licenses); err != nil {
+		t.Fatal(err)
+	}
+	want := `ProjectRoot,License,File
+github.com/foo/none,NONE,
+github.com/foo/odd,Unknown,vendor/github.com/foo/odd/COPYING
+github.com/foo/cached,MIT,github.com/foo/cached/LICENSE.txt
+github.com/foo/mit,MIT,vendor/github.com/foo/mit/LICENSE
+`
+	if buf.String() != want {
+		t.Errorf("unexpected CSV report:\n\t(GOT):\n%s\n\t(WNT):\n%s", buf.String(), want)
+	}
+
+	notices := filepath.Join(h.Path("."), "NOTICES")
+	if err := writeNotices(notices, licenses); err != nil {
+		t.Fatalf("Unexpected error writing the notices: %s", err)
+	}
+	b, err := ioutil.ReadFile(notices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(b)
+	for _, s := range []string{"github.com/foo/odd (Unknown)", "All rights reserved.", "github.com/foo/cached (MIT)", "github.com/foo/mit (MIT)"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("Expected the notices to contain %q, got:\n%s", s, text)
+		}
+	}
+	if strings.Contains(text, "github.com/foo/none") {
+		t.Errorf("Expected no notice for github.com/foo/none, which has no license file, got:\n%s", text)
+	}
+}
+
+func TestWriteLicensesJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeLicensesJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("Expected an empty JSON list for no licenses, got %q", buf.String())
+	}
+
+	buf.Reset()
+	licenses := []projectLicense{
+		{ProjectRoot: "github.com/foo/none", License: noLicense},
+		{ProjectRoot: "github.com/foo/mit", License: "MIT", File: "vendor/github.com/foo/mit/LICENSE", path: "/abs"},
+	}
+	if err := writeLicensesJSON(&buf, licenses); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "ProjectRoot": "github.com/foo/none",
+    "License": "NONE"
+  },
+  {
+    "ProjectRoot": "github.com/foo/mit",
+    "License": "MIT",
+    "File": "vendor/github.com/foo/mit/LICENSE"
+  }
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected JSON report:\n\t(GOT):\n%s\n\t(WNT):\n%s", buf.String(), want)
+	}
+}
+
+func TestLicensesStrictManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("src/example.com/proj/Gopkg.toml", "[[constraint]]\n  name = \"github.com/sdboyer/deptest\"\n  verison = \"1.0.0\"\n")
+
+	ctx := newTestContext(h)
+	h.Must(ctx.SetPaths(h.Path("src/example.com/proj"), h.Path(".")))
+	cmd := &licensesCommand{strict: true}
+	err := cmd.Run(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "found 1 problems") {
+		t.Fatalf("Expected -strict to fail on the problem in Gopkg.toml, got %v", err)
+	}
+}
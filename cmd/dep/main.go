@@ -7,16 +7,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/golang/dep"
+	depfs "github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
 )
 
 type command interface {
@@ -29,6 +35,12 @@ type command interface {
 	Run(*dep.Ctx, []string) error
 }
 
+// exitCoder is implemented by the errors of commands which exit with a status
+// other than 1, to tell different kinds of failure apart.
+type exitCoder interface {
+	ExitCode() int
+}
+
 func main() {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -60,7 +72,13 @@ func (c *Config) Run() (exitCode int) {
 		&initCommand{},
 		&statusCommand{},
 		&ensureCommand{},
+		&checkCommand{},
 		&hashinCommand{},
+		&graphCommand{},
+		&whyCommand{},
+		&removeCommand{},
+		&licensesCommand{},
+		&cacheCommand{},
 		&pruneCommand{},
 	}
 
@@ -85,6 +103,7 @@ func (c *Config) Run() (exitCode int) {
 
 	outLogger := log.New(c.Stdout, "", 0)
 	errLogger := log.New(c.Stderr, "", 0)
+	depfs.Warn = log.New(c.Stderr, "Warning: ", 0)
 
 	usage := func() {
 		errLogger.Println("dep is a tool for managing dependencies for Go projects")
@@ -123,10 +142,29 @@ func (c *Config) Run() (exitCode int) {
 			fs := flag.NewFlagSet(cmdName, flag.ContinueOnError)
 			fs.SetOutput(c.Stderr)
 			verbose := fs.Bool("v", false, "enable verbose logging")
+			versionTTL := fs.Duration("version-ttl", gps.DefaultVersionListTTL, "how long to reuse the version lists of sources for before listing them again; 0 to always list them")
+			metadataTTL := fs.Duration("metadata-ttl", gps.DefaultMetadataTTL, "how long to reuse the go-get metadata of import paths for before fetching it again; 0 to always fetch it")
+			staleOK := fs.Bool("stale-ok", false, "reuse cached version lists and go-get metadata however old they are, e.g. to work offline")
+			noNetwork := fs.Bool("no-network", getEnv(c.Env, "DEPNOFETCH") != "", "never access the network, working only from the source cache; also set by $DEPNOFETCH")
+			noPrompt := fs.Bool("no-prompt", false, "fail rather than prompt for credentials to private sources, e.g. in CI")
+			cachedir := fs.String("cachedir", getEnv(c.Env, "DEPCACHEDIR"), "the dir to cache sources in, rather than $GOPATH/pkg/dep; also set by $DEPCACHEDIR")
+			readOnlyCache := fs.String("readonly-cachedir", getEnv(c.Env, "DEPREADONLYCACHEDIR"), "a cache dir, e.g. one shared by a team, to copy sources from before fetching them; it's only read; also set by $DEPREADONLYCACHEDIR")
+			archives := fs.Bool("archives", false, "export locked revisions of GitHub and Bitbucket sources which aren't cached by downloading archives of them, rather than fetching the sources (experimental)")
+			timeout := fs.Duration("timeout", 0, "stop the command, cleaning up, if it takes longer than this; 0 for no limit")
+			sourceTimeout := fs.Duration("source-timeout", 0, "how long each operation on a source, such as fetching it, may take before it fails; 0 for no limit")
+			vendorLinks := depfs.LinkFiles
+			fs.Var(&vendorLinks, "vendor-links", "how files are copied from the source cache to vendor/: \"auto\" clones or hard links them where the filesystem allows, \"clone\" only clones them, and \"copy\" always copies them")
 
 			// Register the subcommand flags in there, too.
 			cmd.Register(fs)
 
+			// Some commands have a -strict of their own, which takes the place
+			// of the global one, as registering it twice would panic.
+			strict := new(bool)
+			if fs.Lookup("strict") == nil {
+				fs.BoolVar(strict, "strict", false, "treat problems found in Gopkg.toml as errors")
+			}
+
 			// Override the usage text to something nicer.
 			resetUsage(errLogger, fs, cmdName, cmd.Args(), cmd.LongHelp())
 
@@ -144,11 +182,29 @@ func (c *Config) Run() (exitCode int) {
 				return
 			}
 
+			// Stop the command, rather than leave things half done, on an
+			// interrupt or once its time is up.
+			cctx, cancel := commandContext(*timeout)
+			defer cancel()
+
 			// Set up dep context.
 			ctx := &dep.Ctx{
 				Out:     outLogger,
 				Err:     errLogger,
 				Verbose: *verbose,
+				Strict:  *strict,
+
+				VersionListTTL: *versionTTL,
+				MetadataTTL:    *metadataTTL,
+				StaleOK:        *staleOK,
+				NoNetwork:      *noNetwork,
+				NoPrompt:       *noPrompt,
+				Archives:       *archives,
+				Cachedir:       *cachedir,
+				ReadOnlyCache:  *readOnlyCache,
+				SourceTimeout:  *sourceTimeout,
+				VendorLinks:    vendorLinks,
+				Context:        cctx,
 			}
 
 			GOPATHS := filepath.SplitList(getEnv(c.Env, "GOPATH"))
@@ -157,7 +213,13 @@ func (c *Config) Run() (exitCode int) {
 			// Run the command with the post-flag-processing args.
 			if err := cmd.Run(ctx, fs.Args()); err != nil {
 				errLogger.Printf("%v\n", err)
+				if cctx.Err() == context.DeadlineExceeded {
+					errLogger.Printf("dep %s was stopped, as it took longer than -timeout %s\n", cmdName, *timeout)
+				}
 				exitCode = 1
+				if ec, ok := errors.Cause(err).(exitCoder); ok {
+					exitCode = ec.ExitCode()
+				}
 				return
 			}
 
@@ -172,6 +234,34 @@ func (c *Config) Run() (exitCode int) {
 	return
 }
 
+// commandContext returns the context of a command, which is canceled on an
+// interrupt, or once timeout passes, if it's not 0. Only the first interrupt
+// is caught, so a second kills a command which doesn't stop.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	stopTimer := func() {}
+	if timeout > 0 {
+		ctx, stopTimer = context.WithTimeout(ctx, timeout)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt)
+	go func() {
+		select {
+		case <-sigch:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigch)
+	}()
+
+	return ctx, func() {
+		cancel()
+		stopTimer()
+	}
+}
+
 func resetUsage(logger *log.Logger, fs *flag.FlagSet, name, args, longHelp string) {
 	var (
 		hasFlags   bool
@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandFlags(t *testing.T) {
+	// Every command registers its flags along with the global ones, which
+	// panics should any of them clash.
+	for _, name := range []string{"init", "status", "ensure", "check", "hash-inputs", "graph", "why", "remove", "licenses", "cache", "prune"} {
+		var stderr bytes.Buffer
+		c := &Config{
+			Args:       []string{"dep", name, "-h"},
+			Stdout:     &bytes.Buffer{},
+			Stderr:     &stderr,
+			WorkingDir: ".",
+		}
+		c.Run()
+		if !strings.Contains(stderr.String(), "enable verbose logging") {
+			t.Errorf("Expected the usage of %s to list the global flags, got:\n%s", name, stderr.String())
+		}
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	ctx, cancel := commandContext(0)
+	if ctx.Err() != nil {
+		t.Fatalf("Expected a command without a timeout not to be stopped, got %v", ctx.Err())
+	}
+	cancel()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("Expected a command to be stopped once canceled, got %v", ctx.Err())
+	}
+
+	ctx, cancel = commandContext(time.Millisecond)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			t.Errorf("Expected a command to be stopped as its time is up, got %v", ctx.Err())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected a command to be stopped once its timeout passed")
+	}
+
+	// An interrupt stops it, rather than dep.
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = commandContext(0)
+	defer cancel()
+	if err = p.Signal(os.Interrupt); err != nil {
+		t.Skipf("Skipping, as an interrupt can't be sent: %s", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("Expected a command to be stopped on an interrupt")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// offlineError is returned by an offlineSourceManager in place of anything
+// which would have needed the network.
+type offlineError struct {
+	op     string
+	target string
+}
+
+func (e *offlineError) Error() string {
+	return fmt.Sprintf("%s %s requires network access, which -offline disallows", e.op, e.target)
+}
+
+// isOfflineError reports whether err, or its cause, is an offlineError, or an
+// error from a SourceMgr on which the network is disabled.
+func isOfflineError(err error) bool {
+	switch errors.Cause(err).(type) {
+	case *offlineError, *gps.ErrNetworkDisabled:
+		return true
+	}
+	return false
+}
+
+// offlineSourceManager wraps a SourceManager so that nothing it does reaches
+// the network. Import paths are deduced from the roots of the locked projects,
+// or from the shape of the path for well-known hosts; anything else fails with
+// an offlineError.
+type offlineSourceManager struct {
+	gps.SourceManager
+	roots []gps.ProjectRoot
+}
+
+func newOfflineSourceManager(sm gps.SourceManager, l *dep.Lock) *offlineSourceManager {
+	osm := &offlineSourceManager{SourceManager: sm}
+	if l != nil {
+		for _, lp := range l.P {
+			osm.roots = append(osm.roots, lp.Ident().ProjectRoot)
+		}
+	}
+	return osm
+}
+
+func (sm *offlineSourceManager) SourceExists(id gps.ProjectIdentifier) (bool, error) {
+	return false, &offlineError{op: "checking the source of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) SyncSourceFor(id gps.ProjectIdentifier) error {
+	return &offlineError{op: "syncing", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) ListVersions(id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	return nil, &offlineError{op: "listing the versions of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) RevisionPresentIn(id gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	return false, &offlineError{op: "looking up revisions of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) ListPackages(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	return pkgtree.PackageTree{}, &offlineError{op: "listing the packages of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) GetManifestAndLock(id gps.ProjectIdentifier, v gps.Version, an gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	return nil, nil, &offlineError{op: "reading the manifest and lock of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) ExportProject(id gps.ProjectIdentifier, v gps.Version, to string) error {
+	return &offlineError{op: "exporting", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) RevisionTime(id gps.ProjectIdentifier, r gps.Revision) (time.Time, error) {
+	return time.Time{}, &offlineError{op: "looking up the commit time of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) CountCommitsBetween(id gps.ProjectIdentifier, from, to gps.Revision) (int, error) {
+	return 0, &offlineError{op: "counting the commits of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) SourceOrigin(id gps.ProjectIdentifier) (gps.ProjectOrigin, error) {
+	return gps.ProjectOrigin{}, &offlineError{op: "looking up the source of", target: string(id.ProjectRoot)}
+}
+
+func (sm *offlineSourceManager) DeduceProjectRoot(ip string) (gps.ProjectRoot, error) {
+	var root gps.ProjectRoot
+	for _, pr := range sm.roots {
+		if isPathPrefix(ip, string(pr)) && len(pr) > len(root) {
+			root = pr
+		}
+	}
+	if root != "" {
+		return root, nil
+	}
+
+	root, err := gps.DeduceKnownProjectRoot(ip)
+	if err != nil {
+		return "", err
+	}
+	if root == "" {
+		return "", &offlineError{op: "deducing the project root of", target: ip}
+	}
+	return root, nil
+}
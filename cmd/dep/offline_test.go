@@ -0,0 +1,72 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+func TestOfflineSourceManager_DeduceProjectRoot(t *testing.T) {
+	l := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "golang.org/x/net"}, gps.Revision("66aacef3dd8a676686c7ae3716979581e8b03c47"), []string{"context"}),
+		},
+	}
+	sm := newOfflineSourceManager(nil, l)
+
+	cases := map[string]gps.ProjectRoot{
+		"golang.org/x/net/context":   "golang.org/x/net",
+		"github.com/sdboyer/deptest": "github.com/sdboyer/deptest",
+	}
+	for ip, want := range cases {
+		got, err := sm.DeduceProjectRoot(ip)
+		if err != nil {
+			t.Errorf("Unexpected error deducing the root of %s: %s", ip, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Expected the root of %s to be %s, got %s", ip, want, got)
+		}
+	}
+
+	// Vanity import paths which aren't locked can't be deduced without
+	// fetching their metadata.
+	_, err := sm.DeduceProjectRoot("golang.org/x/sys/unix")
+	if !isOfflineError(err) {
+		t.Fatalf("Expected an offline error deducing an unlocked vanity import path, got %v", err)
+	}
+}
+
+func TestOfflineSourceManager_ListVersions(t *testing.T) {
+	sm := newOfflineSourceManager(nil, nil)
+
+	_, err := sm.ListVersions(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"})
+	if !isOfflineError(err) {
+		t.Fatalf("Expected an offline error listing versions, got %v", err)
+	}
+
+	bs := &BasicStatus{LatestErr: err}
+	if got := formatLatest(bs); got != "unknown" {
+		t.Errorf("Expected the latest version to be unknown, got %q", got)
+	}
+	raw := bs.marshalJSONStatus()
+	if raw.Latest != "unknown" || raw.Error != "" {
+		t.Errorf("Expected the JSON status to report the latest version as unknown, without an error, got %+v", raw)
+	}
+}
+
+func TestIsOfflineError(t *testing.T) {
+	nd := &gps.ErrNetworkDisabled{Source: "https://github.com/sdboyer/deptest", Op: "fetching"}
+	if !isOfflineError(errors.Wrap(nd, "exporting")) {
+		t.Error("Expected an ErrNetworkDisabled to be an offline error")
+	}
+	if isOfflineError(errors.New("fetching failed")) {
+		t.Error("Expected another error not to be an offline error")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// defaultPrefetchWorkers is how many projects are prefetched at once by
+// default. Prefetching mostly waits on the network, so it's not tied to the
+// number of CPUs.
+const defaultPrefetchWorkers = 8
+
+// prefetch warms sm up for solving the project p, whose package tree is ptree,
+// so that the solver mostly finds what it needs on hand, rather than waiting
+// on the network for each project in turn, as it comes to it. The project
+// roots of the packages p imports are deduced, and then the versions of those
+// projects, of the projects constrained by the manifest, and of the locked
+// projects, are listed, with workers of them at once. Failures are left for
+// the solver to report.
+func prefetch(ctx context.Context, sm gps.SourceManager, p *dep.Project, ptree pkgtree.PackageTree, workers int, prog *progress) {
+	if workers <= 0 {
+		return
+	}
+	defer prog.phase("fetching")()
+
+	ids := sourcesToFetch(p.Manifest.Constraints, p.Lock)
+	seen := make(map[gps.ProjectRoot]bool)
+	for _, id := range ids {
+		seen[id.ProjectRoot] = true
+	}
+
+	imports := externalImports(p, ptree)
+	roots := make([]gps.ProjectRoot, len(imports))
+	forEachConcurrently(ctx, len(imports), workers, func(i int) {
+		// A failure leaves the root empty, and is left for the solver.
+		roots[i], _ = sm.DeduceProjectRoot(imports[i])
+	})
+	for _, pr := range roots {
+		if pr != "" && !seen[pr] {
+			seen[pr] = true
+			ids = append(ids, gps.ProjectIdentifier{ProjectRoot: pr})
+		}
+	}
+
+	forEachConcurrently(ctx, len(ids), workers, func(i int) {
+		prog.prefetch(len(ids), ids[i].ProjectRoot, func() error {
+			_, err := sm.ListVersions(ids[i])
+			return err
+		})
+	})
+}
+
+// externalImports returns the import paths outside of p which it imports, or
+// requires in its manifest, but which aren't in the standard library. Those
+// only its tests import are left out if the manifest excludes tests.
+func externalImports(p *dep.Project, ptree pkgtree.PackageTree) []string {
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.ExcludeTests, false, p.Manifest.IgnoredPackages())
+	var imports []string
+	for _, ip := range append(rm.FlattenFn(paths.IsStandardImportPath), p.Manifest.Required...) {
+		if ip != ptree.ImportRoot && !strings.HasPrefix(ip, ptree.ImportRoot+"/") {
+			imports = append(imports, ip)
+		}
+	}
+	return imports
+}
+
+// forEachConcurrently calls f with each of 0 to n-1, with workers of them at
+// once, until ctx is done.
+func forEachConcurrently(ctx context.Context, n, workers int, f func(i int)) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				f(i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+)
+
+// slowSourceManager is a SourceManager of projects with a single version and
+// package, importing nothing, which takes latency to deduce the root of an
+// import path, or to fetch a source, the first time, as the network would.
+type slowSourceManager struct {
+	gps.SourceManager
+	latency time.Duration
+
+	mu      sync.Mutex
+	deduced map[gps.ProjectRoot]bool
+	fetched map[gps.ProjectRoot]bool
+}
+
+func newSlowSourceManager(latency time.Duration) *slowSourceManager {
+	return &slowSourceManager{
+		latency: latency,
+		deduced: make(map[gps.ProjectRoot]bool),
+		fetched: make(map[gps.ProjectRoot]bool),
+	}
+}
+
+// wait waits for the latency, unless pr is already in done.
+func (sm *slowSourceManager) wait(done map[gps.ProjectRoot]bool, pr gps.ProjectRoot) {
+	sm.mu.Lock()
+	has := done[pr]
+	sm.mu.Unlock()
+	if has {
+		return
+	}
+
+	time.Sleep(sm.latency)
+	sm.mu.Lock()
+	done[pr] = true
+	sm.mu.Unlock()
+}
+
+func (sm *slowSourceManager) DeduceProjectRoot(ip string) (gps.ProjectRoot, error) {
+	pr := gps.ProjectRoot(strings.Join(strings.SplitN(ip, "/", 4)[:3], "/"))
+	sm.wait(sm.deduced, pr)
+	return pr, nil
+}
+
+func (sm *slowSourceManager) SyncSourceFor(id gps.ProjectIdentifier) error {
+	sm.wait(sm.fetched, id.ProjectRoot)
+	return nil
+}
+
+func (sm *slowSourceManager) SourceExists(id gps.ProjectIdentifier) (bool, error) {
+	return true, sm.SyncSourceFor(id)
+}
+
+func (sm *slowSourceManager) ListVersions(id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	sm.wait(sm.fetched, id.ProjectRoot)
+	return []gps.PairedVersion{gps.NewVersion("v1.0.0").Pair("c575196502940c07bf89fd6d95e83b999162e051")}, nil
+}
+
+func (sm *slowSourceManager) RevisionPresentIn(gps.ProjectIdentifier, gps.Revision) (bool, error) {
+	return true, nil
+}
+
+func (sm *slowSourceManager) ListPackages(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	ip := string(id.ProjectRoot)
+	return pkgtree.PackageTree{
+		ImportRoot: ip,
+		Packages: map[string]pkgtree.PackageOrErr{
+			ip: {P: pkgtree.Package{Name: "p", ImportPath: ip}},
+		},
+	}, nil
+}
+
+func (sm *slowSourceManager) GetManifestAndLock(gps.ProjectIdentifier, gps.Version, gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	return gps.SimpleManifest{}, nil, nil
+}
+
+func (sm *slowSourceManager) SourceOrigin(gps.ProjectIdentifier) (gps.ProjectOrigin, error) {
+	return gps.ProjectOrigin{VCS: "git"}, nil
+}
+
+// TestPrefetch solves a project with many dependencies with and without
+// prefetching them first, and checks that prefetching saves most of the time
+// the solver would spend waiting on each in turn.
+func TestPrefetch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping timing test in short mode")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("src/github.com/root/proj")
+
+	const deps = 60
+	latency := 10 * time.Millisecond
+	root := pkgtree.Package{Name: "proj", ImportPath: "github.com/root/proj"}
+	for i := 0; i < deps; i++ {
+		root.Imports = append(root.Imports, fmt.Sprintf("github.com/dep/p%d", i))
+	}
+	ptree := pkgtree.PackageTree{
+		ImportRoot: root.ImportPath,
+		Packages:   map[string]pkgtree.PackageOrErr{root.ImportPath: {P: root}},
+	}
+	p := &dep.Project{
+		AbsRoot:  h.Path("src/github.com/root/proj"),
+		Manifest: &dep.Manifest{Constraints: make(gps.ProjectConstraints)},
+	}
+
+	solve := func(workers int) time.Duration {
+		sm := newSlowSourceManager(latency)
+		params := p.MakeParams()
+		params.RootPackageTree = ptree
+		solver, err := gps.Prepare(params, sm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		prefetch(context.Background(), sm, p, ptree, workers, nil)
+		solution, err := solver.Solve(context.Background())
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("Unexpected error solving with %d prefetch workers: %s", workers, err)
+		}
+		if n := len(solution.Projects()); n != deps {
+			t.Fatalf("Expected %d projects in the solution, got %d", deps, n)
+		}
+		return elapsed
+	}
+
+	cold := solve(0)
+	prefetched := solve(defaultPrefetchWorkers)
+	t.Logf("Solving %d dependencies: %s without prefetching, %s with it", deps, cold, prefetched)
+	if prefetched > cold/2 {
+		t.Errorf("Expected prefetching to at least halve the time taken solving, from %s, got %s", cold, prefetched)
+	}
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	var running, most int
+	seen := make([]bool, 20)
+	forEachConcurrently(context.Background(), len(seen), 3, func(i int) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		seen[i] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("Expected f to be called with %d", i)
+		}
+	}
+	if most > 3 {
+		t.Errorf("Expected at most 3 calls at once, got %d", most)
+	}
+
+	// Nothing is started once ctx is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var called bool
+	forEachConcurrently(ctx, 5, 2, func(int) { called = true })
+	if called {
+		t.Error("Expected f not to be called once ctx is done")
+	}
+}
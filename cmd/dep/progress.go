@@ -0,0 +1,199 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+)
+
+// progress reports what a long-running command is doing, and how long each
+// step and phase of it takes. A nil *progress reports nothing, so callers
+// needn't check whether progress is being reported.
+type progress struct {
+	out   *log.Logger
+	now   func() time.Time // Stubbed by tests, to make the timings predictable.
+	start time.Time
+
+	// The phases in the order they were first entered, and the total time
+	// spent in each.
+	phases []string
+	spent  map[string]time.Duration
+
+	// How many projects have been prefetched and exported, guarded by mu as
+	// they're done concurrently.
+	mu         sync.Mutex
+	prefetched int
+	exported   int
+}
+
+func newProgress(out *log.Logger) *progress {
+	p := &progress{
+		out:   out,
+		now:   time.Now,
+		spent: make(map[string]time.Duration),
+	}
+	p.start = p.now()
+	return p
+}
+
+// phase starts timing the named phase, returning a func which stops it.
+func (p *progress) phase(name string) func() {
+	if p == nil {
+		return func() {}
+	}
+
+	if _, has := p.spent[name]; !has {
+		p.phases = append(p.phases, name)
+		p.spent[name] = 0
+	}
+	start := p.now()
+	return func() {
+		p.spent[name] += p.now().Sub(start)
+	}
+}
+
+// step runs f as the ith of n steps, then reports what it did to what, and how
+// long it took.
+func (p *progress) step(i, n int, what, target string, f func() error) error {
+	if p == nil {
+		return f()
+	}
+
+	start := p.now()
+	err := f()
+	elapsed := formatElapsed(p.now().Sub(start))
+	if err != nil {
+		p.out.Printf("(%d/%d) %s %s ... failed after %s", i, n, what, target, elapsed)
+	} else {
+		p.out.Printf("(%d/%d) %s %s ... %s", i, n, what, target, elapsed)
+	}
+	return err
+}
+
+// export reports the export of a project to vendor/, one of n. As projects are
+// exported concurrently, each line starts with the project, and they're
+// numbered in the order the exports finish. It has the signature of
+// dep.SafeWriter's ExportProgress.
+func (p *progress) export(n int, pr gps.ProjectRoot, export func() error) error {
+	if p == nil {
+		return export()
+	}
+
+	start := p.now()
+	err := export()
+	elapsed := formatElapsed(p.now().Sub(start))
+
+	p.mu.Lock()
+	p.exported++
+	i := p.exported
+	p.mu.Unlock()
+
+	if err != nil {
+		p.out.Printf("%s: export (%d/%d) failed after %s", pr, i, n, elapsed)
+	} else {
+		p.out.Printf("%s: exported (%d/%d) in %s", pr, i, n, elapsed)
+	}
+	return err
+}
+
+// prefetch reports the prefetching of a project, one of n, for solving. Like
+// exports, as projects are prefetched concurrently, each line starts with the
+// project, and they're numbered in the order they finish.
+func (p *progress) prefetch(n int, pr gps.ProjectRoot, list func() error) error {
+	if p == nil {
+		return list()
+	}
+
+	start := p.now()
+	err := list()
+	elapsed := formatElapsed(p.now().Sub(start))
+
+	p.mu.Lock()
+	p.prefetched++
+	i := p.prefetched
+	p.mu.Unlock()
+
+	if err != nil {
+		p.out.Printf("%s: prefetch (%d/%d) failed after %s", pr, i, n, elapsed)
+	} else {
+		p.out.Printf("%s: prefetched (%d/%d) in %s", pr, i, n, elapsed)
+	}
+	return err
+}
+
+// solve runs the solver until it's done or ctx is, reporting how many
+// attempts it took and how long.
+func (p *progress) solve(ctx context.Context, solver gps.Solver) (gps.Solution, error) {
+	if p == nil {
+		return solver.Solve(ctx)
+	}
+
+	defer p.phase("solving")()
+	start := p.now()
+	solution, err := solver.Solve(ctx)
+	elapsed := formatElapsed(p.now().Sub(start))
+	if err != nil {
+		p.out.Printf("solving ... failed after %s", elapsed)
+	} else {
+		p.out.Printf("solving ... %d attempts, %s", solution.Attempts(), elapsed)
+	}
+	return solution, err
+}
+
+// summarize reports the total time spent in each phase, and overall.
+func (p *progress) summarize() {
+	if p == nil {
+		return
+	}
+
+	p.out.Println("Time spent:")
+	for _, name := range p.phases {
+		p.out.Printf("  %-10s %s", name, formatElapsed(p.spent[name]))
+	}
+	p.out.Printf("  %-10s %s", "total", formatElapsed(p.now().Sub(p.start)))
+}
+
+// sourcesToFetch returns the identifiers of the projects in l and the
+// constraints of m, without duplicates, in that order.
+func sourcesToFetch(m gps.ProjectConstraints, l *dep.Lock) []gps.ProjectIdentifier {
+	var ids []gps.ProjectIdentifier
+	seen := make(map[gps.ProjectRoot]bool)
+	if l != nil {
+		for _, lp := range l.Projects() {
+			id := lp.Ident()
+			if !seen[id.ProjectRoot] {
+				seen[id.ProjectRoot] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	var roots []string
+	for pr := range m {
+		if !seen[pr] {
+			roots = append(roots, string(pr))
+		}
+	}
+	sort.Strings(roots)
+	for _, pr := range roots {
+		ids = append(ids, gps.ProjectIdentifier{
+			ProjectRoot: gps.ProjectRoot(pr),
+			Source:      m[gps.ProjectRoot(pr)].Source,
+		})
+	}
+	return ids
+}
+
+func formatElapsed(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
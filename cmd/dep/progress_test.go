@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(log.New(&buf, "", 0))
+
+	// Every reading of the clock advances it by half a second.
+	clock := time.Unix(0, 0)
+	p.now = func() time.Time {
+		clock = clock.Add(500 * time.Millisecond)
+		return clock
+	}
+	p.start = p.now()
+
+	done := p.phase("fetching")
+	p.step(1, 2, "fetching", "github.com/sdboyer/deptest", func() error { return nil })
+	p.step(2, 2, "fetching", "github.com/sdboyer/deptestdos", func() error { return errors.New("no such repo") })
+	done()
+
+	done = p.phase("writing")
+	p.export(2, "github.com/sdboyer/deptest", func() error { return nil })
+	p.export(2, "github.com/sdboyer/deptestdos", func() error { return errors.New("no such revision") })
+	done()
+	p.summarize()
+
+	want := `(1/2) fetching github.com/sdboyer/deptest ... 0.5s
+(2/2) fetching github.com/sdboyer/deptestdos ... failed after 0.5s
+github.com/sdboyer/deptest: exported (1/2) in 0.5s
+github.com/sdboyer/deptestdos: export (2/2) failed after 0.5s
+Time spent:
+  fetching   2.5s
+  writing    2.5s
+  total      6.5s
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("unexpected progress output:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, want)
+	}
+}
+
+func TestNilProgress(t *testing.T) {
+	var p *progress
+	var ran bool
+	p.phase("fetching")()
+	if err := p.step(1, 1, "fetching", "github.com/sdboyer/deptest", func() error { ran = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatal("expected a nil progress to still run the step")
+	}
+	p.summarize()
+}
+
+func TestSourcesToFetch(t *testing.T) {
+	m := gps.ProjectConstraints{
+		"github.com/sdboyer/deptesttres": {Source: "github.com/carolynvs/deptesttres"},
+		"github.com/sdboyer/deptest":     {},
+		"github.com/sdboyer/deptestdos":  {},
+	}
+	l := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"), nil),
+	}}
+
+	want := []gps.ProjectIdentifier{
+		{ProjectRoot: "github.com/sdboyer/deptestdos"},
+		{ProjectRoot: "github.com/sdboyer/deptest"},
+		{ProjectRoot: "github.com/sdboyer/deptesttres", Source: "github.com/carolynvs/deptesttres"},
+	}
+	if got := sourcesToFetch(m, l); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := sourcesToFetch(m, nil); len(got) != 3 {
+		t.Fatalf("expected every constrained project without a lock, got %v", got)
+	}
+}
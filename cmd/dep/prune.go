@@ -7,29 +7,46 @@ package main
 import (
 	"bytes"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/paths"
 	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/pkg/errors"
 )
 
 const pruneShortHelp = `Prune the vendor tree of unused packages`
 const pruneLongHelp = `
-Prune is used to remove unused packages from your vendor tree.
+Prune is used to remove unused packages from your vendor tree. The packages
+kept are those reachable from the project's own through their imports, under
+any build tags; the ignored packages of Gopkg.toml aren't followed, nor are the
+imports of the project's tests if it sets tests = false, and its required ones
+are kept even though nothing imports them. The dirs above kept
+packages are kept as well, as are legal files, such as LICENSE, COPYING, NOTICE
+and PATENTS, wherever they are, so that vendor/ can be redistributed.
+
+Prune reports how many files, dirs and bytes it removed from each project.
+Pass -dry-run to list what would be removed, by project, without touching
+vendor/.
+
+If Gopkg.toml has a [prune] section, each project is pruned with the options
+it gives for it instead, as dep ensure does when it writes vendor/.
 
 STABILITY NOTICE: this command creates problems for vendor/ verification. As
 such, it may be removed and/or moved out into a separate project later on.
 `
 
 type pruneCommand struct {
+	dryRun bool
 }
 
 func (cmd *pruneCommand) Name() string      { return "prune" }
@@ -39,6 +56,7 @@ func (cmd *pruneCommand) LongHelp() string  { return pruneLongHelp }
 func (cmd *pruneCommand) Hidden() bool      { return false }
 
 func (cmd *pruneCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.dryRun, "dry-run", false, "only list what would be removed from vendor/")
 }
 
 func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -52,11 +70,12 @@ func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
 	defer sm.Release()
 
 	// While the network churns on ListVersions() requests, statically analyze
 	// code from the current project.
-	ptree, err := pkgtree.ListPackages(p.ResolvedAbsRoot, string(p.ImportRoot))
+	ptree, err := p.ParseRootPackageTree()
 	if err != nil {
 		return errors.Wrap(err, "analysis of local packages failed: %v")
 	}
@@ -86,11 +105,14 @@ func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
 	if ctx.Verbose {
 		pruneLogger = ctx.Err
 	}
-	return pruneProject(p, sm, pruneLogger)
+	return pruneProject(p, ptree, sm, ctx.Out, cmd.dryRun, pruneLogger)
 }
 
-// pruneProject removes unused packages from a project.
-func pruneProject(p *dep.Project, sm gps.SourceManager, logger *log.Logger) error {
+// pruneProject removes unused packages from a project, or prunes it with the
+// prune options of its manifest, if it has any, then summarizes what it
+// removed to out. If dryRun is true, what would be removed is listed instead,
+// and vendor/ is left alone.
+func pruneProject(p *dep.Project, ptree pkgtree.PackageTree, sm gps.SourceManager, out *log.Logger, dryRun bool, logger *log.Logger) error {
 	td, err := ioutil.TempDir(os.TempDir(), "dep")
 	if err != nil {
 		return errors.Wrap(err, "error while creating temp dir for writing manifest/lock/vendor")
@@ -101,33 +123,51 @@ func pruneProject(p *dep.Project, sm gps.SourceManager, logger *log.Logger) erro
 		return err
 	}
 
-	var toKeep []string
-	for _, project := range p.Lock.Projects() {
-		projectRoot := string(project.Ident().ProjectRoot)
-		for _, pkg := range project.Packages() {
-			toKeep = append(toKeep, filepath.Join(projectRoot, pkg))
-		}
+	before, err := snapshotVendor(td)
+	if err != nil {
+		return err
 	}
 
-	toDelete, err := calculatePrune(td, toKeep, logger)
+	reached, err := reachablePackages(p, ptree, td)
 	if err != nil {
 		return err
 	}
 
-	if logger != nil {
-		if len(toDelete) > 0 {
-			logger.Println("Calculated the following directories to prune:")
-			for _, d := range toDelete {
-				logger.Printf("  %s\n", d)
+	if po := p.Manifest.PruneOptions; po.DefaultOptions != 0 || len(po.PerProjectOptions) != 0 {
+		if err := pruneWithOptions(td, p, reached, po, logger); err != nil {
+			return err
+		}
+	} else {
+		toDelete, err := calculatePrune(td, packagesToKeep(p, reached), logger)
+		if err != nil {
+			return err
+		}
+
+		if logger != nil {
+			if len(toDelete) > 0 {
+				logger.Println("Calculated the following directories to prune:")
+				for _, d := range toDelete {
+					logger.Printf("  %s\n", d)
+				}
+			} else {
+				logger.Println("No directories found to prune")
 			}
-		} else {
-			logger.Println("No directories found to prune")
+		}
+
+		if err := deleteDirs(toDelete); err != nil {
+			return err
 		}
 	}
 
-	if err := deleteDirs(toDelete); err != nil {
+	after, err := snapshotVendor(td)
+	if err != nil {
 		return err
 	}
+	pruned := prunedFrom(p.Lock, before, after)
+	if dryRun {
+		printPruneSummary(out, pruned, true)
+		return nil
+	}
 
 	vpath := filepath.Join(p.AbsRoot, "vendor")
 	vendorbak := vpath + ".orig"
@@ -155,6 +195,7 @@ func pruneProject(p *dep.Project, sm gps.SourceManager, logger *log.Logger) erro
 
 	os.RemoveAll(vendorbak)
 
+	printPruneSummary(out, pruned, false)
 	return nil
 
 fail:
@@ -162,11 +203,139 @@ fail:
 	return failerr
 }
 
+// pruneWithOptions prunes each of the projects of p written to vendorDir with
+// the options po gives for it, keeping the packages reached.
+func pruneWithOptions(vendorDir string, p *dep.Project, reached map[gps.ProjectRoot][]string, po gps.CascadingPruneOptions, logger *log.Logger) error {
+	for _, lp := range p.Lock.Projects() {
+		pr := lp.Ident().ProjectRoot
+		options := po.PruneOptionsFor(pr)
+		if options == 0 {
+			continue
+		}
+		if logger != nil {
+			logger.Printf("Pruning %s (%s):", pr, options)
+		}
+		keep := gps.NewLockedProject(lp.Ident(), lp.Version(), projectPackagesToKeep(lp, reached))
+		if err := gps.PruneProject(filepath.Join(vendorDir, filepath.FromSlash(string(pr))), keep, options, logger); err != nil {
+			return errors.Wrapf(err, "error while pruning %s", pr)
+		}
+	}
+	return nil
+}
+
+// reachablePackages finds the packages of the locked projects of p, written
+// to vendorDir, which the packages of the project, ptree, reach through their
+// imports, and the required packages of the manifest, along with those they
+// reach. The packages are given by project root, relative to it. All the
+// files of a package are read, whatever their build tags, so that imports
+// for other platforms are followed; ignored packages aren't.
+func reachablePackages(p *dep.Project, ptree pkgtree.PackageTree, vendorDir string) (map[gps.ProjectRoot][]string, error) {
+	ignored := p.Manifest.IgnoredPackages()
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.ExcludeTests, false, ignored)
+	queue := append(rm.FlattenFn(paths.IsStandardImportPath), p.Manifest.Required...)
+
+	trees := make(map[gps.ProjectRoot]*pkgtree.PackageTree)
+	seen := make(map[string]bool)
+	reached := make(map[gps.ProjectRoot][]string)
+	for len(queue) > 0 {
+		ip := queue[0]
+		queue = queue[1:]
+		if seen[ip] || pkgtree.IsIgnored(ip, ignored) {
+			continue
+		}
+		seen[ip] = true
+
+		pr, has := lockedProjectRoot(p.Lock, ip)
+		if !has {
+			continue
+		}
+		tree, has := trees[pr]
+		if !has {
+			t, err := pkgtree.ListPackages(filepath.Join(vendorDir, filepath.FromSlash(string(pr))), string(pr))
+			if err != nil {
+				return nil, errors.Wrapf(err, "analysis of the packages of %s failed", pr)
+			}
+			tree = &t
+			trees[pr] = tree
+		}
+
+		poe, has := tree.Packages[ip]
+		if !has || poe.Err != nil {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(ip, string(pr)), "/")
+		if rel == "" {
+			rel = "."
+		}
+		reached[pr] = append(reached[pr], rel)
+		for _, imp := range poe.P.Imports {
+			if !paths.IsStandardImportPath(imp) {
+				queue = append(queue, imp)
+			}
+		}
+	}
+
+	for _, pkgs := range reached {
+		sort.Strings(pkgs)
+	}
+	return reached, nil
+}
+
+// lockedProjectRoot returns the root of the project of l the package ip is
+// in, the longest if the roots of several are prefixes of it.
+func lockedProjectRoot(l *dep.Lock, ip string) (gps.ProjectRoot, bool) {
+	var root gps.ProjectRoot
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if isPathPrefix(ip, string(pr)) && len(pr) > len(root) {
+			root = pr
+		}
+	}
+	return root, root != ""
+}
+
+// packagesToKeep returns the dirs, relative to vendor/, of the packages of the
+// locked projects of p which are to be kept.
+func packagesToKeep(p *dep.Project, reached map[gps.ProjectRoot][]string) []string {
+	var toKeep []string
+	for _, project := range p.Lock.Projects() {
+		projectRoot := string(project.Ident().ProjectRoot)
+		for _, pkg := range projectPackagesToKeep(project, reached) {
+			toKeep = append(toKeep, filepath.Join(projectRoot, filepath.FromSlash(pkg)))
+		}
+	}
+	return toKeep
+}
+
+// projectPackagesToKeep returns the packages of the locked project lp which
+// are to be kept, relative to its root: those the lock lists, and those which
+// were reached, without duplicates.
+func projectPackagesToKeep(lp gps.LockedProject, reached map[gps.ProjectRoot][]string) []string {
+	var toKeep []string
+	seen := make(map[string]bool)
+	for _, pkgs := range [][]string{lp.Packages(), reached[lp.Ident().ProjectRoot]} {
+		for _, pkg := range pkgs {
+			if !seen[pkg] {
+				seen[pkg] = true
+				toKeep = append(toKeep, pkg)
+			}
+		}
+	}
+	return toKeep
+}
+
+// calculatePrune returns the dirs beneath vendorDir which are to be deleted:
+// those which are neither the dir of a package to keep, nor above one.
 func calculatePrune(vendorDir string, keep []string, logger *log.Logger) ([]string, error) {
 	if logger != nil {
 		logger.Println("Calculating prune. Checking the following packages:")
 	}
-	sort.Strings(keep)
+	keepDirs := make(map[string]bool)
+	for _, dir := range keep {
+		for ; dir != "." && !keepDirs[dir]; dir = filepath.Dir(dir) {
+			keepDirs[dir] = true
+		}
+	}
 	toDelete := []string{}
 	err := filepath.Walk(vendorDir, func(path string, info os.FileInfo, err error) error {
 		if _, err := os.Lstat(path); err != nil {
@@ -183,10 +352,7 @@ func calculatePrune(vendorDir string, keep []string, logger *log.Logger) ([]stri
 		if logger != nil {
 			logger.Printf("  %s", name)
 		}
-		i := sort.Search(len(keep), func(i int) bool {
-			return name <= keep[i]
-		})
-		if i >= len(keep) || !strings.HasPrefix(keep[i], name) {
+		if !keepDirs[name] {
 			toDelete = append(toDelete, path)
 		}
 		return nil
@@ -194,17 +360,171 @@ func calculatePrune(vendorDir string, keep []string, logger *log.Logger) ([]stri
 	return toDelete, err
 }
 
+// deleteDirs deletes the dirs toDelete, each of which is to have its subdirs
+// deleted as well, all but the legal files in them; see gps.IsLegalFile. The
+// dirs holding those are kept, so that they stay in place.
 func deleteDirs(toDelete []string) error {
 	// sort by length so we delete sub dirs first
 	sort.Sort(byLen(toDelete))
 	for _, path := range toDelete {
-		if err := os.RemoveAll(path); err != nil {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
 			return err
 		}
+		var kept bool
+		for _, info := range infos {
+			// Subdirs which are left hold legal files.
+			if info.IsDir() || gps.IsLegalFile(info.Name()) {
+				kept = true
+				continue
+			}
+			if err := os.Remove(filepath.Join(path, info.Name())); err != nil {
+				return err
+			}
+		}
+		if !kept {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// vendorSnapshot holds the files beneath a vendor dir, with their sizes, and
+// its dirs, relative to it with forward slashes.
+type vendorSnapshot struct {
+	files map[string]int64
+	dirs  map[string]bool
+}
+
+func snapshotVendor(vendorDir string) (vendorSnapshot, error) {
+	vs := vendorSnapshot{
+		files: make(map[string]int64),
+		dirs:  make(map[string]bool),
+	}
+	err := filepath.Walk(vendorDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(vendorDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case rel == ".":
+		case info.IsDir():
+			vs.dirs[rel] = true
+		default:
+			vs.files[rel] = info.Size()
+		}
+		return nil
+	})
+	return vs, err
+}
+
+// prunedFrom returns, by project root, what is in before but not in after,
+// the snapshots of a vendor dir holding the projects of l, from before and
+// after it was pruned.
+func prunedFrom(l *dep.Lock, before, after vendorSnapshot) map[gps.ProjectRoot]gps.PruneResult {
+	pruned := make(map[gps.ProjectRoot]gps.PruneResult)
+	add := func(path string, dir bool, size int64) {
+		pr, has := lockedProjectRoot(l, path)
+		if !has || path == string(pr) {
+			return
+		}
+		rel := strings.TrimPrefix(path, string(pr)+"/")
+		r := pruned[pr]
+		if dir {
+			r.Dirs = append(r.Dirs, rel)
+		} else {
+			r.Files = append(r.Files, rel)
+			r.Bytes += size
+		}
+		pruned[pr] = r
+	}
+
+	for f, size := range before.files {
+		if _, has := after.files[f]; !has {
+			add(f, false, size)
+		}
+	}
+	for d := range before.dirs {
+		if !after.dirs[d] {
+			add(d, true, 0)
+		}
+	}
+
+	for pr, r := range pruned {
+		sort.Strings(r.Files)
+		sort.Strings(r.Dirs)
+		pruned[pr] = r
+	}
+	return pruned
+}
+
+// printPruneSummary summarizes to out what was pruned from each project in
+// vendor/, sorted by project root. If dryRun is true, it was only calculated,
+// and each file and dir is listed first.
+func printPruneSummary(out *log.Logger, pruned map[gps.ProjectRoot]gps.PruneResult, dryRun bool) {
+	var roots []string
+	for pr, r := range pruned {
+		if len(r.Files) > 0 || len(r.Dirs) > 0 {
+			roots = append(roots, string(pr))
+		}
+	}
+	sort.Strings(roots)
+
+	if len(roots) == 0 {
+		if dryRun {
+			out.Println("Nothing would be pruned from vendor/")
+		} else {
+			out.Println("Nothing was pruned from vendor/")
+		}
+		return
+	}
+
+	if dryRun {
+		out.Println("Would have pruned the following from vendor/:")
+		for _, pr := range roots {
+			r := pruned[gps.ProjectRoot(pr)]
+			paths := append([]string(nil), r.Files...)
+			for _, d := range r.Dirs {
+				paths = append(paths, d+"/")
+			}
+			sort.Strings(paths)
+
+			out.Printf("\n%s", pr)
+			for _, path := range paths {
+				out.Printf("  %s", path)
+			}
+		}
+		out.Println()
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	var files, dirs int
+	var size int64
+	for _, pr := range roots {
+		r := pruned[gps.ProjectRoot(pr)]
+		fmt.Fprintf(w, "  %s\t%d files\t%d dirs\t%d bytes\n", pr, len(r.Files), len(r.Dirs), r.Bytes)
+		files += len(r.Files)
+		dirs += len(r.Dirs)
+		size += r.Bytes
+	}
+	fmt.Fprintf(w, "  %s\t%d files\t%d dirs\t%d bytes\n", "total", files, dirs, size)
+	w.Flush()
+
+	if dryRun {
+		out.Println("Would have reclaimed:")
+	} else {
+		out.Println("Pruned from vendor/:")
+	}
+	out.Print(buf.String())
+}
+
 type byLen []string
 
 func (a byLen) Len() int           { return len(a) }
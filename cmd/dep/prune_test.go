@@ -5,11 +5,16 @@
 package main
 
 import (
+	"bytes"
+	"log"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
 
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -21,6 +26,8 @@ func TestCalculatePrune(t *testing.T) {
 	h.TempDir(vendorDir)
 	h.TempDir(filepath.Join(vendorDir, "github.com/keep/pkg/sub"))
 	h.TempDir(filepath.Join(vendorDir, "github.com/prune/pkg/sub"))
+	// Shares a prefix with a kept package, but isn't above it.
+	h.TempDir(filepath.Join(vendorDir, "github.com/keep/pkg-other"))
 
 	toKeep := []string{
 		filepath.FromSlash("github.com/keep/pkg"),
@@ -35,6 +42,7 @@ func TestCalculatePrune(t *testing.T) {
 	sort.Sort(byLen(got))
 
 	want := []string{
+		h.Path(filepath.Join(vendorDir, "github.com/keep/pkg-other")),
 		h.Path(filepath.Join(vendorDir, "github.com/prune/pkg/sub")),
 		h.Path(filepath.Join(vendorDir, "github.com/prune/pkg")),
 		h.Path(filepath.Join(vendorDir, "github.com/prune")),
@@ -44,3 +52,224 @@ func TestCalculatePrune(t *testing.T) {
 		t.Fatalf("calculated prune paths are not as expected.\n(WNT) %s\n(GOT) %s", want, got)
 	}
 }
+
+func TestDeleteDirsKeepsLegalFiles(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("vendor/github.com/prune/pkg/pkg.go", "package pkg")
+	h.TempFile("vendor/github.com/prune/pkg/LICENSE.md", "MIT License")
+	h.TempFile("vendor/github.com/prune/pkg/sub/sub.go", "package sub")
+	h.TempFile("vendor/github.com/prune/pkg/sub/deep/COPYING", "GPL")
+	h.TempFile("vendor/github.com/prune/pkg/other/other.go", "package other")
+
+	vendor := h.Path("vendor")
+	path := func(p string) string { return filepath.Join(vendor, filepath.FromSlash(p)) }
+	toDelete := []string{
+		path("github.com/prune/pkg"),
+		path("github.com/prune/pkg/sub"),
+		path("github.com/prune/pkg/sub/deep"),
+		path("github.com/prune/pkg/other"),
+	}
+	if err := deleteDirs(toDelete); err != nil {
+		t.Fatal(err)
+	}
+
+	h.MustExist(path("github.com/prune/pkg/LICENSE.md"))
+	h.MustExist(path("github.com/prune/pkg/sub/deep/COPYING"))
+	h.MustNotExist(path("github.com/prune/pkg/pkg.go"))
+	h.MustNotExist(path("github.com/prune/pkg/sub/sub.go"))
+	h.MustNotExist(path("github.com/prune/pkg/other"))
+}
+
+func TestPackagesToKeep(t *testing.T) {
+	p := &dep.Project{
+		Manifest: &dep.Manifest{},
+		Lock: &dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/keep/pkg"}, gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{".", "sub"}),
+			// Locked before stringer was required.
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "golang.org/x/tools"}, gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"), []string{"go/ast/astutil"}),
+		}},
+	}
+	reached := map[gps.ProjectRoot][]string{
+		"github.com/keep/pkg": {"."},
+		"golang.org/x/tools":  {"cmd/stringer", "go/ast/astutil"},
+	}
+
+	got := packagesToKeep(p, reached)
+	want := []string{
+		filepath.FromSlash("github.com/keep/pkg"),
+		filepath.FromSlash("github.com/keep/pkg/sub"),
+		filepath.FromSlash("golang.org/x/tools/go/ast/astutil"),
+		filepath.FromSlash("golang.org/x/tools/cmd/stringer"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected to keep %v, got %v", want, got)
+	}
+}
+
+func TestReachablePackages(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("vendor")
+	for path, contents := range map[string]string{
+		// The root of tools isn't a package, and only tests import unused.
+		"golang.org/x/tools/LICENSE":                       "license",
+		"golang.org/x/tools/go/ast/astutil/util.go":        "package astutil\n\nimport _ \"golang.org/x/tools/internal/fastwalk\"\n",
+		"golang.org/x/tools/internal/fastwalk/walk.go":     "package fastwalk\n",
+		"golang.org/x/tools/internal/fastwalk/walk_bsd.go": "// +build freebsd\n\npackage fastwalk\n\nimport _ \"github.com/foo/bsd\"\n",
+		"golang.org/x/tools/cmd/stringer/stringer.go":      "package main\n",
+		"golang.org/x/tools/unused/unused.go":              "package unused\n",
+		"github.com/foo/bsd/bsd.go":                        "package bsd\n\nimport _ \"github.com/foo/bsd/ignored\"\n",
+		"github.com/foo/bsd/ignored/ignored.go":            "package ignored\n",
+	} {
+		h.TempFile(filepath.Join("vendor", filepath.FromSlash(path)), contents)
+	}
+
+	p := &dep.Project{
+		Manifest: &dep.Manifest{
+			Ignored:  []string{"github.com/foo/bsd/ignored"},
+			Required: []string{"golang.org/x/tools/cmd/stringer"},
+		},
+		Lock: &dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "golang.org/x/tools"}, gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"), []string{"go/ast/astutil"}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bsd"}, gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		}},
+	}
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "github.com/golang/notexist",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"github.com/golang/notexist": {P: pkgtree.Package{
+				ImportPath:  "github.com/golang/notexist",
+				Imports:     []string{"fmt", "golang.org/x/tools/go/ast/astutil"},
+				TestImports: []string{"golang.org/x/tools/unused"},
+			}},
+		},
+	}
+
+	got, err := reachablePackages(p, ptree, h.Path("vendor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[gps.ProjectRoot][]string{
+		"golang.org/x/tools": {"cmd/stringer", "go/ast/astutil", "internal/fastwalk", "unused"},
+		"github.com/foo/bsd": {"."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected to reach %v, got %v", want, got)
+	}
+
+	// The packages only the tests import are pruned with them, as ensure
+	// leaves them out of the solve.
+	p.Manifest.ExcludeTests = true
+	got, err = reachablePackages(p, ptree, h.Path("vendor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want["golang.org/x/tools"] = []string{"cmd/stringer", "go/ast/astutil", "internal/fastwalk"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected to reach %v excluding tests, got %v", want, got)
+	}
+}
+
+func TestPrunedFrom(t *testing.T) {
+	l := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/keep/pkg"}, gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/prune/pkg"}, gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"), []string{"."}),
+	}}
+	before := vendorSnapshot{
+		files: map[string]int64{
+			"github.com/keep/pkg/pkg.go":        10,
+			"github.com/prune/pkg/pkg.go":       10,
+			"github.com/prune/pkg/sub/sub.go":   20,
+			"github.com/prune/pkg/sub/doc.md":   5,
+			"github.com/prune/pkg/pkg_test.go":  30,
+			"github.com/prune/pkg/README.md":    40,
+			"github.com/prune/pkg/LICENSE":      50,
+			"github.com/prune/pkg/docs/api.txt": 60,
+		},
+		dirs: map[string]bool{
+			"github.com":                true,
+			"github.com/keep":           true,
+			"github.com/keep/pkg":       true,
+			"github.com/prune":          true,
+			"github.com/prune/pkg":      true,
+			"github.com/prune/pkg/sub":  true,
+			"github.com/prune/pkg/docs": true,
+		},
+	}
+	after := vendorSnapshot{
+		files: map[string]int64{
+			"github.com/keep/pkg/pkg.go":   10,
+			"github.com/prune/pkg/pkg.go":  10,
+			"github.com/prune/pkg/LICENSE": 50,
+		},
+		dirs: map[string]bool{
+			"github.com":           true,
+			"github.com/keep":      true,
+			"github.com/keep/pkg":  true,
+			"github.com/prune":     true,
+			"github.com/prune/pkg": true,
+		},
+	}
+
+	got := prunedFrom(l, before, after)
+	want := map[gps.ProjectRoot]gps.PruneResult{
+		"github.com/prune/pkg": {
+			Files: []string{"README.md", "docs/api.txt", "pkg_test.go", "sub/doc.md", "sub/sub.go"},
+			Dirs:  []string{"docs", "sub"},
+			Bytes: 155,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v to be pruned, got %v", want, got)
+	}
+}
+
+func TestPrintPruneSummary(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	pruned := map[gps.ProjectRoot]gps.PruneResult{
+		"github.com/prune/pkg": {
+			Files: []string{"README.md", "docs/api.txt", "pkg_test.go"},
+			Dirs:  []string{"docs"},
+			Bytes: 130,
+		},
+		"github.com/other/project": {
+			Files: []string{"other_test.go"},
+			Bytes: 2048,
+		},
+		"github.com/untouched/project": {},
+	}
+
+	for _, tc := range []struct {
+		dryRun bool
+		golden string
+	}{
+		{true, "prune/summary_dry_run.txt"},
+		{false, "prune/summary.txt"},
+	} {
+		var buf bytes.Buffer
+		printPruneSummary(log.New(&buf, "", 0), pruned, tc.dryRun)
+
+		got := buf.String()
+		want := h.GetTestFileString(tc.golden)
+		if got != want {
+			if *test.UpdateGolden {
+				if err := h.WriteTestFile(tc.golden, got); err != nil {
+					t.Fatalf("Unable to write updated golden file %s: %s", tc.golden, err)
+				}
+			} else {
+				t.Errorf("unexpected output:\n(GOT):\n%s\n(WNT):\n%s", got, want)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	printPruneSummary(log.New(&buf, "", 0), nil, true)
+	if got, want := buf.String(), "Nothing would be pruned from vendor/\n"; got != want {
+		t.Errorf("unexpected output with nothing pruned: %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+const removeShortHelp = `Remove dependencies from the project`
+const removeLongHelp = `
+Remove drops each of the projects given from the project's dependencies. It
+deletes the constraint or override on the project from Gopkg.toml, as well as
+its packages in the required list, solves the dependencies anew, and writes
+Gopkg.lock and vendor/ without the project, or any other which was only needed
+by it.
+
+Remove fails if the project still imports packages of any of the projects
+given, listing the files which import them. Pass -force to remove their
+constraints anyway, which only warns about the imports; the projects then stay
+in Gopkg.lock and vendor/, unconstrained, for as long as they're imported.
+`
+
+type removeCommand struct {
+	force bool
+}
+
+func (cmd *removeCommand) Name() string      { return "remove" }
+func (cmd *removeCommand) Args() string      { return "<import path> [<import path> ...]" }
+func (cmd *removeCommand) ShortHelp() string { return removeShortHelp }
+func (cmd *removeCommand) LongHelp() string  { return removeLongHelp }
+func (cmd *removeCommand) Hidden() bool      { return false }
+
+func (cmd *removeCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.force, "force", false, "remove the constraints on projects which are still imported")
+}
+
+func (cmd *removeCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) == 0 {
+		return errors.New("must specify at least one project to remove")
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+
+	roots, err := dependencyRoots(p, args)
+	if err != nil {
+		return err
+	}
+
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+
+	ignored := p.Manifest.IgnoredPackages()
+	for _, pr := range roots {
+		files := importingFiles(p, ptree, ignored, pr)
+		if len(files) == 0 {
+			continue
+		}
+		if !cmd.force {
+			return errors.Errorf("%s is still imported by:\n\t%s\nremove the imports first, or pass -force to remove its constraint anyway", pr, strings.Join(files, "\n\t"))
+		}
+		ctx.Err.Printf("Warning: %s is still imported by:\n\t%s\nIts constraint is removed, but it stays in %s.\n", pr, strings.Join(files, "\n\t"), dep.LockName)
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
+	defer sm.Release()
+
+	drop := func(m *dep.Manifest) { removeFromManifest(m, roots) }
+	drop(p.Manifest)
+
+	params := p.MakeParams()
+	params.RootPackageTree = ptree
+	if ctx.Verbose {
+		params.TraceLogger = ctx.Err
+	}
+
+	solver, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "prepare solver")
+	}
+	solution, err := solver.Solve(ctx.Context)
+	if err != nil {
+		handleAllTheFailuresOfTheWorld(err)
+		printUnresolvedChains(ctx, sm, p, ptree, err)
+		return errors.Wrap(err, "remove Solve()")
+	}
+
+	newLock := dep.LockFromSolution(solution)
+	newLock.SetPruneOptions(p.Manifest.PruneOptions)
+	sw, err := dep.NewSafeWriter(nil, p.Lock, newLock, dep.VendorOnChanged)
+	if err != nil {
+		return err
+	}
+
+	// The manifest is only edited once the lock and vendor/ are written, as
+	// ensure -add does, so that it's left as it was should that fail.
+	ensure := &ensureCommand{exportWorkers: runtime.NumCPU(), prefetchWorkers: defaultPrefetchWorkers}
+	if err := ensure.write(ctx, sw, p, sm, false); err != nil {
+		return errors.Wrap(err, "grouped write of lock and vendor")
+	}
+
+	mpath := filepath.Join(p.AbsRoot, dep.ManifestName)
+	orig, err := ioutil.ReadFile(mpath)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s failed", dep.ManifestName)
+	}
+	edited, err := dep.EditManifest(orig, drop)
+	if err != nil {
+		return errors.Wrapf(err, "editing %s failed", dep.ManifestName)
+	}
+	if err := ioutil.WriteFile(mpath, edited, 0666); err != nil {
+		return errors.Wrapf(err, "writing to %s failed", dep.ManifestName)
+	}
+
+	printLockChanges(ctx.Out, p.Lock, newLock)
+	return nil
+}
+
+// dependencyRoots returns the roots of the projects which the import paths
+// args are in, in order, which must each be constrained in the manifest of p
+// or be in its lock.
+func dependencyRoots(p *dep.Project, args []string) ([]gps.ProjectRoot, error) {
+	known := make(map[gps.ProjectRoot]bool)
+	for pr := range p.Manifest.Constraints {
+		known[pr] = true
+	}
+	for pr := range p.Manifest.Ovr {
+		known[pr] = true
+	}
+	if p.Lock != nil {
+		for _, lp := range p.Lock.Projects() {
+			known[lp.Ident().ProjectRoot] = true
+		}
+	}
+
+	var roots []gps.ProjectRoot
+	seen := make(map[gps.ProjectRoot]bool)
+	for _, arg := range args {
+		var root gps.ProjectRoot
+		for pr := range known {
+			if len(pr) > len(root) && isPathPrefix(arg, string(pr)) {
+				root = pr
+			}
+		}
+		if root == "" {
+			return nil, errors.Errorf("%s is not a dependency of the project", arg)
+		}
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
+
+// removeFromManifest deletes the constraints and overrides on the projects
+// roots from m, and its required packages in them.
+func removeFromManifest(m *dep.Manifest, roots []gps.ProjectRoot) {
+	in := func(ip string) bool {
+		for _, pr := range roots {
+			if isPathPrefix(ip, string(pr)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pr := range roots {
+		delete(m.Constraints, pr)
+		delete(m.Ovr, pr)
+	}
+
+	var required []string
+	for _, ip := range m.Required {
+		if !in(ip) {
+			required = append(required, ip)
+		}
+	}
+	m.Required = required
+}
+
+// importingFiles returns the files of the root project, by their paths
+// relative to its root and sorted, which import packages of the project pr.
+// The files of ignored packages, and test files if the manifest excludes tests,
+// are left out, as they don't make pr a dependency.
+func importingFiles(p *dep.Project, ptree pkgtree.PackageTree, ignored map[string]bool, pr gps.ProjectRoot) []string {
+	var files []string
+	for ip, poe := range ptree.Packages {
+		if poe.Err != nil || pkgtree.IsIgnored(ip, ignored) {
+			continue
+		}
+		tests := !p.Manifest.ExcludeTests && importsProject(poe.P.TestImports, pr)
+		if !importsProject(poe.P.Imports, pr) && !tests {
+			continue
+		}
+
+		dir := filepath.Join(p.ResolvedAbsRoot, filepath.FromSlash(strings.TrimPrefix(ip, string(p.ImportRoot))))
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		for _, fi := range fis {
+			if fi.IsDir() || filepath.Ext(fi.Name()) != ".go" {
+				continue
+			}
+			if p.Manifest.ExcludeTests && strings.HasSuffix(fi.Name(), "_test.go") {
+				continue
+			}
+			path := filepath.Join(dir, fi.Name())
+			f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+			if err != nil {
+				continue
+			}
+			for _, is := range f.Imports {
+				if imp, err := strconv.Unquote(is.Path.Value); err == nil && isPathPrefix(imp, string(pr)) {
+					rel, _ := filepath.Rel(p.ResolvedAbsRoot, path)
+					files = append(files, filepath.ToSlash(rel))
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// importsProject reports whether any of imports is a package of the project
+// pr.
+func importsProject(imports []string, pr gps.ProjectRoot) bool {
+	for _, imp := range imports {
+		if isPathPrefix(imp, string(pr)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestDependencyRoots(t *testing.T) {
+	p := &dep.Project{
+		Manifest: &dep.Manifest{
+			Constraints: gps.ProjectConstraints{"github.com/foo/bar": {}},
+			Ovr:         gps.ProjectConstraints{"github.com/foo/baz": {}},
+		},
+		Lock: &dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/qux"}, gps.Revision("rev"), nil),
+		}},
+	}
+
+	roots, err := dependencyRoots(p, []string{"github.com/foo/qux/sub", "github.com/foo/bar", "github.com/foo/baz", "github.com/foo/qux"})
+	if err != nil {
+		t.Fatalf("Unexpected error finding the roots: %s", err)
+	}
+	want := []gps.ProjectRoot{"github.com/foo/qux", "github.com/foo/bar", "github.com/foo/baz"}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("unexpected roots:\n\t(GOT): %v\n\t(WNT): %v", roots, want)
+	}
+
+	for _, arg := range []string{"github.com/foo/other", "github.com/foo"} {
+		if _, err := dependencyRoots(p, []string{"github.com/foo/bar", arg}); err == nil {
+			t.Errorf("Expected an error removing %s, which isn't a dependency", arg)
+		}
+	}
+}
+
+func TestRemoveFromManifest(t *testing.T) {
+	m := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/foo/bar": {Constraint: gps.NewBranch("master")},
+			"github.com/foo/baz": {Constraint: gps.NewBranch("master")},
+		},
+		Ovr:      gps.ProjectConstraints{"github.com/foo/bar": {Constraint: gps.NewBranch("dev")}},
+		Required: []string{"github.com/foo/bar/cmd", "github.com/foo/barn", "github.com/foo/baz"},
+	}
+
+	removeFromManifest(m, []gps.ProjectRoot{"github.com/foo/bar"})
+
+	if _, has := m.Constraints["github.com/foo/bar"]; has {
+		t.Error("Expected the constraint on github.com/foo/bar to be removed")
+	}
+	if _, has := m.Constraints["github.com/foo/baz"]; !has {
+		t.Error("Expected the constraint on github.com/foo/baz to be kept")
+	}
+	if len(m.Ovr) != 0 {
+		t.Errorf("Expected the override on github.com/foo/bar to be removed, got %v", m.Ovr)
+	}
+	wantReq := []string{"github.com/foo/barn", "github.com/foo/baz"}
+	if !reflect.DeepEqual(m.Required, wantReq) {
+		t.Errorf("unexpected required packages:\n\t(GOT): %v\n\t(WNT): %v", m.Required, wantReq)
+	}
+}
+
+func TestImportingFiles(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src/example.com/root")
+	h.TempFile("src/example.com/root/root.go", `package root
+
+import _ "github.com/foo/bar/sub"
+`)
+	h.TempFile("src/example.com/root/other.go", `package root
+
+import _ "github.com/foo/barn"
+`)
+	h.TempFile("src/example.com/root/cmd/cmd_test.go", `package cmd
+
+import (
+	"testing"
+
+	_ "github.com/foo/bar"
+)
+
+func TestCmd(t *testing.T) {}
+`)
+	h.TempFile("src/example.com/root/ignored/ignored.go", `package ignored
+
+import _ "github.com/foo/bar"
+`)
+
+	p := &dep.Project{ImportRoot: "example.com/root", Manifest: &dep.Manifest{}}
+	if err := p.SetRoot(h.Path("src/example.com/root")); err != nil {
+		t.Fatal(err)
+	}
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ignored := map[string]bool{"example.com/root/ignored": true}
+	got := importingFiles(p, ptree, ignored, "github.com/foo/bar")
+	want := []string{"cmd/cmd_test.go", "root.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected importing files:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if got := importingFiles(p, ptree, ignored, "github.com/foo/qux"); len(got) != 0 {
+		t.Errorf("Expected no files to import github.com/foo/qux, got %v", got)
+	}
+
+	// Test files don't make a dependency of a project which excludes tests.
+	p.Manifest.ExcludeTests = true
+	got = importingFiles(p, ptree, ignored, "github.com/foo/bar")
+	if want := []string{"root.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected importing files excluding tests:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
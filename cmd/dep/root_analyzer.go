@@ -7,6 +7,10 @@ package main
 import (
 	"io/ioutil"
 	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/golang/dep"
 	fb "github.com/golang/dep/internal/feedback"
@@ -22,16 +26,35 @@ type importer interface {
 	HasDepMetadata(dir string) bool
 }
 
+// Styles of the manifest constraints written for versions imported from
+// external tools.
+const (
+	importConstraintCaret = "caret" // ^x.y.z, the default
+	importConstraintTilde = "tilde" // ~x.y.z
+	importConstraintExact = "exact" // =x.y.z
+	importConstraintNone  = "none"  // No constraint; rely on the lock alone
+)
+
 // rootAnalyzer supplies manifest/lock data from both dep and external tool's
 // configuration files.
 // * When used on the root project, it imports only from external tools.
 // * When used by the solver for dependencies, it first looks for dep config,
 //   then external tools.
 type rootAnalyzer struct {
-	skipTools  bool
-	ctx        *dep.Ctx
-	sm         gps.SourceManager
-	directDeps map[string]bool
+	skipTools    bool
+	strictImport bool     // Fail, rather than skip, when an imported revision can't be locked.
+	importedFrom []string // Names of the tools the root project's configuration was imported from, if any.
+	// Names of the importers to run, in order. When empty, all of them are run
+	// in their default order.
+	importerOrder []string
+	// Style of the constraints written for imported versions, one of the
+	// importConstraint* values. Empty means importConstraintCaret.
+	constraintStyle string
+	unconstrained   map[gps.ProjectRoot]bool // Imported projects deliberately left out of the manifest.
+	importDir       string                   // Directory to import external tool configuration from, if not the root project's.
+	ctx             *dep.Ctx
+	sm              gps.SourceManager
+	directDeps      map[string]bool
 }
 
 func newRootAnalyzer(skipTools bool, ctx *dep.Ctx, directDeps map[string]bool, sm gps.SourceManager) *rootAnalyzer {
@@ -45,10 +68,38 @@ func newRootAnalyzer(skipTools bool, ctx *dep.Ctx, directDeps map[string]bool, s
 
 func (a *rootAnalyzer) InitializeRootManifestAndLock(dir string, pr gps.ProjectRoot) (rootM *dep.Manifest, rootL *dep.Lock, err error) {
 	if !a.skipTools {
-		rootM, rootL, err = a.importManifestAndLock(dir, pr, false)
+		importDir, importPR := dir, pr
+		if a.importDir != "" {
+			importDir = a.importDir
+			importPR = importRoot(dir, importDir, pr)
+		}
+
+		rootM, rootL, a.importedFrom, err = a.importManifestAndLock(importDir, importPR, false)
 		if err != nil {
 			return
 		}
+		if a.importDir != "" && len(a.importedFrom) == 0 {
+			err = errors.Errorf("no configuration from a supported dependency manager was found in %s", a.importDir)
+			return
+		}
+		if rootM != nil {
+			if importPR != pr {
+				rootM.Ignored = a.rerootIgnored(rootM.Ignored, importPR, pr)
+			}
+			err = a.applyConstraintStyle(rootM)
+			if err != nil {
+				return
+			}
+			if len(a.importedFrom) > 0 {
+				rootM.Meta = importMetadata(strings.Join(a.importedFrom, ", "), time.Now())
+			}
+		}
+		if rootL != nil {
+			err = a.removeUnresolvableLocks(rootL)
+			if err != nil {
+				return
+			}
+		}
 	}
 
 	if rootM == nil {
@@ -64,41 +115,366 @@ func (a *rootAnalyzer) InitializeRootManifestAndLock(dir string, pr gps.ProjectR
 	return
 }
 
-func (a *rootAnalyzer) importManifestAndLock(dir string, pr gps.ProjectRoot, suppressLogs bool) (*dep.Manifest, *dep.Lock, error) {
+// importRoot returns the import path corresponding to importDir, the directory
+// external tool configuration is imported from, given that dir is the
+// directory of the project pr. When importDir isn't an ancestor of dir, its
+// configuration is treated as if it were in dir.
+func importRoot(dir, importDir string, pr gps.ProjectRoot) gps.ProjectRoot {
+	rel, err := filepath.Rel(importDir, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return pr
+	}
+
+	rel = filepath.ToSlash(rel)
+	if !strings.HasSuffix(string(pr), "/"+rel) {
+		return pr
+	}
+	return gps.ProjectRoot(strings.TrimSuffix(string(pr), "/"+rel))
+}
+
+// rerootIgnored adjusts the ignored packages imported from the configuration
+// of the project importPR, which contains the root project pr. Packages within
+// importPR but outside of pr can never be imported by the root project, so
+// they are dropped.
+func (a *rootAnalyzer) rerootIgnored(ignored []string, importPR, pr gps.ProjectRoot) []string {
+	var rerooted []string
+	for _, pkg := range ignored {
+		if isPathPrefix(pkg, string(importPR)) && !isPathPrefix(pkg, string(pr)) {
+			a.ctx.Err.Printf("  Ignoring ignored package %s, it is not within %s.\n", pkg, pr)
+			continue
+		}
+		rerooted = append(rerooted, pkg)
+	}
+	return rerooted
+}
+
+// importManifestAndLock imports the configuration of every external tool
+// detected in dir, merged in the order of detectImporters, and returns the
+// names of those tools. If none is detected, an empty manifest is returned.
+func (a *rootAnalyzer) importManifestAndLock(dir string, pr gps.ProjectRoot, suppressLogs bool) (*dep.Manifest, *dep.Lock, []string, error) {
 	logger := a.ctx.Err
 	if suppressLogs {
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 
-	importers := []importer{
+	importers, err := a.detectImporters(dir, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var names []string
+	merged := newImportMerger(logger)
+	for _, i := range importers {
+		a.ctx.Err.Printf("Importing configuration from %s. These are only initial constraints, and are further refined during the solve process.", i.Name())
+		m, l, err := i.Import(dir, pr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		merged.merge(i.Name(), m, l)
+		names = append(names, i.Name())
+	}
+
+	if len(names) == 0 {
+		var emptyManifest = &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
+		return emptyManifest, nil, nil, nil
+	}
+
+	a.removeTransitiveDependencies(merged.m)
+	return merged.m, merged.l, names, nil
+}
+
+// importers returns the importers for all supported external tools, in the
+// order they are imported by default.
+func (a *rootAnalyzer) importers(logger *log.Logger) []importer {
+	return []importer{
 		newGlideImporter(logger, a.ctx.Verbose, a.sm),
 		newGodepImporter(logger, a.ctx.Verbose, a.sm),
+		newGovendorImporter(logger, a.ctx.Verbose, a.sm),
+		newGbImporter(logger, a.ctx.Verbose, a.sm),
+		newGvtImporter(logger, a.ctx.Verbose, a.sm),
+		newGlockImporter(logger, a.ctx.Verbose, a.sm),
+		newVndrImporter(logger, a.ctx.Verbose, a.sm),
+		newGomImporter(logger, a.ctx.Verbose, a.sm),
+		newGpmImporter(logger, a.ctx.Verbose, a.sm),
+		newGitSubmoduleImporter(logger, a.ctx.Verbose, a.sm),
+		newBazelImporter(logger, a.ctx.Verbose, a.sm),
 	}
+}
 
-	for _, i := range importers {
+// fallbackImporters returns the importers which, by default, only run when
+// none of the others detect any configuration. go.mod is increasingly common
+// alongside other tools, so it is only imported when there is nothing else.
+func (a *rootAnalyzer) fallbackImporters(logger *log.Logger) []importer {
+	return []importer{
+		newGomodImporter(logger, a.ctx.Verbose, a.sm),
+	}
+}
+
+// detectImporters returns the importers which detect configuration in dir, in
+// the order their configuration should be imported. When the analyzer has an
+// importer order, only the importers it names are considered, in that order.
+func (a *rootAnalyzer) detectImporters(dir string, logger *log.Logger) ([]importer, error) {
+	all := append(a.importers(logger), a.fallbackImporters(logger)...)
+
+	var candidates []importer
+	if len(a.importerOrder) == 0 {
+		candidates = a.importers(logger)
+	} else {
+		byName := make(map[string]importer, len(all))
+		var names []string
+		for _, i := range all {
+			byName[i.Name()] = i
+			names = append(names, i.Name())
+		}
+		for _, name := range a.importerOrder {
+			i, ok := byName[name]
+			if !ok {
+				return nil, errors.Errorf("unknown importer %q, must be one of: %s", name, strings.Join(names, ", "))
+			}
+			candidates = append(candidates, i)
+		}
+	}
+
+	var detected []importer
+	for _, i := range candidates {
 		if i.HasDepMetadata(dir) {
-			a.ctx.Err.Printf("Importing configuration from %s. These are only initial constraints, and are further refined during the solve process.", i.Name())
-			m, l, err := i.Import(dir, pr)
-			if err != nil {
-				return nil, nil, err
+			detected = append(detected, i)
+		}
+	}
+
+	if len(detected) == 0 && len(a.importerOrder) == 0 {
+		for _, i := range a.fallbackImporters(logger) {
+			if i.HasDepMetadata(dir) {
+				detected = append(detected, i)
 			}
-			a.removeTransitiveDependencies(m)
-			return m, l, err
 		}
 	}
 
-	var emptyManifest = &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
-	return emptyManifest, nil, nil
+	return detected, nil
+}
+
+// importMerger merges the manifests and locks imported from several tools.
+// When two tools disagree about a project, the one merged last wins.
+type importMerger struct {
+	logger *log.Logger
+	m      *dep.Manifest
+	l      *dep.Lock
+
+	// The tool each constraint, override and locked project was taken from.
+	constraintFrom map[gps.ProjectRoot]string
+	ovrFrom        map[gps.ProjectRoot]string
+	lockFrom       map[gps.ProjectRoot]string
+}
+
+func newImportMerger(logger *log.Logger) *importMerger {
+	return &importMerger{
+		logger: logger,
+		m: &dep.Manifest{
+			Constraints: make(gps.ProjectConstraints),
+			Ovr:         make(gps.ProjectConstraints),
+		},
+		l:              &dep.Lock{},
+		constraintFrom: make(map[gps.ProjectRoot]string),
+		ovrFrom:        make(map[gps.ProjectRoot]string),
+		lockFrom:       make(map[gps.ProjectRoot]string),
+	}
+}
+
+// merge the manifest and lock imported from the named tool into the result.
+func (im *importMerger) merge(from string, m *dep.Manifest, l *dep.Lock) {
+	if m != nil {
+		im.mergeConstraints("constraint", from, im.m.Constraints, m.Constraints, im.constraintFrom)
+		im.mergeConstraints("override", from, im.m.Ovr, m.Ovr, im.ovrFrom)
+		im.m.Ignored = appendMissing(im.m.Ignored, m.Ignored...)
+		im.m.Required = appendMissing(im.m.Required, m.Required...)
+	}
+
+	if l == nil {
+		return
+	}
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		replaced := false
+		for i, prev := range im.l.P {
+			if prev.Ident().ProjectRoot != pr {
+				continue
+			}
+			if !prev.Eq(lp) {
+				im.logger.Printf("  Warning: %s and %s both lock %s, using the version from %s.\n", im.lockFrom[pr], from, pr, from)
+			}
+			im.l.P[i] = lp
+			replaced = true
+			break
+		}
+		if !replaced {
+			im.l.P = append(im.l.P, lp)
+		}
+		im.lockFrom[pr] = from
+	}
+}
+
+func (im *importMerger) mergeConstraints(kind, from string, dst, src gps.ProjectConstraints, sources map[gps.ProjectRoot]string) {
+	roots := make([]string, 0, len(src))
+	for pr := range src {
+		roots = append(roots, string(pr))
+	}
+	sort.Strings(roots)
+
+	for _, root := range roots {
+		pr := gps.ProjectRoot(root)
+		pp := src[pr]
+		if prev, ok := dst[pr]; ok && !equalProjectProperties(prev, pp) {
+			im.logger.Printf("  Warning: %s and %s both have a %s for %s, using the one from %s.\n", sources[pr], from, kind, pr, from)
+		}
+		dst[pr] = pp
+		sources[pr] = from
+	}
+}
+
+func equalProjectProperties(a, b gps.ProjectProperties) bool {
+	if a.Source != b.Source {
+		return false
+	}
+	if a.Constraint == nil || b.Constraint == nil {
+		return a.Constraint == b.Constraint
+	}
+	return a.Constraint.String() == b.Constraint.String()
+}
+
+// appendMissing appends to s the values which it doesn't already contain.
+func appendMissing(s []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range s {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s = append(s, v)
+		}
+	}
+	return s
 }
 
 func (a *rootAnalyzer) removeTransitiveDependencies(m *dep.Manifest) {
+	// Required packages are as good as imported by the project.
+	required := make(map[gps.ProjectRoot]bool)
+	for _, ip := range m.Required {
+		if pr, err := a.sm.DeduceProjectRoot(ip); err == nil {
+			required[pr] = true
+		}
+	}
+
 	for pr := range m.Constraints {
-		if _, isDirect := a.directDeps[string(pr)]; !isDirect {
+		if _, isDirect := a.directDeps[string(pr)]; !isDirect && !required[pr] {
 			delete(m.Constraints, pr)
 		}
 	}
 }
 
+// importMetadata returns the manifest metadata recording that it was imported
+// from tool at time t.
+func importMetadata(tool string, t time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"imported-from": tool,
+		"imported-at":   t.UTC().Format(time.RFC3339),
+	}
+}
+
+// applyConstraintStyle rewrites the caret constraints imported into m to the
+// analyzer's constraint style. Ranges and branches are left untouched, as they
+// were stated explicitly in the external tool's configuration.
+func (a *rootAnalyzer) applyConstraintStyle(m *dep.Manifest) error {
+	switch a.constraintStyle {
+	case "", importConstraintCaret:
+		return nil
+	case importConstraintNone:
+		if a.unconstrained == nil {
+			a.unconstrained = make(map[gps.ProjectRoot]bool)
+		}
+		for pr, pp := range m.Constraints {
+			if pp.Source != "" {
+				// Keep the project in the manifest so that its source is not
+				// lost, dropping only the constraint.
+				m.Constraints[pr] = gps.ProjectProperties{Source: pp.Source, Constraint: gps.Any()}
+			} else {
+				delete(m.Constraints, pr)
+			}
+			a.unconstrained[pr] = true
+		}
+		return nil
+	case importConstraintTilde, importConstraintExact:
+		for pr, pp := range m.Constraints {
+			c, err := restyleConstraint(pp.Constraint, a.constraintStyle)
+			if err != nil {
+				return errors.Wrapf(err, "unable to apply the %s constraint style to %s", a.constraintStyle, pr)
+			}
+			pp.Constraint = c
+			m.Constraints[pr] = pp
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown import constraint style %q", a.constraintStyle)
+	}
+}
+
+// restyleConstraint returns the tilde or exact equivalent of c, if c is a caret
+// constraint; otherwise c is returned as is.
+func restyleConstraint(c gps.Constraint, style string) (gps.Constraint, error) {
+	if c == nil || !strings.HasPrefix(c.String(), "^") {
+		return c, nil
+	}
+
+	v := strings.TrimPrefix(c.String(), "^")
+	switch style {
+	case importConstraintTilde:
+		return gps.NewSemverConstraint("~" + v)
+	case importConstraintExact:
+		return gps.NewSemverConstraint("=" + v)
+	}
+	return c, nil
+}
+
+// removeUnresolvableLocks removes the imported locked projects whose revision
+// can no longer be found in the project's source, e.g. because it was lost to
+// a force push or the repository was deleted. Their constraints are kept, so
+// the solver can still pick a version. In strict mode this is an error instead.
+func (a *rootAnalyzer) removeUnresolvableLocks(l *dep.Lock) error {
+	resolved := l.P[:0]
+	for _, lp := range l.P {
+		rev, ok := lp.Version().(gps.Revision)
+		if !ok {
+			// Paired versions were matched against the source while importing.
+			resolved = append(resolved, lp)
+			continue
+		}
+
+		pi := lp.Ident()
+		found, err := a.sm.RevisionPresentIn(pi, rev)
+		if err == nil && found {
+			resolved = append(resolved, lp)
+			continue
+		}
+
+		if a.strictImport {
+			if err != nil {
+				return errors.Wrapf(err, "unable to resolve the imported revision %s of %s", rev, pi.ProjectRoot)
+			}
+			return errors.Errorf("unable to resolve the imported revision %s of %s", rev, pi.ProjectRoot)
+		}
+
+		a.ctx.Err.Printf("  Warning: Unable to resolve the imported revision %s of %s, it will not be locked. The solver will pick a version for it instead.", rev, pi.ProjectRoot)
+		if err != nil && a.ctx.Verbose {
+			a.ctx.Err.Printf("    %s", err)
+		}
+	}
+	l.P = resolved
+
+	return nil
+}
+
 // DeriveManifestAndLock evaluates a dependency for existing dependency manager
 // configuration (ours or external) and passes any configuration found back
 // to the solver.
@@ -113,7 +489,7 @@ func (a *rootAnalyzer) DeriveManifestAndLock(dir string, pr gps.ProjectRoot) (gp
 		// The assignment back to an interface prevents interface-based nil checks from failing later
 		var manifest gps.Manifest = gps.SimpleManifest{}
 		var lock gps.Lock
-		im, il, err := a.importManifestAndLock(dir, pr, true)
+		im, il, _, err := a.importManifestAndLock(dir, pr, true)
 		if im != nil {
 			manifest = im
 		}
@@ -136,7 +512,7 @@ func (a *rootAnalyzer) FinalizeRootManifestAndLock(m *dep.Manifest, l *dep.Lock,
 		if _, ok := a.directDeps[string(pr)]; ok {
 			if _, ok := m.Constraints[pr]; !ok {
 				pp := getProjectPropertiesFromVersion(y.Version())
-				if pp.Constraint != nil {
+				if pp.Constraint != nil && !a.unconstrained[pr] {
 					m.Constraints[pr] = pp
 					pc := gps.ProjectConstraint{Ident: y.Ident(), Constraint: pp.Constraint}
 					f = fb.NewConstraintFeedback(pc, fb.DepTypeDirect)
@@ -176,7 +552,8 @@ func (a *rootAnalyzer) Info() gps.ProjectAnalyzerInfo {
 // lookupVersionForLockedProject figures out the appropriate version for a locked
 // project based on the locked revision and the constraint from the manifest.
 // First try matching the revision to a version, then try the constraint from the
-// manifest, then finally the revision.
+// manifest, then finally the revision. A branch other than the default one is
+// only matched when the revision is the head of no other such branch.
 func lookupVersionForLockedProject(pi gps.ProjectIdentifier, c gps.Constraint, rev gps.Revision, sm gps.SourceManager) (gps.Version, error) {
 	// Find the version that goes with this revision, if any
 	versions, err := sm.ListVersions(pi)
@@ -184,6 +561,8 @@ func lookupVersionForLockedProject(pi gps.ProjectIdentifier, c gps.Constraint, r
 		return rev, errors.Wrapf(err, "Unable to lookup the version represented by %s in %s(%s). Falling back to locking the revision only.", rev, pi.ProjectRoot, pi.Source)
 	}
 
+	var branches []gps.Version
+	var plain gps.Version
 	gps.SortPairedForUpgrade(versions) // Sort versions in asc order
 	for _, v := range versions {
 		if v.Revision() == rev {
@@ -196,10 +575,32 @@ func lookupVersionForLockedProject(pi gps.ProjectIdentifier, c gps.Constraint, r
 					continue
 				}
 			}
-			return v, nil
+
+			// Semver tags and the default branch sort first, and win outright.
+			// Hold on to the rest until we know whether the revision is the
+			// head of more than one branch.
+			switch {
+			case v.Type() == gps.IsBranch && !gps.IsDefaultBranch(v):
+				branches = append(branches, v)
+			case v.Type() == gps.IsVersion:
+				if plain == nil {
+					plain = v
+				}
+			default:
+				return v, nil
+			}
 		}
 	}
 
+	// When several branches point at the revision, there's no telling which
+	// one was being tracked.
+	if len(branches) == 1 {
+		return branches[0], nil
+	}
+	if plain != nil {
+		return plain, nil
+	}
+
 	// Use the version from the manifest as long as it wasn't a range
 	switch tv := c.(type) {
 	case gps.PairedVersion:
@@ -211,3 +612,48 @@ func lookupVersionForLockedProject(pi gps.ProjectIdentifier, c gps.Constraint, r
 	// Give up and lock only to a revision
 	return rev, nil
 }
+
+// tracksDefaultBranch reports whether branch, as another tool recorded it for
+// the project, stands for the default branch of its source: either it names
+// the default branch, or it's "master" and the source has no master branch, as
+// tools which assume master record for any repository. If the versions of the
+// source can't be listed, only master is taken to be the default.
+func tracksDefaultBranch(pi gps.ProjectIdentifier, branch string, sm gps.SourceManager) bool {
+	versions, err := sm.ListVersions(pi)
+	if err != nil {
+		return branch == "master"
+	}
+
+	var hasMaster bool
+	for _, v := range versions {
+		if v.Type() != gps.IsBranch {
+			continue
+		}
+		if v.String() == branch && gps.IsDefaultBranch(v) {
+			return true
+		}
+		if v.String() == "master" {
+			hasMaster = true
+		}
+	}
+	return branch == "master" && !hasMaster
+}
+
+// inferImportedConstraint infers the constraint for a version imported from
+// another tool's configuration. If the source can't be consulted, e.g. because
+// the repository no longer exists, it makes a best effort to interpret the
+// version as semver, and otherwise gives up on constraining the project.
+func inferImportedConstraint(s string, pi gps.ProjectIdentifier, sm gps.SourceManager, logger *log.Logger) gps.Constraint {
+	c, err := sm.InferConstraint(s, pi)
+	if err == nil {
+		return c
+	}
+
+	if c, serr := gps.NewSemverConstraintIC(s); serr == nil {
+		logger.Printf("  Warning: Unable to verify %s for %s, assuming it is a semver version: %s", s, pi.ProjectRoot, err)
+		return c
+	}
+
+	logger.Printf("  Warning: Unable to infer a constraint from %s for %s, it will not be constrained: %s", s, pi.ProjectRoot, err)
+	return nil
+}
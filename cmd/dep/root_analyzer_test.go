@@ -5,10 +5,16 @@
 package main
 
 import (
+	"bytes"
+	"log"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 func TestRootAnalyzer_Info(t *testing.T) {
@@ -25,6 +31,378 @@ func TestRootAnalyzer_Info(t *testing.T) {
 	}
 }
 
+func TestRootAnalyzer_ImportMetadata(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempFile(filepath.Join("src", testProjectRoot, godepPath), `{"ImportPath": "github.com/golang/notexist", "Deps": []}`)
+	projectRoot := h.Path(filepath.Join("src", testProjectRoot))
+
+	ctx.Err = discardLogger
+	a := newRootAnalyzer(false, ctx, nil, sm)
+	m, _, err := a.InitializeRootManifestAndLock(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if got := m.Meta["imported-from"]; got != "godep" {
+		t.Errorf("Expected the manifest to be recorded as imported from godep, got %v", got)
+	}
+	at, ok := m.Meta["imported-at"].(string)
+	if !ok {
+		t.Fatalf("Expected the manifest to record when it was imported, got %v", m.Meta["imported-at"])
+	}
+	if _, err := time.Parse(time.RFC3339, at); err != nil {
+		t.Errorf("Expected the import time to be in RFC 3339 format, got %s", at)
+	}
+
+	a = newRootAnalyzer(true, ctx, nil, sm)
+	m, _, err = a.InitializeRootManifestAndLock(projectRoot, testProjectRoot)
+	h.Must(err)
+	if m.Meta != nil {
+		t.Errorf("Expected no metadata when nothing was imported, got %v", m.Meta)
+	}
+}
+
+func TestRootAnalyzer_DetectImporters(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, glideYamlName), "rootanalyzer/multiple/glide.yaml")
+	h.TempCopy(filepath.Join(testProjectRoot, godepPath), "rootanalyzer/multiple/Godeps/Godeps.json")
+	projectRoot := h.Path(testProjectRoot)
+
+	testCases := map[string]struct {
+		order   []string
+		want    []string
+		wantErr bool
+	}{
+		"default order":  {want: []string{"glide", "godep"}},
+		"explicit order": {order: []string{"godep", "glide"}, want: []string{"godep", "glide"}},
+		"subset":         {order: []string{"glide", "gvt"}, want: []string{"glide"}},
+		"unknown":        {order: []string{"godep", "bower"}, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			a := newRootAnalyzer(false, ctx, nil, nil)
+			a.importerOrder = tc.order
+
+			detected, err := a.detectImporters(projectRoot, discardLogger)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error for an unknown importer")
+				}
+				return
+			}
+			h.Must(err)
+
+			if got := importerNames(detected); !equalSlice(got, tc.want) {
+				t.Fatalf("Expected the importers %v to be detected, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRootAnalyzer_ImportFrom(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join("src", testProjectRoot, glideYamlName), "rootanalyzer/from/glide.yaml")
+	h.TempDir(filepath.Join("src", testProjectRoot, "sub"))
+	h.TempDir("empty")
+	importDir := h.Path(filepath.Join("src", testProjectRoot))
+	projectRoot := h.Path(filepath.Join("src", testProjectRoot, "sub"))
+	pr := gps.ProjectRoot(testProjectRoot + "/sub")
+
+	a := newRootAnalyzer(false, ctx, nil, nil)
+	a.importDir = importDir
+	m, _, err := a.InitializeRootManifestAndLock(projectRoot, pr)
+	h.Must(err)
+
+	wantIgnored := []string{"github.com/sdboyer/dep-test", testProjectRoot + "/sub/gen"}
+	if !equalSlice(m.Ignored, wantIgnored) {
+		t.Errorf("Expected the ignored packages to be %v, got %v", wantIgnored, m.Ignored)
+	}
+	if got := m.Meta["imported-from"]; got != "glide" {
+		t.Errorf("Expected the manifest to be recorded as imported from glide, got %v", got)
+	}
+
+	a = newRootAnalyzer(false, ctx, nil, nil)
+	a.importDir = h.Path("empty")
+	_, _, err = a.InitializeRootManifestAndLock(projectRoot, pr)
+	if err == nil {
+		t.Fatal("Expected an error when there is no configuration to import")
+	}
+}
+
+func TestImportRoot(t *testing.T) {
+	pr := gps.ProjectRoot("github.com/golang/notexist/sub")
+	dir := filepath.FromSlash("/gopath/src/github.com/golang/notexist/sub")
+
+	testCases := map[string]gps.ProjectRoot{
+		"/gopath/src/github.com/golang/notexist/sub":       pr,
+		"/gopath/src/github.com/golang/notexist":           "github.com/golang/notexist",
+		"/gopath/src/github.com/golang":                    "github.com/golang",
+		"/elsewhere/notexist":                              pr,
+		"/gopath/src/github.com/golang/notexist/sub/child": pr,
+	}
+	for importDir, want := range testCases {
+		if got := importRoot(dir, filepath.FromSlash(importDir), pr); got != want {
+			t.Errorf("Expected the import path of %s to be %s, got %s", importDir, want, got)
+		}
+	}
+}
+
+func TestImportMerger(t *testing.T) {
+	c1, _ := gps.NewSemverConstraintIC("v0.8.0")
+	c2, _ := gps.NewSemverConstraintIC("v1.0.0")
+	rev1 := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	rev2 := gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f")
+	deptest := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+	deptestdos := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}
+
+	output := &bytes.Buffer{}
+	merged := newImportMerger(log.New(output, "", 0))
+	merged.merge("godep",
+		&dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				deptest.ProjectRoot:    {Constraint: c1},
+				deptestdos.ProjectRoot: {Constraint: gps.NewBranch("master")},
+			},
+			Ignored: []string{"github.com/sdboyer/dep-test"},
+		},
+		&dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, rev1, nil),
+			gps.NewLockedProject(deptestdos, gps.NewBranch("master").Pair(rev2), nil),
+		}})
+	merged.merge("glide",
+		&dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				deptest.ProjectRoot:    {Constraint: c2},
+				deptestdos.ProjectRoot: {Constraint: gps.NewBranch("master")},
+			},
+			Ignored: []string{"github.com/sdboyer/dep-test", "github.com/golang/notexist/samples"},
+		},
+		&dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(deptest, rev2, nil),
+			gps.NewLockedProject(deptestdos, gps.NewBranch("master").Pair(rev2), nil),
+		}})
+
+	if got := merged.m.Constraints[deptest.ProjectRoot].Constraint.String(); got != "^1.0.0" {
+		t.Errorf("Expected the later constraint to win, got %s", got)
+	}
+	wantIgnored := []string{"github.com/sdboyer/dep-test", "github.com/golang/notexist/samples"}
+	if !equalSlice(merged.m.Ignored, wantIgnored) {
+		t.Errorf("Expected the ignored packages to be merged into %v, got %v", wantIgnored, merged.m.Ignored)
+	}
+	if len(merged.l.P) != 2 {
+		t.Fatalf("Expected 2 locked projects, got %d", len(merged.l.P))
+	}
+	if got := merged.l.P[0].Version(); got != rev2 {
+		t.Errorf("Expected the later locked version to win, got %s", got)
+	}
+
+	wantOutput := "  Warning: godep and glide both have a constraint for github.com/sdboyer/deptest, using the one from glide.\n" +
+		"  Warning: godep and glide both lock github.com/sdboyer/deptest, using the version from glide.\n"
+	if got := output.String(); got != wantOutput {
+		t.Errorf("Expected the conflicts to be reported as:\n%s\ngot:\n%s", wantOutput, got)
+	}
+}
+
+// importerNames returns the names of the importers.
+func importerNames(importers []importer) []string {
+	var names []string
+	for _, i := range importers {
+		names = append(names, i.Name())
+	}
+	return names
+}
+
+func TestRootAnalyzer_RemoveTransitiveDependencies(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	directDeps := map[string]bool{"github.com/sdboyer/deptest": true}
+	a := newRootAnalyzer(false, ctx, directDeps, sm)
+
+	m := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest":     {Constraint: gps.NewBranch("master")},
+			"github.com/sdboyer/deptestdos":  {Constraint: gps.NewBranch("master")},
+			"github.com/sdboyer/deptesttres": {Constraint: gps.NewBranch("master")},
+		},
+		Required: []string{"github.com/sdboyer/deptestdos/cmd/tool"},
+	}
+	a.removeTransitiveDependencies(m)
+
+	for _, pr := range []gps.ProjectRoot{"github.com/sdboyer/deptest", "github.com/sdboyer/deptestdos"} {
+		if _, ok := m.Constraints[pr]; !ok {
+			t.Errorf("Expected the constraint on %s to be kept", pr)
+		}
+	}
+	if _, ok := m.Constraints["github.com/sdboyer/deptesttres"]; ok {
+		t.Error("Expected the constraint on the transitive dependency to be removed")
+	}
+}
+
+func TestRootAnalyzer_RemoveUnresolvableLocks(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		h := test.NewHelper(t)
+		defer h.Cleanup()
+
+		ctx := newTestContext(h)
+		sm, err := ctx.SourceManager()
+		h.Must(err)
+		defer sm.Release()
+
+		// Capture stderr so we can verify output
+		verboseOutput := &bytes.Buffer{}
+		ctx.Err = log.New(verboseOutput, "", 0)
+
+		a := newRootAnalyzer(false, ctx, nil, sm)
+		a.strictImport = strict
+
+		paired := gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"},
+			gps.NewVersion("v2.0.0").Pair("5c607206be5decd28e6263ffffdcee067266015e"),
+			nil,
+		)
+		unresolvable := gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"},
+			gps.Revision("0000000000000000000000000000000000000000"),
+			nil,
+		)
+		l := &dep.Lock{P: []gps.LockedProject{unresolvable, paired}}
+
+		err = a.removeUnresolvableLocks(l)
+		if strict {
+			if err == nil {
+				t.Fatal("Expected an unresolvable revision to fail a strict import")
+			}
+			continue
+		}
+		h.Must(err)
+
+		if len(l.P) != 1 || l.P[0].Ident().ProjectRoot != "github.com/sdboyer/deptestdos" {
+			t.Fatalf("Expected only the resolvable project to remain locked, got %v", l.P)
+		}
+
+		goldenFile := "rootanalyzer/unresolvable_golden.txt"
+		got := verboseOutput.String()
+		want := h.GetTestFileString(goldenFile)
+		if want != got {
+			if *test.UpdateGolden {
+				if err := h.WriteTestFile(goldenFile, got); err != nil {
+					t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+				}
+			} else {
+				t.Fatalf("want %s, got %s", want, got)
+			}
+		}
+	}
+}
+
+func TestRootAnalyzer_ApplyConstraintStyle(t *testing.T) {
+	caret, _ := gps.NewSemverConstraintIC("v1.2.3")
+	rng, _ := gps.NewSemverConstraint(">=1.2.3, <1.4.0")
+	excl, _ := gps.NewSemverConstraintIC("v1.2.3, !=1.2.5")
+
+	testCases := map[string]map[gps.ProjectRoot]string{
+		importConstraintCaret: {"caret": "^1.2.3", "range": rng.String(), "excluded": "^1.2.3, !=1.2.5", "branch": "master"},
+		importConstraintTilde: {"caret": "~1.2.3", "range": rng.String(), "excluded": "~1.2.3, !=1.2.5", "branch": "master"},
+		importConstraintExact: {"caret": "1.2.3", "range": rng.String(), "excluded": "1.2.3", "branch": "master"},
+		importConstraintNone:  {"source": "*"},
+	}
+
+	for style, want := range testCases {
+		t.Run(style, func(t *testing.T) {
+			m := &dep.Manifest{
+				Constraints: gps.ProjectConstraints{
+					"caret":    {Constraint: caret},
+					"range":    {Constraint: rng},
+					"excluded": {Constraint: excl},
+					"branch":   {Constraint: gps.NewBranch("master")},
+					"source":   {Source: "https://example.com/source.git", Constraint: caret},
+				},
+			}
+			if style != importConstraintNone {
+				delete(m.Constraints, "source")
+			}
+
+			a := &rootAnalyzer{constraintStyle: style}
+			if err := a.applyConstraintStyle(m); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m.Constraints) != len(want) {
+				t.Fatalf("Expected %d constraints, got %d: %v", len(want), len(m.Constraints), m.Constraints)
+			}
+			for pr, wantConstraint := range want {
+				pp, ok := m.Constraints[pr]
+				if !ok {
+					t.Fatalf("Expected a constraint for %s", pr)
+				}
+				if got := pp.Constraint.String(); got != wantConstraint {
+					t.Errorf("Expected the constraint for %s to be %s, got %s", pr, wantConstraint, got)
+				}
+			}
+			if style == importConstraintNone && !a.unconstrained["caret"] {
+				t.Error("Expected the dropped constraints to be recorded")
+			}
+		})
+	}
+
+	a := &rootAnalyzer{constraintStyle: "loose"}
+	if err := a.applyConstraintStyle(&dep.Manifest{}); err == nil {
+		t.Error("Expected an unknown constraint style to be rejected")
+	}
+}
+
+func TestInferImportedConstraint_Unreachable(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	// This repository doesn't exist, so the versions can't be looked up.
+	pi := gps.ProjectIdentifier{ProjectRoot: "github.com/golang/notexist"}
+
+	testCases := map[string]string{
+		"v1.0.0":          "^1.0.0",
+		"^1.4.0, !=1.4.2": "^1.4.0, !=1.4.2",
+		"master":          "",
+	}
+	for s, want := range testCases {
+		c := inferImportedConstraint(s, pi, sm, discardLogger)
+		if want == "" {
+			if c != nil {
+				t.Errorf("Expected no constraint to be inferred from %s, got %s", s, c)
+			}
+			continue
+		}
+		if c == nil || c.String() != want {
+			t.Errorf("Expected the constraint inferred from %s to be %s, got %v", s, want, c)
+		}
+	}
+}
+
 func TestLookupVersionForLockedProject_MatchRevisionToTag(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -111,3 +489,148 @@ func TestLookupVersionForLockedProject_FallbackToRevision(t *testing.T) {
 		t.Fatalf("Expected the locked version to be the manifest's pinned revision: wanted '%s', got '%s'", wantV, gotV)
 	}
 }
+
+func TestLookupVersionForLockedProject_MatchRevisionToBranch(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	// This revision is the head of the v2 branch, and isn't tagged.
+	pi := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/carolynvs/deptest-importers")}
+	rev := gps.Revision("45dcf5a09c64b48b6532a7ff2ca5e3db97ec3b46")
+	v, err := lookupVersionForLockedProject(pi, nil, rev, sm)
+	h.Must(err)
+
+	wantV := "v2"
+	gotV := v.String()
+	if gotV != wantV {
+		t.Fatalf("Expected the locked version to be the branch whose head is the manifest's pinned revision: wanted '%s', got '%s'", wantV, gotV)
+	}
+	if v.Type() != gps.IsBranch {
+		t.Fatalf("Expected the locked version to be a branch, got %T", v)
+	}
+}
+
+// versionListSourceManager is a SourceManager which lists the same versions,
+// or fails with the same error, for every project, and otherwise does nothing.
+type versionListSourceManager struct {
+	gps.SourceManager
+	versions []gps.PairedVersion
+	err      error
+}
+
+func (sm versionListSourceManager) ListVersions(gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	if sm.err != nil {
+		return nil, sm.err
+	}
+	return append([]gps.PairedVersion(nil), sm.versions...), nil
+}
+
+func TestLookupVersionForLockedProject_MatchRevisionToBranches(t *testing.T) {
+	pi := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/example/project")}
+	rev := gps.Revision("c575196502940c07bf89fd6d95e83b999162e051")
+	other := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+
+	testCases := map[string]struct {
+		versions []gps.PairedVersion
+		want     gps.Version
+	}{
+		"head of one branch": {
+			versions: []gps.PairedVersion{
+				gps.NewBranch("master").Pair(other),
+				gps.NewBranch("release-1.8").Pair(rev),
+			},
+			want: gps.NewBranch("release-1.8").Pair(rev),
+		},
+		"head of several branches": {
+			versions: []gps.PairedVersion{
+				gps.NewBranch("release-1.8").Pair(rev),
+				gps.NewBranch("release-1.9").Pair(rev),
+			},
+			want: rev,
+		},
+		"head of several branches and tagged": {
+			versions: []gps.PairedVersion{
+				gps.NewBranch("release-1.8").Pair(rev),
+				gps.NewBranch("release-1.9").Pair(rev),
+				gps.NewVersion("stable").Pair(rev),
+			},
+			want: gps.NewVersion("stable").Pair(rev),
+		},
+		"head of one branch and tagged": {
+			versions: []gps.PairedVersion{
+				gps.NewBranch("release-1.8").Pair(rev),
+				gps.NewVersion("stable").Pair(rev),
+			},
+			want: gps.NewBranch("release-1.8").Pair(rev),
+		},
+		"head of one branch and semver tagged": {
+			versions: []gps.PairedVersion{
+				gps.NewBranch("release-1.8").Pair(rev),
+				gps.NewVersion("v1.8.0").Pair(rev),
+			},
+			want: gps.NewVersion("v1.8.0").Pair(rev),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sm := versionListSourceManager{versions: tc.versions}
+			v, err := lookupVersionForLockedProject(pi, nil, rev, sm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tc.want {
+				t.Fatalf("Expected the locked version to be %s (%T), got %s (%T)", tc.want, tc.want, v, v)
+			}
+		})
+	}
+}
+
+func TestTracksDefaultBranch(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	test.NeedsGit(t)
+
+	// The repository's default branch is main, and it has no master.
+	h.TempFile("repo/file", "data\n")
+	repo := h.Path("repo")
+	h.RunGit(repo, "init", "-q")
+	h.RunGit(repo, "add", "file")
+	h.RunGit(repo, "-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", "Add file")
+	h.RunGit(repo, "branch", "-m", "main")
+	h.RunGit(repo, "branch", "develop")
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	pi := gps.ProjectIdentifier{ProjectRoot: "github.com/example/project", Source: "file://" + filepath.ToSlash(repo)}
+	for branch, want := range map[string]bool{"main": true, "develop": false, "master": true} {
+		if got := tracksDefaultBranch(pi, branch, sm); got != want {
+			t.Errorf("Expected tracksDefaultBranch(%q) to be %t, got %t", branch, want, got)
+		}
+	}
+
+	// With a master branch which isn't the default, master is just another
+	// branch.
+	h.RunGit(repo, "branch", "master")
+	sm.Release()
+	sm, err = ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+	if tracksDefaultBranch(pi, "master", sm) {
+		t.Error("Expected a master branch which isn't the default not to track it")
+	}
+
+	// Without the versions, only master is taken to be the default.
+	failing := versionListSourceManager{err: errors.New("no versions")}
+	if !tracksDefaultBranch(pi, "master", failing) || tracksDefaultBranch(pi, "main", failing) {
+		t.Error("Expected only master to track the default branch when versions can't be listed")
+	}
+}
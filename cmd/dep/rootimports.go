@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// rootImports maps each package outside of the project p which its packages
+// in ptree directly import, other than those of the standard library, to the
+// sorted import paths of the packages which import it. Ignored packages, and
+// test imports if the manifest excludes tests, are left out, as they bring in
+// no dependencies.
+func rootImports(p *dep.Project, ptree pkgtree.PackageTree) map[string][]string {
+	ignored := p.Manifest.IgnoredPackages()
+	internal := func(ip string) bool {
+		return ip == ptree.ImportRoot || strings.HasPrefix(ip, ptree.ImportRoot+"/")
+	}
+
+	byImport := make(map[string][]string)
+	for ip, poe := range ptree.Packages {
+		if poe.Err != nil || pkgtree.IsIgnored(ip, ignored) {
+			continue
+		}
+		imports := poe.P.Imports
+		if !p.Manifest.ExcludeTests {
+			imports = append(append([]string(nil), imports...), poe.P.TestImports...)
+		}
+		seen := make(map[string]bool)
+		for _, imp := range imports {
+			if seen[imp] || internal(imp) || paths.IsStandardImportPath(imp) || pkgtree.IsIgnored(imp, ignored) {
+				continue
+			}
+			seen[imp] = true
+			byImport[imp] = append(byImport[imp], ip)
+		}
+	}
+	for _, pkgs := range byImport {
+		sort.Strings(pkgs)
+	}
+	return byImport
+}
+
+// printRootImports logs which packages of the project p, whose package tree is
+// ptree, contribute each of its imports, so that it's clear in a project with
+// several main packages, or dirs excluded from analysis, where they come from.
+func printRootImports(logger *log.Logger, p *dep.Project, ptree pkgtree.PackageTree) {
+	byImport := rootImports(p, ptree)
+	imports := make([]string, 0, len(byImport))
+	for imp := range byImport {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+
+	logger.Printf("Imports of the packages of %s:\n", ptree.ImportRoot)
+	for _, imp := range imports {
+		logger.Printf("  %s\n", imp)
+		for _, pkg := range byImport[imp] {
+			logger.Printf("    from %s\n", pkg)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestRootImports(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src/example.com/root")
+	h.TempFile("src/example.com/root/cmd/a/main.go", `package main
+
+import (
+	"fmt"
+
+	_ "example.com/root/lib"
+	_ "github.com/foo/bar"
+)
+
+func main() { fmt.Println() }
+`)
+	h.TempFile("src/example.com/root/cmd/b/main.go", `package main
+
+import _ "github.com/foo/bar"
+
+func main() {}
+`)
+	h.TempFile("src/example.com/root/lib/lib.go", `package lib
+
+import _ "github.com/foo/baz"
+`)
+	h.TempFile("src/example.com/root/lib/lib_test.go", `package lib
+
+import _ "github.com/foo/qux"
+`)
+	h.TempFile("src/example.com/root/legacy/legacy.go", `package legacy
+
+import _ "github.com/foo/old"
+`)
+
+	p := &dep.Project{
+		ImportRoot: "example.com/root",
+		Manifest:   &dep.Manifest{ExcludeDirs: []string{"legacy"}},
+	}
+	if err := p.SetRoot(h.Path("src/example.com/root")); err != nil {
+		t.Fatal(err)
+	}
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"github.com/foo/bar": {"example.com/root/cmd/a", "example.com/root/cmd/b"},
+		"github.com/foo/baz": {"example.com/root/lib"},
+		"github.com/foo/qux": {"example.com/root/lib"},
+	}
+	if got := rootImports(p, ptree); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected root imports:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	p.Manifest.ExcludeTests = true
+	delete(want, "github.com/foo/qux")
+	if got := rootImports(p, ptree); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected root imports without tests:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	printRootImports(log.New(&buf, "", 0), p, ptree)
+	wantOut := `Imports of the packages of example.com/root:
+  github.com/foo/bar
+    from example.com/root/cmd/a
+    from example.com/root/cmd/b
+  github.com/foo/baz
+    from example.com/root/lib
+`
+	if buf.String() != wantOut {
+		t.Errorf("unexpected output:\n\t(GOT): %s\n\t(WNT): %s", buf.String(), wantOut)
+	}
+}
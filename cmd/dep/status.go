@@ -6,17 +6,30 @@ package main
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/gps/paths"
 	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/license"
 	"github.com/pkg/errors"
 )
 
@@ -25,19 +38,119 @@ const statusLongHelp = `
 With no arguments, print the status of each dependency of the project.
 
   PROJECT     Import path
-  CONSTRAINT  Version constraint, from the manifest
+  CONSTRAINT  Version constraint, from the manifest, narrowed for gopkg.in
+              projects to the major version their import path names
   VERSION     Version chosen, from the lock
   REVISION    VCS revision of the chosen version
-  LATEST      Latest VCS revision available
+  LATEST      Latest VCS revision available, or the error looking it up
   PKGS USED   Number of packages from this project that are actually used
+  DIRECT      Whether the project is imported by the current project, rather
+              than only by other dependencies, or "required" when it's only
+              in the solve because Gopkg.toml requires some of its packages
+  TEST        Whether the current project imports it only from its tests
 
-With one or more explicitly specified packages, or with the -detailed flag,
-print an extended status output for each dependency of the project.
+With one or more explicitly specified packages, print the status of only the
+projects containing them. Each package must be provided by a project in the
+lock. With the -detailed flag, print an extended status output for each
+dependency of the project, or of the specified packages.
 
   TODO    Another column description
   FOOBAR  Another column description
 
-Status returns exit code zero if all dependencies are in a "good state".
+Pass -json to print the same information as a JSON object, for consumption by
+other tools. Its "projects" array holds an object per dependency, sorted by
+project root, with the fields PROJECT, CONSTRAINT, VERSION, REVISION, LATEST,
+PKGS_USED and DIRECT, REQUIRED when Gopkg.toml requires some of its packages,
+TEST when only the project's tests import it, and ERROR when the latest version
+couldn't be looked up.
+Its "in-sync" field reports whether the lock is in sync with the manifest and
+the project's imports; when it isn't, "missing" lists the projects which are
+imported but missing from the lock. -json, -dot and -detailed are mutually
+exclusive.
+
+When the lock is in sync, the constraints and overrides of the manifest which
+have no effect are listed after the dependencies, unless only some projects
+were asked for: those on projects which aren't dependencies, or whose packages
+are all ignored, and constraints on projects which are only transitive
+dependencies, as constraints only apply to direct ones. The -json output lists
+them in its "unused" array, with the fields PROJECT, KIND and REASON. dep
+ensure warns about them too.
+
+Pass -f with a Go text/template to choose what is printed. The template is
+executed once per dependency, each time followed by a newline, against a
+struct with the string fields ProjectRoot, Source, Constraint, Version,
+Revision, Latest and Error, the int field PackageCount and the bool fields
+Direct, Required and Test; for example:
+
+  dep status -f '{{.ProjectRoot}} {{.Version}} {{.Latest}}'
+
+-f can't be combined with -json, -dot or -detailed.
+
+Pass -csv to print the same information as an RFC 4180 CSV document, for
+other tools to ingest, with a header row and the columns PROJECT, SOURCE,
+CONSTRAINT, VERSION, REVISION, LATEST, PKGS USED, DIRECT and TEST, then COMMITTED
+and BEHIND with -age. Versions and revisions are written in full. Combined with
+-old, only the out-of-date dependencies are written, with a NEWEST column for
+the newest version whether or not the constraint allows it. -csv can't be
+combined with -json, -dot, -f or -detailed.
+
+Pass -old to show only the dependencies which are out of date: first those for
+which the constraint of the manifest allows a newer revision than the locked
+one, then those with a newer semver version which the constraint excludes.
+Status then exits with a non-zero status if any dependency is out of date,
+unless -no-exit-code is passed. -old only applies to the table output.
+
+Pass -missing to list the packages imported by the project, other than ignored
+packages, which no project in the lock provides, each with a chain of imports
+showing which of the project's packages pulls it in; then the locked packages
+missing from vendor/. Status then exits with a non-zero status if anything is
+missing, unless -no-exit-code is passed. -missing can't be combined with other
+output flags. Projects which only use Gopkg.lock, and were populated with
+"dep ensure -no-vendor", can pass -no-vendor so that vendor/ isn't expected
+when they have none.
+
+Pass -licenses to list the license of each locked project, as detected from
+the LICENSE, COPYING or UNLICENSE files at its root in vendor/, along with the
+file it was detected from so it can be checked. Licenses are recognized as MIT,
+Apache-2.0, BSD-2-Clause, BSD-3-Clause, MPL, GPL, LGPL, AGPL or Unlicense, and
+are otherwise Unknown. Projects without a license file are reported as such,
+and listed again on stderr. -licenses can't be combined with other output
+flags. See dep licenses for a report in other formats, which doesn't need
+vendor/.
+
+Pass -dot to print the graph of the dependencies in the GraphViz DOT format,
+e.g. for rendering with "dot -Tpng". Each project is a node labeled with its
+locked version, and each edge means that a project imports packages from
+another. The direct dependencies of the project are drawn in bold. The graph
+is written in the same order on every run, so it can be checked in and diffed.
+
+Pass -age to show when each locked revision was committed, in the COMMITTED
+column, and how many commits it is behind the latest revision allowed by the
+constraint, in the BEHIND column; the latter can only be counted for git
+sources. Both are looked up in the local cache of the sources, which is only
+fetched when it lacks the revisions, and are n/a when they can't be found. The
+-json output and the -f template get the same information from the
+REVISION_TIME and COMMITS_BEHIND fields, and the RevisionTime and
+CommitsBehind fields. -age can't be combined with -old or -dot.
+
+The latest versions of up to -parallel projects are looked up at once. Pass
+-offline to skip looking them up, reporting them as unknown, and to check the
+lock using only what's cached locally; anything else which would need the
+network, like -dot, then fails. -offline can't be combined with -old. The
+global -no-network flag, or $DEPNOFETCH, implies -offline.
+
+Status exits with status 0 if all dependencies are in a "good state", and 1
+if it fails. If Gopkg.lock is out of sync with Gopkg.toml and the project's
+imports, as told by the inputs-digest of the lock, it reports what drifted:
+imports added, or removed when all the locked projects are vendored, and
+constraints added or no longer satisfied by the lock; it then exits with status
+2, unless -no-exit-code is passed. The same goes for projects which the lock
+records as pruned differently to how the [prune] section of Gopkg.toml says
+they're to be pruned.
+
+Projects which Gopkg.lock has from directories on the local filesystem, as
+given by a local source in Gopkg.toml, are warned about, as nobody else can
+fetch them; status then exits with status 1, unless -no-exit-code is passed.
 `
 
 func (cmd *statusCommand) Name() string      { return "status" }
@@ -49,24 +162,38 @@ func (cmd *statusCommand) Hidden() bool      { return false }
 func (cmd *statusCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.detailed, "detailed", false, "report more detailed status")
 	fs.BoolVar(&cmd.json, "json", false, "output in JSON format")
+	fs.BoolVar(&cmd.csv, "csv", false, "output in CSV format")
 	fs.StringVar(&cmd.template, "f", "", "output in text/template format")
 	fs.BoolVar(&cmd.dot, "dot", false, "output the dependency graph in GraphViz format")
 	fs.BoolVar(&cmd.old, "old", false, "only show out-of-date dependencies")
+	fs.BoolVar(&cmd.age, "age", false, "show when the locked revisions were committed, and how far behind they are")
+	fs.BoolVar(&cmd.noExitCode, "no-exit-code", false, "exit with zero status even when the lock is out of sync, or -old or -missing find problems")
+	fs.IntVar(&cmd.parallel, "parallel", runtime.GOMAXPROCS(0), "number of projects to look up the latest versions of at once")
+	fs.BoolVar(&cmd.offline, "offline", false, "don't access the network, and don't look up the latest versions")
 	fs.BoolVar(&cmd.missing, "missing", false, "only show missing dependencies")
+	fs.BoolVar(&cmd.noVendor, "no-vendor", false, "with -missing, don't expect a vendor/ directory in projects which haven't got one")
+	fs.BoolVar(&cmd.licenses, "licenses", false, "list the licenses of dependencies, from their vendored license files")
 	fs.BoolVar(&cmd.unused, "unused", false, "only show unused dependencies")
 	fs.BoolVar(&cmd.modified, "modified", false, "only show modified dependencies")
 }
 
 type statusCommand struct {
-	detailed bool
-	json     bool
-	template string
-	output   string
-	dot      bool
-	old      bool
-	missing  bool
-	unused   bool
-	modified bool
+	detailed   bool
+	json       bool
+	csv        bool
+	template   string
+	output     string
+	dot        bool
+	old        bool
+	age        bool
+	noExitCode bool
+	parallel   int
+	offline    bool
+	missing    bool
+	noVendor   bool
+	licenses   bool
+	unused     bool
+	modified   bool
 }
 
 type outputter interface {
@@ -76,12 +203,22 @@ type outputter interface {
 	MissingHeader()
 	MissingLine(*MissingStatus)
 	MissingFooter()
+	UnusedHeader()
+	UnusedLine(*unusedConstraint)
+	UnusedFooter()
 }
 
-type tableOutput struct{ w *tabwriter.Writer }
+type tableOutput struct {
+	w   *tabwriter.Writer
+	age bool // Whether to show the COMMITTED and BEHIND columns
+}
 
 func (out *tableOutput) BasicHeader() {
-	fmt.Fprintf(out.w, "PROJECT\tCONSTRAINT\tVERSION\tREVISION\tLATEST\tPKGS USED\n")
+	if out.age {
+		fmt.Fprintf(out.w, "PROJECT\tCONSTRAINT\tVERSION\tREVISION\tCOMMITTED\tLATEST\tBEHIND\tPKGS USED\tDIRECT\tTEST\n")
+		return
+	}
+	fmt.Fprintf(out.w, "PROJECT\tCONSTRAINT\tVERSION\tREVISION\tLATEST\tPKGS USED\tDIRECT\tTEST\n")
 }
 
 func (out *tableOutput) BasicFooter() {
@@ -89,20 +226,32 @@ func (out *tableOutput) BasicFooter() {
 }
 
 func (out *tableOutput) BasicLine(bs *BasicStatus) {
-	var constraint string
-	if v, ok := bs.Constraint.(gps.Version); ok {
-		constraint = formatVersion(v)
-	} else {
-		constraint = bs.Constraint.String()
+	if out.age {
+		fmt.Fprintf(out.w,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t\n",
+			bs.ProjectRoot,
+			formatConstraint(bs.Constraint),
+			formatVersion(bs.Version),
+			formatVersion(bs.Revision),
+			formatRevisionTime(bs.RevisionTime),
+			formatLatest(bs),
+			formatCommitsBehind(bs.CommitsBehind),
+			bs.PackageCount,
+			formatDirect(bs.Direct, bs.Required),
+			formatTest(bs.Test),
+		)
+		return
 	}
 	fmt.Fprintf(out.w,
-		"%s\t%s\t%s\t%s\t%s\t%d\t\n",
+		"%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t\n",
 		bs.ProjectRoot,
-		constraint,
+		formatConstraint(bs.Constraint),
 		formatVersion(bs.Version),
 		formatVersion(bs.Revision),
-		formatVersion(bs.Latest),
+		formatLatest(bs),
 		bs.PackageCount,
+		formatDirect(bs.Direct, bs.Required),
+		formatTest(bs.Test),
 	)
 }
 
@@ -122,55 +271,255 @@ func (out *tableOutput) MissingFooter() {
 	out.w.Flush()
 }
 
+func (out *tableOutput) UnusedHeader() {
+	out.w.Flush()
+	fmt.Fprintf(out.w, "\nUnused constraints and overrides in %s:\n\n", dep.ManifestName)
+	fmt.Fprintln(out.w, "PROJECT\tKIND\tREASON")
+}
+
+func (out *tableOutput) UnusedLine(uc *unusedConstraint) {
+	fmt.Fprintf(out.w, "%s\t%s\t%s\t\n", uc.ProjectRoot, uc.kind(), uc.Reason)
+}
+
+func (out *tableOutput) UnusedFooter() {
+	out.w.Flush()
+}
+
+// oldOutput shows only the dependencies with newer versions available, as a
+// table of those allowed by the constraints of the manifest and another of
+// those which aren't.
+type oldOutput struct {
+	tableOutput
+	excluded []*BasicStatus
+	count    int // The number of out-of-date dependencies
+}
+
+func (out *oldOutput) BasicLine(bs *BasicStatus) {
+	outdated, excluded := bs.isOutdated(), bs.isExcludedUpdate()
+	if outdated {
+		out.tableOutput.BasicLine(bs)
+	}
+	if excluded {
+		out.excluded = append(out.excluded, bs)
+	}
+	if outdated || excluded {
+		out.count++
+	}
+}
+
+// The manifest doesn't make dependencies any older, so unused constraints
+// aren't reported.
+func (out *oldOutput) UnusedHeader()                   {}
+func (out *oldOutput) UnusedLine(uc *unusedConstraint) {}
+func (out *oldOutput) UnusedFooter()                   {}
+
+func (out *oldOutput) BasicFooter() {
+	out.tableOutput.BasicFooter()
+	if len(out.excluded) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out.w, "\nNewer versions excluded by the constraints:\n\n")
+	fmt.Fprintf(out.w, "PROJECT\tCONSTRAINT\tVERSION\tNEWEST\tDIRECT\n")
+	for _, bs := range out.excluded {
+		fmt.Fprintf(out.w,
+			"%s\t%s\t%s\t%s\t%s\t\n",
+			bs.ProjectRoot,
+			formatConstraint(bs.Constraint),
+			formatVersion(bs.Version),
+			formatVersion(bs.Newest.Unpair()),
+			formatDirect(bs.Direct, bs.Required),
+		)
+	}
+	out.w.Flush()
+}
+
+// csvOutput writes the dependencies as CSV records. With old, only the
+// out-of-date ones are written.
+type csvOutput struct {
+	w     *csv.Writer
+	age   bool // Whether to write the COMMITTED and BEHIND columns
+	old   bool
+	count int // The number of out-of-date dependencies, with old
+}
+
+func (out *csvOutput) BasicHeader() {
+	header := []string{"PROJECT", "SOURCE", "CONSTRAINT", "VERSION", "REVISION", "LATEST", "PKGS USED", "DIRECT", "TEST"}
+	if out.old {
+		header = append(header, "NEWEST")
+	}
+	if out.age {
+		header = append(header, "COMMITTED", "BEHIND")
+	}
+	out.w.Write(header)
+}
+
+func (out *csvOutput) BasicFooter() {
+	out.w.Flush()
+}
+
+func (out *csvOutput) BasicLine(bs *BasicStatus) {
+	if out.old {
+		if !bs.isOutdated() && !bs.isExcludedUpdate() {
+			return
+		}
+		out.count++
+	}
+
+	raw := bs.marshalJSONStatus()
+	latest := raw.Latest
+	if raw.Error != "" {
+		latest = formatLatest(bs)
+	}
+	record := []string{
+		raw.ProjectRoot,
+		bs.Source,
+		raw.Constraint,
+		raw.Version,
+		raw.Revision,
+		latest,
+		strconv.Itoa(raw.PackageCount),
+		formatDirect(raw.Direct, raw.Required),
+		formatTest(raw.Test),
+	}
+	if out.old {
+		var newest string
+		if bs.Newest != nil {
+			newest = bs.Newest.String()
+		}
+		record = append(record, newest)
+	}
+	if out.age {
+		record = append(record, raw.RevisionTime, "")
+		if raw.CommitsBehind != nil {
+			record[len(record)-1] = strconv.Itoa(*raw.CommitsBehind)
+		}
+	}
+	out.w.Write(record)
+}
+
+func (out *csvOutput) MissingHeader() {
+	out.w.Write([]string{"PROJECT", "MISSING PACKAGES"})
+}
+
+func (out *csvOutput) MissingLine(ms *MissingStatus) {
+	out.w.Write([]string{ms.ProjectRoot, strings.Join(ms.MissingPackages, " ")})
+}
+
+func (out *csvOutput) MissingFooter() {
+	out.w.Flush()
+}
+
+// A CSV document only holds one table, that of the dependencies.
+func (out *csvOutput) UnusedHeader()                   {}
+func (out *csvOutput) UnusedLine(uc *unusedConstraint) {}
+func (out *csvOutput) UnusedFooter()                   {}
+
 type jsonOutput struct {
-	w       io.Writer
-	basic   []*BasicStatus
-	missing []*MissingStatus
+	w   io.Writer
+	raw rawStatusOutput
+}
+
+// rawStatusOutput is the document written by status -json.
+type rawStatusOutput struct {
+	InSync   bool               `json:"in-sync"`
+	Projects []rawStatus        `json:"projects"`
+	Missing  []rawMissingStatus `json:"missing,omitempty"`
+	Unused   []rawUnused        `json:"unused,omitempty"`
+}
+
+// rawStatus is the JSON representation of a BasicStatus. Its fields are named
+// after the columns of the table output.
+type rawStatus struct {
+	ProjectRoot  string `json:"PROJECT"`
+	Constraint   string `json:"CONSTRAINT"`
+	Version      string `json:"VERSION"`
+	Revision     string `json:"REVISION"`
+	Latest       string `json:"LATEST"`
+	PackageCount int    `json:"PKGS_USED"`
+	Direct       bool   `json:"DIRECT"`
+	Required     bool   `json:"REQUIRED,omitempty"`
+	Test         bool   `json:"TEST,omitempty"`
+	Error        string `json:"ERROR,omitempty"`
+
+	// Only reported with -age, when known.
+	RevisionTime  string `json:"REVISION_TIME,omitempty"`
+	CommitsBehind *int   `json:"COMMITS_BEHIND,omitempty"`
+}
+
+// rawMissingStatus is the JSON representation of a MissingStatus.
+type rawMissingStatus struct {
+	ProjectRoot     string   `json:"PROJECT"`
+	MissingPackages []string `json:"MISSING_PACKAGES"`
+}
+
+// rawUnused is the JSON representation of an unusedConstraint.
+type rawUnused struct {
+	ProjectRoot string `json:"PROJECT"`
+	Kind        string `json:"KIND"`
+	Reason      string `json:"REASON"`
 }
 
 func (out *jsonOutput) BasicHeader() {
-	out.basic = []*BasicStatus{}
+	out.raw = rawStatusOutput{InSync: true, Projects: []rawStatus{}}
 }
 
 func (out *jsonOutput) BasicFooter() {
-	json.NewEncoder(out.w).Encode(out.basic)
+	json.NewEncoder(out.w).Encode(out.raw)
 }
 
 func (out *jsonOutput) BasicLine(bs *BasicStatus) {
-	out.basic = append(out.basic, bs)
+	out.raw.Projects = append(out.raw.Projects, bs.marshalJSONStatus())
 }
 
 func (out *jsonOutput) MissingHeader() {
-	out.missing = []*MissingStatus{}
+	out.raw = rawStatusOutput{Projects: []rawStatus{}, Missing: []rawMissingStatus{}}
 }
 
 func (out *jsonOutput) MissingLine(ms *MissingStatus) {
-	out.missing = append(out.missing, ms)
+	out.raw.Missing = append(out.raw.Missing, rawMissingStatus{
+		ProjectRoot:     ms.ProjectRoot,
+		MissingPackages: ms.MissingPackages,
+	})
 }
 
 func (out *jsonOutput) MissingFooter() {
-	json.NewEncoder(out.w).Encode(out.missing)
+	json.NewEncoder(out.w).Encode(out.raw)
+}
+
+func (out *jsonOutput) UnusedHeader() {}
+
+func (out *jsonOutput) UnusedLine(uc *unusedConstraint) {
+	out.raw.Unused = append(out.raw.Unused, rawUnused{
+		ProjectRoot: string(uc.ProjectRoot),
+		Kind:        uc.kind(),
+		Reason:      uc.Reason,
+	})
 }
 
+func (out *jsonOutput) UnusedFooter() {}
+
 type dotOutput struct {
-	w io.Writer
-	o string
-	g *graphviz
-	p *dep.Project
+	w       io.Writer
+	o       string
+	g       *graphviz
+	p       *dep.Project
+	imports []string // External packages imported by the root project
 }
 
 func (out *dotOutput) BasicHeader() {
 	out.g = new(graphviz).New()
 
-	ptree, _ := pkgtree.ListPackages(out.p.ResolvedAbsRoot, string(out.p.ImportRoot))
-	prm, _ := ptree.ToReachMap(true, false, false, nil)
+	ptree, _ := out.p.ParseRootPackageTree()
+	prm, _ := ptree.ToReachMap(true, false, false, out.p.Manifest.IgnoredPackages())
+	out.imports = prm.FlattenFn(paths.IsStandardImportPath)
 
-	out.g.createNode(string(out.p.ImportRoot), "", prm.FlattenFn(paths.IsStandardImportPath))
+	out.g.createNode(string(out.p.ImportRoot), "", out.imports)
 }
 
 func (out *dotOutput) BasicFooter() {
 	gvo := out.g.output()
-	fmt.Fprintf(out.w, gvo.String())
+	fmt.Fprint(out.w, gvo.String())
 }
 
 func (out *dotOutput) BasicLine(bs *BasicStatus) {
@@ -178,6 +527,13 @@ func (out *dotOutput) BasicLine(bs *BasicStatus) {
 	if bs.Version != nil {
 		version = formatVersion(bs.Version)
 	}
+
+	for _, ip := range out.imports {
+		if isPathPrefix(ip, bs.ProjectRoot) {
+			out.g.createDirectNode(bs.ProjectRoot, version, bs.Children)
+			return
+		}
+	}
 	out.g.createNode(bs.ProjectRoot, version, bs.Children)
 }
 
@@ -185,19 +541,126 @@ func (out *dotOutput) MissingHeader()                {}
 func (out *dotOutput) MissingLine(ms *MissingStatus) {}
 func (out *dotOutput) MissingFooter()                {}
 
+func (out *dotOutput) UnusedHeader()                   {}
+func (out *dotOutput) UnusedLine(uc *unusedConstraint) {}
+func (out *dotOutput) UnusedFooter()                   {}
+
+// templateOutput executes a template for every dependency. Missing packages
+// are reported as a table, as the template only knows about dependencies.
+type templateOutput struct {
+	tableOutput
+	w    io.Writer
+	tmpl *template.Template
+	err  error // The first error executing the template, if any
+}
+
+// templateStatus is what the -f template is executed against. Keep the long
+// help of the status command in sync with its fields.
+type templateStatus struct {
+	ProjectRoot  string
+	Source       string
+	Constraint   string
+	Version      string
+	Revision     string
+	Latest       string
+	PackageCount int
+	Direct       bool
+	Required     bool
+	Test         bool
+	Error        string
+
+	RevisionTime  string
+	CommitsBehind string
+}
+
+func (out *templateOutput) BasicHeader() {}
+func (out *templateOutput) BasicFooter() {}
+
+func (out *templateOutput) UnusedHeader()                   {}
+func (out *templateOutput) UnusedLine(uc *unusedConstraint) {}
+func (out *templateOutput) UnusedFooter()                   {}
+
+func (out *templateOutput) BasicLine(bs *BasicStatus) {
+	if out.err != nil {
+		return
+	}
+
+	raw := bs.marshalJSONStatus()
+	ts := templateStatus{
+		ProjectRoot:  raw.ProjectRoot,
+		Source:       bs.Source,
+		Constraint:   raw.Constraint,
+		Version:      raw.Version,
+		Revision:     raw.Revision,
+		Latest:       raw.Latest,
+		PackageCount: raw.PackageCount,
+		Direct:       raw.Direct,
+		Required:     raw.Required,
+		Test:         raw.Test,
+		Error:        raw.Error,
+		RevisionTime: raw.RevisionTime,
+	}
+	if raw.CommitsBehind != nil {
+		ts.CommitsBehind = strconv.Itoa(*raw.CommitsBehind)
+	}
+	if out.err = out.tmpl.Execute(out.w, ts); out.err == nil {
+		fmt.Fprintln(out.w)
+	}
+}
+
 func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
+	// With the network disabled altogether, status works as it does offline.
+	cmd.offline = cmd.offline || ctx.NoNetwork
+	if err := cmd.validateFlags(); err != nil {
+		return err
+	}
+
+	// Check the template before going anywhere near the network.
+	var tmpl *template.Template
+	if cmd.template != "" {
+		var err error
+		tmpl, err = template.New("status").Parse(cmd.template)
+		if err != nil {
+			return errors.Wrap(err, "invalid -f template")
+		}
+	}
+
 	p, err := ctx.LoadProject()
 	if err != nil {
 		return err
 	}
 
+	if cmd.missing {
+		// Finding what's missing only takes the code and the lock, so there's
+		// no need for a SourceManager.
+		count, err := runStatusMissing(ctx, p, cmd.noVendor)
+		if err != nil {
+			return err
+		}
+		if count > 0 && !cmd.noExitCode {
+			return errors.Errorf("%d packages are missing", count)
+		}
+		return nil
+	}
+
+	if cmd.licenses {
+		// Likewise, licenses are detected from vendor/.
+		return runStatusLicenses(ctx, p)
+	}
+
 	sm, err := ctx.SourceManager()
 	if err != nil {
 		return err
 	}
 	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
 	defer sm.Release()
 
+	var ssm gps.SourceManager = sm
+	if cmd.offline {
+		ssm = newOfflineSourceManager(sm, p.Lock)
+	}
+
 	var buf bytes.Buffer
 	var out outputter
 	switch {
@@ -207,6 +670,22 @@ func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
 		out = &jsonOutput{
 			w: &buf,
 		}
+	case cmd.csv:
+		out = &csvOutput{
+			w:   csv.NewWriter(&buf),
+			age: cmd.age,
+			old: cmd.old,
+		}
+	case cmd.old:
+		out = &oldOutput{
+			tableOutput: tableOutput{w: tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)},
+		}
+	case tmpl != nil:
+		out = &templateOutput{
+			tableOutput: tableOutput{w: tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)},
+			w:           &buf,
+			tmpl:        tmpl,
+		}
 	case cmd.dot:
 		out = &dotOutput{
 			p: p,
@@ -215,41 +694,185 @@ func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
 		}
 	default:
 		out = &tableOutput{
-			w: tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0),
+			w:   tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0),
+			age: cmd.age,
 		}
 	}
 
-	digestMismatch, hasMissingPkgs, err := runStatusAll(ctx, out, p, sm)
+	drift, hasMissingPkgs, err := runStatusAll(ctx, out, p, ssm, args, cmd.parallel, cmd.age)
 	if err != nil {
 		return err
 	}
+	if tout, ok := out.(*templateOutput); ok && tout.err != nil {
+		return errors.Wrap(tout.err, "executing the -f template")
+	}
 
-	if digestMismatch {
+	if drift != nil {
+		ctx.Err.Println("Lock inputs-digest mismatch, Gopkg.lock is out of sync with Gopkg.toml and the project's imports:")
+		drift.print(ctx.Err)
 		if hasMissingPkgs {
-			ctx.Err.Printf("Lock inputs-digest mismatch due to the following packages missing from the lock:\n\n")
+			ctx.Err.Printf("\nThe following packages are missing from the lock:\n\n")
+			ctx.Out.Print(buf.String())
+		} else if cmd.json {
+			// Tools reading the output still need to be told that the
+			// lock is out of sync.
 			ctx.Out.Print(buf.String())
-			ctx.Err.Printf("\nThis happens when a new import is added. Run `dep ensure` to install the missing packages.\n")
-		} else {
-			ctx.Err.Printf("Lock inputs-digest mismatch. This happens when Gopkg.toml is modified.\n" +
-				"Run `dep ensure` to regenerate the inputs-digest.")
 		}
-	} else {
-		ctx.Out.Print(buf.String())
+		if !cmd.noExitCode {
+			return lockDriftError{}
+		}
+		return nil
+	}
+	ctx.Out.Print(buf.String())
+
+	if pruneDrift := findPruneDrift(p); len(pruneDrift) > 0 {
+		ctx.Err.Println("Gopkg.lock records different prune options than Gopkg.toml gives for:")
+		for _, pr := range pruneDrift {
+			ctx.Err.Printf("  %s: pruned with %q, Gopkg.toml gives %q", pr, p.Lock.PruneOptionsFor(pr), p.Manifest.PruneOptions.PruneOptionsFor(pr))
+		}
+		if !cmd.noExitCode {
+			return lockDriftError{}
+		}
+		return nil
+	}
+
+	if local := findLocalSources(p.Lock); len(local) > 0 {
+		ctx.Err.Println("WARNING: Gopkg.lock has projects from local directories, which nobody else can fetch:")
+		for _, lp := range local {
+			ctx.Err.Printf("  %s: %s\n", lp.Ident().ProjectRoot, lp.Ident().Source)
+		}
+		if !cmd.noExitCode {
+			return errors.Errorf("%d dependencies are from local directories", len(local))
+		}
+	}
+
+	var outdated int
+	switch out := out.(type) {
+	case *oldOutput:
+		outdated = out.count
+	case *csvOutput:
+		outdated = out.count
+	}
+	if outdated > 0 && !cmd.noExitCode {
+		return errors.Errorf("%d dependencies are out of date", outdated)
 	}
 
 	return nil
 }
 
+// validateFlags checks that at most one output format was requested.
+func (cmd *statusCommand) validateFlags() error {
+	var formats []string
+	if cmd.detailed {
+		formats = append(formats, "-detailed")
+	}
+	if cmd.json {
+		formats = append(formats, "-json")
+	}
+	if cmd.dot {
+		formats = append(formats, "-dot")
+	}
+	if cmd.template != "" {
+		formats = append(formats, "-f")
+	}
+	if cmd.csv {
+		formats = append(formats, "-csv")
+	}
+	if cmd.missing && (cmd.old || cmd.licenses || len(formats) > 0) {
+		return errors.New("-missing can't be combined with other output flags")
+	}
+	if cmd.noVendor && !cmd.missing {
+		return errors.New("-no-vendor only applies to -missing")
+	}
+	if cmd.licenses && (cmd.old || len(formats) > 0) {
+		return errors.New("-licenses can't be combined with other output flags")
+	}
+	if cmd.old && len(formats) > 0 && !(cmd.csv && len(formats) == 1) {
+		return errors.Errorf("-old can't be combined with %s, it only filters the table output", strings.Join(formats, " or "))
+	}
+
+	if len(formats) > 1 {
+		return errors.Errorf("%s are mutually exclusive, choose only one output format", strings.Join(formats, " and "))
+	}
+	if cmd.age && (cmd.old || cmd.dot) {
+		return errors.New("-age can't be combined with -old or -dot")
+	}
+	if cmd.old && cmd.offline {
+		return errors.New("-old can't be combined with -offline or -no-network, as finding newer versions needs the network")
+	}
+	if cmd.parallel < 1 {
+		return errors.Errorf("-parallel must be at least 1, got %d", cmd.parallel)
+	}
+	return nil
+}
+
 // BasicStatus contains all the information reported about a single dependency
 // in the summary/list status output mode.
 type BasicStatus struct {
 	ProjectRoot  string
+	Source       string
 	Children     []string
 	Constraint   gps.Constraint
 	Version      gps.UnpairedVersion
 	Revision     gps.Revision
-	Latest       gps.Version
+	Latest       gps.Version       // Latest revision allowed by the constraint
+	Newest       gps.PairedVersion // Newest semver version, whether or not it is allowed
 	PackageCount int
+	Direct       bool  // Whether the root project imports any of its packages
+	Required     bool  // Whether the manifest requires any of its packages
+	Test         bool  // Whether the root project imports it only from its tests
+	LatestErr    error // Error looking up the latest versions, if any
+
+	// Only looked up with -age.
+	RevisionTime  time.Time // When the locked revision was committed, if known
+	CommitsBehind *int      // Commits from the locked to the latest revision, if known
+}
+
+// isOutdated reports whether a newer revision than the locked one is allowed by
+// the constraint.
+func (bs *BasicStatus) isOutdated() bool {
+	return bs.Latest != nil && bs.Latest.String() != string(bs.Revision)
+}
+
+// isExcludedUpdate reports whether a newer version than the locked one exists,
+// but is excluded by the constraint.
+func (bs *BasicStatus) isExcludedUpdate() bool {
+	if bs.Newest == nil || bs.Newest.Revision() == bs.Revision {
+		return false
+	}
+	return bs.Constraint != nil && !bs.Constraint.Matches(bs.Newest)
+}
+
+// marshalJSONStatus converts the status into its JSON representation. Unlike
+// the table output, versions and revisions are reported in full.
+func (bs *BasicStatus) marshalJSONStatus() rawStatus {
+	raw := rawStatus{
+		ProjectRoot:  bs.ProjectRoot,
+		Revision:     string(bs.Revision),
+		PackageCount: bs.PackageCount,
+		Direct:       bs.Direct,
+		Required:     bs.Required,
+		Test:         bs.Test,
+	}
+	if bs.Constraint != nil {
+		raw.Constraint = bs.Constraint.String()
+	}
+	if bs.Version != nil {
+		raw.Version = bs.Version.String()
+	}
+	if bs.Latest != nil {
+		raw.Latest = bs.Latest.String()
+	}
+	if !bs.RevisionTime.IsZero() {
+		raw.RevisionTime = bs.RevisionTime.Format(time.RFC3339)
+	}
+	raw.CommitsBehind = bs.CommitsBehind
+	if isOfflineError(bs.LatestErr) {
+		raw.Latest = "unknown"
+	} else if bs.LatestErr != nil {
+		raw.Error = bs.LatestErr.Error()
+	}
+	return raw
 }
 
 // MissingStatus contains information about all the missing packages in a project.
@@ -258,39 +881,66 @@ type MissingStatus struct {
 	MissingPackages []string
 }
 
-func runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Project, sm gps.SourceManager) (bool, bool, error) {
-	var digestMismatch, hasMissingPkgs bool
+// runStatusAll prints the status of the locked projects, or the projects
+// missing from the lock if it's out of sync, in which case the returned
+// lockDrift describes what changed.
+func runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Project, sm gps.SourceManager, pkgs []string, parallel int, withAge bool) (*lockDrift, bool, error) {
+	var drift *lockDrift
+	var hasMissingPkgs bool
 
 	if p.Lock == nil {
-		return digestMismatch, hasMissingPkgs, errors.Errorf("no Gopkg.lock found. Run `dep ensure` to generate lock file")
+		return drift, hasMissingPkgs, errors.Errorf("no Gopkg.lock found. Run `dep ensure` to generate lock file")
+	}
+
+	var only map[gps.ProjectRoot]bool
+	if len(pkgs) > 0 {
+		var err error
+		only, err = lockedProjectRoots(pkgs, p.Lock, sm)
+		if err != nil {
+			return drift, hasMissingPkgs, err
+		}
 	}
 
 	// While the network churns on ListVersions() requests, statically analyze
 	// code from the current project.
-	ptree, err := pkgtree.ListPackages(p.ResolvedAbsRoot, string(p.ImportRoot))
+	ptree, err := p.ParseRootPackageTree()
 	if err != nil {
-		return digestMismatch, hasMissingPkgs, errors.Errorf("analysis of local packages failed: %v", err)
+		return drift, hasMissingPkgs, errors.Errorf("analysis of local packages failed: %v", err)
 	}
-
-	// Set up a solver in order to check the InputHash.
-	params := gps.SolveParameters{
-		ProjectAnalyzer: dep.Analyzer{},
-		RootDir:         p.AbsRoot,
-		RootPackageTree: ptree,
-		Manifest:        p.Manifest,
-		// Locks aren't a part of the input hash check, so we can omit it.
+	if ctx.Verbose {
+		printRootImports(ctx.Err, p, ptree)
 	}
+
+	// Set up a solver in order to check the InputHash, with the same
+	// parameters as ensure so that both agree on whether the lock is in sync.
+	params := p.MakeParams()
+	params.RootPackageTree = ptree
 	if ctx.Verbose {
 		params.TraceLogger = ctx.Err
 	}
 
 	s, err := gps.Prepare(params, sm)
 	if err != nil {
-		return digestMismatch, hasMissingPkgs, errors.Errorf("could not set up solver for input hashing: %s", err)
+		return drift, hasMissingPkgs, errors.Errorf("could not set up solver for input hashing: %s", err)
 	}
 
 	cm := collectConstraints(ptree, p, sm)
 
+	// The external packages imported by the current project, used both to
+	// tell direct dependencies apart and to find the missing ones.
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.ExcludeTests, false, p.Manifest.IgnoredPackages())
+	external := rm.FlattenFn(paths.IsStandardImportPath)
+	imported := make(map[string]bool, len(external))
+	for _, ip := range external {
+		imported[ip] = true
+	}
+	testOnly := make(map[string]bool)
+	if !p.Manifest.ExcludeTests {
+		for _, ip := range ptree.TestOnlyImports(true, nil) {
+			testOnly[ip] = true
+		}
+	}
+
 	// Get the project list and sort it so that the printed output users see is
 	// deterministically ordered. (This may be superfluous if the lock is always
 	// written in alpha order, but it doesn't hurt to double down.)
@@ -302,84 +952,64 @@ func runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Project, sm gps.SourceMana
 		// complete picture of all deps. That eliminates the need for at least
 		// some checks.
 
-		out.BasicHeader()
-
+		var projects []gps.LockedProject
 		for _, proj := range slp {
-			bs := BasicStatus{
-				ProjectRoot:  string(proj.Ident().ProjectRoot),
-				PackageCount: len(proj.Packages()),
+			// Skip the projects which weren't asked for before doing anything
+			// slow, like listing their versions.
+			if only == nil || only[proj.Ident().ProjectRoot] {
+				projects = append(projects, proj)
 			}
+		}
 
-			// Get children only for specific outputers
-			// in order to avoid slower status process
-			switch out.(type) {
-			case *dotOutput:
-				ptr, err := sm.ListPackages(proj.Ident(), proj.Version())
-
-				if err != nil {
-					return digestMismatch, hasMissingPkgs, fmt.Errorf("analysis of %s package failed: %v", proj.Ident().ProjectRoot, err)
+		// Get children only for specific outputers
+		// in order to avoid slower status process
+		_, withChildren := out.(*dotOutput)
+
+		// Look up the status of the projects concurrently, as it mostly means
+		// waiting on their sources, but report them in order.
+		statuses := make([]*BasicStatus, len(projects))
+		errs := make([]error, len(projects))
+		work := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < parallel && w < len(projects); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range work {
+					statuses[i], errs[i] = basicStatus(projects[i], p, cm, imported, testOnly, sm, withChildren)
+					if withAge && errs[i] == nil {
+						lookUpAge(statuses[i], projects[i].Ident(), sm)
+					}
 				}
+			}()
+		}
+		for i := range projects {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
 
-				prm, _ := ptr.ToReachMap(true, false, false, nil)
-				bs.Children = prm.FlattenFn(paths.IsStandardImportPath)
-			}
-
-			// Split apart the version from the lock into its constituent parts
-			switch tv := proj.Version().(type) {
-			case gps.UnpairedVersion:
-				bs.Version = tv
-			case gps.Revision:
-				bs.Revision = tv
-			case gps.PairedVersion:
-				bs.Version = tv.Unpair()
-				bs.Revision = tv.Revision()
+		out.BasicHeader()
+		for i, bs := range statuses {
+			if errs[i] != nil {
+				return drift, hasMissingPkgs, errs[i]
 			}
+			out.BasicLine(bs)
+		}
 
-			// Check if the manifest has an override for this project. If so,
-			// set that as the constraint.
-			if pp, has := p.Manifest.Ovr[proj.Ident().ProjectRoot]; has && pp.Constraint != nil {
-				// TODO note somehow that it's overridden
-				bs.Constraint = pp.Constraint
-			} else {
-				bs.Constraint = gps.Any()
-				for _, c := range cm[bs.ProjectRoot] {
-					bs.Constraint = c.Intersect(bs.Constraint)
-				}
+		// Unused constraints are about the whole manifest, so they're left
+		// out when only some projects were asked for. They're reported
+		// before the footer, which writes out the JSON document.
+		if unused := findUnusedConstraints(p.Manifest, p.Lock.Projects(), imported); len(unused) > 0 && only == nil {
+			out.UnusedHeader()
+			for i := range unused {
+				out.UnusedLine(&unused[i])
 			}
-
-			// Only if we have a non-rev and non-plain version do/can we display
-			// anything wrt the version's updateability.
-			if bs.Version != nil && bs.Version.Type() != gps.IsVersion {
-				c, has := p.Manifest.Constraints[proj.Ident().ProjectRoot]
-				if !has {
-					c.Constraint = gps.Any()
-				}
-				// TODO: This constraint is only the constraint imposed by the
-				// current project, not by any transitive deps. As a result,
-				// transitive project deps will always show "any" here.
-				bs.Constraint = c.Constraint
-
-				vl, err := sm.ListVersions(proj.Ident())
-				if err == nil {
-					gps.SortPairedForUpgrade(vl)
-
-					for _, v := range vl {
-						// Because we've sorted the version list for
-						// upgrade, the first version we encounter that
-						// matches our constraint will be what we want.
-						if c.Constraint.Matches(v) {
-							bs.Latest = v.Revision()
-							break
-						}
-					}
-				}
-			}
-
-			out.BasicLine(&bs)
+			out.UnusedFooter()
 		}
 		out.BasicFooter()
 
-		return digestMismatch, hasMissingPkgs, nil
+		return drift, hasMissingPkgs, nil
 	}
 
 	// Hash digest mismatch may indicate that some deps are no longer
@@ -388,10 +1018,7 @@ func runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Project, sm gps.SourceMana
 	//
 	// It's possible for digests to not match, but still have a correct
 	// lock.
-	digestMismatch = true
-	rm, _ := ptree.ToReachMap(true, true, false, nil)
-
-	external := rm.FlattenFn(paths.IsStandardImportPath)
+	drift = findLockDrift(p, ptree)
 	roots := make(map[gps.ProjectRoot][]string, len(external))
 
 	type fail struct {
@@ -421,27 +1048,631 @@ func runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Project, sm gps.SourceMana
 			ctx.Err.Printf("\t%s: %s\n", fail.ex, fail.err.Error())
 		}
 
-		return digestMismatch, hasMissingPkgs, errors.New("address issues with undeducible import paths to get more status information")
+		return drift, hasMissingPkgs, errors.New("address issues with undeducible import paths to get more status information")
+	}
+
+	// Report the missing projects in a deterministic order, too.
+	sortedRoots := make([]string, 0, len(roots))
+	for root := range roots {
+		sortedRoots = append(sortedRoots, string(root))
 	}
+	sort.Strings(sortedRoots)
 
 	out.MissingHeader()
 
 outer:
-	for root, pkgs := range roots {
+	for _, root := range sortedRoots {
 		// TODO also handle the case where the project is present, but there
 		// are items missing from just the package list
 		for _, lp := range slp {
-			if lp.Ident().ProjectRoot == root {
+			if string(lp.Ident().ProjectRoot) == root {
 				continue outer
 			}
 		}
 
 		hasMissingPkgs = true
-		out.MissingLine(&MissingStatus{ProjectRoot: string(root), MissingPackages: pkgs})
+		out.MissingLine(&MissingStatus{ProjectRoot: root, MissingPackages: roots[gps.ProjectRoot(root)]})
 	}
 	out.MissingFooter()
 
-	return digestMismatch, hasMissingPkgs, nil
+	return drift, hasMissingPkgs, nil
+}
+
+// unusedConstraint is a constraint or override of the manifest which has no
+// effect on the solution.
+type unusedConstraint struct {
+	ProjectRoot gps.ProjectRoot
+	Override    bool   // Whether it's an override rather than a constraint
+	Reason      string // Why it has no effect
+}
+
+// Reasons for constraints and overrides to be unused.
+const (
+	unusedNotDependency = "not a dependency"
+	unusedIgnored       = "all its packages are ignored"
+	unusedTransitive    = "only a transitive dependency, which constraints don't apply to; use an override"
+)
+
+func (uc *unusedConstraint) kind() string {
+	if uc.Override {
+		return "override"
+	}
+	return "constraint"
+}
+
+// findUnusedConstraints cross-references the constraints and overrides of m
+// with the solved projects lps and the imported packages, along with the
+// required ones. Overrides apply to
+// transitive dependencies too, so they're only unused when their project isn't
+// solved at all, while constraints only apply to the projects which are
+// imported directly.
+func findUnusedConstraints(m *dep.Manifest, lps []gps.LockedProject, imported map[string]bool) []unusedConstraint {
+	solved := make(map[gps.ProjectRoot]bool, len(lps))
+	for _, lp := range lps {
+		solved[lp.Ident().ProjectRoot] = true
+	}
+	ignored := m.IgnoredPackages()
+
+	// reason tells why the project pr is unused, if it's not solved.
+	reason := func(pr gps.ProjectRoot) string {
+		if pkgtree.IsIgnored(string(pr), ignored) {
+			return unusedIgnored
+		}
+		for ip := range ignored {
+			if isPathPrefix(strings.TrimSuffix(ip, pkgtree.IgnoreWildcardSuffix), string(pr)) {
+				return unusedIgnored
+			}
+		}
+		return unusedNotDependency
+	}
+
+	var unused []unusedConstraint
+	for _, pr := range sortedProjectRoots(m.Constraints) {
+		direct := false
+		for ip := range imported {
+			if isPathPrefix(ip, string(pr)) {
+				direct = true
+				break
+			}
+		}
+		for _, ip := range m.Required {
+			if isPathPrefix(ip, string(pr)) {
+				direct = true
+				break
+			}
+		}
+
+		switch {
+		case !solved[pr]:
+			unused = append(unused, unusedConstraint{ProjectRoot: pr, Reason: reason(pr)})
+		case !direct:
+			unused = append(unused, unusedConstraint{ProjectRoot: pr, Reason: unusedTransitive})
+		}
+	}
+	for _, pr := range sortedProjectRoots(m.Ovr) {
+		if !solved[pr] {
+			unused = append(unused, unusedConstraint{ProjectRoot: pr, Override: true, Reason: reason(pr)})
+		}
+	}
+	return unused
+}
+
+// lockDrift describes how the inputs to solving, from the manifest and the
+// project's imports, differ from those which the lock satisfies.
+type lockDrift struct {
+	addedImports       []string // Imported packages which no locked project provides
+	removedImports     []string // Locked projects which nothing imports any more
+	addedConstraints   []string // Constrained projects which aren't locked
+	changedConstraints []string // Constraints which the locked projects don't satisfy
+}
+
+// print describes the drift to l, one kind of change per line.
+func (d *lockDrift) print(l *log.Logger) {
+	empty := true
+	for _, c := range []struct {
+		what  string
+		items []string
+	}{
+		{"imports added", d.addedImports},
+		{"imports removed", d.removedImports},
+		{"constraints added", d.addedConstraints},
+		{"constraints not satisfied by the lock", d.changedConstraints},
+	} {
+		if len(c.items) > 0 {
+			l.Printf("  %s: %s\n", c.what, strings.Join(c.items, ", "))
+			empty = false
+		}
+	}
+	if empty {
+		l.Println("  a constraint, override or ignored package was removed or changed without affecting the lock")
+	}
+}
+
+// findPruneDrift returns the locked projects, sorted, which the lock records as
+// pruned with other options than the manifest gives for them.
+func findPruneDrift(p *dep.Project) []gps.ProjectRoot {
+	var roots []string
+	for _, lp := range p.Lock.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if p.Lock.PruneOptionsFor(pr) != p.Manifest.PruneOptions.PruneOptionsFor(pr) {
+			roots = append(roots, string(pr))
+		}
+	}
+	sort.Strings(roots)
+
+	drift := make([]gps.ProjectRoot, len(roots))
+	for i, pr := range roots {
+		drift[i] = gps.ProjectRoot(pr)
+	}
+	return drift
+}
+
+// findLocalSources returns the locked projects which are from directories on
+// the local filesystem, rather than from sources others can fetch.
+func findLocalSources(l *dep.Lock) []gps.LockedProject {
+	var local []gps.LockedProject
+	for _, lp := range l.Projects() {
+		if gps.IsLocalSource(lp.Ident().Source) {
+			local = append(local, lp)
+		}
+	}
+	return local
+}
+
+// lockDriftError is returned when the lock is out of sync. dep then exits with
+// status 2, so scripts can tell it apart from other failures.
+type lockDriftError struct{}
+
+func (lockDriftError) Error() string {
+	return "Gopkg.lock is out of sync, run `dep ensure` to update it"
+}
+
+func (lockDriftError) ExitCode() int { return 2 }
+
+// findLockDrift diffs the inputs to solving which are hashed for the
+// inputs-digest against the lock. The lock doesn't record the inputs it was
+// solved for, so removed constraints and ignored packages can't be told, and
+// removed imports are only found when all the locked projects are vendored.
+func findLockDrift(p *dep.Project, ptree pkgtree.PackageTree) *lockDrift {
+	ignored := p.Manifest.IgnoredPackages()
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.ExcludeTests, false, ignored)
+
+	var imports []string
+	seen := make(map[string]bool)
+	for _, ip := range append(rm.FlattenFn(paths.IsStandardImportPath), p.Manifest.Required...) {
+		if !seen[ip] && !pkgtree.IsIgnored(ip, ignored) {
+			imports = append(imports, ip)
+			seen[ip] = true
+		}
+	}
+	sort.Strings(imports)
+
+	d := &lockDrift{}
+	for _, ip := range imports {
+		if !isLockedPackage(p.Lock, ip) {
+			d.addedImports = append(d.addedImports, ip)
+		}
+	}
+
+	locked := make(map[gps.ProjectRoot]gps.LockedProject, len(p.Lock.P))
+	for _, lp := range p.Lock.P {
+		locked[lp.Ident().ProjectRoot] = lp
+	}
+	checkConstraint := func(pr gps.ProjectRoot, pp gps.ProjectProperties, lp gps.LockedProject) {
+		switch {
+		case pp.Constraint != nil && !pp.Constraint.Matches(lp.Version()):
+			d.changedConstraints = append(d.changedConstraints, fmt.Sprintf("%s (%s, locked at %s)", pr, formatConstraint(pp.Constraint), formatVersion(lp.Version())))
+		case pp.Source != lp.Ident().Source:
+			d.changedConstraints = append(d.changedConstraints, fmt.Sprintf("%s (source %q, locked from %q)", pr, pp.Source, lp.Ident().Source))
+		}
+	}
+
+	// Like the hash, only take the constraints on imported projects into
+	// account, while overrides apply to any locked project.
+	for _, pr := range sortedProjectRoots(p.Manifest.Constraints) {
+		imported := false
+		for _, ip := range imports {
+			if isPathPrefix(ip, string(pr)) {
+				imported = true
+				break
+			}
+		}
+		if !imported {
+			continue
+		}
+
+		if lp, has := locked[pr]; has {
+			checkConstraint(pr, p.Manifest.Constraints[pr], lp)
+		} else {
+			d.addedConstraints = append(d.addedConstraints, string(pr))
+		}
+	}
+	for _, pr := range sortedProjectRoots(p.Manifest.Ovr) {
+		if lp, has := locked[pr]; has {
+			checkConstraint(pr, p.Manifest.Ovr[pr], lp)
+		}
+	}
+
+	// Follow the imports through vendor/ to find the locked projects which
+	// are still used, directly or not.
+	vendored := make(map[string]pkgtree.PackageOrErr)
+	for pr := range locked {
+		vt, err := pkgtree.ListPackages(filepath.Join(p.AbsRoot, "vendor", filepath.FromSlash(string(pr))), string(pr))
+		if err != nil {
+			return d
+		}
+		for ip, poe := range vt.Packages {
+			vendored[ip] = poe
+		}
+	}
+	used := make(map[gps.ProjectRoot]bool)
+	visited := make(map[string]bool)
+	queue := append([]string(nil), imports...)
+	for len(queue) > 0 {
+		ip := queue[0]
+		queue = queue[1:]
+		if visited[ip] {
+			continue
+		}
+		visited[ip] = true
+
+		for pr := range locked {
+			if isPathPrefix(ip, string(pr)) {
+				used[pr] = true
+			}
+		}
+		if poe, ok := vendored[ip]; ok && poe.Err == nil {
+			queue = append(queue, poe.P.Imports...)
+		}
+	}
+	for _, lp := range p.Lock.Projects() {
+		if !used[lp.Ident().ProjectRoot] {
+			d.removedImports = append(d.removedImports, string(lp.Ident().ProjectRoot))
+		}
+	}
+	sort.Strings(d.removedImports)
+
+	return d
+}
+
+// sortedProjectRoots returns the project roots of pc in order.
+func sortedProjectRoots(pc gps.ProjectConstraints) []gps.ProjectRoot {
+	names := make([]string, 0, len(pc))
+	for pr := range pc {
+		names = append(names, string(pr))
+	}
+	sort.Strings(names)
+
+	roots := make([]gps.ProjectRoot, len(names))
+	for i, name := range names {
+		roots[i] = gps.ProjectRoot(name)
+	}
+	return roots
+}
+
+// runStatusMissing prints the packages which are imported by the project but
+// not provided by a locked project, and the locked packages which are missing
+// from vendor/. When noVendor is set and the project has no vendor/ directory,
+// or an empty one, the locked packages aren't expected there. It returns how many packages are
+// missing.
+func runStatusMissing(ctx *dep.Ctx, p *dep.Project, noVendor bool) (int, error) {
+	if p.Lock == nil {
+		return 0, errors.Errorf("no Gopkg.lock found. Run `dep ensure` to generate lock file")
+	}
+
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		return 0, errors.Errorf("analysis of local packages failed: %v", err)
+	}
+
+	ignored := p.Manifest.IgnoredPackages()
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.ExcludeTests, false, ignored)
+
+	var unlocked []string
+	for _, ip := range rm.FlattenFn(paths.IsStandardImportPath) {
+		if pkgtree.IsIgnored(ip, ignored) || isLockedPackage(p.Lock, ip) {
+			continue
+		}
+		unlocked = append(unlocked, ip)
+	}
+
+	checkVendor := true
+	if noVendor {
+		hasVendor, err := fs.IsNonEmptyDir(filepath.Join(p.AbsRoot, "vendor"))
+		if err != nil {
+			return 0, err
+		}
+		checkVendor = hasVendor
+	}
+
+	var unvendored []string
+	if checkVendor {
+		for _, lp := range p.Lock.Projects() {
+			for _, pkg := range lp.Packages() {
+				ip := path.Join(string(lp.Ident().ProjectRoot), pkg)
+				dir := filepath.Join(p.AbsRoot, "vendor", filepath.FromSlash(ip))
+				if _, err := fs.IsDir(dir); err != nil {
+					unvendored = append(unvendored, ip)
+				}
+			}
+		}
+	}
+	sort.Strings(unvendored)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	if len(unlocked) > 0 {
+		fmt.Fprintln(w, "PACKAGE\tIMPORTED BY")
+		for _, ip := range unlocked {
+			fmt.Fprintf(w, "%s\t%s\t\n", ip, strings.Join(importChain(ptree, ignored, ip), " -> "))
+		}
+		w.Flush()
+	}
+	if len(unvendored) > 0 {
+		if len(unlocked) > 0 {
+			fmt.Fprintln(&buf)
+		}
+		fmt.Fprintln(&buf, "Locked packages missing from vendor/:")
+		fmt.Fprintln(&buf)
+		for _, ip := range unvendored {
+			fmt.Fprintln(&buf, ip)
+		}
+	}
+	ctx.Out.Print(buf.String())
+
+	return len(unlocked) + len(unvendored), nil
+}
+
+// runStatusLicenses prints the licenses detected for each locked project from
+// its license files in vendor/, warning about the projects without any.
+func runStatusLicenses(ctx *dep.Ctx, p *dep.Project) error {
+	if p.Lock == nil {
+		return errors.Errorf("no Gopkg.lock found. Run `dep ensure` to generate lock file")
+	}
+
+	slp := p.Lock.Projects()
+	sort.Sort(dep.SortedLockedProjects(slp))
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tLICENSE\tFILE")
+	var unlicensed []string
+	for _, lp := range slp {
+		pr := string(lp.Ident().ProjectRoot)
+		vendored := path.Join("vendor", pr)
+		licenses, err := license.Detect(filepath.Join(p.AbsRoot, filepath.FromSlash(vendored)))
+		if os.IsNotExist(err) {
+			fmt.Fprintf(w, "%s\t?\tnot vendored\t\n", pr)
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "detecting the license of %s", pr)
+		}
+
+		if len(licenses) == 0 {
+			unlicensed = append(unlicensed, pr)
+			fmt.Fprintf(w, "%s\tNONE\tno license file found\t\n", pr)
+		}
+		for _, l := range licenses {
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", pr, l.Name, path.Join(vendored, l.File))
+		}
+	}
+	w.Flush()
+	ctx.Out.Print(buf.String())
+
+	if len(unlicensed) > 0 {
+		ctx.Err.Printf("\nWARNING: no license file was found for %d project(s): %s\n", len(unlicensed), strings.Join(unlicensed, ", "))
+	}
+	return nil
+}
+
+// isLockedPackage reports whether a locked project provides the package ip.
+func isLockedPackage(l *dep.Lock, ip string) bool {
+	for _, lp := range l.P {
+		if isPathPrefix(ip, string(lp.Ident().ProjectRoot)) {
+			return true
+		}
+	}
+	return false
+}
+
+// importChain returns the shortest chain of imports by which one of the
+// packages in ptree, the first in lexical order which can, imports the
+// external package ip. The chain starts with that package and ends with ip.
+func importChain(ptree pkgtree.PackageTree, ignored map[string]bool, ip string) []string {
+	imports := func(pkg string) []string {
+		poe, ok := ptree.Packages[pkg]
+		if !ok || poe.Err != nil || pkgtree.IsIgnored(pkg, ignored) {
+			return nil
+		}
+		return append(append([]string(nil), poe.P.Imports...), poe.P.TestImports...)
+	}
+
+	pkgs := make([]string, 0, len(ptree.Packages))
+	for pkg := range ptree.Packages {
+		if !pkgtree.IsIgnored(pkg, ignored) {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+
+	chain := shortestImportChain(pkgs, imports, func(imp string) bool { return imp == ip })
+	if chain == nil {
+		return []string{ip}
+	}
+	return chain
+}
+
+// basicStatus works out the status of the locked project proj, given the
+// packages the root project imports, and those it imports only from its tests.
+// The error of listing the project's versions is recorded in the status, rather
+// than returned, so that it can be reported alongside the other projects.
+func basicStatus(proj gps.LockedProject, p *dep.Project, cm map[string][]gps.Constraint, imported, testOnly map[string]bool, sm gps.SourceManager, withChildren bool) (*BasicStatus, error) {
+	bs := &BasicStatus{
+		ProjectRoot:  string(proj.Ident().ProjectRoot),
+		Source:       proj.Ident().Source,
+		PackageCount: len(proj.Packages()),
+		Direct:       importsLockedProject(imported, proj),
+		Required:     importsLockedProject(p.Manifest.RequiredPackages(), proj),
+		Test:         importedOnlyByTests(imported, testOnly, proj),
+	}
+
+	if withChildren {
+		ptr, err := sm.ListPackages(proj.Ident(), proj.Version())
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "analysis of %s package failed", proj.Ident().ProjectRoot)
+		}
+
+		prm, _ := ptr.ToReachMap(true, false, false, nil)
+		bs.Children = prm.FlattenFn(paths.IsStandardImportPath)
+	}
+
+	// Split apart the version from the lock into its constituent parts
+	switch tv := proj.Version().(type) {
+	case gps.UnpairedVersion:
+		bs.Version = tv
+	case gps.Revision:
+		bs.Revision = tv
+	case gps.PairedVersion:
+		bs.Version = tv.Unpair()
+		bs.Revision = tv.Revision()
+	}
+
+	// Check if the manifest has an override for this project. If so,
+	// set that as the constraint.
+	if pp, has := p.Manifest.Ovr[proj.Ident().ProjectRoot]; has && pp.Constraint != nil {
+		// TODO note somehow that it's overridden
+		bs.Constraint = pp.Constraint
+	} else {
+		bs.Constraint = gps.Any()
+		for _, c := range cm[bs.ProjectRoot] {
+			bs.Constraint = c.Intersect(bs.Constraint)
+		}
+	}
+	// A gopkg.in project is implicitly constrained to the major version its
+	// import path names, which is shown rather than any.
+	bs.Constraint = gps.EffectiveConstraint(proj.Ident().ProjectRoot, bs.Constraint)
+
+	// Only if we have a non-rev and non-plain version do/can we display
+	// anything wrt the version's updateability.
+	if bs.Version != nil && bs.Version.Type() != gps.IsVersion {
+		c, has := p.Manifest.Constraints[proj.Ident().ProjectRoot]
+		if !has {
+			c.Constraint = gps.Any()
+		}
+		// TODO: This constraint is only the constraint imposed by the
+		// current project, not by any transitive deps. As a result,
+		// transitive project deps will always show "any" here.
+		bs.Constraint = gps.EffectiveConstraint(proj.Ident().ProjectRoot, c.Constraint)
+
+		vl, err := sm.ListVersions(proj.Ident())
+		if err != nil {
+			bs.LatestErr = err
+			return bs, nil
+		}
+		gps.SortPairedForUpgrade(vl)
+
+		for _, v := range vl {
+			// Because we've sorted the version list for
+			// upgrade, the first version we encounter that
+			// matches our constraint will be what we want.
+			if c.Constraint.Matches(v) {
+				bs.Latest = v.Revision()
+				break
+			}
+		}
+
+		// Likewise, the first semver version is the newest
+		// overall, whether or not the constraint allows it.
+		if bs.Version.Type() == gps.IsSemver {
+			for _, v := range vl {
+				if v.Type() == gps.IsSemver {
+					bs.Newest = v
+					break
+				}
+			}
+		}
+	}
+
+	return bs, nil
+}
+
+// lookUpAge fills in when the locked revision of the project was committed, and
+// how many commits behind the latest allowed revision it is, leaving either
+// unknown if the source can't tell.
+func lookUpAge(bs *BasicStatus, id gps.ProjectIdentifier, sm gps.SourceManager) {
+	if bs.Revision == "" {
+		return
+	}
+
+	if t, err := sm.RevisionTime(id, bs.Revision); err == nil {
+		bs.RevisionTime = t
+	}
+
+	latest, ok := bs.Latest.(gps.Revision)
+	if !ok {
+		return
+	}
+	if latest == bs.Revision {
+		bs.CommitsBehind = new(int)
+	} else if n, err := sm.CountCommitsBetween(id, bs.Revision, latest); err == nil {
+		bs.CommitsBehind = &n
+	}
+}
+
+// lockedProjectRoots returns the roots of the locked projects providing pkgs.
+// Packages which aren't provided by any locked project are listed together in
+// the returned error.
+func lockedProjectRoots(pkgs []string, l *dep.Lock, sm gps.SourceManager) (map[gps.ProjectRoot]bool, error) {
+	locked := make(map[gps.ProjectRoot]bool, len(l.P))
+	for _, lp := range l.P {
+		locked[lp.Ident().ProjectRoot] = true
+	}
+
+	roots := make(map[gps.ProjectRoot]bool, len(pkgs))
+	var unknown []string
+	for _, pkg := range pkgs {
+		pr, err := sm.DeduceProjectRoot(pkg)
+		if err != nil || !locked[pr] {
+			unknown = append(unknown, pkg)
+			continue
+		}
+		roots[pr] = true
+	}
+
+	if len(unknown) > 0 {
+		return nil, errors.Errorf("not provided by any project in Gopkg.lock: %s", strings.Join(unknown, ", "))
+	}
+	return roots, nil
+}
+
+// importsLockedProject reports whether any of the packages of lp are among the
+// imported packages.
+func importsLockedProject(imported map[string]bool, lp gps.LockedProject) bool {
+	for _, pkg := range lp.Packages() {
+		if imported[path.Join(string(lp.Ident().ProjectRoot), pkg)] {
+			return true
+		}
+	}
+	return false
+}
+
+// importedOnlyByTests reports whether the only packages of lp which are
+// imported are among those imported only by tests, testOnly. A package imported
+// both from tests and from other files makes lp a dependency like any other.
+func importedOnlyByTests(imported, testOnly map[string]bool, lp gps.LockedProject) bool {
+	var any bool
+	for _, pkg := range lp.Packages() {
+		ip := path.Join(string(lp.Ident().ProjectRoot), pkg)
+		if imported[ip] {
+			if !testOnly[ip] {
+				return false
+			}
+			any = true
+		}
+	}
+	return any
 }
 
 func formatVersion(v gps.Version) string {
@@ -461,6 +1692,60 @@ func formatVersion(v gps.Version) string {
 	return v.String()
 }
 
+// formatLatest formats the latest revision of the project, or the first line of
+// the error looking it up. It is unknown when offline.
+func formatLatest(bs *BasicStatus) string {
+	if isOfflineError(bs.LatestErr) {
+		return "unknown"
+	}
+	if bs.LatestErr != nil {
+		return "error: " + strings.SplitN(bs.LatestErr.Error(), "\n", 2)[0]
+	}
+	return formatVersion(bs.Latest)
+}
+
+func formatRevisionTime(t time.Time) string {
+	if t.IsZero() {
+		return "n/a"
+	}
+	return t.Format("2006-01-02")
+}
+
+func formatCommitsBehind(n *int) string {
+	if n == nil {
+		return "n/a"
+	}
+	return strconv.Itoa(*n)
+}
+
+// formatDirect tells whether a project is imported by the current project, or
+// else only brought in by the required list of the manifest, or neither.
+func formatDirect(direct, required bool) string {
+	switch {
+	case direct:
+		return "yes"
+	case required:
+		return "required"
+	}
+	return "no"
+}
+
+// formatTest tells whether a project is imported only by the tests of the
+// current project.
+func formatTest(test bool) string {
+	if test {
+		return "yes"
+	}
+	return "no"
+}
+
+func formatConstraint(c gps.Constraint) string {
+	if v, ok := c.(gps.Version); ok {
+		return formatVersion(v)
+	}
+	return c.String()
+}
+
 func collectConstraints(ptree pkgtree.PackageTree, p *dep.Project, sm gps.SourceManager) map[string][]gps.Constraint {
 	// TODO
 	return map[string][]gps.Constraint{}
@@ -6,12 +6,21 @@ package main
 
 import (
 	"bytes"
-	"testing"
-
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"testing"
+	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 func TestStatusFormatVersion(t *testing.T) {
@@ -31,9 +40,32 @@ func TestStatusFormatVersion(t *testing.T) {
 	}
 }
 
+func TestStatusFormatConstraint(t *testing.T) {
+	t.Parallel()
+
+	union, _ := gps.NewSemverConstraintIC(">=1.2.0, <2.0.0 || >=3.1.0")
+	caret, _ := gps.NewSemverConstraintIC("1.2.0")
+	excl, _ := gps.NewSemverConstraintIC("1.4.0, !=1.4.2")
+	tests := []struct {
+		c        gps.Constraint
+		expected string
+	}{
+		{union, "^1.2.0 || >=3.1.0"},
+		{caret, "^1.2.0"},
+		{excl, "^1.4.0, !=1.4.2"},
+		{gps.NewBranch("master"), "branch master"},
+		{gps.Revision("flooboofoobooo"), "flooboo"},
+	}
+	for _, test := range tests {
+		if str := formatConstraint(test.c); str != test.expected {
+			t.Fatalf("expected '%v', got '%v'", test.expected, str)
+		}
+	}
+}
+
 func TestBasicLine(t *testing.T) {
 
-	project := dep.Project{}
+	project := dep.Project{Manifest: &dep.Manifest{}}
 
 	var tests = []struct {
 		status   BasicStatus
@@ -65,3 +97,707 @@ func TestBasicLine(t *testing.T) {
 		}
 	}
 }
+
+func TestJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	out := &jsonOutput{w: &buf}
+
+	c, _ := gps.NewSemverConstraint("^1.0.0")
+	out.BasicHeader()
+	out.BasicLine(&BasicStatus{
+		ProjectRoot:  "github.com/sdboyer/deptest",
+		Constraint:   c,
+		Version:      gps.NewVersion("v1.0.0"),
+		Revision:     gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		Latest:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		PackageCount: 1,
+		Direct:       true,
+	})
+	out.BasicLine(&BasicStatus{
+		ProjectRoot:  "github.com/sdboyer/deptestdos",
+		Constraint:   gps.Any(),
+		Revision:     gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+		PackageCount: 2,
+	})
+	out.BasicFooter()
+
+	want := `{"in-sync":true,"projects":[` +
+		`{"PROJECT":"github.com/sdboyer/deptest","CONSTRAINT":"^1.0.0","VERSION":"v1.0.0","REVISION":"ff2948a2ac8f538c4ecd55962e919d1e13e74baf","LATEST":"ff2948a2ac8f538c4ecd55962e919d1e13e74baf","PKGS_USED":1,"DIRECT":true},` +
+		`{"PROJECT":"github.com/sdboyer/deptestdos","CONSTRAINT":"*","VERSION":"","REVISION":"5c607206be5decd28e6263ffffdcee067266015e","LATEST":"","PKGS_USED":2,"DIRECT":false}` +
+		"]}\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected JSON output:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+
+	buf.Reset()
+	out.MissingHeader()
+	out.MissingLine(&MissingStatus{
+		ProjectRoot:     "github.com/sdboyer/deptest",
+		MissingPackages: []string{"github.com/sdboyer/deptest"},
+	})
+	out.MissingFooter()
+
+	want = `{"in-sync":false,"projects":[],"missing":[{"PROJECT":"github.com/sdboyer/deptest","MISSING_PACKAGES":["github.com/sdboyer/deptest"]}]}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected JSON output:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+}
+
+func TestStatusValidateFlags(t *testing.T) {
+	testCases := map[string]struct {
+		cmd     statusCommand
+		wantErr bool
+	}{
+		"table":             {cmd: statusCommand{}},
+		"json":              {cmd: statusCommand{json: true}},
+		"dot":               {cmd: statusCommand{dot: true}},
+		"json and dot":      {cmd: statusCommand{json: true, dot: true}, wantErr: true},
+		"json and detail":   {cmd: statusCommand{json: true, detailed: true}, wantErr: true},
+		"template":          {cmd: statusCommand{template: "{{.ProjectRoot}}"}},
+		"template and dot":  {cmd: statusCommand{template: "{{.ProjectRoot}}", dot: true}, wantErr: true},
+		"old":               {cmd: statusCommand{old: true}},
+		"old and json":      {cmd: statusCommand{old: true, json: true}, wantErr: true},
+		"no parallelism":    {cmd: statusCommand{parallel: -1}, wantErr: true},
+		"offline":           {cmd: statusCommand{offline: true, json: true}},
+		"old and offline":   {cmd: statusCommand{old: true, offline: true}, wantErr: true},
+		"licenses":          {cmd: statusCommand{licenses: true}},
+		"licenses and json": {cmd: statusCommand{licenses: true, json: true}, wantErr: true},
+		"age and json":      {cmd: statusCommand{age: true, json: true}},
+		"age and old":       {cmd: statusCommand{age: true, old: true}, wantErr: true},
+		"csv and old":       {cmd: statusCommand{csv: true, old: true}},
+		"no-vendor":         {cmd: statusCommand{missing: true, noVendor: true}},
+		"no-vendor alone":   {cmd: statusCommand{noVendor: true}, wantErr: true},
+		"csv and json":      {cmd: statusCommand{csv: true, json: true}, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		if tc.cmd.parallel == 0 {
+			tc.cmd.parallel = 1
+		}
+		err := tc.cmd.validateFlags()
+		if tc.wantErr && err == nil {
+			t.Errorf("%s: expected the output formats to be rejected", name)
+		} else if !tc.wantErr && err != nil {
+			t.Errorf("%s: unexpected error %s", name, err)
+		}
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("status").Parse("{{.ProjectRoot}} {{.Source}} {{.Constraint}} {{.Version}} {{.Revision}} {{.Latest}} {{.PackageCount}} {{.Direct}}"))
+	out := &templateOutput{w: &buf, tmpl: tmpl}
+
+	c, _ := gps.NewSemverConstraint("^1.0.0")
+	out.BasicHeader()
+	out.BasicLine(&BasicStatus{
+		ProjectRoot:  "github.com/sdboyer/deptest",
+		Source:       "https://github.com/carolynvs/deptest",
+		Constraint:   c,
+		Version:      gps.NewVersion("v1.0.0"),
+		Revision:     gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		Latest:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		PackageCount: 1,
+		Direct:       true,
+	})
+	out.BasicLine(&BasicStatus{
+		ProjectRoot:  "github.com/sdboyer/deptestdos",
+		Constraint:   gps.Any(),
+		Version:      gps.NewBranch("master"),
+		Revision:     gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+		PackageCount: 2,
+	})
+	out.BasicFooter()
+
+	want := "github.com/sdboyer/deptest https://github.com/carolynvs/deptest ^1.0.0 v1.0.0 ff2948a2ac8f538c4ecd55962e919d1e13e74baf ff2948a2ac8f538c4ecd55962e919d1e13e74baf 1 true\n" +
+		"github.com/sdboyer/deptestdos  * master 5c607206be5decd28e6263ffffdcee067266015e  2 false\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected template output:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+	if out.err != nil {
+		t.Fatal(out.err)
+	}
+
+	buf.Reset()
+	out = &templateOutput{w: &buf, tmpl: template.Must(template.New("status").Parse("{{.Missing}}"))}
+	out.BasicLine(&BasicStatus{ProjectRoot: "github.com/sdboyer/deptest"})
+	if out.err == nil {
+		t.Fatal("Expected an error executing a template with an unknown field")
+	}
+}
+
+func TestOldOutput(t *testing.T) {
+	var buf bytes.Buffer
+	out := &oldOutput{tableOutput: tableOutput{w: tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)}}
+
+	rev := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	newer := gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f")
+	caret, _ := gps.NewSemverConstraint("^0.8.0")
+
+	out.BasicHeader()
+	// Locked to the newest version, allowed or not
+	out.BasicLine(&BasicStatus{
+		ProjectRoot: "github.com/sdboyer/current",
+		Constraint:  caret,
+		Version:     gps.NewVersion("v0.8.0"),
+		Revision:    rev,
+		Latest:      rev,
+		Newest:      gps.NewVersion("v0.8.0").Pair(rev),
+	})
+	// A newer version is allowed
+	out.BasicLine(&BasicStatus{
+		ProjectRoot:  "github.com/sdboyer/allowed",
+		Constraint:   caret,
+		Version:      gps.NewVersion("v0.8.0"),
+		Revision:     rev,
+		Latest:       newer,
+		Newest:       gps.NewVersion("v0.8.1").Pair(newer),
+		PackageCount: 1,
+		Direct:       true,
+	})
+	// A newer version is excluded by the constraint
+	out.BasicLine(&BasicStatus{
+		ProjectRoot: "github.com/sdboyer/excluded",
+		Constraint:  caret,
+		Version:     gps.NewVersion("v0.8.0"),
+		Revision:    rev,
+		Latest:      rev,
+		Newest:      gps.NewVersion("v1.0.0").Pair(newer),
+	})
+	out.BasicFooter()
+
+	want := "PROJECT                     CONSTRAINT  VERSION  REVISION  LATEST   PKGS USED  DIRECT  TEST\n" +
+		"github.com/sdboyer/allowed  ^0.8.0      v0.8.0   ff2948a   3f4c3be  1          yes     no  \n" +
+		"\n" +
+		"Newer versions excluded by the constraints:\n" +
+		"\n" +
+		"PROJECT                      CONSTRAINT  VERSION  NEWEST  DIRECT\n" +
+		"github.com/sdboyer/excluded  ^0.8.0      v0.8.0   v1.0.0  no  \n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected -old output:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, want)
+	}
+	if out.count != 2 {
+		t.Fatalf("Expected 2 out-of-date dependencies, got %d", out.count)
+	}
+}
+
+func TestLockedProjectRoots(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	l := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.NewVersion("v2.0.0"), []string{"."}),
+		},
+	}
+
+	roots, err := lockedProjectRoots([]string{"github.com/sdboyer/deptest/foo", "github.com/sdboyer/deptest"}, l, sm)
+	h.Must(err)
+	if len(roots) != 1 || !roots["github.com/sdboyer/deptest"] {
+		t.Fatalf("Expected only github.com/sdboyer/deptest to be selected, got %v", roots)
+	}
+
+	_, err = lockedProjectRoots([]string{"github.com/sdboyer/deptest", "github.com/pkg/errors", "github.com/golang/notexist/foo"}, l, sm)
+	if err == nil {
+		t.Fatal("Expected an error for packages which aren't in the lock")
+	}
+	for _, pkg := range []string{"github.com/pkg/errors", "github.com/golang/notexist/foo"} {
+		if !strings.Contains(err.Error(), pkg) {
+			t.Errorf("Expected the error to name %s, got %s", pkg, err)
+		}
+	}
+	if strings.Contains(err.Error(), "github.com/sdboyer/deptest,") {
+		t.Errorf("Expected the error not to name the locked project, got %s", err)
+	}
+}
+
+func TestImportsLockedProject(t *testing.T) {
+	imported := map[string]bool{
+		"github.com/sdboyer/deptest/foo": true,
+		"github.com/sdboyer/deptestdos":  true,
+	}
+
+	testCases := map[string]struct {
+		lp   gps.LockedProject
+		want bool
+	}{
+		"subpackage": {
+			lp:   gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0"), []string{".", "foo"}),
+			want: true,
+		},
+		"root package": {
+			lp:   gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.NewVersion("v2.0.0"), []string{"."}),
+			want: true,
+		},
+		"transitive": {
+			lp:   gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptesttres"}, gps.NewVersion("v1.0.0"), []string{"."}),
+			want: false,
+		},
+		"unused package of an imported project": {
+			lp:   gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0"), []string{"."}),
+			want: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		if got := importsLockedProject(imported, tc.lp); got != tc.want {
+			t.Errorf("%s: expected importsLockedProject to be %t, got %t", name, tc.want, got)
+		}
+	}
+}
+
+func TestImportChain(t *testing.T) {
+	pkg := func(ip string, imports ...string) pkgtree.PackageOrErr {
+		return pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Imports: imports}}
+	}
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "github.com/golang/notexist",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"github.com/golang/notexist":          pkg("github.com/golang/notexist", "github.com/golang/notexist/a", "github.com/golang/notexist/b"),
+			"github.com/golang/notexist/a":        pkg("github.com/golang/notexist/a", "github.com/golang/notexist/a/deeper"),
+			"github.com/golang/notexist/a/deeper": pkg("github.com/golang/notexist/a/deeper", "github.com/sdboyer/deptest"),
+			"github.com/golang/notexist/b":        pkg("github.com/golang/notexist/b", "github.com/sdboyer/deptest", "github.com/sdboyer/deptestdos"),
+		},
+	}
+
+	testCases := map[string]struct {
+		ip      string
+		ignored map[string]bool
+		want    []string
+	}{
+		"shortest chain": {
+			ip:   "github.com/sdboyer/deptest",
+			want: []string{"github.com/golang/notexist", "github.com/golang/notexist/b", "github.com/sdboyer/deptest"},
+		},
+		"around an ignored package": {
+			ip:      "github.com/sdboyer/deptest",
+			ignored: map[string]bool{"github.com/golang/notexist/b": true},
+			want:    []string{"github.com/golang/notexist", "github.com/golang/notexist/a", "github.com/golang/notexist/a/deeper", "github.com/sdboyer/deptest"},
+		},
+		"not imported": {
+			ip:   "github.com/sdboyer/deptesttres",
+			want: []string{"github.com/sdboyer/deptesttres"},
+		},
+	}
+
+	for name, tc := range testCases {
+		if got := importChain(ptree, tc.ignored, tc.ip); !equalSlice(got, tc.want) {
+			t.Errorf("%s: expected the import chain %v, got %v", name, tc.want, got)
+		}
+	}
+}
+
+func TestBasicStatus(t *testing.T) {
+	rev := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	newer := gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f")
+	newest := gps.Revision("5c607206be5decd28e6263ffffdcee067266015e")
+	caret, _ := gps.NewSemverConstraint("^0.8.0")
+
+	p := &dep.Project{
+		Manifest: &dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				"github.com/sdboyer/deptest": gps.ProjectProperties{Constraint: caret},
+			},
+		},
+	}
+	lp := gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v0.8.0").Pair(rev), []string{"."})
+	imported := map[string]bool{"github.com/sdboyer/deptest": true}
+
+	sm := versionListSourceManager{
+		versions: []gps.PairedVersion{
+			gps.NewVersion("v0.8.0").Pair(rev),
+			gps.NewVersion("v0.8.1").Pair(newer),
+			gps.NewVersion("v1.0.0").Pair(newest),
+		},
+	}
+	bs, err := basicStatus(lp, p, nil, imported, nil, sm, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs.Latest != newer {
+		t.Errorf("Expected the latest allowed revision to be %s, got %v", newer, bs.Latest)
+	}
+	if bs.Newest == nil || bs.Newest.String() != "v1.0.0" {
+		t.Errorf("Expected the newest version to be v1.0.0, got %v", bs.Newest)
+	}
+	if !bs.Direct {
+		t.Error("Expected the project to be a direct dependency")
+	}
+
+	sm = versionListSourceManager{err: errors.New("no valid source could be created:\n\tfailed to set up")}
+	bs, err = basicStatus(lp, p, nil, imported, nil, sm, false)
+	if err != nil {
+		t.Fatalf("Expected the error listing versions to be recorded in the status, got %s", err)
+	}
+	if bs.LatestErr == nil {
+		t.Fatal("Expected the error listing versions to be recorded in the status")
+	}
+	if got, want := formatLatest(bs), "error: no valid source could be created:"; got != want {
+		t.Errorf("Expected the latest version to be reported as %q, got %q", want, got)
+	}
+
+	// A project which is only brought in by the required list is neither
+	// direct nor transitive.
+	p.Manifest.Required = []string{"github.com/sdboyer/deptest"}
+	bs, err = basicStatus(lp, p, nil, nil, nil, sm, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs.Direct || !bs.Required {
+		t.Errorf("Expected the project to be required but not direct, got direct: %v, required: %v", bs.Direct, bs.Required)
+	}
+	if got := formatDirect(bs.Direct, bs.Required); got != "required" {
+		t.Errorf("Expected the project to be reported as required, got %q", got)
+	}
+}
+
+func TestImportedOnlyByTests(t *testing.T) {
+	lp := gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v0.8.0"), []string{".", "sub"})
+	cases := []struct {
+		name               string
+		imported, testOnly []string
+		want               bool
+	}{
+		{"not imported", nil, nil, false},
+		{"imported", []string{"github.com/sdboyer/deptest"}, nil, false},
+		{"imported by tests", []string{"github.com/sdboyer/deptest"}, []string{"github.com/sdboyer/deptest"}, true},
+		// One package imported outside of tests makes the project a
+		// dependency like any other.
+		{"one package imported by tests", []string{"github.com/sdboyer/deptest", "github.com/sdboyer/deptest/sub"}, []string{"github.com/sdboyer/deptest/sub"}, false},
+	}
+	set := func(ips []string) map[string]bool {
+		m := make(map[string]bool)
+		for _, ip := range ips {
+			m[ip] = true
+		}
+		return m
+	}
+	for _, c := range cases {
+		if got := importedOnlyByTests(set(c.imported), set(c.testOnly), lp); got != c.want {
+			t.Errorf("%s: expected %t, got %t", c.name, c.want, got)
+		}
+	}
+}
+
+func TestFindLockDrift(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("project")
+	h.TempFile("project/vendor/github.com/sdboyer/deptest/deptest.go", "package deptest\n\nimport _ \"github.com/sdboyer/deptestdos\"\n")
+	h.TempFile("project/vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos\n")
+	h.TempFile("project/vendor/github.com/carolynvs/deptest/deptest.go", "package deptest\n")
+
+	pkg := func(ip string, imports ...string) pkgtree.PackageOrErr {
+		return pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Imports: imports}}
+	}
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "github.com/golang/notexist",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"github.com/golang/notexist": pkg("github.com/golang/notexist", "github.com/sdboyer/deptest", "github.com/pkg/errors"),
+		},
+	}
+
+	lock := func(pr, source string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr), Source: source}, gps.NewVersion("v1.0.0"), []string{"."})
+	}
+	caret, _ := gps.NewSemverConstraint("^1.0.0")
+	p := &dep.Project{
+		AbsRoot: h.Path("project"),
+		Manifest: &dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				"github.com/sdboyer/deptest":   gps.ProjectProperties{Source: "https://github.com/carolynvs/deptest", Constraint: caret},
+				"github.com/pkg/errors":        gps.ProjectProperties{Constraint: caret},
+				"github.com/carolynvs/deptest": gps.ProjectProperties{Constraint: gps.NewBranch("master")},
+			},
+			Ovr: gps.ProjectConstraints{
+				"github.com/sdboyer/deptestdos": gps.ProjectProperties{Constraint: gps.NewVersion("v2.0.0")},
+			},
+		},
+		Lock: &dep.Lock{
+			P: []gps.LockedProject{
+				lock("github.com/carolynvs/deptest", ""),
+				lock("github.com/sdboyer/deptest", ""),
+				lock("github.com/sdboyer/deptestdos", ""),
+			},
+		},
+	}
+
+	d := findLockDrift(p, ptree)
+
+	if want := []string{"github.com/pkg/errors"}; !equalSlice(d.addedImports, want) {
+		t.Errorf("Expected the added imports to be %v, got %v", want, d.addedImports)
+	}
+	if want := []string{"github.com/carolynvs/deptest"}; !equalSlice(d.removedImports, want) {
+		t.Errorf("Expected the removed imports to be %v, got %v", want, d.removedImports)
+	}
+	if want := []string{"github.com/pkg/errors"}; !equalSlice(d.addedConstraints, want) {
+		t.Errorf("Expected the added constraints to be %v, got %v", want, d.addedConstraints)
+	}
+	want := []string{
+		`github.com/sdboyer/deptest (source "https://github.com/carolynvs/deptest", locked from "")`,
+		"github.com/sdboyer/deptestdos (v2.0.0, locked at v1.0.0)",
+	}
+	if !equalSlice(d.changedConstraints, want) {
+		t.Errorf("Expected the unsatisfied constraints to be %v, got %v", want, d.changedConstraints)
+	}
+
+	// Without all the locked projects vendored, removed imports can't be
+	// told apart from those of other dependencies.
+	h.Must(os.RemoveAll(h.Path("project/vendor/github.com/sdboyer/deptestdos")))
+	if d := findLockDrift(p, ptree); len(d.removedImports) != 0 {
+		t.Errorf("Expected no removed imports without a complete vendor/, got %v", d.removedImports)
+	}
+}
+
+func TestFindPruneDrift(t *testing.T) {
+	lock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.Revision("rev1"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/baz"}, gps.Revision("rev2"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/qux"}, gps.Revision("rev3"), []string{"."}),
+		},
+		PruneOpts: map[gps.ProjectRoot]gps.PruneOptions{
+			"github.com/foo/bar": gps.PruneGoTestFiles,
+			"github.com/foo/baz": gps.PruneGoTestFiles,
+		},
+	}
+	p := &dep.Project{
+		Lock: lock,
+		Manifest: &dep.Manifest{PruneOptions: gps.CascadingPruneOptions{
+			DefaultOptions: gps.PruneGoTestFiles,
+			PerProjectOptions: map[gps.ProjectRoot]gps.PruneOptionSet{
+				"github.com/foo/baz": {Overridden: gps.PruneNonGoFiles, Options: gps.PruneNonGoFiles},
+			},
+		}},
+	}
+
+	got := findPruneDrift(p)
+	want := []gps.ProjectRoot{"github.com/foo/baz", "github.com/foo/qux"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected prune drift:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestFindLocalSources(t *testing.T) {
+	lock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "/home/me/src/github.com/foo/bar"}, gps.Revision("rev1"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/baz", Source: "https://github.com/fork/baz"}, gps.Revision("rev2"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/qux", Source: "file:///home/me/src/qux"}, gps.Revision("rev3"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/quux"}, gps.Revision("rev4"), []string{"."}),
+		},
+	}
+
+	var got []gps.ProjectRoot
+	for _, lp := range findLocalSources(lock) {
+		got = append(got, lp.Ident().ProjectRoot)
+	}
+	want := []gps.ProjectRoot{"github.com/foo/bar", "github.com/foo/qux"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected local sources:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+// ageSourceManager is a SourceManager which knows the commit times of some
+// revisions, and how many commits there are between any two of them.
+type ageSourceManager struct {
+	gps.SourceManager
+	times  map[gps.Revision]time.Time
+	behind int
+}
+
+func (sm ageSourceManager) RevisionTime(id gps.ProjectIdentifier, r gps.Revision) (time.Time, error) {
+	if t, ok := sm.times[r]; ok {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("unknown revision %s", r)
+}
+
+func (sm ageSourceManager) CountCommitsBetween(id gps.ProjectIdentifier, from, to gps.Revision) (int, error) {
+	return sm.behind, nil
+}
+
+func TestLookUpAge(t *testing.T) {
+	rev := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	newer := gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f")
+	committed := time.Date(2017, 5, 31, 12, 0, 0, 0, time.UTC)
+	sm := ageSourceManager{times: map[gps.Revision]time.Time{rev: committed}, behind: 3}
+	id := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+
+	bs := &BasicStatus{Revision: rev, Latest: newer}
+	lookUpAge(bs, id, sm)
+	if !bs.RevisionTime.Equal(committed) {
+		t.Errorf("Expected the revision time to be %s, got %s", committed, bs.RevisionTime)
+	}
+	if got := formatCommitsBehind(bs.CommitsBehind); got != "3" {
+		t.Errorf("Expected the revision to be 3 commits behind, got %s", got)
+	}
+	raw := bs.marshalJSONStatus()
+	if raw.RevisionTime != "2017-05-31T12:00:00Z" || raw.CommitsBehind == nil || *raw.CommitsBehind != 3 {
+		t.Errorf("Unexpected age in the JSON status: %q, %v", raw.RevisionTime, raw.CommitsBehind)
+	}
+
+	// Up-to-date revisions aren't behind, without needing to count.
+	bs = &BasicStatus{Revision: rev, Latest: rev}
+	lookUpAge(bs, id, sm)
+	if got := formatCommitsBehind(bs.CommitsBehind); got != "0" {
+		t.Errorf("Expected the up-to-date revision to be 0 commits behind, got %s", got)
+	}
+
+	// What can't be looked up is n/a.
+	bs = &BasicStatus{Revision: newer, LatestErr: errors.New("no versions")}
+	lookUpAge(bs, id, sm)
+	if got := formatRevisionTime(bs.RevisionTime); got != "n/a" {
+		t.Errorf("Expected an unknown revision time to be n/a, got %s", got)
+	}
+	if got := formatCommitsBehind(bs.CommitsBehind); got != "n/a" {
+		t.Errorf("Expected an unknown number of commits to be n/a, got %s", got)
+	}
+	if raw := bs.marshalJSONStatus(); raw.RevisionTime != "" || raw.CommitsBehind != nil {
+		t.Errorf("Expected no age in the JSON status, got %q, %v", raw.RevisionTime, raw.CommitsBehind)
+	}
+}
+
+func TestFindUnusedConstraints(t *testing.T) {
+	any := gps.ProjectProperties{Constraint: gps.Any()}
+	m := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest":    any,
+			"github.com/sdboyer/deptestdos": any,
+			"github.com/pkg/errors":         any,
+			"github.com/golang/notexist":    any,
+			"github.com/carolynvs/deptest":  any,
+			"github.com/required/pkg":       any,
+		},
+		Ovr: gps.ProjectConstraints{
+			"github.com/sdboyer/deptestdos": any,
+			"github.com/pkg/old":            any,
+		},
+		Ignored:  []string{"github.com/golang/notexist/foo", "github.com/carolynvs/*"},
+		Required: []string{"github.com/required/pkg/cmd"},
+	}
+	lock := func(pr string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}, gps.NewVersion("v1.0.0"), []string{"."})
+	}
+	lps := []gps.LockedProject{
+		lock("github.com/sdboyer/deptest"),
+		lock("github.com/sdboyer/deptestdos"),
+		lock("github.com/required/pkg"),
+	}
+	imported := map[string]bool{"github.com/sdboyer/deptest": true}
+
+	want := []unusedConstraint{
+		{ProjectRoot: "github.com/carolynvs/deptest", Reason: unusedIgnored},
+		{ProjectRoot: "github.com/golang/notexist", Reason: unusedIgnored},
+		{ProjectRoot: "github.com/pkg/errors", Reason: unusedNotDependency},
+		{ProjectRoot: "github.com/sdboyer/deptestdos", Reason: unusedTransitive},
+		{ProjectRoot: "github.com/pkg/old", Override: true, Reason: unusedNotDependency},
+	}
+	got := findUnusedConstraints(m, lps, imported)
+	if len(got) != len(want) {
+		t.Fatalf("Expected the unused constraints to be %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected unused constraint %d to be %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestUnusedConstraintsOutput(t *testing.T) {
+	var buf bytes.Buffer
+	out := &jsonOutput{w: &buf}
+	out.BasicHeader()
+	out.UnusedHeader()
+	out.UnusedLine(&unusedConstraint{ProjectRoot: "github.com/pkg/old", Override: true, Reason: unusedNotDependency})
+	out.UnusedFooter()
+	out.BasicFooter()
+
+	want := `{"in-sync":true,"projects":[],"unused":[{"PROJECT":"github.com/pkg/old","KIND":"override","REASON":"not a dependency"}]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected JSON output:\n\t(GOT): %s\n\t(WNT): %s", buf.String(), want)
+	}
+
+	buf.Reset()
+	tout := &tableOutput{w: tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)}
+	tout.BasicHeader()
+	tout.UnusedHeader()
+	tout.UnusedLine(&unusedConstraint{ProjectRoot: "github.com/pkg/errors", Reason: unusedNotDependency})
+	tout.UnusedFooter()
+	tout.BasicFooter()
+
+	want = "PROJECT  CONSTRAINT  VERSION  REVISION  LATEST  PKGS USED  DIRECT  TEST\n" +
+		"\nUnused constraints and overrides in Gopkg.toml:\n\n" +
+		"PROJECT                KIND        REASON\n" +
+		"github.com/pkg/errors  constraint  not a dependency  \n"
+	if buf.String() != want {
+		t.Errorf("Unexpected table output:\n\t(GOT): %q\n\t(WNT): %q", buf.String(), want)
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	caret, _ := gps.NewSemverConstraint("^0.8.0")
+	statuses := []*BasicStatus{
+		{
+			ProjectRoot:  "github.com/sdboyer/deptest",
+			Source:       "https://github.com/carolynvs/deptest,fork",
+			Constraint:   caret,
+			Version:      gps.NewVersion("v0.8.0"),
+			Revision:     gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			Latest:       gps.Revision("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+			Newest:       gps.NewVersion("v1.0.0").Pair(gps.Revision("5c607206be5decd28e6263ffffdcee067266015e")),
+			PackageCount: 1,
+			Direct:       true,
+		},
+		{
+			ProjectRoot:  "github.com/sdboyer/deptestdos",
+			Constraint:   gps.Any(),
+			Version:      gps.NewBranch("master"),
+			Revision:     gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+			Latest:       gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+			PackageCount: 2,
+		},
+		{
+			ProjectRoot: "github.com/golang/notexist",
+			Constraint:  gps.Any(),
+			Revision:    gps.Revision("a7a8c9ba9293036ce3d51d4b4fd5dffd68ac64e4"),
+			LatestErr:   errors.New("unable to list versions:\n\tno such repository"),
+		},
+	}
+
+	for name, old := range map[string]bool{"csv.csv": false, "csv_old.csv": true} {
+		var buf bytes.Buffer
+		out := &csvOutput{w: csv.NewWriter(&buf), old: old}
+		out.BasicHeader()
+		for _, bs := range statuses {
+			out.BasicLine(bs)
+		}
+		out.BasicFooter()
+
+		goldenFile := filepath.Join("status", name)
+		got := buf.String()
+		want := h.GetTestFileString(goldenFile)
+		if want != got {
+			if *test.UpdateGolden {
+				if err := h.WriteTestFile(goldenFile, got); err != nil {
+					t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+				}
+			} else {
+				t.Errorf("Unexpected output for %s:\n\t(GOT):\n%s\n\t(WNT):\n%s", goldenFile, got, want)
+			}
+		}
+		if old && out.count != 1 {
+			t.Errorf("Expected 1 out-of-date dependency, got %d", out.count)
+		}
+	}
+}
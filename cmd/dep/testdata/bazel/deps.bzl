@@ -0,0 +1,17 @@
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+DEPTEST_COMMIT = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+def go_dependencies():
+    go_repository(
+        name = "com_github_sdboyer_deptestdos",
+        importpath = "github.com/sdboyer/deptestdos",
+        tag = "v2.0.0",
+        build_file_proto_mode = "disable",
+    )
+
+    go_repository(
+        name = "com_github_carolynvs_deptest",
+        importpath = "github.com/carolynvs/deptest",
+        commit = DEPTEST_COMMIT,
+    )
@@ -0,0 +1,11 @@
+module github.com/golang/notexist
+
+require (
+	github.com/sdboyer/deptest v0.8.1
+	github.com/sdboyer/deptestdos v2.0.0+incompatible // indirect
+	github.com/example/local v1.0.0
+)
+
+replace github.com/example/local => ../local
+
+exclude github.com/sdboyer/deptest v0.8.0
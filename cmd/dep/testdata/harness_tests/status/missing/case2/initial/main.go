@@ -0,0 +1,13 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	_ "github.com/golang/notexist/foo"
+	_ "github.com/sdboyer/deptest"
+)
+
+func main() {
+}
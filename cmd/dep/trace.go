@@ -0,0 +1,80 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const (
+	traceFormatText = "text"
+	traceFormatJSON = "json"
+)
+
+// traceOptions are the flags of the commands which solve, ensure and init,
+// which write the solver's trace to a file, for a failure to be looked into
+// after the fact, or by tools.
+type traceOptions struct {
+	file   string
+	format string
+}
+
+func (t *traceOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.file, "trace-file", "", "write the full trace of the solver to this file, whether or not -v is passed")
+	fs.StringVar(&t.format, "trace-format", traceFormatText, "format of -trace-file: text, as -v prints it, or json, with an event per line")
+}
+
+func (t *traceOptions) validate() error {
+	switch t.format {
+	case "", traceFormatText, traceFormatJSON:
+	default:
+		return errors.Errorf("invalid -trace-format %q, must be one of text or json", t.format)
+	}
+	if t.format == traceFormatJSON && t.file == "" {
+		return errors.New("-trace-format only applies to -trace-file")
+	}
+	return nil
+}
+
+// apply sets params to trace solving as -v and the trace flags ask. The trace
+// file is to be closed, by calling the func returned, once solving is done.
+func (t *traceOptions) apply(ctx *dep.Ctx, params *gps.SolveParameters) (func() error, error) {
+	if ctx.Verbose {
+		params.TraceLogger = ctx.Err
+	}
+	if t.file == "" {
+		return func() error { return nil }, nil
+	}
+
+	f, err := os.Create(t.file)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create the trace file")
+	}
+	switch {
+	case t.format == traceFormatJSON:
+		params.TraceEvents = f
+	case ctx.Verbose:
+		params.TraceLogger = log.New(io.MultiWriter(f, loggerWriter{ctx.Err}), "", 0)
+	default:
+		params.TraceLogger = log.New(f, "", 0)
+	}
+	return f.Close, nil
+}
+
+// loggerWriter writes to a logger, for it to be written to along with a file.
+type loggerWriter struct {
+	l *log.Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	return len(p), w.l.Output(2, string(p))
+}
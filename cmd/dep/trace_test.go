@@ -0,0 +1,77 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestTraceOptionsValidate(t *testing.T) {
+	cases := []struct {
+		opts traceOptions
+		ok   bool
+	}{
+		{traceOptions{format: traceFormatText}, true},
+		{traceOptions{file: "trace", format: traceFormatText}, true},
+		{traceOptions{file: "trace", format: traceFormatJSON}, true},
+		{traceOptions{format: traceFormatJSON}, false},
+		{traceOptions{file: "trace", format: "xml"}, false},
+	}
+	for _, c := range cases {
+		if err := c.opts.validate(); (err == nil) != c.ok {
+			t.Errorf("%+v: expected success %t, got error %v", c.opts, c.ok, err)
+		}
+	}
+}
+
+func TestTraceOptionsApply(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	ctx := newTestContext(h)
+	var stderr bytes.Buffer
+	ctx.Err = log.New(&stderr, "", 0)
+	ctx.Verbose = true
+
+	// The text trace is written to the file as well as to stderr.
+	file := filepath.Join(h.Path("."), "trace.txt")
+	var params gps.SolveParameters
+	closeTrace, err := (&traceOptions{file: file, format: traceFormatText}).apply(ctx, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.TraceLogger == nil || params.TraceEvents != nil {
+		t.Fatalf("Expected just a text trace, got %+v", params)
+	}
+	params.TraceLogger.Println("try foo@1.0.0")
+	if err = closeTrace(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "try foo@1.0.0\n" || stderr.String() != "try foo@1.0.0\n" {
+		t.Errorf("Expected the trace in the file and on stderr, got %q and %q", b, stderr.String())
+	}
+
+	// The JSON trace is written to the file, leaving stderr to the text trace.
+	file = filepath.Join(h.Path("."), "trace.json")
+	params = gps.SolveParameters{}
+	closeTrace, err = (&traceOptions{file: file, format: traceFormatJSON}).apply(ctx, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeTrace()
+	if params.TraceEvents == nil || params.TraceLogger != ctx.Err {
+		t.Errorf("Expected trace events for the file and a text trace for stderr, got %+v", params)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const vndrFile = "vendor.conf"
+
+// vndrImporter imports vndr and trash configuration into the dep
+// configuration format. Both tools use the same vendor.conf format.
+type vndrImporter struct {
+	packages []vndrPackage
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newVndrImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *vndrImporter {
+	return &vndrImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// vndrPackage is a single line of a vendor.conf: an import path, a revision,
+// tag or branch, and optionally the repository to fetch it from.
+type vndrPackage struct {
+	importPath string
+	reference  string
+	repository string
+}
+
+func (v *vndrImporter) Name() string {
+	return "vndr"
+}
+
+func (v *vndrImporter) HasDepMetadata(dir string) bool {
+	path := filepath.Join(dir, vndrFile)
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (v *vndrImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := v.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v.convert(pr)
+}
+
+// load the vendor.conf file.
+func (v *vndrImporter) load(projectDir string) error {
+	v.logger.Println("Detected vndr configuration file...")
+	path := filepath.Join(projectDir, vndrFile)
+	if v.verbose {
+		v.logger.Printf("  Loading %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		pkg, err := parseVndrLine(scanner.Text())
+		if err != nil {
+			return errors.Wrapf(err, "Unable to parse %s, line %d", path, n)
+		}
+		if pkg == nil {
+			continue
+		}
+		v.packages = append(v.packages, *pkg)
+	}
+
+	return errors.Wrapf(scanner.Err(), "Unable to read %s", path)
+}
+
+// parseVndrLine parses a single line of a vendor.conf. It returns nil for
+// blank lines and comments.
+func parseVndrLine(line string) (*vndrPackage, error) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	switch len(fields) {
+	case 0:
+		return nil, nil
+	case 2:
+		return &vndrPackage{
+			importPath: fields[0],
+			reference:  fields[1],
+		}, nil
+	case 3:
+		return &vndrPackage{
+			importPath: fields[0],
+			reference:  fields[1],
+			repository: fields[2],
+		}, nil
+	default:
+		return nil, errors.Errorf("invalid config format: %q", line)
+	}
+}
+
+// convert the vndr packages into dep configuration files.
+func (v *vndrImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	v.logger.Println("Converting from vendor.conf ...")
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, pkg := range v.packages {
+		// Obtain ProjectRoot. Required for avoiding sub-package imports.
+		ip, err := v.sm.DeduceProjectRoot(pkg.importPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Check if it already existing in locked projects
+		if projectExistsInLock(lock, string(ip)) {
+			continue
+		}
+
+		pi := gps.ProjectIdentifier{
+			ProjectRoot: ip,
+			Source:      pkg.repository,
+		}
+
+		pc, err := v.buildProjectConstraint(pi, pkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pc.Constraint != nil {
+			manifest.Constraints[pi.ProjectRoot] = gps.ProjectProperties{Source: pi.Source, Constraint: pc.Constraint}
+		}
+
+		lp := v.buildLockedProject(pi, pkg, manifest)
+		lock.P = append(lock.P, lp)
+	}
+
+	return manifest, lock, nil
+}
+
+// buildProjectConstraint uses the package's reference to create a project
+// constraint. When the reference is a bare revision, the constraint is inferred
+// from the version matching it instead, if there is one.
+func (v *vndrImporter) buildProjectConstraint(pi gps.ProjectIdentifier, pkg vndrPackage) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+	pc.Constraint, err = v.sm.InferConstraint(pkg.reference, pi)
+	if err != nil {
+		return
+	}
+
+	if revision, ok := pc.Constraint.(gps.Revision); ok {
+		version, err := lookupVersionForLockedProject(pi, nil, revision, v.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			v.logger.Println(err.Error())
+			pc.Constraint = nil
+			return pc, nil
+		}
+		pc.Constraint = getProjectPropertiesFromVersion(version).Constraint
+		if pc.Constraint == nil {
+			return pc, nil
+		}
+	}
+
+	f := fb.NewConstraintFeedback(pc, fb.DepTypeImported)
+	f.LogFeedback(v.logger)
+
+	return
+}
+
+// buildLockedProject uses the package's reference to create a lock project.
+// vndr also accepts tags and branches, in which case the project is locked to
+// the revision they currently point to.
+func (v *vndrImporter) buildLockedProject(pi gps.ProjectIdentifier, pkg vndrPackage, manifest *dep.Manifest) gps.LockedProject {
+	pp := manifest.Constraints[pi.ProjectRoot]
+
+	var version gps.Version
+	versions, err := v.sm.ListVersions(pi)
+	if err == nil {
+		for _, pv := range versions {
+			if pv.String() == pkg.reference {
+				version = pv
+				break
+			}
+		}
+	}
+
+	if version == nil {
+		revision := gps.Revision(pkg.reference)
+		version, err = lookupVersionForLockedProject(pi, pp.Constraint, revision, v.sm)
+		if err != nil {
+			// Only warn about the problem, it is not enough to warrant failing
+			v.logger.Println(err.Error())
+		}
+	}
+
+	lp := gps.NewLockedProject(pi, version, nil)
+	f := fb.NewLockedProjectFeedback(lp, fb.DepTypeImported)
+	f.LogFeedback(v.logger)
+
+	return lp
+}
@@ -0,0 +1,275 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestVndrConfig_Convert(t *testing.T) {
+	testCases := map[string]struct {
+		importConverterTestCase
+		packages []vndrPackage
+	}{
+		"revision": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]vndrPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					// This revision has 2 versions attached to it, v1.0.0 & v0.8.0.
+					reference: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+		"tag": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				matchPairedVersion: true,
+				wantConstraint:     "^0.8.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v0.8.0",
+				wantLockCount:      1,
+			},
+			[]vndrPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					reference:  "v0.8.0",
+				},
+			},
+		},
+		"source url": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				wantSourceRepo:     "https://github.com/sdboyer/deptest.git",
+				matchPairedVersion: true,
+				wantConstraint:     "^1.0.0",
+				wantRevision:       gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				wantVersion:        "v1.0.0",
+				wantLockCount:      1,
+			},
+			[]vndrPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					reference:  "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+					repository: "https://github.com/sdboyer/deptest.git",
+				},
+			},
+		},
+		"source url with tag": {
+			importConverterTestCase{
+				projectRoot:        "github.com/sdboyer/deptest",
+				wantSourceRepo:     "https://github.com/sdboyer/deptest.git",
+				matchPairedVersion: true,
+				wantConstraint:     "^0.8.0",
+				wantVersion:        "v0.8.0",
+				wantLockCount:      1,
+			},
+			[]vndrPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					reference:  "v0.8.0",
+					repository: "https://github.com/sdboyer/deptest.git",
+				},
+			},
+		},
+		"sub-packages": {
+			importConverterTestCase{
+				projectRoot:    "github.com/sdboyer/deptest",
+				wantConstraint: "^1.0.0",
+				wantLockCount:  1,
+			},
+			[]vndrPackage{
+				{
+					importPath: "github.com/sdboyer/deptest",
+					reference:  "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+				{
+					importPath: "github.com/sdboyer/deptest/foo",
+					reference:  "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+				},
+			},
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			v := newVndrImporter(discardLogger, true, sm)
+			v.packages = testCase.packages
+
+			testCase.exec(t, v)
+		})
+	}
+}
+
+func TestVndrConfig_Import(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+	sm, err := ctx.SourceManager()
+	h.Must(err)
+	defer sm.Release()
+
+	h.TempDir(filepath.Join("src", testProjectRoot))
+	h.TempCopy(filepath.Join(testProjectRoot, vndrFile), "vndr/vendor.conf")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	// Capture stderr so we can verify output
+	verboseOutput := &bytes.Buffer{}
+	ctx.Err = log.New(verboseOutput, "", 0)
+
+	v := newVndrImporter(ctx.Err, false, sm) // Disable verbose so that we don't print values that change each test run
+	if !v.HasDepMetadata(projectRoot) {
+		t.Fatal("Expected the importer to detect the vndr configuration file")
+	}
+
+	m, l, err := v.Import(projectRoot, testProjectRoot)
+	h.Must(err)
+
+	if m == nil {
+		t.Fatal("Expected the manifest to be generated")
+	}
+
+	if l == nil {
+		t.Fatal("Expected the lock to be generated")
+	}
+
+	goldenFile := "vndr/golden.txt"
+	got := verboseOutput.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("want %s, got %s", want, got)
+		}
+	}
+}
+
+func TestVndrConfig_Load(t *testing.T) {
+	// This is same as cmd/dep/testdata/vndr/vendor.conf
+	wantPackages := []vndrPackage{
+		{
+			importPath: "github.com/sdboyer/deptest",
+			reference:  "3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			repository: "https://github.com/sdboyer/deptest.git",
+		},
+		{
+			importPath: "github.com/sdboyer/deptestdos",
+			reference:  "v2.0.0",
+		},
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempCopy(filepath.Join(testProjectRoot, vndrFile), "vndr/vendor.conf")
+
+	projectRoot := h.Path(testProjectRoot)
+
+	v := newVndrImporter(ctx.Err, true, nil)
+	err := v.load(projectRoot)
+	if err != nil {
+		t.Fatalf("Error while loading... %v", err)
+	}
+
+	if !reflect.DeepEqual(v.packages, wantPackages) {
+		t.Fatalf("Unexpected packages.\n\t(GOT): %+v\n\t(WNT): %+v", v.packages, wantPackages)
+	}
+}
+
+func TestVndrConfig_LoadMalformed(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := newTestContext(h)
+
+	h.TempFile(filepath.Join(testProjectRoot, vndrFile), "# Comment\n\ngithub.com/sdboyer/deptest\n")
+
+	v := newVndrImporter(ctx.Err, false, nil)
+	err := v.load(h.Path(testProjectRoot))
+	if err == nil {
+		t.Fatal("Expected a malformed vendor.conf to fail to load")
+	}
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("Expected the error to include the line number, got %q", err)
+	}
+}
+
+func TestParseVndrLine(t *testing.T) {
+	testCases := map[string]struct {
+		line    string
+		want    *vndrPackage
+		wantErr bool
+	}{
+		"revision": {
+			line: "github.com/sdboyer/deptest 3f4c3bea144e112a69bbe5d8d01c1b09a544253f",
+			want: &vndrPackage{importPath: "github.com/sdboyer/deptest", reference: "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"},
+		},
+		"source url": {
+			line: "github.com/sdboyer/deptest v1.0.0 https://github.com/carolynvs/deptest.git",
+			want: &vndrPackage{importPath: "github.com/sdboyer/deptest", reference: "v1.0.0", repository: "https://github.com/carolynvs/deptest.git"},
+		},
+		"trailing comment": {
+			line: "github.com/sdboyer/deptest v1.0.0 # pinned for reasons",
+			want: &vndrPackage{importPath: "github.com/sdboyer/deptest", reference: "v1.0.0"},
+		},
+		"comment": {
+			line: "# github.com/sdboyer/deptest v1.0.0",
+		},
+		"blank": {
+			line: "\t ",
+		},
+		"missing reference": {
+			line:    "github.com/sdboyer/deptest",
+			wantErr: true,
+		},
+		"too many fields": {
+			line:    "github.com/sdboyer/deptest v1.0.0 https://github.com/sdboyer/deptest.git extra",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseVndrLine(tc.line)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error state, wantErr %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+const whyShortHelp = `Explain why a dependency is in the lock`
+const whyLongHelp = `
+Why explains why a project is in Gopkg.lock. The argument is the root of the
+project, or the import path of one of its packages, to only explain why that
+package is needed.
+
+For each package of the current project which imports it, directly or through
+other dependencies, why prints the shortest chain of imports leading to it,
+telling the imports of the project's tests apart. It then prints the version
+the project is locked to and its constraint in Gopkg.toml, if it has one, and
+the packages of it which Gopkg.toml requires, if any.
+
+Why fails if the project isn't in Gopkg.lock.
+`
+
+type whyCommand struct{}
+
+func (cmd *whyCommand) Name() string      { return "why" }
+func (cmd *whyCommand) Args() string      { return "<import path>" }
+func (cmd *whyCommand) ShortHelp() string { return whyShortHelp }
+func (cmd *whyCommand) LongHelp() string  { return whyLongHelp }
+func (cmd *whyCommand) Hidden() bool      { return false }
+
+func (cmd *whyCommand) Register(fs *flag.FlagSet) {}
+
+func (cmd *whyCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) != 1 {
+		return errors.New("why takes exactly one argument, the import path of a dependency")
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found. Run `dep ensure` to generate lock file", dep.LockName)
+	}
+
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	sm.UseSourceMirrors(p.Manifest.Mirrors)
+	defer sm.Release()
+
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+
+	w, err := explainWhy(p, ptree, newImportGraph(sm, p, ptree).imports, args[0])
+	if err != nil {
+		return err
+	}
+	ctx.Out.Print(w.String())
+	return nil
+}
+
+// whyHop is one import in a chain of imports.
+type whyHop struct {
+	ImportPath string
+	Test       bool // Whether it's only imported by the tests of the importer
+}
+
+// whyChain is a chain of imports from a package of the root project, or one
+// that Gopkg.toml requires, to a package of the dependency.
+type whyChain struct {
+	From     string
+	Required bool // Whether From is required by Gopkg.toml, not in the project
+	Hops     []whyHop
+}
+
+// why explains why a dependency is in the lock.
+type why struct {
+	Target     string // The import path asked about
+	Project    gps.LockedProject
+	Constraint gps.Constraint // From Gopkg.toml, or nil if it has none
+	Override   bool           // Whether the constraint is an override
+	Chains     []whyChain
+	Required   []string // The packages of the dependency that Gopkg.toml requires
+}
+
+// explainWhy finds why the project or package target is in the lock of p.
+// imports returns the imports of a package, including the test imports of
+// those of the root project, or nil if they can't be determined.
+func explainWhy(p *dep.Project, ptree pkgtree.PackageTree, imports func(string) []string, target string) (*why, error) {
+	w := &why{Target: target}
+	var found bool
+	for _, lp := range p.Lock.Projects() {
+		if isPathPrefix(target, string(lp.Ident().ProjectRoot)) {
+			w.Project, found = lp, true
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("%s is not in %s", target, dep.LockName)
+	}
+
+	pr := w.Project.Ident().ProjectRoot
+	if pp, has := p.Manifest.Ovr[pr]; has && pp.Constraint != nil {
+		w.Constraint, w.Override = pp.Constraint, true
+	} else if pp, has := p.Manifest.Constraints[pr]; has && pp.Constraint != nil {
+		w.Constraint = pp.Constraint
+	}
+
+	// Required packages of other projects can bring the dependency in, just
+	// as those of the root project can.
+	var required []string
+	for ip := range p.Manifest.RequiredPackages() {
+		if isPathPrefix(ip, target) {
+			w.Required = append(w.Required, ip)
+		} else {
+			required = append(required, ip)
+		}
+	}
+	sort.Strings(w.Required)
+	sort.Strings(required)
+
+	ignored := p.Manifest.IgnoredPackages()
+	var starts []string
+	for ip := range ptree.Packages {
+		if !pkgtree.IsIgnored(ip, ignored) {
+			starts = append(starts, ip)
+		}
+	}
+	sort.Strings(starts)
+	starts = append(starts, required...)
+
+	// Each package of the root project starts its own chains, so they aren't
+	// followed through others, whose chains would be shorter. Imports are
+	// followed in order, so that the shortest chain found is always the same.
+	follow := func(ip string) []string {
+		var imps []string
+		for _, imp := range imports(ip) {
+			_, inRoot := ptree.Packages[imp]
+			if !inRoot && !paths.IsStandardImportPath(imp) && !pkgtree.IsIgnored(imp, ignored) {
+				imps = append(imps, imp)
+			}
+		}
+		sort.Strings(imps)
+		return imps
+	}
+	isTarget := func(ip string) bool {
+		return isPathPrefix(ip, target)
+	}
+
+	for _, start := range starts {
+		chain := shortestImportChain([]string{start}, follow, isTarget)
+		if chain == nil {
+			continue
+		}
+
+		// Only the first hop can be a test import, as the tests of
+		// dependencies aren't followed.
+		_, inRoot := ptree.Packages[start]
+		c := whyChain{From: start, Required: !inRoot}
+		for i, ip := range chain[1:] {
+			hop := whyHop{ImportPath: ip}
+			if i == 0 && inRoot {
+				hop.Test = !importsOutsideTests(ptree, start, ip)
+			}
+			c.Hops = append(c.Hops, hop)
+		}
+		w.Chains = append(w.Chains, c)
+	}
+
+	return w, nil
+}
+
+// importsOutsideTests reports whether the package from of the root project
+// imports ip outside of its tests.
+func importsOutsideTests(ptree pkgtree.PackageTree, from, ip string) bool {
+	poe := ptree.Packages[from]
+	if poe.Err != nil {
+		return false
+	}
+	for _, imp := range poe.P.Imports {
+		if imp == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the chains of imports, then how the dependency is locked,
+// constrained and required.
+func (w *why) String() string {
+	var buf bytes.Buffer
+	for _, c := range w.Chains {
+		if c.Required {
+			fmt.Fprintf(&buf, "%s (required by %s)\n", c.From, dep.ManifestName)
+		} else {
+			fmt.Fprintln(&buf, c.From)
+		}
+		for _, hop := range c.Hops {
+			verb := "imports"
+			if hop.Test {
+				verb = "imports in tests"
+			}
+			fmt.Fprintf(&buf, "  %s %s\n", verb, hop.ImportPath)
+		}
+	}
+	if len(w.Chains) > 0 {
+		fmt.Fprintln(&buf)
+	}
+
+	pr := w.Project.Ident().ProjectRoot
+	switch {
+	case len(w.Chains) == 0 && len(w.Required) > 0:
+		fmt.Fprintf(&buf, "%s is only in %s because %s requires it.\n", w.Target, dep.LockName, dep.ManifestName)
+	case len(w.Chains) == 0:
+		fmt.Fprintf(&buf, "No package of the project imports %s; %s may be out of sync.\n", w.Target, dep.LockName)
+	}
+
+	locked := formatVersion(w.Project.Version())
+	if r, ok := w.Project.Version().(gps.PairedVersion); ok {
+		locked += fmt.Sprintf(" (%s)", formatVersion(r.Revision()))
+	}
+	fmt.Fprintf(&buf, "%s is locked at %s.\n", pr, locked)
+
+	switch {
+	case w.Constraint != nil && w.Override:
+		fmt.Fprintf(&buf, "It's overridden to %s in %s.\n", w.Constraint, dep.ManifestName)
+	case w.Constraint != nil:
+		fmt.Fprintf(&buf, "It's constrained to %s in %s.\n", w.Constraint, dep.ManifestName)
+	default:
+		fmt.Fprintf(&buf, "It has no constraint in %s.\n", dep.ManifestName)
+	}
+	for _, ip := range w.Required {
+		fmt.Fprintf(&buf, "%s requires %s.\n", dep.ManifestName, ip)
+	}
+	return buf.String()
+}
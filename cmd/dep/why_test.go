@@ -0,0 +1,108 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+// mkWhyProject returns a project which imports github.com/foo/bar both
+// directly and, in the tests of one of its packages, through
+// github.com/foo/baz, and requires github.com/foo/qux, which imports bar
+// again, along with the imports of all of their packages.
+func mkWhyProject() (*dep.Project, pkgtree.PackageTree, func(string) []string) {
+	p := &dep.Project{
+		ImportRoot: "example.com/root",
+		Manifest: &dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				"github.com/foo/bar": {Constraint: gps.NewVersion("v1.0.0")},
+			},
+			Ovr: gps.ProjectConstraints{
+				"github.com/foo/baz": {Constraint: gps.NewBranch("master")},
+			},
+			Required: []string{"github.com/foo/qux/cmd"},
+		},
+		Lock: &dep.Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.NewVersion("v1.0.0").Pair("0123456789abcdef"), nil),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/baz"}, gps.NewBranch("master").Pair("fedcba9876543210"), nil),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/qux"}, gps.Revision("abcdef0123456789"), nil),
+		}},
+	}
+
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "example.com/root",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"example.com/root": {P: pkgtree.Package{
+				Imports: []string{"fmt", "github.com/foo/bar/sub"},
+			}},
+			"example.com/root/cmd": {P: pkgtree.Package{
+				Imports:     []string{"example.com/root"},
+				TestImports: []string{"github.com/foo/baz"},
+			}},
+		},
+	}
+
+	imports := map[string][]string{
+		"github.com/foo/baz":     {"github.com/foo/bar"},
+		"github.com/foo/qux/cmd": {"github.com/foo/bar"},
+	}
+	return p, ptree, func(ip string) []string {
+		if poe, ok := ptree.Packages[ip]; ok {
+			return append(append([]string(nil), poe.P.Imports...), poe.P.TestImports...)
+		}
+		return imports[ip]
+	}
+}
+
+func TestExplainWhy(t *testing.T) {
+	cases := []struct {
+		target string
+		golden string
+	}{
+		{target: "github.com/foo/bar", golden: "why/bar.txt"},
+		{target: "github.com/foo/baz", golden: "why/baz.txt"},
+		{target: "github.com/foo/qux", golden: "why/qux.txt"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			p, ptree, imports := mkWhyProject()
+			w, err := explainWhy(p, ptree, imports, c.target)
+			if err != nil {
+				t.Fatalf("Unexpected error explaining why %s is locked: %s", c.target, err)
+			}
+
+			got := w.String()
+			want := h.GetTestFileString(c.golden)
+			if want != got {
+				if *test.UpdateGolden {
+					if err := h.WriteTestFile(c.golden, got); err != nil {
+						t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", c.golden))
+					}
+				} else {
+					t.Fatalf("want %s, got %s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExplainWhyNotLocked(t *testing.T) {
+	p, ptree, imports := mkWhyProject()
+	for _, target := range []string{"github.com/unlocked/pkg", "github.com/foo"} {
+		if _, err := explainWhy(p, ptree, imports, target); err == nil {
+			t.Errorf("Expected an error explaining why %s, which isn't locked, is locked", target)
+		}
+	}
+}
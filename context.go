@@ -5,10 +5,13 @@
 package dep
 
 import (
+	"context"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
@@ -17,11 +20,13 @@ import (
 
 // Ctx defines the supporting context of dep.
 //
-// A properly initialized Ctx has a GOPATH containing the project root and non-nil Loggers.
+// A properly initialized Ctx has a GOPATH containing the project root, all the
+// entries of the GOPATH environment variable in GOPATHs, and non-nil Loggers.
 //
 //	ctx := &dep.Ctx{
 //		WorkingDir: GOPATH + "/src/project/root",
 //		GOPATH: GOPATH,
+//		GOPATHs: filepath.SplitList(os.Getenv("GOPATH")),
 //		Out: log.New(os.Stdout, "", 0),
 //		Err: log.New(os.Stderr, "", 0),
 //	}
@@ -36,9 +41,25 @@ import (
 type Ctx struct {
 	WorkingDir string      // Where to execute.
 	GOPATH     string      // Selected Go path, containing WorkingDir.
-	GOPATHs    []string    // Other Go paths.
+	GOPATHs    []string    // All the Go paths, in order, including GOPATH.
 	Out, Err   *log.Logger // Required loggers.
 	Verbose    bool        // Enables more verbose logging.
+	Strict     bool        // Makes problems found in the manifest errors, not warnings.
+
+	VersionListTTL time.Duration // How long the version lists of sources are cached for.
+	MetadataTTL    time.Duration // How long the go-get metadata of import paths is cached for.
+	StaleOK        bool          // Uses cached version lists and metadata however old they are.
+	NoNetwork      bool          // Works only from the source cache, never the network.
+	NoPrompt       bool          // Fails rather than prompts for credentials.
+	Archives       bool          // Exports sources on GitHub and Bitbucket from archives of their revisions.
+	Cachedir       string        // Where sources are cached; $GOPATH/pkg/dep if empty.
+	ReadOnlyCache  string        // A cache dir sources are copied from before they're fetched, if set.
+	SourceTimeout  time.Duration // How long each operation on a source may take, if set.
+	VendorLinks    fs.LinkMode   // How files are copied out of the cache to vendor/.
+
+	// Context is done once the command is to stop, as on an interrupt or
+	// once its time is up, stopping solving and the SourceManager's work.
+	Context context.Context
 }
 
 // SetPaths sets the WorkingDir and GOPATHs fields. If GOPATHs is empty, then
@@ -83,8 +104,45 @@ func defaultGOPATH() string {
 	return ""
 }
 
+// SourceManager returns a SourceMgr set up as c says, caching sources in
+// c.Cachedir, or $GOPATH/pkg/dep if that's empty, and copying those it lacks
+// from c.ReadOnlyCache, if set, before fetching them.
 func (c *Ctx) SourceManager() (*gps.SourceMgr, error) {
-	return gps.NewSourceManager(filepath.Join(c.GOPATH, "pkg", "dep"))
+	cachedir := c.Cachedir
+	if cachedir == "" {
+		cachedir = filepath.Join(c.GOPATH, "pkg", "dep")
+	}
+	sm, err := gps.NewSourceManager(cachedir)
+	if err != nil {
+		return nil, err
+	}
+	if c.ReadOnlyCache != "" {
+		sm.UseReadOnlyCache(c.ReadOnlyCache)
+	}
+	sm.UseVersionListCache(c.VersionListTTL, c.StaleOK)
+	sm.UseMetadataCache(c.MetadataTTL, c.StaleOK)
+	if c.NoNetwork {
+		sm.DisableNetwork()
+	}
+	if c.NoPrompt {
+		sm.DisablePrompts()
+	}
+	if c.Archives {
+		sm.UseArchives()
+	}
+	if c.SourceTimeout > 0 {
+		sm.UseCallTimeout(c.SourceTimeout)
+	}
+	sm.UseLinks(c.VendorLinks)
+	if c.Context != nil {
+		sm.UseContext(c.Context)
+	}
+	if c.Verbose {
+		retry := gps.DefaultRetryPolicy
+		retry.Logger = c.Err
+		sm.UseRetryPolicy(retry)
+	}
+	return sm, nil
 }
 
 // LoadProject starts from the current working directory and searches up the
@@ -106,17 +164,6 @@ func (c *Ctx) LoadProject() (*Project, error) {
 		return nil, err
 	}
 
-	c.GOPATH, err = c.DetectProjectGOPATH(p)
-	if err != nil {
-		return nil, err
-	}
-
-	ip, err := c.ImportForAbs(p.AbsRoot)
-	if err != nil {
-		return nil, errors.Wrap(err, "root project import")
-	}
-	p.ImportRoot = gps.ProjectRoot(ip)
-
 	mp := filepath.Join(p.AbsRoot, ManifestName)
 	mf, err := os.Open(mp)
 	if err != nil {
@@ -132,11 +179,22 @@ func (c *Ctx) LoadProject() (*Project, error) {
 	var warns []error
 	p.Manifest, warns, err = readManifest(mf)
 	for _, warn := range warns {
-		c.Err.Printf("dep: WARNING: %v\n", warn)
+		if c.Strict {
+			c.Err.Printf("dep: ERROR: %v\n", warn)
+		} else {
+			c.Err.Printf("dep: WARNING: %v\n", warn)
+		}
 	}
 	if err != nil {
 		return nil, errors.Errorf("error while parsing %s: %s", mp, err)
 	}
+	if c.Strict && len(warns) > 0 {
+		return nil, errors.Errorf("found %d problems in %s", len(warns), mp)
+	}
+
+	if err = c.ResolveProject(p, p.Manifest.Root); err != nil {
+		return nil, err
+	}
 
 	lp := filepath.Join(p.AbsRoot, LockName)
 	lf, err := os.Open(lp)
@@ -158,12 +216,50 @@ func (c *Ctx) LoadProject() (*Project, error) {
 	return p, nil
 }
 
+// ResolveProject sets the import path of p, whose root must be set, and the
+// GOPATH of c for it. The import path is importRoot if it's set, as it must be
+// for a project outside of GOPATH. Such a project uses the first of GOPATHs, as
+// go get does, e.g. for the cache of sources. Otherwise, the import path is
+// where p is within its GOPATH, per DetectProjectGOPATH.
+func (c *Ctx) ResolveProject(p *Project, importRoot string) error {
+	GOPATH, err := c.DetectProjectGOPATH(p)
+	if importRoot == "" {
+		if err != nil {
+			return err
+		}
+		c.GOPATH = GOPATH
+		ip, err := c.ImportForAbs(p.AbsRoot)
+		if err != nil {
+			return errors.Wrap(err, "root project import")
+		}
+		p.ImportRoot = gps.ProjectRoot(ip)
+		return nil
+	}
+
+	if err := ValidateRoot(importRoot); err != nil {
+		return errors.Wrapf(err, "invalid root %q", importRoot)
+	}
+	if err != nil {
+		if gopaths := c.gopaths(); len(gopaths) > 0 {
+			GOPATH = gopaths[0]
+		}
+		if GOPATH == "" {
+			return errors.Errorf("no GOPATH to keep the cache of sources of %s in", importRoot)
+		}
+	}
+	c.GOPATH = GOPATH
+	p.ImportRoot = gps.ProjectRoot(importRoot)
+	return nil
+}
+
 // DetectProjectGOPATH attempt to find the GOPATH containing the project.
 //
 //  If p.AbsRoot is not a symlink and is within a GOPATH, the GOPATH containing p.AbsRoot is returned.
 //  If p.AbsRoot is a symlink and is not within any known GOPATH, the GOPATH containing p.ResolvedAbsRoot is returned.
 //
 // p.AbsRoot is assumed to be a symlink if it is not the same as p.ResolvedAbsRoot.
+// If it's only a symlink because the GOPATH is behind one, as /tmp is on macOS,
+// the GOPATH containing p.AbsRoot is returned.
 //
 // DetectProjectGOPATH will return an error in the following cases:
 //
@@ -187,7 +283,18 @@ func (c *Ctx) DetectProjectGOPATH(p *Project) (string, error) {
 
 	// If detectGOPATH() failed for both p.AbsRoot and p.ResolvedAbsRoot, then both are not within any known GOPATHs.
 	if perr != nil && rerr != nil {
-		return "", errors.Errorf("both %s and %s are not within any known GOPATH", p.AbsRoot, p.ResolvedAbsRoot)
+		return "", errors.Errorf("both %s and %s are not within any known GOPATH (%s)", p.AbsRoot, p.ResolvedAbsRoot, c.gopathList())
+	}
+
+	// If the GOPATH is itself behind a symlink, as /tmp is on macOS, then
+	// p.AbsRoot resolves to p.ResolvedAbsRoot through it, and both are the
+	// same project.
+	if perr == nil && rerr == nil && pGOPATH != rGOPATH {
+		prel, err1 := filepath.Rel(pGOPATH, p.AbsRoot)
+		rrel, err2 := filepath.Rel(rGOPATH, p.ResolvedAbsRoot)
+		if err1 == nil && err2 == nil && prel == rrel {
+			return pGOPATH, nil
+		}
 	}
 
 	// If pGOPATH equals rGOPATH, then both are within the same GOPATH.
@@ -196,7 +303,7 @@ func (c *Ctx) DetectProjectGOPATH(p *Project) (string, error) {
 	}
 
 	if pGOPATH != "" && rGOPATH != "" {
-		return "", errors.Errorf("%s and %s are both in different GOPATHs", p.AbsRoot, p.ResolvedAbsRoot)
+		return "", errors.Errorf("%s and %s are both in different GOPATHs, %s and %s", p.AbsRoot, p.ResolvedAbsRoot, pGOPATH, rGOPATH)
 	}
 
 	// Otherwise, either the p.AbsRoot or p.ResolvedAbsRoot is within a GOPATH.
@@ -207,14 +314,33 @@ func (c *Ctx) DetectProjectGOPATH(p *Project) (string, error) {
 	return pGOPATH, nil
 }
 
-// detectGOPATH detects the GOPATH for a given path from ctx.GOPATHs.
+// detectGOPATH detects the GOPATH for a given path from ctx.GOPATHs. A GOPATH
+// behind a symlink contains the paths resolved through it too, and is then
+// returned resolved, for the import path of path to be relative to it.
 func (c *Ctx) detectGOPATH(path string) (string, error) {
-	for _, gp := range c.GOPATHs {
+	for _, gp := range c.gopaths() {
 		if fs.HasFilepathPrefix(path, gp) {
 			return gp, nil
 		}
+		if rgp, err := filepath.EvalSymlinks(gp); err == nil && rgp != gp && fs.HasFilepathPrefix(path, rgp) {
+			return rgp, nil
+		}
+	}
+	return "", errors.Errorf("%s is not within a known GOPATH (%s)", path, c.gopathList())
+}
+
+// gopaths returns the Go paths to look for projects in, in order: GOPATHs, or
+// just GOPATH if they're not set.
+func (c *Ctx) gopaths() []string {
+	if len(c.GOPATHs) == 0 && c.GOPATH != "" {
+		return []string{c.GOPATH}
 	}
-	return "", errors.Errorf("%s is not within a known GOPATH", path)
+	return c.GOPATHs
+}
+
+// gopathList formats the Go paths for error messages, the way GOPATH lists them.
+func (c *Ctx) gopathList() string {
+	return strings.Join(c.gopaths(), string(filepath.ListSeparator))
 }
 
 // ImportForAbs returns the import path for an absolute project path by trimming the
@@ -231,20 +357,26 @@ func (c *Ctx) ImportForAbs(path string) (string, error) {
 		return filepath.ToSlash(path[len(srcprefix):]), nil
 	}
 
-	return "", errors.Errorf("%s not in GOPATH", path)
+	return "", errors.Errorf("%s not in GOPATH %s", path, c.GOPATH)
 }
 
 // AbsForImport returns the absolute path for the project root
-// including the $GOPATH. This will not work with stdlib packages and the
-// package directory needs to exist.
+// including the $GOPATH. Like the go tool, it looks in each of the GOPATHs in
+// order, and returns the first one the package directory exists in. This will
+// not work with stdlib packages.
 func (c *Ctx) AbsForImport(path string) (string, error) {
-	posspath := filepath.Join(c.GOPATH, "src", path)
-	dirOK, err := fs.IsDir(posspath)
-	if err != nil {
-		return "", errors.Wrapf(err, "checking if %s is a directory", posspath)
-	}
-	if !dirOK {
-		return "", errors.Errorf("%s does not exist", posspath)
+	for _, gp := range c.gopaths() {
+		posspath := filepath.Join(gp, "src", path)
+		dirOK, err := fs.IsDir(posspath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "checking if %s is a directory", posspath)
+		}
+		if dirOK {
+			return posspath, nil
+		}
 	}
-	return posspath, nil
+	return "", errors.Errorf("%s does not exist in any GOPATH (%s)", path, c.gopathList())
 }
@@ -14,7 +14,9 @@ import (
 	"testing"
 	"unicode"
 
+	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -103,6 +105,226 @@ func TestAbsoluteProjectRoot(t *testing.T) {
 	}
 }
 
+func TestAbsForImportMultipleGOPATHs(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("go/src/github.com/foo/first")
+	h.TempDir("go/src/github.com/foo/both")
+	h.TempDir("gotwo/src/github.com/foo/second")
+	h.TempDir("gotwo/src/github.com/foo/both")
+
+	depCtx := &Ctx{
+		GOPATH:  h.Path("go"),
+		GOPATHs: []string{h.Path("go"), h.Path("gotwo")},
+	}
+
+	for ip, want := range map[string]string{
+		"github.com/foo/first":  h.Path("go/src/github.com/foo/first"),
+		"github.com/foo/second": h.Path("gotwo/src/github.com/foo/second"),
+		"github.com/foo/both":   h.Path("go/src/github.com/foo/both"),
+	} {
+		got, err := depCtx.AbsForImport(ip)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", ip, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", ip, want, got)
+		}
+	}
+
+	_, err := depCtx.AbsForImport("github.com/foo/neither")
+	if err == nil {
+		t.Fatal("expected an error for a project in neither GOPATH")
+	}
+	for _, gp := range depCtx.GOPATHs {
+		if !strings.Contains(err.Error(), gp) {
+			t.Errorf("expected the error to name GOPATH entry %s, got: %s", gp, err)
+		}
+	}
+}
+
+func TestLoadProjectInSecondGOPATH(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("go/src")
+	h.TempDir("gotwo/src/example.com/project/sub")
+	h.TempFile("gotwo/src/example.com/project/"+ManifestName, "")
+
+	ctx := &Ctx{
+		Out: discardLogger,
+		Err: discardLogger,
+	}
+	err := ctx.SetPaths(h.Path("gotwo/src/example.com/project/sub"), h.Path("go"), h.Path("gotwo"))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		t.Fatalf("LoadProject failed: %+v", err)
+	}
+	if ctx.GOPATH != h.Path("gotwo") {
+		t.Errorf("expected GOPATH %s, got %s", h.Path("gotwo"), ctx.GOPATH)
+	}
+	if p.ImportRoot != "example.com/project" {
+		t.Errorf("expected import root example.com/project, got %s", p.ImportRoot)
+	}
+}
+
+func TestLoadProjectOutsideGOPATH(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("go/src")
+	h.TempDir("elsewhere/proj/sub")
+	h.TempFile("elsewhere/proj/"+ManifestName, `root = "github.com/org/proj"`)
+	h.TempDir("unrooted/sub")
+	h.TempFile("unrooted/"+ManifestName, "")
+
+	ctx := &Ctx{
+		Out: discardLogger,
+		Err: discardLogger,
+	}
+	if err := ctx.SetPaths(h.Path("elsewhere/proj/sub"), h.Path("go")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		t.Fatalf("LoadProject failed: %+v", err)
+	}
+	if p.ImportRoot != "github.com/org/proj" {
+		t.Errorf("expected import root github.com/org/proj, got %s", p.ImportRoot)
+	}
+	if p.AbsRoot != h.Path("elsewhere/proj") {
+		t.Errorf("expected root %s, got %s", h.Path("elsewhere/proj"), p.AbsRoot)
+	}
+	if ctx.GOPATH != h.Path("go") {
+		t.Errorf("expected the first GOPATH %s to be used, got %s", h.Path("go"), ctx.GOPATH)
+	}
+
+	// Without a root in the manifest, the import path can't be inferred.
+	ctx = &Ctx{
+		Out: discardLogger,
+		Err: discardLogger,
+	}
+	if err := ctx.SetPaths(h.Path("unrooted/sub"), h.Path("go")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := ctx.LoadProject(); err == nil {
+		t.Error("expected an error loading a project outside of GOPATH without a root")
+	}
+}
+
+func TestLoadProjectSymlinkedGOPATH(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires special privileges on Windows")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// golink is a GOPATH behind a symlink, as /tmp is on macOS, and the
+	// working dir is the resolved path of the project.
+	h.TempDir("go/src/example.com/proj/sub")
+	h.TempFile("go/src/example.com/proj/"+ManifestName, "")
+	if err := os.Symlink(h.Path("go"), filepath.Join(h.Path("."), "golink")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, wd := range map[string]string{
+		"resolved": h.Path("go/src/example.com/proj/sub"),
+		"symlink":  filepath.Join(h.Path("."), "golink", "src", "example.com", "proj", "sub"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := &Ctx{
+				Out: discardLogger,
+				Err: discardLogger,
+			}
+			if err := ctx.SetPaths(wd, filepath.Join(h.Path("."), "golink")); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			p, err := ctx.LoadProject()
+			if err != nil {
+				t.Fatalf("LoadProject failed: %+v", err)
+			}
+			if p.ImportRoot != "example.com/proj" {
+				t.Errorf("expected import root example.com/proj, got %s", p.ImportRoot)
+			}
+		})
+	}
+}
+
+func TestResolveProjectInvalidRoot(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("go")
+	h.TempDir("proj")
+	ctx := &Ctx{GOPATHs: []string{h.Path("go")}}
+	p := new(Project)
+	if err := p.SetRoot(h.Path("proj")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []string{"../proj", "/proj", "github.com/org/proj/"} {
+		if err := ctx.ResolveProject(p, root); err == nil {
+			t.Errorf("expected an error resolving the project with the root %q", root)
+		}
+	}
+	if err := ctx.ResolveProject(p, "github.com/org/proj"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if p.ImportRoot != "github.com/org/proj" || ctx.GOPATH != h.Path("go") {
+		t.Errorf("unexpected import root %s and GOPATH %s", p.ImportRoot, ctx.GOPATH)
+	}
+}
+
+func TestSourceManagerNoNetwork(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("go")
+	ctx := &Ctx{GOPATH: h.Path("go"), NoNetwork: true}
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	id := gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}
+	if _, err := sm.ListVersions(id); err == nil {
+		t.Fatal("expected an error listing the versions of an uncached source")
+	} else if _, ok := errors.Cause(err).(*gps.ErrNetworkDisabled); !ok {
+		t.Fatalf("expected an ErrNetworkDisabled, got %+v", err)
+	}
+}
+
+func TestSourceManagerCachedir(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("go")
+	h.TempDir("cache")
+	ctx := &Ctx{GOPATH: h.Path("go"), Cachedir: h.Path("cache")}
+	sm, err := ctx.SourceManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Release()
+
+	if _, err := os.Stat(filepath.Join(h.Path("cache"), "sources")); err != nil {
+		t.Errorf("expected the sources to be cached in the cache dir given: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(h.Path("go"), "pkg", "dep")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be cached in the GOPATH, got %v", err)
+	}
+}
+
 func TestLoadProject(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -210,6 +432,33 @@ func TestLoadProjectManifestParseError(t *testing.T) {
 	}
 }
 
+func TestLoadProjectStrict(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir(filepath.Join("src", "test1"))
+	h.TempFile(filepath.Join("src", "test1", ManifestName), "[[constriant]]\n  name = \"github.com/foo/bar\"\n")
+
+	for _, strict := range []bool{false, true} {
+		ctx := &Ctx{
+			Out:    discardLogger,
+			Err:    discardLogger,
+			Strict: strict,
+		}
+		if err := ctx.SetPaths(h.Path(filepath.Join("src", "test1")), h.Path(".")); err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		_, err := ctx.LoadProject()
+		if strict && err == nil {
+			t.Error("LoadProject should have failed on the unknown field when strict")
+		}
+		if !strict && err != nil {
+			t.Errorf("LoadProject should only have warned about the unknown field: %+v", err)
+		}
+	}
+}
+
 func TestLoadProjectLockParseError(t *testing.T) {
 	tg := test.NewHelper(t)
 	defer tg.Cleanup()
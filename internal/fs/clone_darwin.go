@@ -0,0 +1,39 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The clonefileat system call, from sys/syscall.h, and the fd it takes paths
+// relative to the working dir with, from sys/fcntl.h.
+const (
+	sysClonefileat = 462
+	atFdcwd        = -2
+)
+
+// cloneFile clones the regular file src to dst, which mustn't exist, with
+// clonefileat, which copies its mode too.
+func cloneFile(src, dst string) error {
+	srcp, err := syscall.BytePtrFromString(src)
+	if err != nil {
+		return err
+	}
+	dstp, err := syscall.BytePtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	fdcwd := atFdcwd
+	_, _, errno := syscall.Syscall6(sysClonefileat, uintptr(fdcwd), uintptr(unsafe.Pointer(srcp)), uintptr(fdcwd), uintptr(unsafe.Pointer(dstp)), 0, 0)
+	if errno == syscall.EEXIST {
+		return &os.LinkError{Op: "clone", Old: src, New: dst, Err: errno}
+	} else if errno != 0 {
+		return cloneFailed(src, dst, errno)
+	}
+	return nil
+}
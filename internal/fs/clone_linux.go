@@ -0,0 +1,40 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, _IOW(0x94, 9, int), from linux/fs.h.
+const ficlone = 0x40049409
+
+// cloneFile clones the regular file src to dst, which mustn't exist, with the
+// FICLONE ioctl, keeping its mode.
+func cloneFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	if cerr := out.Close(); errno == 0 && cerr != nil {
+		return cloneFailed(src, dst, cerr)
+	}
+	if errno != 0 {
+		return cloneFailed(src, dst, errno)
+	}
+	return os.Chmod(dst, fi.Mode())
+}
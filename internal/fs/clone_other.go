@@ -0,0 +1,14 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!darwin
+
+package fs
+
+import "github.com/pkg/errors"
+
+// cloneFile fails, as files can't be cloned here.
+func cloneFile(src, dst string) error {
+	return errors.New("cloning files is not supported")
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DigestTree returns a hex-encoded SHA-256 digest of the files and symlinks
+// of the tree rooted at dir. Each is hashed in lexical order as its path
+// relative to dir, with forward slashes, its type and whether it's executable,
+// then its contents, or the target of a symlink. Directories only count
+// through what they contain, and other permission bits are left out, as they
+// depend on the umask of whoever wrote the tree.
+func DigestTree(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		writeDigestField(h, []byte(filepath.ToSlash(rel)))
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			writeDigestField(h, []byte("l"))
+			writeDigestField(h, []byte(filepath.ToSlash(target)))
+		case info.Mode().IsRegular():
+			kind := "f"
+			if info.Mode()&0111 != 0 {
+				kind = "x"
+			}
+			writeDigestField(h, []byte(kind))
+
+			// The length goes first, so that contents can't run on into
+			// the next path.
+			binary.Write(h, binary.BigEndian, info.Size())
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("cannot digest %s, which is neither a file nor a symlink", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to digest %s", dir)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeDigestField writes b to w followed by a NUL, which can't appear in
+// paths.
+func writeDigestField(w io.Writer, b []byte) {
+	w.Write(b)
+	w.Write([]byte{0})
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDigestTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTree := func(name string, files map[string]string) string {
+		root := filepath.Join(dir, name)
+		for path, contents := range files {
+			path = filepath.Join(root, filepath.FromSlash(path))
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root
+	}
+	digest := func(root string) string {
+		d, err := DigestTree(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	files := map[string]string{
+		"a.go":     "package a",
+		"sub/b.go": "package sub",
+	}
+	want := digest(writeTree("orig", files))
+
+	if got := digest(writeTree("same", files)); got != want {
+		t.Errorf("expected identical trees to have the same digest, got %s and %s", want, got)
+	}
+
+	// An empty dir doesn't count.
+	emptied := writeTree("emptydir", files)
+	if err := os.Mkdir(filepath.Join(emptied, "empty"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if got := digest(emptied); got != want {
+		t.Errorf("expected an empty dir not to change the digest, got %s and %s", want, got)
+	}
+
+	changed := map[string]map[string]string{
+		"contents": {"a.go": "package b", "sub/b.go": "package sub"},
+		"path":     {"a.go": "package a", "sub/c.go": "package sub"},
+		"added":    {"a.go": "package a", "sub/b.go": "package sub", "c.go": ""},
+		"moved":    {"a.go": "package asub/b.go", "sub/b.go": ""},
+	}
+	for name, files := range changed {
+		if got := digest(writeTree(name, files)); got == want {
+			t.Errorf("expected the digest to change with a different %s", name)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		exec := writeTree("exec", files)
+		if err := os.Chmod(filepath.Join(exec, "a.go"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if got := digest(exec); got == want {
+			t.Error("expected the digest to change when a file becomes executable")
+		}
+	}
+
+	if _, err := DigestTree(filepath.Join(dir, "nonexistent")); err == nil {
+		t.Error("expected an error digesting a nonexistent dir")
+	}
+}
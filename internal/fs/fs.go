@@ -7,16 +7,43 @@ package fs
 import (
 	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 	"unicode"
 
 	"github.com/pkg/errors"
 )
 
+// Warn is told of what the functions of the package do differently to how
+// they were asked, such as copying what a symlink points to where it can't be
+// recreated, if it's set.
+var Warn *log.Logger
+
+func warnf(format string, args ...interface{}) {
+	if Warn != nil {
+		Warn.Printf(format, args...)
+	}
+}
+
+// The functions files are renamed and symlinks are made with, which tests
+// replace to simulate their failures, such as renames across filesystems.
+var (
+	osRename  = os.Rename
+	osSymlink = os.Symlink
+)
+
+// How many times a rename which fails transiently is retried, and how long is
+// waited before the first retry; the wait doubles for each one after.
+var (
+	renameRetries    = 5
+	renameRetryDelay = 20 * time.Millisecond
+)
+
 // HasFilepathPrefix will determine if "path" starts with "prefix" from
 // the point of view of a filesystem.
 //
@@ -102,9 +129,11 @@ func HasFilepathPrefix(path, prefix string) bool {
 
 // RenameWithFallback attempts to rename a file or directory, but falls back to
 // copying in the event of a cross-device link error. If the fallback copy
-// succeeds, src is still removed, emulating normal rename behavior.
+// succeeds, src is still removed, emulating normal rename behavior. On
+// Windows, renames which fail as another process holds a handle to src or dst,
+// as antivirus software briefly does, are retried a few times first.
 func RenameWithFallback(src, dst string) error {
-	_, err := os.Stat(src)
+	_, err := os.Lstat(src)
 	if err != nil {
 		return errors.Wrapf(err, "cannot stat %s", src)
 	}
@@ -117,16 +146,42 @@ func RenameWithFallback(src, dst string) error {
 	return renameFallback(err, src, dst)
 }
 
+// retryRename renames src to dst with osRename, retrying up to renameRetries
+// times for as long as it fails with errors that transient reports are.
+func retryRename(src, dst string, transient func(error) bool) error {
+	delay := renameRetryDelay
+	err := osRename(src, dst)
+	for i := 0; i < renameRetries && err != nil && transient(err); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = osRename(src, dst)
+	}
+	return err
+}
+
 // renameByCopy attempts to rename a file or directory by copying it to the
 // destination and then removing the src thus emulating the rename behavior.
+// Modes are kept, and symlinks, including src itself, are recreated. As a
+// rename would, a file replaces one at dst; the one at dst is unlinked, rather
+// than written over, in case it's a link to another.
 func renameByCopy(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return errors.Wrapf(err, "cannot stat %s", src)
+	}
+
 	var cerr error
-	if dir, _ := IsDir(src); dir {
+	if fi.IsDir() {
 		cerr = CopyDir(src, dst)
 		if cerr != nil {
 			cerr = errors.Wrap(cerr, "copying directory failed")
 		}
 	} else {
+		if dfi, err := os.Lstat(dst); err == nil && !dfi.IsDir() {
+			if err = os.Remove(dst); err != nil {
+				return errors.Wrapf(err, "rename fallback failed: cannot replace %s", dst)
+			}
+		}
 		cerr = copyFile(src, dst)
 		if cerr != nil {
 			cerr = errors.Wrap(cerr, "copying file failed")
@@ -215,6 +270,11 @@ var (
 // CopyDir recursively copies a directory tree, attempting to preserve permissions.
 // Source directory must exist, destination directory must *not* exist.
 func CopyDir(src, dst string) error {
+	return copyDir(src, dst, copyFile)
+}
+
+// copyDir is CopyDir, but with copy to copy each file in the tree.
+func copyDir(src, dst string, copy func(src, dst string) error) error {
 	src = filepath.Clean(src)
 	dst = filepath.Clean(dst)
 
@@ -250,13 +310,13 @@ func CopyDir(src, dst string) error {
 		dstPath := filepath.Join(dst, entry.Name())
 
 		if entry.IsDir() {
-			if err = CopyDir(srcPath, dstPath); err != nil {
+			if err = copyDir(srcPath, dstPath, copy); err != nil {
 				return errors.Wrap(err, "copying directory failed")
 			}
 		} else {
 			// This will include symlinks, which is what we want when
 			// copying things.
-			if err = copyFile(srcPath, dstPath); err != nil {
+			if err = copy(srcPath, dstPath); err != nil {
 				return errors.Wrap(err, "copying file failed")
 			}
 		}
@@ -270,26 +330,20 @@ func CopyDir(src, dst string) error {
 // destination file exists, all its contents will be replaced by the contents
 // of the source file. The file mode will be copied from the source and
 // the copied data is synced/flushed to stable storage.
+//
+// A symlink is recreated, unless symlinks can't be made at dst, in which case
+// what it points to is copied instead, with a warning.
 func copyFile(src, dst string) (err error) {
 	if sym, err := IsSymlink(src); err != nil {
 		return errors.Wrap(err, "symlink check failed")
 	} else if sym {
-		if err := cloneSymlink(src, dst); err != nil {
-			if runtime.GOOS == "windows" {
-				// If cloning the symlink fails on Windows because the user
-				// does not have the required privileges, ignore the error and
-				// fall back to copying the file contents.
-				//
-				// ERROR_PRIVILEGE_NOT_HELD is 1314 (0x522):
-				// https://msdn.microsoft.com/en-us/library/windows/desktop/ms681385(v=vs.85).aspx
-				if lerr, ok := err.(*os.LinkError); ok && lerr.Err != syscall.Errno(1314) {
-					return err
-				}
-			} else {
-				return err
-			}
-		} else {
-			return nil
+		err := cloneSymlink(src, dst)
+		if err == nil || !symlinkUnsupported(err) {
+			return err
+		}
+		warnf("%s can't be made a symlink (%s), so what it points to is copied to it instead\n", dst, err)
+		if dir, _ := IsDir(src); dir {
+			return copySymlinkedDir(src, dst)
 		}
 	}
 
@@ -331,7 +385,41 @@ func cloneSymlink(sl, dst string) error {
 		return err
 	}
 
-	return os.Symlink(resolved, dst)
+	return osSymlink(resolved, dst)
+}
+
+// symlinkUnsupported reports whether err, from making a symlink, means that
+// symlinks can't be made there: for want of privilege, as usual on Windows, or
+// of support by the filesystem, as with FAT and some network volumes.
+func symlinkUnsupported(err error) bool {
+	lerr, ok := err.(*os.LinkError)
+	if !ok {
+		return false
+	}
+	// ERROR_PRIVILEGE_NOT_HELD is 1314 (0x522):
+	// https://msdn.microsoft.com/en-us/library/windows/desktop/ms681385(v=vs.85).aspx
+	if runtime.GOOS == "windows" && lerr.Err == syscall.Errno(1314) {
+		return true
+	}
+	return os.IsPermission(lerr.Err) || lerr.Err == syscall.EOPNOTSUPP || lerr.Err == syscall.ENOSYS
+}
+
+// copySymlinkedDir copies the dir the symlink src points to, to dst, where the
+// symlink can't be recreated. A symlink to a dir it's in is an error, as
+// copying what it points to would never end.
+func copySymlinkedDir(src, dst string) error {
+	target, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(src))
+	if err != nil {
+		return err
+	}
+	if HasFilepathPrefix(dir, target) {
+		return errors.Errorf("cannot copy %s, as it points to a dir it's in", src)
+	}
+	return CopyDir(target, dst)
 }
 
 // IsDir determines is the path given is a directory or not.
@@ -0,0 +1,117 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// LinkMode is how CopyDirLinked populates the files of the dir it copies to.
+type LinkMode int
+
+const (
+	// CopyFiles copies the contents of every file, as CopyDir does.
+	CopyFiles LinkMode = iota
+	// CloneFiles clones files where the filesystem can, so that they share
+	// their contents with the originals until either is written to: with
+	// FICLONE on Linux, as Btrfs and XFS support, and clonefile on macOS, as
+	// APFS supports. Other files are copied.
+	CloneFiles
+	// LinkFiles clones files where the filesystem can, and otherwise hard
+	// links them, so that they are the originals. Other files, as on another
+	// filesystem, are copied. As writing to a hard link in place writes to its
+	// original too, files copied this way are only to be replaced or removed.
+	LinkFiles
+)
+
+var linkModeNames = map[LinkMode]string{
+	CopyFiles:  "copy",
+	CloneFiles: "clone",
+	LinkFiles:  "auto",
+}
+
+func (m LinkMode) String() string {
+	return linkModeNames[m]
+}
+
+// Set sets m to the LinkMode named s, as ParseLinkMode does, so that a
+// LinkMode is a flag.Value.
+func (m *LinkMode) Set(s string) error {
+	mode, err := ParseLinkMode(s)
+	if err == nil {
+		*m = mode
+	}
+	return err
+}
+
+// ParseLinkMode returns the LinkMode named s: "copy", "clone", or "auto" for
+// LinkFiles.
+func ParseLinkMode(s string) (LinkMode, error) {
+	for m, name := range linkModeNames {
+		if name == s {
+			return m, nil
+		}
+	}
+	return CopyFiles, errors.Errorf("%q is not a way to copy files; use \"auto\", \"clone\" or \"copy\"", s)
+}
+
+// CopyDirLinked is CopyDir, but populates the files of dst as mode says. Each
+// file which can't be cloned or linked, as it's on another filesystem, or for
+// want of permission or support, is copied instead. Symlinks are recreated,
+// as CopyDir does.
+func CopyDirLinked(src, dst string, mode LinkMode) error {
+	if mode == CopyFiles {
+		return CopyDir(src, dst)
+	}
+	l := &linker{mode: mode}
+	return copyDir(src, dst, l.linkFile)
+}
+
+// linker clones or links files as its mode says. Once cloning, or linking,
+// fails other than for want of permission, it's not tried again, as the
+// filesystem has shown it can't; a tree is mostly all on one filesystem.
+type linker struct {
+	mode            LinkMode
+	noClone, noLink bool
+}
+
+func (l *linker) linkFile(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return copyFile(src, dst)
+	}
+
+	if !l.noClone {
+		err = cloneFile(src, dst)
+		if err == nil {
+			return nil
+		}
+		l.noClone = !os.IsPermission(err)
+	}
+	if l.mode == LinkFiles && !l.noLink {
+		err = os.Link(src, dst)
+		if err == nil {
+			return nil
+		}
+		l.noLink = !os.IsPermission(err)
+	}
+
+	// Anything in the way is unlinked rather than written over, as it may be
+	// a link to another file.
+	os.Remove(dst)
+	return copyFile(src, dst)
+}
+
+// cloneFailed cleans up after failing to clone src to dst with err: dst is
+// removed, and err is returned as the *os.LinkError of the clone.
+func cloneFailed(src, dst string, err error) error {
+	os.Remove(dst)
+	return &os.LinkError{Op: "clone", Old: src, New: dst, Err: err}
+}
@@ -0,0 +1,200 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseLinkMode(t *testing.T) {
+	for _, mode := range []LinkMode{CopyFiles, CloneFiles, LinkFiles} {
+		got, err := ParseLinkMode(mode.String())
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", mode, err)
+		} else if got != mode {
+			t.Errorf("Expected %q to parse as %d, got %d", mode, mode, got)
+		}
+	}
+	if _, err := ParseLinkMode("hardlink"); err == nil {
+		t.Error("Expected an error parsing an unknown mode")
+	}
+}
+
+// mkLinkTree makes a tree of files to copy in dir, returning their paths
+// relative to it.
+func mkLinkTree(t testing.TB, dir string, n, size int) []string {
+	var files []string
+	for i := 0; i < n; i++ {
+		rel := filepath.Join(fmt.Sprintf("pkg%d", i%10), fmt.Sprintf("file%d.go", i))
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, bytes.Repeat([]byte{byte('a' + i%26)}, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, rel)
+	}
+	return files
+}
+
+func TestCopyDirLinked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	files := mkLinkTree(t, srcdir, 4, 64)
+	if err = os.Chmod(filepath.Join(srcdir, files[0]), 0755); err != nil {
+		t.Fatal(err)
+	}
+	symlinks := runtime.GOOS != "windows"
+	if symlinks {
+		if err = os.Symlink(files[1], filepath.Join(srcdir, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mode := range []LinkMode{CopyFiles, CloneFiles, LinkFiles} {
+		t.Run(mode.String(), func(t *testing.T) {
+			dst := filepath.Join(dir, mode.String())
+			if err := CopyDirLinked(srcdir, dst, mode); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, rel := range files {
+				want, err := os.Stat(filepath.Join(srcdir, rel))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.Stat(filepath.Join(dst, rel))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Mode() != want.Mode() || got.Size() != want.Size() {
+					t.Errorf("Expected %s to have the mode %s and size %d, got %s and %d", rel, want.Mode(), want.Size(), got.Mode(), got.Size())
+				}
+				if mode != LinkFiles && os.SameFile(got, want) {
+					t.Errorf("Expected %s to be a file of its own, not a hard link", rel)
+				}
+			}
+			if symlinks {
+				if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != files[1] {
+					t.Errorf("Expected the symlink to be recreated, pointing to %s, got %q (%v)", files[1], target, err)
+				}
+			}
+
+			if err := CopyDirLinked(srcdir, dst, mode); err != errDstExist {
+				t.Errorf("Expected copying over an existing dir to fail with %q, got %v", errDstExist, err)
+			}
+		})
+	}
+}
+
+func TestLinkerFallsBack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err = ioutil.WriteFile(src, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sfi, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Where files can't be cloned, they're hard linked.
+	l := &linker{mode: LinkFiles, noClone: true}
+	linked := filepath.Join(dir, "linked")
+	if err = l.linkFile(src, linked); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(linked); err != nil || !os.SameFile(fi, sfi) {
+		t.Errorf("Expected %s to be hard linked to %s (%v)", linked, src, err)
+	}
+
+	// Where they can't be linked, they're copied, and linking isn't tried
+	// again. The hard link in the way is unlinked, not written through.
+	l = &linker{mode: LinkFiles, noClone: true}
+	if err = l.linkFile(src, linked); err != nil {
+		t.Fatalf("Expected failing to link over an existing file to fall back to copying it, got %s", err)
+	}
+	if !l.noLink {
+		t.Error("Expected linking not to be tried again once it failed")
+	}
+	if fi, err := os.Stat(linked); err != nil || os.SameFile(fi, sfi) {
+		t.Errorf("Expected %s to be copied from %s, not linked (%v)", linked, src, err)
+	}
+	if got, err := ioutil.ReadFile(src); err != nil || string(got) != "contents" {
+		t.Errorf("Expected %s to be left as it was, got %q (%v)", src, got, err)
+	}
+}
+
+// BenchmarkCopyDirLinked copies a tree the size of a large vendor/, of 2000
+// files of 16KB, in each mode. Where the filesystem supports them, clones and
+// hard links are much faster than copies, and take no space of their own; the
+// space the copies take is logged.
+func BenchmarkCopyDirLinked(b *testing.B) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const n, size = 2000, 16 << 10
+	srcdir := filepath.Join(dir, "src")
+	files := mkLinkTree(b, srcdir, n, size)
+
+	for _, mode := range []LinkMode{CopyFiles, CloneFiles, LinkFiles} {
+		b.Run(mode.String(), func(b *testing.B) {
+			b.SetBytes(n * size)
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(dir, mode.String())
+				if err := CopyDirLinked(srcdir, dst, mode); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if i == 0 {
+					b.Logf("%d of %d bytes written anew", bytesWritten(b, srcdir, dst, files), n*size)
+				}
+				os.RemoveAll(dst)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// bytesWritten returns how many bytes of the files in dst aren't hard links to
+// those in src. Clones share their contents too, but can't be told apart from
+// copies portably, so they're counted.
+func bytesWritten(b *testing.B, src, dst string, files []string) int64 {
+	var n int64
+	for _, rel := range files {
+		sfi, err := os.Stat(filepath.Join(src, rel))
+		if err != nil {
+			b.Fatal(err)
+		}
+		dfi, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !os.SameFile(sfi, dfi) {
+			n += dfi.Size()
+		}
+	}
+	return n
+}
@@ -15,7 +15,7 @@ import (
 )
 
 func rename(src, dst string) error {
-	return os.Rename(src, dst)
+	return osRename(src, dst)
 }
 
 // renameFallback attempts to determine the appropriate fallback to failed rename
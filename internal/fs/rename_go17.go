@@ -29,7 +29,7 @@ func rename(src, dst string) error {
 		return errors.Errorf("cannot rename directory %s to existing dst %s", src, dst)
 	}
 
-	return os.Rename(src, dst)
+	return osRename(src, dst)
 }
 
 // renameFallback attempts to determine the appropriate fallback to failed rename
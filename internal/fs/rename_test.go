@@ -0,0 +1,254 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failRenames makes renames fail with errno, as they would across
+// filesystems for syscall.EXDEV, until the returned func is called.
+func failRenames(errno syscall.Errno) func() {
+	osRename = func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: errno}
+	}
+	return func() { osRename = os.Rename }
+}
+
+func TestRenameWithFallbackCrossDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer failRenames(syscall.EXDEV)()
+
+	src := filepath.Join(dir, "src")
+	files := map[string]os.FileMode{
+		"a.go":              0644,
+		"run.sh":            0755,
+		"sub/b.go":          0600,
+		"sub/deeper/c.go":   0644,
+		"sub/deeper/d.json": 0640,
+	}
+	for rel, mode := range files {
+		path := filepath.Join(src, filepath.FromSlash(rel))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(rel), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := runtime.GOOS != "windows"
+	if symlinks {
+		if err = os.Symlink(filepath.Join("sub", "b.go"), filepath.Join(src, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(dir, "dst")
+	if err = RenameWithFallback(src, dst); err != nil {
+		t.Fatalf("Expected renaming across filesystems to fall back to copying, got %s", err)
+	}
+	if _, err = os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed once copied, got %v", src, err)
+	}
+	for rel, mode := range files {
+		path := filepath.Join(dst, filepath.FromSlash(rel))
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("Expected %s to be copied: %s", rel, err)
+			continue
+		}
+		if runtime.GOOS != "windows" && fi.Mode() != mode {
+			t.Errorf("Expected %s to keep the mode %s, got %s", rel, mode, fi.Mode())
+		}
+		if b, _ := ioutil.ReadFile(path); string(b) != rel {
+			t.Errorf("Expected %s to hold %q, got %q", rel, rel, b)
+		}
+	}
+	if symlinks {
+		if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != filepath.Join("sub", "b.go") {
+			t.Errorf("Expected the symlink to be recreated, got %q (%v)", target, err)
+		}
+	}
+}
+
+func TestRenameWithFallbackCrossDeviceReplacesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer failRenames(syscall.EXDEV)()
+
+	src, dst, other := filepath.Join(dir, "src"), filepath.Join(dir, "dst"), filepath.Join(dir, "other")
+	if err = ioutil.WriteFile(src, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(other, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// dst is a hard link to other, which mustn't be written through.
+	if err = os.Link(other, dst); err != nil {
+		t.Skipf("Can't make hard links: %s", err)
+	}
+
+	if err = RenameWithFallback(src, dst); err != nil {
+		t.Fatalf("Expected renaming across filesystems to fall back to copying, got %s", err)
+	}
+	if b, _ := ioutil.ReadFile(dst); string(b) != "new" {
+		t.Errorf("Expected %s to be replaced, got %q", dst, b)
+	}
+	if b, _ := ioutil.ReadFile(other); string(b) != "old" {
+		t.Errorf("Expected %s, which %s was linked to, to be left as it was, got %q", other, dst, b)
+	}
+	if _, err = os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed once copied, got %v", src, err)
+	}
+}
+
+func TestRenameWithFallbackOtherErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("access denied is retried, and then copied, on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer failRenames(syscall.EACCES)()
+
+	src := filepath.Join(dir, "src")
+	if err = ioutil.WriteFile(src, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = RenameWithFallback(src, filepath.Join(dir, "dst")); err == nil {
+		t.Fatal("Expected a rename failing other than across filesystems to fail")
+	}
+	if _, err = os.Stat(src); err != nil {
+		t.Errorf("Expected %s to be left as it was: %s", src, err)
+	}
+}
+
+func TestRetryRename(t *testing.T) {
+	defer func(d time.Duration) { renameRetryDelay = d }(renameRetryDelay)
+	renameRetryDelay = 0
+	defer func() { osRename = os.Rename }()
+
+	held := &os.LinkError{Op: "rename", Old: "src", New: "dst", Err: syscall.EBUSY}
+	transient := func(err error) bool { return err == held }
+
+	var calls int
+	osRename = func(src, dst string) error {
+		calls++
+		if calls < 3 {
+			return held
+		}
+		return nil
+	}
+	if err := retryRename("src", "dst", transient); err != nil {
+		t.Errorf("Expected the rename to succeed once retried, got %s", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected the rename to be tried 3 times, got %d", calls)
+	}
+
+	calls = 0
+	osRename = func(src, dst string) error {
+		calls++
+		return held
+	}
+	if err := retryRename("src", "dst", transient); err != held {
+		t.Errorf("Expected the rename to fail with %v, got %v", held, err)
+	}
+	if calls != renameRetries+1 {
+		t.Errorf("Expected the rename to be tried %d times, got %d", renameRetries+1, calls)
+	}
+
+	calls = 0
+	denied := &os.LinkError{Op: "rename", Old: "src", New: "dst", Err: syscall.EACCES}
+	osRename = func(src, dst string) error {
+		calls++
+		return denied
+	}
+	if err := retryRename("src", "dst", transient); err != denied || calls != 1 {
+		t.Errorf("Expected a rename failing for good not to be retried, got %v after %d tries", err, calls)
+	}
+}
+
+func TestCopyDirSymlinksUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(src, "sub", "a.go"), []byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join("sub", "a.go"), filepath.Join(src, "file-link")); err != nil {
+		t.Skipf("Can't make symlinks: %s", err)
+	}
+	if err = os.Symlink("sub", filepath.Join(src, "dir-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Symlinks can't be made where the tree's copied to.
+	osSymlink = func(oldname, newname string) error {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	defer func() { osSymlink = os.Symlink }()
+	var warnings bytes.Buffer
+	Warn = log.New(&warnings, "", 0)
+	defer func() { Warn = nil }()
+
+	dst := filepath.Join(dir, "dst")
+	if err = CopyDir(src, dst); err != nil {
+		t.Fatalf("Expected the symlinks to be copied as what they point to, got %s", err)
+	}
+	for _, rel := range []string{"file-link", filepath.Join("dir-link", "a.go")} {
+		fi, err := os.Lstat(filepath.Join(dst, rel))
+		if err != nil {
+			t.Errorf("Expected %s to be copied: %s", rel, err)
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			t.Errorf("Expected %s to be a regular file, got the mode %s", rel, fi.Mode())
+		}
+	}
+	if fi, err := os.Lstat(filepath.Join(dst, "dir-link")); err != nil || !fi.IsDir() {
+		t.Errorf("Expected dir-link to be copied as a dir (%v)", err)
+	}
+	if got := strings.Count(warnings.String(), "can't be made a symlink"); got != 2 {
+		t.Errorf("Expected a warning for each of the 2 symlinks, got:\n%s", warnings.String())
+	}
+
+	// A symlink to a dir it's in can't be copied as what it points to.
+	if err = os.Symlink("..", filepath.Join(src, "sub", "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err = CopyDir(src, filepath.Join(dir, "loop")); err == nil {
+		t.Error("Expected copying a symlink to a dir it's in to fail")
+	}
+}
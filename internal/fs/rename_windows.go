@@ -13,8 +13,33 @@ import (
 	"github.com/pkg/errors"
 )
 
+// The errors of renames which fail while another process holds a handle to
+// src or dst, as antivirus software and indexers briefly do.
+// See https://msdn.microsoft.com/en-us/library/cc231199.aspx
+const (
+	errorAccessDenied     = syscall.Errno(0x5)
+	errorSharingViolation = syscall.Errno(0x20)
+	errorLockViolation    = syscall.Errno(0x21)
+)
+
+// rename retries renames which fail as another process holds a handle to src
+// or dst, as the handle's likely to be closed soon.
 func rename(src, dst string) error {
-	return os.Rename(src, dst)
+	return retryRename(src, dst, isHeldOpen)
+}
+
+// isHeldOpen reports whether err, from a rename, is as another process holds
+// a handle to the file renamed or replaced.
+func isHeldOpen(err error) bool {
+	lerr, ok := err.(*os.LinkError)
+	if !ok {
+		return false
+	}
+	switch lerr.Err {
+	case errorAccessDenied, errorSharingViolation, errorLockViolation:
+		return true
+	}
+	return false
 }
 
 // renameFallback attempts to determine the appropriate fallback to failed rename
@@ -37,7 +62,10 @@ func renameFallback(err error, src, dst string) error {
 
 		// 0x11 (ERROR_NOT_SAME_DEVICE) is the windows error.
 		// See https://msdn.microsoft.com/en-us/library/cc231199.aspx
-		if ok && noerr != 0x11 {
+		//
+		// A rename still failing as another process holds a handle to src
+		// or dst, once retried, may yet be done by copying.
+		if ok && noerr != 0x11 && !isHeldOpen(terr) {
 			return errors.Wrapf(terr, "link error: cannot rename %s to %s", src, dst)
 		}
 	}
@@ -0,0 +1,217 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// archiveTimeout is how long downloading an archive of a revision may take
+// before it's given up on, for the source to be fetched instead.
+const archiveTimeout = 5 * time.Minute
+
+// archiveExporter is implemented by sources which can export a revision from
+// an archive of it downloaded from their forge, without their copy in the cache
+// being set up at all.
+type archiveExporter interface {
+	exportArchive(ctx context.Context, client *http.Client, r Revision, to string) error
+}
+
+// exportArchive downloads an archive of the revision r of the source with
+// client and unpacks it to the dir to, if the source is on GitHub or
+// Bitbucket, which serve them.
+func (s *gitSource) exportArchive(ctx context.Context, client *http.Client, r Revision, to string) error {
+	u, ok := archiveURL(s.upstreamURL(), r)
+	if !ok {
+		return errors.Errorf("no archives are served of %s", s.upstreamURL())
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "unable to download %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unable to download %s: status %d", u, resp.StatusCode)
+	}
+
+	if err = unpackArchive(resp.Body, r, to); err != nil {
+		return errors.Wrapf(err, "unable to unpack %s", u)
+	}
+	return nil
+}
+
+// archiveURL returns the URL of a gzipped tarball of the revision r of the git
+// repository at u, if it's on GitHub or Bitbucket, whatever the scheme of u.
+func archiveURL(u string, r Revision) (string, bool) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(pu.Path, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	switch pu.Host {
+	case "github.com":
+		return "https://codeload.github.com/" + parts[0] + "/" + parts[1] + "/tar.gz/" + string(r), true
+	case "bitbucket.org":
+		return "https://bitbucket.org/" + parts[0] + "/" + parts[1] + "/get/" + string(r) + ".tar.gz", true
+	}
+	return "", false
+}
+
+// unpackArchive unpacks the gzipped tarball of the revision r read from rd to
+// the dir to, just as checking r out there would write it. All the paths in
+// the tarball are under a dir named for r, as those of the forges are; it's
+// verified that they're of r by that name.
+//
+// Trees with .gitattributes which keep some files out of archives, or change
+// them in archives, aren't unpacked, as they wouldn't be as checked out.
+func unpackArchive(rd io.Reader, r Revision, to string) (err error) {
+	_, serr := os.Stat(to)
+	defer func() {
+		// Don't leave anything half unpacked.
+		if err != nil {
+			os.RemoveAll(to)
+			if serr == nil {
+				os.MkdirAll(to, 0777)
+			}
+		}
+	}()
+
+	gz, err := gzip.NewReader(rd)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	var top string
+	symlinks := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			// git writes the revision it archived in a global header, which
+			// archive/tar doesn't make equally available in every version.
+			continue
+		}
+
+		dir, rel := hdr.Name, ""
+		if i := strings.Index(hdr.Name, "/"); i >= 0 {
+			dir, rel = hdr.Name[:i], path.Clean(hdr.Name[i+1:])
+		}
+		if top == "" {
+			if !archiveDirOf(dir, r) {
+				return errors.Errorf("archive is of %q, not revision %s", dir, r)
+			}
+			top = dir
+		} else if dir != top {
+			return errors.Errorf("%s is outside the dir %s of the archive", hdr.Name, top)
+		}
+		if rel == "" || rel == "." {
+			continue
+		}
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return errors.Errorf("%s is outside the dir of the archive", hdr.Name)
+		}
+		for p := path.Dir(rel); p != "."; p = path.Dir(p) {
+			if symlinks[p] {
+				return errors.Errorf("%s is under the symlink %s", hdr.Name, p)
+			}
+		}
+
+		dst := filepath.Join(to, filepath.FromSlash(rel))
+		if hdr.Typeflag != tar.TypeDir {
+			if err = os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+				return err
+			}
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dst, 0777)
+		case tar.TypeReg:
+			if path.Base(rel) == ".gitattributes" {
+				var b []byte
+				if b, err = ioutil.ReadAll(tr); err != nil {
+					return err
+				}
+				if bytes.Contains(b, []byte("export-ignore")) || bytes.Contains(b, []byte("export-subst")) {
+					return errors.Errorf("%s changes what's archived", rel)
+				}
+				err = ioutil.WriteFile(dst, b, 0666)
+				break
+			}
+			err = writeArchivedFile(dst, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			symlinks[rel] = true
+			err = os.Symlink(hdr.Linkname, dst)
+		default:
+			return errors.Errorf("%s is of unexpected type %q", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if top == "" {
+		return errors.New("archive is empty")
+	}
+	return nil
+}
+
+// archiveDirOf reports whether dir, the dir of an archive, is named for the
+// revision r, ending with at least the first seven digits of its hash after a
+// hyphen, as those of GitHub and Bitbucket do.
+func archiveDirOf(dir string, r Revision) bool {
+	i := strings.LastIndex(dir, "-")
+	if i < 0 {
+		return false
+	}
+	hash := dir[i+1:]
+	return len(hash) >= 7 && strings.HasPrefix(string(r), hash)
+}
+
+// writeArchivedFile writes the contents of the file read from rd to path,
+// executable if mode says it is, as git would check it out.
+func writeArchivedFile(path string, rd io.Reader, mode os.FileMode) error {
+	perm := os.FileMode(0666)
+	if mode&0111 != 0 {
+		perm = 0777
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, rd)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,274 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/vcs"
+	"github.com/golang/dep/internal/fs"
+)
+
+func TestArchiveURL(t *testing.T) {
+	r := Revision("0123456789abcdef0123456789abcdef01234567")
+	cases := map[string]string{
+		"https://github.com/foo/bar":           "https://codeload.github.com/foo/bar/tar.gz/" + string(r),
+		"ssh://git@github.com/foo/bar.git":     "https://codeload.github.com/foo/bar/tar.gz/" + string(r),
+		"git://github.com/foo/bar":             "https://codeload.github.com/foo/bar/tar.gz/" + string(r),
+		"https://bitbucket.org/foo/bar":        "https://bitbucket.org/foo/bar/get/" + string(r) + ".tar.gz",
+		"https://github.com/foo":               "",
+		"https://github.com/foo/bar/baz":       "",
+		"https://gitlab.com/foo/bar":           "",
+		"https://github.example.com/foo/bar":   "",
+		"file:///home/me/src/github.com/foo/x": "",
+	}
+	for u, want := range cases {
+		got, ok := archiveURL(u, r)
+		if got != want || ok != (want != "") {
+			t.Errorf("Expected the archive URL of %s to be %q, got %q", u, want, got)
+		}
+	}
+}
+
+// archiveTransport sends every request to the server at url, as if it were
+// the host requested.
+type archiveTransport struct {
+	url       *url.URL
+	requested []string
+}
+
+func (t *archiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requested = append(t.requested, req.URL.String())
+	req.URL.Scheme, req.URL.Host = t.url.Scheme, t.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestGitSourceExportArchive exports a revision from an archive of it, and
+// from a clone, and checks that the trees have the same digest, as the lock
+// records.
+func TestGitSourceExportArchive(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, _ := mkGitHistory(t, 2, 64)
+	defer os.RemoveAll(dir)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	// An executable, a symlink, and a nested dir, besides the data.
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "dir"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "dir", "run.sh"), []byte("#!/bin/sh\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("Skipping, as symlinks can't be made: %s", err)
+	}
+	git("add", "-A")
+	git("-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", "More")
+	rev := Revision(git("rev-parse", "HEAD"))
+
+	tgz, err := exec.Command("git", "-C", dir, "archive", "--format=tar.gz", "--prefix=bar-"+string(rev)+"/", string(rev)).Output()
+	if err != nil {
+		t.Fatalf("Failed to archive %s: %s", rev, err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/foo/bar/tar.gz/"+string(rev) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(tgz)
+	}))
+	defer srv.Close()
+	su, _ := url.Parse(srv.URL)
+	tr := &archiveTransport{url: su}
+	client := &http.Client{Transport: tr}
+
+	tmp, err := ioutil.TempDir("", "exportarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+
+	repo, err := newCtxRepo(ctx, nil, vcs.Git, "https://github.com/foo/bar", filepath.Join(tmp, "cache", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &gitSource{baseVCSSource{repo: repo}}
+	fromArchive := filepath.Join(tmp, "archive")
+	if err = src.exportArchive(ctx, client, rev, fromArchive); err != nil {
+		t.Fatalf("Unexpected error exporting from the archive: %s", err)
+	}
+	if want := "https://codeload.github.com/foo/bar/tar.gz/" + string(rev); len(tr.requested) != 1 || tr.requested[0] != want {
+		t.Errorf("Expected just %s to be requested, got %v", want, tr.requested)
+	}
+	if src.existsLocally(ctx) {
+		t.Error("Expected the source not to be fetched to the cache")
+	}
+
+	u := "file://" + filepath.ToSlash(dir)
+	repo, err = newCtxRepo(ctx, nil, vcs.Git, u, sourceCachePath(filepath.Join(tmp, "cache"), u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = &gitSource{baseVCSSource{repo: repo}}
+	if err = src.initLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fromClone := filepath.Join(tmp, "clone")
+	if err = src.exportRevisionTo(ctx, rev, fromClone); err != nil {
+		t.Fatalf("Unexpected error exporting from the clone: %s", err)
+	}
+
+	want, err := fs.DigestTree(fromClone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.DigestTree(fromArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Expected the tree exported from the archive to have the digest %s of the one exported from the clone, got %s", want, got)
+	}
+
+	// Another revision isn't served, and so isn't exported.
+	other := filepath.Join(tmp, "other")
+	if err = (&gitSource{baseVCSSource{repo: repo}}).exportArchive(ctx, client, "0123456789abcdef0123456789abcdef01234567", other); err == nil {
+		t.Error("Expected an error exporting a revision whose archive isn't found")
+	}
+}
+
+// tarEntry is an entry of a tarball made by mkArchive.
+type tarEntry struct {
+	name    string
+	typ     byte
+	content string // Or the target of a symlink
+	perm    int64
+}
+
+func mkArchive(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typ, Mode: e.perm}
+		if e.typ == tar.TypeSymlink {
+			hdr.Linkname = e.content
+		} else {
+			hdr.Size = int64(len(e.content))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte(e.content))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestUnpackArchive(t *testing.T) {
+	r := Revision("0123456789abcdef0123456789abcdef01234567")
+	top := "foo-bar-0123456789ab/"
+	cases := []struct {
+		name    string
+		entries []tarEntry
+		ok      bool
+	}{
+		{"ok", []tarEntry{
+			{name: top, typ: tar.TypeDir, perm: 0755},
+			{name: top + "a/b.go", typ: tar.TypeReg, content: "package a\n"},
+			{name: top + "run.sh", typ: tar.TypeReg, content: "#!/bin/sh\n", perm: 0755},
+			{name: top + "link", typ: tar.TypeSymlink, content: "a/b.go"},
+			{name: top + ".gitattributes", typ: tar.TypeReg, content: "*.go text eol=lf\n"},
+		}, true},
+		{"another revision", []tarEntry{
+			{name: "foo-bar-fedcba987654/a.go", typ: tar.TypeReg, content: "package a\n"},
+		}, false},
+		{"no revision", []tarEntry{
+			{name: "bar/a.go", typ: tar.TypeReg, content: "package a\n"},
+		}, false},
+		{"two dirs", []tarEntry{
+			{name: top + "a.go", typ: tar.TypeReg, content: "package a\n"},
+			{name: "foo-bar-0123456/a.go", typ: tar.TypeReg, content: "package a\n"},
+		}, false},
+		{"outside", []tarEntry{
+			{name: top + "../../a.go", typ: tar.TypeReg, content: "package a\n"},
+		}, false},
+		{"under a symlink", []tarEntry{
+			{name: top + "link", typ: tar.TypeSymlink, content: "/tmp"},
+			{name: top + "link/a.go", typ: tar.TypeReg, content: "package a\n"},
+		}, false},
+		{"export-ignore", []tarEntry{
+			{name: top + "a.go", typ: tar.TypeReg, content: "package a\n"},
+			{name: top + ".gitattributes", typ: tar.TypeReg, content: "/testdata export-ignore\n"},
+		}, false},
+		{"export-subst", []tarEntry{
+			{name: top + "sub/.gitattributes", typ: tar.TypeReg, content: "version.go export-subst\n"},
+		}, false},
+		{"empty", nil, false},
+	}
+
+	for _, c := range cases {
+		if c.ok && runtime.GOOS == "windows" {
+			// Neither symlinks nor executable bits can be relied on.
+			continue
+		}
+		to, err := ioutil.TempDir("", "unpackarchive")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(to)
+
+		err = unpackArchive(bytes.NewReader(mkArchive(t, c.entries)), r, to)
+		if c.ok != (err == nil) {
+			t.Errorf("%s: expected success %t, got error %v", c.name, c.ok, err)
+			continue
+		}
+		fis, _ := ioutil.ReadDir(to)
+		if !c.ok {
+			if len(fis) != 0 {
+				t.Errorf("%s: expected nothing to be left unpacked, got %d files", c.name, len(fis))
+			}
+			continue
+		}
+
+		if b, err := ioutil.ReadFile(filepath.Join(to, "link")); err != nil || string(b) != "package a\n" {
+			t.Errorf("%s: expected link to point to a/b.go, got %q, %v", c.name, b, err)
+		}
+		if fi, err := os.Stat(filepath.Join(to, "run.sh")); err != nil || fi.Mode()&0100 == 0 {
+			t.Errorf("%s: expected run.sh to be executable", c.name)
+		}
+		if fi, err := os.Stat(filepath.Join(to, "a", "b.go")); err != nil || fi.Mode()&0111 != 0 {
+			t.Errorf("%s: expected a/b.go not to be executable", c.name)
+		}
+	}
+}
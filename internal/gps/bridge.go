@@ -25,6 +25,7 @@ type sourceBridge interface {
 	GetManifestAndLock(ProjectIdentifier, Version, ProjectAnalyzer) (Manifest, Lock, error)
 	ExportProject(ProjectIdentifier, Version, string) error
 	DeduceProjectRoot(ip string) (ProjectRoot, error)
+	SourceOrigin(ProjectIdentifier) (ProjectOrigin, error)
 
 	//sourceExists(ProjectIdentifier) (bool, error)
 	//syncSourceFor(ProjectIdentifier) error
@@ -109,7 +110,9 @@ func (b *bridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 	}
 
 	vl := hidePair(pvl)
-	if b.down {
+	if b.s.rd.allowsPrereleases(id.ProjectRoot) {
+		sortWithPrereleases(vl, b.down)
+	} else if b.down {
 		SortForDowngrade(vl)
 	} else {
 		SortForUpgrade(vl)
@@ -158,7 +161,7 @@ func (b *bridge) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageT
 	b.s.mtr.push("b-list-pkgs")
 	pt, err := b.sm.ListPackages(id, v)
 	b.s.mtr.pop()
-	return pt, err
+	return pt.Constrain(b.s.rd.build), err
 }
 
 func (b *bridge) ExportProject(id ProjectIdentifier, v Version, path string) error {
@@ -213,6 +216,12 @@ func (b *bridge) breakLock() {
 	}
 }
 
+func (b *bridge) SourceOrigin(id ProjectIdentifier) (ProjectOrigin, error) {
+	// we don't track metrics here b/c this is only called once the solve is
+	// done, when the metrics have been finished
+	return b.sm.SourceOrigin(id)
+}
+
 func (b *bridge) SyncSourceFor(id ProjectIdentifier) error {
 	// we don't track metrics here b/c this is often called in its own goroutine
 	// by the solver, and the metrics design is for wall time on a single thread
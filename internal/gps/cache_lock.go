@@ -0,0 +1,215 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cacheLocks are the locks on the sources in a cache dir, which every
+// SourceMgr using the cache dir, in this process or any other, takes before it
+// touches their copies there. A lock is either shared, to read a copy, or
+// exclusive, to change it; any number of shared locks may be held on a source
+// at once, or else a single exclusive one.
+//
+// A lock is held by having a file in the locks dir of the cache dir, named for
+// what it locks, whether it's shared, the pid of the process holding it, and a
+// sequence number, e.g. "https---github.com-golang-dep.shared.1234.7". The
+// lock files of a name are only looked at or created by a process holding its
+// guard, a file created exclusively beside them, for as long as that takes.
+// Locks and guards held by processes which have died without releasing them
+// are broken, with a warning.
+type cacheLocks struct {
+	dir  string      // Where the lock files are kept
+	warn *log.Logger // Told of locks being waited for or broken
+}
+
+func newCacheLocks(cachedir string, warn *log.Logger) *cacheLocks {
+	return &cacheLocks{dir: filepath.Join(cachedir, "locks"), warn: warn}
+}
+
+// lockSeq numbers the locks taken by this process, so that several may be
+// held on a name at once.
+var lockSeq uint64
+
+const (
+	// lockPoll is how long to wait at first before trying again to take a
+	// lock which is held. The wait doubles, up to lockPollMax.
+	lockPoll    = 10 * time.Millisecond
+	lockPollMax = time.Second
+	// lockWarnAfter is how long a lock is waited for before saying so, and
+	// how often it's said again while waiting.
+	lockWarnAfter = 15 * time.Second
+	// guardStaleAfter is how old a guard without a pid in it must be for
+	// its process to be taken to have died before writing it.
+	guardStaleAfter = 10 * time.Second
+)
+
+// lock takes the lock on name, shared unless exclusive, waiting for as long as
+// others hold it in a way that excludes that, or until ctx is done. The
+// returned func releases it.
+func (cl *cacheLocks) lock(ctx context.Context, name string, exclusive bool) (func(), error) {
+	mode := "shared"
+	if exclusive {
+		mode = "exclusive"
+	}
+	path := filepath.Join(cl.dir, fmt.Sprintf("%s.%s.%d.%d", name, mode, os.Getpid(), atomic.AddUint64(&lockSeq, 1)))
+
+	poll := lockPoll
+	start, warned := time.Now(), time.Now()
+	for {
+		holder, err := cl.tryLock(ctx, name, path, exclusive)
+		if err != nil {
+			return nil, CouldNotCreateLockError{
+				Path: path,
+				Err:  errors.Wrapf(err, "unable to lock %s", name),
+			}
+		}
+		if holder == 0 {
+			return func() { os.Remove(path) }, nil
+		}
+
+		if now := time.Now(); now.Sub(warned) > lockWarnAfter {
+			waited := now.Sub(start) / time.Second * time.Second
+			cl.warn.Printf("waiting %s for the lock on %s, held by process %d", waited, name, holder)
+			warned = now
+		}
+		if err = sleepCtx(ctx, poll); err != nil {
+			return nil, err
+		}
+		if poll *= 2; poll > lockPollMax {
+			poll = lockPollMax
+		}
+	}
+}
+
+// with calls f holding the lock on name, shared unless exclusive. Nothing is
+// locked for a nil cacheLocks, whose cache dir isn't shared, nor for a name of
+// "", that of a source which isn't kept in the cache dir, like a local one.
+func (cl *cacheLocks) with(ctx context.Context, name string, exclusive bool, f func() error) error {
+	if cl == nil || name == "" {
+		return f()
+	}
+
+	unlock, err := cl.lock(ctx, name, exclusive)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return f()
+}
+
+// tryLock takes the lock on name by creating the lock file at path, unless
+// it's held in a way that excludes that, in which case it returns the pid of a
+// process holding it.
+func (cl *cacheLocks) tryLock(ctx context.Context, name, path string, exclusive bool) (int, error) {
+	release, err := cl.guard(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	fis, err := ioutil.ReadDir(cl.dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, fi := range fis {
+		mode, pid, ok := parseLockFile(name, fi.Name())
+		if !ok {
+			continue
+		}
+		if !processRunning(pid) {
+			cl.warn.Printf("breaking the lock on %s held by process %d, which is no longer running", name, pid)
+			os.Remove(filepath.Join(cl.dir, fi.Name()))
+			continue
+		}
+		if exclusive || mode == "exclusive" {
+			return pid, nil
+		}
+	}
+
+	return 0, ioutil.WriteFile(path, nil, 0666)
+}
+
+// guard takes the guard of name, which is held only for as long as it takes to
+// look at and create its lock files. The returned func releases it.
+func (cl *cacheLocks) guard(ctx context.Context, name string) (func(), error) {
+	path := filepath.Join(cl.dir, name+".guard")
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			_, err = fmt.Fprint(f, os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		cl.breakStaleGuard(name, path)
+		if err = sleepCtx(ctx, lockPoll); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// breakStaleGuard removes the guard of name at path if the process which
+// created it is no longer running.
+func (cl *cacheLocks) breakStaleGuard(name, path string) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	pid, err := strconv.Atoi(string(b))
+	if err != nil {
+		// The process may be yet to write its pid.
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > guardStaleAfter {
+			cl.warn.Printf("breaking the guard of the lock on %s, which has no process", name)
+			os.Remove(path)
+		}
+		return
+	}
+	if !processRunning(pid) {
+		cl.warn.Printf("breaking the guard of the lock on %s held by process %d, which is no longer running", name, pid)
+		os.Remove(path)
+	}
+}
+
+// parseLockFile returns whether the lock file named file is shared or
+// exclusive, and the pid of the process holding it, if it's a lock on name.
+func parseLockFile(name, file string) (mode string, pid int, ok bool) {
+	if !strings.HasPrefix(file, name+".") {
+		return "", 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(file, name+"."), ".")
+	if len(parts) != 3 || (parts[0] != "shared" && parts[0] != "exclusive") {
+		return "", 0, false
+	}
+	pid, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, false
+	}
+	if _, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+		return "", 0, false
+	}
+	return parts[0], pid, true
+}
@@ -0,0 +1,232 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mkCacheLocks(t *testing.T) (*cacheLocks, *bytes.Buffer, func()) {
+	cachedir, err := ioutil.TempDir("", "cachelocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warned bytes.Buffer
+	cl := newCacheLocks(cachedir, log.New(&warned, "", 0))
+	if err = os.MkdirAll(cl.dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	return cl, &warned, func() { os.RemoveAll(cachedir) }
+}
+
+// deadPid returns the pid of a process which has exited.
+func deadPid(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run a process: %s", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestCacheLocks(t *testing.T) {
+	cl, _, clean := mkCacheLocks(t)
+	defer clean()
+	ctx := context.Background()
+
+	// Shared locks are held together.
+	unlock1, err := cl.lock(ctx, "src", false)
+	if err != nil {
+		t.Fatalf("Unexpected error taking a shared lock: %s", err)
+	}
+	unlock2, err := cl.lock(ctx, "src", false)
+	if err != nil {
+		t.Fatalf("Unexpected error taking a second shared lock: %s", err)
+	}
+
+	// A lock on another name isn't affected by them.
+	tctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	unlock, err := cl.lock(tctx, "src.git", true)
+	cancel()
+	if err != nil {
+		t.Fatalf("Unexpected error taking an exclusive lock on another name: %s", err)
+	}
+	unlock()
+
+	// An exclusive lock waits for both to be released.
+	locked := make(chan func())
+	go func() {
+		unlock, err := cl.lock(ctx, "src", true)
+		if err != nil {
+			t.Errorf("Unexpected error taking an exclusive lock: %s", err)
+		}
+		locked <- unlock
+	}()
+	unlock1()
+	select {
+	case <-locked:
+		t.Fatal("Expected the exclusive lock to wait for the second shared lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock2()
+	unlockx := <-locked
+
+	// As does a shared one for it.
+	tctx, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = cl.lock(tctx, "src", false)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected the shared lock to wait for the exclusive one until the deadline, got %v", err)
+	}
+	unlockx()
+
+	fis, err := ioutil.ReadDir(cl.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 0 {
+		t.Errorf("Expected no lock files once the locks were released, got %d", len(fis))
+	}
+}
+
+func TestCacheLocksBreakStale(t *testing.T) {
+	cl, warned, clean := mkCacheLocks(t)
+	defer clean()
+
+	// A process which held the lock on src, and the guard of its locks, has
+	// died.
+	pid := deadPid(t)
+	files := map[string]string{
+		fmt.Sprintf("src.exclusive.%d.1", pid): "",
+		"src.guard":                            strconv.Itoa(pid),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(cl.dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	unlock, err := cl.lock(ctx, "src", true)
+	if err != nil {
+		t.Fatalf("Expected the stale lock to be broken, got %s", err)
+	}
+	unlock()
+
+	for _, want := range []string{
+		fmt.Sprintf("breaking the guard of the lock on src held by process %d", pid),
+		fmt.Sprintf("breaking the lock on src held by process %d", pid),
+	} {
+		if !strings.Contains(warned.String(), want) {
+			t.Errorf("Expected a warning containing %q, got:\n%s", want, warned.String())
+		}
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(cl.dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", name)
+		}
+	}
+}
+
+func TestParseLockFile(t *testing.T) {
+	cases := []struct {
+		file string
+		mode string
+		pid  int
+		ok   bool
+	}{
+		{"src.shared.12.3", "shared", 12, true},
+		{"src.exclusive.12.3", "exclusive", 12, true},
+		{"src.guard", "", 0, false},
+		{"src.git.shared.12.3", "", 0, false},
+		{"src.other.12.3", "", 0, false},
+		{"src.shared.x.3", "", 0, false},
+		{"srcs.shared.12.3", "", 0, false},
+	}
+	for _, c := range cases {
+		mode, pid, ok := parseLockFile("src", c.file)
+		if mode != c.mode || pid != c.pid || ok != c.ok {
+			t.Errorf("Expected parseLockFile(%q) to be %q, %d, %t, got %q, %d, %t", c.file, c.mode, c.pid, c.ok, mode, pid, ok)
+		}
+	}
+}
+
+// TestConcurrentSourceManagers has several SourceMgrs use the same source, in
+// the same cache dir, at once, as many dep processes might.
+func TestConcurrentSourceManagers(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, revs := mkGitHistory(t, 5, 1024)
+	defer os.RemoveAll(dir)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "file://" + filepath.ToSlash(dir)}
+
+	cachedir, err := ioutil.TempDir("", "concurrentsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachedir)
+	exportdir, err := ioutil.TempDir("", "concurrentexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(exportdir)
+
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sm, err := NewSourceManager(cachedir)
+			if err != nil {
+				t.Errorf("Unexpected error creating SourceMgr %d: %s", i, err)
+				return
+			}
+			defer sm.Release()
+
+			// Each checks out a revision of its own to list the packages in
+			// it, and exports the tagged one, and another, to a dir of its
+			// own.
+			for j, r := range []Revision{revs[i%len(revs)], revs[len(revs)-1]} {
+				if _, err := sm.ListPackages(id, r); err != nil {
+					t.Errorf("SourceMgr %d failed to list the packages at %s: %s", i, r, err)
+				}
+				to := filepath.Join(exportdir, fmt.Sprintf("%d-%d", i, j))
+				if err := sm.ExportProject(id, r, to); err != nil {
+					t.Errorf("SourceMgr %d failed to export %s: %s", i, r, err)
+					continue
+				}
+				b, err := ioutil.ReadFile(filepath.Join(to, "data"))
+				if want := fmt.Sprintf("commit %d\n", i%len(revs)); j == 0 && (err != nil || !bytes.HasPrefix(b, []byte(want))) {
+					t.Errorf("SourceMgr %d exported the wrong data for %s", i, r)
+				}
+			}
+			if _, err := sm.RevisionPresentIn(id, revs[0]); err != nil {
+				t.Errorf("SourceMgr %d failed to find %s: %s", i, revs[0], err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	fis, err := ioutil.ReadDir(filepath.Join(cachedir, "locks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		t.Errorf("Expected no lock files once the SourceMgrs were released, got %s", fi.Name())
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CachedSource is a source kept in the cache dir of a SourceMgr.
+type CachedSource struct {
+	// Name is the name of the source's dir in the cache: its URL, sanitized.
+	Name string
+	// Path is the path of the source's dir.
+	Path string
+	// Size is the size in bytes of the files in the dir. Symlinks aren't
+	// followed, so files they point to outside of it aren't counted.
+	Size int64
+	// LastAccess is when a SourceMgr last used the source.
+	LastAccess time.Time
+}
+
+// Matches reports whether source, the URL of a source, or an import path,
+// refers to the cached source.
+func (cs CachedSource) Matches(source string) bool {
+	name := strings.TrimSuffix(cs.Name, ".git")
+	s := strings.TrimSuffix(sanitizer.Replace(source), ".git")
+	if name == s {
+		return true
+	}
+	// An import path matches the URLs it's fetched from, whatever their
+	// scheme or user.
+	return strings.HasSuffix(name, "---"+s) || strings.HasSuffix(name, "@"+s)
+}
+
+// markAccessed records that the cached copy of the source was used now, as
+// the modification time of its dir, for CachedSources to report. Sources which
+// aren't kept in the cache, like local ones, are left alone.
+func (sg *sourceGateway) markAccessed() {
+	if cs, ok := sg.src.(interface {
+		cachePath() string
+	}); ok {
+		now := time.Now()
+		os.Chtimes(cs.cachePath(), now, now)
+	}
+}
+
+// CachedSources lists the sources in the cache dir, by name.
+func (sm *SourceMgr) CachedSources() ([]CachedSource, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return nil, smIsReleased{}
+	}
+
+	dir := filepath.Join(sm.cachedir, "sources")
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the sources in %s", dir)
+	}
+
+	var sources []CachedSource
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		cs := CachedSource{
+			Name:       fi.Name(),
+			Path:       filepath.Join(dir, fi.Name()),
+			LastAccess: fi.ModTime(),
+		}
+		// Walk uses Lstat, so symlinks are counted as themselves, rather than
+		// as what they point to.
+		err := filepath.Walk(cs.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				cs.Size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to work out the size of %s", cs.Path)
+		}
+		sources = append(sources, cs)
+	}
+	return sources, nil
+}
+
+// RemoveCachedSource removes the source from the cache dir. It's safe from
+// other SourceMgrs, in this process or others, as it's done under the
+// exclusive lock on the source, but the source must not be in use by the
+// SourceMgr itself.
+func (sm *SourceMgr) RemoveCachedSource(cs CachedSource) error {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return smIsReleased{}
+	}
+
+	path := filepath.Join(sm.cachedir, "sources", cs.Name)
+	if cs.Name == "" || filepath.Base(path) != cs.Name {
+		return errors.Errorf("%q is not a source in the cache", cs.Name)
+	}
+	return sm.suprvsr.locks.with(context.TODO(), cs.Name, true, func() error {
+		// The version list of the source goes too, as it's the list of what
+		// was in its dir.
+		if err := removeAll(path); err != nil {
+			return err
+		}
+		os.Remove(filepath.Join(sm.cachedir, "versions", cs.Name+".json"))
+		return nil
+	})
+}
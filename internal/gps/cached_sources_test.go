@@ -0,0 +1,112 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCachedSourceMatches(t *testing.T) {
+	cases := []struct {
+		name, source string
+		want         bool
+	}{
+		{"https---github.com-sdboyer-gps", "github.com/sdboyer/gps", true},
+		{"https---github.com-sdboyer-gps", "https://github.com/sdboyer/gps", true},
+		{"https---github.com-sdboyer-gps.git", "github.com/sdboyer/gps", true},
+		{"ssh---git@github.com-sdboyer-gps", "github.com/sdboyer/gps", true},
+		{"git@github.com-sdboyer-gps", "github.com/sdboyer/gps", true},
+		{"https---github.com-sdboyer-gps", "github.com/sdboyer/gpsx", false},
+		{"https---github.com-sdboyer-gpsx", "github.com/sdboyer/gps", false},
+		{"https---github.com-other-gps", "github.com/sdboyer/gps", false},
+	}
+
+	for _, c := range cases {
+		if got := (CachedSource{Name: c.name}).Matches(c.source); got != c.want {
+			t.Errorf("CachedSource{%q}.Matches(%q) = %v, want %v", c.name, c.source, got, c.want)
+		}
+	}
+}
+
+func TestCachedSources(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	sources := filepath.Join(sm.cachedir, "sources")
+	foo := filepath.Join(sources, "https---github.com-foo-foo")
+	bar := filepath.Join(sources, "https---github.com-foo-bar")
+	for _, f := range []struct {
+		path string
+		size int
+	}{
+		{filepath.Join(foo, "a"), 10},
+		{filepath.Join(foo, "sub", "b"), 5},
+		{filepath.Join(bar, "c"), 7},
+		{filepath.Join(sm.cachedir, "outside"), 1000},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f.path, make([]byte, f.size), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantFoo := int64(15)
+	if runtime.GOOS != "windows" {
+		// The file the symlink points to isn't counted, only the link.
+		link := filepath.Join(foo, "link")
+		if err := os.Symlink(filepath.Join(sm.cachedir, "outside"), link); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Lstat(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantFoo += fi.Size()
+	}
+
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(bar, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := sm.CachedSources()
+	if err != nil {
+		t.Fatalf("Unexpected error listing the cached sources: %s", err)
+	}
+	if len(cached) != 2 {
+		t.Fatalf("Expected 2 cached sources, got %v", cached)
+	}
+	if cached[0].Name != "https---github.com-foo-bar" || cached[0].Size != 7 || !cached[0].LastAccess.Equal(old) {
+		t.Errorf("Unexpected cached source for bar: %+v", cached[0])
+	}
+	if cached[1].Name != "https---github.com-foo-foo" || cached[1].Size != wantFoo {
+		t.Errorf("Unexpected cached source for foo, want a size of %d: %+v", wantFoo, cached[1])
+	}
+
+	vc := newVersionListCache(sm.cachedir, time.Minute, false)
+	vc.put(cached[0].Name, []PairedVersion{NewVersion("v1.0.0").Pair("r1")})
+	if err := sm.RemoveCachedSource(cached[0]); err != nil {
+		t.Fatalf("Unexpected error removing the cached source: %s", err)
+	}
+	if _, err := os.Stat(bar); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", bar, err)
+	}
+	if _, has := vc.get(cached[0].Name); has {
+		t.Error("Expected the version list of the removed source to be removed too")
+	}
+	if err := sm.RemoveCachedSource(CachedSource{Name: "../outside"}); err == nil {
+		t.Error("Expected an error removing something outside of the sources")
+	}
+	if _, err := os.Stat(filepath.Join(sm.cachedir, "outside")); err != nil {
+		t.Errorf("Expected the file outside of the sources to be kept: %s", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"sync"
 	"sync/atomic"
@@ -58,6 +59,14 @@ func (c *monitoredCmd) run(ctx context.Context) error {
 		return ctx.Err()
 	}
 
+	if ctx.Value(noPromptKey{}) != nil {
+		c.cmd.Env = noPromptEnv(c.cmd.Env)
+		// svn has a flag for it, rather than a variable.
+		if len(c.cmd.Args) > 0 && c.cmd.Args[0] == "svn" {
+			c.cmd.Args = append([]string{"svn", "--non-interactive"}, c.cmd.Args[1:]...)
+		}
+	}
+
 	err := c.cmd.Start()
 	if err != nil {
 		return err
@@ -186,6 +195,26 @@ func (e killCmdError) Error() string {
 	return fmt.Sprintf("error killing command: %s", e.err)
 }
 
+// noPromptKey is the key of a context value which makes the commands run with
+// the context fail rather than prompt for credentials; see DisablePrompts.
+type noPromptKey struct{}
+
+// noPromptEnv returns env, or the environment of the process if it's nil, set
+// up so that git doesn't prompt for credentials on the terminal, nor ssh for
+// passwords or passphrases, unless the user has told git how to run ssh.
+// Credential helpers and askpass programs still work, as they don't wait for
+// anyone.
+func noPromptEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	in := []string{"GIT_TERMINAL_PROMPT=0"}
+	if os.Getenv("GIT_SSH") == "" && os.Getenv("GIT_SSH_COMMAND") == "" {
+		in = append(in, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	return mergeEnvLists(in, env)
+}
+
 func runFromCwd(ctx context.Context, timeout time.Duration, cmd string, args ...string) ([]byte, error) {
 	c := newMonitoredCmd(exec.Command(cmd, args...), timeout)
 	return c.combinedOutput(ctx)
@@ -196,6 +225,17 @@ func runFromRepoDir(ctx context.Context, repo vcs.Repo, timeout time.Duration, c
 	return c.combinedOutput(ctx)
 }
 
+// runFromRepoDirWithEnv is like runFromRepoDir, with the environment variable
+// env, of the form "key=value", set for the command.
+func runFromRepoDirWithEnv(ctx context.Context, repo vcs.Repo, timeout time.Duration, env string, cmd string, args ...string) ([]byte, error) {
+	ec := repo.CmdFromDir(cmd, args...)
+	if ec.Env == nil {
+		ec.Env = os.Environ()
+	}
+	ec.Env = mergeEnvLists([]string{env}, ec.Env)
+	return newMonitoredCmd(ec, timeout).combinedOutput(ctx)
+}
+
 const (
 	// expensiveCmdTimeout is meant to be used in a command that is expensive
 	// in terms of computation and we know it will take long or one that uses
@@ -673,6 +673,114 @@ func TestSemverConstraintOps(t *testing.T) {
 	}
 }
 
+func TestSemverConstraintUnionOps(t *testing.T) {
+	c, err := NewSemverConstraintIC(">=1.2.0, <2.0.0 || >=3.1.0")
+	if err != nil {
+		t.Fatalf("Failed to create constraint: %s", err)
+	}
+
+	for v, want := range map[string]bool{
+		"1.1.0": false,
+		"1.5.0": true,
+		"2.5.0": false,
+		"3.0.0": false,
+		"3.2.0": true,
+	} {
+		sv := NewVersion(v).(semVersion)
+		pv := sv.Pair("fozzie bear")
+		if got := c.Matches(sv); got != want {
+			t.Errorf("Union constraint matching %s should be %v", v, want)
+		}
+		if got := c.MatchesAny(sv) && sv.MatchesAny(c); got != want {
+			t.Errorf("Union constraint allowing any of %s should be %v", v, want)
+		}
+		if want && (c.Intersect(sv) != sv || c.Intersect(pv) != pv) {
+			t.Errorf("Union constraint should return input when intersected with %s, in one of its ranges", v)
+		}
+		if !want && (c.Intersect(sv) != none || c.Intersect(pv) != none || sv.Intersect(c) != none) {
+			t.Errorf("Union constraint should return none when intersected with %s, outside of its ranges", v)
+		}
+	}
+
+	// Intersecting with a range which only overlaps one of the union's
+	// leaves just that part of it.
+	c2, _ := NewSemverConstraint(">=2.0.0")
+	if got, want := c.Intersect(c2).String(), ">=3.1.0"; got != want {
+		t.Errorf("Expected union intersected with %s to be %s, got %s", c2, want, got)
+	}
+	c3, _ := NewSemverConstraint("~2.5.0")
+	if c.MatchesAny(c3) {
+		t.Errorf("Union constraint should not allow any of %s, which falls in its gap", c3)
+	}
+
+	// Either way it's written, the union parses back to what it was.
+	if got, want := c.String(), "^1.2.0 || >=3.1.0"; got != want {
+		t.Errorf("Expected string %s, got %s", want, got)
+	}
+	for _, s := range []string{c.String(), c.ImpliedCaretString()} {
+		c4, err := NewSemverConstraintIC(s)
+		if err != nil {
+			t.Fatalf("Failed to create constraint from %q: %s", s, err)
+		}
+		if !c4.identical(c) {
+			t.Errorf("Expected %q to parse back as %s, got %s", s, c, c4)
+		}
+	}
+}
+
+func TestSemverConstraintWithPrereleases(t *testing.T) {
+	c, _ := NewSemverConstraintIC(">=2.0.0-rc1, !=2.2.0")
+	pc := WithPrereleases(c)
+	if AllowsPrereleases(c) || !AllowsPrereleases(pc) {
+		t.Fatal("Expected only the constraint made with WithPrereleases to allow prereleases")
+	}
+	if pc.String() != c.String() {
+		t.Errorf("Allowing prereleases should not change the constraint's string, got %s", pc)
+	}
+	if pc.typedString() == c.typedString() {
+		t.Error("Allowing prereleases should change the constraint's typed string, so input hashes change with it")
+	}
+
+	for v, want := range map[string][2]bool{
+		"1.9.0":        {false, false},
+		"2.0.0-beta.1": {false, false},
+		"2.0.0-rc1":    {true, true},
+		"2.0.0-rc2":    {true, true},
+		"2.0.0":        {true, true},
+		"2.1.0-rc1":    {false, true},
+		"2.2.0-rc1":    {false, false},
+		"3.0.0-alpha":  {false, true},
+	} {
+		sv := NewVersion(v)
+		if got := c.Matches(sv); got != want[0] {
+			t.Errorf("Expected %s matching %s to be %v", c, v, want[0])
+		}
+		if got := pc.Matches(sv); got != want[1] {
+			t.Errorf("Expected %s, allowing prereleases, matching %s to be %v", pc, v, want[1])
+		}
+		if got := pc.Intersect(sv.(semVersion).Pair("fozzie bear")) != none; got != want[1] {
+			t.Errorf("Expected %s, allowing prereleases, intersecting with %s to be %v", pc, v, want[1])
+		}
+	}
+
+	// A release outside the range keeps its prereleases out of it, too.
+	caret, _ := NewSemverConstraintIC("^2.0.0")
+	if WithPrereleases(caret).Matches(NewVersion("3.0.0-rc1")) {
+		t.Errorf("Expected %s, allowing prereleases, not to match 3.0.0-rc1", caret)
+	}
+
+	// Prereleases stay allowed through intersections.
+	if rc := caret.Intersect(pc); !AllowsPrereleases(rc) || !rc.Matches(NewVersion("2.1.0-rc1")) {
+		t.Errorf("Expected the intersection of %s with %s to allow prereleases, got %s", caret, pc, rc)
+	}
+	if c.identical(pc) {
+		t.Error("Expected constraints which differ only in allowing prereleases not to be identical")
+	}
+	if got := WithPrereleases(NewBranch("master")); got != NewBranch("master") {
+		t.Errorf("Expected a branch to be returned as is, got %s", got)
+	}
+}
+
 func TestSemverConstraint_ImpliedCaret(t *testing.T) {
 	c, _ := NewSemverConstraintIC("1.0.0")
 
@@ -7,6 +7,7 @@ package gps
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/Masterminds/semver"
 )
@@ -102,6 +103,9 @@ func NewSemverConstraintIC(body string) (Constraint, error) {
 
 type semverConstraint struct {
 	c semver.Constraint
+	// pre indicates the constraint also matches the prereleases within its
+	// ranges. See WithPrereleases.
+	pre bool
 }
 
 func (c semverConstraint) String() string {
@@ -119,6 +123,9 @@ func (c semverConstraint) ImpliedCaretString() string {
 }
 
 func (c semverConstraint) typedString() string {
+	if c.pre {
+		return fmt.Sprintf("svc-pre-%s", c.c.String())
+	}
 	return fmt.Sprintf("svc-%s", c.c.String())
 }
 
@@ -131,16 +138,42 @@ func (c semverConstraint) Matches(v Version) bool {
 			}
 		}
 	case semVersion:
-		return c.c.Matches(tv.sv) == nil
+		return c.matchesSemver(tv.sv)
 	case versionPair:
 		if tv2, ok := tv.v.(semVersion); ok {
-			return c.c.Matches(tv2.sv) == nil
+			return c.matchesSemver(tv2.sv)
 		}
 	}
 
 	return false
 }
 
+func (c semverConstraint) matchesSemver(sv semver.Version) bool {
+	if c.c.Matches(sv) == nil {
+		return true
+	}
+	if !c.pre || sv.Prerelease() == "" {
+		return false
+	}
+
+	// A prerelease is only wanted if its release would be, so ^2.0.0 doesn't
+	// reach 3.0.0-rc1, and excluding a release excludes its prereleases.
+	rel, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", sv.Major(), sv.Minor(), sv.Patch()))
+	if err != nil || c.c.Matches(rel) != nil {
+		return false
+	}
+
+	// semver only matches a prerelease which has the same numbers as the
+	// minimum of its range. Raising the minimum to the prerelease itself
+	// leaves the rest of the range to decide; if the minimum was already
+	// above it, it's still above it.
+	floor, err := semver.NewConstraint(">=" + sv.String())
+	if err != nil {
+		return false
+	}
+	return c.c.Intersect(floor).Matches(sv) == nil
+}
+
 func (c semverConstraint) MatchesAny(c2 Constraint) bool {
 	return c.Intersect(c2) != none
 }
@@ -158,20 +191,21 @@ func (c semverConstraint) Intersect(c2 Constraint) Constraint {
 	case semverConstraint:
 		rc := c.c.Intersect(tc.c)
 		if !semver.IsNone(rc) {
-			return semverConstraint{c: rc}
+			// Prereleases are opted into per project, so if either side
+			// allows them, so does the result.
+			return semverConstraint{c: rc, pre: c.pre || tc.pre}
 		}
 	case semVersion:
-		rc := c.c.Intersect(tc.sv)
-		if !semver.IsNone(rc) {
-			// If single version intersected with constraint, we know the result
-			// must be the single version, so just return it back out
+		// A single version intersected with the constraint can only be the
+		// version, if it matches. It's matched rather than intersected, as
+		// semver intersects a union of ranges with any version as the version.
+		if c.matchesSemver(tc.sv) {
 			return c2
 		}
 	case versionPair:
 		if tc2, ok := tc.v.(semVersion); ok {
-			rc := c.c.Intersect(tc2.sv)
-			if !semver.IsNone(rc) {
-				// same reasoning as previous case
+			// same reasoning as previous case
+			if c.matchesSemver(tc2.sv) {
 				return c2
 			}
 		}
@@ -185,7 +219,53 @@ func (c semverConstraint) identical(c2 Constraint) bool {
 	if !ok {
 		return false
 	}
-	return c.c.String() == sc2.c.String()
+	return c.c.String() == sc2.c.String() && c.pre == sc2.pre
+}
+
+// excludes indicates if v is ruled out by one of the constraint's != clauses,
+// rather than by falling outside its ranges.
+func (c semverConstraint) excludes(v Version) bool {
+	if pv, ok := v.(versionPair); ok {
+		v = pv.v
+	}
+	sv, ok := v.(semVersion)
+	if !ok {
+		return false
+	}
+
+	clauses := strings.FieldsFunc(c.c.String(), func(r rune) bool { return r == ',' || r == '|' })
+	for _, clause := range clauses {
+		clause = strings.TrimSpace(clause)
+		if !strings.HasPrefix(clause, "!=") {
+			continue
+		}
+		if ev, err := semver.NewVersion(strings.TrimPrefix(clause, "!=")); err == nil && ev.Equal(sv.sv) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrereleases returns a copy of the provided constraint which also matches
+// the prerelease versions within its ranges, by semver precedence, as long as
+// it matches their release. Otherwise, a semver range only matches a prerelease
+// with the same version numbers as its minimum, so >=2.0.0-rc1 matches
+// 2.0.0-rc2, but not 2.1.0-rc1.
+//
+// Constraints other than semver ranges are returned as they are.
+func WithPrereleases(c Constraint) Constraint {
+	if sc, ok := c.(semverConstraint); ok {
+		sc.pre = true
+		return sc
+	}
+	return c
+}
+
+// AllowsPrereleases indicates if the provided constraint was made to match
+// prereleases with WithPrereleases.
+func AllowsPrereleases(c Constraint) bool {
+	sc, ok := c.(semverConstraint)
+	return ok && sc.pre
 }
 
 // IsAny indicates if the provided constraint is the wildcard "Any" constraint.
@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
@@ -15,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	radix "github.com/armon/go-radix"
 	"github.com/pkg/errors"
@@ -259,8 +261,7 @@ func (m gopkginDeducer) parseAndValidatePath(p string) ([]string, error) {
 }
 
 func (m gopkginDeducer) deduceSource(p string, u *url.URL) (maybeSource, error) {
-	// Reuse root detection logic for initial validation
-	v, err := m.parseAndValidatePath(p)
+	gp, err := m.parse(p)
 	if err != nil {
 		return nil, err
 	}
@@ -272,42 +273,113 @@ func (m gopkginDeducer) deduceSource(p string, u *url.URL) (maybeSource, error)
 
 	// gopkg.in is always backed by github
 	u.Host = "github.com"
+	u.Path = strings.TrimPrefix(gp.repo, u.Host)
+
+	mb := make(maybeSources, len(gitSchemes))
+	for k, scheme := range gitSchemes {
+		u2 := *u
+		if scheme == "ssh" {
+			u2.User = url.User("git")
+		}
+		u2.Scheme = scheme
+		mb[k] = maybeGopkginSource{
+			opath:    gp.root,
+			url:      &u2,
+			major:    gp.major,
+			unstable: gp.unstable,
+		}
+	}
+
+	return mb, nil
+}
+
+// gopkginPath is an import path on gopkg.in, taken apart.
+type gopkginPath struct {
+	root     string // The root of the project, e.g. gopkg.in/yaml.v2
+	repo     string // The GitHub repository it's served from, e.g. github.com/go-yaml/yaml
+	major    uint64 // The major version it names
+	unstable bool   // Whether it names the -unstable branches of the major version
+}
+
+func (m gopkginDeducer) parse(p string) (gopkginPath, error) {
+	// Reuse root detection logic for initial validation
+	v, err := m.parseAndValidatePath(p)
+	if err != nil {
+		return gopkginPath{}, err
+	}
+
+	gp := gopkginPath{root: v[1]}
+	// The package form, gopkg.in/pkg.v1, is served from github.com/go-pkg/pkg,
+	// and the user form, gopkg.in/user/pkg.v1, from github.com/user/pkg.
 	if v[2] == "" {
 		elem := v[3][1:]
-		u.Path = path.Join("/go-"+elem, elem)
+		gp.repo = path.Join("github.com", "go-"+elem, elem)
 	} else {
-		u.Path = path.Join(v[2], v[3])
+		gp.repo = path.Join("github.com", v[2], v[3])
 	}
 
-	unstable := false
 	majorStr := v[4]
-
 	if strings.HasSuffix(majorStr, gopkgUnstableSuffix) {
-		unstable = true
+		gp.unstable = true
 		majorStr = strings.TrimSuffix(majorStr, gopkgUnstableSuffix)
 	}
-	major, err := strconv.ParseUint(majorStr[1:], 10, 64)
+	gp.major, err = strconv.ParseUint(majorStr[1:], 10, 64)
 	if err != nil {
 		// this should only be reachable if there's an error in the regex
-		return nil, fmt.Errorf("could not parse %q as a gopkg.in major version", majorStr[1:])
+		return gopkginPath{}, fmt.Errorf("could not parse %q as a gopkg.in major version", majorStr[1:])
 	}
 
-	mb := make(maybeSources, len(gitSchemes))
-	for k, scheme := range gitSchemes {
-		u2 := *u
-		if scheme == "ssh" {
-			u2.User = url.User("git")
-		}
-		u2.Scheme = scheme
-		mb[k] = maybeGopkginSource{
-			opath:    v[1],
-			url:      &u2,
-			major:    major,
-			unstable: unstable,
-		}
+	return gp, nil
+}
+
+// GopkginRepo returns the GitHub repository gopkg.in serves the project at
+// root from, e.g. github.com/go-yaml/yaml for gopkg.in/yaml.v2, if root is on
+// gopkg.in.
+func GopkginRepo(root ProjectRoot) (string, bool) {
+	gp, err := gopkginDeducer{regexp: gpinNewRegex}.parse(string(root))
+	if err != nil {
+		return "", false
 	}
+	return gp.repo, true
+}
 
-	return mb, nil
+// GopkginConstraint returns the constraint implied by the major version named
+// by root, if it's on gopkg.in, which only serves versions of that major
+// version: ^N.0.0 for .vN. The project's versions are restricted to those as
+// they're listed, whatever it's constrained to otherwise. A path naming
+// -unstable branches implies no semver constraint, as it gets no tags.
+func GopkginConstraint(root ProjectRoot) (Constraint, bool) {
+	gp, err := gopkginDeducer{regexp: gpinNewRegex}.parse(string(root))
+	if err != nil || gp.unstable {
+		return nil, false
+	}
+
+	body := fmt.Sprintf("^%d.0.0", gp.major)
+	if gp.major == 0 {
+		// ^0.0.0 would be narrower than all of 0.x.
+		body = "<1.0.0"
+	}
+	c, err := NewSemverConstraint(body)
+	if err != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// EffectiveConstraint returns the constraint which applies to the project at
+// root given c: the intersection of c with the GopkginConstraint of root, if
+// it has one and c is any version or a semver range or version; c otherwise.
+func EffectiveConstraint(root ProjectRoot, c Constraint) Constraint {
+	ic, ok := GopkginConstraint(root)
+	if !ok {
+		return c
+	}
+
+	switch c.(type) {
+	case anyConstraint, semverConstraint, semVersion:
+		return ic.Intersect(c)
+	}
+	return c
 }
 
 type launchpadDeducer struct {
@@ -483,7 +555,7 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSource,
 	}
 
 	switch v[4] {
-	case "git", "hg", "bzr":
+	case "git", "hg", "bzr", "svn":
 		x := strings.SplitN(v[1], "/", 2)
 		// TODO(sdboyer) is this actually correct for bzr?
 		u.Host = x[0]
@@ -501,6 +573,8 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSource,
 				return maybeBzrSource{url: u}, nil
 			case "hg":
 				return maybeHgSource{url: u}, nil
+			case "svn":
+				return maybeSvnSource{url: u}, nil
 			}
 		}
 
@@ -524,6 +598,11 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSource,
 			f = func(k int, u *url.URL) {
 				mb[k] = maybeHgSource{url: u}
 			}
+		case "svn":
+			schemes = svnSchemes
+			f = func(k int, u *url.URL) {
+				mb[k] = maybeSvnSource{url: u}
+			}
 		}
 
 		mb = make(maybeSources, len(schemes))
@@ -555,6 +634,9 @@ type deductionCoordinator struct {
 	mut      sync.RWMutex
 	rootxt   *radix.Tree
 	deducext *deducerTrie
+	metadata *metadataCache // persists the go-get metadata fetched, if set
+	client   *http.Client   // fetches the go-get metadata; the default if nil
+	warn     *log.Logger    // logs the use of old metadata, if set
 }
 
 func newDeductionCoordinator(superv *supervisor) *deductionCoordinator {
@@ -622,6 +704,9 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	hmd := &httpMetadataDeducer{
 		basePath: path,
 		suprvsr:  dc.suprvsr,
+		metadata: dc.metadata,
+		client:   dc.client,
+		warn:     dc.warn,
 		// The vanity deducer will call this func with a completed
 		// pathDeduction if it succeeds in finding one. We process it
 		// back through the action channel to ensure serialized
@@ -654,6 +739,13 @@ type pathDeduction struct {
 var errNoKnownPathMatch = errors.New("no known path match")
 
 func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, error) {
+	if IsLocalSource(path) {
+		return pathDeduction{
+			root: path,
+			mb:   maybeLocalSource{path: localSourcePath(path)},
+		}, nil
+	}
+
 	u, path, err := normalizeURI(path)
 	if err != nil {
 		return pathDeduction{}, err
@@ -693,6 +785,20 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 	return pathDeduction{}, errNoKnownPathMatch
 }
 
+// DeduceKnownProjectRoot deduces the root of the project providing the import
+// path ip from the shape of the path alone, as is done for well-known hosts
+// like github.com, without any network activity. An empty root is returned,
+// without an error, if the root can only be found by fetching the go get
+// metadata of ip.
+func DeduceKnownProjectRoot(ip string) (ProjectRoot, error) {
+	dc := &deductionCoordinator{deducext: pathDeducerTrie()}
+	pd, err := dc.deduceKnownPaths(ip)
+	if err == errNoKnownPathMatch {
+		return "", nil
+	}
+	return ProjectRoot(pd.root), err
+}
+
 type httpMetadataDeducer struct {
 	once       sync.Once
 	deduced    pathDeduction
@@ -700,6 +806,9 @@ type httpMetadataDeducer struct {
 	basePath   string
 	returnFunc func(pathDeduction)
 	suprvsr    *supervisor
+	metadata   *metadataCache
+	client     *http.Client
+	warn       *log.Logger
 }
 
 func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDeduction, error) {
@@ -714,19 +823,42 @@ func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDe
 
 		pd := pathDeduction{}
 
-		// Make the HTTP call to attempt to retrieve go-get metadata
+		// Make the HTTP call to attempt to retrieve go-get metadata, unless
+		// that fetched before is fresh enough to use, or the network is
+		// disabled, in which case only the metadata fetched before is to be
+		// had. It's also used, with a warning, if the host is down.
 		var root, vcs, reporoot string
-		err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
-			root, vcs, reporoot, err = getMetadata(ctx, path, u.Scheme)
-			if err != nil {
-				err = errors.Wrapf(err, "unable to read metadata")
+		cm, cached := hmd.metadata.get(path)
+		if err = hmd.suprvsr.checkNetwork(path, "fetching the go-get metadata of"); err != nil {
+			if !cached {
+				hmd.deduceErr = err
+				return
+			}
+			root, vcs, reporoot = cm.Root, cm.VCS, cm.RepoRoot
+		} else if cached && hmd.metadata.fresh(cm) {
+			root, vcs, reporoot = cm.Root, cm.VCS, cm.RepoRoot
+		} else {
+			err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
+				root, vcs, reporoot, err = getMetadata(ctx, hmd.client, path, u.Scheme)
+				if err != nil {
+					err = errors.Wrapf(err, "unable to read metadata")
+				}
+				return err
+			})
+			switch {
+			case err == nil:
+				cached = false
+				hmd.metadata.put(cachedMetadata{Root: root, VCS: vcs, RepoRoot: reporoot, Fetched: time.Now()})
+			case cached && ctx.Err() == nil:
+				if hmd.warn != nil {
+					hmd.warn.Printf("Warning: using the go-get metadata of %s fetched on %s, as it can't be fetched now: %s", cm.Root, cm.Fetched.Format("2006-01-02"), err)
+				}
+				root, vcs, reporoot = cm.Root, cm.VCS, cm.RepoRoot
+			default:
+				err = errors.Wrapf(err, "unable to deduce repository and source type for %q", opath)
+				hmd.deduceErr = err
+				return
 			}
-			return err
-		})
-		if err != nil {
-			err = errors.Wrapf(err, "unable to deduce repository and source type for %q", opath)
-			hmd.deduceErr = err
-			return
 		}
 		pd.root = root
 
@@ -760,10 +892,15 @@ func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDe
 			pd.mb = maybeBzrSource{url: repoURL}
 		case "hg":
 			pd.mb = maybeHgSource{url: repoURL}
+		case "svn":
+			pd.mb = maybeSvnSource{url: repoURL}
 		default:
 			hmd.deduceErr = errors.Errorf("unsupported vcs type %s in go-get metadata from %s", vcs, path)
 			return
 		}
+		if cached {
+			pd.mb = maybeCachedMetadataSource{maybeSource: pd.mb, mc: hmd.metadata, root: root}
+		}
 
 		hmd.deduced = pd
 		// All data is assigned for other goroutines that may be waiting. Now,
@@ -817,23 +954,27 @@ func normalizeURI(p string) (u *url.URL, newpath string, err error) {
 	return
 }
 
-// fetchMetadata fetches the remote metadata for path.
-func fetchMetadata(ctx context.Context, path, scheme string) (rc io.ReadCloser, err error) {
+// fetchMetadata fetches the remote metadata for path with client, or the
+// default client if it's nil.
+func fetchMetadata(ctx context.Context, client *http.Client, path, scheme string) (rc io.ReadCloser, err error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
 	if scheme == "http" {
-		rc, err = doFetchMetadata(ctx, "http", path)
+		rc, err = doFetchMetadata(ctx, client, "http", path)
 		return
 	}
 
-	rc, err = doFetchMetadata(ctx, "https", path)
+	rc, err = doFetchMetadata(ctx, client, "https", path)
 	if err == nil {
 		return
 	}
 
-	rc, err = doFetchMetadata(ctx, "http", path)
+	rc, err = doFetchMetadata(ctx, client, "http", path)
 	return
 }
 
-func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, error) {
+func doFetchMetadata(ctx context.Context, client *http.Client, scheme, path string) (io.ReadCloser, error) {
 	url := fmt.Sprintf("%s://%s?go-get=1", scheme, path)
 	switch scheme {
 	case "https", "http":
@@ -841,11 +982,23 @@ func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, e
 		if err != nil {
 			return nil, errors.Wrapf(err, "unable to build HTTP request for URL %q", url)
 		}
+		addNetrcAuth(req)
 
-		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		resp, err := client.Do(req.WithContext(ctx))
 		if err != nil {
+			// Name the proxy the request went through, if any, as it's as
+			// likely to be at fault as the server.
+			if tr, ok := client.Transport.(*http.Transport); ok && tr.Proxy != nil {
+				if proxy, perr := tr.Proxy(req); perr == nil && proxy != nil {
+					return nil, errors.Wrapf(err, "failed HTTP request to URL %q via proxy %s", url, proxy.Host)
+				}
+			}
 			return nil, errors.Wrapf(err, "failed HTTP request to URL %q", url)
 		}
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			return nil, &httpStatusError{url: url, code: resp.StatusCode}
+		}
 
 		return resp.Body, nil
 	default:
@@ -858,8 +1011,8 @@ func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, e
 // scheme is optional. If it's http, only http will be attempted for fetching.
 // Any other scheme (including none) will first try https, then fall back to
 // http.
-func getMetadata(ctx context.Context, path, scheme string) (string, string, string, error) {
-	rc, err := fetchMetadata(ctx, path, scheme)
+func getMetadata(ctx context.Context, client *http.Client, path, scheme string) (string, string, string, error) {
+	rc, err := fetchMetadata(ctx, client, path, scheme)
 	if err != nil {
 		return "", "", "", errors.Wrapf(err, "unable to fetch raw metadata")
 	}
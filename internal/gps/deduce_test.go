@@ -426,6 +426,16 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 				maybeHgSource{url: mkurl("http://foo-bar.com/baz.hg")},
 			},
 		},
+		{
+			in:   "foobar.com/baz.svn/pkg",
+			root: "foobar.com/baz.svn",
+			mb: maybeSources{
+				maybeSvnSource{url: mkurl("https://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("http://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("svn://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("svn+ssh://foobar.com/baz.svn")},
+			},
+		},
 		{
 			in:   "git@foobar.com:baz.git",
 			root: "foobar.com/baz.git",
@@ -446,6 +456,11 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 			root: "foobar.com/baz.hg",
 			mb:   maybeHgSource{url: mkurl("https://foobar.com/baz.hg")},
 		},
+		{
+			in:   "svn+ssh://foobar.com/baz.svn",
+			root: "foobar.com/baz.svn",
+			mb:   maybeSvnSource{url: mkurl("svn+ssh://foobar.com/baz.svn")},
+		},
 		{
 			in:     "git://foobar.com/baz.hg",
 			root:   "foobar.com/baz.hg",
@@ -529,6 +544,8 @@ func TestDeduceFromPath(t *testing.T) {
 					return fmt.Sprintf("%T: %s", tmb, ufmt(tmb.url))
 				case maybeHgSource:
 					return fmt.Sprintf("%T: %s", tmb, ufmt(tmb.url))
+				case maybeSvnSource:
+					return fmt.Sprintf("%T: %s", tmb, ufmt(tmb.url))
 				case maybeGopkginSource:
 					return fmt.Sprintf("%T: %s (v%v) %s ", tmb, tmb.opath, tmb.major, ufmt(tmb.url))
 				default:
@@ -657,6 +674,73 @@ func TestVanityDeductionSchemeMismatch(t *testing.T) {
 	}
 }
 
+func TestDeduceKnownProjectRoot(t *testing.T) {
+	cases := map[string]ProjectRoot{
+		"github.com/sdboyer/gps/solver": "github.com/sdboyer/gps",
+		"gopkg.in/yaml.v2":              "gopkg.in/yaml.v2",
+		"golang.org/x/net/context":      "",
+	}
+	for ip, want := range cases {
+		got, err := DeduceKnownProjectRoot(ip)
+		if err != nil {
+			t.Errorf("unexpected error deducing the root of %s: %s", ip, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("expected the root of %s to be %q, got %q", ip, want, got)
+		}
+	}
+}
+
+func TestGopkgin(t *testing.T) {
+	cases := []struct {
+		root       ProjectRoot
+		repo       string
+		constraint string
+	}{
+		{"gopkg.in/yaml.v2", "github.com/go-yaml/yaml", "^2.0.0"},
+		{"gopkg.in/sdboyer/gps.v1", "github.com/sdboyer/gps", "^1.0.0"},
+		{"gopkg.in/inf.v0", "github.com/go-inf/inf", "<1.0.0"},
+		{"gopkg.in/sdboyer/gpkt2.v1-unstable", "github.com/sdboyer/gpkt2", ""},
+		{"github.com/go-yaml/yaml", "", ""},
+	}
+	for _, c := range cases {
+		repo, ok := GopkginRepo(c.root)
+		if repo != c.repo || ok != (c.repo != "") {
+			t.Errorf("expected %s to be served from %q, got %q", c.root, c.repo, repo)
+		}
+		ic, ok := GopkginConstraint(c.root)
+		if ok != (c.constraint != "") || (ok && ic.String() != c.constraint) {
+			t.Errorf("expected %s to imply the constraint %q, got %v", c.root, c.constraint, ic)
+		}
+	}
+
+	v2 := ProjectRoot("gopkg.in/yaml.v2")
+	effective := []struct {
+		c    Constraint
+		want string
+	}{
+		{Any(), "^2.0.0"},
+		{mkSVC("^2.1.0"), "^2.1.0"},
+		{mkSVC(">=1.5.0"), "^2.0.0"},
+		{mkSVC("^1.0.0 || ^2.3.0"), "^2.3.0"},
+		{mkSVC("^3.0.0"), ""}, // none
+		{NewVersion("v2.0.1"), "v2.0.1"},
+		{NewBranch("v2"), "v2"},
+		{NewBranch("master"), "master"},
+		{NewVersion("not-semver"), "not-semver"},
+		{Revision("abcdef012345"), "abcdef012345"},
+	}
+	for _, e := range effective {
+		if got := EffectiveConstraint(v2, e.c); got.String() != e.want {
+			t.Errorf("expected the effective constraint on %s of %s to be %s, got %s", v2, e.c, e.want, got)
+		}
+	}
+	if got := EffectiveConstraint("github.com/go-yaml/yaml", Any()); !IsAny(got) {
+		t.Errorf("expected no constraint to be implied off gopkg.in, got %s", got)
+	}
+}
+
 // borrow from stdlib
 // more useful string for debugging than fmt's struct printer
 func ufmt(u *url.URL) string {
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"context"
 	"go/build"
 	"io/ioutil"
 	"log"
@@ -49,7 +50,7 @@ func main() {
 
 	// Prep and run the solver
 	solver, _ := gps.Prepare(params, sourcemgr)
-	solution, err := solver.Solve()
+	solution, err := solver.Solve(context.Background())
 	if err == nil {
 		// If no failure, blow away the vendor dir and write a new one out,
 		// stripping nested vendor directories as we go.
@@ -19,6 +19,11 @@ const (
 	hhImportsReqs = "-IMPORTS/REQS-"
 	hhIgnores     = "-IGNORES-"
 	hhOverrides   = "-OVERRIDES-"
+	hhMirrors     = "-MIRRORS-"
+	hhDowngrade   = "-DOWNGRADE-"
+	hhNoTests     = "-NOTESTS-"
+	hhBuild       = "-BUILD-"
+	hhAnalysis    = "-ANALYSIS-"
 	hhAnalyzer    = "-ANALYZER-"
 )
 
@@ -105,6 +110,81 @@ func (s *solver) writeHashingInputs(w io.Writer) {
 		}
 	}
 
+	// Mirrors change the sources of projects beyond the reach of the
+	// constraints, so they're written out in full. The section is omitted when
+	// there are none, so that inputs without them hash as they always have.
+	if len(s.rd.mirrors) > 0 {
+		writeString(hhMirrors)
+		prefixes := make([]string, 0, len(s.rd.mirrors))
+		for prefix := range s.rd.mirrors {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			writeString(prefix)
+			writeString(s.rd.mirrors[prefix])
+		}
+	}
+
+	// Preferring the oldest versions changes which of them are selected, so
+	// switching it has to make for a new solve. Like the mirrors, it's only
+	// written out when set.
+	if s.rd.down {
+		writeString(hhDowngrade)
+	}
+	// Excluding tests only changes the imports above if the tests import
+	// anything else, so it's written out too, when set.
+	if s.rd.notests {
+		writeString(hhNoTests)
+	}
+	// The build matrix changes which imports of dependencies are followed, as
+	// well as of the root, so it's written out in full, when set.
+	if !s.rd.build.IsEmpty() {
+		writeString(hhBuild)
+		for _, l := range []struct {
+			name   string
+			values []string
+		}{
+			{"GOOS", s.rd.build.GOOS},
+			{"GOARCH", s.rd.build.GOARCH},
+			{"TAGS", s.rd.build.Tags},
+		} {
+			if len(l.values) == 0 {
+				continue
+			}
+			writeString(l.name)
+			values := append([]string(nil), l.values...)
+			sort.Strings(values)
+			for _, v := range values {
+				writeString(v)
+			}
+		}
+	}
+
+	// The dirs left out of the root's package tree, or kept in it all the
+	// same, decide which of its packages are there to import anything, so
+	// they're written out too, when set.
+	if len(s.rd.exclude) > 0 || len(s.rd.include) > 0 {
+		writeString(hhAnalysis)
+		for _, l := range []struct {
+			name string
+			dirs []string
+		}{
+			{"EXCLUDE", s.rd.exclude},
+			{"INCLUDE", s.rd.include},
+		} {
+			if len(l.dirs) == 0 {
+				continue
+			}
+			writeString(l.name)
+			dirs := append([]string(nil), l.dirs...)
+			sort.Strings(dirs)
+			for _, dir := range dirs {
+				writeString(dir)
+			}
+		}
+	}
+
 	writeString(hhAnalyzer)
 	ai := s.rd.an.Info()
 	writeString(ai.Name)
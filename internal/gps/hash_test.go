@@ -8,9 +8,13 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"text/tabwriter"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
 )
 
 func TestHashInputs(t *testing.T) {
@@ -543,6 +547,58 @@ func TestHashInputsOverrides(t *testing.T) {
 	}
 }
 
+func TestHashInputsMirrors(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		SourceMirrors:   SourceMirrors{"a": "mirror/a", "c": "mirror/c"},
+		stdLibFn:        func(string) bool { return false },
+		mkBridgeFn:      overrideMkBridge,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while prepping solver: %s", err)
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"mirror/a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhMirrors,
+		"a",
+		"mirror/a",
+		"c",
+		"mirror/c",
+		hhAnalyzer,
+		"naive-analyzer",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
+
 func diffHashingInputs(s Solver, wnt []string) string {
 	actual := HashingInputsAsString(s)
 	got := strings.Split(actual, "\n")
@@ -594,3 +650,273 @@ func diffHashingInputs(s Solver, wnt []string) string {
 	tw.Flush()
 	return buf.String()
 }
+
+func TestHashInputsDowngrade(t *testing.T) {
+	fix := basicFixtures["downgrade on overlapping constraints"]
+
+	solve := func(down bool) (Solution, []byte) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			Downgrade:       down,
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			t.Fatalf("Unexpected error solving with downgrade %t: %s", down, err)
+		}
+		return soln, soln.InputHash()
+	}
+
+	// The same constraints select the newest and the oldest versions of shared
+	// they allow, and the lock of each is out of sync with the other.
+	up, updig := solve(false)
+	down, downdig := solve(true)
+	versions := func(soln Solution) map[ProjectRoot]string {
+		m := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			m[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return m
+	}
+	if got := versions(up)["shared"]; got != "4.0.0" {
+		t.Errorf("Expected shared 4.0.0 to be selected upgrading, got %s", got)
+	}
+	if got := versions(down)["shared"]; got != "3.0.0" {
+		t.Errorf("Expected shared 3.0.0 to be selected downgrading, got %s", got)
+	}
+	if bytes.Equal(updig, downdig) {
+		t.Error("Expected the inputs to hash differently downgrading")
+	}
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhDowngrade,
+		hhAnalyzer,
+		"naive-analyzer",
+		"1",
+	}
+	h := sha256.New()
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	if !bytes.Equal(downdig, h.Sum(nil)) {
+		t.Errorf("Hashes are not equal to those of the inputs:\n%s", strings.Join(elems, "\n"))
+	}
+}
+
+func TestHashInputsExcludeTests(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	// Only the root's tests import b.
+	ptree := fix.rootTree()
+	root := ptree.Packages["root"]
+	root.P.Imports, root.P.TestImports = []string{"a"}, []string{"a", "b"}
+	ptree.Packages["root"] = root
+
+	solve := func(notests bool) (Solution, []byte) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: ptree,
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			ExcludeTests:    notests,
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			t.Fatalf("Unexpected error solving with tests excluded %t: %s", notests, err)
+		}
+		return soln, soln.InputHash()
+	}
+	roots := func(soln Solution) []string {
+		var prs []string
+		for _, lp := range soln.Projects() {
+			prs = append(prs, string(lp.Ident().ProjectRoot))
+		}
+		sort.Strings(prs)
+		return prs
+	}
+
+	with, withdig := solve(false)
+	without, withoutdig := solve(true)
+	if got, want := roots(with), []string{"a", "b", "shared"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v to be selected with tests, got %v", want, got)
+	}
+	if got, want := roots(without), []string{"a", "shared"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v to be selected without tests, got %v", want, got)
+	}
+	if bytes.Equal(withdig, withoutdig) {
+		t.Error("Expected the inputs to hash differently without tests")
+	}
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		hhIgnores,
+		hhOverrides,
+		hhNoTests,
+		hhAnalyzer,
+		"naive-analyzer",
+		"1",
+	}
+	h := sha256.New()
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	if !bytes.Equal(withoutdig, h.Sum(nil)) {
+		t.Errorf("Hashes are not equal to those of the inputs:\n%s", strings.Join(elems, "\n"))
+	}
+}
+
+func TestHashInputsBuildMatrix(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	// Only a file built for windows imports b.
+	ptree := fix.rootTree()
+	root := ptree.Packages["root"]
+	root.P.Imports = []string{"a", "b"}
+	root.P.Constrained = map[string][]pkgtree.BuildConstraint{"b": {{"windows"}}}
+	ptree.Packages["root"] = root
+
+	solve := func(m pkgtree.BuildMatrix) (Solution, []byte) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: ptree,
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			BuildMatrix:     m,
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			t.Fatalf("Unexpected error solving with build matrix %+v: %s", m, err)
+		}
+		return soln, soln.InputHash()
+	}
+	roots := func(soln Solution) []string {
+		var prs []string
+		for _, lp := range soln.Projects() {
+			prs = append(prs, string(lp.Ident().ProjectRoot))
+		}
+		sort.Strings(prs)
+		return prs
+	}
+
+	all, alldig := solve(pkgtree.BuildMatrix{})
+	windows, windowsdig := solve(pkgtree.BuildMatrix{GOOS: []string{"windows"}})
+	linux, linuxdig := solve(pkgtree.BuildMatrix{GOOS: []string{"linux", "darwin"}, Tags: []string{"!appengine"}})
+	if got, want := roots(all), []string{"a", "b", "shared"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v to be selected for all platforms, got %v", want, got)
+	}
+	if got, want := roots(windows), []string{"a", "b", "shared"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v to be selected for windows, got %v", want, got)
+	}
+	if got, want := roots(linux), []string{"a", "shared"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v to be selected for linux and darwin, got %v", want, got)
+	}
+	if bytes.Equal(alldig, windowsdig) {
+		t.Error("Expected the inputs to hash differently with a build matrix")
+	}
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		hhIgnores,
+		hhOverrides,
+		hhBuild,
+		"GOOS",
+		"darwin",
+		"linux",
+		"TAGS",
+		"!appengine",
+		hhAnalyzer,
+		"naive-analyzer",
+		"1",
+	}
+	h := sha256.New()
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	if !bytes.Equal(linuxdig, h.Sum(nil)) {
+		t.Errorf("Hashes are not equal to those of the inputs:\n%s", strings.Join(elems, "\n"))
+	}
+}
+
+func TestHashInputsExcludeDirs(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	hash := func(exclude, include []string) []byte {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			RootExcludeDirs: exclude,
+			RootIncludeDirs: include,
+			stdLibFn:        func(string) bool { return false },
+			mkBridgeFn:      overrideMkBridge,
+		}
+		s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error while prepping solver: %s", err)
+		}
+		return s.HashInputs()
+	}
+
+	none := hash(nil, nil)
+	excluded := hash([]string{"legacy", "internal/old"}, nil)
+	included := hash([]string{"legacy", "internal/old"}, []string{"legacy/keep"})
+	if bytes.Equal(none, excluded) {
+		t.Error("Expected the inputs to hash differently with dirs excluded")
+	}
+	if bytes.Equal(excluded, included) {
+		t.Error("Expected the inputs to hash differently with dirs included")
+	}
+	if !bytes.Equal(excluded, hash([]string{"internal/old", "legacy"}, nil)) {
+		t.Error("Expected the order of the excluded dirs not to change the hash")
+	}
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhAnalysis,
+		"EXCLUDE",
+		"internal/old",
+		"legacy",
+		"INCLUDE",
+		"legacy/keep",
+		hhAnalyzer,
+		"naive-analyzer",
+		"1",
+	}
+	h := sha256.New()
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	if !bytes.Equal(included, h.Sum(nil)) {
+		t.Errorf("Hashes are not equal to those of the inputs:\n%s", strings.Join(elems, "\n"))
+	}
+}
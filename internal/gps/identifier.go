@@ -7,7 +7,10 @@ package gps
 import (
 	"fmt"
 	"math/rand"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
 )
 
 // ProjectRoot is the topmost import path in a tree of other import paths - the
@@ -141,6 +144,60 @@ func (i ProjectIdentifier) normalizedSource() string {
 	return i.Source
 }
 
+// sourceEnvRE matches the ${VAR} references to environment variables in a
+// source.
+var sourceEnvRE = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandSourceEnv returns the source with each ${VAR} reference in it replaced
+// by the value of the environment variable VAR, such as to keep credentials
+// out of a manifest. It is an error for any of them to be unset.
+//
+// Sources are only expanded by the SourceManager, when it fetches them, so
+// that solutions record them unexpanded.
+func ExpandSourceEnv(source string) (string, error) {
+	var unset []string
+	expanded := sourceEnvRE.ReplaceAllStringFunc(source, func(ref string) string {
+		name := sourceEnvRE.FindStringSubmatch(ref)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			unset = append(unset, name)
+		}
+		return val
+	})
+
+	switch len(unset) {
+	case 0:
+		return expanded, nil
+	case 1:
+		return "", fmt.Errorf("source %q refers to the unset environment variable %s", source, unset[0])
+	default:
+		return "", fmt.Errorf("source %q refers to the unset environment variables %s", source, strings.Join(unset, ", "))
+	}
+}
+
+// SourceMirrors maps prefixes of the sources of projects, such as
+// "github.com/", to the prefixes of the URLs of the mirrors they're to be
+// fetched from instead, such as "https://git.example.com/github/". The source
+// of a project without one of its own is its import path.
+type SourceMirrors map[string]string
+
+// Apply returns the provided ProjectIdentifier with its source replaced by that
+// of the mirror whose prefix is the longest one it has, if any.
+func (m SourceMirrors) Apply(id ProjectIdentifier) ProjectIdentifier {
+	src := id.normalizedSource()
+	var longest string
+	var found bool
+	for prefix := range m {
+		if (!found || len(prefix) > len(longest)) && strings.HasPrefix(src, prefix) {
+			longest, found = prefix, true
+		}
+	}
+	if found {
+		id.Source = m[longest] + strings.TrimPrefix(src, longest)
+	}
+	return id
+}
+
 func (i ProjectIdentifier) errString() string {
 	if i.Source == "" || i.Source == string(i.ProjectRoot) {
 		return string(i.ProjectRoot)
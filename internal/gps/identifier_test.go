@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSourceMirrorsApply(t *testing.T) {
+	m := SourceMirrors{
+		"github.com/":        "https://git.example.com/github/",
+		"github.com/sdboyer": "https://git.example.com/sdboyer",
+		"golang.org/x/":      "https://git.example.com/x/",
+	}
+
+	cases := []struct {
+		id   ProjectIdentifier
+		want string
+	}{
+		{
+			id:   mkPI("github.com/foo/bar"),
+			want: "https://git.example.com/github/foo/bar",
+		},
+		{
+			id:   mkPI("github.com/sdboyer/gps"),
+			want: "https://git.example.com/sdboyer/gps",
+		},
+		{
+			id:   mkPI("github.com/foo/bar").normalize(),
+			want: "https://git.example.com/github/foo/bar",
+		},
+		{
+			// An alternate source is mirrored, rather than the import path.
+			id:   ProjectIdentifier{ProjectRoot: "golang.org/x/net", Source: "github.com/golang/net"},
+			want: "https://git.example.com/github/golang/net",
+		},
+		{
+			id:   ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "https://example.com/bar.git"},
+			want: "https://example.com/bar.git",
+		},
+		{
+			id:   mkPI("bitbucket.org/foo/bar"),
+			want: "",
+		},
+	}
+
+	for _, c := range cases {
+		got := m.Apply(c.id)
+		if got.ProjectRoot != c.id.ProjectRoot {
+			t.Errorf("%s: project root changed to %s", c.id, got.ProjectRoot)
+		}
+		if got.Source != c.want {
+			t.Errorf("%s: expected source %q, got %q", c.id, c.want, got.Source)
+		}
+	}
+}
+
+func TestExpandSourceEnv(t *testing.T) {
+	os.Setenv("DEP_TEST_HOST", "git.example.com")
+	os.Setenv("DEP_TEST_TOKEN", "s3cr3t")
+	os.Unsetenv("DEP_TEST_UNSET")
+	os.Unsetenv("DEP_TEST_UNSET2")
+	defer os.Unsetenv("DEP_TEST_HOST")
+	defer os.Unsetenv("DEP_TEST_TOKEN")
+
+	cases := []struct {
+		source, want, err string
+	}{
+		{
+			source: "github.com/sdboyer/gps",
+			want:   "github.com/sdboyer/gps",
+		},
+		{
+			source: "https://${DEP_TEST_TOKEN}@${DEP_TEST_HOST}/sdboyer/gps.git",
+			want:   "https://s3cr3t@git.example.com/sdboyer/gps.git",
+		},
+		{
+			// Only braced references are expanded.
+			source: "https://$DEP_TEST_HOST/sdboyer/gps.git",
+			want:   "https://$DEP_TEST_HOST/sdboyer/gps.git",
+		},
+		{
+			source: "https://${DEP_TEST_UNSET}/sdboyer/gps.git",
+			err:    `source "https://${DEP_TEST_UNSET}/sdboyer/gps.git" refers to the unset environment variable DEP_TEST_UNSET`,
+		},
+		{
+			source: "https://${DEP_TEST_UNSET}@${DEP_TEST_UNSET2}/gps.git",
+			err:    `source "https://${DEP_TEST_UNSET}@${DEP_TEST_UNSET2}/gps.git" refers to the unset environment variables DEP_TEST_UNSET, DEP_TEST_UNSET2`,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := ExpandSourceEnv(c.source)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: expected error %q, got %v", c.source, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.source, err)
+		} else if got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.source, c.want, got)
+		}
+	}
+}
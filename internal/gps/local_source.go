@@ -0,0 +1,215 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// localBranch is the name of the one version of an unversioned local source.
+const localBranch = "local"
+
+// IsLocalSource indicates whether the source of a project is a directory on
+// the local filesystem, given as an absolute path or a file:// URL, rather than
+// an import path or a URL of a remote repository.
+func IsLocalSource(source string) bool {
+	return strings.HasPrefix(source, "file://") || strings.HasPrefix(source, "/") || filepath.IsAbs(source)
+}
+
+// localSourcePath returns the path of the directory that the local source
+// refers to.
+func localSourcePath(source string) string {
+	if u, err := url.Parse(source); err == nil && u.Scheme == "file" {
+		p := filepath.FromSlash(u.Path)
+		// file:///C:/foo leaves a leading separator before the volume name.
+		if len(p) > 1 && filepath.VolumeName(p[1:]) != "" {
+			p = p[1:]
+		}
+		return filepath.Clean(p)
+	}
+	return filepath.Clean(source)
+}
+
+// maybeLocalSource is a directory on the local filesystem. A checkout of a VCS
+// repository is fetched like a remote one would be, so that its branches and
+// tags are its versions; any other directory is an unversioned localSource.
+type maybeLocalSource struct {
+	path string
+}
+
+func (m maybeLocalSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
+	fi, err := os.Stat(m.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !fi.IsDir() {
+		return nil, 0, fmt.Errorf("%s is not a directory", m.path)
+	}
+
+	p := filepath.ToSlash(m.path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	u := &url.URL{Scheme: "file", Path: p}
+	switch {
+	case m.has(".git"):
+		return maybeGitSource{url: u}.try(ctx, cachedir, c, vc, superv)
+	case m.has(".hg"):
+		return maybeHgSource{url: u}.try(ctx, cachedir, c, vc, superv)
+	case m.has(".bzr"):
+		return maybeBzrSource{url: u}.try(ctx, cachedir, c, vc, superv)
+	case m.has("db") && m.has("format"):
+		// A Subversion repository, as made by svnadmin create.
+		return maybeSvnSource{url: u}.try(ctx, cachedir, c, vc, superv)
+	}
+
+	// The files of a local source are the user's own, which may be edited in
+	// place, so they're only ever cloned, not hard linked.
+	src := &localSource{path: m.path, links: superv.links}
+	if src.links == fs.LinkFiles {
+		src.links = fs.CloneFiles
+	}
+	vl, err := src.listVersions(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.storeVersionMap(vl, true)
+
+	state := sourceIsSetUp | sourceExistsUpstream | sourceExistsLocally | sourceHasLatestVersionList | sourceHasLatestLocally
+	return src, state, nil
+}
+
+func (m maybeLocalSource) getURL() string {
+	return m.path
+}
+
+// has indicates whether the directory holds the named VCS metadata. It needn't
+// be a directory: .git is a file in worktrees and submodules.
+func (m maybeLocalSource) has(name string) bool {
+	_, err := os.Lstat(filepath.Join(m.path, name))
+	return err == nil
+}
+
+// localSource is an unversioned tree of code on the local filesystem, such as
+// work in progress on a dependency. Its one version is its default branch,
+// named "local", at a revision which is a digest of the tree, so that a lock
+// tells when the tree has changed since it was solved.
+type localSource struct {
+	path string
+	// rev is the digest of the tree, worked out when it's first needed, as
+	// the tree is taken not to change while the source is in use.
+	rev Revision
+	// links is how files are copied out of the tree to export it.
+	links fs.LinkMode
+}
+
+func (s *localSource) sourceType() string {
+	return "local"
+}
+
+func (s *localSource) existsLocally(ctx context.Context) bool {
+	isDir, _ := fs.IsDir(s.path)
+	return isDir
+}
+
+func (s *localSource) existsUpstream(ctx context.Context) bool {
+	return s.existsLocally(ctx)
+}
+
+func (s *localSource) upstreamURL() string {
+	return s.path
+}
+
+// initLocal does nothing, as the tree is used where it is.
+func (s *localSource) initLocal(ctx context.Context) error {
+	return nil
+}
+
+// updateLocal does nothing, as the tree is used where it is.
+func (s *localSource) updateLocal(ctx context.Context) error {
+	return nil
+}
+
+func (s *localSource) revision() (Revision, error) {
+	if s.rev == "" {
+		digest, err := fs.DigestTree(s.path)
+		if err != nil {
+			return "", err
+		}
+		s.rev = Revision(digest)
+	}
+	return s.rev, nil
+}
+
+func (s *localSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	rev, err := s.revision()
+	if err != nil {
+		return nil, err
+	}
+	return []PairedVersion{newDefaultBranch(localBranch).Pair(rev)}, nil
+}
+
+// getManifestAndLock reads the tree as it is, whatever the revision, as there's
+// no other.
+func (s *localSource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (Manifest, Lock, error) {
+	m, l, err := an.DeriveManifestAndLock(s.path, pr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+
+	return prepManifest(m), l, nil
+}
+
+// listPackages lists the packages in the tree as it is, whatever the revision,
+// as there's no other.
+func (s *localSource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (pkgtree.PackageTree, error) {
+	return pkgtree.ListPackages(s.path, string(pr))
+}
+
+func (s *localSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	rev, err := s.revision()
+	if err != nil {
+		return false, err
+	}
+	return r == rev, nil
+}
+
+func (s *localSource) revisionTime(ctx context.Context, r Revision) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("%s has no commits to tell the time of", s.path)
+}
+
+func (s *localSource) countCommitsBetween(ctx context.Context, from, to Revision) (int, error) {
+	return 0, fmt.Errorf("counting commits is not supported for %s sources", s.sourceType())
+}
+
+// exportRevisionTo copies the tree to the provided dir, provided it's still at
+// the revision, so that what's exported is what was locked.
+func (s *localSource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if present, err := s.revisionPresentIn(ctx, r); err != nil {
+		return err
+	} else if !present {
+		return fmt.Errorf("%s has changed since it was locked at %s, run dep ensure to lock it anew", s.path, r)
+	}
+
+	// Only make the parent dir, as CopyDir will balk on trying to write to an
+	// empty but existing dir.
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+	return fs.CopyDirLinked(s.path, to, s.links)
+}
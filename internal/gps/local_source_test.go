@@ -0,0 +1,188 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestIsLocalSource(t *testing.T) {
+	cases := map[string]bool{
+		"github.com/sdboyer/gps":         false,
+		"https://github.com/sdboyer/gps": false,
+		"git@github.com:sdboyer/gps":     false,
+		"file:///home/me/src/gps":        true,
+		"/home/me/src/gps":               true,
+	}
+	if runtime.GOOS == "windows" {
+		cases[`C:\src\gps`] = true
+	}
+
+	for source, want := range cases {
+		if got := IsLocalSource(source); got != want {
+			t.Errorf("IsLocalSource(%q) = %v, want %v", source, got, want)
+		}
+	}
+}
+
+func TestLocalSourcePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("paths are unix-shaped")
+	}
+
+	cases := map[string]string{
+		"/home/me/src/gps":         "/home/me/src/gps",
+		"/home/me/src/gps/":        "/home/me/src/gps",
+		"file:///home/me/src/gps":  "/home/me/src/gps",
+		"file:///home/me/src/gps/": "/home/me/src/gps",
+	}
+	for source, want := range cases {
+		if got := localSourcePath(source); got != want {
+			t.Errorf("localSourcePath(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func mkLocalTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "localsource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bar.go"), []byte("package bar\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLocalSourceUnversioned(t *testing.T) {
+	dir := mkLocalTree(t)
+	defer os.RemoveAll(dir)
+
+	sm, clean := mkNaiveSM(t)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: dir}
+
+	vl, err := sm.ListVersions(id)
+	if err != nil {
+		clean()
+		t.Fatalf("Unexpected error listing versions: %s", err)
+	}
+	if len(vl) != 1 || vl[0].Type() != IsBranch || vl[0].String() != localBranch || !IsDefaultBranch(vl[0]) {
+		clean()
+		t.Fatalf("Expected only the default branch %q, got %v", localBranch, vl)
+	}
+	v := vl[0]
+
+	ptree, err := sm.ListPackages(id, v)
+	if err != nil {
+		clean()
+		t.Fatalf("Unexpected error listing packages: %s", err)
+	}
+	if _, has := ptree.Packages["github.com/foo/bar"]; !has {
+		t.Errorf("Expected the package github.com/foo/bar in %v", ptree.Packages)
+	}
+
+	to := filepath.Join(dir+"-export", "bar")
+	defer os.RemoveAll(filepath.Dir(to))
+	if err = sm.ExportProject(id, v, to); err != nil {
+		t.Errorf("Unexpected error exporting the tree: %s", err)
+	} else if _, err = os.Stat(filepath.Join(to, "bar.go")); err != nil {
+		t.Errorf("Expected bar.go to be exported: %s", err)
+	}
+
+	// Once the tree changes, it's no longer at the locked revision.
+	if err = ioutil.WriteFile(filepath.Join(dir, "baz.go"), []byte("package bar\n"), 0666); err != nil {
+		clean()
+		t.Fatal(err)
+	}
+	sm, clean = remakeNaiveSM(sm, t)
+	defer clean()
+
+	present, err := sm.RevisionPresentIn(id, v.Revision())
+	if err != nil {
+		t.Fatalf("Unexpected error checking for the revision: %s", err)
+	}
+	if present {
+		t.Error("Expected the revision of the unchanged tree not to be present any longer")
+	}
+	if err = sm.ExportProject(id, v, to+"2"); err == nil {
+		t.Error("Expected exporting a revision the tree has changed from to fail")
+	}
+}
+
+func TestLocalSourceFromEnv(t *testing.T) {
+	dir := mkLocalTree(t)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DEP_TEST_SRC", filepath.Dir(dir))
+	defer os.Unsetenv("DEP_TEST_SRC")
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "${DEP_TEST_SRC}/" + filepath.Base(dir)}
+	if _, err := sm.ListVersions(id); err != nil {
+		t.Errorf("Unexpected error listing versions: %s", err)
+	}
+
+	id.Source = "${DEP_TEST_UNSET}/" + filepath.Base(dir)
+	if _, err := sm.ListVersions(id); err == nil {
+		t.Error("Expected an error for a source with an unset environment variable")
+	}
+}
+
+func TestLocalSourceGitCheckout(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := mkLocalTree(t)
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "bar.go"},
+		{"-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", "Initial commit"},
+		{"tag", "v1.0.0"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+	}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "file://" + filepath.ToSlash(dir)}
+	vl, err := sm.ListVersions(id)
+	if err != nil {
+		t.Fatalf("Unexpected error listing versions: %s", err)
+	}
+
+	var tag Version
+	for _, v := range vl {
+		if v.String() == "v1.0.0" {
+			tag = v
+		}
+	}
+	if tag == nil {
+		t.Fatalf("Expected the tag v1.0.0 of the checkout among %v", vl)
+	}
+
+	// The checkout is cloned into the cache, like a remote repository.
+	ptree, err := sm.ListPackages(id, tag)
+	if err != nil {
+		t.Fatalf("Unexpected error listing packages: %s", err)
+	}
+	if _, has := ptree.Packages["github.com/foo/bar"]; !has {
+		t.Errorf("Expected the package github.com/foo/bar in %v", ptree.Packages)
+	}
+}
@@ -66,10 +66,25 @@ func LocksAreEq(l1, l2 Lock, checkHash bool) bool {
 // URI for accessing it, the path at which it should be placed within a vendor
 // directory, and the packages that are used in it.
 type LockedProject struct {
-	pi   ProjectIdentifier
-	v    UnpairedVersion
-	r    Revision
-	pkgs []string
+	pi     ProjectIdentifier
+	v      UnpairedVersion
+	r      Revision
+	pkgs   []string
+	origin ProjectOrigin
+}
+
+// ProjectOrigin describes where the source of a locked project was fetched
+// from, so that tools which consume locks needn't deduce it again. Its fields
+// are empty where that isn't known.
+type ProjectOrigin struct {
+	// VCS is the type of the source: "git", "hg", "bzr", "svn", or "local" for a
+	// directory which isn't a checkout.
+	VCS string
+	// URL is the URL the source was fetched from.
+	URL string
+	// DefaultBranch is the name of the default branch of the source. It's
+	// only recorded for projects which are locked to a branch.
+	DefaultBranch string
 }
 
 // SimpleLock is a helper for tools to easily describe lock data when they know
@@ -148,7 +163,21 @@ func (lp LockedProject) Version() Version {
 	return lp.v.Pair(lp.r)
 }
 
-// Eq checks if two LockedProject instances are equal.
+// Origin returns where the source of the project was fetched from, as far as
+// it's known.
+func (lp LockedProject) Origin() ProjectOrigin {
+	return lp.origin
+}
+
+// WithOrigin returns a copy of the LockedProject which records that its source
+// was fetched from o.
+func (lp LockedProject) WithOrigin(o ProjectOrigin) LockedProject {
+	lp.origin = o
+	return lp
+}
+
+// Eq checks if two LockedProject instances are equal. Their origins aren't
+// compared, as they only describe where the same code was fetched from.
 func (lp LockedProject) Eq(lp2 LockedProject) bool {
 	if lp.pi != lp2.pi {
 		return false
@@ -25,7 +25,7 @@ func TestLockedProjectSorting(t *testing.T) {
 	// only the two should have switched positions
 	lps[0], lps[2] = lps[2], lps[0]
 	if !reflect.DeepEqual(lps, lps2) {
-		t.Errorf("SortLockedProject did not sort as expected:\n\t(GOT) %s\n\t(WNT) %s", lps2, lps)
+		t.Errorf("SortLockedProject did not sort as expected:\n\t(GOT) %v\n\t(WNT) %v", lps2, lps)
 	}
 }
 
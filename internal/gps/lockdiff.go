@@ -53,12 +53,15 @@ type LockDiff struct {
 // LockedProjectDiff contains the before and after snapshot of a project reference.
 // Fields are only populated when there is a difference, otherwise they are empty.
 type LockedProjectDiff struct {
-	Name     ProjectRoot
-	Source   *StringDiff
-	Version  *StringDiff
-	Branch   *StringDiff
-	Revision *StringDiff
-	Packages []StringDiff
+	Name          ProjectRoot
+	Source        *StringDiff
+	Version       *StringDiff
+	Branch        *StringDiff
+	Revision      *StringDiff
+	Packages      []StringDiff
+	VCS           *StringDiff
+	URL           *StringDiff
+	DefaultBranch *StringDiff
 }
 
 // DiffLocks compares two locks and identifies the differences between them.
@@ -165,12 +168,15 @@ func buildLockedProjectDiff(lp LockedProject) LockedProjectDiff {
 	}
 
 	add := LockedProjectDiff{
-		Name:     lp.pi.ProjectRoot,
-		Source:   source,
-		Revision: rev,
-		Version:  version,
-		Branch:   branch,
-		Packages: make([]StringDiff, len(lp.Packages())),
+		Name:          lp.pi.ProjectRoot,
+		Source:        source,
+		Revision:      rev,
+		Version:       version,
+		Branch:        branch,
+		Packages:      make([]StringDiff, len(lp.Packages())),
+		VCS:           unchangedStringDiff(lp.origin.VCS),
+		URL:           unchangedStringDiff(lp.origin.URL),
+		DefaultBranch: unchangedStringDiff(lp.origin.DefaultBranch),
 	}
 	for i, pkg := range lp.Packages() {
 		add.Packages[i] = StringDiff{Previous: pkg, Current: pkg}
@@ -178,6 +184,22 @@ func buildLockedProjectDiff(lp LockedProject) LockedProjectDiff {
 	return add
 }
 
+// unchangedStringDiff returns a StringDiff of s to itself, or nil if s is empty.
+func unchangedStringDiff(s string) *StringDiff {
+	if s == "" {
+		return nil
+	}
+	return &StringDiff{Previous: s, Current: s}
+}
+
+// diffStrings returns a StringDiff of s1 to s2, or nil if they're the same.
+func diffStrings(s1, s2 string) *StringDiff {
+	if s1 == s2 {
+		return nil
+	}
+	return &StringDiff{Previous: s1, Current: s2}
+}
+
 // DiffProjects compares two projects and identifies the differences between them.
 // Returns nil if there are no differences
 func DiffProjects(lp1 LockedProject, lp2 LockedProject) *LockedProjectDiff {
@@ -250,7 +272,13 @@ func DiffProjects(lp1 LockedProject, lp2 LockedProject) *LockedProjectDiff {
 		diff.Packages = append(diff.Packages, add)
 	}
 
-	if diff.Source == nil && diff.Version == nil && diff.Revision == nil && len(diff.Packages) == 0 {
+	o1, o2 := lp1.Origin(), lp2.Origin()
+	diff.VCS = diffStrings(o1.VCS, o2.VCS)
+	diff.URL = diffStrings(o1.URL, o2.URL)
+	diff.DefaultBranch = diffStrings(o1.DefaultBranch, o2.DefaultBranch)
+
+	if diff.Source == nil && diff.Version == nil && diff.Revision == nil && len(diff.Packages) == 0 &&
+		diff.VCS == nil && diff.URL == nil && diff.DefaultBranch == nil {
 		return nil // The projects are equivalent
 	}
 	return &diff
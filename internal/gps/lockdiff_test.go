@@ -116,6 +116,37 @@ func TestDiffProjects_Modify(t *testing.T) {
 	}
 }
 
+func TestDiffProjects_ModifyOrigin(t *testing.T) {
+	p1 := NewLockedProject(mkPI("github.com/foo/bar"), NewBranch("master").Pair("abc123"), []string{"."})
+	p2 := p1.WithOrigin(ProjectOrigin{VCS: "git", URL: "https://github.com/foo/bar", DefaultBranch: "master"})
+
+	diff := DiffProjects(p1, p2)
+	if diff == nil {
+		t.Fatal("Expected the diff to be populated")
+	}
+	if diff.Revision != nil || diff.Branch != nil || len(diff.Packages) != 0 {
+		t.Fatalf("Expected only the origin to differ, got %+v", diff)
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  *StringDiff
+		want string
+	}{
+		{"VCS", diff.VCS, "+ git"},
+		{"URL", diff.URL, "+ https://github.com/foo/bar"},
+		{"DefaultBranch", diff.DefaultBranch, "+ master"},
+	} {
+		if got := tc.got.String(); got != tc.want {
+			t.Errorf("Expected diff.%s to be '%s', got '%s'", tc.name, tc.want, got)
+		}
+	}
+
+	if DiffProjects(p2, p2) != nil {
+		t.Error("Expected no diff between projects with the same origin")
+	}
+}
+
 func TestDiffProjects_AddPackages(t *testing.T) {
 	p1 := LockedProject{
 		pi:   ProjectIdentifier{ProjectRoot: "github.com/foo/bar"},
@@ -83,15 +83,20 @@ func TestSourceManagerInit(t *testing.T) {
 		t.Errorf("Unexpected error on SourceManager creation: %s", err)
 	}
 
-	_, err = NewSourceManager(cpath)
-	if err == nil {
-		t.Errorf("Creating second SourceManager should have failed due to file lock contention")
-	} else if te, ok := err.(CouldNotCreateLockError); !ok {
-		t.Errorf("Should have gotten CouldNotCreateLockError error type, but got %T", te)
+	// Any number of SourceManagers may share the cache dir.
+	sm2, err := NewSourceManager(cpath)
+	if err != nil {
+		t.Errorf("Creating a second SourceManager on the same cache dir should have succeeded, but failed with err %s", err)
+	} else {
+		sm2.Release()
 	}
 
-	if _, err = os.Stat(path.Join(cpath, "sm.lock")); err != nil {
-		t.Errorf("Global cache lock file not created correctly")
+	// No lock is held once they're set up.
+	fis, err := ioutil.ReadDir(path.Join(cpath, "locks"))
+	if err != nil {
+		t.Errorf("Cache lock dir not created correctly: %s", err)
+	} else if len(fis) != 0 {
+		t.Errorf("Expected no cache lock files once set up, got %d", len(fis))
 	}
 
 	sm.Release()
@@ -100,10 +105,6 @@ func TestSourceManagerInit(t *testing.T) {
 		t.Errorf("removeAll failed: %s", err)
 	}
 
-	if _, err = os.Stat(path.Join(cpath, "sm.lock")); !os.IsNotExist(err) {
-		t.Fatalf("Global cache lock file not cleared correctly on Release()")
-	}
-
 	// Set another one up at the same spot now, just to be sure
 	sm, err = NewSourceManager(cpath)
 	if err != nil {
@@ -883,3 +884,53 @@ func TestSupervisor(t *testing.T) {
 		return nil
 	})
 }
+
+func TestSourceMgrUseContext(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, _ := mkGitHistory(t, 1, 64)
+	defer os.RemoveAll(dir)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "file://" + filepath.ToSlash(dir)}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.UseContext(ctx)
+	if err := sm.SyncSourceFor(id); err != nil {
+		t.Fatalf("Unexpected error before canceling: %s", err)
+	}
+
+	cancel()
+	select {
+	case <-sm.suprvsr.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the SourceMgr to be canceled along with its context")
+	}
+	if _, err := sm.ListVersions(id); err == nil {
+		t.Error("Expected listing versions once canceled to fail")
+	}
+
+	// Nothing is left running, nor locked.
+	sm.Release()
+	if n := sm.suprvsr.count(); n != 0 {
+		t.Errorf("Expected no calls to be left running, got %d", n)
+	}
+	if fis, _ := ioutil.ReadDir(sm.suprvsr.locks.dir); len(fis) != 0 {
+		t.Errorf("Expected no locks to be left in the cache dir, got %d", len(fis))
+	}
+}
+
+func TestSourceMgrUseCallTimeout(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, _ := mkGitHistory(t, 1, 64)
+	defer os.RemoveAll(dir)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "file://" + filepath.ToSlash(dir)}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	sm.UseCallTimeout(time.Nanosecond)
+	if err := sm.SyncSourceFor(id); err != context.DeadlineExceeded {
+		t.Errorf("Expected fetching to fail with %v, got %v", context.DeadlineExceeded, err)
+	}
+}
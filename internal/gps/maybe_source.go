@@ -23,24 +23,32 @@ import (
 // * Allows control over when deduction logic triggers network activity
 // * Makes it easy to attempt multiple URLs for a given import path
 type maybeSource interface {
-	try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error)
+	try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error)
 	getURL() string
 }
 
 type maybeSources []maybeSource
 
-func (mbs maybeSources) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (mbs maybeSources) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
 	var e sourceFailures
+	offline := true
 	for _, mb := range mbs {
-		src, state, err := mb.try(ctx, cachedir, c, superv)
+		src, state, err := mb.try(ctx, cachedir, c, vc, superv)
 		if err == nil {
 			return src, state, nil
 		}
+		_, ok := err.(*ErrNetworkDisabled)
+		offline = offline && ok
 		e = append(e, sourceSetupFailure{
 			ident: mb.getURL(),
 			err:   err,
 		})
 	}
+	// If none could be set up only because the network is disabled, say so,
+	// rather than that there's no valid source.
+	if offline && len(e) > 0 {
+		return nil, 0, e[0].err
+	}
 	return nil, 0, e
 }
 
@@ -85,10 +93,10 @@ type maybeGitSource struct {
 	url *url.URL
 }
 
-func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
 	ustr := m.url.String()
 
-	r, err := newCtxRepo(vcs.Git, ustr, sourceCachePath(cachedir, ustr))
+	r, err := newCtxRepo(ctx, superv.locks, vcs.Git, ustr, sourceCachePath(cachedir, ustr))
 
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
@@ -101,20 +109,13 @@ func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSource
 	}
 
 	// Pinging invokes the same action as calling listVersions, so just do that.
-	var vl []PairedVersion
-	err = superv.do(ctx, "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
-		if vl, err = src.listVersions(ctx); err != nil {
-			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
-		}
-		return nil
-	})
+	// It's skipped if the versions were listed recently enough to be cached;
+	// the gateway then reads them from the cache.
+	state, err := pingByListingVersions(ctx, ustr, src, c, vc, superv)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	c.storeVersionMap(vl, true)
-	state := sourceIsSetUp | sourceExistsUpstream | sourceHasLatestVersionList
-
 	if r.CheckLocal() {
 		state |= sourceExistsLocally
 	}
@@ -126,6 +127,41 @@ func (m maybeGitSource) getURL() string {
 	return m.url.String()
 }
 
+// pingByListingVersions checks that the git source at ustr exists upstream by
+// listing its versions into c, and persisting them in vc. If vc holds them
+// already, the source is assumed to exist, as it did when they were listed,
+// and the versions are left for the gateway to read from vc.
+func pingByListingVersions(ctx context.Context, ustr string, src source, c singleSourceCache, vc *versionListCache, superv *supervisor) (sourceState, error) {
+	name := versionListName(src)
+	if _, has := vc.get(name); has {
+		return sourceIsSetUp | sourceExistsUpstream, nil
+	}
+	// With the network disabled, a source in the cache is set up from there,
+	// without knowing whether it still exists upstream.
+	if err := superv.checkNetwork(ustr, "fetching"); err != nil {
+		if src.existsLocally(ctx) {
+			return sourceIsSetUp, nil
+		}
+		return 0, err
+	}
+
+	var vl []PairedVersion
+	err := superv.do(ctx, "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
+		vl, err = src.listVersions(ctx)
+		return err
+	})
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		// It's not known whether it exists.
+		return 0, err
+	} else if err != nil {
+		return 0, fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
+	}
+
+	c.storeVersionMap(vl, true)
+	vc.put(name, vl)
+	return sourceIsSetUp | sourceExistsUpstream | sourceHasLatestVersionList, nil
+}
+
 type maybeGopkginSource struct {
 	// the original gopkg.in import path. this is used to create the on-disk
 	// location to avoid duplicate resource management - e.g., if instances of
@@ -140,13 +176,13 @@ type maybeGopkginSource struct {
 	unstable bool
 }
 
-func (m maybeGopkginSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeGopkginSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
 	// We don't actually need a fully consistent transform into the on-disk path
 	// - just something that's unique to the particular gopkg.in domain context.
 	// So, it's OK to just dumb-join the scheme with the path.
 	path := sourceCachePath(cachedir, m.url.Scheme+"/"+m.opath)
 	ustr := m.url.String()
-	r, err := newCtxRepo(vcs.Git, ustr, path)
+	r, err := newCtxRepo(ctx, superv.locks, vcs.Git, ustr, path)
 
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
@@ -162,20 +198,11 @@ func (m maybeGopkginSource) try(ctx context.Context, cachedir string, c singleSo
 		unstable: m.unstable,
 	}
 
-	var vl []PairedVersion
-	err = superv.do(ctx, "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
-		if vl, err = src.listVersions(ctx); err != nil {
-			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
-		}
-		return nil
-	})
+	state, err := pingByListingVersions(ctx, ustr, src, c, vc, superv)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	c.storeVersionMap(vl, true)
-	state := sourceIsSetUp | sourceExistsUpstream | sourceHasLatestVersionList
-
 	if r.CheckLocal() {
 		state |= sourceExistsLocally
 	}
@@ -191,15 +218,31 @@ type maybeBzrSource struct {
 	url *url.URL
 }
 
-func (m maybeBzrSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeBzrSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
 	ustr := m.url.String()
 
-	r, err := newCtxRepo(vcs.Bzr, ustr, sourceCachePath(cachedir, ustr))
+	r, err := newCtxRepo(ctx, superv.locks, vcs.Bzr, ustr, sourceCachePath(cachedir, ustr))
 
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
 	}
 
+	src := &bzrSource{
+		baseVCSSource: baseVCSSource{
+			repo:  r,
+			links: superv.links,
+		},
+	}
+
+	// With the network disabled, a source in the cache is set up from there,
+	// without knowing whether it still exists upstream.
+	if err = superv.checkNetwork(ustr, "fetching"); err != nil {
+		if !r.CheckLocal() {
+			return nil, 0, err
+		}
+		return src, sourceIsSetUp | sourceExistsLocally, nil
+	}
+
 	err = superv.do(ctx, "bzr:ping", ctSourcePing, func(ctx context.Context) error {
 		if !r.Ping() {
 			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
@@ -215,12 +258,6 @@ func (m maybeBzrSource) try(ctx context.Context, cachedir string, c singleSource
 		state |= sourceExistsLocally
 	}
 
-	src := &bzrSource{
-		baseVCSSource: baseVCSSource{
-			repo: r,
-		},
-	}
-
 	return src, state, nil
 }
 
@@ -232,15 +269,31 @@ type maybeHgSource struct {
 	url *url.URL
 }
 
-func (m maybeHgSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeHgSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
 	ustr := m.url.String()
 
-	r, err := newCtxRepo(vcs.Hg, ustr, sourceCachePath(cachedir, ustr))
+	r, err := newCtxRepo(ctx, superv.locks, vcs.Hg, ustr, sourceCachePath(cachedir, ustr))
 
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
 	}
 
+	src := &hgSource{
+		baseVCSSource: baseVCSSource{
+			repo:  r,
+			links: superv.links,
+		},
+	}
+
+	// With the network disabled, a source in the cache is set up from there,
+	// without knowing whether it still exists upstream.
+	if err = superv.checkNetwork(ustr, "fetching"); err != nil {
+		if !r.CheckLocal() {
+			return nil, 0, err
+		}
+		return src, sourceIsSetUp | sourceExistsLocally, nil
+	}
+
 	err = superv.do(ctx, "hg:ping", ctSourcePing, func(ctx context.Context) error {
 		if !r.Ping() {
 			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
@@ -256,15 +309,60 @@ func (m maybeHgSource) try(ctx context.Context, cachedir string, c singleSourceC
 		state |= sourceExistsLocally
 	}
 
-	src := &hgSource{
+	return src, state, nil
+}
+
+func (m maybeHgSource) getURL() string {
+	return m.url.String()
+}
+
+type maybeSvnSource struct {
+	url *url.URL
+}
+
+func (m maybeSvnSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
+	ustr := m.url.String()
+
+	r, err := newCtxRepo(ctx, superv.locks, vcs.Svn, ustr, sourceCachePath(cachedir, ustr))
+
+	if err != nil {
+		return nil, 0, unwrapVcsErr(err)
+	}
+
+	src := &svnSource{
 		baseVCSSource: baseVCSSource{
 			repo: r,
 		},
+		layout: superv.svnLayouts.layoutFor(ustr),
+	}
+
+	// With the network disabled, a source in the cache is set up from there,
+	// without knowing whether it still exists upstream.
+	if err = superv.checkNetwork(ustr, "fetching"); err != nil {
+		if !r.CheckLocal() {
+			return nil, 0, err
+		}
+		return src, sourceIsSetUp | sourceExistsLocally, nil
+	}
+
+	err = superv.do(ctx, "svn:ping", ctSourcePing, func(ctx context.Context) error {
+		if !r.Ping() {
+			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	state := sourceIsSetUp | sourceExistsUpstream
+	if r.CheckLocal() {
+		state |= sourceExistsLocally
 	}
 
 	return src, state, nil
 }
 
-func (m maybeHgSource) getURL() string {
+func (m maybeSvnSource) getURL() string {
 	return m.url.String()
 }
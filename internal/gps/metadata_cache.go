@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// metadataCache persists the go-get metadata fetched for vanity import paths
+// in the cache dir, so that a SourceMgr on which the network is disabled, or
+// whose vanity hosts are down, can still find the sources of the import paths
+// it has seen before, and so that the metadata needn't be fetched again within
+// ttl of its last fetch. A nil metadataCache persists nothing.
+type metadataCache struct {
+	dir     string        // Where the metadata is kept, a file per project root
+	ttl     time.Duration // How long metadata is used for, rather than fetched
+	staleOK bool          // Whether metadata is used however old it is
+}
+
+// cachedMetadata is the go-get metadata of a project root, as it's kept in a
+// metadataCache.
+type cachedMetadata struct {
+	Root     string
+	VCS      string
+	RepoRoot string
+	Fetched  time.Time
+}
+
+func newMetadataCache(cachedir string) *metadataCache {
+	return &metadataCache{dir: filepath.Join(cachedir, "metadata")}
+}
+
+// path returns the path of the file the metadata of the project root is kept
+// in.
+func (mc *metadataCache) path(root string) string {
+	return filepath.Join(mc.dir, sanitizer.Replace(root)+".json")
+}
+
+// get returns the metadata of the project providing the import path ip,
+// however old it is; see fresh. It's kept under the root of the project, which
+// is ip or one of its parents.
+func (mc *metadataCache) get(ip string) (cachedMetadata, bool) {
+	if mc == nil {
+		return cachedMetadata{}, false
+	}
+
+	for p := ip; p != "." && p != "/"; p = path.Dir(p) {
+		b, err := ioutil.ReadFile(mc.path(p))
+		if err != nil {
+			continue
+		}
+		var cm cachedMetadata
+		if err := json.Unmarshal(b, &cm); err != nil || cm.Root != p || cm.VCS == "" || cm.RepoRoot == "" {
+			// Corrupt; it's overwritten once the metadata is fetched again.
+			continue
+		}
+		return cm, true
+	}
+	return cachedMetadata{}, false
+}
+
+// put keeps the metadata of a project root, as just fetched at cm.Fetched. Like the version
+// lists, it's only worth keeping, so failing to write it isn't an error.
+func (mc *metadataCache) put(cm cachedMetadata) {
+	if mc == nil {
+		return
+	}
+
+	b, err := json.Marshal(cm)
+	if err != nil {
+		return
+	}
+	writeCacheFile(mc.dir, mc.path(cm.Root), b)
+}
+
+// fresh reports whether the metadata cm, as got from mc, was fetched recently
+// enough to be used rather than fetched again.
+func (mc *metadataCache) fresh(cm cachedMetadata) bool {
+	return mc != nil && (mc.staleOK || time.Since(cm.Fetched) <= mc.ttl)
+}
+
+// remove drops the metadata of the project root, e.g. as the source it points
+// to can't be set up, so that it's fetched again.
+func (mc *metadataCache) remove(root string) {
+	if mc != nil {
+		os.Remove(mc.path(root))
+	}
+}
+
+// maybeCachedMetadataSource is the maybeSource found from metadata got from a
+// metadataCache. The metadata is dropped if the source can't be set up, as it
+// may no longer point to the right place.
+type maybeCachedMetadataSource struct {
+	maybeSource
+	mc   *metadataCache
+	root string
+}
+
+func (m maybeCachedMetadataSource) try(ctx context.Context, cachedir string, c singleSourceCache, vc *versionListCache, superv *supervisor) (source, sourceState, error) {
+	src, state, err := m.maybeSource.try(ctx, cachedir, c, vc, superv)
+	if err != nil && ctx.Err() == nil {
+		if _, ok := err.(*ErrNetworkDisabled); !ok {
+			m.mc.remove(m.root)
+		}
+	}
+	return src, state, err
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataCacheFresh(t *testing.T) {
+	cachedir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeAll(cachedir)
+
+	mc := newMetadataCache(cachedir)
+	mc.ttl = time.Hour
+	mc.put(cachedMetadata{Root: "example.com/foo", VCS: "git", RepoRoot: "https://git.example.com/foo", Fetched: time.Now()})
+
+	cm, has := mc.get("example.com/foo/bar")
+	if !has || cm.Root != "example.com/foo" {
+		t.Fatalf("Expected the metadata of example.com/foo, got %+v, %v", cm, has)
+	}
+	if !mc.fresh(cm) {
+		t.Error("Expected metadata fetched just now to be fresh")
+	}
+	cm.Fetched = cm.Fetched.Add(-2 * time.Hour)
+	if mc.fresh(cm) {
+		t.Error("Expected metadata fetched before the ttl not to be fresh")
+	}
+	mc.staleOK = true
+	if !mc.fresh(cm) {
+		t.Error("Expected old metadata to be fresh when stale metadata is OK")
+	}
+
+	mc.remove("example.com/foo")
+	if _, has := mc.get("example.com/foo/bar"); has {
+		t.Error("Expected no metadata after it was removed")
+	}
+
+	var nilmc *metadataCache
+	if nilmc.fresh(cm) {
+		t.Error("Expected nothing to be fresh in a nil cache")
+	}
+}
+
+// TestDeduceCachedMetadata fetches the go-get metadata of a vanity import path
+// from a server standing in for its host, through a proxy, and checks when the
+// metadata persisted is used instead.
+func TestDeduceCachedMetadata(t *testing.T) {
+	var fetches int
+	up := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			// As if the host were down.
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+			return
+		}
+		if r.Method != "GET" {
+			// https is tried first, and refused.
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fetches++
+		fmt.Fprint(w, `<meta name="go-import" content="example.com/vanity git file:///nonexistent/vanity">`)
+	}))
+	defer srv.Close()
+	proxy, _ := url.Parse(srv.URL)
+
+	var warnings bytes.Buffer
+	setup := func(sm *SourceMgr, ttl time.Duration) {
+		sm.UseMetadataCache(ttl, false)
+		sm.deduceCoord.client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}
+		sm.deduceCoord.warn = log.New(&warnings, "", 0)
+	}
+	deduce := func(sm *SourceMgr) {
+		root, err := sm.DeduceProjectRoot("example.com/vanity/pkg")
+		if err != nil {
+			t.Fatalf("Unexpected error deducing the root: %s", err)
+		}
+		if root != "example.com/vanity" {
+			t.Fatalf("Expected the root example.com/vanity, got %q", root)
+		}
+	}
+
+	sm, clean := mkNaiveSM(t)
+	setup(sm, time.Hour)
+	deduce(sm)
+	if fetches != 1 {
+		t.Fatalf("Expected the metadata to be fetched once, got %d", fetches)
+	}
+
+	// Within the ttl, the metadata isn't fetched again.
+	sm, clean = remakeNaiveSM(sm, t)
+	setup(sm, time.Hour)
+	deduce(sm)
+	if fetches != 1 {
+		t.Errorf("Expected the persisted metadata to be used, but it was fetched %d times", fetches)
+	}
+
+	// Past it, it is, but if the host is down, the metadata persisted is used,
+	// with a warning.
+	up = false
+	sm, clean = remakeNaiveSM(sm, t)
+	defer clean()
+	setup(sm, 0)
+	deduce(sm)
+	if !strings.Contains(warnings.String(), "Warning: using the go-get metadata of example.com/vanity fetched on") {
+		t.Errorf("Expected a warning about using persisted metadata, got %q", warnings.String())
+	}
+
+	// Once the source it points to can't be set up, it's dropped, to be
+	// fetched anew.
+	if _, err := sm.ListVersions(mkPI("example.com/vanity")); err == nil {
+		t.Fatal("Expected an error listing the versions of a source that doesn't exist")
+	}
+	if _, has := sm.deduceCoord.metadata.get("example.com/vanity"); has {
+		t.Error("Expected the metadata to be dropped once its source couldn't be set up")
+	}
+	if _, err := ioutil.ReadDir(filepath.Join(sm.cachedir, "metadata")); err != nil {
+		t.Errorf("Expected the metadata dir to be kept: %s", err)
+	}
+}
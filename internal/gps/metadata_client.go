@@ -0,0 +1,160 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMetadataTimeout is how long a request for the go-get metadata of an
+// import path may take, unless $DEP_HTTP_TIMEOUT says otherwise.
+const DefaultMetadataTimeout = 30 * time.Second
+
+// newMetadataClient builds the HTTP client the go-get metadata of import paths
+// is fetched with, as configured by the environment getenv reads:
+//
+//	HTTP_PROXY, HTTPS_PROXY, NO_PROXY: the proxies to make requests through,
+//	    as for the go tool; the lowercase forms are also read.
+//	DEP_CA_FILE: a PEM bundle of CA certificates to trust, besides the
+//	    system's, such as that of a corporate proxy.
+//	DEP_HTTP_TIMEOUT: how long a request may take, as a duration; 0 for no
+//	    limit.
+func newMetadataClient(getenv func(string) string) (*http.Client, error) {
+	tr := &http.Transport{
+		Proxy: proxyFromEnv(getenv),
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	if f := getenv("DEP_CA_FILE"); f != "" {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read DEP_CA_FILE")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in DEP_CA_FILE %s", f)
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	timeout := DefaultMetadataTimeout
+	if s := getenv("DEP_HTTP_TIMEOUT"); s != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s); err != nil || timeout < 0 {
+			return nil, errors.Errorf("invalid DEP_HTTP_TIMEOUT %q, expected a duration like 30s", s)
+		}
+	}
+
+	return &http.Client{Transport: tr, Timeout: timeout}, nil
+}
+
+// proxyFromEnv returns a proxy func following the rules of
+// http.ProxyFromEnvironment, but for the environment getenv reads, as it is
+// when the func is made; http.ProxyFromEnvironment reads it only once per
+// process.
+func proxyFromEnv(getenv func(string) string) func(*http.Request) (*url.URL, error) {
+	get := func(k string) string {
+		if v := getenv(k); v != "" {
+			return v
+		}
+		return getenv(strings.ToLower(k))
+	}
+	httpProxy, httpsProxy, noProxy := get("HTTP_PROXY"), get("HTTPS_PROXY"), get("NO_PROXY")
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxy := httpProxy
+		if req.URL.Scheme == "https" {
+			proxy = httpsProxy
+		}
+		if proxy == "" || !useProxy(canonicalAddr(req.URL), noProxy) {
+			return nil, nil
+		}
+
+		u, err := url.Parse(proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			// A proxy without a scheme, like "proxy:3128", is taken to be
+			// an http one.
+			if u, err := url.Parse("http://" + proxy); err == nil {
+				return u, nil
+			}
+		}
+		if err != nil {
+			return nil, errors.Errorf("invalid proxy address %q: %v", proxy, err)
+		}
+		return u, nil
+	}
+}
+
+// canonicalAddr returns the host:port of u, with the default port of its
+// scheme if it has none.
+func canonicalAddr(u *url.URL) string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Host, port)
+}
+
+// useProxy reports whether requests to addr, a host:port, should go through a
+// proxy, given the hosts in noProxy, a comma-separated NO_PROXY list, which
+// don't. As for http.ProxyFromEnvironment, neither do requests to localhost.
+func useProxy(addr, noProxy string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return false
+	}
+
+	if noProxy == "*" {
+		return false
+	}
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	for _, p := range strings.Split(noProxy, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			// Without a port, the entry covers every port of the host.
+			p = net.JoinHostPort(p, addr[strings.LastIndex(addr, ":")+1:])
+		}
+		if addr == p {
+			return false
+		}
+		if p[0] == '.' && (strings.HasSuffix(addr, p) || addr == p[1:]) {
+			// ".foo.com" covers "foo.com" and its subdomains.
+			return false
+		}
+		if p[0] != '.' && strings.HasSuffix(addr, "."+p) {
+			// "foo.com" covers its subdomains, too.
+			return false
+		}
+	}
+	return true
+}
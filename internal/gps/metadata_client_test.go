@@ -0,0 +1,176 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv func reading the variables in m.
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestMetadataClientProxy(t *testing.T) {
+	var got []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy is asked for the whole URL.
+		got = append(got, r.RequestURI)
+		fmt.Fprint(w, `<meta name="go-import" content="example.com/pkg git https://git.example.com/pkg">`)
+	}))
+	defer proxy.Close()
+
+	client, err := newMetadataClient(env(map[string]string{"http_proxy": proxy.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, vcs, reporoot, err := getMetadata(context.Background(), client, "example.com/pkg/sub", "http")
+	if err != nil {
+		t.Fatalf("Unexpected error fetching metadata through the proxy: %s", err)
+	}
+	if root != "example.com/pkg" || vcs != "git" || reporoot != "https://git.example.com/pkg" {
+		t.Errorf("Unexpected metadata %q, %q, %q", root, vcs, reporoot)
+	}
+	if want := "http://example.com/pkg/sub?go-get=1"; len(got) != 1 || got[0] != want {
+		t.Errorf("Expected the proxy to be asked for %q, got %q", want, got)
+	}
+
+	// A failed request names the proxy.
+	u, _ := url.Parse(proxy.URL)
+	proxy.Close()
+	_, _, _, err = getMetadata(context.Background(), client, "example.com/pkg/sub", "http")
+	if err == nil || !strings.Contains(err.Error(), "via proxy "+u.Host) {
+		t.Errorf("Expected the error to name the proxy %s, got %v", u.Host, err)
+	}
+}
+
+func TestProxyFromEnv(t *testing.T) {
+	proxy := proxyFromEnv(env(map[string]string{
+		"HTTP_PROXY":  "proxy:3128",
+		"HTTPS_PROXY": "https://secure.proxy:443",
+		"NO_PROXY":    "internal.example.com, .corp.example.com,other.example.com:8080",
+	}))
+
+	cases := map[string]string{
+		"http://example.com/pkg":                "http://proxy:3128",
+		"https://example.com/pkg":               "https://secure.proxy:443",
+		"http://internal.example.com/pkg":       "",
+		"http://sub.internal.example.com/pkg":   "",
+		"https://corp.example.com/pkg":          "",
+		"https://git.corp.example.com/pkg":      "",
+		"http://other.example.com:8080/pkg":     "",
+		"http://other.example.com/pkg":          "http://proxy:3128",
+		"http://notinternal.example.com/pkg":    "http://proxy:3128",
+		"http://localhost/pkg":                  "",
+		"http://127.0.0.1:8080/pkg":             "",
+		"https://example.com.corp.example.org/": "https://secure.proxy:443",
+	}
+	for in, want := range cases {
+		req, err := http.NewRequest("GET", in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := proxy(req)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", in, err)
+			continue
+		}
+		var got string
+		if u != nil {
+			got = u.String()
+		}
+		if got != want {
+			t.Errorf("%s: Expected proxy %q, got %q", in, want, got)
+		}
+	}
+
+	proxy = proxyFromEnv(env(map[string]string{"HTTP_PROXY": "http://proxy:3128", "no_proxy": "*"}))
+	req, _ := http.NewRequest("GET", "http://example.com/pkg", nil)
+	if u, err := proxy(req); u != nil || err != nil {
+		t.Errorf("Expected no proxy with NO_PROXY=*, got %v, %v", u, err)
+	}
+}
+
+func TestMetadataClientCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<meta name="go-import" content="%s/pkg git https://git.example.com/pkg">`, r.Host)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	dir, err := ioutil.TempDir("", "cafile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.TLS.Certificates[0].Certificate[0]})
+	if err := ioutil.WriteFile(ca, b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the CA, the server's certificate isn't trusted.
+	client, err := newMetadataClient(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doFetchMetadata(context.Background(), client, "https", host+"/pkg"); err == nil {
+		t.Fatal("Expected an error fetching metadata from a server with an untrusted certificate")
+	}
+
+	client, err = newMetadataClient(env(map[string]string{"DEP_CA_FILE": ca}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := doFetchMetadata(context.Background(), client, "https", host+"/pkg")
+	if err != nil {
+		t.Fatalf("Unexpected error fetching metadata with DEP_CA_FILE: %s", err)
+	}
+	rc.Close()
+
+	// A file without certificates is a mistake.
+	if _, err := newMetadataClient(env(map[string]string{"DEP_CA_FILE": filepath.Join(dir, "none.pem")})); err == nil {
+		t.Error("Expected an error for a missing DEP_CA_FILE")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "empty.pem"), []byte("not a certificate"), 0666)
+	if _, err := newMetadataClient(env(map[string]string{"DEP_CA_FILE": filepath.Join(dir, "empty.pem")})); err == nil {
+		t.Error("Expected an error for a DEP_CA_FILE without certificates")
+	}
+}
+
+func TestMetadataClientTimeout(t *testing.T) {
+	client, err := newMetadataClient(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != DefaultMetadataTimeout {
+		t.Errorf("Expected the default timeout %s, got %s", DefaultMetadataTimeout, client.Timeout)
+	}
+
+	client, err = newMetadataClient(env(map[string]string{"DEP_HTTP_TIMEOUT": "5s"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 5*time.Second {
+		t.Errorf("Expected a timeout of 5s, got %s", client.Timeout)
+	}
+
+	for _, s := range []string{"5", "forever", "-1s"} {
+		if _, err := newMetadataClient(env(map[string]string{"DEP_HTTP_TIMEOUT": s})); err == nil {
+			t.Errorf("Expected an error for DEP_HTTP_TIMEOUT=%s", s)
+		}
+	}
+}
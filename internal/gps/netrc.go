@@ -0,0 +1,107 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcMachine is a machine's credentials in a .netrc file.
+type netrcMachine struct {
+	name     string // Empty for the default credentials
+	login    string
+	password string
+}
+
+// netrcPath returns the path of the user's .netrc file: $NETRC, or .netrc in
+// their home dir, or _netrc on Windows, as curl, and so git, reads it.
+func netrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, name := os.Getenv("HOME"), ".netrc"
+	if runtime.GOOS == "windows" {
+		home, name = os.Getenv("USERPROFILE"), "_netrc"
+	}
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, name)
+}
+
+// parseNetrc parses the machines in the contents of a .netrc file. Macros,
+// which only ftp has any use for, are skipped.
+func parseNetrc(data string) []netrcMachine {
+	var machines []netrcMachine
+	var m *netrcMachine
+	fields := strings.Fields(data)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine", "default":
+			machines = append(machines, netrcMachine{})
+			m = &machines[len(machines)-1]
+			if fields[i] == "machine" && i+1 < len(fields) {
+				i++
+				m.name = fields[i]
+			}
+		case "login", "password":
+			if m == nil || i+1 >= len(fields) {
+				continue
+			}
+			if fields[i] == "login" {
+				m.login = fields[i+1]
+			} else {
+				m.password = fields[i+1]
+			}
+			i++
+		case "macdef":
+			// A macro runs up to the next blank line, which Fields can't
+			// tell; none of a machine's tokens are expected in one.
+			m = nil
+		}
+	}
+	return machines
+}
+
+// addNetrcAuth sets the basic auth of req to the credentials in the user's
+// .netrc file for the host of its URL, if it has any, so that the go-get
+// metadata of private vanity import paths can be fetched, as git fetches
+// their sources with the same credentials.
+func addNetrcAuth(req *http.Request) {
+	path := netrcPath()
+	if path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	// Machines are named by host alone, whatever the port.
+	host := req.URL.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	var def *netrcMachine
+	machines := parseNetrc(string(data))
+	for i, m := range machines {
+		if m.name == host {
+			req.SetBasicAuth(m.login, m.password)
+			return
+		}
+		if m.name == "" && def == nil {
+			def = &machines[i]
+		}
+	}
+	if def != nil {
+		req.SetBasicAuth(def.login, def.password)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/vcs"
+)
+
+func TestParseNetrc(t *testing.T) {
+	data := `
+machine example.com login alice password s3cret
+machine other.example.com
+	login bob
+	password hunter2
+
+macdef init
+	cd /pub
+
+default login anonymous password guest
+`
+	want := []netrcMachine{
+		{name: "example.com", login: "alice", password: "s3cret"},
+		{name: "other.example.com", login: "bob", password: "hunter2"},
+		{login: "anonymous", password: "guest"},
+	}
+	if got := parseNetrc(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected machines:\n\t(GOT): %+v\n\t(WNT): %+v", got, want)
+	}
+}
+
+// setenv sets the environment variable k to v, returning a func which
+// restores it.
+func setenv(t *testing.T, k, v string) func() {
+	old, had := os.LookupEnv(k)
+	if err := os.Setenv(k, v); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if had {
+			os.Setenv(k, old)
+		} else {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestGetMetadataNetrc(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `<meta name="go-import" content="%s/private git https://git.example.com/private">`, r.Host)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	netrc := filepath.Join(dir, "netrc")
+	defer setenv(t, "NETRC", netrc)()
+
+	// Without credentials, the metadata can't be had.
+	if _, _, _, err := getMetadata(context.Background(), nil, host+"/private/pkg", "http"); err == nil {
+		t.Fatal("Expected an error fetching the metadata without credentials")
+	}
+
+	data := "machine 127.0.0.1 login alice password s3cret\n"
+	if err := ioutil.WriteFile(netrc, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	root, vcs, reporoot, err := getMetadata(context.Background(), nil, host+"/private/pkg", "http")
+	if err != nil {
+		t.Fatalf("Unexpected error fetching the metadata with the credentials in .netrc: %s", err)
+	}
+	if root != host+"/private" || vcs != "git" || reporoot != "https://git.example.com/private" {
+		t.Errorf("Unexpected metadata %q, %q, %q", root, vcs, reporoot)
+	}
+}
+
+func TestNoPromptEnv(t *testing.T) {
+	defer setenv(t, "GIT_SSH_COMMAND", "")()
+	defer setenv(t, "GIT_SSH", "")()
+
+	env := noPromptEnv([]string{"GIT_TERMINAL_PROMPT=1", "GIT_ASKPASS=/bin/askpass"})
+	want := []string{"GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=/bin/askpass", "GIT_SSH_COMMAND=ssh -o BatchMode=yes"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("Unexpected environment:\n\t(GOT): %v\n\t(WNT): %v", env, want)
+	}
+
+	// How the user runs ssh is left alone.
+	os.Setenv("GIT_SSH_COMMAND", "ssh -i key")
+	env = noPromptEnv([]string{"GIT_SSH_COMMAND=ssh -i key"})
+	want = []string{"GIT_SSH_COMMAND=ssh -i key", "GIT_TERMINAL_PROMPT=0"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("Unexpected environment:\n\t(GOT): %v\n\t(WNT): %v", env, want)
+	}
+}
+
+// TestGitCredentialHelper serves a git repository over HTTP, behind basic
+// auth, and checks that the versions of the source can be listed with the
+// credentials from a git credential helper, and that without them, listing
+// fails rather than prompts when prompts are disabled.
+func TestGitCredentialHelper(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir := mkLocalTree(t)
+	defer os.RemoveAll(dir)
+	home, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+	}
+	git(dir, "init", "-q")
+	git(dir, "add", "bar.go")
+	git(dir, "-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", "Initial commit")
+	git(dir, "tag", "v1.0.0")
+	git(home, "clone", "-q", "--bare", dir, "repo.git")
+	git(filepath.Join(home, "repo.git"), "update-server-info")
+
+	// The bare repository is served by the dumb HTTP protocol.
+	fs := http.FileServer(http.Dir(home))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "s3cret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fs.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// Git reads the credential helper from the config in $HOME, which the
+	// commands the SourceMgr runs inherit.
+	defer setenv(t, "HOME", home)()
+	defer setenv(t, "XDG_CONFIG_HOME", filepath.Join(home, ".config"))()
+	defer setenv(t, "GIT_CONFIG_NOSYSTEM", "1")()
+	u := srv.URL + "/repo.git"
+	r, err := newCtxRepo(context.Background(), nil, vcs.Git, u, sourceCachePath(home, u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &gitSource{baseVCSSource: baseVCSSource{repo: r}}
+	ctx := context.WithValue(context.Background(), noPromptKey{}, true)
+
+	if _, err := src.listVersions(ctx); err == nil {
+		t.Fatal("Expected an error listing versions without credentials")
+	}
+
+	helper := "!f() { echo username=alice; echo password=s3cret; }; f"
+	git(home, "config", "--global", "credential.helper", helper)
+	vl, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error listing versions with a credential helper: %s", err)
+	}
+	var found bool
+	for _, v := range vl {
+		found = found || v.String() == "v1.0.0"
+	}
+	if !found {
+		t.Errorf("Expected the tag v1.0.0 among %v", vl)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// mkCachedGitSource commits a tree with a package and tags it v1.0.0, and
+// clones it into the cache of sm as the source at the URL u, as if it had been
+// fetched from there. It returns the revision tagged.
+func mkCachedGitSource(t *testing.T, sm *SourceMgr, u string) Revision {
+	dir := mkLocalTree(t)
+	defer os.RemoveAll(dir)
+
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git(dir, "init", "-q")
+	git(dir, "add", "bar.go")
+	git(dir, "-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", "Initial commit")
+	git(dir, "tag", "v1.0.0")
+	path := sourceCachePath(sm.cachedir, u)
+	git(sm.cachedir, "clone", "-q", dir, path)
+	git(path, "remote", "set-url", "origin", u)
+	return Revision(git(dir, "rev-parse", "HEAD"))
+}
+
+func TestSourceMgrNetworkDisabled(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	sm.DisableNetwork()
+
+	rev := mkCachedGitSource(t, sm, "https://github.com/foo/bar")
+	id := mkPI("github.com/foo/bar")
+	v := NewVersion("v1.0.0").Pair(rev)
+
+	// What's in the cache can be had without the network.
+	to, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+	if err := sm.ExportProject(id, v, to); err != nil {
+		t.Fatalf("Unexpected error exporting a cached source: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(to, "bar.go")); err != nil {
+		t.Errorf("Expected bar.go to be exported: %s", err)
+	}
+	ptree, err := sm.ListPackages(id, v)
+	if err != nil {
+		t.Fatalf("Unexpected error listing the packages of a cached source: %s", err)
+	}
+	if _, has := ptree.Packages["github.com/foo/bar"]; !has {
+		t.Errorf("Expected the package github.com/foo/bar in %v", ptree.Packages)
+	}
+
+	// Its versions can only be listed from a persisted version list.
+	_, err = sm.ListVersions(id)
+	if _, ok := errors.Cause(err).(*ErrNetworkDisabled); !ok {
+		t.Fatalf("Expected an ErrNetworkDisabled listing the versions, got %v", err)
+	}
+	sm.srcCoord.versions.put("https---github.com-foo-bar", []PairedVersion{v})
+	if vl, err := sm.ListVersions(id); err != nil || len(vl) != 1 || vl[0] != v {
+		t.Errorf("Expected the persisted version list, got %v, %v", vl, err)
+	}
+
+	// A source which isn't in the cache would have to be fetched.
+	err = sm.ExportProject(mkPI("github.com/foo/uncached"), v, to)
+	nd, ok := errors.Cause(err).(*ErrNetworkDisabled)
+	if !ok {
+		t.Fatalf("Expected an ErrNetworkDisabled for an uncached source, got %v", err)
+	}
+	if nd.Op != "fetching" || nd.Source != "https://github.com/foo/uncached" {
+		t.Errorf("Expected the error to be for fetching https://github.com/foo/uncached, got %+v", nd)
+	}
+}
+
+func TestSourceMgrNetworkDisabledVanityPath(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	sm.DisableNetwork()
+
+	// The go-get metadata of a vanity import path can't be fetched...
+	_, err := sm.DeduceProjectRoot("example.com/other/pkg")
+	if nd, ok := errors.Cause(err).(*ErrNetworkDisabled); !ok || nd.Op != "fetching the go-get metadata of" {
+		t.Fatalf("Expected an ErrNetworkDisabled deducing a vanity import path, got %v", err)
+	}
+
+	// ...but that fetched before is kept, for the source it points to to be
+	// found in the cache.
+	sm.deduceCoord.metadata.put(cachedMetadata{Root: "example.com/vanity", VCS: "git", RepoRoot: "https://git.example.com/vanity"})
+	rev := mkCachedGitSource(t, sm, "https://git.example.com/vanity")
+
+	root, err := sm.DeduceProjectRoot("example.com/vanity/pkg")
+	if err != nil || root != "example.com/vanity" {
+		t.Fatalf("Expected the root example.com/vanity from the kept metadata, got %q, %v", root, err)
+	}
+	to, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+	if err := sm.ExportProject(mkPI("example.com/vanity"), NewVersion("v1.0.0").Pair(rev), to); err != nil {
+		t.Errorf("Unexpected error exporting the source of a vanity import path: %s", err)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The GOOS and GOARCH values that go/build knows of, which are recognized in
+// file names and +build lines.
+var (
+	knownOS   = strings.Fields("android darwin dragonfly freebsd linux nacl netbsd openbsd plan9 solaris windows zos")
+	knownArch = strings.Fields("386 amd64 amd64p32 arm armbe arm64 arm64be ppc64 ppc64le mips mipsle mips64 mips64le mips64p32 mips64p32le ppc s390 s390x sparc sparc64")
+)
+
+// BuildConstraint holds the build constraints of a Go file: the +build lines
+// it has, and a line made of the GOOS and GOARCH in its name, if any, as
+// "linux,amd64" for foo_linux_amd64.go. The file is only built where all of
+// them are satisfied.
+type BuildConstraint []string
+
+// fileConstraint returns the BuildConstraint of the file at path, given the
+// text of the +build lines it has, after the "+build" prefix; it's nil if the
+// file is built everywhere.
+func fileConstraint(path string, lines []string) BuildConstraint {
+	var c BuildConstraint
+	if l := nameConstraint(filepath.Base(path)); l != "" {
+		c = append(c, l)
+	}
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			c = append(c, l)
+		}
+	}
+	return c
+}
+
+// nameConstraint returns the GOOS and GOARCH in the file name name as a +build
+// line, following go/build's rules: they're the last one or two _-separated
+// elements of the name, ahead of any _test, and after its first element.
+func nameConstraint(name string) string {
+	if dot := strings.Index(name, "."); dot != -1 {
+		name = name[:dot]
+	}
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return ""
+	}
+	l := strings.Split(name[i:], "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+
+	n := len(l)
+	if n >= 2 && contains(knownOS, l[n-2]) && contains(knownArch, l[n-1]) {
+		return l[n-2] + "," + l[n-1]
+	}
+	if n >= 1 && (contains(knownOS, l[n-1]) || contains(knownArch, l[n-1])) {
+		return l[n-1]
+	}
+	return ""
+}
+
+// BuildMatrix is a set of platforms and build tags for which packages are
+// built, by which the imports of files with build constraints are kept or
+// dropped, as with PackageTree.Constrain.
+//
+// GOOS and GOARCH list the operating systems and architectures built for,
+// every one that go/build knows of if they're empty. Tags lists the build
+// tags which are set, or, prefixed with "!", unset; others, such as cgo or
+// the release tags, may be either, whichever lets a file be built. The zero
+// value builds every file, regardless of its build constraints.
+type BuildMatrix struct {
+	GOOS, GOARCH, Tags []string
+}
+
+// IsEmpty reports whether m is the zero BuildMatrix.
+func (m BuildMatrix) IsEmpty() bool {
+	return len(m.GOOS) == 0 && len(m.GOARCH) == 0 && len(m.Tags) == 0
+}
+
+// Allows reports whether a file with the build constraint c is built for any
+// of the platforms in m, with its tags.
+func (m BuildMatrix) Allows(c BuildConstraint) bool {
+	if m.IsEmpty() || len(c) == 0 {
+		return true
+	}
+
+	oses, arches := m.GOOS, m.GOARCH
+	if len(oses) == 0 {
+		oses = knownOS
+	}
+	if len(arches) == 0 {
+		arches = knownArch
+	}
+	for _, goos := range oses {
+		for _, goarch := range arches {
+			if m.allowsOn(c, goos, goarch) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsOn reports whether every line of c is satisfied on goos and goarch.
+func (m BuildMatrix) allowsOn(c BuildConstraint, goos, goarch string) bool {
+	for _, line := range c {
+		var ok bool
+		for _, opt := range strings.Fields(line) {
+			if m.satisfies(opt, goos, goarch) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfies reports whether the +build option opt, a comma-separated list of
+// terms which must all hold, is satisfied on goos and goarch. Tags not in m
+// may be set or not, so long as opt doesn't need both.
+func (m BuildMatrix) satisfies(opt, goos, goarch string) bool {
+	free := make(map[string]bool)
+	for _, term := range strings.Split(opt, ",") {
+		want := !strings.HasPrefix(term, "!")
+		name := strings.TrimPrefix(term, "!")
+		if name == "" {
+			return false
+		}
+
+		switch {
+		case contains(knownOS, name):
+			if (name == goos || name == "linux" && goos == "android") != want {
+				return false
+			}
+		case contains(knownArch, name):
+			if (name == goarch) != want {
+				return false
+			}
+		case contains(m.Tags, name):
+			if !want {
+				return false
+			}
+		case contains(m.Tags, "!"+name):
+			if want {
+				return false
+			}
+		default:
+			if set, has := free[name]; has && set != want {
+				return false
+			}
+			free[name] = want
+		}
+	}
+	return true
+}
+
+// Constrain returns a copy of t without the imports which are only made by
+// files that m doesn't build. t is returned as it is if m is empty.
+func (t PackageTree) Constrain(m BuildMatrix) PackageTree {
+	if m.IsEmpty() {
+		return t
+	}
+
+	t2 := t.Copy()
+	for ip, poe := range t2.Packages {
+		if poe.Err != nil {
+			continue
+		}
+		poe.P.Imports = constrainImports(poe.P.Imports, poe.P.Constrained, m)
+		poe.P.TestImports = constrainImports(poe.P.TestImports, poe.P.TestConstrained, m)
+		t2.Packages[ip] = poe
+	}
+	return t2
+}
+
+// constrainImports returns imports without those whose constraints in
+// constrained are all disallowed by m.
+func constrainImports(imports []string, constrained map[string][]BuildConstraint, m BuildMatrix) []string {
+	if len(constrained) == 0 {
+		return imports
+	}
+
+	var kept []string
+	for _, imp := range imports {
+		cs, has := constrained[imp]
+		if !has {
+			kept = append(kept, imp)
+			continue
+		}
+		for _, c := range cs {
+			if m.Allows(c) {
+				kept = append(kept, imp)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNameConstraint(t *testing.T) {
+	table := map[string]string{
+		"a.go":                  "",
+		"linux.go":              "",
+		"a_linux.go":            "linux",
+		"a_amd64.go":            "amd64",
+		"a_linux_amd64.go":      "linux,amd64",
+		"a_linux_test.go":       "linux",
+		"a_windows_386_test.go": "windows,386",
+		"a_amd64_linux.go":      "linux",
+		"a_foo.go":              "",
+		"a_test.go":             "",
+	}
+	for name, want := range table {
+		if got := nameConstraint(name); got != want {
+			t.Errorf("nameConstraint(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBuildMatrixAllows(t *testing.T) {
+	table := []struct {
+		m    BuildMatrix
+		c    BuildConstraint
+		want bool
+	}{
+		{BuildMatrix{}, BuildConstraint{"linux,windows"}, true},
+		{BuildMatrix{GOOS: []string{"linux"}}, nil, true},
+		{BuildMatrix{GOOS: []string{"linux"}}, BuildConstraint{"windows"}, false},
+		{BuildMatrix{GOOS: []string{"linux", "windows"}}, BuildConstraint{"windows"}, true},
+		{BuildMatrix{GOOS: []string{"android"}}, BuildConstraint{"linux"}, true},
+		{BuildMatrix{GOOS: []string{"linux"}}, BuildConstraint{"!linux"}, false},
+		{BuildMatrix{GOOS: []string{"linux"}}, BuildConstraint{"linux,amd64"}, true},
+		{BuildMatrix{GOOS: []string{"linux"}, GOARCH: []string{"arm"}}, BuildConstraint{"linux,amd64"}, false},
+		{BuildMatrix{GOOS: []string{"linux"}}, BuildConstraint{"windows darwin", "linux"}, false},
+		{BuildMatrix{GOOS: []string{"darwin"}}, BuildConstraint{"windows darwin", "!linux"}, true},
+		{BuildMatrix{Tags: []string{"!appengine"}}, BuildConstraint{"appengine"}, false},
+		{BuildMatrix{Tags: []string{"!appengine"}}, BuildConstraint{"!appengine"}, true},
+		{BuildMatrix{Tags: []string{"appengine"}}, BuildConstraint{"!appengine"}, false},
+		{BuildMatrix{Tags: []string{"appengine"}}, BuildConstraint{"appengine,cgo"}, true},
+		{BuildMatrix{Tags: []string{"appengine"}}, BuildConstraint{"integration,!integration"}, false},
+		{BuildMatrix{Tags: []string{"appengine"}}, BuildConstraint{"ignore"}, true},
+		{BuildMatrix{Tags: []string{"!ignore"}}, BuildConstraint{"ignore"}, false},
+	}
+	for _, fix := range table {
+		if got := fix.m.Allows(fix.c); got != fix.want {
+			t.Errorf("%+v.Allows(%q) = %t, want %t", fix.m, fix.c, got, fix.want)
+		}
+	}
+}
+
+func TestConstrain(t *testing.T) {
+	ptree, err := ListPackages(filepath.Join(getTestdataRootDir(t), "src", "buildmatrix"), "buildmatrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := ptree.Packages["buildmatrix"].P
+	wantConstrained := map[string][]BuildConstraint{
+		"github.com/linux/amd64":      {{"linux,amd64"}},
+		"github.com/standard/server":  {{"!appengine"}},
+		"github.com/unix/both":        {{"linux,!appengine darwin"}},
+		"github.com/windows/registry": {{"windows"}},
+		"google.golang.org/appengine": {{"appengine"}},
+	}
+	if !reflect.DeepEqual(pkg.Constrained, wantConstrained) {
+		t.Errorf("Expected the constrained imports to be %v, got %v", wantConstrained, pkg.Constrained)
+	}
+	wantTestConstrained := map[string][]BuildConstraint{
+		"github.com/integration/harness": {{"integration"}},
+	}
+	if !reflect.DeepEqual(pkg.TestConstrained, wantTestConstrained) {
+		t.Errorf("Expected the constrained test imports to be %v, got %v", wantTestConstrained, pkg.TestConstrained)
+	}
+
+	table := map[string]struct {
+		m                    BuildMatrix
+		imports, testImports []string
+	}{
+		"all": {
+			imports: []string{
+				"github.com/linux/amd64",
+				"github.com/standard/server",
+				"github.com/unix/both",
+				"github.com/windows/registry",
+				"google.golang.org/appengine",
+				"sort",
+			},
+			testImports: []string{
+				"github.com/integration/harness",
+				"testing",
+			},
+		},
+		"linux and darwin without appengine": {
+			m: BuildMatrix{GOOS: []string{"linux", "darwin"}, Tags: []string{"!appengine"}},
+			imports: []string{
+				"github.com/linux/amd64",
+				"github.com/standard/server",
+				"github.com/unix/both",
+				"sort",
+			},
+			testImports: []string{
+				"github.com/integration/harness",
+				"testing",
+			},
+		},
+		"linux arm with appengine": {
+			m: BuildMatrix{GOOS: []string{"linux"}, GOARCH: []string{"arm"}, Tags: []string{"appengine", "!integration"}},
+			imports: []string{
+				"google.golang.org/appengine",
+				"sort",
+			},
+			testImports: []string{
+				"testing",
+			},
+		},
+		"windows": {
+			m: BuildMatrix{GOOS: []string{"windows"}},
+			imports: []string{
+				"github.com/standard/server",
+				"github.com/windows/registry",
+				"google.golang.org/appengine",
+				"sort",
+			},
+			testImports: []string{
+				"github.com/integration/harness",
+				"testing",
+			},
+		},
+	}
+	for name, fix := range table {
+		t.Run(name, func(t *testing.T) {
+			got := ptree.Constrain(fix.m).Packages["buildmatrix"].P
+			if !reflect.DeepEqual(got.Imports, fix.imports) {
+				t.Errorf("Expected imports %v, got %v", fix.imports, got.Imports)
+			}
+			if !reflect.DeepEqual(got.TestImports, fix.testImports) {
+				t.Errorf("Expected test imports %v, got %v", fix.testImports, got.TestImports)
+			}
+		})
+	}
+
+	// The tree constrained is left as it was.
+	if got := ptree.Packages["buildmatrix"].P.Imports; len(got) != 6 {
+		t.Errorf("Expected Constrain to leave the tree's imports alone, got %v", got)
+	}
+}
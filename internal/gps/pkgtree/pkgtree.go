@@ -6,11 +6,13 @@ package pkgtree
 
 import (
 	"fmt"
+	"go/ast"
 	"go/build"
 	"go/parser"
 	gscan "go/scanner"
 	"go/token"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -26,6 +28,13 @@ type Package struct {
 	CommentPath string   // Import path given in the comment on the package statement
 	Imports     []string // Imports from all go and cgo files
 	TestImports []string // Imports from all go test files (in go/build parlance: both TestImports and XTestImports)
+
+	// Constrained and TestConstrained hold the build constraints of the
+	// files making those of Imports and TestImports, respectively, which are
+	// only made by files with build constraints, so that they can be dropped
+	// for a BuildMatrix which builds none of them.
+	Constrained     map[string][]BuildConstraint
+	TestConstrained map[string][]BuildConstraint
 }
 
 // vcsRoots is a set of directories we should not descend into in ListPackages when
@@ -60,6 +69,15 @@ var vcsRoots = map[string]struct{}{
 // to PackageOrErr - each path under the root that exists will have either a
 // Package, or an error describing why the directory is not a valid package.
 func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
+	return ListPackagesExcluding(fileRoot, importRoot, nil, nil)
+}
+
+// ListPackagesExcluding is ListPackages, but for the dirs at or beneath those
+// of exclude, which are left out of the tree without being read, unless
+// they're at or beneath those of include, which are walked all the same. The
+// dirs of both are slash-separated paths relative to fileRoot, such as
+// "legacy/"; of those covering a dir, the longest decides.
+func ListPackagesExcluding(fileRoot, importRoot string, exclude, include []string) (PackageTree, error) {
 	ptree := PackageTree{
 		ImportRoot: importRoot,
 		Packages:   make(map[string]PackageOrErr),
@@ -71,7 +89,23 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		return PackageTree{}, err
 	}
 
+	exclude, include = cleanDirs(exclude), cleanDirs(include)
 	err = filepath.Walk(fileRoot, func(wp string, fi os.FileInfo, err error) error {
+		// Excluded dirs are skipped before anything else, so that whatever
+		// they hold can't fail the walk.
+		var excluded bool
+		if len(exclude) > 0 {
+			rel, _ := filepath.Rel(fileRoot, wp)
+			rel = filepath.ToSlash(rel)
+			excluded = isExcluded(rel, exclude, include)
+			if excluded && !hasIncludedBeneath(rel, include) {
+				if fi != nil && fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
 		if err != nil && err != filepath.SkipDir {
 			return err
 		}
@@ -117,6 +151,11 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		}
 		f.Close()
 
+		// An excluded dir is only walked for the included dirs beneath it.
+		if excluded {
+			return nil
+		}
+
 		// Compute the import path. Run the result through ToSlash(), so that
 		// windows file paths are normalized to slashes, as is expected of
 		// import paths.
@@ -127,17 +166,15 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		p := &build.Package{
 			Dir: wp,
 		}
-		err = fillPackage(p)
-
 		var pkg Package
+		err = fillPackage(p, &pkg)
+
 		if err == nil {
-			pkg = Package{
-				ImportPath:  ip,
-				CommentPath: p.ImportComment,
-				Name:        p.Name,
-				Imports:     p.Imports,
-				TestImports: dedupeStrings(p.TestImports, p.XTestImports),
-			}
+			pkg.ImportPath = ip
+			pkg.CommentPath = p.ImportComment
+			pkg.Name = p.Name
+			pkg.Imports = p.Imports
+			pkg.TestImports = dedupeStrings(p.TestImports, p.XTestImports)
 		} else {
 			switch err.(type) {
 			case gscan.ErrorList, *gscan.Error, *build.NoGoError:
@@ -192,8 +229,9 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 	return ptree, nil
 }
 
-// fillPackage full of info. Assumes p.Dir is set at a minimum
-func fillPackage(p *build.Package) error {
+// fillPackage full of info. Assumes p.Dir is set at a minimum. The build
+// constraints of the imports are recorded in pkg.
+func fillPackage(p *build.Package, pkg *Package) error {
 	var buildPrefix = "// +build "
 	var buildFieldSplit = func(r rune) bool {
 		return unicode.IsSpace(r) || r == ','
@@ -210,6 +248,12 @@ func fillPackage(p *build.Package) error {
 
 	var testImports []string
 	var imports []string
+	// The imports made by files without build constraints, which are left
+	// out of the constrained ones once all the files are parsed.
+	unconstrained := make(map[string]bool)
+	testUnconstrained := make(map[string]bool)
+	constrained := make(map[string][]BuildConstraint)
+	testConstrained := make(map[string][]BuildConstraint)
 	for _, file := range gofiles {
 		// Skip underscore-led or dot-led files, in keeping with the rest of the toolchain.
 		bPrefix := filepath.Base(file)[0]
@@ -222,9 +266,11 @@ func fillPackage(p *build.Package) error {
 			continue
 		}
 
-		pf, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly|parser.ParseComments)
+		fset := token.NewFileSet()
+		pf, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly|parser.ParseComments)
 		if err != nil {
-			if os.IsPermission(err) {
+			// Unreadable files, and dangling symlinks, aren't code.
+			if os.IsPermission(err) || os.IsNotExist(err) {
 				continue
 			}
 			return err
@@ -233,30 +279,33 @@ func fillPackage(p *build.Package) error {
 		fname := filepath.Base(file)
 
 		var ignored bool
+		var lines []string
 		for _, c := range pf.Comments {
 			if c.Pos() > pf.Package { // +build comment must come before package
 				continue
 			}
 
-			var ct string
 			for _, cl := range c.List {
-				if strings.HasPrefix(cl.Text, buildPrefix) {
-					ct = cl.Text
-					break
+				if !strings.HasPrefix(cl.Text, buildPrefix) {
+					continue
 				}
-			}
-			if ct == "" {
-				continue
-			}
-
-			for _, t := range strings.FieldsFunc(ct[len(buildPrefix):], buildFieldSplit) {
-				// hardcoded (for now) handling for the "ignore" build tag
-				// We "soft" ignore the files tagged with ignore so that we pull in their imports.
-				if t == "ignore" {
-					ignored = true
+				ct := cl.Text[len(buildPrefix):]
+				lines = append(lines, ct)
+
+				for _, t := range strings.FieldsFunc(ct, buildFieldSplit) {
+					// hardcoded (for now) handling for the "ignore" build tag
+					// We "soft" ignore the files tagged with ignore so that we pull in their imports.
+					if t == "ignore" {
+						ignored = true
+					}
 				}
 			}
 		}
+		bc := fileConstraint(file, lines)
+
+		if !testFile && !ignored && p.ImportComment == "" {
+			p.ImportComment = importComment(fset, pf)
+		}
 
 		if testFile {
 			p.TestGoFiles = append(p.TestGoFiles, fname)
@@ -275,6 +324,16 @@ func fillPackage(p *build.Package) error {
 			if err != nil {
 				return err // can't happen?
 			}
+			switch {
+			case testFile && bc == nil:
+				testUnconstrained[name] = true
+			case testFile:
+				testConstrained[name] = append(testConstrained[name], bc)
+			case bc == nil:
+				unconstrained[name] = true
+			default:
+				constrained[name] = append(constrained[name], bc)
+			}
 			if testFile {
 				testImports = append(testImports, name)
 			} else {
@@ -287,9 +346,95 @@ func fillPackage(p *build.Package) error {
 	testImports = uniq(testImports)
 	p.Imports = imports
 	p.TestImports = testImports
+	pkg.Constrained = onlyConstrained(constrained, unconstrained)
+	pkg.TestConstrained = onlyConstrained(testConstrained, testUnconstrained)
 	return nil
 }
 
+// importComment returns the import path in the import comment of the file f,
+// as in package foo // import "github.com/org/foo", or "" if it has none.
+func importComment(fset *token.FileSet, f *ast.File) string {
+	line := fset.Position(f.Name.End()).Line
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if c.Pos() < f.Name.End() {
+				continue
+			}
+			if fset.Position(c.Pos()).Line != line {
+				return ""
+			}
+
+			text := c.Text
+			if strings.HasPrefix(text, "//") {
+				text = text[2:]
+			} else {
+				text = strings.TrimSuffix(text[2:], "*/")
+			}
+			text = strings.TrimSpace(text)
+			if !strings.HasPrefix(text, "import ") {
+				return ""
+			}
+			path, err := strconv.Unquote(strings.TrimSpace(text[len("import "):]))
+			if err != nil {
+				return ""
+			}
+			return path
+		}
+	}
+	return ""
+}
+
+// onlyConstrained returns constrained without the imports in unconstrained,
+// or nil if that leaves it empty.
+func onlyConstrained(constrained map[string][]BuildConstraint, unconstrained map[string]bool) map[string][]BuildConstraint {
+	for imp := range unconstrained {
+		delete(constrained, imp)
+	}
+	if len(constrained) == 0 {
+		return nil
+	}
+	return constrained
+}
+
+// cleanDirs returns the slash-separated relative paths of dirs, cleaned, and
+// without trailing slashes.
+func cleanDirs(dirs []string) []string {
+	cleaned := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		cleaned = append(cleaned, path.Clean(filepath.ToSlash(dir)))
+	}
+	return cleaned
+}
+
+// isExcluded reports whether the dir rel, relative to the root of a tree, is
+// excluded from it: whether the longest of exclude and include it's at or
+// beneath is one of exclude.
+func isExcluded(rel string, exclude, include []string) bool {
+	var longest int
+	var excluded bool
+	for _, dir := range exclude {
+		if eqOrSlashedPrefix(rel, dir) && len(dir) >= longest {
+			longest, excluded = len(dir), true
+		}
+	}
+	for _, dir := range include {
+		if eqOrSlashedPrefix(rel, dir) && len(dir) > longest {
+			longest, excluded = len(dir), false
+		}
+	}
+	return excluded
+}
+
+// hasIncludedBeneath reports whether any of include is beneath the dir rel.
+func hasIncludedBeneath(rel string, include []string) bool {
+	for _, dir := range include {
+		if rel == "." || strings.HasPrefix(dir, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // LocalImportsError indicates that a package contains at least one relative
 // import that will prevent it from compiling.
 //
@@ -463,7 +608,7 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore map[string]bo
 			continue
 		}
 		// Skip ignored packages
-		if ignore[ip] {
+		if IsIgnored(ip, ignore) {
 			continue
 		}
 
@@ -484,7 +629,7 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore map[string]bo
 		// For each import, decide whether it should be ignored, or if it
 		// belongs in the external or internal imports list.
 		for _, imp := range imps {
-			if ignore[imp] || imp == "." {
+			if imp == "." || IsIgnored(imp, ignore) {
 				continue
 			}
 
@@ -501,6 +646,29 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore map[string]bo
 	return wmToReach(workmap, backprop)
 }
 
+// TestOnlyImports returns the external import paths which the packages in the
+// tree reach only through the imports of their test files, sorted. An import
+// path reached from a package's non-test files too, whether or not its tests
+// also import it, isn't one of them.
+//
+// main and ignore are as for ToReachMap.
+func (t PackageTree) TestOnlyImports(main bool, ignore map[string]bool) []string {
+	rm, _ := t.ToReachMap(main, false, false, ignore)
+	normal := make(map[string]bool)
+	for _, ip := range rm.FlattenFn(nil) {
+		normal[ip] = true
+	}
+
+	trm, _ := t.ToReachMap(main, true, false, ignore)
+	var testOnly []string
+	for _, ip := range trm.FlattenFn(nil) {
+		if !normal[ip] {
+			testOnly = append(testOnly, ip)
+		}
+	}
+	return testOnly
+}
+
 // Copy copies the PackageTree.
 //
 // This is really only useful as a defensive measure to prevent external state
@@ -866,6 +1034,25 @@ func wmToReach(workmap map[string]wm, backprop bool) (ReachMap, map[string]*Prob
 	return rm, errmap
 }
 
+// IgnoreWildcardSuffix ends an ignored import path which covers a whole tree
+// of packages: "github.com/foo/*" ignores github.com/foo and every package
+// beneath it.
+const IgnoreWildcardSuffix = "/*"
+
+// IsIgnored reports whether the import path ip is in ignore, or beneath one of
+// the paths in it ending in IgnoreWildcardSuffix.
+func IsIgnored(ip string, ignore map[string]bool) bool {
+	if ignore[ip] {
+		return true
+	}
+	for ig := range ignore {
+		if strings.HasSuffix(ig, IgnoreWildcardSuffix) && eqOrSlashedPrefix(ip, strings.TrimSuffix(ig, IgnoreWildcardSuffix)) {
+			return true
+		}
+	}
+	return false
+}
+
 // eqOrSlashedPrefix checks to see if the prefix is either equal to the string,
 // or that it is a prefix and the next char in the string is "/".
 func eqOrSlashedPrefix(s, prefix string) bool {
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
 
@@ -867,6 +868,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							Constrained: map[string][]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 						},
 					},
 				},
@@ -888,6 +892,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							Constrained: map[string][]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 						},
 					},
 				},
@@ -909,6 +916,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							Constrained: map[string][]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 						},
 					},
 				},
@@ -930,6 +940,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							Constrained: map[string][]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 							TestImports: []string{
 								"math/rand",
 								"strconv",
@@ -1681,6 +1694,18 @@ func TestToReachMap(t *testing.T) {
 	)
 	validate()
 
+	// a wildcard cuts out varied/simple/another along with it
+	name = "ignore varied/simple/*"
+	ignore = map[string]bool{
+		b("simple") + IgnoreWildcardSuffix: true,
+	}
+	except(
+		bl("", "simple", "simple/another")+" hash encoding/binary go/parser",
+		b("simple"),
+		b("simple/another"),
+	)
+	validate()
+
 	// widen the hole by excluding otherpath
 	name = "ignore varied/{otherpath,simple}"
 	ignore = map[string]bool{
@@ -1708,6 +1733,36 @@ func TestToReachMap(t *testing.T) {
 	validate()
 }
 
+func TestIsIgnored(t *testing.T) {
+	ignore := map[string]bool{
+		"github.com/foo/bar":  true,
+		"github.com/baz/*":    true,
+		"github.com/qux/quux": true,
+	}
+
+	cases := map[string]bool{
+		"github.com/foo/bar":       true,
+		"github.com/foo/bar/sub":   false,
+		"github.com/foo":           false,
+		"github.com/baz":           true,
+		"github.com/baz/sub":       true,
+		"github.com/baz/sub/deep":  true,
+		"github.com/bazooka":       false,
+		"github.com/qux/quux/sub":  false,
+		"github.com/qux/quuxx":     false,
+		"github.com/unrelated/pkg": false,
+	}
+	for ip, want := range cases {
+		if got := IsIgnored(ip, ignore); got != want {
+			t.Errorf("IsIgnored(%q) = %t, expected %t", ip, got, want)
+		}
+	}
+
+	if IsIgnored("github.com/foo/bar", nil) {
+		t.Error("expected nothing to be ignored by a nil set")
+	}
+}
+
 func TestFlattenReachMap(t *testing.T) {
 	// There's enough in the 'varied' test case to test most of what matters
 	vptree, err := ListPackages(filepath.Join(getTestdataRootDir(t), "src", "github.com", "example", "varied"), "github.com/example/varied")
@@ -1976,6 +2031,41 @@ func TestToReachMapFilterDot(t *testing.T) {
 	}
 }
 
+func TestTestOnlyImports(t *testing.T) {
+	ptree := PackageTree{
+		ImportRoot: "root",
+		Packages: map[string]PackageOrErr{
+			"root": {P: Package{
+				Name:        "root",
+				ImportPath:  "root",
+				Imports:     []string{"a", "root/sub"},
+				TestImports: []string{"a", "b", "root/testutil"},
+			}},
+			"root/sub": {P: Package{
+				Name:        "sub",
+				ImportPath:  "root/sub",
+				Imports:     []string{"c"},
+				TestImports: []string{"c", "d"},
+			}},
+			"root/testutil": {P: Package{
+				Name:       "testutil",
+				ImportPath: "root/testutil",
+				Imports:    []string{"e"},
+			}},
+		},
+	}
+
+	// a and c are imported by both test and non-test files, and e by
+	// root/testutil, which is a package of the tree like any other, though
+	// only tests import it.
+	if got, want := ptree.TestOnlyImports(true, nil), []string{"b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected test-only imports:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	if got, want := ptree.TestOnlyImports(true, map[string]bool{"b": true}), []string{"d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected test-only imports ignoring b:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
 func getTestdataRootDir(t *testing.T) string {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -1983,3 +2073,46 @@ func getTestdataRootDir(t *testing.T) string {
 	}
 	return filepath.Join(cwd, "..", "_testdata")
 }
+
+func TestListPackagesExcluding(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "listpkgsexcl")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	srcdir := filepath.Join(getTestdataRootDir(t), "src", "excluding")
+	workdir := filepath.Join(tmp, "excluding")
+	if err = fs.CopyDir(srcdir, workdir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Junk in legacy/ which can't be read fails a plain ListPackages.
+	junk := filepath.Join(workdir, "legacy", "junk")
+	if err = os.MkdirAll(junk, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("loop.go", filepath.Join(junk, "loop.go")); err != nil {
+		t.Skipf("Can't create symlinks: %s", err)
+	}
+	if _, err = ListPackages(workdir, "excluding"); err == nil {
+		t.Fatal("Expected ListPackages to fail on the symlink loop")
+	}
+
+	out, err := ListPackagesExcluding(workdir, "excluding", []string{"legacy/", "services/billing"}, []string{"legacy/keep/"})
+	if err != nil {
+		t.Fatalf("Unexpected error listing packages excluding legacy/: %s", err)
+	}
+	var got []string
+	for ip := range out.Packages {
+		got = append(got, ip)
+	}
+	sort.Strings(got)
+	want := []string{"excluding", "excluding/legacy/keep", "excluding/services"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the packages %v, got %v", want, got)
+	}
+	if imports := out.Packages["excluding/legacy/keep"].P.Imports; !reflect.DeepEqual(imports, []string{"github.com/keep/dep"}) {
+		t.Errorf("Expected the included package to be listed in full, got the imports %v", imports)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"log"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PruneOptions represents the pruning options used to write the dependency
+// tree.
+type PruneOptions uint8
+
+const (
+	// PruneUnusedPackages indicates if unused Go packages should be pruned.
+	PruneUnusedPackages PruneOptions = 1 << iota
+	// PruneNonGoFiles indicates if non-Go files should be pruned.
+	PruneNonGoFiles
+	// PruneGoTestFiles indicates if Go test files should be pruned.
+	PruneGoTestFiles
+)
+
+// pruneOptionLetters are the letters standing for each of the prune options
+// in String and ParsePruneOptions, in the order they're written.
+var pruneOptionLetters = []struct {
+	letter byte
+	option PruneOptions
+}{
+	{'N', PruneNonGoFiles},
+	{'T', PruneGoTestFiles},
+	{'U', PruneUnusedPackages},
+}
+
+// String returns the options as a letter for each which is set, as recorded
+// in Gopkg.lock: "N" for PruneNonGoFiles, "T" for PruneGoTestFiles and "U" for
+// PruneUnusedPackages.
+func (o PruneOptions) String() string {
+	var b []byte
+	for _, pl := range pruneOptionLetters {
+		if o&pl.option != 0 {
+			b = append(b, pl.letter)
+		}
+	}
+	return string(b)
+}
+
+// ParsePruneOptions parses prune options in the form returned by String.
+func ParsePruneOptions(s string) (PruneOptions, error) {
+	var o PruneOptions
+	for i := 0; i < len(s); i++ {
+		found := false
+		for _, pl := range pruneOptionLetters {
+			if s[i] == pl.letter {
+				o |= pl.option
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.Errorf("invalid prune option %q in %q", s[i], s)
+		}
+	}
+	return o, nil
+}
+
+// PruneOptionSet holds the prune options which a project overrides: those
+// set in Overridden are replaced by their values in Options.
+type PruneOptionSet struct {
+	Overridden PruneOptions
+	Options    PruneOptions
+}
+
+// CascadingPruneOptions holds the default prune options, and those overridden
+// for particular projects.
+type CascadingPruneOptions struct {
+	DefaultOptions    PruneOptions
+	PerProjectOptions map[ProjectRoot]PruneOptionSet
+}
+
+// PruneOptionsFor returns the prune options for the project pr.
+func (o CascadingPruneOptions) PruneOptionsFor(pr ProjectRoot) PruneOptions {
+	pos, has := o.PerProjectOptions[pr]
+	if !has {
+		return o.DefaultOptions
+	}
+	return o.DefaultOptions&^pos.Overridden | pos.Options&pos.Overridden
+}
+
+// PruneResult is what pruning a project removes from the dir it was exported
+// to.
+type PruneResult struct {
+	// Files and Dirs are relative to the project's dir, with forward slashes,
+	// and sorted.
+	Files []string
+	Dirs  []string
+
+	// Bytes is the total size of Files.
+	Bytes int64
+}
+
+// CalculatePrune returns what PruneProject would remove from baseDir, without
+// removing anything.
+func CalculatePrune(baseDir string, lp LockedProject, options PruneOptions) (PruneResult, error) {
+	used := make(map[string]bool, len(lp.Packages()))
+	for _, pkg := range lp.Packages() {
+		used[pkg] = true
+	}
+
+	var r PruneResult
+	var dirs []string
+	kept := make(map[string]int) // The number of entries of each dir kept.
+	err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if rel != "." {
+				dirs = append(dirs, rel)
+			}
+			return nil
+		}
+
+		dir := pathpkg.Dir(rel)
+		if !prunesFile(options, used[dir], info) {
+			kept[dir]++
+			return nil
+		}
+		r.Files = append(r.Files, rel)
+		r.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return PruneResult{}, err
+	}
+
+	// Deepest first, so that whether a dir's subdirs are left empty is known
+	// by the time it's reached.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if kept[dir] == 0 {
+			r.Dirs = append(r.Dirs, dir)
+		} else {
+			kept[pathpkg.Dir(dir)]++
+		}
+	}
+
+	sort.Strings(r.Files)
+	sort.Strings(r.Dirs)
+	return r, nil
+}
+
+// prunesFile reports whether options prune the file info, in a dir of the
+// project which is a package in use if used is true. Legal files are never
+// pruned, wherever they are.
+func prunesFile(options PruneOptions, used bool, info os.FileInfo) bool {
+	switch {
+	case IsLegalFile(info.Name()):
+		return false
+	case options&PruneUnusedPackages != 0 && !used:
+		return true
+	case options&PruneNonGoFiles != 0 && isNonGoFile(info):
+		return true
+	case options&PruneGoTestFiles != 0 && isGoTestFile(info):
+		return true
+	}
+	return false
+}
+
+// PruneProject removes from baseDir, the dir lp was exported to, what options
+// say to prune. Those of lp's packages which are in use are always kept, along
+// with the dirs above them, as are legal files, wherever they are; see
+// IsLegalFile. Dirs left empty are removed. What is removed is logged to logger, if it's
+// not nil.
+func PruneProject(baseDir string, lp LockedProject, options PruneOptions, logger *log.Logger) error {
+	r, err := CalculatePrune(baseDir, lp, options)
+	if err != nil {
+		return errors.Wrap(err, "failed to calculate what to prune")
+	}
+
+	for _, f := range r.Files {
+		if err := pruneFile(filepath.Join(baseDir, filepath.FromSlash(f)), logger); err != nil {
+			return errors.Wrap(err, "failed to prune file")
+		}
+	}
+	// Deepest first, so that each dir is empty by the time it's removed.
+	for i := len(r.Dirs) - 1; i >= 0; i-- {
+		if err := pruneFile(filepath.Join(baseDir, filepath.FromSlash(r.Dirs[i])), logger); err != nil {
+			return errors.Wrap(err, "failed to prune empty dir")
+		}
+	}
+	return nil
+}
+
+// pruneFile removes the file or empty dir path. Files are unlinked, never
+// truncated, as they may be hard links to those of sources in the cache.
+func pruneFile(path string, logger *log.Logger) error {
+	if logger != nil {
+		logger.Printf("  %s", path)
+	}
+	return os.Remove(path)
+}
+
+// legalFileNames are the lower-cased names of the files which hold a project's
+// license or other legal notices, without any extension or qualifier.
+var legalFileNames = []string{
+	"copying",
+	"copyleft",
+	"copyright",
+	"legal",
+	"licence",
+	"license",
+	"notice",
+	"patents",
+	"unlicense",
+}
+
+// IsLegalFile reports whether the file name holds a license or other legal
+// notice, which must be kept when the project is redistributed. Names are
+// matched whatever their case, and with any extension or qualifier, as in
+// LICENSE.md, COPYING.LESSER, LICENSE-MIT or MIT-LICENSE.txt. Go files never
+// are legal files, as keeping one would keep its package.
+func IsLegalFile(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".go") {
+		return false
+	}
+	stem := strings.TrimSuffix(lower, pathpkg.Ext(lower))
+	for _, ln := range legalFileNames {
+		switch {
+		case lower == ln,
+			strings.HasPrefix(lower, ln+"."), strings.HasPrefix(lower, ln+"-"), strings.HasPrefix(lower, ln+"_"),
+			strings.HasSuffix(stem, "-"+ln), strings.HasSuffix(stem, "_"+ln):
+			return true
+		}
+	}
+	return false
+}
+
+func isNonGoFile(info os.FileInfo) bool {
+	return !strings.HasSuffix(info.Name(), ".go")
+}
+
+func isGoTestFile(info os.FileInfo) bool {
+	return strings.HasSuffix(info.Name(), "_test.go")
+}
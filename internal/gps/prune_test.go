@@ -0,0 +1,331 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang/dep/internal/fs"
+)
+
+func TestPruneOptionsString(t *testing.T) {
+	cases := map[PruneOptions]string{
+		0:                                      "",
+		PruneUnusedPackages:                    "U",
+		PruneNonGoFiles | PruneGoTestFiles:     "NT",
+		PruneUnusedPackages | PruneGoTestFiles: "TU",
+		PruneUnusedPackages | PruneNonGoFiles | PruneGoTestFiles: "NTU",
+	}
+	for o, want := range cases {
+		if got := o.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", o, got, want)
+		}
+		parsed, err := ParsePruneOptions(want)
+		if err != nil {
+			t.Errorf("ParsePruneOptions(%q) failed: %s", want, err)
+		} else if parsed != o {
+			t.Errorf("ParsePruneOptions(%q) = %d, want %d", want, parsed, o)
+		}
+	}
+
+	if _, err := ParsePruneOptions("NX"); err == nil {
+		t.Error("ParsePruneOptions should have failed on an unknown option")
+	}
+}
+
+func TestCascadingPruneOptions(t *testing.T) {
+	o := CascadingPruneOptions{
+		DefaultOptions: PruneUnusedPackages | PruneGoTestFiles,
+		PerProjectOptions: map[ProjectRoot]PruneOptionSet{
+			"github.com/foo/bar": {
+				Overridden: PruneUnusedPackages | PruneNonGoFiles,
+				Options:    PruneNonGoFiles,
+			},
+		},
+	}
+
+	if got, want := o.PruneOptionsFor("github.com/foo/baz"), o.DefaultOptions; got != want {
+		t.Errorf("Unexpected options for a project without overrides: %q, want %q", got, want)
+	}
+	if got, want := o.PruneOptionsFor("github.com/foo/bar"), PruneNonGoFiles|PruneGoTestFiles; got != want {
+		t.Errorf("Unexpected options for a project with overrides: %q, want %q", got, want)
+	}
+}
+
+func TestPruneProject(t *testing.T) {
+	cases := []struct {
+		options PruneOptions
+		pkgs    []string
+		want    []string
+	}{
+		{
+			options: PruneUnusedPackages,
+			pkgs:    []string{".", "used"},
+			want: []string{
+				"LICENSE",
+				"a.go",
+				"a_test.go",
+				"used/README.md",
+				"used/used.go",
+			},
+		},
+		{
+			// The legal files at the root are kept, even if it's unused.
+			options: PruneUnusedPackages,
+			pkgs:    []string{"used"},
+			want: []string{
+				"LICENSE",
+				"used/README.md",
+				"used/used.go",
+			},
+		},
+		{
+			options: PruneNonGoFiles | PruneGoTestFiles,
+			pkgs:    []string{".", "used"},
+			want: []string{
+				"LICENSE",
+				"a.go",
+				"unused/deep/deep.go",
+				"unused/unused.go",
+				"used/used.go",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "gps-prune")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, f := range []string{
+			"LICENSE",
+			"a.go",
+			"a_test.go",
+			"unused/unused.go",
+			"unused/deep/deep.go",
+			"used/README.md",
+			"used/used.go",
+		} {
+			path := filepath.Join(dir, filepath.FromSlash(f))
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte("package x\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		lp := NewLockedProject(pi("github.com/foo/bar"), Revision("rev"), c.pkgs)
+		if err := PruneProject(dir, lp, c.options, nil); err != nil {
+			t.Fatalf("PruneProject with %q failed: %s", c.options, err)
+		}
+
+		var got []string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				rel, _ := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Unexpected files left by PruneProject with %q:\n\t(GOT): %v\n\t(WNT): %v", c.options, got, c.want)
+		}
+		if c.options&PruneUnusedPackages != 0 {
+			if _, err := os.Stat(filepath.Join(dir, "unused")); !os.IsNotExist(err) {
+				t.Errorf("Empty dirs should have been removed by PruneProject with %q", c.options)
+			}
+		}
+	}
+}
+
+func TestPruneProjectLinked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gps-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The project's files are hard links to those of a source in the cache,
+	// which pruning mustn't touch.
+	cache, proj := filepath.Join(dir, "cache"), filepath.Join(dir, "proj")
+	for _, f := range []string{"a.go", "a_test.go", "README.md"} {
+		path := filepath.Join(cache, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("package x\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.CopyDirLinked(cache, proj, fs.LinkFiles); err != nil {
+		t.Fatal(err)
+	}
+
+	lp := NewLockedProject(pi("github.com/foo/bar"), Revision("rev"), []string{"."})
+	if err := PruneProject(proj, lp, PruneNonGoFiles|PruneGoTestFiles, nil); err != nil {
+		t.Fatalf("PruneProject failed: %s", err)
+	}
+	for _, f := range []string{"a_test.go", "README.md"} {
+		if _, err := os.Stat(filepath.Join(proj, f)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be pruned", f)
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(cache, f)); err != nil || string(b) != "package x\n" {
+			t.Errorf("Expected the file %s links to in the cache to be left as it was, got %q (%v)", f, b, err)
+		}
+	}
+}
+
+func TestCalculatePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gps-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for f, contents := range map[string]string{
+		"a.go":                "package a\n",
+		"a_test.go":           "package a\n",
+		"docs/guide/index.md": "# Guide\n",
+		"sub/sub_test.go":     "package sub\n",
+		"sub/testdata/in.txt": "in\n",
+		"sub/sub.go":          "package sub\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	lp := NewLockedProject(pi("github.com/foo/bar"), Revision("rev"), []string{".", "sub"})
+	got, err := CalculatePrune(dir, lp, PruneNonGoFiles|PruneGoTestFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PruneResult{
+		Files: []string{"a_test.go", "docs/guide/index.md", "sub/sub_test.go", "sub/testdata/in.txt"},
+		Dirs:  []string{"docs", "docs/guide", "empty", "sub/testdata"},
+		Bytes: int64(len("package a\n") + len("# Guide\n") + len("package sub\n") + len("in\n")),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected prune calculated:\n\t(GOT): %+v\n\t(WNT): %+v", got, want)
+	}
+
+	// Nothing is removed by calculating the prune.
+	if _, err := os.Stat(filepath.Join(dir, "docs", "guide", "index.md")); err != nil {
+		t.Errorf("CalculatePrune should not have removed anything: %s", err)
+	}
+}
+
+func TestIsLegalFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"LICENSE":            true,
+		"license.md":         true,
+		"LICENCE.txt":        true,
+		"LICENSE-MIT":        true,
+		"MIT-LICENSE.txt":    true,
+		"COPYING":            true,
+		"COPYING.LESSER":     true,
+		"NOTICE":             true,
+		"Patents":            true,
+		"UNLICENSE":          true,
+		"COPYRIGHT":          true,
+		"license.go":         false,
+		"licenses_test.go":   false,
+		"README.md":          false,
+		"licensing.md":       false,
+		"noticeboard.txt":    false,
+		"unlicensed_file.md": false,
+	} {
+		if got := IsLegalFile(name); got != want {
+			t.Errorf("IsLegalFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPruneProjectKeepsLegalFiles(t *testing.T) {
+	cases := []struct {
+		options PruneOptions
+		want    []string
+	}{
+		{
+			// The legal files of unused packages are kept, in their dirs.
+			options: PruneUnusedPackages,
+			want: []string{
+				"LICENSE",
+				"NOTICE.md",
+				"unused/COPYING.LESSER",
+				"unused/deep/patents",
+				"used/LICENSE-APACHE.txt",
+				"used/used.go",
+				"used/used_test.go",
+			},
+		},
+		{
+			options: PruneNonGoFiles | PruneGoTestFiles,
+			want: []string{
+				"LICENSE",
+				"NOTICE.md",
+				"legal.go",
+				"unused/COPYING.LESSER",
+				"unused/deep/deep.go",
+				"unused/deep/patents",
+				"unused/unused.go",
+				"used/LICENSE-APACHE.txt",
+				"used/used.go",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "gps-prune")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		base := filepath.Join(dir, "legal")
+		if err := fs.CopyDir(filepath.Join("_testdata", "prune", "legal"), base); err != nil {
+			t.Fatal(err)
+		}
+
+		lp := NewLockedProject(pi("github.com/foo/legal"), Revision("rev"), []string{"used"})
+		if err := PruneProject(base, lp, c.options, nil); err != nil {
+			t.Fatalf("PruneProject with %q failed: %s", c.options, err)
+		}
+
+		var got []string
+		filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				rel, _ := filepath.Rel(base, path)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Unexpected files left by PruneProject with %q:\n\t(GOT): %v\n\t(WNT): %v", c.options, got, c.want)
+		}
+	}
+}
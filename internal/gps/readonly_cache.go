@@ -0,0 +1,106 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// readOnlyCache is the cache dir of other SourceMgrs, such as one kept warm
+// for a team on a shared filesystem, which a SourceMgr only reads: sources
+// which aren't in its own cache dir are copied from there, if they're there,
+// rather than fetched. Nothing is locked or written there, so it's not to be
+// changed while it's read.
+type readOnlyCache struct {
+	dir  string
+	warn *log.Logger // Told of sources which couldn't be copied
+}
+
+// copySource copies the copy of src in the read-only cache, if there is one,
+// to the same place in the cache dir, reporting whether it did. Failing to read
+// it, for want of permission or otherwise, isn't fatal: it's warned of, and
+// anything copied is removed, for src to be fetched after all.
+func (rc *readOnlyCache) copySource(src source) bool {
+	cs, ok := src.(interface {
+		cachePath() string
+	})
+	if rc == nil || !ok {
+		return false
+	}
+	to := cs.cachePath()
+	from := filepath.Join(rc.dir, "sources", filepath.Base(to))
+
+	fi, err := os.Stat(from)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			rc.warn.Printf("unable to read %s from the read-only cache, so fetching it: %s", filepath.Base(to), err)
+		}
+		return false
+	}
+	if !fi.IsDir() {
+		return false
+	}
+
+	// It's copied beside where it goes, and moved there once it's whole.
+	tmp := to + ".copying"
+	os.RemoveAll(tmp)
+	if err = copyTree(from, tmp); err == nil {
+		os.RemoveAll(to)
+		err = os.Rename(tmp, to)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		rc.warn.Printf("unable to copy %s from the read-only cache, so fetching it: %s", filepath.Base(to), err)
+		return false
+	}
+	return true
+}
+
+// copyTree copies the dir from to the dir to, which mustn't exist. Unlike
+// fs.CopyDir, it leaves everything copied writable by its owner, as what's
+// read-only in the read-only cache isn't to be in the cache dir.
+func copyTree(from, to string) error {
+	return filepath.Walk(from, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(to, rel)
+
+		switch {
+		case fi.IsDir():
+			return os.Mkdir(dst, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dst)
+		case !fi.Mode().IsRegular():
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm()|0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, in)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
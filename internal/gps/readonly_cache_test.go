@@ -0,0 +1,170 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mkTeamCache makes a cache dir with the source of id in it, as a SourceMgr
+// using it would have left it.
+func mkTeamCache(t *testing.T, id ProjectIdentifier) string {
+	team, err := ioutil.TempDir("", "teamcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewSourceManager(team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+	if err = sm.SyncSourceFor(id); err != nil {
+		t.Fatalf("Failed to fetch %s to the team cache: %s", id.Source, err)
+	}
+	return team
+}
+
+// hasCommit reports whether the git repository at dir has the revision r.
+func hasCommit(dir string, r Revision) bool {
+	return exec.Command("git", "-C", dir, "cat-file", "-e", string(r)+"^{commit}").Run() == nil
+}
+
+func TestReadOnlyCache(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, revs := mkGitHistory(t, 2, 64)
+	defer os.RemoveAll(dir)
+	u := "file://" + filepath.ToSlash(dir)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: u}
+	team := mkTeamCache(t, id)
+	defer os.RemoveAll(team)
+
+	// A commit made since the team cache was warmed is only upstream.
+	cmd := exec.Command("git", "-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "--allow-empty", "-m", "Later")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to commit: %s\n%s", err, out)
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := Revision(strings.TrimSpace(string(out)))
+
+	own, err := ioutil.TempDir("", "owncache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(own)
+	exportdir, err := ioutil.TempDir("", "readonlyexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(exportdir)
+
+	sm, err := NewSourceManager(own)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+	sm.UseReadOnlyCache(team)
+
+	// A revision in the team cache is exported from a copy of it there, which
+	// lacks the later commit, as a clone wouldn't.
+	if err = sm.ExportProject(id, revs[0], filepath.Join(exportdir, "0")); err != nil {
+		t.Fatalf("Unexpected error exporting %s: %s", revs[0], err)
+	}
+	checkExportedCommit(t, filepath.Join(exportdir, "0"), 0)
+	copied := sourceCachePath(own, u)
+	if !hasCommit(copied, revs[1]) {
+		t.Fatal("Expected the source to be copied from the team cache")
+	}
+	if hasCommit(copied, later) {
+		t.Fatal("Expected the source to be copied from the team cache, rather than fetched")
+	}
+
+	// The copy is updated for a revision which the team cache lacks, and the
+	// team cache is left as it was.
+	if err = sm.ExportProject(id, later, filepath.Join(exportdir, "later")); err != nil {
+		t.Fatalf("Unexpected error exporting %s: %s", later, err)
+	}
+	if !hasCommit(copied, later) {
+		t.Error("Expected the copy of the source to be updated")
+	}
+	if hasCommit(sourceCachePath(team, u), later) {
+		t.Error("Expected the team cache not to be updated")
+	}
+}
+
+func TestReadOnlyCacheUnreadable(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, revs := mkGitHistory(t, 2, 64)
+	defer os.RemoveAll(dir)
+	u := "file://" + filepath.ToSlash(dir)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: u}
+
+	cases := []struct {
+		name  string
+		setup func(team string) bool
+	}{
+		{"not permitted", func(team string) bool {
+			if os.Geteuid() == 0 {
+				// Permissions aren't enforced for root.
+				return false
+			}
+			return os.Chmod(filepath.Join(team, "sources"), 0) == nil
+		}},
+		{"not a dir", func(team string) bool {
+			if err := os.RemoveAll(filepath.Join(team, "sources")); err != nil {
+				return false
+			}
+			return ioutil.WriteFile(filepath.Join(team, "sources"), nil, 0666) == nil
+		}},
+	}
+
+	for _, c := range cases {
+		team := mkTeamCache(t, id)
+		defer os.RemoveAll(team)
+		if !c.setup(team) {
+			t.Logf("%s: skipping, as the team cache can't be made unreadable so", c.name)
+			continue
+		}
+		// Let it be removed once done.
+		defer os.Chmod(filepath.Join(team, "sources"), 0777)
+
+		own, err := ioutil.TempDir("", "owncache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(own)
+		sm, err := NewSourceManager(own)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sm.UseReadOnlyCache(team)
+		var warned bytes.Buffer
+		sm.suprvsr.readOnly.warn = log.New(&warned, "", 0)
+
+		// The source is fetched instead, with a warning.
+		if _, err = sm.ListPackages(id, revs[1]); err != nil {
+			t.Errorf("%s: unexpected error listing the packages of %s: %s", c.name, revs[1], err)
+		}
+		sm.Release()
+		if !hasCommit(sourceCachePath(own, u), revs[1]) {
+			t.Errorf("%s: expected the source to be fetched", c.name)
+		}
+		if !strings.Contains(warned.String(), "unable to read") {
+			t.Errorf("%s: expected a warning that the team cache couldn't be read, got %q", c.name, warned.String())
+		}
+	}
+}
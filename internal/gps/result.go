@@ -8,6 +8,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // A Solution is returned by a solver run. It is mostly just a Lock, with some
@@ -50,8 +54,56 @@ type solution struct {
 //
 // It requires a SourceManager to do the work, and takes a flag indicating
 // whether or not to strip vendor directories contained in the exported
-// dependencies.
+// dependencies. Projects are exported concurrently, as many at once as there
+// are CPUs; see WriteDepTreeWithOptions for more control.
 func WriteDepTree(basedir string, l Lock, sm SourceManager, sv bool) error {
+	return WriteDepTreeWithOptions(basedir, l, sm, WriteDepTreeOptions{StripVendor: sv})
+}
+
+// WriteDepTreeOptions control how WriteDepTreeWithOptions exports projects.
+type WriteDepTreeOptions struct {
+	// StripVendor indicates whether to strip vendor directories contained in
+	// the exported dependencies.
+	StripVendor bool
+
+	// Workers is the number of projects exported at once. If it's less than
+	// one, it's the number of CPUs. The SourceManager serializes exports from
+	// the same source, so only distinct sources are exported concurrently.
+	Workers int
+
+	// PruneOptions, if set, returns the options to prune each project with
+	// once it's exported; see PruneProject.
+	PruneOptions func(ProjectRoot) PruneOptions
+
+	// Export, if set, is called to export each project, e.g. so that its
+	// export can be timed and reported. It must call export and return its
+	// error. It's called concurrently by up to Workers goroutines.
+	Export func(lp LockedProject, export func() error) error
+}
+
+// ExportErrs maps the roots of projects which could not be exported by
+// WriteDepTreeWithOptions to the errors they failed with.
+type ExportErrs map[ProjectRoot]error
+
+func (e ExportErrs) Error() string {
+	roots := make([]string, 0, len(e))
+	for pr := range e {
+		roots = append(roots, string(pr))
+	}
+	sort.Strings(roots)
+
+	msgs := make([]string, len(roots))
+	for i, pr := range roots {
+		msgs[i] = fmt.Sprintf("error while exporting %s: %s", pr, e[ProjectRoot(pr)])
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// WriteDepTreeWithOptions is WriteDepTree, with the exports controlled by
+// opts. If any project fails to export, no more exports are started, basedir
+// is removed once those already underway are done, and an ExportErrs is
+// returned.
+func WriteDepTreeWithOptions(basedir string, l Lock, sm SourceManager, opts WriteDepTreeOptions) error {
 	if l == nil {
 		return fmt.Errorf("must provide non-nil Lock to WriteDepTree")
 	}
@@ -61,20 +113,68 @@ func WriteDepTree(basedir string, l Lock, sm SourceManager, sv bool) error {
 		return err
 	}
 
-	// TODO(sdboyer) parallelize
-	for _, p := range l.Projects() {
-		to := filepath.FromSlash(filepath.Join(basedir, string(p.Ident().ProjectRoot)))
+	workers := opts.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
 
-		err = sm.ExportProject(p.Ident(), p.Version(), to)
-		if err != nil {
-			removeAll(basedir)
-			return fmt.Errorf("error while exporting %s: %s", p.Ident().ProjectRoot, err)
-		}
-		if sv {
-			filepath.Walk(to, stripVendor)
+	var wg sync.WaitGroup
+	exportErrs := make(ExportErrs)
+	var errsMut sync.Mutex
+
+	projects := make(chan LockedProject)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range projects {
+				to := filepath.FromSlash(filepath.Join(basedir, string(p.Ident().ProjectRoot)))
+				export := func() error {
+					if err := sm.ExportProject(p.Ident(), p.Version(), to); err != nil {
+						return err
+					}
+					if opts.StripVendor {
+						filepath.Walk(to, stripVendor)
+					}
+					if opts.PruneOptions != nil {
+						if po := opts.PruneOptions(p.Ident().ProjectRoot); po != 0 {
+							return PruneProject(to, p, po, nil)
+						}
+					}
+					return nil
+				}
+
+				var err error
+				if opts.Export != nil {
+					err = opts.Export(p, export)
+				} else {
+					err = export()
+				}
+				if err != nil {
+					errsMut.Lock()
+					exportErrs[p.Ident().ProjectRoot] = err
+					errsMut.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, p := range l.Projects() {
+		errsMut.Lock()
+		failed := len(exportErrs) > 0
+		errsMut.Unlock()
+		if failed {
+			break
 		}
+		projects <- p
 	}
+	close(projects)
+	wg.Wait()
 
+	if len(exportErrs) > 0 {
+		removeAll(basedir)
+		return exportErrs
+	}
 	return nil
 }
 
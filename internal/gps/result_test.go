@@ -5,11 +5,15 @@
 package gps
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 var basicResult solution
@@ -155,3 +159,140 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 	sm.Release()
 	os.RemoveAll(tmp) // comment this to leave temp dir behind for inspection
 }
+
+// exportSourceManager only exports projects, writing a file to each after a
+// delay which stands in for a slow network filesystem, and keeps track of how
+// many exports run at once.
+type exportSourceManager struct {
+	SourceManager
+	delay time.Duration
+	fail  map[ProjectRoot]bool
+
+	mu                  sync.Mutex
+	running, maxRunning int
+}
+
+func (sm *exportSourceManager) ExportProject(id ProjectIdentifier, v Version, to string) error {
+	sm.mu.Lock()
+	sm.running++
+	if sm.running > sm.maxRunning {
+		sm.maxRunning = sm.running
+	}
+	sm.mu.Unlock()
+	defer func() {
+		sm.mu.Lock()
+		sm.running--
+		sm.mu.Unlock()
+	}()
+
+	time.Sleep(sm.delay)
+	if sm.fail[id.ProjectRoot] {
+		return errors.New("no such revision")
+	}
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(to, "main.go"), []byte("package main\n"), 0666)
+}
+
+func exportTestLock(n int) SimpleLock {
+	l := make(SimpleLock, n)
+	for i := range l {
+		l[i] = NewLockedProject(pi(fmt.Sprintf("github.com/sdboyer/dep%d", i)), NewVersion("v1.0.0").Pair("rev"), nil)
+	}
+	return l
+}
+
+func TestWriteDepTreeWithOptions(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := exportTestLock(8)
+	sm := &exportSourceManager{delay: 5 * time.Millisecond}
+	var mu sync.Mutex
+	reported := make(map[ProjectRoot]bool)
+	opts := WriteDepTreeOptions{
+		Workers: 3,
+		Export: func(lp LockedProject, export func() error) error {
+			mu.Lock()
+			reported[lp.Ident().ProjectRoot] = true
+			mu.Unlock()
+			return export()
+		},
+	}
+	if err := WriteDepTreeWithOptions(filepath.Join(tmp, "vendor"), l, sm, opts); err != nil {
+		t.Fatalf("Unexpected error while creating vendor tree: %s", err)
+	}
+
+	for _, lp := range l {
+		pr := lp.Ident().ProjectRoot
+		if _, err := os.Stat(filepath.Join(tmp, "vendor", filepath.FromSlash(string(pr)), "main.go")); err != nil {
+			t.Errorf("%s was not exported: %s", pr, err)
+		}
+		if !reported[pr] {
+			t.Errorf("%s was not exported through opts.Export", pr)
+		}
+	}
+	if sm.maxRunning < 2 || sm.maxRunning > 3 {
+		t.Errorf("expected 2 or 3 exports to run at once with 3 workers, got %d", sm.maxRunning)
+	}
+}
+
+func TestWriteDepTreeWithOptionsErrors(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// With a worker for each, every project is underway before any fails.
+	l := exportTestLock(4)
+	sm := &exportSourceManager{
+		delay: 10 * time.Millisecond,
+		fail: map[ProjectRoot]bool{
+			"github.com/sdboyer/dep1": true,
+			"github.com/sdboyer/dep3": true,
+		},
+	}
+	basedir := filepath.Join(tmp, "vendor")
+	err = WriteDepTreeWithOptions(basedir, l, sm, WriteDepTreeOptions{Workers: len(l)})
+	errs, ok := err.(ExportErrs)
+	if !ok {
+		t.Fatalf("expected ExportErrs, got %v", err)
+	}
+	want := "error while exporting github.com/sdboyer/dep1: no such revision\n" +
+		"error while exporting github.com/sdboyer/dep3: no such revision"
+	if errs.Error() != want {
+		t.Errorf("unexpected error:\n\t(GOT): %q\n\t(WNT): %q", errs.Error(), want)
+	}
+	if _, err := os.Stat(basedir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed after failing to export", basedir)
+	}
+}
+
+// BenchmarkWriteDepTreeWorkers exports projects which each take a millisecond,
+// as they might on a network filesystem, with increasing numbers of workers.
+func BenchmarkWriteDepTreeWorkers(b *testing.B) {
+	l := exportTestLock(32)
+	sm := &exportSourceManager{delay: time.Millisecond}
+	for _, workers := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			tmp, err := ioutil.TempDir("", "writetree")
+			if err != nil {
+				b.Fatalf("Failed to create temp dir: %s", err)
+			}
+			defer os.RemoveAll(tmp)
+
+			opts := WriteDepTreeOptions{Workers: workers}
+			for i := 0; i < b.N; i++ {
+				exp := filepath.Join(tmp, fmt.Sprint(i))
+				if err := WriteDepTreeWithOptions(exp, l, sm, opts); err != nil {
+					b.Fatalf("unexpected error after %v iterations: %s", i, err)
+				}
+			}
+		})
+	}
+}
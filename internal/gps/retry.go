@@ -0,0 +1,177 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy says how a remote operation of the SourceMgr, such as listing
+// the versions of a source, fetching it, or fetching the go-get metadata of an
+// import path, is tried again after it fails with a transient error: a network
+// timeout, a connection reset, a temporary failure to resolve a host, or a 5xx
+// response.
+// Operations which fail otherwise, such as for want of credentials or because
+// the source doesn't exist, are never tried again.
+type RetryPolicy struct {
+	// Attempts is how many times an operation is tried in all. Less than two
+	// means it's never tried again.
+	Attempts int
+	// Backoff is how long to wait before trying an operation again for the
+	// first time. The wait doubles for each attempt after that, and is
+	// jittered by up to half either way.
+	Backoff time.Duration
+	// Logger, if set, is told of each retry, with its count and the error
+	// which caused it.
+	Logger *log.Logger
+	// Sleep waits for the duration, or until the context is done. It's
+	// time.Sleep, in effect, if nil; tests may set it so as not to wait.
+	Sleep func(context.Context, time.Duration) error
+}
+
+// DefaultRetryPolicy is the RetryPolicy of a SourceMgr unless
+// UseRetryPolicy says otherwise.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: time.Second}
+
+// do calls f, and again as the policy says if it fails transiently, and
+// returns its last error. name names the operation for the Logger.
+func (p RetryPolicy) do(ctx context.Context, name string, f func() error) error {
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = sleepCtx
+	}
+
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.Attempts || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+		if p.Logger != nil {
+			p.Logger.Printf("Retrying %s (attempt %d of %d) in %s after a transient error: %s", name, attempt+1, p.Attempts, wait, firstLine(err))
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// firstLine returns the first line of the message of err, as the output of
+// commands can go on at length.
+func firstLine(err error) string {
+	return strings.SplitN(strings.TrimSpace(err.Error()), "\n", 2)[0]
+}
+
+// httpStatusError is a response to a request for go-get metadata with a status
+// which shows the server failed.
+type httpStatusError struct {
+	url  string
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("request for URL %q failed with status %d", e.url, e.code)
+}
+
+// permanentErrorHints are parts of the output of commands which fail for want
+// of credentials or because the source doesn't exist, which retrying won't
+// fix, even if they look transient otherwise.
+var permanentErrorHints = []string{
+	"authentication failed",
+	"could not read username",
+	"could not read password",
+	"terminal prompts disabled",
+	"permission denied",
+	"access denied",
+	"repository not found",
+	"not found",
+	"does not exist",
+	"returned error: 401",
+	"returned error: 403",
+	"returned error: 404",
+}
+
+// transientErrorHints are parts of the output of commands which fail for
+// reasons which may well be gone on the next attempt. A host which can't be
+// resolved at all isn't among them, as git can't tell that from a host which
+// doesn't exist; only a temporary failure to resolve it is.
+var transientErrorHints = []string{
+	"connection reset",
+	"timed out",
+	"temporary failure in name resolution",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"returned error: 5",
+	"http 5",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+	"tls handshake timeout",
+	"gnutls_handshake() failed",
+}
+
+// isTransient reports whether err, from a remote operation, is one which a
+// retry might not fail with.
+func isTransient(err error) bool {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+
+	cause := errors.Cause(err)
+	switch terr := cause.(type) {
+	case *noProgressError:
+		// The command stalled.
+		return true
+	case *httpStatusError:
+		return terr.code >= 500
+	case net.Error:
+		if terr.Timeout() || terr.Temporary() {
+			return true
+		}
+	}
+
+	msg := err.Error()
+	if verr, ok := cause.(interface {
+		Out() string
+	}); ok {
+		// The output of the command, from a *vcs.RemoteError.
+		msg += "\n" + verr.Out()
+	}
+	msg = strings.ToLower(msg)
+	for _, hint := range permanentErrorHints {
+		if strings.Contains(msg, hint) {
+			return false
+		}
+	}
+	for _, hint := range transientErrorHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
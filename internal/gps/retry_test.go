@@ -0,0 +1,197 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/vcs"
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{&noProgressError{time.Minute}, true},
+		{&httpStatusError{url: "https://example.com/pkg?go-get=1", code: 502}, true},
+		{&httpStatusError{url: "https://example.com/pkg?go-get=1", code: 503}, true},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: timeoutError{}}}, true},
+		{pkgerrors.Wrap(&url.Error{Op: "Get", URL: "https://example.com", Err: timeoutError{}}, "unable to read metadata"), true},
+		{&net.DNSError{Err: "no such host", Name: "example.com"}, false},
+		{vcs.NewRemoteError("unable to get repository", errors.New("exit status 128"), "fatal: unable to access 'https://example.com/repo.git/': Could not resolve host: example.com"), false},
+		{vcs.NewRemoteError("unable to get repository", errors.New("exit status 128"), "ssh: Could not resolve hostname example.com: Temporary failure in name resolution\nfatal: Could not read from remote repository."), true},
+		{vcs.NewRemoteError("unable to update repository", errors.New("exit status 128"), "read: connection reset by peer\nfatal: the remote end hung up unexpectedly"), true},
+		{vcs.NewRemoteError("unable to list versions", errors.New("exit status 128"), "fatal: unable to access 'https://example.com/repo.git/': The requested URL returned error: 502"), true},
+		{vcs.NewRemoteError("unable to list versions", errors.New("exit status 128"), "fatal: Authentication failed for 'https://example.com/repo.git/'"), false},
+		{vcs.NewRemoteError("unable to list versions", errors.New("exit status 128"), "fatal: could not read Username for 'https://example.com': terminal prompts disabled"), false},
+		{vcs.NewRemoteError("unable to list versions", errors.New("exit status 128"), "remote: Repository not found.\nfatal: repository 'https://example.com/repo.git/' not found"), false},
+		{vcs.NewRemoteError("unable to get repository", errors.New("exit status 128"), "Permission denied (publickey).\nfatal: the remote end hung up unexpectedly"), false},
+		{errors.New("remote repository at https://example.com/repo does not exist, or is inaccessible"), false},
+		{errors.New("exit status 1"), false},
+	}
+	for _, c := range cases {
+		if got := isTransient(c.err); got != c.want {
+			t.Errorf("Expected isTransient(%v) to be %t, got %t", c.err, c.want, got)
+		}
+	}
+}
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryPolicy(t *testing.T) {
+	var slept []time.Duration
+	var logged bytes.Buffer
+	p := RetryPolicy{
+		Attempts: 3,
+		Backoff:  time.Second,
+		Logger:   log.New(&logged, "", 0),
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		},
+	}
+	transient := &httpStatusError{url: "https://example.com/pkg?go-get=1", code: 502}
+
+	// Fails transiently every time, so it's tried as often as allowed, with
+	// the wait doubling, give or take half.
+	var calls int
+	err := p.do(context.Background(), "example.com/pkg", func() error {
+		calls++
+		return transient
+	})
+	if err != transient || calls != 3 {
+		t.Fatalf("Expected 3 calls ending in the transient error, got %d, %v", calls, err)
+	}
+	if len(slept) != 2 {
+		t.Fatalf("Expected 2 waits, got %v", slept)
+	}
+	for i, d := range slept {
+		base := time.Second << uint(i)
+		if d < base/2 || d > base*3/2 {
+			t.Errorf("Expected wait %d to be within half of %s, got %s", i+1, base, d)
+		}
+	}
+	for _, want := range []string{"Retrying example.com/pkg (attempt 2 of 3)", "Retrying example.com/pkg (attempt 3 of 3)", "status 502"} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("Expected the log to contain %q, got:\n%s", want, logged.String())
+		}
+	}
+
+	// Succeeds on the second attempt.
+	calls, slept = 0, nil
+	err = p.do(context.Background(), "example.com/pkg", func() error {
+		calls++
+		if calls == 1 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || calls != 2 || len(slept) != 1 {
+		t.Errorf("Expected success on the second call after one wait, got %d calls, %d waits, %v", calls, len(slept), err)
+	}
+
+	// A permanent failure isn't retried.
+	calls, slept = 0, nil
+	permanent := errors.New("fatal: repository 'https://example.com/repo.git/' not found")
+	if err = p.do(context.Background(), "example.com/repo", func() error {
+		calls++
+		return permanent
+	}); err != permanent || calls != 1 || len(slept) != 0 {
+		t.Errorf("Expected one call for a permanent error, got %d calls, %d waits, %v", calls, len(slept), err)
+	}
+
+	// Nor is anything once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err = p.do(ctx, "example.com/pkg", func() error {
+		calls++
+		return transient
+	}); calls != 1 {
+		t.Errorf("Expected one call with the context done, got %d", calls)
+	}
+
+	// A policy of one attempt never retries.
+	calls = 0
+	p.Attempts = 1
+	p.do(context.Background(), "example.com/pkg", func() error {
+		calls++
+		return transient
+	})
+	if calls != 1 {
+		t.Errorf("Expected one call with a single attempt, got %d", calls)
+	}
+}
+
+// TestDeduceRetries fetches the go-get metadata of an import path from a
+// server which fails with a 502 the first time.
+func TestDeduceRetries(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			// https is tried first, and refused.
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `<meta name="go-import" content="example.com/flaky git https://git.example.com/flaky">`)
+	}))
+	defer srv.Close()
+	proxy, _ := url.Parse(srv.URL)
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	var logged bytes.Buffer
+	var slept int
+	sm.UseRetryPolicy(RetryPolicy{
+		Attempts: 3,
+		Backoff:  time.Second,
+		Logger:   log.New(&logged, "", 0),
+		Sleep: func(context.Context, time.Duration) error {
+			slept++
+			return nil
+		},
+	})
+	sm.deduceCoord.client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}
+
+	root, err := sm.DeduceProjectRoot("example.com/flaky/pkg")
+	if err != nil {
+		t.Fatalf("Unexpected error deducing the root: %s", err)
+	}
+	if root != "example.com/flaky" {
+		t.Errorf("Expected the root example.com/flaky, got %q", root)
+	}
+	if requests != 2 || slept != 1 {
+		t.Errorf("Expected the metadata to be fetched twice, with one wait, got %d requests and %d waits", requests, slept)
+	}
+	if !strings.Contains(logged.String(), "Retrying example.com/flaky/pkg (attempt 2 of 3)") {
+		t.Errorf("Expected the retry to be logged, got %q", logged.String())
+	}
+}
@@ -48,13 +48,32 @@ type rootdata struct {
 
 	// The ProjectAnalyzer to use for all GetManifestAndLock calls.
 	an ProjectAnalyzer
+
+	// The mirrors that the sources of all projects are subject to.
+	mirrors SourceMirrors
+
+	// Whether the oldest versions of projects are preferred, rather than the
+	// newest.
+	down bool
+
+	// Whether the imports of the root's test files are left out.
+	notests bool
+
+	// The platforms and build tags for which the imports of all packages are
+	// followed.
+	build pkgtree.BuildMatrix
+
+	// The dirs left out of the root's package tree, and those beneath them
+	// kept in it all the same.
+	exclude, include []string
 }
 
 // externalImportList returns a list of the unique imports from the root data.
-// Ignores and requires are taken into consideration, stdlib is excluded, and
-// errors within the local set of package are not backpropagated.
+// Ignores and requires are taken into consideration, stdlib is excluded, as
+// are the imports of test files if notests is set, and errors within the local
+// set of package are not backpropagated.
 func (rd rootdata) externalImportList(stdLibFn func(string) bool) []string {
-	rm, _ := rd.rpt.ToReachMap(true, true, false, rd.ig)
+	rm, _ := rd.rpt.ToReachMap(true, !rd.notests, false, rd.ig)
 	reach := rm.FlattenFn(stdLibFn)
 
 	// If there are any requires, slide them into the reach list, as well.
@@ -99,7 +118,7 @@ func (rd rootdata) getApplicableConstraints(stdLibFn func(string) bool) []workin
 	}
 
 	// Now override them all to produce a consolidated workingConstraint slice
-	combined := rd.ovr.overrideAll(pc)
+	combined := rd.mirrorAll(rd.ovr.overrideAll(pc))
 
 	type wccount struct {
 		count int
@@ -137,8 +156,30 @@ func (rd rootdata) getApplicableConstraints(stdLibFn func(string) bool) []workin
 	return ret
 }
 
+// allowsPrereleases indicates if the root manifest opted the project into
+// considering prerelease versions, through its override or else its
+// constraint.
+func (rd rootdata) allowsPrereleases(pr ProjectRoot) bool {
+	if pp, has := rd.ovr[pr]; has && pp.Constraint != nil {
+		return AllowsPrereleases(pp.Constraint)
+	}
+	return AllowsPrereleases(rd.rm.Deps[pr].Constraint)
+}
+
 func (rd rootdata) combineConstraints() []workingConstraint {
-	return rd.ovr.overrideAll(rd.rm.DependencyConstraints())
+	return rd.mirrorAll(rd.ovr.overrideAll(rd.rm.DependencyConstraints()))
+}
+
+// mirrorAll applies the root's source mirrors to the identifiers of each of the
+// provided workingConstraints, in place.
+func (rd rootdata) mirrorAll(wcs []workingConstraint) []workingConstraint {
+	if len(rd.mirrors) == 0 {
+		return wcs
+	}
+	for k, wc := range wcs {
+		wcs[k].Ident = rd.mirrors.Apply(wc.Ident)
+	}
+	return wcs
 }
 
 // needVersionListFor indicates whether we need a version list for a given
@@ -191,7 +232,7 @@ func (rd rootdata) rootAtom() atomWithPackages {
 
 	list := make([]string, 0, len(rd.rpt.Packages))
 	for path, pkg := range rd.rpt.Packages {
-		if pkg.Err != nil && !rd.ig[path] {
+		if pkg.Err != nil && !pkgtree.IsIgnored(path, rd.ig) {
 			list = append(list, path)
 		}
 	}
@@ -22,7 +22,7 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 	var err error
 	defer func() {
 		if err != nil {
-			s.traceInfo(err)
+			s.traceReject(a, err)
 		}
 		s.mtr.pop()
 	}()
@@ -33,6 +33,9 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 		if err = s.checkAtomAllowable(pa); err != nil {
 			return err
 		}
+		if err = s.checkRootCaseConflicts(a); err != nil {
+			return err
+		}
 	}
 
 	if err = s.checkRequiredPackagesExist(a); err != nil {
@@ -95,11 +98,38 @@ func (s *solver) checkAtomAllowable(pa atom) error {
 		goal:       pa,
 		failparent: failparent,
 		c:          constraint,
+		chains:     s.sel.chainsTo(failparent...),
 	}
 
 	return err
 }
 
+// checkRootCaseConflicts ensures that the root of the atom doesn't differ only
+// in case from that of a project which is already depended on, as the two
+// would collide on case-insensitive filesystems, such as in vendor/.
+func (s *solver) checkRootCaseConflicts(a atomWithPackages) error {
+	cur, has := s.sel.getCaseVariant(a.a.id.ProjectRoot)
+	if !has {
+		return nil
+	}
+
+	goalsel := s.sel.getDependenciesOn(a.a.id)
+	cursel := s.sel.getDependenciesOn(ProjectIdentifier{ProjectRoot: cur})
+	// Fail all the dependers of either, as no version of the atom can be
+	// selected alongside the current root.
+	for _, d := range append(goalsel, cursel...) {
+		s.fail(d.depender.id)
+	}
+
+	return &caseMismatchFailure{
+		goal:    a.a,
+		current: cur,
+		goalsel: goalsel,
+		cursel:  cursel,
+		chains:  s.sel.chainsTo(append(goalsel, cursel...)...),
+	}
+}
+
 // checkRequiredPackagesExist ensures that all required packages enumerated by
 // existing dependencies on this atom are actually present in the atom.
 func (s *solver) checkRequiredPackagesExist(a atomWithPackages) error {
@@ -164,11 +194,13 @@ func (s *solver) checkDepsConstraintsAllowable(a atomWithPackages, cdep complete
 		}
 	}
 
+	goal := dependency{depender: a.a, dep: cdep}
 	return &disjointConstraintFailure{
-		goal:      dependency{depender: a.a, dep: cdep},
+		goal:      goal,
 		failsib:   failsib,
 		nofailsib: nofailsib,
 		c:         constraint,
+		chains:    s.sel.chainsTo(append([]dependency{goal}, siblings...)...),
 	}
 }
 
@@ -181,9 +213,13 @@ func (s *solver) checkDepsDisallowsSelected(a atomWithPackages, cdep completeDep
 	if exists && !s.vUnify.matches(dep.Ident, dep.Constraint, selected.a.v) {
 		s.fail(dep.Ident)
 
+		goal := dependency{depender: a.a, dep: cdep}
+		sel := append([]dependency(nil), s.sel.getDependenciesOn(dep.Ident)...)
 		return &constraintNotAllowedFailure{
-			goal: dependency{depender: a.a, dep: cdep},
-			v:    selected.a.v,
+			goal:   goal,
+			v:      selected.a.v,
+			sel:    sel,
+			chains: s.sel.chainsTo(append([]dependency{goal}, sel...)...),
 		}
 	}
 	return nil
@@ -4,6 +4,8 @@
 
 package gps
 
+import "strings"
+
 type selection struct {
 	projects []selected
 	deps     map[ProjectRoot][]dependency
@@ -23,6 +25,22 @@ func (s *selection) getDependenciesOn(id ProjectIdentifier) []dependency {
 	return nil
 }
 
+// getCaseVariant returns the project root which is depended on in the
+// selection and differs from pr only in case, if there is one. Should there be
+// several, the first of them in order is returned.
+func (s *selection) getCaseVariant(pr ProjectRoot) (ProjectRoot, bool) {
+	var variant ProjectRoot
+	for dpr, deps := range s.deps {
+		if len(deps) == 0 || dpr == pr || !strings.EqualFold(string(dpr), string(pr)) {
+			continue
+		}
+		if variant == "" || dpr < variant {
+			variant = dpr
+		}
+	}
+	return variant, variant != ""
+}
+
 // getIdentFor returns the ProjectIdentifier (so, the network name) currently in
 // use for the provided ProjectRoot.
 //
@@ -69,6 +87,39 @@ func (s *selection) popDep(id ProjectIdentifier) (dep dependency) {
 	return dep
 }
 
+// chainsTo returns the chains by which the dependers of deps came to be in the
+// depgraph.
+func (s *selection) chainsTo(deps ...dependency) depChains {
+	dc := make(depChains)
+	for _, dep := range deps {
+		dc[dep.depender.id.ProjectRoot] = s.chainTo(dep.depender)
+	}
+	return dc
+}
+
+// chainTo returns the chain by which the project of a came to be in the
+// depgraph: the root, and then each project which depended on the next, up to
+// but not including a. Each project is followed back through its first
+// dependency, being the one which introduced it.
+func (s *selection) chainTo(a atom) []atom {
+	var chain []atom
+	seen := map[ProjectRoot]bool{a.id.ProjectRoot: true}
+	for a.v != rootRev {
+		deps := s.deps[a.id.ProjectRoot]
+		if len(deps) == 0 || seen[deps[0].depender.id.ProjectRoot] {
+			break
+		}
+		a = deps[0].depender
+		seen[a.id.ProjectRoot] = true
+		chain = append(chain, a)
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
 func (s *selection) depperCount(id ProjectIdentifier) int {
 	return len(s.deps[id.ProjectRoot])
 }
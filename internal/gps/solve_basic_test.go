@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/golang/dep/internal/gps/pkgtree"
@@ -399,6 +400,10 @@ type basicFixture struct {
 	changeall bool
 	// individual projects to change
 	changelist []ProjectRoot
+	// projects the root's constraints opt into prereleases
+	pre []ProjectRoot
+	// source mirrors, if any
+	mirrors SourceMirrors
 }
 
 func (f basicFixture) name() string {
@@ -418,8 +423,14 @@ func (f basicFixture) solution() map[ProjectIdentifier]LockedProject {
 }
 
 func (f basicFixture) rootmanifest() RootManifest {
+	c := pcSliceToMap(f.ds[0].deps)
+	for _, pr := range f.pre {
+		pp := c[pr]
+		pp.Constraint = WithPrereleases(pp.Constraint)
+		c[pr] = pp
+	}
 	return simpleRootManifest{
-		c:   pcSliceToMap(f.ds[0].deps),
+		c:   c,
 		ovr: f.ovr,
 	}
 }
@@ -496,6 +507,123 @@ var basicFixtures = map[string]basicFixture{
 			"shared 3.6.9",
 		),
 	},
+	"shared dependency constrained to a union of ranges": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0", "b 1.0.0", "c 1.0.0"),
+			mkDepspec("a 1.0.0", "shared >=1.0.0, <2.0.0 || >=3.0.0"),
+			mkDepspec("b 1.0.0", "shared >=2.0.0"),
+			mkDepspec("c 1.0.0", "shared <4.0.0"),
+			mkDepspec("shared 1.0.0"),
+			mkDepspec("shared 2.0.0"),
+			mkDepspec("shared 2.5.0"),
+			mkDepspec("shared 3.1.0"),
+			mkDepspec("shared 4.0.0"),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.0.0",
+			"c 1.0.0",
+			"shared 3.1.0",
+		),
+	},
+	"downgrade across the gap in a union of ranges": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a >=1.0.0, <2.0.0 || >=3.1.0", "b 1.0.0"),
+			mkDepspec("b 1.0.0", "a <3.0.0"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 2.0.0"),
+			mkDepspec("a 2.1.0"),
+			mkDepspec("a 3.0.0"),
+			mkDepspec("a 3.1.0"),
+		},
+		r: mksolution(
+			"a 1.1.0",
+			"b 1.0.0",
+		),
+	},
+	"excluded version is skipped": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.4.0, !=1.4.2"),
+			mkDepspec("foo 1.4.0"),
+			mkDepspec("foo 1.4.2"),
+			mkDepspec("foo 1.4.3"),
+			mkDepspec("foo 2.0.0"),
+		},
+		r: mksolution(
+			"foo 1.4.3",
+		),
+	},
+	"prereleases ignored unless opted into": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo >=2.0.0-rc1"),
+			mkDepspec("foo 1.9.0"),
+			mkDepspec("foo 2.0.0-rc1"),
+			mkDepspec("foo 2.0.0-rc2"),
+			mkDepspec("foo 2.1.0-rc1"),
+		},
+		r: mksolution(
+			"foo 2.0.0-rc2",
+		),
+	},
+	"newest prerelease when opted into prereleases": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo >=2.0.0-rc1", "bar 1.0.0"),
+			mkDepspec("bar 1.0.0", "foo ^2.0.0-rc1"),
+			mkDepspec("foo 1.9.0"),
+			mkDepspec("foo 2.0.0-rc1"),
+			mkDepspec("foo 2.0.0"),
+			mkDepspec("foo 2.1.0-rc1"),
+			mkDepspec("foo 2.1.0-rc2"),
+		},
+		r: mksolution(
+			"bar 1.0.0",
+			"foo 2.1.0-rc2",
+		),
+		pre: []ProjectRoot{"foo"},
+	},
+	"final release beats its prereleases": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo >=2.0.0-rc1"),
+			mkDepspec("foo 1.9.0"),
+			mkDepspec("foo 2.0.0-rc1"),
+			mkDepspec("foo 2.0.0-rc2"),
+			mkDepspec("foo 2.0.0"),
+		},
+		r: mksolution(
+			"foo 2.0.0",
+		),
+		pre: []ProjectRoot{"foo"},
+	},
+	"locked prerelease kept without update": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo >=2.0.0-rc1"),
+			mkDepspec("foo 2.0.0-rc1"),
+			mkDepspec("foo 2.0.0-rc2"),
+		},
+		l: mklock(
+			"foo 2.0.0-rc1",
+		),
+		r: mksolution(
+			"foo 2.0.0-rc1",
+		),
+		pre: []ProjectRoot{"foo"},
+	},
+	"locked prerelease updated to the next one": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo >=2.0.0-rc1"),
+			mkDepspec("foo 2.0.0-rc1"),
+			mkDepspec("foo 2.0.0-rc2"),
+		},
+		l: mklock(
+			"foo 2.0.0-rc1",
+		),
+		r: mksolution(
+			"foo 2.0.0-rc2",
+		),
+		changelist: []ProjectRoot{"foo"},
+		pre:        []ProjectRoot{"foo"},
+	},
 	"downgrade on overlapping constraints": {
 		ds: []depspec{
 			mkDepspec("root 0.0.0", "a 1.0.0", "b 1.0.0"),
@@ -893,6 +1021,32 @@ var basicFixtures = map[string]basicFixture{
 			"foo ptaggerino oldrev",
 		),
 	},
+	"case-only variants of a root": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo 1.0.0", "bar 1.0.0"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("Foo 1.0.0"),
+			mkDepspec("bar 1.0.0", "baz 1.0.0"),
+			mkDepspec("baz 1.0.0", "Foo 1.0.0"),
+		},
+		fail: &noVersionError{
+			pn: mkPI("Foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &caseMismatchFailure{
+						goal:    mkAtom("Foo 1.0.0"),
+						current: "foo",
+						goalsel: []dependency{mkDep("baz 1.0.0", "Foo 1.0.0", "Foo")},
+						cursel:  []dependency{mkDep("root", "foo 1.0.0", "foo")},
+						chains: depChains{
+							"baz": {{id: mkPI("root"), v: rootRev}, mkAtom("bar 1.0.0")},
+						},
+					},
+				},
+			},
+		},
+	},
 	"no version that matches requirement": {
 		ds: []depspec{
 			mkDepspec("root 0.0.0", "foo ^1.0.0"),
@@ -921,6 +1075,43 @@ var basicFixtures = map[string]basicFixture{
 			},
 		},
 	},
+	"no version but an excluded one matches requirement": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.4.0, !=1.4.2"),
+			mkDepspec("foo 1.3.0"),
+			mkDepspec("foo 1.4.2"),
+			mkDepspec("foo 2.0.0"),
+		},
+		fail: &noVersionError{
+			pn: mkPI("foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("2.0.0"),
+					f: &versionNotAllowedFailure{
+						goal:       mkAtom("foo 2.0.0"),
+						failparent: []dependency{mkDep("root", "foo ^1.4.0, !=1.4.2", "foo")},
+						c:          mkSVC("^1.4.0, !=1.4.2"),
+					},
+				},
+				{
+					v: NewVersion("1.4.2"),
+					f: &versionNotAllowedFailure{
+						goal:       mkAtom("foo 1.4.2"),
+						failparent: []dependency{mkDep("root", "foo ^1.4.0, !=1.4.2", "foo")},
+						c:          mkSVC("^1.4.0, !=1.4.2"),
+					},
+				},
+				{
+					v: NewVersion("1.3.0"),
+					f: &versionNotAllowedFailure{
+						goal:       mkAtom("foo 1.3.0"),
+						failparent: []dependency{mkDep("root", "foo ^1.4.0, !=1.4.2", "foo")},
+						c:          mkSVC("^1.4.0, !=1.4.2"),
+					},
+				},
+			},
+		},
+	},
 	"no version that matches combined constraint": {
 		ds: []depspec{
 			mkDepspec("root 0.0.0", "foo 1.0.0", "bar 1.0.0"),
@@ -998,6 +1189,7 @@ var basicFixtures = map[string]basicFixture{
 					f: &constraintNotAllowedFailure{
 						goal: mkDep("b 1.0.0", "a 2.0.0", "a"),
 						v:    NewVersion("1.0.0"),
+						sel:  []dependency{mkDep("root", "a *", "a")},
 					},
 				},
 			},
@@ -1231,6 +1423,20 @@ var basicFixtures = map[string]basicFixture{
 			"bar from bar 1.0.0",
 		),
 	},
+	"mirrors apply to transitive deps": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo 1.0.0"),
+			mkDepspec("foo 1.0.0", "bar 1.0.0"),
+			mkDepspec("bar 1.0.0"),
+			mkDepspec("mirrorfoo 1.0.0", "bar 1.0.0"),
+			mkDepspec("mirrorbar 1.0.0"),
+		},
+		mirrors: SourceMirrors{"": "mirror"},
+		r: mksolution(
+			"foo from mirrorfoo 1.0.0",
+			"bar from mirrorbar 1.0.0",
+		),
+	},
 
 	// TODO(sdboyer) decide how to refactor the solver in order to re-enable these.
 	// Checking for revision existence is important...but kinda obnoxious.
@@ -1371,13 +1577,15 @@ func (sm *depspecSourceManager) ListPackages(id ProjectIdentifier, v Version) (p
 	}
 
 	if r, exists := sm.rm[pid]; exists {
+		// Like the real SourceManager, the packages are at the project's import
+		// path, wherever its source is.
 		return pkgtree.PackageTree{
-			ImportRoot: string(pid.n),
+			ImportRoot: string(id.ProjectRoot),
 			Packages: map[string]pkgtree.PackageOrErr{
-				string(pid.n): {
+				string(id.ProjectRoot): {
 					P: pkgtree.Package{
-						ImportPath: string(pid.n),
-						Name:       string(pid.n),
+						ImportPath: string(id.ProjectRoot),
+						Name:       string(id.ProjectRoot),
 						Imports:    r[string(pid.n)],
 					},
 				},
@@ -1468,6 +1676,13 @@ func (sm *depspecSourceManager) SyncSourceFor(id ProjectIdentifier) error {
 
 func (sm *depspecSourceManager) Release() {}
 
+func (sm *depspecSourceManager) SourceOrigin(id ProjectIdentifier) (ProjectOrigin, error) {
+	if exist, _ := sm.SourceExists(id); !exist {
+		return ProjectOrigin{}, fmt.Errorf("Source %s does not exist", id.errString())
+	}
+	return ProjectOrigin{VCS: "depspec", URL: id.normalizedSource()}, nil
+}
+
 func (sm *depspecSourceManager) ExportProject(id ProjectIdentifier, v Version, to string) error {
 	return fmt.Errorf("dummy sm doesn't support exporting")
 }
@@ -1503,6 +1718,14 @@ func (sm *depspecSourceManager) InferConstraint(s string, pi ProjectIdentifier)
 	panic("depsecSourceManager is only for gps solving tests")
 }
 
+func (sm *depspecSourceManager) RevisionTime(id ProjectIdentifier, r Revision) (time.Time, error) {
+	panic("depsecSourceManager is only for gps solving tests")
+}
+
+func (sm *depspecSourceManager) CountCommitsBetween(id ProjectIdentifier, from, to Revision) (int, error) {
+	panic("depsecSourceManager is only for gps solving tests")
+}
+
 type depspecBridge struct {
 	*bridge
 }
@@ -1528,7 +1751,9 @@ func (b *depspecBridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 		}
 	}
 
-	if b.down {
+	if b.s.rd.allowsPrereleases(id.ProjectRoot) {
+		sortWithPrereleases(vl, b.down)
+	} else if b.down {
 		SortForDowngrade(vl)
 	} else {
 		SortForUpgrade(vl)
@@ -30,6 +30,36 @@ func a2vs(a atom) string {
 	return fmt.Sprintf("%s@%s", a.id.errString(), a.v)
 }
 
+// maxChainLen is the most projects shown of a chain by which a project came to
+// be in the depgraph; those in the middle of longer chains are elided.
+const maxChainLen = 5
+
+// depChains are the chains by which the dependers in a failure came to be in
+// the depgraph, by their project roots, for a failure to say why projects
+// that aren't depended on by the root are there at all.
+type depChains map[ProjectRoot][]atom
+
+// via describes the chain by which the project of a came to be in the
+// depgraph, if it was through any project but the root.
+func (dc depChains) via(a atom) string {
+	chain := dc[a.id.ProjectRoot]
+	if len(chain) < 2 {
+		return ""
+	}
+
+	var parts []string
+	for k, ca := range chain {
+		if len(chain) > maxChainLen && k >= maxChainLen/2 && k < len(chain)-maxChainLen/2 {
+			if k == maxChainLen/2 {
+				parts = append(parts, "...")
+			}
+			continue
+		}
+		parts = append(parts, a2vs(ca))
+	}
+	return fmt.Sprintf(" (via %s)", strings.Join(parts, " -> "))
+}
+
 type traceError interface {
 	traceString() string
 }
@@ -90,12 +120,15 @@ type disjointConstraintFailure struct {
 	// c is the current constraint on the target identifier. It is intersection
 	// of all the active dependencies' constraints.
 	c Constraint
+	// chains are the chains by which the goal's depender and the siblings
+	// came to be in the depgraph.
+	chains depChains
 }
 
 func (e *disjointConstraintFailure) Error() string {
 	if len(e.failsib) == 1 {
-		str := "Could not introduce %s, as it has a dependency on %s with constraint %s, which has no overlap with existing constraint %s from %s"
-		return fmt.Sprintf(str, a2vs(e.goal.depender), e.goal.dep.Ident.errString(), e.goal.dep.Constraint.String(), e.failsib[0].dep.Constraint.String(), a2vs(e.failsib[0].depender))
+		str := "Could not introduce %s%s, as it has a dependency on %s with constraint %s, which has no overlap with existing constraint %s from %s%s"
+		return fmt.Sprintf(str, a2vs(e.goal.depender), e.chains.via(e.goal.depender), e.goal.dep.Ident.errString(), e.goal.dep.Constraint.String(), e.failsib[0].dep.Constraint.String(), a2vs(e.failsib[0].depender), e.chains.via(e.failsib[0].depender))
 	}
 
 	var buf bytes.Buffer
@@ -104,17 +137,17 @@ func (e *disjointConstraintFailure) Error() string {
 	if len(e.failsib) > 1 {
 		sibs = e.failsib
 
-		str := "Could not introduce %s, as it has a dependency on %s with constraint %s, which has no overlap with the following existing constraints:\n"
-		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.goal.dep.Ident.errString(), e.goal.dep.Constraint.String())
+		str := "Could not introduce %s%s, as it has a dependency on %s with constraint %s, which has no overlap with the following existing constraints:\n"
+		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.chains.via(e.goal.depender), e.goal.dep.Ident.errString(), e.goal.dep.Constraint.String())
 	} else {
 		sibs = e.nofailsib
 
-		str := "Could not introduce %s, as it has a dependency on %s with constraint %s, which does not overlap with the intersection of existing constraints from other currently selected packages:\n"
-		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.goal.dep.Ident.errString(), e.goal.dep.Constraint.String())
+		str := "Could not introduce %s%s, as it has a dependency on %s with constraint %s, which does not overlap with the intersection of existing constraints from other currently selected packages:\n"
+		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.chains.via(e.goal.depender), e.goal.dep.Ident.errString(), e.goal.dep.Constraint.String())
 	}
 
 	for _, c := range sibs {
-		fmt.Fprintf(&buf, "\t%s from %s\n", c.dep.Constraint.String(), a2vs(c.depender))
+		fmt.Fprintf(&buf, "\t%s from %s%s\n", c.dep.Constraint.String(), a2vs(c.depender), e.chains.via(c.depender))
 	}
 
 	return buf.String()
@@ -153,16 +186,34 @@ type constraintNotAllowedFailure struct {
 	// The (currently selected) version of the target project that was not
 	// admissible by the goal dependency.
 	v Version
+	// sel is the list of active dependencies on the target project, under
+	// which its version was selected.
+	sel []dependency
+	// chains are the chains by which the goal's depender and those of sel
+	// came to be in the depgraph.
+	chains depChains
 }
 
 func (e *constraintNotAllowedFailure) Error() string {
-	return fmt.Sprintf(
-		"Could not introduce %s, as it has a dependency on %s with constraint %s, which does not allow the currently selected version of %s",
+	str := fmt.Sprintf(
+		"Could not introduce %s%s, as it has a dependency on %s with constraint %s, which does not allow the currently selected version of %s",
 		a2vs(e.goal.depender),
+		e.chains.via(e.goal.depender),
 		e.goal.dep.Ident.errString(),
 		e.goal.dep.Constraint,
 		e.v,
 	)
+	if len(e.sel) == 0 {
+		return str
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s, selected under the following existing constraints:\n", str)
+	for _, d := range e.sel {
+		fmt.Fprintf(&buf, "\t%s from %s%s\n", d.dep.Constraint.String(), a2vs(d.depender), e.chains.via(d.depender))
+	}
+
+	return buf.String()
 }
 
 func (e *constraintNotAllowedFailure) traceString() string {
@@ -190,15 +241,24 @@ type versionNotAllowedFailure struct {
 	// c is the current constraint on the atom's identifier. This is the intersection
 	// of all active dependencies' constraints.
 	c Constraint
+	// chains are the chains by which the dependers of failparent came to be
+	// in the depgraph.
+	chains depChains
 }
 
 func (e *versionNotAllowedFailure) Error() string {
 	if len(e.failparent) == 1 {
+		why := "not allowed"
+		if e.excludedBy(e.failparent[0]) {
+			why = "excluded"
+		}
 		return fmt.Sprintf(
-			"Could not introduce %s, as it is not allowed by constraint %s from project %s.",
+			"Could not introduce %s, as it is %s by constraint %s from project %s%s.",
 			a2vs(e.goal),
+			why,
 			e.failparent[0].dep.Constraint.String(),
 			e.failparent[0].depender.id.errString(),
+			e.chains.via(e.failparent[0].depender),
 		)
 	}
 
@@ -207,12 +267,23 @@ func (e *versionNotAllowedFailure) Error() string {
 	fmt.Fprintf(&buf, "Could not introduce %s, as it is not allowed by constraints from the following projects:\n", a2vs(e.goal))
 
 	for _, f := range e.failparent {
-		fmt.Fprintf(&buf, "\t%s from %s\n", f.dep.Constraint.String(), a2vs(f.depender))
+		if e.excludedBy(f) {
+			fmt.Fprintf(&buf, "\t%s from %s%s, which excludes it\n", f.dep.Constraint.String(), a2vs(f.depender), e.chains.via(f.depender))
+		} else {
+			fmt.Fprintf(&buf, "\t%s from %s%s\n", f.dep.Constraint.String(), a2vs(f.depender), e.chains.via(f.depender))
+		}
 	}
 
 	return buf.String()
 }
 
+// excludedBy indicates if the goal version was rejected by one of the !=
+// clauses of the dependency's constraint.
+func (e *versionNotAllowedFailure) excludedBy(d dependency) bool {
+	sc, ok := d.dep.Constraint.(semverConstraint)
+	return ok && sc.excludes(e.goal.v)
+}
+
 func (e *versionNotAllowedFailure) traceString() string {
 	var buf bytes.Buffer
 
@@ -276,6 +347,48 @@ func (e *sourceMismatchFailure) traceString() string {
 	return buf.String()
 }
 
+// caseMismatchFailure indicates that the goal atom was rejected because its
+// project root differs only in case from that of a project which is already
+// depended on. The two would be written to the same place on case-insensitive
+// filesystems, as in vendor/, and one would overwrite the other.
+type caseMismatchFailure struct {
+	// goal is the atom whose root is a case variant of current.
+	goal atom
+	// current is the root which was depended on first.
+	current ProjectRoot
+	// goalsel and cursel are the dependencies on the goal's root and on
+	// current, respectively.
+	goalsel, cursel []dependency
+	// chains are the chains by which the dependers of goalsel and cursel came
+	// to be in the depgraph.
+	chains depChains
+}
+
+func (e *caseMismatchFailure) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Could not introduce %s, as its root differs only in case from %s, and the two would collide on case-insensitive filesystems. %s is imported by:\n", a2vs(e.goal), e.current, e.goal.id.ProjectRoot)
+	for _, d := range e.goalsel {
+		fmt.Fprintf(&buf, "\t%s%s\n", a2vs(d.depender), e.chains.via(d.depender))
+	}
+	fmt.Fprintf(&buf, "and %s by:\n", e.current)
+	for _, d := range e.cursel {
+		fmt.Fprintf(&buf, "\t%s%s\n", a2vs(d.depender), e.chains.via(d.depender))
+	}
+	return buf.String()
+}
+
+func (e *caseMismatchFailure) traceString() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "case-only variation of %s from %s:\n", e.current, e.goal.id.ProjectRoot)
+	for _, d := range e.goalsel {
+		fmt.Fprintf(&buf, "  %s from %s\n", e.goal.id.ProjectRoot, d.depender.id.errString())
+	}
+	for _, d := range e.cursel {
+		fmt.Fprintf(&buf, "  %s from %s\n", e.current, d.depender.id.errString())
+	}
+	return buf.String()
+}
+
 type errDeppers struct {
 	err     error
 	deppers []atom
@@ -494,3 +607,75 @@ func (e *nonexistentRevisionFailure) traceString() string {
 		e.goal.dep.Ident.errString(),
 	)
 }
+
+// UnresolvedImport is an import which a solve could not satisfy, because the
+// imported package, or its whole project, could not be found or used.
+type UnresolvedImport struct {
+	// ImportPath is the import path of the problem package or, when no version
+	// of its project could be found at all, the root of the project.
+	ImportPath string
+	// Importer is the project importing the package, if it's known. Version is
+	// the version of it being tried, and is nil for the root project.
+	Importer ProjectIdentifier
+	Version  Version
+	// Err is why the package couldn't be used, e.g. because it has no
+	// buildable Go files, or nil if it wasn't found at all.
+	Err error
+}
+
+// UnresolvedImports returns the imports which err, as returned from
+// Solver.Solve(), reports could not be satisfied, sorted by import path. Each
+// import path appears only once, with the first importer found for it.
+func UnresolvedImports(err error) []UnresolvedImport {
+	found := make(map[string]UnresolvedImport)
+	add := func(ui UnresolvedImport) {
+		if _, has := found[ui.ImportPath]; !has {
+			found[ui.ImportPath] = ui
+		}
+	}
+	addImportedBy := func(ip string, importer atom, err error) {
+		ui := UnresolvedImport{ImportPath: ip, Importer: importer.id, Err: err}
+		if importer.v != rootRev {
+			ui.Version = importer.v
+		}
+		add(ui)
+	}
+
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case *noVersionError:
+			if len(e.fails) == 0 {
+				add(UnresolvedImport{ImportPath: string(e.pn.ProjectRoot)})
+			}
+			for _, f := range e.fails {
+				walk(f.f)
+			}
+		case *depHasProblemPackagesFailure:
+			for pkg, perr := range e.prob {
+				addImportedBy(pkg, e.goal.depender, perr)
+			}
+		case *checkeeHasProblemPackagesFailure:
+			for pkg, errdep := range e.failpkg {
+				if len(errdep.deppers) > 0 {
+					addImportedBy(pkg, errdep.deppers[0], errdep.err)
+				} else {
+					add(UnresolvedImport{ImportPath: pkg, Err: errdep.err})
+				}
+			}
+		}
+	}
+	walk(err)
+
+	ips := make([]string, 0, len(found))
+	for ip := range found {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	unresolved := make([]UnresolvedImport, len(ips))
+	for i, ip := range ips {
+		unresolved[i] = found[ip]
+	}
+	return unresolved
+}
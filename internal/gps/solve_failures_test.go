@@ -0,0 +1,161 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnresolvedImports(t *testing.T) {
+	root := atom{id: mkPI("myproj"), v: rootRev}
+	bar := atom{id: mkPI("github.com/foo/bar"), v: NewVersion("v1.0.0")}
+	noGo := errors.New("no buildable Go source files")
+
+	err := &noVersionError{
+		pn: mkPI("github.com/foo/bar"),
+		fails: []failedVersion{
+			{
+				v: NewVersion("v1.0.0"),
+				f: &checkeeHasProblemPackagesFailure{
+					goal: bar,
+					failpkg: map[string]errDeppers{
+						"github.com/foo/bar/client": {deppers: []atom{root}},
+						"github.com/foo/bar/gone":   {err: noGo},
+					},
+				},
+			},
+			{
+				v: NewVersion("v0.9.0"),
+				f: &depHasProblemPackagesFailure{
+					goal: dependency{
+						depender: bar,
+						dep:      completeDep{pl: []string{"github.com/gone/pkg"}},
+					},
+					prob: map[string]error{
+						"github.com/gone/pkg":       nil,
+						"github.com/foo/bar/client": nil,
+					},
+				},
+			},
+			{
+				v: NewVersion("v0.8.0"),
+				f: &noVersionError{pn: mkPI("github.com/nowhere/proj")},
+			},
+			{
+				v: NewVersion("v0.7.0"),
+				f: errors.New("unrelated failure"),
+			},
+		},
+	}
+
+	want := []UnresolvedImport{
+		{ImportPath: "github.com/foo/bar/client", Importer: root.id},
+		{ImportPath: "github.com/foo/bar/gone", Err: noGo},
+		{ImportPath: "github.com/gone/pkg", Importer: bar.id, Version: bar.v},
+		{ImportPath: "github.com/nowhere/proj"},
+	}
+	if got := UnresolvedImports(err); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected unresolved imports:\n\t%v\ngot:\n\t%v", want, got)
+	}
+
+	if got := UnresolvedImports(errors.New("unrelated failure")); len(got) != 0 {
+		t.Fatalf("expected no unresolved imports from an unrelated error, got %v", got)
+	}
+}
+
+func TestVersionNotAllowedFailureExcluded(t *testing.T) {
+	c := mkSVC("^1.4.0, !=1.4.2")
+	dep := mkDep("root", "foo ^1.4.0, !=1.4.2", "foo")
+
+	excluded := &versionNotAllowedFailure{goal: mkAtom("foo 1.4.2"), failparent: []dependency{dep}, c: c}
+	want := "Could not introduce foo@1.4.2, as it is excluded by constraint ^1.4.0, !=1.4.2 from project root."
+	if got := excluded.Error(); got != want {
+		t.Errorf("unexpected error for an excluded version:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+
+	outside := &versionNotAllowedFailure{goal: mkAtom("foo 1.3.0"), failparent: []dependency{dep}, c: c}
+	want = "Could not introduce foo@1.3.0, as it is not allowed by constraint ^1.4.0, !=1.4.2 from project root."
+	if got := outside.Error(); got != want {
+		t.Errorf("unexpected error for a version outside the range:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+}
+
+// TestFailureChains solves fixtures which fail for constraints of projects
+// that the root depends on only transitively, and checks the failures say how
+// those projects came to be depended on.
+func TestFailureChains(t *testing.T) {
+	cases := []struct {
+		name string
+		ds   []depspec
+		want string
+	}{
+		{
+			name: "transitive constraint",
+			ds: []depspec{
+				mkDepspec("root 0.0.0", "a 1.0.0", "shared ^2.0.0"),
+				mkDepspec("a 1.0.0", "b 1.0.0"),
+				mkDepspec("b 1.0.0", "shared ^1.0.0"),
+				mkDepspec("shared 1.0.0"),
+				mkDepspec("shared 2.0.0"),
+			},
+			want: "No versions of b met constraints:\n" +
+				"\t1.0.0: Could not introduce b@1.0.0 (via (root) -> a@1.0.0), as it has a dependency on shared with constraint ^1.0.0, which has no overlap with existing constraint ^2.0.0 from (root)",
+		},
+		{
+			name: "elided chain",
+			ds: []depspec{
+				mkDepspec("root 0.0.0", "a 1.0.0", "shared ^2.0.0"),
+				mkDepspec("a 1.0.0", "b 1.0.0"),
+				mkDepspec("b 1.0.0", "c 1.0.0"),
+				mkDepspec("c 1.0.0", "d 1.0.0"),
+				mkDepspec("d 1.0.0", "e 1.0.0"),
+				mkDepspec("e 1.0.0", "f 1.0.0"),
+				mkDepspec("f 1.0.0", "shared ^1.0.0"),
+				mkDepspec("shared 1.0.0"),
+				mkDepspec("shared 2.0.0"),
+			},
+			want: "No versions of f met constraints:\n" +
+				"\t1.0.0: Could not introduce f@1.0.0 (via (root) -> a@1.0.0 -> ... -> d@1.0.0 -> e@1.0.0), as it has a dependency on shared with constraint ^1.0.0, which has no overlap with existing constraint ^2.0.0 from (root)",
+		},
+		{
+			name: "grouped constraints",
+			ds: []depspec{
+				mkDepspec("root 0.0.0", "shared *", "b 1.0.0"),
+				mkDepspec("b 1.0.0", "y 1.0.0"),
+				mkDepspec("y 1.0.0", "shared ^1.0.0", "z 1.0.0"),
+				mkDepspec("z 1.0.0", "shared >1.0.0, <2.0.0"),
+				mkDepspec("shared 1.0.0"),
+				mkDepspec("shared 2.0.0"),
+			},
+			want: "No versions of shared met constraints:\n" +
+				"\t2.0.0: Could not introduce shared@2.0.0, as it is not allowed by constraints from the following projects:\n" +
+				"\t^1.0.0 from y@1.0.0 (via (root) -> b@1.0.0)\n" +
+				"\t>1.0.0, <2.0.0 from z@1.0.0 (via (root) -> b@1.0.0 -> y@1.0.0)\n" +
+				"\n" +
+				"\t1.0.0: Could not introduce shared@1.0.0, as it is not allowed by constraint >1.0.0, <2.0.0 from project z (via (root) -> b@1.0.0 -> y@1.0.0).",
+		},
+	}
+
+	for _, c := range cases {
+		fix := basicFixture{ds: c.ds}
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			Lock:            dummyLock{},
+			ProjectAnalyzer: naiveAnalyzer{},
+		}
+		_, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err == nil {
+			t.Errorf("%s: expected solving to fail", c.name)
+			continue
+		}
+		if err.Error() != c.want {
+			t.Errorf("%s: unexpected failure:\n\t(GOT): %s\n\t(WNT): %s", c.name, err, c.want)
+		}
+	}
+}
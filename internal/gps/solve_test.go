@@ -6,6 +6,7 @@ package gps
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"reflect"
@@ -54,7 +55,7 @@ func fixSolve(params SolveParameters, sm SourceManager, t *testing.T) (Solution,
 		return nil, err
 	}
 
-	return s.Solve()
+	return s.Solve(context.Background())
 }
 
 // Test all the basic table fixtures.
@@ -89,6 +90,7 @@ func solveBasicsAndCheck(fix basicFixture, t *testing.T) (res Solution, err erro
 		ChangeAll:       fix.changeall,
 		ToChange:        fix.changelist,
 		ProjectAnalyzer: naiveAnalyzer{},
+		SourceMirrors:   fix.mirrors,
 	}
 
 	if fix.l != nil {
@@ -269,3 +271,126 @@ func TestRootLockNoVersionPairMatching(t *testing.T) {
 
 	fixtureSolveSimpleChecks(fix, res, err, t)
 }
+
+func TestSolveRecordsOrigins(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo bmaster", "bar 1.0.0"),
+			mkDepspec("foo bmaster foorev"),
+			mkDepspec("foo bdevelop devrev"),
+			mkDepspec("bar 1.0.0"),
+		},
+	}
+	// Only the SourceManager can mark a branch as the default one.
+	fix.ds[1].v = newDefaultBranch("master").Pair("foorev")
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatalf("Unexpected error while solving: %s", err)
+	}
+
+	want := map[ProjectRoot]ProjectOrigin{
+		"foo": {VCS: "depspec", URL: "foo", DefaultBranch: "master"},
+		"bar": {VCS: "depspec", URL: "bar"},
+	}
+	for _, lp := range soln.Projects() {
+		if got := lp.Origin(); got != want[lp.Ident().ProjectRoot] {
+			t.Errorf("Unexpected origin for %s:\n\t(GOT): %+v\n\t(WNT): %+v", lp.Ident().ProjectRoot, got, want[lp.Ident().ProjectRoot])
+		}
+	}
+}
+
+func TestSolveIsStable(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0", "b 1.0.0", "c 1.0.0"),
+			mkDepspec("a 1.0.0", "d 1.0.0"),
+			mkDepspec("b 1.0.0", "d 1.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("d 1.0.0"),
+		},
+	}
+
+	var first []LockedProject
+	for i := 0; i < 10; i++ {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			t.Fatalf("Unexpected error while solving: %s", err)
+		}
+
+		if first == nil {
+			first = soln.Projects()
+		} else if !reflect.DeepEqual(soln.Projects(), first) {
+			t.Fatalf("Solving the same inputs again gave the projects in another order:\n\t(GOT): %v\n\t(WNT): %v", soln.Projects(), first)
+		}
+	}
+}
+
+// cancelingSM cancels a solve once it has listed the versions of a project.
+type cancelingSM struct {
+	*depspecSourceManager
+	listed int
+	cancel context.CancelFunc
+}
+
+func (sm *cancelingSM) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	sm.listed++
+	sm.cancel()
+	return sm.depspecSourceManager.ListVersions(id)
+}
+
+func TestSolveCanceled(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            dummyLock{},
+		ProjectAnalyzer: naiveAnalyzer{},
+		stdLibFn:        func(string) bool { return false },
+		mkBridgeFn:      overrideMkBridge,
+	}
+
+	// Canceled partway, once the first project's versions are listed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sm := &cancelingSM{depspecSourceManager: newdepspecSM(fix.ds, nil), cancel: cancel}
+	s, err := Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Solve(ctx)
+	if ce, ok := err.(*CanceledError); !ok || ce.Err != context.Canceled {
+		t.Fatalf("Expected solving to be canceled, got %v", err)
+	}
+	// It stops once it's done with the step it was on, rather than going on
+	// to select all three projects.
+	if sm.listed >= 3 {
+		t.Errorf("Expected solving to stop once canceled, but the versions of all %d projects were listed", sm.listed)
+	}
+
+	// Past its deadline before it starts.
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	s, err = Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Solve(ctx); err == nil {
+		t.Fatal("Expected solving past its deadline to fail")
+	} else if ce, ok := err.(*CanceledError); !ok || ce.Err != context.DeadlineExceeded {
+		t.Fatalf("Expected solving to fail as its deadline passed, got %v", err)
+	}
+}
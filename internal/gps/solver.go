@@ -6,7 +6,10 @@ package gps
 
 import (
 	"container/heap"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"sort"
 	"strings"
@@ -94,6 +97,34 @@ type SolveParameters struct {
 	// solving process.
 	TraceLogger *log.Logger
 
+	// TraceEvents is where to write the events of the solving process, as
+	// TraceEvents encoded as JSON, one per line, for tools. It's independent
+	// of TraceLogger; either, both or neither may be set.
+	TraceEvents io.Writer
+
+	// SourceMirrors are applied to the sources of all the projects the solver
+	// encounters, whether the root depends on them directly or not. The
+	// solution records the sources they resulted in.
+	SourceMirrors SourceMirrors
+
+	// ExcludeTests leaves the imports of the test files of the root project
+	// out of the solve, so that projects only they import aren't selected.
+	// Packages imported by both test and non-test files are still selected.
+	ExcludeTests bool
+
+	// BuildMatrix sets the platforms and build tags for which the packages of
+	// the root and its dependencies are built. The imports of files which
+	// aren't built for any of them are left out of the solve. The zero value
+	// follows every import, regardless of build constraints.
+	BuildMatrix pkgtree.BuildMatrix
+
+	// RootExcludeDirs and RootIncludeDirs are the dirs of the root project
+	// which were left out of RootPackageTree, and those beneath them which
+	// were kept in it all the same, as with pkgtree.ListPackagesExcluding.
+	// The solver doesn't apply them itself; they're only recorded in the
+	// inputs hash, as they change which imports the tree has.
+	RootExcludeDirs, RootIncludeDirs []string
+
 	// stdLibFn is the function to use to recognize standard library import paths.
 	// Only overridden for tests. Defaults to paths.IsStandardImportPath if nil.
 	stdLibFn func(string) bool
@@ -115,6 +146,9 @@ type solver struct {
 	// Logger used exclusively for trace output, or nil to suppress.
 	tl *log.Logger
 
+	// Encoder of trace events, as JSON lines, or nil to suppress.
+	te *json.Encoder
+
 	// The function to use to recognize standard library import paths.
 	stdLibFn func(string) bool
 
@@ -187,12 +221,18 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		ig:      params.Manifest.IgnoredPackages(),
 		req:     params.Manifest.RequiredPackages(),
 		ovr:     params.Manifest.Overrides(),
-		rpt:     params.RootPackageTree.Copy(),
+		rpt:     params.RootPackageTree.Constrain(params.BuildMatrix).Copy(),
 		chng:    make(map[ProjectRoot]struct{}),
 		rlm:     make(map[ProjectRoot]LockedProject),
 		chngall: params.ChangeAll,
 		dir:     params.RootDir,
 		an:      params.ProjectAnalyzer,
+		mirrors: params.SourceMirrors,
+		down:    params.Downgrade,
+		notests: params.ExcludeTests,
+		build:   params.BuildMatrix,
+		exclude: params.RootExcludeDirs,
+		include: params.RootIncludeDirs,
 	}
 
 	// Ensure the required, ignore and overrides maps are at least initialized
@@ -209,7 +249,7 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 	if len(rd.ig) != 0 {
 		var both []string
 		for pkg := range params.Manifest.RequiredPackages() {
-			if rd.ig[pkg] {
+			if pkgtree.IsIgnored(pkg, rd.ig) {
 				both = append(both, pkg)
 			}
 		}
@@ -289,6 +329,9 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 		stdLibFn: params.stdLibFn,
 		rd:       rd,
 	}
+	if params.TraceEvents != nil {
+		s.te = json.NewEncoder(params.TraceEvents)
+	}
 
 	// Set up the bridge and ensure the root dir is in good, working order
 	// before doing anything else.
@@ -335,8 +378,9 @@ type Solver interface {
 	HashInputs() []byte
 
 	// Solve initiates a solving run. It will either complete successfully with
-	// a Solution, or fail with an informative error.
-	Solve() (Solution, error)
+	// a Solution, or fail with an informative error. If ctx is canceled, or
+	// its deadline passes, before either, it fails with a *CanceledError.
+	Solve(ctx context.Context) (Solution, error)
 
 	// Name returns a string identifying the particular solver backend.
 	//
@@ -425,11 +469,21 @@ func ValidateParams(params SolveParameters, sm SourceManager) error {
 	return nil
 }
 
+// CanceledError is returned by Solve when its context is canceled, or its
+// deadline passes, before it finds a solution or fails to.
+type CanceledError struct {
+	Err error // The context's error, context.Canceled or context.DeadlineExceeded
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("solving was stopped: %s", e.Err)
+}
+
 // Solve attempts to find a dependency solution for the given project, as
 // represented by the SolveParameters with which this Solver was created.
 //
 // This is the entry point to the main gps workhorse.
-func (s *solver) Solve() (Solution, error) {
+func (s *solver) Solve(ctx context.Context) (Solution, error) {
 	// Set up a metrics object
 	s.mtr = newMetrics()
 	s.vUnify.mtr = s.mtr
@@ -439,7 +493,7 @@ func (s *solver) Solve() (Solution, error) {
 		return nil, err
 	}
 
-	all, err := s.solve()
+	all, err := s.solve(ctx)
 
 	s.mtr.pop()
 	var soln solution
@@ -455,9 +509,12 @@ func (s *solver) Solve() (Solution, error) {
 		soln.p = make([]LockedProject, len(all))
 		k := 0
 		for pa, pl := range all {
-			soln.p[k] = pa2lp(pa, pl)
+			soln.p[k] = s.recordOrigin(pa2lp(pa, pl))
 			k++
 		}
+		// The atoms come out of a map, so they're sorted to keep solutions
+		// from the same inputs the same.
+		SortLockedProjects(soln.p)
 	}
 
 	s.traceFinish(soln, err)
@@ -468,9 +525,15 @@ func (s *solver) Solve() (Solution, error) {
 }
 
 // solve is the top-level loop for the solving process.
-func (s *solver) solve() (map[atom]map[string]struct{}, error) {
+func (s *solver) solve(ctx context.Context) (map[atom]map[string]struct{}, error) {
 	// Main solving loop
 	for {
+		// Stop between steps, leaving what the SourceManager is doing to
+		// it, if it's been asked to.
+		if err := ctx.Err(); err != nil {
+			return nil, &CanceledError{Err: err}
+		}
+
 		bmi, has := s.nextUnselected()
 
 		if !has {
@@ -657,7 +720,7 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 	// explicitly listed in the atom
 	for _, pkg := range a.pl {
 		// Skip ignored packages
-		if s.rd.ig[pkg] {
+		if pkgtree.IsIgnored(pkg, s.rd.ig) {
 			continue
 		}
 
@@ -684,7 +747,7 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 	}
 	sort.Strings(reach)
 
-	deps := s.rd.ovr.overrideAll(m.DependencyConstraints())
+	deps := s.rd.mirrorAll(s.rd.ovr.overrideAll(m.DependencyConstraints()))
 	cd, err := s.intersectConstraintsWithImports(deps, reach)
 	return pl, cd, err
 }
@@ -737,6 +800,7 @@ func (s *solver) intersectConstraintsWithImports(deps []workingConstraint, reach
 
 		// Make a new completeDep with an open constraint, respecting overrides
 		pd := s.rd.ovr.override(root, ProjectProperties{Constraint: Any()})
+		pd.Ident = s.rd.mirrors.Apply(pd.Ident)
 
 		// Insert the pd into the trie so that further deps from this
 		// project get caught by the prefix search
@@ -887,7 +951,7 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 
 	for {
 		cur := q.current()
-		s.traceInfo("try %s@%s", q.id.errString(), cur)
+		s.traceTry(q.id, cur)
 		err := s.check(atomWithPackages{
 			a: atom{
 				id: q.id,
@@ -1302,6 +1366,31 @@ func (s *solver) unselectLast() (atomWithPackages, bool) {
 	return awp, first
 }
 
+// recordOrigin returns lp recording where its source was fetched from and, if
+// it's locked to a branch, what the default branch of the source is. The origin
+// is only informational, so it's left out if it can't be found.
+func (s *solver) recordOrigin(lp LockedProject) LockedProject {
+	o, err := s.b.SourceOrigin(lp.pi)
+	if err != nil {
+		return lp
+	}
+
+	if _, ok := lp.v.(branchVersion); ok {
+		// The versions are almost always cached, from solving.
+		vl, err := s.b.listVersions(lp.pi)
+		if err == nil {
+			for _, v := range vl {
+				if IsDefaultBranch(v) {
+					o.DefaultBranch = v.String()
+					break
+				}
+			}
+		}
+	}
+
+	return lp.WithOrigin(o)
+}
+
 // simple (temporary?) helper just to convert atoms into locked projects
 func pa2lp(pa atom, pkgs map[string]struct{}) LockedProject {
 	lp := LockedProject{
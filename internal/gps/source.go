@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/golang/dep/internal/gps/pkgtree"
 )
@@ -49,6 +50,8 @@ type sourceCoordinator struct {
 	protoSrcs  map[string][]srcReturnChans
 	deducer    deducer
 	cachedir   string
+	mirrors    SourceMirrors
+	versions   *versionListCache
 }
 
 func newSourceCoordinator(superv *supervisor, deducer deducer, cachedir string) *sourceCoordinator {
@@ -67,7 +70,11 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		return nil, errors.New("sourceCoordinator has been terminated")
 	}
 
-	normalizedName := id.normalizedSource()
+	id = sc.mirrors.Apply(id)
+	normalizedName, err := ExpandSourceEnv(id.normalizedSource())
+	if err != nil {
+		return nil, err
+	}
 
 	sc.srcmut.RLock()
 	if url, has := sc.nameToURL[normalizedName]; has {
@@ -141,7 +148,7 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	}
 	sc.srcmut.RUnlock()
 
-	srcGate = newSourceGateway(pd.mb, sc.supervisor, sc.cachedir)
+	srcGate = newSourceGateway(pd.mb, sc.supervisor, sc.cachedir, sc.versions)
 
 	// The normalized name is usually different from the source URL- e.g.
 	// github.com/golang/dep/internal/gps vs. https://github.com/golang/dep/internal/gps. But it's
@@ -187,13 +194,20 @@ type sourceGateway struct {
 	cache    singleSourceCache
 	mu       sync.Mutex // global lock, serializes all behaviors
 	suprvsr  *supervisor
+
+	// versions persists the version list of the source between SourceMgrs.
+	// versionsCached is set while the version list in cache came from it,
+	// rather than from upstream, and so may lack the latest versions.
+	versions       *versionListCache
+	versionsCached bool
 }
 
-func newSourceGateway(maybe maybeSource, superv *supervisor, cachedir string) *sourceGateway {
+func newSourceGateway(maybe maybeSource, superv *supervisor, cachedir string, versions *versionListCache) *sourceGateway {
 	sg := &sourceGateway{
 		maybe:    maybe,
 		cachedir: cachedir,
 		suprvsr:  superv,
+		versions: versions,
 	}
 	sg.cache = sg.createSingleSourceCache()
 
@@ -236,7 +250,22 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
 
-	_, err := sg.require(ctx, sourceIsSetUp|sourceExistsLocally)
+	_, err := sg.require(ctx, sourceIsSetUp)
+	if err != nil {
+		return err
+	}
+
+	// A source which isn't in the cache yet needn't be cloned in full to
+	// export a revision that's known without listing its versions; just that
+	// revision is fetched, if the source can do that.
+	if r, has := sg.cache.toRevision(v); has && sg.srcState&sourceExistsLocally == 0 && !sg.copyFromReadOnlyCache(ctx) {
+		if sg.exportArchive(ctx, r, to) {
+			return nil
+		}
+		sg.fetchShallow(ctx, v, r)
+	}
+
+	_, err = sg.require(ctx, sourceExistsLocally)
 	if err != nil {
 		return err
 	}
@@ -246,9 +275,13 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 		return err
 	}
 
-	err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
-		return sg.src.exportRevisionTo(ctx, r, to)
-	})
+	export := func() error {
+		return sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+			return sg.src.exportRevisionTo(ctx, r, to)
+		})
+	}
+	_, shared := sg.src.(cacheReader)
+	err = sg.withCacheLock(ctx, !shared, export)
 
 	// It's possible (in git) that we may have tried this against a version that
 	// doesn't exist in the repository cache, even though we know it exists in
@@ -257,10 +290,8 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 	// TODO(sdboyer) It'd be better if we could check the error to see if this
 	// actually was the cause of the problem.
 	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
-		if _, err = sg.require(ctx, sourceHasLatestLocally); err != nil {
-			err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
-				return sg.src.exportRevisionTo(ctx, r, to)
-			})
+		if _, err = sg.require(ctx, sourceHasLatestLocally); err == nil {
+			err = sg.withCacheLock(ctx, !shared, export)
 		}
 	}
 
@@ -286,11 +317,15 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 		return nil, nil, err
 	}
 
+	// The revision is checked out in the copy of the source to analyze it.
 	label := fmt.Sprintf("%s:%s", sg.src.upstreamURL(), an.Info())
-	err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
-		m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
-		return err
-	})
+	analyze := func() error {
+		return sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
+			m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
+			return err
+		})
+	}
+	err = sg.withCacheLock(ctx, true, analyze)
 
 	// It's possible (in git) that we may have tried this against a version that
 	// doesn't exist in the repository cache, even though we know it exists in
@@ -306,10 +341,7 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 			return nil, nil, err
 		}
 
-		err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
-			m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
-			return err
-		})
+		err = sg.withCacheLock(ctx, true, analyze)
 	}
 
 	if err != nil {
@@ -341,11 +373,15 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 		return pkgtree.PackageTree{}, err
 	}
 
+	// The revision is checked out in the copy of the source to list them.
 	label := fmt.Sprintf("%s:%s", pr, sg.src.upstreamURL())
-	err = sg.suprvsr.do(ctx, label, ctListPackages, func(ctx context.Context) error {
-		ptree, err = sg.src.listPackages(ctx, pr, r)
-		return err
-	})
+	list := func() error {
+		return sg.suprvsr.do(ctx, label, ctListPackages, func(ctx context.Context) error {
+			ptree, err = sg.src.listPackages(ctx, pr, r)
+			return err
+		})
+	}
+	err = sg.withCacheLock(ctx, true, list)
 
 	// It's possible (in git) that we may have tried this against a version that
 	// doesn't exist in the repository cache, even though we know it exists in
@@ -361,10 +397,7 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 			return pkgtree.PackageTree{}, err
 		}
 
-		err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
-			ptree, err = sg.src.listPackages(ctx, pr, r)
-			return err
-		})
+		err = sg.withCacheLock(ctx, true, list)
 	}
 
 	if err != nil {
@@ -394,7 +427,13 @@ func (sg *sourceGateway) convertToRevision(ctx context.Context, v Version) (Revi
 		return r, nil
 	}
 
-	if sg.srcState&sourceHasLatestVersionList != 0 {
+	if sg.versionsCached {
+		// The version list was persisted by an earlier SourceMgr, and the
+		// version may be newer than it; list the source upstream anew.
+		if err := sg.listUpstreamVersions(ctx); err != nil {
+			return "", err
+		}
+	} else if sg.srcState&sourceHasLatestVersionList != 0 {
 		// We have the latest version list already and didn't get a match, so
 		// this is definitely a failure case.
 		return "", fmt.Errorf("version %q does not exist in source", v)
@@ -443,13 +482,149 @@ func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (boo
 		return true, nil
 	}
 
-	present, err := sg.src.revisionPresentIn(r)
+	var present bool
+	err = sg.withCacheLock(ctx, false, func() (err error) {
+		present, err = sg.src.revisionPresentIn(ctx, r)
+		return err
+	})
 	if err == nil && present {
 		sg.cache.markRevisionExists(r)
 	}
 	return present, err
 }
 
+func (sg *sourceGateway) revisionTime(ctx context.Context, r Revision) (time.Time, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if err := sg.requireRevisions(ctx, r); err != nil {
+		return time.Time{}, err
+	}
+
+	var t time.Time
+	err := sg.withCacheLock(ctx, false, func() (err error) {
+		t, err = sg.src.revisionTime(ctx, r)
+		return err
+	})
+	return t, err
+}
+
+func (sg *sourceGateway) countCommitsBetween(ctx context.Context, from, to Revision) (int, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if err := sg.requireRevisions(ctx, from, to); err != nil {
+		return 0, err
+	}
+	// The commits between them can't be counted without the history.
+	if sf, ok := sg.src.(shallowFetcher); ok && sf.isShallow() {
+		if _, err := sg.require(ctx, sourceHasLatestLocally); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	err := sg.withCacheLock(ctx, false, func() (err error) {
+		n, err = sg.src.countCommitsBetween(ctx, from, to)
+		return err
+	})
+	return n, err
+}
+
+// shallowFetcher is implemented by sources which can set up their local copy
+// with a single revision, rather than all of their history.
+type shallowFetcher interface {
+	fetchShallow(ctx context.Context, v Version, r Revision) error
+	isShallow() bool
+}
+
+// fetchShallow sets up the local copy of the source with only the revision r
+// of v, if the source can do that, reporting whether it did. If it didn't, the
+// source is to be cloned in full.
+func (sg *sourceGateway) fetchShallow(ctx context.Context, v Version, r Revision) bool {
+	sf, ok := sg.src.(shallowFetcher)
+	if !ok || sg.suprvsr.checkNetwork(sg.src.upstreamURL(), "fetching") != nil {
+		return false
+	}
+
+	err := sg.withCacheLock(ctx, true, func() error {
+		// Another process may have set up the copy meanwhile.
+		if sg.src.existsLocally(ctx) {
+			return nil
+		}
+		return sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
+			return sf.fetchShallow(ctx, v, r)
+		})
+	})
+	if err != nil {
+		return false
+	}
+	sg.srcState |= sourceExistsLocally
+	sg.markAccessed()
+	return true
+}
+
+// copyFromReadOnlyCache copies the source from the read-only cache of the
+// SourceMgr to its cache dir, if it has one with the source in it, reporting
+// whether the source is now in the cache dir.
+func (sg *sourceGateway) copyFromReadOnlyCache(ctx context.Context) bool {
+	if sg.suprvsr.readOnly == nil {
+		return false
+	}
+
+	var copied bool
+	err := sg.withCacheLock(ctx, true, func() error {
+		// Another process may have set up the copy meanwhile.
+		copied = sg.src.existsLocally(ctx) || sg.suprvsr.readOnly.copySource(sg.src)
+		return nil
+	})
+	if err != nil || !copied {
+		return false
+	}
+	sg.srcState |= sourceExistsLocally
+	sg.markAccessed()
+	return true
+}
+
+// exportArchive exports the revision r to the dir to from an archive of it, if
+// the SourceMgr uses archives and the source can, reporting whether it did. If
+// it didn't, the source is to be fetched to export r.
+func (sg *sourceGateway) exportArchive(ctx context.Context, r Revision, to string) bool {
+	ae, ok := sg.src.(archiveExporter)
+	if !ok || sg.suprvsr.archives == nil || sg.suprvsr.checkNetwork(sg.src.upstreamURL(), "downloading an archive of") != nil {
+		return false
+	}
+
+	err := sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+		return ae.exportArchive(ctx, sg.suprvsr.archives, r, to)
+	})
+	return err == nil
+}
+
+// requireRevisions ensures that the local copy of the source has all the
+// revisions, only fetching from upstream if it lacks any of them.
+func (sg *sourceGateway) requireRevisions(ctx context.Context, revs ...Revision) error {
+	if _, err := sg.require(ctx, sourceIsSetUp|sourceExistsLocally); err != nil {
+		return err
+	}
+
+	var missing bool
+	err := sg.withCacheLock(ctx, false, func() error {
+		for _, r := range revs {
+			if present, err := sg.src.revisionPresentIn(ctx, r); err != nil || !present {
+				missing = true
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil || !missing {
+		return err
+	}
+	_, err = sg.require(ctx, sourceHasLatestLocally)
+	return err
+}
+
 func (sg *sourceGateway) sourceURL(ctx context.Context) (string, error) {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
@@ -462,6 +637,33 @@ func (sg *sourceGateway) sourceURL(ctx context.Context) (string, error) {
 	return sg.src.upstreamURL(), nil
 }
 
+func (sg *sourceGateway) sourceOrigin(ctx context.Context) (ProjectOrigin, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	_, err := sg.require(ctx, sourceIsSetUp)
+	if err != nil {
+		return ProjectOrigin{}, err
+	}
+
+	return ProjectOrigin{VCS: sg.src.sourceType(), URL: sg.src.upstreamURL()}, nil
+}
+
+// withCacheLock calls f holding the lock on the copy of the source in the
+// cache dir, exclusive if f changes it, and shared if it only reads it, as
+// other SourceMgrs, in this process or others, may be using it too.
+func (sg *sourceGateway) withCacheLock(ctx context.Context, exclusive bool, f func() error) error {
+	return sg.suprvsr.locks.with(ctx, versionListName(sg.src), exclusive, f)
+}
+
+// cacheReader is implemented by sources which only read their copy in the
+// cache dir to export revisions from it and to list their versions, rather
+// than check revisions out in it or update it, so that the lock they're done
+// under can be shared.
+type cacheReader interface {
+	readsCacheOnly()
+}
+
 // createSingleSourceCache creates a singleSourceCache instance for use by
 // the encapsulated source.
 func (sg *sourceGateway) createSingleSourceCache() singleSourceCache {
@@ -486,8 +688,16 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 
 			switch flag {
 			case sourceIsSetUp:
-				sg.src, addlState, err = sg.maybe.try(ctx, sg.cachedir, sg.cache, sg.suprvsr)
+				sg.src, addlState, err = sg.maybe.try(ctx, sg.cachedir, sg.cache, sg.versions, sg.suprvsr)
 			case sourceExistsUpstream:
+				if err = sg.suprvsr.checkNetwork(sg.src.upstreamURL(), "checking the existence of"); err != nil {
+					// A persisted version list tells that the source existed
+					// when it was listed, which is as much as can be known.
+					if _, has := sg.versions.get(versionListName(sg.src)); has {
+						err = nil
+					}
+					break
+				}
 				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourcePing, func(ctx context.Context) error {
 					if !sg.src.existsUpstream(ctx) {
 						return fmt.Errorf("%s does not exist upstream", sg.src.upstreamURL())
@@ -495,30 +705,42 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 					return nil
 				})
 			case sourceExistsLocally:
-				if !sg.src.existsLocally(ctx) {
-					err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
+				// It's checked for under the lock, as another process may
+				// be setting it up.
+				err = sg.withCacheLock(ctx, true, func() error {
+					if sg.src.existsLocally(ctx) || sg.suprvsr.readOnly.copySource(sg.src) {
+						return nil
+					}
+					if err := sg.suprvsr.checkNetwork(sg.src.upstreamURL(), "fetching"); err != nil {
+						return err
+					}
+					err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
 						return sg.src.initLocal(ctx)
 					})
-
-					if err == nil {
-						addlState |= sourceHasLatestLocally
-					} else {
-						err = fmt.Errorf("%s does not exist in the local cache and fetching failed: %s", sg.src.upstreamURL(), err)
+					if err != nil {
+						return fmt.Errorf("%s does not exist in the local cache and fetching failed: %s", sg.src.upstreamURL(), err)
 					}
-				}
-			case sourceHasLatestVersionList:
-				var pvl []PairedVersion
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctListVersions, func(ctx context.Context) error {
-					pvl, err = sg.src.listVersions(ctx)
-					return err
+					addlState |= sourceHasLatestLocally
+					return nil
 				})
-
 				if err == nil {
+					sg.markAccessed()
+				}
+			case sourceHasLatestVersionList:
+				if pvl, has := sg.versions.get(versionListName(sg.src)); has {
 					sg.cache.storeVersionMap(pvl, true)
+					sg.versionsCached = true
+					break
 				}
+				err = sg.listUpstreamVersions(ctx)
 			case sourceHasLatestLocally:
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
-					return sg.src.updateLocal(ctx)
+				if err = sg.suprvsr.checkNetwork(sg.src.upstreamURL(), "updating"); err != nil {
+					break
+				}
+				err = sg.withCacheLock(ctx, true, func() error {
+					return sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
+						return sg.src.updateLocal(ctx)
+					})
 				})
 			}
 
@@ -537,6 +759,34 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 	return 0, nil
 }
 
+// listUpstreamVersions lists the versions of the source upstream, replacing
+// those in the cache, and persists them.
+func (sg *sourceGateway) listUpstreamVersions(ctx context.Context) error {
+	if err := sg.suprvsr.checkNetwork(sg.src.upstreamURL(), "listing the versions of"); err != nil {
+		return err
+	}
+
+	// Some sources list the versions in their copy in the cache, updating it
+	// first.
+	var pvl []PairedVersion
+	_, shared := sg.src.(cacheReader)
+	err := sg.withCacheLock(ctx, !shared, func() error {
+		return sg.suprvsr.do(ctx, sg.src.sourceType(), ctListVersions, func(ctx context.Context) (err error) {
+			pvl, err = sg.src.listVersions(ctx)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	sg.cache.storeVersionMap(pvl, true)
+	sg.versions.put(versionListName(sg.src), pvl)
+	sg.versionsCached = false
+	sg.srcState |= sourceHasLatestVersionList
+	return nil
+}
+
 // source is an abstraction around the different underlying types (git, bzr, hg,
 // svn, maybe raw on-disk code, and maybe eventually a registry) that can
 // provide versioned project source trees.
@@ -549,7 +799,9 @@ type source interface {
 	listVersions(context.Context) ([]PairedVersion, error)
 	getManifestAndLock(context.Context, ProjectRoot, Revision, ProjectAnalyzer) (Manifest, Lock, error)
 	listPackages(context.Context, ProjectRoot, Revision) (pkgtree.PackageTree, error)
-	revisionPresentIn(Revision) (bool, error)
+	revisionPresentIn(context.Context, Revision) (bool, error)
+	revisionTime(context.Context, Revision) (time.Time, error)
+	countCommitsBetween(ctx context.Context, from, to Revision) (int, error)
 	exportRevisionTo(context.Context, Revision, string) error
 	sourceType() string
 }
@@ -8,6 +8,8 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -18,8 +20,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps/pkgtree"
-	"github.com/nightlyone/lockfile"
 	"github.com/pkg/errors"
 	"github.com/sdboyer/constext"
 )
@@ -80,6 +82,17 @@ type SourceManager interface {
 	// InferConstraint tries to puzzle out what kind of version is given in a string -
 	// semver, a revision, or as a fallback, a plain tag
 	InferConstraint(s string, pi ProjectIdentifier) (Constraint, error)
+
+	// RevisionTime reports when the revision of the project was committed.
+	RevisionTime(ProjectIdentifier, Revision) (time.Time, error)
+
+	// CountCommitsBetween counts the commits reachable from the revision to but
+	// not from the revision from, for the sources where that's cheap.
+	CountCommitsBetween(id ProjectIdentifier, from, to Revision) (int, error)
+
+	// SourceOrigin reports the type and URL of the source of the project. The
+	// DefaultBranch of the ProjectOrigin is left empty.
+	SourceOrigin(ProjectIdentifier) (ProjectOrigin, error)
 }
 
 // A ProjectAnalyzer is responsible for analyzing a given path for Manifest and
@@ -116,7 +129,6 @@ func (p ProjectAnalyzerInfo) String() string {
 // tools; control via dependency injection is intended to be sufficient.
 type SourceMgr struct {
 	cachedir    string                // path to root of cache dir
-	lf          *lockfile.Lockfile    // handle for the sm lock file on disk
 	suprvsr     *supervisor           // subsystem that supervises running calls/io
 	cancelAll   context.CancelFunc    // cancel func to kill all running work
 	deduceCoord *deductionCoordinator // subsystem that manages import path deduction
@@ -145,87 +157,52 @@ var _ SourceManager = &SourceMgr{}
 // SourceManager as early as possible and use it to their ends. That way, the
 // solver can benefit from any caches that may have already been warmed.
 //
+// The go-get metadata of import paths is fetched through the proxies in the
+// environment, trusting the CA certificates in $DEP_CA_FILE, if set, as well
+// as the system's; see newMetadataClient.
+//
 // gps's SourceManager is intended to be threadsafe (if it's not, please file a
 // bug!). It should be safe to reuse across concurrent solving runs, even on
 // unrelated projects.
 func NewSourceManager(cachedir string) (*SourceMgr, error) {
-	err := os.MkdirAll(filepath.Join(cachedir, "sources"), 0777)
+	// TODO: #534 needs to be implemented to provide a better way to log warnings,
+	// but until then we will just use stderr.
+	warn := log.New(os.Stderr, "", 0)
+
+	// Any number of SourceMgrs, in this process and others, may share the
+	// cache dir. Rather than lock all of it for as long as they live, they
+	// lock each source in it as they use it; see cacheLocks. Only setting up
+	// the cache dir is done under a lock on all of it.
+	locks := newCacheLocks(cachedir, warn)
+	err := os.MkdirAll(locks.dir, 0777)
 	if err != nil {
 		return nil, err
 	}
-
-	// Fix for #820
-	//
-	// Consult https://godoc.org/github.com/nightlyone/lockfile for the lockfile
-	// behaviour. It's magic. It deals with stale processes, and if there is
-	// a process keeping the lock busy, it will pass back a temporary error that
-	// we can spin on.
-
-	glpath := filepath.Join(cachedir, "sm.lock")
-	lockfile, err := lockfile.New(glpath)
+	unlock, err := locks.lock(context.TODO(), "cache", true)
 	if err != nil {
-		return nil, CouldNotCreateLockError{
-			Path: glpath,
-			Err:  fmt.Errorf("unable to create lock %s: %s", glpath, err.Error()),
-		}
+		return nil, err
 	}
-
-	process, err := lockfile.GetOwner()
-	if err == nil {
-		// If we didn't get an error, then the lockfile exists already. We should
-		// check to see if it's us already:
-		if process.Pid == os.Getpid() {
-			return nil, CouldNotCreateLockError{
-				Path: glpath,
-				Err:  fmt.Errorf("lockfile %s already locked by this process", glpath),
-			}
-		}
-
-		// There is a lockfile, but it's owned by someone else. We'll try to lock
-		// it anyway.
+	err = os.MkdirAll(filepath.Join(cachedir, "sources"), 0777)
+	unlock()
+	if err != nil {
+		return nil, err
 	}
 
-	// If it's a TemporaryError, we retry every second. Otherwise, we fail
-	// permanently.
-	//
-	// TODO: #534 needs to be implemented to provide a better way to log warnings,
-	// but until then we will just use stderr.
-
-	// Implicit Time of 0.
-	var lasttime time.Time
-	err = lockfile.TryLock()
-	for err != nil {
-		nowtime := time.Now()
-		duration := nowtime.Sub(lasttime)
-
-		// The first time this is evaluated, duration will be very large as lasttime is 0.
-		// Unless time travel is invented and someone travels back to the year 1, we should
-		// be ok.
-		if duration > 15*time.Second {
-			fmt.Fprintf(os.Stderr, "waiting for lockfile %s: %s\n", glpath, err.Error())
-			lasttime = nowtime
-		}
-
-		if _, ok := err.(interface {
-			Temporary() bool
-		}); ok {
-			time.Sleep(time.Second * 1)
-		} else {
-			return nil, CouldNotCreateLockError{
-				Path: glpath,
-				Err:  fmt.Errorf("unable to lock %s: %s", glpath, err.Error()),
-			}
-		}
-		err = lockfile.TryLock()
+	client, err := newMetadataClient(os.Getenv)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx, cf := context.WithCancel(context.TODO())
 	superv := newSupervisor(ctx)
+	superv.locks = locks
 	deducer := newDeductionCoordinator(superv)
-
+	deducer.metadata = newMetadataCache(cachedir)
+	deducer.client = client
+	// TODO: #534 should give a better way to log this warning, too.
+	deducer.warn = warn
 	sm := &SourceMgr{
 		cachedir:    cachedir,
-		lf:          &lockfile,
 		suprvsr:     superv,
 		cancelAll:   cf,
 		deduceCoord: deducer,
@@ -236,6 +213,137 @@ func NewSourceManager(cachedir string) (*SourceMgr, error) {
 	return sm, nil
 }
 
+// UseSourceMirrors makes the SourceMgr fetch every project from the source its
+// mirrors give for it, rather than the one it's identified by. It is not safe
+// to call concurrently with other methods, and must be called before any of
+// them, or it would change the source of a project it has already fetched.
+func (sm *SourceMgr) UseSourceMirrors(m SourceMirrors) {
+	sm.srcCoord.mirrors = m
+}
+
+// DefaultVersionListTTL is how long a version list persisted by a SourceMgr
+// is used for by default, before its source is listed upstream again.
+const DefaultVersionListTTL = 5 * time.Minute
+
+// UseVersionListCache makes the SourceMgr persist the version lists of the
+// sources it lists in its cache dir, and use them rather than list the sources
+// upstream again, so long as they were listed within ttl, or however long ago
+// they were if staleOK is true. A ttl of zero, without staleOK, disables the
+// cache. Like UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseVersionListCache(ttl time.Duration, staleOK bool) {
+	sm.srcCoord.versions = newVersionListCache(sm.cachedir, ttl, staleOK)
+}
+
+// DefaultMetadataTTL is how long the go-get metadata of an import path,
+// persisted by a SourceMgr, is used for by default, before it's fetched again.
+// Vanity import paths seldom move, so it's long.
+const DefaultMetadataTTL = 24 * time.Hour
+
+// UseMetadataCache makes the SourceMgr use the go-get metadata of import paths
+// persisted in its cache dir, rather than fetch it again, so long as it was
+// fetched within ttl, or however long ago it was if staleOK is true. It's
+// persisted regardless, to be used when its host is down, or the network is
+// disabled, and is dropped when the source it points to can't be set up. Like
+// UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseMetadataCache(ttl time.Duration, staleOK bool) {
+	sm.deduceCoord.metadata.ttl = ttl
+	sm.deduceCoord.metadata.staleOK = staleOK
+}
+
+// DisableNetwork makes the SourceMgr work only from its cache dir: anything
+// which would need the network, like fetching a source, listing its versions
+// upstream or fetching the go-get metadata of an import path, fails with an
+// ErrNetworkDisabled instead. Version lists persisted by UseVersionListCache
+// are used however old they are. Like UseSourceMirrors, it must be called
+// before any other methods.
+func (sm *SourceMgr) DisableNetwork() {
+	sm.suprvsr.offline = true
+	if sm.srcCoord.versions == nil {
+		sm.srcCoord.versions = newVersionListCache(sm.cachedir, 0, true)
+	} else {
+		sm.srcCoord.versions.staleOK = true
+	}
+}
+
+// DisablePrompts makes the commands the SourceMgr runs fail, rather than wait
+// for credentials to be typed on the terminal, when a source needs them and
+// they're not to be had otherwise, e.g. from a credential helper. It's meant
+// for CI, where nobody would type them. Like UseSourceMirrors, it must be
+// called before any other methods.
+func (sm *SourceMgr) DisablePrompts() {
+	sm.suprvsr.noPrompt = true
+}
+
+// UseSvnLayouts sets the layouts of the Subversion sources whose URLs have the
+// prefixes in l; any other svn source has the DefaultSvnLayout. Like
+// UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseSvnLayouts(l SvnLayouts) {
+	sm.suprvsr.svnLayouts = l
+}
+
+// UseRetryPolicy sets how the SourceMgr retries the remote operations which
+// fail transiently, rather than as the DefaultRetryPolicy says. Like
+// UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseRetryPolicy(p RetryPolicy) {
+	sm.suprvsr.retry = p
+}
+
+// UseArchives makes the SourceMgr export the revisions of git sources on GitHub
+// and Bitbucket which aren't in its cache dir from archives of them, downloaded
+// over HTTPS, rather than fetch them first, so long as they're known without
+// listing the sources' versions. Should that fail for any reason, they're
+// fetched after all. Like UseSourceMirrors, it must be called before any
+// other methods.
+func (sm *SourceMgr) UseArchives() {
+	client := *sm.deduceCoord.client
+	client.Timeout = archiveTimeout
+	sm.suprvsr.archives = &client
+}
+
+// UseReadOnlyCache makes the SourceMgr copy the sources it needs which aren't
+// in its cache dir from the cache dir dir, if they're there, rather than fetch
+// them; dir is only read, so it may be shared by a team, or be read-only. A
+// copied source is updated from upstream as it would be if it had been in the
+// cache dir all along. Sources which can't be read there are warned of and
+// fetched instead. Like UseSourceMirrors, it must be called before any other
+// methods.
+func (sm *SourceMgr) UseReadOnlyCache(dir string) {
+	sm.suprvsr.readOnly = &readOnlyCache{dir: dir, warn: sm.suprvsr.locks.warn}
+}
+
+// UseLinks sets how the SourceMgr copies files out of its cache dir to export
+// revisions: by cloning, or hard linking, them, rather than copying their
+// contents, where the filesystems allow, which saves time and space when the
+// cache dir and where revisions are exported are on the same one. Sources whose
+// revisions are written by their VCS, such as git ones, aren't affected. Like
+// UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseLinks(mode fs.LinkMode) {
+	sm.suprvsr.links = mode
+}
+
+// UseContext makes the SourceMgr stop what it's doing once ctx is done, as on
+// an interrupt, or a deadline for a whole command: the operations it's running
+// are canceled, and those called after fail, with ctx's error, much as if it
+// had been released. It must still be released, as that waits for them to
+// stop. Like UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseContext(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			sm.cancelAll()
+		case <-sm.suprvsr.ctx.Done():
+		}
+	}()
+}
+
+// UseCallTimeout bounds how long each operation of the SourceMgr, such as
+// fetching a source or listing its versions, may take, retries and all,
+// before it's canceled and fails; d of 0 doesn't bound them. Like
+// UseSourceMirrors, it must be called before any other methods.
+func (sm *SourceMgr) UseCallTimeout(d time.Duration) {
+	sm.suprvsr.timeout = d
+}
+
 // UseDefaultSignalHandling sets up typical os.Interrupt signal handling for a
 // SourceMgr.
 func (sm *SourceMgr) UseDefaultSignalHandling() {
@@ -326,9 +434,9 @@ func (sm *SourceMgr) StopSignalHandling() {
 	sm.sigmut.Unlock()
 }
 
-// CouldNotCreateLockError describe failure modes in which creating a SourceMgr
-// did not succeed because there was an error while attempting to create the
-// on-disk lock file.
+// CouldNotCreateLockError describe failure modes in which creating a SourceMgr,
+// or using a source in its cache dir, did not succeed because there was an
+// error while attempting to create an on-disk lock file.
 type CouldNotCreateLockError struct {
 	Path string
 	Err  error
@@ -338,6 +446,17 @@ func (e CouldNotCreateLockError) Error() string {
 	return e.Err.Error()
 }
 
+// ErrNetworkDisabled is returned by a SourceMgr on which DisableNetwork was
+// called, in place of anything it would have needed the network for.
+type ErrNetworkDisabled struct {
+	Source string // The URL of the source, or the import path, it was for
+	Op     string // What needed the network, e.g. "fetching"
+}
+
+func (e *ErrNetworkDisabled) Error() string {
+	return fmt.Sprintf("%s %s needs the network, which is disabled", e.Op, e.Source)
+}
+
 // Release lets go of any locks held by the SourceManager. Once called, it is no
 // longer safe to call methods against it; all method calls will immediately
 // result in errors.
@@ -362,10 +481,6 @@ func (sm *SourceMgr) doRelease() {
 	sm.cancelAll()
 	sm.suprvsr.wait()
 
-	// Close the file handle for the lock file and remove it from disk
-	sm.lf.Unlock()
-	os.Remove(filepath.Join(sm.cachedir, "sm.lock"))
-
 	// Close the qch, if non-nil, so the signal handlers run out. This will
 	// also deregister the sig channel, if any has been set up.
 	if sm.qch != nil {
@@ -511,6 +626,54 @@ func (sm *SourceMgr) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 	return ProjectRoot(pd.root), err
 }
 
+// RevisionTime reports when the revision r of the project was committed. The
+// local copy of the source is only fetched from upstream if it lacks r.
+func (sm *SourceMgr) RevisionTime(id ProjectIdentifier, r Revision) (time.Time, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return time.Time{}, smIsReleased{}
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return srcg.revisionTime(context.TODO(), r)
+}
+
+// CountCommitsBetween counts the commits of the project which are reachable
+// from the revision to, but not from the revision from. Only git sources can
+// count them; the local copy of the source is only fetched from upstream if it
+// lacks either revision.
+func (sm *SourceMgr) CountCommitsBetween(id ProjectIdentifier, from, to Revision) (int, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return 0, smIsReleased{}
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	return srcg.countCommitsBetween(context.TODO(), from, to)
+}
+
+// SourceOrigin reports the type and URL of the source of the project, setting
+// it up if it isn't already. The DefaultBranch of the ProjectOrigin is left
+// empty, as finding it needs the versions of the source to be listed.
+func (sm *SourceMgr) SourceOrigin(id ProjectIdentifier) (ProjectOrigin, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return ProjectOrigin{}, smIsReleased{}
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	if err != nil {
+		return ProjectOrigin{}, err
+	}
+
+	return srcg.sourceOrigin(context.TODO())
+}
+
 // InferConstraint tries to puzzle out what kind of version is given in a
 // string. Preference is given first for revisions, then branches, then semver
 // constraints, and then plain tags.
@@ -598,6 +761,15 @@ type supervisor struct {
 	cond       sync.Cond  // Wraps mu so callers can wait until all calls end
 	running    map[callInfo]timeCount
 	ran        map[callType]durCount
+	offline    bool           // Whether calls which need the network are disallowed
+	noPrompt   bool           // Whether the commands calls run fail rather than prompt
+	svnLayouts SvnLayouts     // The layouts of svn sources, by URL prefix
+	retry      RetryPolicy    // How remote calls are retried
+	locks      *cacheLocks    // Locks on the sources in the cache dir, if shared
+	archives   *http.Client   // Downloads archives of revisions to export, if set
+	readOnly   *readOnlyCache // Where sources are copied from before fetching, if set
+	links      fs.LinkMode    // How files are copied out of the cache to export revisions
+	timeout    time.Duration  // How long each call may take, if set
 }
 
 func newSupervisor(ctx context.Context) *supervisor {
@@ -607,6 +779,7 @@ func newSupervisor(ctx context.Context) *supervisor {
 		cancelFunc: cf,
 		running:    make(map[callInfo]timeCount),
 		ran:        make(map[callType]durCount),
+		retry:      DefaultRetryPolicy,
 	}
 
 	supv.cond = sync.Cond{L: &supv.mu}
@@ -628,12 +801,35 @@ func (sup *supervisor) do(inctx context.Context, name string, typ callType, f fu
 	}
 
 	cctx, cancelFunc := constext.Cons(inctx, octx)
-	err = f(cctx)
+	if sup.timeout > 0 {
+		var cancelCall context.CancelFunc
+		cctx, cancelCall = context.WithTimeout(cctx, sup.timeout)
+		defer cancelCall()
+	}
+	ctx := cctx
+	if sup.noPrompt {
+		ctx = context.WithValue(cctx, noPromptKey{}, true)
+	}
+	if typ.isRemote() {
+		err = sup.retry.do(ctx, name, func() error { return f(ctx) })
+	} else {
+		err = f(ctx)
+	}
 	sup.done(ci)
 	cancelFunc()
 	return err
 }
 
+// checkNetwork returns an ErrNetworkDisabled for op on the source at u, or the
+// import path u, if the network is disabled. Sources on the local filesystem,
+// with file:// URLs, never need the network.
+func (sup *supervisor) checkNetwork(u, op string) error {
+	if !sup.offline || strings.HasPrefix(u, "file://") {
+		return nil
+	}
+	return &ErrNetworkDisabled{Source: u, Op: op}
+}
+
 func (sup *supervisor) getLifetimeContext() context.Context {
 	return sup.ctx
 }
@@ -719,6 +915,17 @@ const (
 	ctExportTree
 )
 
+// isRemote reports whether calls of the type talk to the upstream of a source,
+// or to the host of an import path, and so are retried if they fail
+// transiently.
+func (ct callType) isRemote() bool {
+	switch ct {
+	case ctHTTPMetadata, ctListVersions, ctSourcePing, ctSourceInit, ctSourceFetch:
+		return true
+	}
+	return false
+}
+
 // callInfo provides metadata about an ongoing call.
 type callInfo struct {
 	name string
@@ -21,6 +21,102 @@ const (
 	innerIndent   = "  "
 )
 
+// A TraceEvent is a step of the solving process, as the solver writes it to
+// SolveParameters.TraceEvents. Event is one of:
+//
+//	root       the root project is selected, importing Packages packages
+//	attempt    a version of Project is to be found, among Versions queued
+//	continue   another version of Project is to be found after backtracking
+//	try        Version of Project is checked against the selected projects
+//	reject     Version of Project is rejected for Reason; see below
+//	select     Version of Project is selected, with Packages of its packages
+//	include    Packages more packages of the selected Project are included
+//	backtrack  Project is backtracked over, for Reason
+//	solved     a solution is found, with Packages packages in all
+//	failed     solving failed, for Reason
+//
+// A rejection over constraints records the Constraint responsible, on
+// Project, or on Dependency if it's a constraint of Version of Project on a
+// dependency which is rejected, and the Constraints of the selected projects
+// it conflicts with.
+type TraceEvent struct {
+	Event       string            `json:"event"`
+	Depth       int               `json:"depth"` // How many projects are selected, including the root
+	Project     string            `json:"project,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Packages    int               `json:"packages,omitempty"`
+	Versions    int               `json:"versions,omitempty"`
+	Dependency  string            `json:"dependency,omitempty"`
+	Constraint  string            `json:"constraint,omitempty"`
+	Constraints []TraceConstraint `json:"constraints,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+}
+
+// A TraceConstraint is a constraint of a selected project on another, which a
+// rejection in a trace conflicts with.
+type TraceConstraint struct {
+	Depender   string `json:"depender"` // The project, at its selected version, or (root)
+	Constraint string `json:"constraint"`
+}
+
+// traceEvent writes e, at the current depth, if trace events are wanted.
+func (s *solver) traceEvent(e TraceEvent) {
+	if s.te == nil {
+		return
+	}
+
+	e.Depth = len(s.sel.projects)
+	// Failing to write the trace isn't a reason to fail solving.
+	s.te.Encode(e)
+}
+
+// traceTry is called when a version of a project is about to be checked.
+func (s *solver) traceTry(id ProjectIdentifier, v Version) {
+	s.traceEvent(TraceEvent{Event: "try", Project: id.errString(), Version: v.String()})
+	s.traceInfo("try %s@%s", id.errString(), v)
+}
+
+// traceReject is called when the atom a was rejected by the checks which
+// produced err.
+func (s *solver) traceReject(a atomWithPackages, err error) {
+	if s.te != nil {
+		e := TraceEvent{
+			Event:   "reject",
+			Project: a.a.id.errString(),
+			Version: a.a.v.String(),
+			Reason:  err.Error(),
+		}
+		tc := func(deps []dependency) {
+			for _, d := range deps {
+				e.Constraints = append(e.Constraints, TraceConstraint{
+					Depender:   a2vs(d.depender),
+					Constraint: d.dep.Constraint.String(),
+				})
+			}
+		}
+		switch f := err.(type) {
+		case *versionNotAllowedFailure:
+			e.Constraint = f.c.String()
+			tc(f.failparent)
+		case *disjointConstraintFailure:
+			e.Dependency = f.goal.dep.Ident.errString()
+			e.Constraint = f.goal.dep.Constraint.String()
+			tc(f.failsib)
+			if len(f.failsib) == 0 {
+				tc(f.nofailsib)
+			}
+		case *constraintNotAllowedFailure:
+			e.Dependency = f.goal.dep.Ident.errString()
+			e.Constraint = f.goal.dep.Constraint.String()
+		case *sourceMismatchFailure:
+			e.Dependency = string(f.shared)
+		}
+		s.traceEvent(e)
+	}
+
+	s.traceInfo(err)
+}
+
 func (s *solver) traceCheckPkgs(bmi bimodalIdentifier) {
 	if s.tl == nil {
 		return
@@ -31,6 +127,11 @@ func (s *solver) traceCheckPkgs(bmi bimodalIdentifier) {
 }
 
 func (s *solver) traceCheckQueue(q *versionQueue, bmi bimodalIdentifier, cont bool, offset int) {
+	event := "attempt"
+	if cont {
+		event = "continue"
+	}
+	s.traceEvent(TraceEvent{Event: event, Project: bmi.id.errString(), Packages: len(bmi.pl), Versions: len(q.pi)})
 	if s.tl == nil {
 		return
 	}
@@ -59,6 +160,11 @@ func (s *solver) traceCheckQueue(q *versionQueue, bmi bimodalIdentifier, cont bo
 // traceStartBacktrack is called with the bmi that first failed, thus initiating
 // backtracking
 func (s *solver) traceStartBacktrack(bmi bimodalIdentifier, err error, pkgonly bool) {
+	if pkgonly {
+		s.traceEvent(TraceEvent{Event: "backtrack", Project: bmi.id.errString(), Packages: len(bmi.pl), Reason: "could not add packages; begin backtrack"})
+	} else {
+		s.traceEvent(TraceEvent{Event: "backtrack", Project: bmi.id.errString(), Reason: "no more versions to try; begin backtrack"})
+	}
 	if s.tl == nil {
 		return
 	}
@@ -77,6 +183,11 @@ func (s *solver) traceStartBacktrack(bmi bimodalIdentifier, err error, pkgonly b
 // traceBacktrack is called when a package or project is poppped off during
 // backtracking
 func (s *solver) traceBacktrack(bmi bimodalIdentifier, pkgonly bool) {
+	if pkgonly {
+		s.traceEvent(TraceEvent{Event: "backtrack", Project: bmi.id.errString(), Packages: len(bmi.pl), Reason: "popped packages"})
+	} else {
+		s.traceEvent(TraceEvent{Event: "backtrack", Project: bmi.id.errString(), Reason: "no more versions to try"})
+	}
 	if s.tl == nil {
 		return
 	}
@@ -94,6 +205,17 @@ func (s *solver) traceBacktrack(bmi bimodalIdentifier, pkgonly bool) {
 
 // Called just once after solving has finished, whether success or not
 func (s *solver) traceFinish(sol solution, err error) {
+	if s.te != nil {
+		if err == nil {
+			var pkgcount int
+			for _, lp := range sol.Projects() {
+				pkgcount += len(lp.pkgs)
+			}
+			s.traceEvent(TraceEvent{Event: "solved", Packages: pkgcount})
+		} else {
+			s.traceEvent(TraceEvent{Event: "failed", Reason: err.Error()})
+		}
+	}
 	if s.tl == nil {
 		return
 	}
@@ -111,13 +233,20 @@ func (s *solver) traceFinish(sol solution, err error) {
 
 // traceSelectRoot is called just once, when the root project is selected
 func (s *solver) traceSelectRoot(ptree pkgtree.PackageTree, cdeps []completeDep) {
+	if s.te != nil {
+		var expkgs int
+		for _, cdep := range cdeps {
+			expkgs += len(cdep.pl)
+		}
+		s.traceEvent(TraceEvent{Event: "root", Project: s.rd.rpt.ImportRoot, Packages: expkgs})
+	}
 	if s.tl == nil {
 		return
 	}
 
 	// This duplicates work a bit, but we're in trace mode and it's only once,
 	// so who cares
-	rm, _ := ptree.ToReachMap(true, true, false, s.rd.ig)
+	rm, _ := ptree.ToReachMap(true, !s.rd.notests, false, s.rd.ig)
 
 	s.tl.Printf("Root project is %q", s.rd.rpt.ImportRoot)
 
@@ -129,11 +258,23 @@ func (s *solver) traceSelectRoot(ptree pkgtree.PackageTree, cdeps []completeDep)
 	// TODO(sdboyer) include info on ignored pkgs/imports, etc.
 	s.tl.Printf(" %v transitively valid internal packages", len(rm))
 	s.tl.Printf(" %v external packages imported from %v projects", expkgs, len(cdeps))
+	for _, pc := range s.rd.ovr.asSortedSlice() {
+		if pc.Constraint != nil {
+			s.tl.Printf(" override on %s: %s", pc.Ident.errString(), pc.Constraint)
+		} else {
+			s.tl.Printf(" override on %s", pc.Ident.errString())
+		}
+	}
 	s.tl.Printf("(0)   " + successCharSp + "select (root)")
 }
 
 // traceSelect is called when an atom is successfully selected
 func (s *solver) traceSelect(awp atomWithPackages, pkgonly bool) {
+	event := "select"
+	if pkgonly {
+		event = "include"
+	}
+	s.traceEvent(TraceEvent{Event: event, Project: awp.a.id.errString(), Version: awp.a.v.String(), Packages: len(awp.pl)})
 	if s.tl == nil {
 		return
 	}
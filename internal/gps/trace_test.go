@@ -0,0 +1,105 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// solveTraceEvents solves the basic fixture named name, and returns the events
+// traced while solving.
+func solveTraceEvents(t *testing.T, name string) []TraceEvent {
+	fix := basicFixtures[name]
+	var buf bytes.Buffer
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            dummyLock{},
+		ProjectAnalyzer: naiveAnalyzer{},
+		TraceEvents:     &buf,
+	}
+	_, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if (err == nil) != (fix.fail == nil) {
+		t.Fatalf("Unexpected result solving %q: %v", name, err)
+	}
+
+	var events []TraceEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e TraceEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("Failed to decode a trace event: %s", err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestTraceEvents(t *testing.T) {
+	events := solveTraceEvents(t, "disjoint constraints")
+	if len(events) == 0 || events[0].Event != "root" {
+		t.Fatalf("Expected the trace to start with the root, got %+v", events)
+	}
+	if last := events[len(events)-1]; last.Event != "failed" || last.Reason == "" {
+		t.Errorf("Expected the trace to end in failure, got %+v", last)
+	}
+
+	// foo is rejected for its constraint on shared, which bar's excludes.
+	var rejects []TraceEvent
+	for _, e := range events {
+		if e.Event == "reject" {
+			rejects = append(rejects, e)
+		}
+	}
+	want := TraceEvent{
+		Event:      "reject",
+		Depth:      2,
+		Project:    "foo",
+		Version:    "1.0.0",
+		Dependency: "shared",
+		Constraint: "<=2.0.0",
+		Constraints: []TraceConstraint{
+			{Depender: "bar@1.0.0", Constraint: ">3.0.0"},
+		},
+	}
+	if len(rejects) != 1 {
+		t.Fatalf("Expected one rejection, got %+v", rejects)
+	}
+	got := rejects[0]
+	if got.Reason == "" {
+		t.Error("Expected the rejection to have a reason")
+	}
+	got.Reason = ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected rejection:\n\t(GOT) %+v\n\t(WNT) %+v", got, want)
+	}
+
+	// Solving succeeds, with every project selected, once the versions of
+	// shared which a's constraint excludes are rejected.
+	events = solveTraceEvents(t, "shared dependency with overlapping constraints")
+	selected := make(map[string]string)
+	for _, e := range events {
+		switch e.Event {
+		case "select":
+			selected[e.Project] = e.Version
+		case "reject":
+			if e.Project != "shared" || len(e.Constraints) == 0 || e.Constraints[0].Depender != "a@1.0.0" {
+				t.Errorf("Unexpected rejection %+v", e)
+			}
+		case "failed":
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+	if last := events[len(events)-1]; last.Event != "solved" {
+		t.Errorf("Expected the trace to end in a solution, got %+v", last)
+	}
+	if want := map[string]string{"a": "1.0.0", "b": "1.0.0", "shared": "3.6.9"}; !reflect.DeepEqual(selected, want) {
+		t.Errorf("Expected %v to be selected, got %v", want, selected)
+	}
+}
@@ -7,6 +7,7 @@ package gps
 import (
 	"context"
 	"encoding/xml"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -24,16 +25,24 @@ type ctxRepo interface {
 	//ping(context.Context) (bool, error)
 }
 
-func newCtxRepo(s vcs.Type, ustr, path string) (r ctxRepo, err error) {
+func newCtxRepo(ctx context.Context, locks *cacheLocks, s vcs.Type, ustr, path string) (r ctxRepo, err error) {
 	r, err = getVCSRepo(s, ustr, path)
 	if err != nil {
 		// if vcs could not initialize the repo due to a local error
 		// then the local repo is in an incorrect state. Remove and
 		// treat it as a new not-yet-cloned repo.
+		//
+		// Unless it's being set up by another process, in which case it's
+		// fine once the lock on it can be had.
 
 		// TODO(marwan-at-work): warn/give progress of the above comment.
-		os.RemoveAll(path)
-		r, err = getVCSRepo(s, ustr, path)
+		err = locks.with(ctx, filepath.Base(path), true, func() (err error) {
+			if r, err = getVCSRepo(s, ustr, path); err != nil {
+				os.RemoveAll(path)
+				r, err = getVCSRepo(s, ustr, path)
+			}
+			return err
+		})
 	}
 
 	return
@@ -53,6 +62,10 @@ func getVCSRepo(s vcs.Type, ustr, path string) (r ctxRepo, err error) {
 		var repo *vcs.HgRepo
 		repo, err = vcs.NewHgRepo(ustr, path)
 		r = &hgRepo{repo}
+	case vcs.Svn:
+		var repo *vcs.SvnRepo
+		repo, err = vcs.NewSvnRepo(ustr, path)
+		r = &svnRepo{repo}
 	}
 
 	return
@@ -89,14 +102,61 @@ func (r *gitRepo) get(ctx context.Context) error {
 }
 
 func (r *gitRepo) fetch(ctx context.Context) error {
-	// Perform a fetch to make sure everything is up to date.
-	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "git", "fetch", "--tags", "--prune", r.RemoteLocation)
+	// Perform a fetch to make sure everything is up to date. A shallow
+	// repository gets the history it lacks, too, to be just like a clone.
+	args := []string{"fetch", "--tags", "--prune"}
+	if r.isShallow() {
+		args = append(args, "--unshallow")
+	}
+	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "git", append(args, r.RemoteLocation)...)
 	if err != nil {
 		return newVcsRemoteErrorOr("unable to update repository", err, string(out))
 	}
 	return nil
 }
 
+// fetchShallow sets up the local repository with only the commit at ref, a
+// ref name or a commit hash, which must be rev, and checks it out. None of the
+// history behind the commit is fetched, until fetch is called. The repository
+// is otherwise laid out like a clone, so that a full fetch completes it.
+func (r *gitRepo) fetchShallow(ctx context.Context, ref string, rev Revision) error {
+	if !r.CheckLocal() {
+		if err := os.MkdirAll(r.LocalPath(), 0777); err != nil {
+			return newVcsLocalErrorOr("unable to create directory", err, "")
+		}
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"remote", "add", "origin", r.Remote()},
+		} {
+			if out, err := runFromRepoDir(ctx, r, defaultCmdTimeout, "git", args...); err != nil {
+				return newVcsLocalErrorOr("unable to set up repository", err, string(out))
+			}
+		}
+	}
+
+	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "git", "fetch", "--depth=1", "origin", ref)
+	if err != nil {
+		return newVcsRemoteErrorOr("unable to fetch "+ref, err, string(out))
+	}
+	// A branch may have moved on since its revision was listed.
+	out, err = runFromRepoDir(ctx, r, defaultCmdTimeout, "git", "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return newVcsLocalErrorOr("unable to read the commit fetched", err, string(out))
+	}
+	if got := strings.TrimSpace(string(out)); got != string(rev) {
+		return newVcsRemoteErrorOr("unable to fetch "+ref, fmt.Errorf("%s is at %s, not %s", ref, got, rev), "")
+	}
+
+	return r.updateVersion(ctx, string(rev))
+}
+
+// isShallow reports whether the local repository lacks history, having been
+// set up by fetchShallow.
+func (r *gitRepo) isShallow() bool {
+	_, err := os.Stat(filepath.Join(r.LocalPath(), ".git", "shallow"))
+	return err == nil
+}
+
 func (r *gitRepo) updateVersion(ctx context.Context, v string) error {
 	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "git", "checkout", v)
 	if err != nil {
@@ -165,6 +225,13 @@ func (r *bzrRepo) updateVersion(ctx context.Context, version string) error {
 	if err != nil {
 		return newVcsLocalErrorOr("unable to update checked out version", err, string(out))
 	}
+
+	// Any changes to the working copy, as made through the hard links of files
+	// exported from it, are discarded, so that it's as committed.
+	out, err = runFromRepoDir(ctx, r, expensiveCmdTimeout, "bzr", "revert", "--no-backup")
+	if err != nil {
+		return newVcsLocalErrorOr("unable to revert changes to checked out version", err, string(out))
+	}
 	return nil
 }
 
@@ -190,7 +257,9 @@ func (r *hgRepo) fetch(ctx context.Context) error {
 }
 
 func (r *hgRepo) updateVersion(ctx context.Context, version string) error {
-	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "hg", "update", version)
+	// --clean discards any changes to the working copy, as made through the
+	// hard links of files exported from it, so that it's as committed.
+	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "hg", "update", "--clean", version)
 	if err != nil {
 		return newVcsRemoteErrorOr("unable to update checked out version", err, string(out))
 	}
@@ -227,6 +296,10 @@ func (r *svnRepo) update(ctx context.Context) error {
 	return err
 }
 
+func (r *svnRepo) fetch(ctx context.Context) error {
+	return r.update(ctx)
+}
+
 func (r *svnRepo) updateVersion(ctx context.Context, version string) error {
 	out, err := runFromRepoDir(ctx, r, expensiveCmdTimeout, "svn", "update", "-r", version)
 	if err != nil {
@@ -66,7 +66,7 @@ func TestNewCtxRepoHappyPath(t *testing.T) {
 		}
 	}()
 
-	_, err = newCtxRepo(vcs.Git, gitRemoteTestRepo, tempDir)
+	_, err = newCtxRepo(context.Background(), nil, vcs.Git, gitRemoteTestRepo, tempDir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,7 +113,7 @@ func TestNewCtxRepoRecovery(t *testing.T) {
 		t.Fatal("expected getVCSRepo to fail when pointing to a corrupt local path. It is possible that vcs.GitNewRepo updated to gracefully handle this test scenario. Check the return of vcs.GitNewRepo.")
 	}
 
-	_, err = newCtxRepo(vcs.Git, gitRemoteTestRepo, tempDir)
+	_, err = newCtxRepo(context.Background(), nil, vcs.Git, gitRemoteTestRepo, tempDir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -7,10 +7,14 @@ package gps
 import (
 	"bytes"
 	"context"
+	"encoding/xml"
 	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,12 +25,20 @@ import (
 
 type baseVCSSource struct {
 	repo ctxRepo
+	// links is how files are copied out of the repository's working copy to
+	// export a revision.
+	links fs.LinkMode
 }
 
 func (bs *baseVCSSource) sourceType() string {
 	return string(bs.repo.Vcs())
 }
 
+// cachePath returns the path of the source's repository in the cache dir.
+func (bs *baseVCSSource) cachePath() string {
+	return bs.repo.LocalPath()
+}
+
 func (bs *baseVCSSource) existsLocally(ctx context.Context) bool {
 	return bs.repo.CheckLocal()
 }
@@ -58,10 +70,22 @@ func (bs *baseVCSSource) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 	return prepManifest(m), l, nil
 }
 
-func (bs *baseVCSSource) revisionPresentIn(r Revision) (bool, error) {
+func (bs *baseVCSSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
 	return bs.repo.IsReference(string(r)), nil
 }
 
+func (bs *baseVCSSource) revisionTime(ctx context.Context, r Revision) (time.Time, error) {
+	ci, err := bs.repo.CommitInfo(string(r))
+	if err != nil {
+		return time.Time{}, unwrapVcsErr(err)
+	}
+	return ci.Date, nil
+}
+
+func (bs *baseVCSSource) countCommitsBetween(ctx context.Context, from, to Revision) (int, error) {
+	return 0, fmt.Errorf("counting commits is not supported for %s sources", bs.sourceType())
+}
+
 // initLocal clones/checks out the upstream repository to disk for the first
 // time.
 func (bs *baseVCSSource) initLocal(ctx context.Context) error {
@@ -107,7 +131,7 @@ func (bs *baseVCSSource) exportRevisionTo(ctx context.Context, r Revision, to st
 		return unwrapVcsErr(err)
 	}
 
-	return fs.CopyDir(bs.repo.LocalPath(), to)
+	return fs.CopyDirLinked(bs.repo.LocalPath(), to, bs.links)
 }
 
 // gitSource is a generic git repository implementation that should work with
@@ -116,6 +140,10 @@ type gitSource struct {
 	baseVCSSource
 }
 
+// readsCacheOnly marks gitSource as a cacheReader: it lists its versions
+// upstream, and exports revisions without checking them out.
+func (s *gitSource) readsCacheOnly() {}
+
 func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to string) error {
 	r := s.repo
 
@@ -123,17 +151,18 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 		return err
 	}
 
-	// Back up original index
-	idx, bak := filepath.Join(r.LocalPath(), ".git", "index"), filepath.Join(r.LocalPath(), ".git", "origindex")
-	err := fs.RenameWithFallback(idx, bak)
+	// Read the revision into an index of our own, rather than the one of the
+	// repository, which would have to be backed up and restored, so that the
+	// repository isn't changed, and other processes may export from it at the
+	// same time.
+	tmp, err := ioutil.TempDir("", "dep-export")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(tmp)
+	env := "GIT_INDEX_FILE=" + filepath.Join(tmp, "index")
 
-	// could have an err here...but it's hard to imagine how?
-	defer fs.RenameWithFallback(bak, idx)
-
-	out, err := runFromRepoDir(ctx, r, defaultCmdTimeout, "git", "read-tree", rev.String())
+	out, err := runFromRepoDirWithEnv(ctx, r, defaultCmdTimeout, env, "git", "read-tree", rev.String())
 	if err != nil {
 		return fmt.Errorf("%s: %s", out, err)
 	}
@@ -149,7 +178,7 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 	// though we have a bunch of housekeeping to do to set up, then tear
 	// down, the sparse checkout controls, as well as restore the original
 	// index and HEAD.
-	out, err = runFromRepoDir(ctx, r, defaultCmdTimeout, "git", "checkout-index", "-a", "--prefix="+to)
+	out, err = runFromRepoDirWithEnv(ctx, r, defaultCmdTimeout, env, "git", "checkout-index", "-a", "--prefix="+to)
 	if err != nil {
 		return fmt.Errorf("%s: %s", out, err)
 	}
@@ -157,17 +186,70 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 	return nil
 }
 
+// fetchShallow sets up the local copy of the source with only the commit r,
+// rather than clone the source's whole history just to export it. The commit
+// is fetched by the name of the branch or tag v, if it is one, as servers
+// needn't allow fetching commits by hash, and by its hash otherwise. If
+// neither works, the partial local copy is removed, for the source to be
+// cloned in full instead.
+func (s *gitSource) fetchShallow(ctx context.Context, v Version, r Revision) error {
+	gr, ok := s.repo.(*gitRepo)
+	if !ok {
+		return fmt.Errorf("%s can't be fetched shallowly", s.upstreamURL())
+	}
+
+	var refs []string
+	if pv, ok := v.(PairedVersion); ok {
+		switch uv := pv.Unpair(); uv.Type() {
+		case IsBranch:
+			refs = append(refs, "refs/heads/"+uv.String())
+		case IsVersion, IsSemver:
+			refs = append(refs, "refs/tags/"+uv.String())
+		}
+	}
+	refs = append(refs, string(r))
+
+	var err error
+	for _, ref := range refs {
+		if err = gr.fetchShallow(ctx, ref, r); err == nil {
+			return nil
+		}
+	}
+	os.RemoveAll(gr.LocalPath())
+	return unwrapVcsErr(err)
+}
+
+// isShallow reports whether the local copy of the source lacks history, as
+// fetchShallow set it up.
+func (s *gitSource) isShallow() bool {
+	gr, ok := s.repo.(*gitRepo)
+	return ok && gr.isShallow()
+}
+
+func (s *gitSource) countCommitsBetween(ctx context.Context, from, to Revision) (int, error) {
+	out, err := runFromRepoDir(ctx, s.repo, defaultCmdTimeout, "git", "rev-list", "--count", string(from)+".."+string(to))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", out, err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
 func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, err error) {
 	r := s.repo
 
 	var out []byte
-	c := newMonitoredCmd(exec.Command("git", "ls-remote", r.Remote()), 30*time.Second)
-	// Ensure no prompting for PWs
-	c.cmd.Env = mergeEnvLists([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ())
+	// The environment is left alone, so that credential helpers and askpass
+	// programs work for private sources; the SourceMgr disables prompts.
+	c := newMonitoredCmd(exec.Command("git", "ls-remote", "--symref", r.Remote()), 30*time.Second)
 	out, err = c.combinedOutput(ctx)
+	if err != nil && bytes.Contains(out, []byte("symref")) {
+		// git before 2.8 has no --symref.
+		c = newMonitoredCmd(exec.Command("git", "ls-remote", r.Remote()), 30*time.Second)
+		out, err = c.combinedOutput(ctx)
+	}
 
 	if err != nil {
-		return nil, err
+		return nil, newVcsRemoteErrorOr("unable to list versions", err, string(out))
 	}
 
 	all := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
@@ -175,11 +257,25 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 		return nil, fmt.Errorf("no data returned from ls-remote")
 	}
 
-	// Pull out the HEAD rev (it's always first) so we know what branches to
-	// mark as default. This is, perhaps, not the best way to glean this, but it
-	// was good enough for git itself until 1.8.5. Also, the alternative is
-	// sniffing data out of the pack protocol, which is a separate request, and
-	// also waaaay more than we want to do right now.
+	// The remote names the branch its HEAD points at first, as in
+	// "ref: refs/heads/main\tHEAD", and that's the default branch, whatever
+	// it's called.
+	var defbranch string
+	if bytes.HasPrefix(all[0], []byte("ref: refs/heads/")) {
+		ref := bytes.SplitN(all[0], []byte("\t"), 2)[0]
+		defbranch = string(bytes.TrimPrefix(ref, []byte("ref: refs/heads/")))
+		all = all[1:]
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no data returned from ls-remote")
+	}
+
+	// Older servers don't say what HEAD points at, so pull out the HEAD rev
+	// (it's always first) so we know what branches to mark as default. This
+	// is, perhaps, not the best way to glean this, but it was good enough for
+	// git itself until 1.8.5. Also, the alternative is sniffing data out of
+	// the pack protocol, which is a separate request, and also waaaay more
+	// than we want to do right now.
 	//
 	// The cost is that we could potentially have multiple branches marked as
 	// the default. If that does occur, a later check (again, emulating git
@@ -207,13 +303,16 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 	smap := make(map[string]bool)
 	uniq := 0
 	vlist = make([]PairedVersion, len(all)-1) // less 1, because always ignore HEAD
-	for _, pair := range all {
+	for _, pair := range all[1:] {
 		var v PairedVersion
 		if string(pair[46:51]) == "heads" {
 			rev := Revision(pair[:40])
 
-			isdef := rev == headrev
 			n := string(pair[52:])
+			isdef := rev == headrev
+			if defbranch != "" {
+				isdef = n == defbranch
+			}
 			if isdef {
 				if onedef {
 					multidef = true
@@ -333,6 +432,15 @@ func (s *gopkginSource) listVersions(ctx context.Context) ([]PairedVersion, erro
 	}
 
 	vlist = vlist[:k]
+	if k == 0 && s.major == 0 && !s.unstable {
+		// gopkg.in serves the default branch for v0 when nothing is of v0.
+		for _, v := range ovlist {
+			if bv, ok := v.(versionPair).v.(branchVersion); ok && bv.isDefault {
+				vlist = append(vlist, v)
+			}
+		}
+		return vlist, nil
+	}
 	if bsv != (semver.Version{}) {
 		dbv := vlist[dbranch].(versionPair)
 		vlist[dbranch] = branchVersion{
@@ -537,6 +645,348 @@ func (s *hgSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 	return vlist, nil
 }
 
+// SvnLayout names the dirs of a Subversion source which hold its branches and
+// tags, as svn has no notion of either: its default branch is the dir Trunk,
+// and its other branches and its tags are the dirs in Branches and Tags. Each
+// is a dir directly under the URL of the source; Branches or Tags may be empty
+// for a source without any. An empty Trunk means the source has no layout at
+// all, and its URL is its only branch, named "default".
+type SvnLayout struct {
+	Trunk, Branches, Tags string
+}
+
+// DefaultSvnLayout is the conventional layout of a Subversion repository.
+var DefaultSvnLayout = SvnLayout{Trunk: "trunk", Branches: "branches", Tags: "tags"}
+
+// SvnLayouts gives the layouts of Subversion sources by the prefixes of their
+// URLs. A source none of the prefixes match has the DefaultSvnLayout.
+type SvnLayouts map[string]SvnLayout
+
+// layoutFor returns the layout of the svn source at the URL u: that of the
+// longest prefix of u in l, if any, or else the default.
+func (l SvnLayouts) layoutFor(u string) SvnLayout {
+	layout, longest := DefaultSvnLayout, -1
+	for prefix, pl := range l {
+		if len(prefix) > longest && strings.HasPrefix(u, prefix) {
+			layout, longest = pl, len(prefix)
+		}
+	}
+	return layout
+}
+
+// svnSource is a Subversion repository, whose branches and tags are dirs in it
+// laid out as its SvnLayout says. A revision of svn is a number for a commit to
+// the whole repository, so a version is paired with the last revision which
+// changed its dir, and a revision is mapped back to the dir it changed for its
+// tree to be had. The local copy of the source is a sparse checkout of its
+// URL, into which only the dirs of the revisions needed are checked out.
+type svnSource struct {
+	baseVCSSource
+	layout SvnLayout
+
+	// relPath is the path of the source's URL within its repository, which
+	// the paths a commit changed are relative to; it's looked up once.
+	relPath string
+	hasRel  bool
+}
+
+// svnEntry is a file or dir in the XML output of svn info and svn ls.
+type svnEntry struct {
+	Kind   string `xml:"kind,attr"`
+	Name   string `xml:"name"`
+	URL    string `xml:"url"`
+	Root   string `xml:"repository>root"`
+	Commit struct {
+		Revision string `xml:"revision,attr"`
+		Date     string `xml:"date"`
+	} `xml:"commit"`
+}
+
+// svnNoRevisionError is returned for a revision which isn't that of a single
+// branch or tag of an svn source, or isn't in its repository at all.
+type svnNoRevisionError string
+
+func (e svnNoRevisionError) Error() string {
+	return string(e)
+}
+
+// svn runs svn with args from the current dir, for commands which work on
+// URLs, and returns its output. Only stdout is returned, as it's XML to be
+// parsed; stderr is in the error, if any.
+func (s *svnSource) svn(ctx context.Context, args ...string) ([]byte, error) {
+	c := newMonitoredCmd(exec.Command("svn", args...), expensiveCmdTimeout)
+	if err := c.run(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, c.stderr.Bytes())
+	}
+	return c.stdout.Bytes(), nil
+}
+
+// url returns the URL of the dir of the source, relative to its root.
+func (s *svnSource) url(dir string) string {
+	u := strings.TrimSuffix(s.repo.Remote(), "/")
+	if dir != "" {
+		u += "/" + dir
+	}
+	return u
+}
+
+// list lists the dirs in the dir of the source.
+func (s *svnSource) list(ctx context.Context, dir string) ([]svnEntry, error) {
+	out, err := s.svn(ctx, "ls", "--xml", s.url(dir))
+	if err != nil {
+		return nil, err
+	}
+	var lists struct {
+		Entries []svnEntry `xml:"list>entry"`
+	}
+	if err := xml.Unmarshal(out, &lists); err != nil {
+		return nil, fmt.Errorf("unable to parse the entries of %s: %s", s.url(dir), err)
+	}
+	dirs := lists.Entries[:0]
+	for _, e := range lists.Entries {
+		if e.Kind == "dir" {
+			dirs = append(dirs, e)
+		}
+	}
+	return dirs, nil
+}
+
+// info returns the entry of the URL u, which may be pegged at a revision, as
+// u@rev.
+func (s *svnSource) info(ctx context.Context, u string) (svnEntry, error) {
+	out, err := s.svn(ctx, "info", "--xml", u)
+	if err != nil {
+		return svnEntry{}, err
+	}
+	var info struct {
+		Entries []svnEntry `xml:"entry"`
+	}
+	if err := xml.Unmarshal(out, &info); err != nil || len(info.Entries) != 1 {
+		return svnEntry{}, fmt.Errorf("unable to parse the info of %s: %v", u, err)
+	}
+	return info.Entries[0], nil
+}
+
+func (s *svnSource) existsUpstream(ctx context.Context) bool {
+	return s.repo.Ping()
+}
+
+// initLocal checks out the source's URL without any of its contents; the dirs
+// of its revisions are checked out as they're needed.
+func (s *svnSource) initLocal(ctx context.Context) error {
+	out, err := runFromCwd(ctx, expensiveCmdTimeout, "svn", "checkout", "--depth", "empty", s.repo.Remote(), s.repo.LocalPath())
+	if err != nil {
+		return unwrapVcsErr(newVcsRemoteErrorOr("unable to get repository", err, string(out)))
+	}
+	return nil
+}
+
+// updateLocal does nothing, as revisions are checked out from upstream as
+// they're needed, and versions are listed from there.
+func (s *svnSource) updateLocal(ctx context.Context) error {
+	return nil
+}
+
+func (s *svnSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	l := s.layout
+	if l.Trunk == "" {
+		e, err := s.info(ctx, s.url(""))
+		if err != nil {
+			return nil, err
+		}
+		return []PairedVersion{newDefaultBranch("default").Pair(Revision(e.Commit.Revision))}, nil
+	}
+
+	// The layout's dirs are found, with the revision of trunk, by listing the
+	// source's URL; the branches and tags are then listed in theirs.
+	top, err := s.list(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var vlist []PairedVersion
+	var hasTrunk bool
+	for _, e := range top {
+		switch e.Name {
+		case l.Trunk:
+			hasTrunk = true
+			vlist = append(vlist, newDefaultBranch(l.Trunk).Pair(Revision(e.Commit.Revision)))
+		case l.Branches, l.Tags:
+			if e.Name == "" {
+				continue
+			}
+			entries, err := s.list(ctx, e.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, be := range entries {
+				var uv UnpairedVersion = NewVersion(be.Name)
+				if e.Name == l.Branches {
+					uv = NewBranch(be.Name)
+				}
+				vlist = append(vlist, uv.Pair(Revision(be.Commit.Revision)))
+			}
+		}
+	}
+	if !hasTrunk {
+		return nil, fmt.Errorf("no %s dir in %s; is its layout set?", l.Trunk, s.url(""))
+	}
+	return vlist, nil
+}
+
+// dirOf returns the dir of the branch or tag which the revision r changed,
+// which is that of the version paired with r. It's "" for a source without a
+// layout.
+func (s *svnSource) dirOf(ctx context.Context, r Revision) (string, error) {
+	if _, err := strconv.ParseUint(string(r), 10, 64); err != nil {
+		return "", svnNoRevisionError(fmt.Sprintf("%q is not a revision of svn", r))
+	}
+	l := s.layout
+	if l.Trunk == "" {
+		return "", nil
+	}
+
+	if !s.hasRel {
+		e, err := s.info(ctx, s.url(""))
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return "", err
+		}
+		root, err := url.Parse(e.Root)
+		if err != nil {
+			return "", err
+		}
+		s.relPath, s.hasRel = strings.TrimPrefix(u.Path, root.Path), true
+	}
+
+	out, err := s.svn(ctx, "log", "--xml", "-v", "-r", string(r), s.url(""))
+	if err != nil {
+		// E160006 is svn's "No such revision", and E195012 its "Unable to
+		// find repository location", for revisions from before the URL was.
+		if strings.Contains(err.Error(), "E160006") || strings.Contains(err.Error(), "E195012") {
+			return "", svnNoRevisionError(err.Error())
+		}
+		return "", err
+	}
+	var log struct {
+		Entries []struct {
+			Paths []string `xml:"paths>path"`
+		} `xml:"logentry"`
+	}
+	if err := xml.Unmarshal(out, &log); err != nil {
+		return "", fmt.Errorf("unable to parse the log of revision %s of %s: %s", r, s.url(""), err)
+	}
+
+	dirs := make(map[string]bool)
+	for _, e := range log.Entries {
+		for _, p := range e.Paths {
+			if !strings.HasPrefix(p, s.relPath+"/") {
+				continue
+			}
+			parts := strings.Split(strings.TrimPrefix(p, s.relPath+"/"), "/")
+			switch {
+			case parts[0] == l.Trunk:
+				dirs[l.Trunk] = true
+			case len(parts) > 1 && parts[0] != "" && (parts[0] == l.Branches || parts[0] == l.Tags):
+				dirs[parts[0]+"/"+parts[1]] = true
+			}
+		}
+	}
+	if len(dirs) != 1 {
+		return "", svnNoRevisionError(fmt.Sprintf("revision %s of %s changed %d of its branches and tags, rather than one", r, s.url(""), len(dirs)))
+	}
+	var dir string
+	for d := range dirs {
+		dir = d
+	}
+	return dir, nil
+}
+
+// checkout checks out the dir of the revision r, at r, into the local copy of
+// the source, and returns its path there.
+func (s *svnSource) checkout(ctx context.Context, r Revision) (string, error) {
+	dir, err := s.dirOf(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"update", "--set-depth", "infinity", "-r", string(r)}
+	if dir == "" {
+		args = append(args, ".")
+	} else {
+		args = append(args, "--parents", dir)
+	}
+	out, err := runFromRepoDir(ctx, s.repo, expensiveCmdTimeout, "svn", args...)
+	if err != nil {
+		return "", unwrapVcsErr(newVcsRemoteErrorOr("unable to update checked out version", err, string(out)))
+	}
+	return filepath.Join(s.repo.LocalPath(), filepath.FromSlash(dir)), nil
+}
+
+func (s *svnSource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (Manifest, Lock, error) {
+	path, err := s.checkout(ctx, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, l, err := an.DeriveManifestAndLock(path, pr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+
+	return prepManifest(m), l, nil
+}
+
+func (s *svnSource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (pkgtree.PackageTree, error) {
+	path, err := s.checkout(ctx, r)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return pkgtree.ListPackages(path, string(pr))
+}
+
+// revisionPresentIn reports whether r is the revision of a branch or tag of
+// the source, if not necessarily the latest.
+func (s *svnSource) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	_, err := s.dirOf(ctx, r)
+	if _, ok := err.(svnNoRevisionError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *svnSource) revisionTime(ctx context.Context, r Revision) (time.Time, error) {
+	dir, err := s.dirOf(ctx, r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	e, err := s.info(ctx, s.url(dir)+"@"+string(r))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, e.Commit.Date)
+}
+
+// exportRevisionTo exports the dir of the revision r with svn export. The dir
+// is pegged at r, as it may since have been deleted or replaced.
+func (s *svnSource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	dir, err := s.dirOf(ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	_, err = s.svn(ctx, "export", "--force", s.url(dir)+"@"+string(r), to)
+	return err
+}
+
 type repo struct {
 	// Object for direct repo interaction
 	r ctxRepo
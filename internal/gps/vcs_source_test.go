@@ -5,8 +5,11 @@
 package gps
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/url"
 	"os"
 	"os/exec"
@@ -16,6 +19,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/Masterminds/vcs"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -66,7 +70,7 @@ func testGitSourceInteractions(t *testing.T) {
 
 	ctx := context.Background()
 	superv := newSupervisor(ctx)
-	isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+	isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), nil, superv)
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
 	}
@@ -97,13 +101,27 @@ func testGitSourceInteractions(t *testing.T) {
 
 	vlist := hidePair(pvlist)
 	// check that an expected rev is present
-	is, err := src.revisionPresentIn(Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"))
+	is, err := src.revisionPresentIn(ctx, Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"))
 	if err != nil {
 		t.Errorf("Unexpected error while checking revision presence: %s", err)
 	} else if !is {
 		t.Errorf("Revision that should exist was not present")
 	}
 
+	rt, err := src.revisionTime(ctx, Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"))
+	if err != nil {
+		t.Errorf("Unexpected error while getting the commit time of a revision: %s", err)
+	} else if rt.IsZero() {
+		t.Errorf("Expected the commit time of the revision to be reported")
+	}
+
+	count, err := src.countCommitsBetween(ctx, Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"), Revision("4a54adf81c75375d26d376459c00d5ff9b703e5e"))
+	if err != nil {
+		t.Errorf("Unexpected error while counting commits: %s", err)
+	} else if count != 0 {
+		t.Errorf("Expected no commits between a revision and itself, got %d", count)
+	}
+
 	if len(vlist) != 7 {
 		t.Errorf("git test repo should've produced seven versions, got %v: vlist was %s", len(vlist), vlist)
 	} else {
@@ -123,7 +141,7 @@ func testGitSourceInteractions(t *testing.T) {
 	}
 
 	// recheck that rev is present, this time interacting with cache differently
-	is, err = src.revisionPresentIn(Revision("30605f6ac35fcb075ad0bfa9296f90a7d891523e"))
+	is, err = src.revisionPresentIn(ctx, Revision("30605f6ac35fcb075ad0bfa9296f90a7d891523e"))
 	if err != nil {
 		t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 	} else if !is {
@@ -167,7 +185,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 
 		ctx := context.Background()
 		superv := newSupervisor(ctx)
-		isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+		isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), nil, superv)
 		if err != nil {
 			t.Errorf("Unexpected error while setting up gopkginSource for test repo: %s", err)
 			return
@@ -198,7 +216,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 
 		// check that an expected rev is present
 		rev := evl[0].(PairedVersion).Revision()
-		is, err := src.revisionPresentIn(rev)
+		is, err := src.revisionPresentIn(ctx, rev)
 		if err != nil {
 			t.Errorf("Unexpected error while checking revision presence: %s", err)
 		} else if !is {
@@ -237,7 +255,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 		}
 
 		// recheck that rev is present, this time interacting with cache differently
-		is, err = src.revisionPresentIn(rev)
+		is, err = src.revisionPresentIn(ctx, rev)
 		if err != nil {
 			t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 		} else if !is {
@@ -313,7 +331,7 @@ func testBzrSourceInteractions(t *testing.T) {
 
 	ctx := context.Background()
 	superv := newSupervisor(ctx)
-	isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+	isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), nil, superv)
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up bzrSource for test repo: %s", err)
 	}
@@ -345,7 +363,7 @@ func testBzrSourceInteractions(t *testing.T) {
 	}
 
 	// check that an expected rev is present
-	is, err := src.revisionPresentIn(Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
+	is, err := src.revisionPresentIn(ctx, Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
 	if err != nil {
 		t.Errorf("Unexpected error while checking revision presence: %s", err)
 	} else if !is {
@@ -384,7 +402,7 @@ func testBzrSourceInteractions(t *testing.T) {
 	}
 
 	// recheck that rev is present, this time interacting with cache differently
-	is, err = src.revisionPresentIn(Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
+	is, err = src.revisionPresentIn(ctx, Revision("matt@mattfarina.com-20150731135137-pbphasfppmygpl68"))
 	if err != nil {
 		t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 	} else if !is {
@@ -424,7 +442,7 @@ func testHgSourceInteractions(t *testing.T) {
 
 		ctx := context.Background()
 		superv := newSupervisor(ctx)
-		isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+		isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), nil, superv)
 		if err != nil {
 			t.Errorf("Unexpected error while setting up hgSource for test repo: %s", err)
 			return
@@ -454,7 +472,7 @@ func testHgSourceInteractions(t *testing.T) {
 		}
 
 		// check that an expected rev is present
-		is, err := src.revisionPresentIn(Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
+		is, err := src.revisionPresentIn(ctx, Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
 		if err != nil {
 			t.Errorf("Unexpected error while checking revision presence: %s", err)
 		} else if !is {
@@ -493,7 +511,7 @@ func testHgSourceInteractions(t *testing.T) {
 		}
 
 		// recheck that rev is present, this time interacting with cache differently
-		is, err = src.revisionPresentIn(Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
+		is, err = src.revisionPresentIn(ctx, Revision("103d1bddef2199c80aad7c42041223083d613ef9"))
 		if err != nil {
 			t.Errorf("Unexpected error while re-checking revision presence: %s", err)
 		} else if !is {
@@ -551,7 +569,7 @@ func Test_bzrSource_exportRevisionTo_removeVcsFiles(t *testing.T) {
 
 	ctx := context.Background()
 	superv := newSupervisor(ctx)
-	isrc, _, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+	isrc, _, err := mb.try(ctx, cpath, newMemoryCache(), nil, superv)
 	if err != nil {
 		t.Fatalf("unexpected error while setting up hgSource for test repo: %s", err)
 	}
@@ -605,7 +623,7 @@ func Test_hgSource_exportRevisionTo_removeVcsFiles(t *testing.T) {
 
 	ctx := context.Background()
 	superv := newSupervisor(ctx)
-	isrc, _, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+	isrc, _, err := mb.try(ctx, cpath, newMemoryCache(), nil, superv)
 	if err != nil {
 		t.Fatalf("unexpected error while setting up hgSource for test repo: %s", err)
 	}
@@ -641,3 +659,369 @@ func requiresBins(t *testing.T, bins ...string) {
 		}
 	}
 }
+
+// mkGitHistory creates a git repository with n commits, each rewriting the
+// file data with size random bytes after a line naming the commit, and tags
+// the last v1.0.0. It returns the dir of the repository and the revisions of
+// the commits, oldest first.
+func mkGitHistory(tb testing.TB, n, size int) (string, []Revision) {
+	dir, err := ioutil.TempDir("", "githistory")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			tb.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	git("init", "-q")
+	revs := make([]Revision, n)
+	data := make([]byte, size)
+	for i := range revs {
+		rand.New(rand.NewSource(int64(i))).Read(data)
+		content := append([]byte(fmt.Sprintf("commit %d\n", i)), data...)
+		if err := ioutil.WriteFile(filepath.Join(dir, "data"), content, 0666); err != nil {
+			tb.Fatal(err)
+		}
+		git("add", "data")
+		git("-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", fmt.Sprintf("Commit %d", i))
+		revs[i] = Revision(git("rev-parse", "HEAD"))
+	}
+	git("tag", "v1.0.0")
+	return dir, revs
+}
+
+// checkExportedCommit checks that the commit numbered i by mkGitHistory was
+// exported to dir.
+func checkExportedCommit(t *testing.T, dir string, i int) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatalf("Expected the data of commit %d to be exported: %s", i, err)
+	}
+	if want := fmt.Sprintf("commit %d\n", i); !bytes.HasPrefix(b, []byte(want)) {
+		t.Errorf("Expected the data of commit %d to be exported, got %q", i, b[:bytes.IndexByte(b, '\n')+1])
+	}
+}
+
+func TestGitSourceShallowExport(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, revs := mkGitHistory(t, 3, 16)
+	defer os.RemoveAll(dir)
+	u := "file://" + filepath.ToSlash(dir)
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: u}
+
+	export := func(sm *SourceMgr, v Version, i int) {
+		to, err := ioutil.TempDir("", "export")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(to)
+		if err := sm.ExportProject(id, v, to); err != nil {
+			t.Fatalf("Unexpected error exporting %s: %s", v, err)
+		}
+		checkExportedCommit(t, to, i)
+	}
+	isShallow := func(sm *SourceMgr) bool {
+		_, err := os.Stat(filepath.Join(sourceCachePath(sm.cachedir, u), ".git", "shallow"))
+		return err == nil
+	}
+
+	// The tag is fetched alone, rather than the whole history cloned.
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	export(sm, NewVersion("v1.0.0").Pair(revs[2]), 2)
+	if !isShallow(sm) {
+		t.Error("Expected the source to be fetched shallowly")
+	}
+
+	// An older revision isn't there, so the rest of the history is fetched,
+	// leaving a full clone.
+	export(sm, revs[1], 1)
+	if isShallow(sm) {
+		t.Error("Expected the source to be fetched in full for an older revision")
+	}
+
+	// A branch which has since moved on is fetched by the hash of the
+	// revision instead.
+	sm2, clean2 := mkNaiveSM(t)
+	defer clean2()
+	export(sm2, NewBranch("master").Pair(revs[1]), 1)
+	if !isShallow(sm2) {
+		t.Error("Expected the revision of the branch to be fetched shallowly")
+	}
+
+	// Counting commits needs the history.
+	n, err := sm2.CountCommitsBetween(id, revs[0], revs[2])
+	if err != nil {
+		t.Fatalf("Unexpected error counting commits: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 commits between the first and last, got %d", n)
+	}
+	if isShallow(sm2) {
+		t.Error("Expected the source to be fetched in full to count commits")
+	}
+}
+
+// TestGopkginSourceVersions checks that a gopkg.in source lists only the
+// versions of the major version its path names, and its default branch for
+// v0 when nothing is of v0, as gopkg.in serves.
+func TestGopkginSourceVersions(t *testing.T) {
+	requiresBins(t, "git")
+
+	dir, revs := mkGitHistory(t, 2, 64)
+	defer os.RemoveAll(dir)
+	cachedir, err := ioutil.TempDir("", "gopkginversions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachedir)
+	ctx := context.Background()
+
+	tagged := revs[len(revs)-1]
+	cases := []struct {
+		major uint64
+		want  []Version
+	}{
+		{0, []Version{newDefaultBranch("master").Pair(tagged)}},
+		{1, []Version{NewVersion("v1.0.0").Pair(tagged)}},
+		{2, nil},
+	}
+	for _, c := range cases {
+		u := "file://" + filepath.ToSlash(dir)
+		repo, err := newCtxRepo(ctx, nil, vcs.Git, u, filepath.Join(cachedir, fmt.Sprint(c.major)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := &gopkginSource{gitSource: gitSource{baseVCSSource{repo: repo}}, major: c.major}
+		pvl, err := src.listVersions(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error listing the versions of v%d: %s", c.major, err)
+		}
+		if got := hidePair(pvl); !reflect.DeepEqual(got, c.want) && (len(got) != 0 || len(c.want) != 0) {
+			t.Errorf("Expected the versions of v%d to be %s, got %s", c.major, c.want, got)
+		}
+	}
+}
+
+func TestGitSourceDefaultBranch(t *testing.T) {
+	requiresBins(t, "git")
+
+	// The default branch is main, and develop is at the same revision, so the
+	// revision of HEAD alone can't tell them apart.
+	dir, revs := mkGitHistory(t, 1, 16)
+	defer os.RemoveAll(dir)
+	for _, args := range [][]string{{"branch", "-m", "main"}, {"branch", "develop"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, out)
+		}
+	}
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: "file://" + filepath.ToSlash(dir)}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	vlist, err := sm.ListVersions(id)
+	if err != nil {
+		t.Fatalf("Unexpected error listing versions: %s", err)
+	}
+
+	var defaults []string
+	for _, v := range vlist {
+		if v.Type() == IsBranch && v.String() == "master" {
+			t.Error("Expected no master branch")
+		}
+		if IsDefaultBranch(v) {
+			defaults = append(defaults, v.String())
+			if v.Revision() != revs[0] {
+				t.Errorf("Expected the default branch at %s, got %s", revs[0], v.Revision())
+			}
+		}
+	}
+	if len(defaults) != 1 || defaults[0] != "main" {
+		t.Errorf("Expected main to be the only default branch, got %v", defaults)
+	}
+}
+
+// BenchmarkGitSourceExport compares exporting the tagged revision of a source
+// with a long history from a full clone of it, and from a shallow fetch of
+// just that revision.
+func BenchmarkGitSourceExport(b *testing.B) {
+	if _, err := exec.LookPath("git"); err != nil {
+		b.Skip("git is not installed")
+	}
+
+	dir, revs := mkGitHistory(b, 200, 32*1024)
+	defer os.RemoveAll(dir)
+	u := "file://" + filepath.ToSlash(dir)
+	rev := revs[len(revs)-1]
+	ctx := context.Background()
+
+	run := func(b *testing.B, fetch func(*gitSource) error) {
+		for i := 0; i < b.N; i++ {
+			cachedir, err := ioutil.TempDir("", "smcache")
+			if err != nil {
+				b.Fatal(err)
+			}
+			r, err := newCtxRepo(context.Background(), nil, vcs.Git, u, sourceCachePath(cachedir, u))
+			if err != nil {
+				b.Fatal(err)
+			}
+			src := &gitSource{baseVCSSource: baseVCSSource{repo: r}}
+			if err := fetch(src); err != nil {
+				b.Fatal(err)
+			}
+			if err := src.exportRevisionTo(ctx, rev, filepath.Join(cachedir, "export")); err != nil {
+				b.Fatal(err)
+			}
+			os.RemoveAll(cachedir)
+		}
+	}
+
+	b.Run("full", func(b *testing.B) {
+		run(b, func(src *gitSource) error { return src.initLocal(ctx) })
+	})
+	b.Run("shallow", func(b *testing.B) {
+		run(b, func(src *gitSource) error { return src.fetchShallow(ctx, NewVersion("v1.0.0").Pair(rev), rev) })
+	})
+}
+
+// mkSvnRepo creates a Subversion repository with the default layout: its
+// first revision adds trunk with the package pkg, the second tags it v1.0.0,
+// and the third changes it in trunk. It returns the dir of the repository.
+func mkSvnRepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "svnrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(cmd string, args ...string) {
+		c := exec.Command(cmd, args...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("%s %v failed: %s\n%s", cmd, args, err, out)
+		}
+	}
+	write := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "wc", "trunk", "pkg", "pkg.go"), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("svnadmin", "create", "repo")
+	u := "file://" + filepath.ToSlash(filepath.Join(dir, "repo"))
+	run("svn", "checkout", "-q", u, "wc")
+	for _, d := range []string{"trunk/pkg", "branches", "tags"} {
+		if err := os.MkdirAll(filepath.Join(dir, "wc", filepath.FromSlash(d)), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("package pkg\n")
+	run("svn", "add", "-q", "wc/trunk", "wc/branches", "wc/tags")
+	run("svn", "commit", "-q", "-m", "Add trunk", "wc")
+	run("svn", "copy", "-q", "-m", "Tag v1.0.0", u+"/trunk", u+"/tags/v1.0.0")
+	write("package pkg\n\nconst Version = 2\n")
+	run("svn", "commit", "-q", "-m", "Change trunk", "wc")
+	return dir
+}
+
+func TestSvnSource(t *testing.T) {
+	for _, b := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(b); err != nil {
+			t.Skipf("%s is not installed", b)
+		}
+	}
+
+	dir := mkSvnRepo(t)
+	defer os.RemoveAll(dir)
+	u := "file://" + filepath.ToSlash(filepath.Join(dir, "repo"))
+	id := ProjectIdentifier{ProjectRoot: "github.com/foo/bar", Source: u}
+
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	vlist, err := sm.ListVersions(id)
+	if err != nil {
+		t.Fatalf("Unexpected error listing versions: %s", err)
+	}
+	got := make(map[string]Revision)
+	for _, v := range vlist {
+		var typ string
+		switch v.Unpair().(type) {
+		case branchVersion:
+			typ = "branch"
+		case semVersion:
+			typ = "semver"
+		case plainVersion:
+			typ = "version"
+		}
+		got[typ+" "+v.String()] = v.Revision()
+	}
+	want := map[string]Revision{
+		"branch trunk":  "3",
+		"semver v1.0.0": "2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected versions %v, got %v", want, got)
+	}
+
+	for r, want := range map[Revision]bool{"1": true, "2": true, "3": true, "abc": false, "99": false} {
+		if has, _ := sm.RevisionPresentIn(id, r); has != want {
+			t.Errorf("Expected revision %s present to be %v", r, want)
+		}
+	}
+
+	v := NewVersion("v1.0.0").Pair("2")
+	to, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(to)
+	if err := sm.ExportProject(id, v, to); err != nil {
+		t.Fatalf("Unexpected error exporting %s: %s", v, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(to, "pkg", "pkg.go"))
+	if err != nil || string(b) != "package pkg\n" {
+		t.Errorf("Expected the tagged pkg.go to be exported, got %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(to, ".svn")); err == nil {
+		t.Error("Expected no .svn dir to be exported")
+	}
+
+	ptree, err := sm.ListPackages(id, NewBranch("trunk").Pair("3"))
+	if err != nil {
+		t.Fatalf("Unexpected error listing packages: %s", err)
+	}
+	if _, has := ptree.Packages["github.com/foo/bar/pkg"]; !has {
+		t.Errorf("Expected the package github.com/foo/bar/pkg, got %v", ptree.Packages)
+	}
+}
+
+func TestSvnLayoutFor(t *testing.T) {
+	flat := SvnLayout{}
+	odd := SvnLayout{Trunk: "main", Tags: "releases"}
+	l := SvnLayouts{
+		"https://svn.example.com/":      odd,
+		"https://svn.example.com/flat/": flat,
+	}
+
+	cases := map[string]SvnLayout{
+		"https://svn.example.com/project":      odd,
+		"https://svn.example.com/flat/project": flat,
+		"https://other.example.com/project":    DefaultSvnLayout,
+	}
+	for u, want := range cases {
+		if got := l.layoutFor(u); got != want {
+			t.Errorf("%s: Expected the layout %+v, got %+v", u, want, got)
+		}
+	}
+	if got := SvnLayouts(nil).layoutFor("https://svn.example.com/project"); got != DefaultSvnLayout {
+		t.Errorf("Expected the default layout without any set, got %+v", got)
+	}
+}
@@ -46,16 +46,36 @@ func VCSVersion(path string) (Version, error) {
 	// Look for the current branch.
 	branches, err := repo.Branches()
 	if err != nil {
-		return nil, errors.Wrapf(err, "getting repo branch for root: %s")
+		return nil, errors.Wrapf(err, "getting repo branch for root: %s", path)
 	}
 	// Try to match the current version to a branch.
 	if contains(branches, ver) {
+		if ver == defaultBranch(repo) {
+			return newDefaultBranch(ver).Pair(Revision(rev)), nil
+		}
 		return NewBranch(ver).Pair(Revision(rev)), nil
 	}
 
 	return Revision(rev), nil
 }
 
+// defaultBranch returns the name of the default branch of repo's upstream, as
+// far as the local repo knows it, or "" if it doesn't.
+func defaultBranch(repo vcs.Repo) string {
+	switch repo.Vcs() {
+	case vcs.Git:
+		// origin/HEAD is set by clones to the branch the remote's HEAD is on.
+		out, err := repo.RunFromDir("git", "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+		if err != nil {
+			return ""
+		}
+		return strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/")
+	case vcs.Hg:
+		return "default"
+	}
+	return ""
+}
+
 // contains checks if a array of strings contains a value
 func contains(a []string, b string) bool {
 	for _, v := range a {
@@ -35,7 +35,7 @@ func TestVCSVersion(t *testing.T) {
 			checkout: true,
 		},
 		"github.com/rsc/go-get-default-branch": {
-			rev: NewBranch("another-branch").Pair("8e6902fdd0361e8fa30226b350e62973e3625ed5"),
+			rev: newDefaultBranch("another-branch").Pair("8e6902fdd0361e8fa30226b350e62973e3625ed5"),
 		},
 	}
 
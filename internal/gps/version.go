@@ -100,6 +100,16 @@ func newDefaultBranch(body string) UnpairedVersion {
 	}
 }
 
+// IsDefaultBranch indicates if the provided version is the default branch of
+// its source, as marked by the SourceManager.
+func IsDefaultBranch(v Version) bool {
+	if pv, ok := v.(versionPair); ok {
+		v = pv.v
+	}
+	bv, ok := v.(branchVersion)
+	return ok && bv.isDefault
+}
+
 // NewVersion creates a Semver-typed Version if the provided version string is
 // valid semver, and a plain/non-semver version if not.
 func NewVersion(body string) UnpairedVersion {
@@ -707,6 +717,49 @@ func SortPairedForDowngrade(vl []PairedVersion) {
 	sort.Sort(pvdowngradeVersionSorter(vl))
 }
 
+// sortWithPrereleases sorts a slice of []Version in the same manner as
+// SortForUpgrade, or SortForDowngrade if down is true, except that semver
+// versions with a prerelease are ordered among the others by semver precedence,
+// rather than after all of them. It's used for projects which have been opted
+// into prereleases, so that 2.0.0-rc2 is visited before 2.0.0-rc1 or 1.9.0,
+// but 2.0.0 before all of them.
+func sortWithPrereleases(vl []Version, down bool) {
+	sort.Sort(prereleaseVersionSorter{vl: vl, down: down})
+}
+
+type prereleaseVersionSorter struct {
+	vl   []Version
+	down bool
+}
+
+func (vs prereleaseVersionSorter) Len() int {
+	return len(vs.vl)
+}
+
+func (vs prereleaseVersionSorter) Swap(i, j int) {
+	vs.vl[i], vs.vl[j] = vs.vl[j], vs.vl[i]
+}
+
+func (vs prereleaseVersionSorter) Less(i, j int) bool {
+	l, r := vs.vl[i], vs.vl[j]
+	if tl, ispair := l.(versionPair); ispair {
+		l = tl.v
+	}
+	if tr, ispair := r.(versionPair); ispair {
+		r = tr.v
+	}
+
+	lsv, lok := l.(semVersion)
+	rsv, rok := r.(semVersion)
+	if !lok || !rok {
+		return vLess(l, r, vs.down)
+	}
+	if vs.down {
+		return lsv.sv.LessThan(rsv.sv)
+	}
+	return lsv.sv.GreaterThan(rsv.sv)
+}
+
 type upgradeVersionSorter []Version
 
 func (vs upgradeVersionSorter) Len() int {
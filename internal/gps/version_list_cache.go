@@ -0,0 +1,207 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// versionListCache persists the version lists of sources in the cache dir, so
+// that a source needn't be listed upstream again, e.g. with git ls-remote, by
+// every SourceMgr within ttl of its last listing. A nil versionListCache
+// caches nothing.
+type versionListCache struct {
+	dir     string        // Where the lists are kept, a file per source
+	ttl     time.Duration // How long a list is used for after it's listed
+	staleOK bool          // Whether lists are used however old they are
+}
+
+// cachedVersionList is the file a version list is kept in.
+type cachedVersionList struct {
+	Source   string // The name of the source's dir in the cache
+	Listed   time.Time
+	Versions []cachedVersion
+	// Digest is of the fields above, so that a corrupted file can be told
+	// from a valid one.
+	Digest string
+}
+
+// cachedVersion is a PairedVersion, as it's kept in a cachedVersionList.
+type cachedVersion struct {
+	Type     string // "version", which may be semver, "branch" or "default-branch"
+	Name     string
+	Revision Revision
+}
+
+func newVersionListCache(cachedir string, ttl time.Duration, staleOK bool) *versionListCache {
+	if ttl <= 0 && !staleOK {
+		return nil
+	}
+	return &versionListCache{
+		dir:     filepath.Join(cachedir, "versions"),
+		ttl:     ttl,
+		staleOK: staleOK,
+	}
+}
+
+// versionListName returns the name the version list of src is kept under:
+// that of its dir in the cache, which is its URL, sanitized. It's "" for
+// sources which aren't kept in the cache, like local ones, whose version lists
+// aren't worth persisting.
+func versionListName(src source) string {
+	if cs, ok := src.(interface {
+		cachePath() string
+	}); ok {
+		return filepath.Base(cs.cachePath())
+	}
+	return ""
+}
+
+// path returns the path of the file the version list named name is kept in.
+func (vc *versionListCache) path(name string) string {
+	return filepath.Join(vc.dir, name+".json")
+}
+
+// get returns the version list of the source named name, if it was listed
+// within the ttl of vc, or at all if stale lists are OK. A file which can't be
+// read back as it was written is removed, for the source to be listed anew.
+func (vc *versionListCache) get(name string) ([]PairedVersion, bool) {
+	if vc == nil || name == "" {
+		return nil, false
+	}
+
+	path := vc.path(name)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cvl cachedVersionList
+	pvl, err := cvl.decode(b, name)
+	if err != nil {
+		os.Remove(path)
+		return nil, false
+	}
+	if !vc.staleOK && time.Since(cvl.Listed) > vc.ttl {
+		return nil, false
+	}
+	return pvl, true
+}
+
+// put keeps the version list of the source named name, as just listed
+// upstream. The cache is only an optimization, so failing to write it isn't an
+// error.
+func (vc *versionListCache) put(name string, pvl []PairedVersion) {
+	if vc == nil || name == "" {
+		return
+	}
+
+	cvl := cachedVersionList{
+		Source:   name,
+		Listed:   time.Now(),
+		Versions: make([]cachedVersion, 0, len(pvl)),
+	}
+	for _, pv := range pvl {
+		cv := cachedVersion{Name: pv.String(), Revision: pv.Revision(), Type: "version"}
+		if pv.Type() == IsBranch {
+			cv.Type = "branch"
+			if IsDefaultBranch(pv) {
+				cv.Type = "default-branch"
+			}
+		}
+		cvl.Versions = append(cvl.Versions, cv)
+	}
+	cvl.Digest = cvl.digest()
+
+	b, err := json.Marshal(cvl)
+	if err != nil {
+		return
+	}
+	writeCacheFile(vc.dir, vc.path(name), b)
+}
+
+// writeCacheFile writes b to the file at path, in dir, through a temporary
+// file, so that it's never read back half written.
+func writeCacheFile(dir, path string, b []byte) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// remove drops the version list of the source named name, e.g. as the source
+// is removed from the cache.
+func (vc *versionListCache) remove(name string) {
+	if vc != nil && name != "" {
+		os.Remove(vc.path(name))
+	}
+}
+
+// digest returns the hex SHA-256 of the fields of cvl other than its Digest.
+func (cvl cachedVersionList) digest() string {
+	cvl.Digest = ""
+	b, _ := json.Marshal(cvl)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// decode reads cvl from b, checking that it's intact and is the list of the
+// source named name, and returns its versions.
+func (cvl *cachedVersionList) decode(b []byte, name string) ([]PairedVersion, error) {
+	if err := json.Unmarshal(b, cvl); err != nil {
+		return nil, err
+	}
+	if cvl.Digest != cvl.digest() {
+		return nil, errCorruptVersionList
+	}
+	if cvl.Source != name {
+		return nil, errCorruptVersionList
+	}
+
+	pvl := make([]PairedVersion, 0, len(cvl.Versions))
+	for _, cv := range cvl.Versions {
+		if cv.Name == "" || cv.Revision == "" {
+			return nil, errCorruptVersionList
+		}
+		var uv UnpairedVersion
+		switch cv.Type {
+		case "version":
+			uv = NewVersion(cv.Name)
+		case "branch":
+			uv = NewBranch(cv.Name)
+		case "default-branch":
+			uv = newDefaultBranch(cv.Name)
+		default:
+			return nil, errCorruptVersionList
+		}
+		pvl = append(pvl, uv.Pair(cv.Revision))
+	}
+	return pvl, nil
+}
+
+var errCorruptVersionList = errors.New("the cached version list is corrupt")
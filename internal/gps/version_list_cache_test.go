@@ -0,0 +1,167 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mkVersionListCache(t *testing.T, ttl time.Duration, staleOK bool) (*versionListCache, func()) {
+	cachedir, err := ioutil.TempDir("", "versionlists")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	return newVersionListCache(cachedir, ttl, staleOK), func() { removeAll(cachedir) }
+}
+
+func TestVersionListCacheRoundTrip(t *testing.T) {
+	vc, clean := mkVersionListCache(t, time.Minute, false)
+	defer clean()
+
+	const name = "https---github.com-sdboyer-gps"
+	pvl := []PairedVersion{
+		NewVersion("v1.0.0").Pair("r1"),
+		NewVersion("v1.1.0").Pair("r2"),
+		NewVersion("notsemver").Pair("r3"),
+		NewBranch("dev").Pair("r4"),
+		newDefaultBranch("master").Pair("r5"),
+	}
+
+	if _, has := vc.get(name); has {
+		t.Fatal("Expected no version list before one was put")
+	}
+	vc.put(name, pvl)
+	got, has := vc.get(name)
+	if !has {
+		t.Fatal("Expected the version list just put")
+	}
+	if !reflect.DeepEqual(got, pvl) {
+		t.Errorf("Expected the version list to round trip:\n\t(GOT): %#v\n\t(WNT): %#v", got, pvl)
+	}
+	if !IsDefaultBranch(got[4]) {
+		t.Error("Expected the default branch to still be the default")
+	}
+	if _, has := vc.get("https---github.com-sdboyer-other"); has {
+		t.Error("Expected no version list for another source")
+	}
+
+	vc.remove(name)
+	if _, has := vc.get(name); has {
+		t.Error("Expected no version list after it was removed")
+	}
+}
+
+func TestVersionListCacheTTL(t *testing.T) {
+	vc, clean := mkVersionListCache(t, time.Minute, false)
+	defer clean()
+
+	const name = "https---github.com-sdboyer-gps"
+	vc.put(name, []PairedVersion{NewVersion("v1.0.0").Pair("r1")})
+
+	// Backdate the list, as if it were listed before the ttl.
+	b, err := ioutil.ReadFile(vc.path(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cvl cachedVersionList
+	if err := json.Unmarshal(b, &cvl); err != nil {
+		t.Fatal(err)
+	}
+	cvl.Listed = cvl.Listed.Add(-time.Hour)
+	cvl.Digest = cvl.digest()
+	if b, err = json.Marshal(cvl); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(vc.path(name), b, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, has := vc.get(name); has {
+		t.Error("Expected a version list older than the ttl not to be used")
+	}
+	if _, err := os.Stat(vc.path(name)); err != nil {
+		t.Errorf("Expected the stale version list to be kept: %s", err)
+	}
+
+	vc.staleOK = true
+	if _, has := vc.get(name); !has {
+		t.Error("Expected a stale version list to be used when stale lists are OK")
+	}
+}
+
+func TestVersionListCacheCorrupt(t *testing.T) {
+	vc, clean := mkVersionListCache(t, time.Minute, false)
+	defer clean()
+
+	const name = "https---github.com-sdboyer-gps"
+	cases := map[string]func(b []byte) []byte{
+		"garbage": func(b []byte) []byte {
+			return []byte("\x00not json")
+		},
+		"truncated": func(b []byte) []byte {
+			return b[:len(b)/2]
+		},
+		"tampered": func(b []byte) []byte {
+			var cvl cachedVersionList
+			json.Unmarshal(b, &cvl)
+			cvl.Versions[0].Revision = "r2"
+			b, _ = json.Marshal(cvl)
+			return b
+		},
+		"other source": func(b []byte) []byte {
+			var cvl cachedVersionList
+			json.Unmarshal(b, &cvl)
+			cvl.Source = "https---github.com-sdboyer-other"
+			cvl.Digest = cvl.digest()
+			b, _ = json.Marshal(cvl)
+			return b
+		},
+		"unknown type": func(b []byte) []byte {
+			var cvl cachedVersionList
+			json.Unmarshal(b, &cvl)
+			cvl.Versions[0].Type = "tag"
+			cvl.Digest = cvl.digest()
+			b, _ = json.Marshal(cvl)
+			return b
+		},
+	}
+
+	for n, corrupt := range cases {
+		vc.put(name, []PairedVersion{NewVersion("v1.0.0").Pair("r1")})
+		b, err := ioutil.ReadFile(vc.path(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(vc.path(name), corrupt(b), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, has := vc.get(name); has {
+			t.Errorf("%s: Expected a corrupt version list not to be used", n)
+		}
+		if _, err := os.Stat(vc.path(name)); !os.IsNotExist(err) {
+			t.Errorf("%s: Expected the corrupt version list to be removed, got %v", n, err)
+		}
+	}
+}
+
+func TestVersionListCacheDisabled(t *testing.T) {
+	if vc := newVersionListCache("/cache", 0, false); vc != nil {
+		t.Fatalf("Expected no cache with a ttl of zero, got %+v", vc)
+	}
+
+	// A nil cache is a no-op.
+	var vc *versionListCache
+	vc.put("source", []PairedVersion{NewVersion("v1.0.0").Pair("r1")})
+	if _, has := vc.get("source"); has {
+		t.Error("Expected a nil cache to have no version lists")
+	}
+	vc.remove("source")
+}
@@ -187,3 +187,49 @@ func TestVersionSorts(t *testing.T) {
 		t.Errorf("Up-then-downgrade sort positions with wrong versions: %v", wrong)
 	}
 }
+
+func TestSortWithPrereleases(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	v1 := NewVersion("1.9.0")
+	v2 := NewVersion("2.0.0-rc1").Pair(rev)
+	v3 := NewVersion("2.0.0-rc2")
+	v4 := NewVersion("2.0.0")
+	v5 := NewVersion("2.1.0-beta.1")
+	v6 := NewBranch("master")
+
+	vl := []Version{v6, v2, v4, v1, v5, v3}
+	sortWithPrereleases(vl, false)
+	eup := []Version{v5, v4, v3, v2, v1, v6}
+	for k, v := range vl {
+		if eup[k] != v {
+			t.Errorf("Expected version %s in position %v on upgrade sort with prereleases, but got %s", eup[k], k, v)
+		}
+	}
+
+	sortWithPrereleases(vl, true)
+	edown := []Version{v1, v2, v3, v4, v5, v6}
+	for k, v := range vl {
+		if edown[k] != v {
+			t.Errorf("Expected version %s in position %v on downgrade sort with prereleases, but got %s", edown[k], k, v)
+		}
+	}
+}
+
+func TestIsDefaultBranch(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	table := map[Version]bool{
+		newDefaultBranch("master"):           true,
+		newDefaultBranch("master").Pair(rev): true,
+		NewBranch("master"):                  false,
+		NewBranch("release-1.8").Pair(rev):   false,
+		NewVersion("v1.0.0").Pair(rev):       false,
+		NewVersion("foo"):                    false,
+		rev:                                  false,
+	}
+
+	for v, want := range table {
+		if got := IsDefaultBranch(v); got != want {
+			t.Errorf("Expected IsDefaultBranch(%s) to be %t, got %t", v, want, got)
+		}
+	}
+}
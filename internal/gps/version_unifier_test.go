@@ -129,6 +129,10 @@ func (lb lvFixBridge) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 	panic("not implemented")
 }
 
+func (lb lvFixBridge) SourceOrigin(ProjectIdentifier) (ProjectOrigin, error) {
+	panic("not implemented")
+}
+
 func (lb lvFixBridge) verifyRootDir(path string) error {
 	panic("not implemented")
 }
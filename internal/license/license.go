@@ -0,0 +1,110 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package license detects the licenses of projects from their license files.
+package license
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Unknown is the name of licenses which aren't recognized.
+const Unknown = "Unknown"
+
+// License is a license detected from a file of a project.
+type License struct {
+	Name string // SPDX identifier of the license, or Unknown
+	File string // Name of the file it was detected from
+}
+
+// matchers classify the text of license files by the phrases they must all
+// contain, normalized as by normalize. The first match wins, so that e.g. the
+// LGPL, which refers to the GPL, isn't mistaken for it.
+var matchers = []struct {
+	name    string
+	phrases []string
+}{
+	{"Apache-2.0", []string{"apache license version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license version 2.0"}},
+	{"MPL-1.1", []string{"mozilla public license version 1.1"}},
+	{"AGPL-3.0", []string{"gnu affero general public license version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license version 2.1"}},
+	{"LGPL-2.0", []string{"gnu library general public license version 2"}},
+	{"GPL-3.0", []string{"gnu general public license version 3"}},
+	{"GPL-2.0", []string{"gnu general public license version 2"}},
+	{"MIT", []string{"permission is hereby granted free of charge", "the above copyright notice and this permission notice shall be included"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "endorse or promote products derived from this software"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+// Classify returns the SPDX identifier of the license in text, or Unknown.
+func Classify(text string) string {
+	text = normalize(text)
+outer:
+	for _, m := range matchers {
+		for _, phrase := range m.phrases {
+			if !strings.Contains(text, phrase) {
+				continue outer
+			}
+		}
+		return m.name
+	}
+	return Unknown
+}
+
+// normalize lowercases text and turns all the runs of whitespace and
+// punctuation, other than the dots of version numbers, into single spaces.
+func normalize(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.')
+	})
+	for i, f := range fields {
+		fields[i] = strings.Trim(f, ".")
+	}
+	return strings.Join(fields, " ")
+}
+
+// IsLicenseFile reports whether the file name looks like that of a license
+// file, like LICENSE, LICENSE.txt, LICENSE-MIT, COPYING or UNLICENSE, rather
+// than e.g. a Go file about licenses.
+func IsLicenseFile(name string) bool {
+	name = strings.ToUpper(name)
+	if filepath.Ext(name) == ".GO" {
+		return false
+	}
+	for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix):]
+		return rest == "" || strings.IndexAny(rest[:1], ".-_") == 0
+	}
+	return false
+}
+
+// Detect classifies the license files at the root of the project in dir, in
+// the order of their names. A project without license files has no licenses.
+func Detect(dir string) ([]License, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var licenses []License
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() || !IsLicenseFile(fi.Name()) {
+			continue
+		}
+		text, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, License{Name: Classify(string(text)), File: fi.Name()})
+	}
+	return licenses, nil
+}
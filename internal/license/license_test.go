@@ -0,0 +1,144 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package license
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const mitText = `The MIT License (MIT)
+
+Copyright (c) 2017 Sam Boyer
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+`
+
+func TestClassify(t *testing.T) {
+	cases := map[string]string{
+		"mit": mitText,
+		"apache": `
+                                 Apache License
+                           Version 2.0, January 2004
+                        http://www.apache.org/licenses/`,
+		"bsd-3": `Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+   * Neither the name of Google Inc. nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.`,
+		"bsd-2": `Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:`,
+		"mpl": `Mozilla Public License Version 2.0
+==================================`,
+		"gpl-2": `		    GNU GENERAL PUBLIC LICENSE
+		       Version 2, June 1991
+
+If your program is a subroutine library, you may consider it more useful to
+permit linking proprietary applications with the library.  If this is what you
+want to do, use the GNU Library General Public License instead of this License.`,
+		"gpl-3": `                    GNU GENERAL PUBLIC LICENSE
+                       Version 3, 29 June 2007
+
+But first, please read <http://www.gnu.org/philosophy/why-not-lgpl.html>, and
+use the GNU Lesser General Public License instead of this License.`,
+		"lgpl-3": `                   GNU LESSER GENERAL PUBLIC LICENSE
+                       Version 3, 29 June 2007
+
+  This version of the GNU Lesser General Public License incorporates
+the terms and conditions of version 3 of the GNU General Public
+License, supplemented by the additional permissions listed below.`,
+		"unlicense": `This is free and unencumbered software released into the public domain.`,
+		"unknown":   `All rights reserved.`,
+	}
+	want := map[string]string{
+		"mit":       "MIT",
+		"apache":    "Apache-2.0",
+		"bsd-3":     "BSD-3-Clause",
+		"bsd-2":     "BSD-2-Clause",
+		"mpl":       "MPL-2.0",
+		"gpl-2":     "GPL-2.0",
+		"gpl-3":     "GPL-3.0",
+		"lgpl-3":    "LGPL-3.0",
+		"unlicense": "Unlicense",
+		"unknown":   Unknown,
+	}
+
+	for name, text := range cases {
+		if got := Classify(text); got != want[name] {
+			t.Errorf("%s: expected %s, got %s", name, want[name], got)
+		}
+	}
+}
+
+func TestIsLicenseFile(t *testing.T) {
+	cases := map[string]bool{
+		"LICENSE":        true,
+		"LICENSE.txt":    true,
+		"license.md":     true,
+		"LICENCE":        true,
+		"COPYING.LESSER": true,
+		"UNLICENSE":      true,
+		"README.md":      false,
+		"LICENSE-MIT":    true,
+		"licenses.go":    false,
+		"LICENSES":       false,
+		"main.go":        false,
+	}
+	for name, want := range cases {
+		if got := IsLicenseFile(name); got != want {
+			t.Errorf("%s: expected %t, got %t", name, want, got)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "license")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"LICENSE":   mitText,
+		"COPYING":   "All rights reserved.",
+		"README.md": mitText,
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "LICENSES"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Detect(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []License{{Name: Unknown, File: "COPYING"}, {Name: "MIT", File: "LICENSE"}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], got[i])
+		}
+	}
+
+	if _, err := Detect(filepath.Join(dir, "notexist")); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error for a missing directory, got %v", err)
+	}
+}
@@ -22,6 +22,16 @@ const LockName = "Gopkg.lock"
 type Lock struct {
 	SolveMeta SolveMeta
 	P         []gps.LockedProject
+
+	// PruneOpts records, by project root, the options the projects were
+	// pruned with when they were written to vendor/. Projects without any
+	// weren't pruned.
+	PruneOpts map[gps.ProjectRoot]gps.PruneOptions
+
+	// Digests records, by project root, the digests of the trees the projects
+	// were written to vendor/ as, from fs.DigestTree. Projects without any
+	// haven't been written by a dep which records them.
+	Digests map[gps.ProjectRoot]string
 }
 
 // SolveMeta holds solver meta data.
@@ -47,12 +57,20 @@ type solveMeta struct {
 }
 
 type rawLockedProject struct {
-	Name     string   `toml:"name"`
-	Branch   string   `toml:"branch,omitempty"`
-	Revision string   `toml:"revision"`
-	Version  string   `toml:"version,omitempty"`
-	Source   string   `toml:"source,omitempty"`
-	Packages []string `toml:"packages"`
+	Name      string   `toml:"name"`
+	Branch    string   `toml:"branch,omitempty"`
+	Revision  string   `toml:"revision"`
+	Version   string   `toml:"version,omitempty"`
+	Source    string   `toml:"source,omitempty"`
+	Packages  []string `toml:"packages"`
+	PruneOpts string   `toml:"pruneopts,omitempty"`
+	Digest    string   `toml:"digest,omitempty"`
+
+	// The origin of the project, for tools which consume the lock. Older
+	// versions of dep ignore these fields.
+	VCS           string `toml:"vcs,omitempty"`
+	URL           string `toml:"url,omitempty"`
+	DefaultBranch string `toml:"default-branch,omitempty"`
 }
 
 func readLock(r io.Reader) (*Lock, error) {
@@ -106,7 +124,28 @@ func fromRawLock(raw rawLock) (*Lock, error) {
 			ProjectRoot: gps.ProjectRoot(ld.Name),
 			Source:      ld.Source,
 		}
-		l.P[i] = gps.NewLockedProject(id, v, ld.Packages)
+		l.P[i] = gps.NewLockedProject(id, v, ld.Packages).WithOrigin(gps.ProjectOrigin{
+			VCS:           ld.VCS,
+			URL:           ld.URL,
+			DefaultBranch: ld.DefaultBranch,
+		})
+
+		if ld.PruneOpts != "" {
+			po, err := gps.ParsePruneOptions(ld.PruneOpts)
+			if err != nil {
+				return nil, errors.Wrapf(err, "lock file has invalid prune options for %s", ld.Name)
+			}
+			if l.PruneOpts == nil {
+				l.PruneOpts = make(map[gps.ProjectRoot]gps.PruneOptions)
+			}
+			l.PruneOpts[id.ProjectRoot] = po
+		}
+		if ld.Digest != "" {
+			if l.Digests == nil {
+				l.Digests = make(map[gps.ProjectRoot]string)
+			}
+			l.Digests[id.ProjectRoot] = ld.Digest
+		}
 	}
 
 	return l, nil
@@ -136,6 +175,83 @@ func (l *Lock) HasProjectWithRoot(root gps.ProjectRoot) bool {
 	return false
 }
 
+// PruneOptionsFor returns the options the project pr was pruned with.
+func (l *Lock) PruneOptionsFor(pr gps.ProjectRoot) gps.PruneOptions {
+	return l.PruneOpts[pr]
+}
+
+// SetPruneOptions records that each project of the lock is to be pruned with
+// the options o gives for it.
+func (l *Lock) SetPruneOptions(o gps.CascadingPruneOptions) {
+	l.PruneOpts = nil
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		if po := o.PruneOptionsFor(pr); po != 0 {
+			if l.PruneOpts == nil {
+				l.PruneOpts = make(map[gps.ProjectRoot]gps.PruneOptions)
+			}
+			l.PruneOpts[pr] = po
+		}
+	}
+}
+
+// samePruneOptions reports whether the projects of l1 and l2 are pruned with
+// the same options.
+func samePruneOptions(l1, l2 *Lock) bool {
+	for _, l := range [][2]*Lock{{l1, l2}, {l2, l1}} {
+		for pr, po := range l[0].PruneOpts {
+			if l[1].PruneOpts[pr] != po {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// carryDigests records in l the digests old records for the projects which are
+// locked and pruned the same in both, and which l has no digest for, so that
+// they aren't lost when vendor/ isn't written.
+func (l *Lock) carryDigests(old *Lock) {
+	oldProjects := make(map[gps.ProjectRoot]gps.LockedProject, len(old.P))
+	for _, lp := range old.P {
+		oldProjects[lp.Ident().ProjectRoot] = lp
+	}
+
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		digest, has := old.Digests[pr]
+		if _, set := l.Digests[pr]; set || !has {
+			continue
+		}
+		if olp, has := oldProjects[pr]; !has || !olp.Eq(lp) || old.PruneOptionsFor(pr) != l.PruneOptionsFor(pr) {
+			continue
+		}
+		if l.Digests == nil {
+			l.Digests = make(map[gps.ProjectRoot]string)
+		}
+		l.Digests[pr] = digest
+	}
+}
+
+// carryOrigins records in l the origins old records for the projects which are
+// locked the same in both, and which l has no origin for, e.g. as it couldn't
+// be looked up offline.
+func (l *Lock) carryOrigins(old *Lock) {
+	oldProjects := make(map[gps.ProjectRoot]gps.LockedProject, len(old.P))
+	for _, lp := range old.P {
+		oldProjects[lp.Ident().ProjectRoot] = lp
+	}
+
+	for i, lp := range l.P {
+		if lp.Origin() != (gps.ProjectOrigin{}) {
+			continue
+		}
+		if olp, has := oldProjects[lp.Ident().ProjectRoot]; has && olp.Eq(lp) {
+			l.P[i] = lp.WithOrigin(olp.Origin())
+		}
+	}
+}
+
 // toRaw converts the manifest into a representation suitable to write to the lock file
 func (l *Lock) toRaw() rawLock {
 	raw := rawLock{
@@ -154,21 +270,52 @@ func (l *Lock) toRaw() rawLock {
 	for k, lp := range l.P {
 		id := lp.Ident()
 		ld := rawLockedProject{
-			Name:     string(id.ProjectRoot),
-			Source:   id.Source,
-			Packages: lp.Packages(),
+			Name:      string(id.ProjectRoot),
+			Source:    id.Source,
+			Packages:  sortedPackages(lp.Packages()),
+			PruneOpts: l.PruneOpts[id.ProjectRoot].String(),
+			Digest:    l.Digests[id.ProjectRoot],
 		}
 
 		v := lp.Version()
 		ld.Revision, ld.Branch, ld.Version = gps.VersionComponentStrings(v)
 
+		o := lp.Origin()
+		ld.VCS, ld.URL = o.VCS, o.URL
+		if ld.Branch != "" {
+			ld.DefaultBranch = o.DefaultBranch
+		}
+
 		raw.Projects[k] = ld
 	}
 
 	return raw
 }
 
+// sortedPackages returns the packages sorted and without duplicates, leaving
+// pkgs as it is.
+func sortedPackages(pkgs []string) []string {
+	sorted := make([]string, len(pkgs))
+	copy(sorted, pkgs)
+	sort.Strings(sorted)
+
+	var n int
+	for i, pkg := range sorted {
+		if i == 0 || pkg != sorted[n-1] {
+			sorted[n] = pkg
+			n++
+		}
+	}
+	return sorted[:n]
+}
+
 // MarshalTOML serializes this lock into TOML via an intermediate raw form.
+//
+// The lock is always serialized the same way: projects are sorted by their
+// root, the packages of each are sorted, and keys are in alphabetical order.
+// Nothing in it depends on when or how often it's written, so the blocks of
+// the projects which didn't change stay byte-for-byte the same when a lock is
+// written again.
 func (l *Lock) MarshalTOML() ([]byte, error) {
 	raw := l.toRaw()
 	result, err := toml.Marshal(raw)
@@ -5,6 +5,7 @@
 package dep
 
 import (
+	"bytes"
 	"encoding/hex"
 	"reflect"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/test"
+	"github.com/pelletier/go-toml"
 )
 
 func TestReadLock(t *testing.T) {
@@ -36,7 +38,11 @@ func TestReadLock(t *testing.T) {
 				gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/golang/dep")},
 				gps.NewBranch("master").Pair(gps.Revision("d05d5aca9f895d19e9265839bffeadd74a2d2ecb")),
 				[]string{"."},
-			),
+			).WithOrigin(gps.ProjectOrigin{
+				VCS:           "git",
+				URL:           "https://github.com/golang/dep",
+				DefaultBranch: "master",
+			}),
 		},
 	}
 
@@ -87,7 +93,11 @@ func TestWriteLock(t *testing.T) {
 				gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/golang/dep")},
 				gps.NewBranch("master").Pair(gps.Revision("d05d5aca9f895d19e9265839bffeadd74a2d2ecb")),
 				[]string{"."},
-			),
+			).WithOrigin(gps.ProjectOrigin{
+				VCS:           "git",
+				URL:           "https://github.com/golang/dep",
+				DefaultBranch: "master",
+			}),
 		},
 	}
 
@@ -138,6 +148,262 @@ func TestWriteLock(t *testing.T) {
 	}
 }
 
+func TestLockPruneOptionsAndDigestsRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "lock/golden2.toml"
+	lf := h.GetTestFile(golden)
+	defer lf.Close()
+	l, err := readLock(lf)
+	if err != nil {
+		t.Fatalf("Should have read Lock correctly, but got err %q", err)
+	}
+
+	wantOpts := map[gps.ProjectRoot]gps.PruneOptions{
+		"github.com/golang/dep": gps.PruneUnusedPackages | gps.PruneGoTestFiles,
+	}
+	if !reflect.DeepEqual(l.PruneOpts, wantOpts) {
+		t.Errorf("Valid lock's prune options did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", l.PruneOpts, wantOpts)
+	}
+	wantDigests := map[gps.ProjectRoot]string{
+		"github.com/sdboyer/deptest": "5f1e7ea6c2ab8bd564fc0d6c31e2a5bdd7c0b6dd4f7a5e9834a080e5fd1a3d87",
+	}
+	if !reflect.DeepEqual(l.Digests, wantDigests) {
+		t.Errorf("Valid lock's digests did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", l.Digests, wantDigests)
+	}
+
+	got, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid lock to TOML: %q", err)
+	}
+	want := h.GetTestFileString(golden)
+	if string(got) != want {
+		t.Errorf("Lock prune options and digests did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), want)
+	}
+}
+
+func TestLockSetPruneOptions(t *testing.T) {
+	l := &Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.Revision("rev1"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/baz"}, gps.Revision("rev2"), []string{"."}),
+		},
+	}
+	l.SetPruneOptions(gps.CascadingPruneOptions{
+		DefaultOptions: gps.PruneNonGoFiles,
+		PerProjectOptions: map[gps.ProjectRoot]gps.PruneOptionSet{
+			"github.com/foo/baz": {Overridden: gps.PruneNonGoFiles},
+		},
+	})
+
+	want := map[gps.ProjectRoot]gps.PruneOptions{"github.com/foo/bar": gps.PruneNonGoFiles}
+	if !reflect.DeepEqual(l.PruneOpts, want) {
+		t.Errorf("Unexpected prune options:\n\t(GOT): %v\n\t(WNT): %v", l.PruneOpts, want)
+	}
+	if samePruneOptions(l, &Lock{P: l.P}) {
+		t.Error("Locks pruned differently should not have been reported as pruned the same")
+	}
+}
+
+func TestLockCarryDigests(t *testing.T) {
+	lp := func(root, rev string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(root)}, gps.Revision(rev), []string{"."})
+	}
+	old := &Lock{
+		P: []gps.LockedProject{
+			lp("github.com/foo/bar", "rev1"),
+			lp("github.com/foo/baz", "rev2"),
+			lp("github.com/foo/qux", "rev3"),
+			lp("github.com/foo/quux", "rev4"),
+		},
+		Digests: map[gps.ProjectRoot]string{
+			"github.com/foo/bar":  "bar",
+			"github.com/foo/baz":  "baz",
+			"github.com/foo/qux":  "qux",
+			"github.com/foo/quux": "quux",
+		},
+	}
+	l := &Lock{
+		P: []gps.LockedProject{
+			// Unchanged.
+			lp("github.com/foo/bar", "rev1"),
+			// Locked to another revision.
+			lp("github.com/foo/baz", "new"),
+			// Pruned differently.
+			lp("github.com/foo/qux", "rev3"),
+			// Already has a digest of its own.
+			lp("github.com/foo/quux", "rev4"),
+		},
+		PruneOpts: map[gps.ProjectRoot]gps.PruneOptions{"github.com/foo/qux": gps.PruneGoTestFiles},
+		Digests:   map[gps.ProjectRoot]string{"github.com/foo/quux": "new"},
+	}
+	l.carryDigests(old)
+
+	want := map[gps.ProjectRoot]string{
+		"github.com/foo/bar":  "bar",
+		"github.com/foo/quux": "new",
+	}
+	if !reflect.DeepEqual(l.Digests, want) {
+		t.Errorf("Unexpected digests carried:\n\t(GOT): %v\n\t(WNT): %v", l.Digests, want)
+	}
+}
+
+func TestLockOriginsIgnoredByOlderDep(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// The projects of a lock as a dep which doesn't know of their origins
+	// reads them.
+	var raw struct {
+		Projects []struct {
+			Name     string   `toml:"name"`
+			Branch   string   `toml:"branch,omitempty"`
+			Revision string   `toml:"revision"`
+			Packages []string `toml:"packages"`
+		} `toml:"projects"`
+	}
+	if err := toml.Unmarshal([]byte(h.GetTestFileString("lock/golden0.toml")), &raw); err != nil {
+		t.Fatalf("A lock with origins should be readable without them: %s", err)
+	}
+	if len(raw.Projects) != 1 || raw.Projects[0].Branch != "master" {
+		t.Errorf("Unexpected projects read without their origins: %+v", raw.Projects)
+	}
+}
+
+func TestLockCarryOrigins(t *testing.T) {
+	lp := func(root, rev string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(root)}, gps.Revision(rev), []string{"."})
+	}
+	origin := func(root string) gps.ProjectOrigin {
+		return gps.ProjectOrigin{VCS: "git", URL: "https://" + root}
+	}
+	old := &Lock{
+		P: []gps.LockedProject{
+			lp("github.com/foo/bar", "rev1").WithOrigin(origin("github.com/foo/bar")),
+			lp("github.com/foo/baz", "rev2").WithOrigin(origin("github.com/foo/baz")),
+			lp("github.com/foo/qux", "rev3").WithOrigin(origin("github.com/foo/qux")),
+		},
+	}
+	l := &Lock{
+		P: []gps.LockedProject{
+			// Unchanged.
+			lp("github.com/foo/bar", "rev1"),
+			// Locked to another revision.
+			lp("github.com/foo/baz", "new"),
+			// Already has an origin of its own.
+			lp("github.com/foo/qux", "rev3").WithOrigin(gps.ProjectOrigin{VCS: "hg", URL: "https://hg.example.com/qux"}),
+		},
+	}
+	l.carryOrigins(old)
+
+	want := []gps.ProjectOrigin{
+		origin("github.com/foo/bar"),
+		{},
+		{VCS: "hg", URL: "https://hg.example.com/qux"},
+	}
+	for i, lp := range l.P {
+		if got := lp.Origin(); got != want[i] {
+			t.Errorf("Unexpected origin carried for %s:\n\t(GOT): %+v\n\t(WNT): %+v", lp.Ident().ProjectRoot, got, want[i])
+		}
+	}
+}
+
+// stubSolution is a gps.Solution of the projects of its SimpleLock, in the
+// order they are given.
+type stubSolution struct {
+	gps.SimpleLock
+	h []byte
+}
+
+func (s stubSolution) InputHash() []byte    { return s.h }
+func (s stubSolution) AnalyzerName() string { return "dep" }
+func (s stubSolution) AnalyzerVersion() int { return 1 }
+func (s stubSolution) SolverName() string   { return "gps-cdcl" }
+func (s stubSolution) SolverVersion() int   { return 1 }
+func (s stubSolution) Attempts() int        { return 1 }
+
+func stableLockProjects() []gps.LockedProject {
+	return []gps.LockedProject{
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"},
+			gps.NewVersion("v1.0.0").Pair("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			[]string{".", "cmd/bar", "internal"},
+		),
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/foo/baz", Source: "https://git.example.com/baz"},
+			gps.NewBranch("master").Pair("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+			[]string{"."},
+		).WithOrigin(gps.ProjectOrigin{VCS: "git", URL: "https://git.example.com/baz", DefaultBranch: "master"}),
+		gps.NewLockedProject(
+			gps.ProjectIdentifier{ProjectRoot: "github.com/foo/qux"},
+			gps.NewVersion("v2.0.0").Pair("5c607206be5decd28e6263ffffdcee067266015e"),
+			[]string{"a", "b"},
+		),
+	}
+}
+
+func TestLockFromSolutionIsStable(t *testing.T) {
+	h, _ := hex.DecodeString("2252a285ab27944a4d7adcba8dbd03980f59ba652f12db39fa93b927c345593e")
+	lps := stableLockProjects()
+	first, err := LockFromSolution(stubSolution{SimpleLock: lps, h: h}).MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The solver returns the same projects in any order, with their packages
+	// in any order.
+	shuffled := []gps.LockedProject{
+		lps[2],
+		gps.NewLockedProject(lps[0].Ident(), lps[0].Version(), []string{"internal", ".", "cmd/bar", "."}),
+		lps[1],
+	}
+	second, err := LockFromSolution(stubSolution{SimpleLock: shuffled, h: h}).MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("The same solution marshaled differently:\n\t(FIRST): %s\n\t(SECOND): %s", first, second)
+	}
+}
+
+func TestLockRewriteOnlyChangesModifiedProject(t *testing.T) {
+	h1, _ := hex.DecodeString("2252a285ab27944a4d7adcba8dbd03980f59ba652f12db39fa93b927c345593e")
+	h2, _ := hex.DecodeString("1ed417a0bec57ffe988fae1cba8f3d49994fb893394d61844e0b3c96d69573fe")
+
+	lps := stableLockProjects()
+	before, err := LockFromSolution(stubSolution{SimpleLock: lps, h: h1}).MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lps = stableLockProjects()
+	lps[1] = gps.NewLockedProject(lps[1].Ident(), gps.NewBranch("master").Pair("d05d5aca9f895d19e9265839bffeadd74a2d2ecb"), []string{"."}).WithOrigin(lps[1].Origin())
+	after, err := LockFromSolution(stubSolution{SimpleLock: lps, h: h2}).MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bl, al := strings.Split(string(before), "\n"), strings.Split(string(after), "\n")
+	if len(bl) != len(al) {
+		t.Fatalf("Expected the rewritten lock to have as many lines:\n\t(BEFORE): %s\n\t(AFTER): %s", before, after)
+	}
+	var changed []string
+	for i := range bl {
+		if bl[i] != al[i] {
+			changed = append(changed, strings.TrimSpace(al[i]))
+		}
+	}
+	want := []string{
+		`revision = "d05d5aca9f895d19e9265839bffeadd74a2d2ecb"`,
+		`inputs-digest = "1ed417a0bec57ffe988fae1cba8f3d49994fb893394d61844e0b3c96d69573fe"`,
+	}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("Expected only the revision of the project and the inputs digest to change:\n\t(GOT): %q\n\t(WNT): %q", changed, want)
+	}
+}
+
 func TestReadLockErrors(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -8,11 +8,14 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path"
 	"reflect"
 	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
 )
@@ -26,31 +29,193 @@ var (
 	errInvalidOverride   = errors.New("\"override\" must be a TOML array of tables")
 	errInvalidRequired   = errors.New("\"required\" must be a TOML list of strings")
 	errInvalidIgnored    = errors.New("\"ignored\" must be a TOML list of strings")
+	errInvalidNoVerify   = errors.New("\"noverify\" must be a TOML list of strings")
+	errInvalidPrune      = errors.New("\"prune\" must be a TOML table")
+	errInvalidSource     = errors.New("\"source\" must be a TOML array of tables")
+	errInvalidSolve      = errors.New("\"solve\" must be a TOML table")
+	errInvalidTests      = errors.New("\"tests\" must be a boolean")
+	errInvalidBuild      = errors.New("\"build\" must be a TOML table")
+	errInvalidAnalysis   = errors.New("\"analysis\" must be a TOML table")
+	errInvalidRoot       = errors.New("\"root\" must be a string")
+	errRootNotImportPath = errors.New("the root must be the import path of the project, as in \"github.com/org/proj\"")
+	errInvalidWildcard   = errors.New("a wildcard may only end an ignored path, as in \"github.com/foo/*\"")
+	errRequiredNotPkg    = errors.New("required entries must each be the full import path of a single package, without wildcards")
 )
 
 // Manifest holds manifest file data and implements gps.RootManifest.
 type Manifest struct {
+	// Root is the import path of the project, set for projects outside of
+	// GOPATH, as it can't be inferred from where they are.
+	Root string
+
 	Constraints gps.ProjectConstraints
 	Ovr         gps.ProjectConstraints
 	Ignored     []string
 	Required    []string
+
+	// NoVerify lists the roots of the projects which aren't verified against
+	// their digests in vendor/, e.g. because they're patched locally.
+	NoVerify []string
+
+	// ExcludeTests leaves the imports of the project's test files out of
+	// solving, so that the projects only they import aren't vendored.
+	ExcludeTests bool
+
+	// TestOnly holds the roots of the projects whose constraints are marked as
+	// being only for tests. It documents the constraints, and isn't acted on.
+	TestOnly map[gps.ProjectRoot]bool
+
+	// PruneOptions are the options vendor/ is pruned with, by default and for
+	// particular projects.
+	PruneOptions gps.CascadingPruneOptions
+
+	// Mirrors maps prefixes of the sources of projects to the URLs they're
+	// fetched from instead, whether the projects are dependencies of the root
+	// or not.
+	Mirrors gps.SourceMirrors
+
+	// PreferOldest makes the solver select the oldest versions of projects
+	// which are allowed, rather than the newest, unless they're locked.
+	PreferOldest bool
+
+	// Build is the set of platforms and build tags the project is built for.
+	// The imports of files which aren't built for any of them are left out of
+	// solving. It's empty by default, which follows every import.
+	Build pkgtree.BuildMatrix
+
+	// ExcludeDirs are the dirs of the project, relative to its root, whose
+	// packages are left out of its analysis, unread. IncludeDirs are those
+	// beneath them which are analyzed all the same.
+	ExcludeDirs, IncludeDirs []string
+
+	// Meta holds the manifest's metadata table. dep doesn't interpret it, but
+	// preserves it when the manifest is rewritten.
+	Meta map[string]interface{}
 }
 
+// rawManifest doesn't hold the metadata table, as go-toml can't (un)marshal
+// interface{} values; it is handled as a *toml.TomlTree instead.
 type rawManifest struct {
-	Constraints []rawProject `toml:"constraint,omitempty"`
-	Overrides   []rawProject `toml:"override,omitempty"`
-	Ignored     []string     `toml:"ignored,omitempty"`
-	Required    []string     `toml:"required,omitempty"`
+	Root        string           `toml:"root,omitempty"`
+	Constraints []rawProject     `toml:"constraint,omitempty"`
+	Overrides   []rawProject     `toml:"override,omitempty"`
+	Ignored     []string         `toml:"ignored,omitempty"`
+	Required    []string         `toml:"required,omitempty"`
+	NoVerify    []string         `toml:"noverify,omitempty"`
+	Tests       *bool            `toml:"tests,omitempty"`
+	Prune       *rawPruneOptions `toml:"prune,omitempty"`
+	Sources     []rawSource      `toml:"source,omitempty"`
+	Solve       *rawSolveOptions `toml:"solve,omitempty"`
+	Build       *rawBuildMatrix  `toml:"build,omitempty"`
+	Analysis    *rawAnalysis     `toml:"analysis,omitempty"`
+}
+
+type rawSolveOptions struct {
+	Prefer string `toml:"prefer,omitempty"`
+}
+
+// The versions the solver can prefer, in the solve table of the manifest.
+const (
+	preferNewest = "newest"
+	preferOldest = "oldest"
+)
+
+type rawBuildMatrix struct {
+	GOOS   []string `toml:"goos,omitempty"`
+	GOARCH []string `toml:"goarch,omitempty"`
+	Tags   []string `toml:"tags,omitempty"`
+}
+
+type rawAnalysis struct {
+	ExcludeDirs []string `toml:"exclude-dirs,omitempty"`
+	IncludeDirs []string `toml:"include-dirs,omitempty"`
+}
+
+type rawSource struct {
+	Prefix string `toml:"prefix"`
+	URL    string `toml:"url"`
+}
+
+type rawPruneOptions struct {
+	UnusedPackages bool                     `toml:"unused-packages,omitempty"`
+	NonGoFiles     bool                     `toml:"non-go,omitempty"`
+	GoTests        bool                     `toml:"go-tests,omitempty"`
+	Projects       []rawPruneProjectOptions `toml:"project,omitempty"`
+}
+
+// rawPruneProjectOptions holds the prune options a project overrides; those
+// which are nil are left as they are by default.
+type rawPruneProjectOptions struct {
+	Name           string `toml:"name"`
+	UnusedPackages *bool  `toml:"unused-packages,omitempty"`
+	NonGoFiles     *bool  `toml:"non-go,omitempty"`
+	GoTests        *bool  `toml:"go-tests,omitempty"`
+}
+
+// pruneOptionKeys are the keys of the prune options in the manifest.
+var pruneOptionKeys = map[string]gps.PruneOptions{
+	"unused-packages": gps.PruneUnusedPackages,
+	"non-go":          gps.PruneNonGoFiles,
+	"go-tests":        gps.PruneGoTestFiles,
 }
 
 type rawProject struct {
-	Name     string `toml:"name"`
-	Branch   string `toml:"branch,omitempty"`
-	Revision string `toml:"revision,omitempty"`
-	Version  string `toml:"version,omitempty"`
-	Source   string `toml:"source,omitempty"`
+	Name       string `toml:"name"`
+	Branch     string `toml:"branch,omitempty"`
+	Revision   string `toml:"revision,omitempty"`
+	Version    string `toml:"version,omitempty"`
+	Source     string `toml:"source,omitempty"`
+	Prerelease bool   `toml:"prerelease,omitempty"`
+	TestOnly   bool   `toml:"test-only,omitempty"`
 }
 
+// manifestProblem is a problem found in a manifest, reported with the line it
+// was found on.
+type manifestProblem struct {
+	line int
+	msg  string
+}
+
+func (p manifestProblem) Error() string {
+	return fmt.Sprintf("line %d: %s", p.line, p.msg)
+}
+
+// problemAt returns a manifestProblem at pos.
+func problemAt(pos toml.Position, format string, args ...interface{}) error {
+	return manifestProblem{line: pos.Line, msg: fmt.Sprintf(format, args...)}
+}
+
+// unknownKey returns a problem for the key at pos, which isn't one of the
+// known keys of where, suggesting the one it's probably a typo of.
+func unknownKey(pos toml.Position, key, where string, known []string) error {
+	var msg string
+	if where == "" {
+		msg = fmt.Sprintf("unknown field %q in manifest", key)
+	} else {
+		msg = fmt.Sprintf("invalid key %q in %q", key, where)
+	}
+	if s := closest(key, known); s != "" {
+		msg += fmt.Sprintf(", did you mean %q?", s)
+	}
+	return problemAt(pos, "%s", msg)
+}
+
+// The known keys of the manifest and of each of its tables.
+var (
+	manifestKeys     = []string{"analysis", "build", "constraint", "ignored", "metadata", "noverify", "override", "prune", "required", "root", "solve", "source", "tests"}
+	projectKeys      = []string{"branch", "metadata", "name", "prerelease", "revision", "source", "test-only", "version"}
+	sourceKeys       = []string{"prefix", "url"}
+	pruneKeys        = []string{"go-tests", "non-go", "project", "unused-packages"}
+	pruneProjectKeys = []string{"go-tests", "name", "non-go", "unused-packages"}
+	solveKeys        = []string{"prefer"}
+	buildKeys        = []string{"goarch", "goos", "tags"}
+	analysisKeys     = []string{"exclude-dirs", "include-dirs"}
+)
+
+// validateManifest checks the manifest s for problems which the parsing of it
+// would pass over: unknown tables and keys, which are likely typos, and
+// values of the wrong type. The warnings it returns are ordered by line, and
+// the error is for the first problem the manifest can't be read with.
 func validateManifest(s string) ([]error, error) {
 	var warns []error
 	// Load the TomlTree from string
@@ -58,96 +223,391 @@ func validateManifest(s string) ([]error, error) {
 	if err != nil {
 		return warns, errors.Wrap(err, "Unable to load TomlTree from string")
 	}
-	// Convert tree to a map
-	manifest := tree.ToMap()
 
 	// match abbreviated git hash (7chars) or hg hash (12chars)
 	abbrevRevHash := regexp.MustCompile("^[a-f0-9]{7}([a-f0-9]{5})?$")
 	// Look for unknown fields and collect errors
-	for prop, val := range manifest {
+	for _, prop := range sortedKeys(tree) {
+		val := tree.Get(prop)
+		pos := tree.GetPosition(prop)
 		switch prop {
 		case "metadata":
-			// Check if metadata is of Map type
-			if reflect.TypeOf(val).Kind() != reflect.Map {
-				warns = append(warns, errors.New("metadata should be a TOML table"))
+			if _, ok := val.(*toml.TomlTree); !ok {
+				warns = append(warns, problemAt(pos, "metadata should be a TOML table"))
+			}
+		case "root":
+			if _, ok := val.(string); !ok {
+				return sortByLine(warns), errInvalidRoot
 			}
 		case "constraint", "override":
-			valid := true
 			// Invalid if type assertion fails. Not a TOML array of tables.
-			if rawProj, ok := val.([]interface{}); ok {
-				// Check element type. Must be a map. Checking one element would be
-				// enough because TOML doesn't allow mixing of types.
-				if reflect.TypeOf(rawProj[0]).Kind() != reflect.Map {
-					valid = false
+			projects, ok := val.([]*toml.TomlTree)
+			if !ok {
+				if prop == "constraint" {
+					return sortByLine(warns), errInvalidConstraint
 				}
+				return sortByLine(warns), errInvalidOverride
+			}
 
-				if valid {
-					// Iterate through each array of tables
-					for _, v := range rawProj {
-						// Check the individual field's key to be valid
-						for key, value := range v.(map[string]interface{}) {
-							// Check if the key is valid
-							switch key {
-							case "name", "branch", "version", "source":
-								// valid key
-							case "revision":
-								if valueStr, ok := value.(string); ok {
-									if abbrevRevHash.MatchString(valueStr) {
-										warns = append(warns, fmt.Errorf("revision %q should not be in abbreviated form", valueStr))
-									}
-								}
-							case "metadata":
-								// Check if metadata is of Map type
-								if reflect.TypeOf(value).Kind() != reflect.Map {
-									warns = append(warns, fmt.Errorf("metadata in %q should be a TOML table", prop))
-								}
-							default:
-								// unknown/invalid key
-								warns = append(warns, fmt.Errorf("Invalid key %q in %q", key, prop))
-							}
+			for _, proj := range projects {
+				for _, key := range sortedKeys(proj) {
+					switch value := proj.Get(key); key {
+					case "name", "branch", "version", "source", "prerelease":
+						// valid key
+					case "revision":
+						if valueStr, ok := value.(string); ok && abbrevRevHash.MatchString(valueStr) {
+							warns = append(warns, problemAt(proj.GetPosition(key), "revision %q should not be in abbreviated form", valueStr))
+						}
+					case "metadata":
+						if _, ok := value.(*toml.TomlTree); !ok {
+							warns = append(warns, problemAt(proj.GetPosition(key), "metadata in %q should be a TOML table", prop))
 						}
+					case "test-only":
+						if _, ok := value.(bool); !ok {
+							return sortByLine(warns), problemAt(proj.GetPosition(key), "\"test-only\" in %q must be a boolean", prop)
+						}
+						if prop == "override" {
+							warns = append(warns, problemAt(proj.GetPosition(key), "\"test-only\" only applies to constraints"))
+						}
+					default:
+						warns = append(warns, unknownKey(proj.GetPosition(key), key, prop, projectKeys))
 					}
 				}
-			} else {
-				valid = false
 			}
-
-			if !valid {
-				if prop == "constraint" {
-					return warns, errInvalidConstraint
-				}
-				if prop == "override" {
-					return warns, errInvalidOverride
+		case "ignored", "required", "noverify":
+			// TOML doesn't allow the mixing of types in an array, so checking
+			// one element is enough. An empty array is valid.
+			if list, ok := val.([]interface{}); !ok || len(list) > 0 && reflect.TypeOf(list[0]).Kind() != reflect.String {
+				switch prop {
+				case "ignored":
+					return sortByLine(warns), errInvalidIgnored
+				case "required":
+					return sortByLine(warns), errInvalidRequired
+				default:
+					return sortByLine(warns), errInvalidNoVerify
 				}
 			}
-		case "ignored", "required":
-			valid := true
-			if rawList, ok := val.([]interface{}); ok {
-				// Check element type of the array. TOML doesn't let mixing of types in
-				// array. Checking one element would be enough. Empty array is valid.
-				if len(rawList) > 0 && reflect.TypeOf(rawList[0]).Kind() != reflect.String {
-					valid = false
+		case "tests":
+			if _, ok := val.(bool); !ok {
+				return sortByLine(warns), errInvalidTests
+			}
+		case "source":
+			sources, ok := val.([]*toml.TomlTree)
+			if !ok {
+				return sortByLine(warns), errInvalidSource
+			}
+			for _, src := range sources {
+				for _, key := range sortedKeys(src) {
+					switch key {
+					case "prefix", "url":
+						if _, ok := src.Get(key).(string); !ok {
+							return sortByLine(warns), problemAt(src.GetPosition(key), "%q in \"source\" must be a string", key)
+						}
+					default:
+						warns = append(warns, unknownKey(src.GetPosition(key), key, prop, sourceKeys))
+					}
 				}
-			} else {
-				valid = false
 			}
+		case "prune":
+			pruneWarns, err := validatePrune(val)
+			warns = append(warns, pruneWarns...)
+			if err != nil {
+				return sortByLine(warns), err
+			}
+		case "solve":
+			solveWarns, err := validateSolve(val)
+			warns = append(warns, solveWarns...)
+			if err != nil {
+				return sortByLine(warns), err
+			}
+		case "build":
+			buildWarns, err := validateBuild(val)
+			warns = append(warns, buildWarns...)
+			if err != nil {
+				return sortByLine(warns), err
+			}
+		case "analysis":
+			analysisWarns, err := validateAnalysis(val)
+			warns = append(warns, analysisWarns...)
+			if err != nil {
+				return sortByLine(warns), err
+			}
+		default:
+			warns = append(warns, unknownKey(pos, prop, "", manifestKeys))
+		}
+	}
 
-			if !valid {
-				if prop == "ignored" {
-					return warns, errInvalidIgnored
-				}
-				if prop == "required" {
-					return warns, errInvalidRequired
+	// Only once the whole manifest has been warned about, look for what's
+	// inconsistent in it.
+	for _, prop := range []string{"constraint", "override"} {
+		if err := validateProjects(tree, prop); err != nil {
+			return sortByLine(warns), err
+		}
+	}
+	if err := validateRequiredIgnored(tree); err != nil {
+		return sortByLine(warns), err
+	}
+
+	return sortByLine(warns), nil
+}
+
+// validatePrune validates the prune table of the manifest, val.
+func validatePrune(val interface{}) ([]error, error) {
+	var warns []error
+	table, ok := val.(*toml.TomlTree)
+	if !ok {
+		return warns, errInvalidPrune
+	}
+
+	for _, key := range sortedKeys(table) {
+		value := table.Get(key)
+		if _, ok := pruneOptionKeys[key]; ok {
+			if _, ok := value.(bool); !ok {
+				return warns, problemAt(table.GetPosition(key), "%q in \"prune\" must be a boolean", key)
+			}
+			continue
+		}
+		if key != "project" {
+			warns = append(warns, unknownKey(table.GetPosition(key), key, "prune", pruneKeys))
+			continue
+		}
+
+		projects, ok := value.([]*toml.TomlTree)
+		if !ok {
+			return warns, problemAt(table.GetPosition(key), "\"project\" in \"prune\" must be a TOML array of tables")
+		}
+		for _, proj := range projects {
+			for _, pkey := range sortedKeys(proj) {
+				if _, ok := pruneOptionKeys[pkey]; ok {
+					if _, ok := proj.Get(pkey).(bool); !ok {
+						return warns, problemAt(proj.GetPosition(pkey), "%q in \"prune.project\" must be a boolean", pkey)
+					}
+				} else if pkey != "name" {
+					warns = append(warns, unknownKey(proj.GetPosition(pkey), pkey, "prune.project", pruneProjectKeys))
 				}
 			}
+		}
+	}
+	return warns, nil
+}
+
+// validateSolve validates the solve table of the manifest, val.
+func validateSolve(val interface{}) ([]error, error) {
+	var warns []error
+	table, ok := val.(*toml.TomlTree)
+	if !ok {
+		return warns, errInvalidSolve
+	}
+
+	for _, key := range sortedKeys(table) {
+		if key != "prefer" {
+			warns = append(warns, unknownKey(table.GetPosition(key), key, "solve", solveKeys))
+			continue
+		}
+		switch table.Get(key) {
+		case preferNewest, preferOldest:
 		default:
-			warns = append(warns, fmt.Errorf("Unknown field in manifest: %v", prop))
+			return warns, problemAt(table.GetPosition(key), "\"prefer\" in \"solve\" must be %q or %q", preferNewest, preferOldest)
 		}
 	}
+	return warns, nil
+}
 
+// validateBuild validates the build table of the manifest, val.
+func validateBuild(val interface{}) ([]error, error) {
+	var warns []error
+	table, ok := val.(*toml.TomlTree)
+	if !ok {
+		return warns, errInvalidBuild
+	}
+
+	for _, key := range sortedKeys(table) {
+		switch key {
+		case "goos", "goarch", "tags":
+		default:
+			warns = append(warns, unknownKey(table.GetPosition(key), key, "build", buildKeys))
+			continue
+		}
+
+		list, ok := table.Get(key).([]interface{})
+		if !ok {
+			return warns, problemAt(table.GetPosition(key), "%q in \"build\" must be a TOML list of strings", key)
+		}
+		for _, v := range list {
+			s, ok := v.(string)
+			if !ok {
+				return warns, problemAt(table.GetPosition(key), "%q in \"build\" must be a TOML list of strings", key)
+			}
+			if name := strings.TrimPrefix(s, "!"); name == "" || strings.ContainsAny(name, ", !") || key != "tags" && name != s {
+				return warns, problemAt(table.GetPosition(key), "invalid %q in %q in \"build\"", s, key)
+			}
+		}
+	}
 	return warns, nil
 }
 
+// validateAnalysis validates the analysis table of the manifest, val. The dirs
+// in it must be relative to the root of the project, and within it.
+func validateAnalysis(val interface{}) ([]error, error) {
+	var warns []error
+	table, ok := val.(*toml.TomlTree)
+	if !ok {
+		return warns, errInvalidAnalysis
+	}
+
+	for _, key := range sortedKeys(table) {
+		switch key {
+		case "exclude-dirs", "include-dirs":
+		default:
+			warns = append(warns, unknownKey(table.GetPosition(key), key, "analysis", analysisKeys))
+			continue
+		}
+
+		list, ok := table.Get(key).([]interface{})
+		if !ok {
+			return warns, problemAt(table.GetPosition(key), "%q in \"analysis\" must be a TOML list of strings", key)
+		}
+		for _, v := range list {
+			s, ok := v.(string)
+			if !ok {
+				return warns, problemAt(table.GetPosition(key), "%q in \"analysis\" must be a TOML list of strings", key)
+			}
+			dir := path.Clean(s)
+			if s == "" || dir == "." || path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+				return warns, problemAt(table.GetPosition(key), "invalid %q in %q in \"analysis\", must be a dir within the project", s, key)
+			}
+		}
+	}
+	return warns, nil
+}
+
+// validateProjects checks that each project of the prop array of tables of the
+// manifest tree appears in it only once, with only one kind of constraint.
+func validateProjects(tree *toml.TomlTree, prop string) error {
+	projects, _ := tree.Get(prop).([]*toml.TomlTree)
+	seen := make(map[string]toml.Position, len(projects))
+	for _, proj := range projects {
+		name, _ := proj.Get("name").(string)
+		if name == "" {
+			continue
+		}
+
+		var n int
+		for _, key := range []string{"branch", "version", "revision"} {
+			if proj.Has(key) {
+				n++
+			}
+		}
+		if n > 1 {
+			return problemAt(proj.GetPosition(""), "multiple constraints specified for %s, can only specify one", name)
+		}
+
+		if first, exists := seen[name]; exists {
+			kind := "dependencies"
+			if prop == "override" {
+				kind = "overrides"
+			}
+			return problemAt(proj.GetPosition(""), "multiple %s specified for %s, can only specify one (also on line %d)", kind, name, first.Line)
+		}
+		seen[name] = proj.GetPosition("")
+	}
+	return nil
+}
+
+// validateRequiredIgnored checks that none of the required packages of the
+// manifest tree are also ignored, as the solver can't do both.
+func validateRequiredIgnored(tree *toml.TomlTree) error {
+	required, _ := tree.Get("required").([]interface{})
+	ignored, _ := tree.Get("ignored").([]interface{})
+	if len(required) == 0 || len(ignored) == 0 {
+		return nil
+	}
+
+	ig := make(map[string]bool, len(ignored))
+	for _, v := range ignored {
+		ig[v.(string)] = true
+	}
+	for _, v := range required {
+		if req := v.(string); pkgtree.IsIgnored(req, ig) {
+			return problemAt(tree.GetPosition("required"), "%q is both required and ignored, can only be one", req)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the table, sorted, so that problems are found
+// in the same order each time.
+func sortedKeys(table *toml.TomlTree) []string {
+	keys := table.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+// byLine sorts the problems of a manifest by the line they're on.
+type byLine []error
+
+func (s byLine) Len() int           { return len(s) }
+func (s byLine) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLine) Less(i, j int) bool { return problemLine(s[i]) < problemLine(s[j]) }
+
+func problemLine(err error) int {
+	if p, ok := err.(manifestProblem); ok {
+		return p.line
+	}
+	return 0
+}
+
+// sortByLine sorts the problems of a manifest by the line they're on, keeping
+// those on the same line in the order they were found.
+func sortByLine(problems []error) []error {
+	sort.Stable(byLine(problems))
+	return problems
+}
+
+// closest returns the one of the known keys that key is most likely a typo of,
+// or "" if none is close enough to it to be.
+func closest(key string, known []string) string {
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(key, k); d < bestDist && d < len(key) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and
+// transpositions of adjacent characters that turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
 // readManifest returns a Manifest read from r and a slice of validation warnings.
 func readManifest(r io.Reader) (*Manifest, []error, error) {
 	buf := &bytes.Buffer{}
@@ -168,15 +628,47 @@ func readManifest(r io.Reader) (*Manifest, []error, error) {
 	}
 
 	m, err := fromRawManifest(raw)
-	return m, warns, err
+	if err != nil {
+		return nil, warns, err
+	}
+	warns = append(warns, m.mirrorConflicts()...)
+	warns = append(warns, m.gopkginConflicts()...)
+
+	tree, err := toml.LoadReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, warns, errors.Wrap(err, "Unable to parse the manifest as TOML")
+	}
+	if meta, ok := tree.Get("metadata").(*toml.TomlTree); ok {
+		m.Meta = meta.ToMap()
+	}
+
+	return m, warns, nil
 }
 
 func fromRawManifest(raw rawManifest) (*Manifest, error) {
 	m := &Manifest{
+		Root:        raw.Root,
 		Constraints: make(gps.ProjectConstraints, len(raw.Constraints)),
 		Ovr:         make(gps.ProjectConstraints, len(raw.Overrides)),
 		Ignored:     raw.Ignored,
 		Required:    raw.Required,
+		NoVerify:    raw.NoVerify,
+	}
+
+	if raw.Root != "" {
+		if err := ValidateRoot(raw.Root); err != nil {
+			return nil, errors.Wrapf(err, "invalid root %q", raw.Root)
+		}
+	}
+	for _, ig := range raw.Ignored {
+		if err := validateIgnored(ig); err != nil {
+			return nil, errors.Wrapf(err, "invalid ignored path %q", ig)
+		}
+	}
+	for _, req := range raw.Required {
+		if err := validateRequired(req); err != nil {
+			return nil, errors.Wrapf(err, "invalid required package %q", req)
+		}
 	}
 
 	for i := 0; i < len(raw.Constraints); i++ {
@@ -188,6 +680,12 @@ func fromRawManifest(raw rawManifest) (*Manifest, error) {
 			return nil, errors.Errorf("multiple dependencies specified for %s, can only specify one", name)
 		}
 		m.Constraints[name] = prj
+		if raw.Constraints[i].TestOnly {
+			if m.TestOnly == nil {
+				m.TestOnly = make(map[gps.ProjectRoot]bool)
+			}
+			m.TestOnly[name] = true
+		}
 	}
 
 	for i := 0; i < len(raw.Overrides); i++ {
@@ -201,9 +699,193 @@ func fromRawManifest(raw rawManifest) (*Manifest, error) {
 		m.Ovr[name] = prj
 	}
 
+	if len(raw.Sources) > 0 {
+		m.Mirrors = make(gps.SourceMirrors, len(raw.Sources))
+	}
+	for _, rs := range raw.Sources {
+		if rs.Prefix == "" || rs.URL == "" {
+			return nil, errors.New("each \"source\" must have both a prefix and a url")
+		}
+		if _, err := gps.ExpandSourceEnv(rs.URL); err != nil {
+			return nil, errors.Wrapf(err, "invalid url for the prefix %s", rs.Prefix)
+		}
+		if _, exists := m.Mirrors[rs.Prefix]; exists {
+			return nil, errors.Errorf("multiple sources specified for the prefix %s, can only specify one", rs.Prefix)
+		}
+		m.Mirrors[rs.Prefix] = rs.URL
+	}
+
+	if raw.Tests != nil {
+		m.ExcludeTests = !*raw.Tests
+	}
+
+	if raw.Solve != nil {
+		m.PreferOldest = raw.Solve.Prefer == preferOldest
+	}
+
+	if raw.Build != nil {
+		m.Build = pkgtree.BuildMatrix{
+			GOOS:   raw.Build.GOOS,
+			GOARCH: raw.Build.GOARCH,
+			Tags:   raw.Build.Tags,
+		}
+	}
+
+	if raw.Analysis != nil {
+		m.ExcludeDirs = raw.Analysis.ExcludeDirs
+		m.IncludeDirs = raw.Analysis.IncludeDirs
+	}
+
+	if raw.Prune != nil {
+		po, err := fromRawPruneOptions(*raw.Prune)
+		if err != nil {
+			return nil, err
+		}
+		m.PruneOptions = po
+	}
+
 	return m, nil
 }
 
+func fromRawPruneOptions(raw rawPruneOptions) (gps.CascadingPruneOptions, error) {
+	po := gps.CascadingPruneOptions{
+		PerProjectOptions: make(map[gps.ProjectRoot]gps.PruneOptionSet, len(raw.Projects)),
+	}
+	if raw.UnusedPackages {
+		po.DefaultOptions |= gps.PruneUnusedPackages
+	}
+	if raw.NonGoFiles {
+		po.DefaultOptions |= gps.PruneNonGoFiles
+	}
+	if raw.GoTests {
+		po.DefaultOptions |= gps.PruneGoTestFiles
+	}
+
+	for _, rp := range raw.Projects {
+		if rp.Name == "" {
+			return po, errors.New("each project in \"prune\" must have a name")
+		}
+		pr := gps.ProjectRoot(rp.Name)
+		if _, exists := po.PerProjectOptions[pr]; exists {
+			return po, errors.Errorf("multiple prune options specified for %s, can only specify one", pr)
+		}
+
+		var pos gps.PruneOptionSet
+		set := func(b *bool, o gps.PruneOptions) {
+			if b == nil {
+				return
+			}
+			pos.Overridden |= o
+			if *b {
+				pos.Options |= o
+			}
+		}
+		set(rp.UnusedPackages, gps.PruneUnusedPackages)
+		set(rp.NonGoFiles, gps.PruneNonGoFiles)
+		set(rp.GoTests, gps.PruneGoTestFiles)
+		po.PerProjectOptions[pr] = pos
+	}
+	return po, nil
+}
+
+// mirrorConflicts returns a warning for each constraint and override which
+// gives a source of its own for a project the mirrors would otherwise fetch
+// from elsewhere. The source of the constraint is used, being specific to the
+// project.
+func (m *Manifest) mirrorConflicts() []error {
+	if len(m.Mirrors) == 0 {
+		return nil
+	}
+
+	var warns []error
+	check := func(pc gps.ProjectConstraints, kind string) {
+		roots := make([]string, 0, len(pc))
+		for pr := range pc {
+			roots = append(roots, string(pr))
+		}
+		sort.Strings(roots)
+		for _, pr := range roots {
+			pp := pc[gps.ProjectRoot(pr)]
+			if pp.Source == "" {
+				continue
+			}
+			id := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr), Source: pp.Source}
+			mirrored := m.Mirrors.Apply(gps.ProjectIdentifier{ProjectRoot: id.ProjectRoot})
+			if mirrored.Source != "" && m.Mirrors.Apply(id) == id {
+				warns = append(warns, fmt.Errorf("the source %q of the %s on %s is used rather than its mirror %q", pp.Source, kind, pr, mirrored.Source))
+			}
+		}
+	}
+	check(m.Constraints, "constraint")
+	check(m.Ovr, "override")
+	return warns
+}
+
+// gopkginConflicts returns a warning for each semver constraint and override on
+// a gopkg.in project which allows none of the versions of the major version
+// its import path names, the only ones gopkg.in serves, e.g. ^2.0.0 on
+// gopkg.in/yaml.v3.
+func (m *Manifest) gopkginConflicts() []error {
+	var warns []error
+	check := func(pc gps.ProjectConstraints, kind string) {
+		roots := make([]string, 0, len(pc))
+		for pr := range pc {
+			roots = append(roots, string(pr))
+		}
+		sort.Strings(roots)
+		for _, pr := range roots {
+			c := pc[gps.ProjectRoot(pr)].Constraint
+			ic, ok := gps.GopkginConstraint(gps.ProjectRoot(pr))
+			if !ok || c == nil || gps.IsAny(c) {
+				continue
+			}
+			if v, ok := c.(gps.Version); ok && v.Type() != gps.IsSemver {
+				continue
+			}
+			if !ic.MatchesAny(c) {
+				warns = append(warns, fmt.Errorf("the %s %s on %s allows none of the versions %s which its import path restricts it to", kind, c, pr, ic))
+			}
+		}
+	}
+	check(m.Constraints, "constraint")
+	check(m.Ovr, "override")
+	return warns
+}
+
+// validateIgnored checks that the ignored import path ig has no wildcard, other
+// than one ending it to ignore the whole tree of packages beneath it.
+func validateIgnored(ig string) error {
+	prefix := strings.TrimSuffix(ig, pkgtree.IgnoreWildcardSuffix)
+	if strings.Contains(prefix, "*") || (prefix == "" && ig != "") {
+		return errInvalidWildcard
+	}
+	return nil
+}
+
+// validateRequired checks that the required entry req looks like the import
+// path of a single package. Whether it is a buildable package, rather than a
+// project root without one, can only be told once its project is solved.
+func validateRequired(req string) error {
+	switch {
+	case req == "",
+		strings.ContainsAny(req, "*\\"),
+		strings.Contains(req, "..."),
+		strings.HasPrefix(req, "/"), strings.HasSuffix(req, "/"),
+		strings.HasPrefix(req, "./"), strings.HasPrefix(req, "../"):
+		return errRequiredNotPkg
+	}
+	return nil
+}
+
+// ValidateRoot checks that root looks like the import path of a project, to
+// be the root of a project outside of GOPATH.
+func ValidateRoot(root string) error {
+	if validateRequired(root) != nil || strings.Contains(root, "//") {
+		return errRootNotImportPath
+	}
+	return nil
+}
+
 // toProject interprets the string representations of project information held in
 // a rawProject, converting them into a proper gps.ProjectProperties. An
 // error is returned if the rawProject contains some invalid combination -
@@ -222,6 +904,10 @@ func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err
 
 		// always semver if we can
 		pp.Constraint, err = gps.NewSemverConstraintIC(raw.Version)
+		if err != nil && strings.Contains(raw.Version, "||") {
+			// A union of ranges can only have been meant as semver.
+			return n, pp, errors.Wrapf(err, "invalid version constraint %q for %s", raw.Version, n)
+		}
 		if err != nil {
 			// but if not, fall back on plain versions
 			pp.Constraint = gps.NewVersion(raw.Version)
@@ -234,6 +920,19 @@ func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err
 		pp.Constraint = gps.Any()
 	}
 
+	if raw.Prerelease {
+		if _, ok := pp.Constraint.(gps.Version); ok || gps.IsAny(pp.Constraint) {
+			return n, pp, errors.Errorf("prerelease without version range specified for %s, it only applies to ranges", n)
+		}
+		pp.Constraint = gps.WithPrereleases(pp.Constraint)
+	}
+
+	// The source is kept as it's written, for it to be written back so, but
+	// any environment variables it refers to have to be set for it to be
+	// fetched.
+	if _, err := gps.ExpandSourceEnv(raw.Source); err != nil {
+		return n, pp, errors.Wrapf(err, "invalid source for %s", n)
+	}
 	pp.Source = raw.Source
 	return n, pp, nil
 }
@@ -241,13 +940,17 @@ func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err
 // toRaw converts the manifest into a representation suitable to write to the manifest file
 func (m *Manifest) toRaw() rawManifest {
 	raw := rawManifest{
+		Root:        m.Root,
 		Constraints: make([]rawProject, 0, len(m.Constraints)),
 		Overrides:   make([]rawProject, 0, len(m.Ovr)),
 		Ignored:     m.Ignored,
 		Required:    m.Required,
+		NoVerify:    m.NoVerify,
 	}
 	for n, prj := range m.Constraints {
-		raw.Constraints = append(raw.Constraints, toRawProject(n, prj))
+		rp := toRawProject(n, prj)
+		rp.TestOnly = m.TestOnly[n]
+		raw.Constraints = append(raw.Constraints, rp)
 	}
 	sort.Sort(sortedRawProjects(raw.Constraints))
 
@@ -256,6 +959,73 @@ func (m *Manifest) toRaw() rawManifest {
 	}
 	sort.Sort(sortedRawProjects(raw.Overrides))
 
+	if m.ExcludeTests {
+		tests := false
+		raw.Tests = &tests
+	}
+	raw.Prune = toRawPruneOptions(m.PruneOptions)
+	if m.PreferOldest {
+		raw.Solve = &rawSolveOptions{Prefer: preferOldest}
+	}
+	if !m.Build.IsEmpty() {
+		raw.Build = &rawBuildMatrix{
+			GOOS:   m.Build.GOOS,
+			GOARCH: m.Build.GOARCH,
+			Tags:   m.Build.Tags,
+		}
+	}
+	if len(m.ExcludeDirs) > 0 || len(m.IncludeDirs) > 0 {
+		raw.Analysis = &rawAnalysis{
+			ExcludeDirs: m.ExcludeDirs,
+			IncludeDirs: m.IncludeDirs,
+		}
+	}
+
+	prefixes := make([]string, 0, len(m.Mirrors))
+	for prefix := range m.Mirrors {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		raw.Sources = append(raw.Sources, rawSource{Prefix: prefix, URL: m.Mirrors[prefix]})
+	}
+	return raw
+}
+
+// toRawPruneOptions returns nil if po prunes nothing, so that the manifest
+// doesn't gain an empty prune table.
+func toRawPruneOptions(po gps.CascadingPruneOptions) *rawPruneOptions {
+	if po.DefaultOptions == 0 && len(po.PerProjectOptions) == 0 {
+		return nil
+	}
+
+	raw := &rawPruneOptions{
+		UnusedPackages: po.DefaultOptions&gps.PruneUnusedPackages != 0,
+		NonGoFiles:     po.DefaultOptions&gps.PruneNonGoFiles != 0,
+		GoTests:        po.DefaultOptions&gps.PruneGoTestFiles != 0,
+	}
+
+	roots := make([]string, 0, len(po.PerProjectOptions))
+	for pr := range po.PerProjectOptions {
+		roots = append(roots, string(pr))
+	}
+	sort.Strings(roots)
+	for _, pr := range roots {
+		pos := po.PerProjectOptions[gps.ProjectRoot(pr)]
+		get := func(o gps.PruneOptions) *bool {
+			if pos.Overridden&o == 0 {
+				return nil
+			}
+			b := pos.Options&o != 0
+			return &b
+		}
+		raw.Projects = append(raw.Projects, rawPruneProjectOptions{
+			Name:           pr,
+			UnusedPackages: get(gps.PruneUnusedPackages),
+			NonGoFiles:     get(gps.PruneNonGoFiles),
+			GoTests:        get(gps.PruneGoTestFiles),
+		})
+	}
 	return raw
 }
 
@@ -280,7 +1050,21 @@ func (s sortedRawProjects) Less(i, j int) bool {
 func (m *Manifest) MarshalTOML() ([]byte, error) {
 	raw := m.toRaw()
 	result, err := toml.Marshal(raw)
-	return result, errors.Wrap(err, "Unable to marshal the lock to a TOML string")
+	if err != nil || len(m.Meta) == 0 {
+		return result, errors.Wrap(err, "Unable to marshal the lock to a TOML string")
+	}
+
+	tree, err := toml.LoadReader(bytes.NewReader(result))
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to marshal the manifest to a TOML string")
+	}
+	meta, err := toml.TreeFromMap(m.Meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to marshal the manifest metadata to a TOML string")
+	}
+	tree.Set("metadata", meta)
+	s, err := tree.ToTomlString()
+	return []byte(s), errors.Wrap(err, "Unable to marshal the manifest to a TOML string")
 }
 
 func toRawProject(name gps.ProjectRoot, project gps.ProjectProperties) rawProject {
@@ -307,8 +1091,15 @@ func toRawProject(name gps.ProjectRoot, project gps.ProjectProperties) rawProjec
 	// we interpret not having any constraint expressions at all to mean.
 	// if !gps.IsAny(pp.Constraint) && !gps.IsNone(pp.Constraint) {
 	if !gps.IsAny(project.Constraint) && project.Constraint != nil {
-		// Has to be a semver range.
+		// Has to be a semver range, or a union of them. Each range of a
+		// union, or of a range with exclusions, is written out with its
+		// operator, as a bare version among them would read as that
+		// version alone.
 		raw.Version = project.Constraint.ImpliedCaretString()
+		if strings.Contains(raw.Version, "||") || strings.Contains(raw.Version, "!=") {
+			raw.Version = project.Constraint.String()
+		}
+		raw.Prerelease = gps.AllowsPrereleases(project.Constraint)
 	}
 	return raw
 }
@@ -323,7 +1114,8 @@ func (m *Manifest) Overrides() gps.ProjectConstraints {
 	return m.Ovr
 }
 
-// IgnoredPackages returns a set of import paths to ignore.
+// IgnoredPackages returns a set of import paths to ignore. Paths ending in
+// pkgtree.IgnoreWildcardSuffix ignore every package beneath them, as well.
 func (m *Manifest) IgnoredPackages() map[string]bool {
 	if len(m.Ignored) == 0 {
 		return nil
@@ -350,6 +1142,21 @@ func (m *Manifest) HasConstraintsOn(root gps.ProjectRoot) bool {
 	return false
 }
 
+// NoVerifyProjects returns the set of roots of the projects which aren't
+// verified in vendor/.
+func (m *Manifest) NoVerifyProjects() map[gps.ProjectRoot]bool {
+	if len(m.NoVerify) == 0 {
+		return nil
+	}
+
+	mp := make(map[gps.ProjectRoot]bool, len(m.NoVerify))
+	for _, pr := range m.NoVerify {
+		mp[gps.ProjectRoot(pr)] = true
+	}
+
+	return mp
+}
+
 // RequiredPackages returns a set of import paths to require.
 func (m *Manifest) RequiredPackages() map[string]bool {
 	if len(m.Required) == 0 {
@@ -0,0 +1,432 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+var (
+	tomlTableRE = regexp.MustCompile(`^\s*\[\[?\s*([A-Za-z0-9_.-]+)\s*\]\]?\s*(#.*)?$`)
+	tomlKeyRE   = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+)\s*=`)
+	tomlNameRE  = regexp.MustCompile(`^\s*name\s*=\s*"([^"]*)"`)
+)
+
+// manifestSection is a run of the lines of a manifest file: those above its
+// first table, or a table along with the tables nested in it, e.g. the
+// [[prune.project]] tables of [prune], and the comments directly above it.
+type manifestSection struct {
+	table string // "" for the lines above the first table
+	name  string // The project of a constraint or override
+	lines []string
+}
+
+// EditManifest returns orig, the contents of a manifest file, with the
+// changes edit makes to the manifest read from it. Only the tables and keys
+// which are changed are rewritten, so that the comments and layout of the
+// rest are kept as they were; new constraints and overrides are added after
+// the last ones there are.
+func EditManifest(orig []byte, edit func(*Manifest)) ([]byte, error) {
+	m, _, err := readManifest(bytes.NewReader(orig))
+	if err != nil {
+		return nil, err
+	}
+	edit(m)
+	return updateManifestTOML(orig, m)
+}
+
+// updateManifestTOML returns orig, the contents of a manifest file, edited to
+// hold m, as EditManifest does. Should the edit not read back as m, e.g.
+// because orig is laid out in a way the edit can't cope with, m is marshaled
+// anew instead.
+func updateManifestTOML(orig []byte, m *Manifest) ([]byte, error) {
+	om, _, err := readManifest(bytes.NewReader(orig))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the manifest to be edited")
+	}
+	want, err := m.MarshalTOML()
+	if err != nil {
+		return nil, err
+	}
+	if have, err := om.MarshalTOML(); err == nil && bytes.Equal(have, want) {
+		return orig, nil
+	}
+
+	oraw, raw := om.toRaw(), m.toRaw()
+	sections := splitManifestSections(orig)
+	sections[0].lines = editTopLevelLists(sections[0].lines, len(sections) > 1, []topLevelList{
+		{"ignored", oraw.Ignored, raw.Ignored},
+		{"noverify", oraw.NoVerify, raw.NoVerify},
+		{"required", oraw.Required, raw.Required},
+	})
+	sections, err = editProjectTables(sections, "constraint", oraw.Constraints, raw.Constraints)
+	if err != nil {
+		return nil, err
+	}
+	sections, err = editProjectTables(sections, "override", oraw.Overrides, raw.Overrides)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(oraw.Prune, raw.Prune) {
+		var lines []string
+		if raw.Prune != nil {
+			if lines, err = marshalTOMLLines(rawManifest{Prune: raw.Prune}); err != nil {
+				return nil, err
+			}
+		}
+		sections = replaceTable(sections, "prune", lines)
+	}
+	if !reflect.DeepEqual(om.Meta, m.Meta) {
+		var lines []string
+		if len(m.Meta) > 0 {
+			tree, err := toml.TreeFromMap(map[string]interface{}{"metadata": m.Meta})
+			if err != nil {
+				return nil, errors.Wrap(err, "Unable to marshal the manifest metadata to a TOML string")
+			}
+			s, err := tree.ToTomlString()
+			if err != nil {
+				return nil, errors.Wrap(err, "Unable to marshal the manifest metadata to a TOML string")
+			}
+			lines = trimBlankLines(strings.Split(s, "\n"))
+		}
+		sections = replaceTable(sections, "metadata", lines)
+	}
+
+	var lines []string
+	for _, s := range sections {
+		lines = append(lines, s.lines...)
+	}
+	// Removing the last table can leave blank lines at the end.
+	for len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	edited := []byte(strings.Join(lines, "\n") + "\n")
+
+	em, _, err := readManifest(bytes.NewReader(edited))
+	if err != nil {
+		return want, nil
+	}
+	if got, err := em.MarshalTOML(); err != nil || !bytes.Equal(got, want) {
+		return want, nil
+	}
+	return edited, nil
+}
+
+// splitManifestSections splits the manifest file b into sections. The
+// comments directly above a table, without a blank line between, are taken
+// to be about it.
+func splitManifestSections(b []byte) []*manifestSection {
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	sections := []*manifestSection{{}}
+	nested := false
+	for _, line := range lines {
+		cur := sections[len(sections)-1]
+		m := tomlTableRE.FindStringSubmatch(line)
+		switch {
+		case m != nil && cur.table != "" && strings.HasPrefix(m[1], cur.table+"."):
+			nested = true
+		case m != nil:
+			i := len(cur.lines)
+			for i > 0 && strings.HasPrefix(strings.TrimSpace(cur.lines[i-1]), "#") {
+				i--
+			}
+			s := &manifestSection{table: m[1], lines: append([]string(nil), cur.lines[i:]...)}
+			cur.lines = cur.lines[:i]
+			sections = append(sections, s)
+			nested = false
+			cur = s
+		case cur.name == "" && !nested:
+			if nm := tomlNameRE.FindStringSubmatch(line); nm != nil {
+				cur.name = nm[1]
+			}
+		}
+		cur.lines = append(cur.lines, line)
+	}
+	return sections
+}
+
+// topLevelList is a list of the manifest which is a key above its tables, as
+// the manifest read had it, and as it's to be written.
+type topLevelList struct {
+	key      string
+	old, new []string
+}
+
+// editTopLevelLists rewrites the lists which changed in lines, those above
+// the first table of a manifest file, removing those which are now empty.
+// Those which are new are added after the last key there, or if there isn't
+// any, after any comments; tables is whether there are tables below lines.
+func editTopLevelLists(lines []string, tables bool, lists []topLevelList) []string {
+	for _, l := range lists {
+		if len(l.old) == 0 && len(l.new) == 0 || reflect.DeepEqual(l.old, l.new) {
+			continue
+		}
+
+		var rendered []string
+		if len(l.new) > 0 {
+			rendered = []string{fmt.Sprintf("%s = %s", l.key, formatTOMLStrings(l.new))}
+		}
+
+		start, end := findTOMLKey(lines, l.key)
+		if start >= 0 {
+			lines = append(lines[:start], append(rendered, lines[end:]...)...)
+			continue
+		}
+
+		at := 0
+		for i, line := range lines {
+			if tomlKeyRE.MatchString(line) {
+				_, at = findTOMLKey(lines[i:], tomlKeyRE.FindStringSubmatch(line)[2])
+				at += i
+			}
+		}
+		if at == 0 {
+			for at = len(lines); at > 0 && strings.TrimSpace(lines[at-1]) == ""; at-- {
+			}
+			if at > 0 {
+				rendered = append([]string{""}, rendered...)
+			}
+		}
+		if tables && (at == len(lines) || strings.TrimSpace(lines[at]) != "") {
+			rendered = append(rendered, "")
+		}
+		lines = append(lines[:at], append(rendered, lines[at:]...)...)
+	}
+	return lines
+}
+
+// findTOMLKey returns the range of lines which holds the key, and its value,
+// which may span lines if it's an array, or -1 if lines doesn't hold it.
+func findTOMLKey(lines []string, key string) (int, int) {
+	for i, line := range lines {
+		if m := tomlKeyRE.FindStringSubmatch(line); m == nil || m[2] != key {
+			continue
+		}
+		depth := 0
+		for j := i; j < len(lines); j++ {
+			depth += tomlBracketDepth(lines[j])
+			if depth <= 0 {
+				return i, j + 1
+			}
+		}
+		return i, len(lines)
+	}
+	return -1, -1
+}
+
+// tomlBracketDepth returns how many more brackets line opens than it closes,
+// outside of strings and comments.
+func tomlBracketDepth(line string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return depth
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+func formatTOMLStrings(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// editProjectTables edits the tables of sections, such as the
+// [[constraint]] ones, which hold the projects old to hold those of new
+// instead. Tables of projects which are gone are removed, along with the
+// comments about them, those of projects which changed have their rules
+// rewritten, and those of projects which are new are added, sorted, after the
+// last of the tables there are, or at the end.
+func editProjectTables(sections []*manifestSection, table string, old, new []rawProject) ([]*manifestSection, error) {
+	oldProjects := make(map[string]rawProject, len(old))
+	for _, rp := range old {
+		oldProjects[rp.Name] = rp
+	}
+	newProjects := make(map[string]rawProject, len(new))
+	for _, rp := range new {
+		newProjects[rp.Name] = rp
+	}
+
+	var kept []*manifestSection
+	last := -1
+	for _, s := range sections {
+		if s.table == table {
+			rp, has := newProjects[s.name]
+			if !has {
+				continue
+			}
+			if rp != oldProjects[s.name] {
+				s.lines = rewriteProjectRules(s.lines, rp)
+			}
+			last = len(kept)
+		}
+		kept = append(kept, s)
+	}
+
+	var added []*manifestSection
+	for _, rp := range new {
+		if _, has := oldProjects[rp.Name]; has {
+			continue
+		}
+		var raw rawManifest
+		if table == "constraint" {
+			raw.Constraints = []rawProject{rp}
+		} else {
+			raw.Overrides = []rawProject{rp}
+		}
+		lines, err := marshalTOMLLines(raw)
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, &manifestSection{table: table, name: rp.Name, lines: lines})
+	}
+	if len(added) == 0 {
+		return kept, nil
+	}
+
+	at := len(kept)
+	if last >= 0 {
+		at = last + 1
+	}
+	return insertSections(kept, at, added), nil
+}
+
+// rewriteProjectRules rewrites the rules of the project table lines, such as
+// its version or source, to be those of rp, where they were, or after its
+// name.
+func rewriteProjectRules(lines []string, rp rawProject) []string {
+	var out []string
+	indent, at, afterName := "  ", -1, len(lines)
+	header, nested := false, false
+	for _, line := range lines {
+		if tomlTableRE.MatchString(line) {
+			nested = header
+			header = true
+		}
+		if m := tomlKeyRE.FindStringSubmatch(line); m != nil && header && !nested {
+			switch m[2] {
+			case "branch", "revision", "source", "version", "prerelease":
+				if at < 0 {
+					at = len(out)
+				}
+				continue
+			case "name":
+				indent, afterName = m[1], len(out)+1
+			}
+		}
+		out = append(out, line)
+	}
+	if at < 0 {
+		at = afterName
+	}
+
+	var rules []string
+	for _, r := range []struct{ key, value string }{
+		{"branch", rp.Branch},
+		{"revision", rp.Revision},
+		{"source", rp.Source},
+		{"version", rp.Version},
+	} {
+		if r.value != "" {
+			rules = append(rules, fmt.Sprintf("%s%s = %q", indent, r.key, r.value))
+		}
+	}
+	if rp.Prerelease {
+		rules = append(rules, fmt.Sprintf("%sprerelease = true", indent))
+	}
+	return append(out[:at:at], append(rules, out[at:]...)...)
+}
+
+// replaceTable replaces the table of sections, such as [prune], with lines,
+// keeping the comments about it, or removes it if lines is empty. A table
+// which isn't there yet is added at the end.
+func replaceTable(sections []*manifestSection, table string, lines []string) []*manifestSection {
+	for i, s := range sections {
+		if s.table != table {
+			continue
+		}
+		if len(lines) == 0 {
+			return append(sections[:i], sections[i+1:]...)
+		}
+		var comments, trailing []string
+		for _, line := range s.lines {
+			if tomlTableRE.MatchString(line) {
+				break
+			}
+			comments = append(comments, line)
+		}
+		for j := len(s.lines); j > 0 && strings.TrimSpace(s.lines[j-1]) == ""; j-- {
+			trailing = append(trailing, "")
+		}
+		s.lines = append(append(comments, lines...), trailing...)
+		return sections
+	}
+	if len(lines) == 0 {
+		return sections
+	}
+	return insertSections(sections, len(sections), []*manifestSection{{table: table, lines: lines}})
+}
+
+// insertSections inserts the new sections into sections before the one at
+// index at, separated from what's around them by blank lines.
+func insertSections(sections []*manifestSection, at int, added []*manifestSection) []*manifestSection {
+	for i, s := range added {
+		before := sections[at-1+i].lines
+		if len(before) > 0 && strings.TrimSpace(before[len(before)-1]) != "" {
+			s.lines = append([]string{""}, s.lines...)
+		}
+		sections = append(sections[:at+i], append([]*manifestSection{s}, sections[at+i:]...)...)
+	}
+	if next := at + len(added); next < len(sections) {
+		last := added[len(added)-1]
+		last.lines = append(last.lines, "")
+	}
+	return sections
+}
+
+// marshalTOMLLines marshals raw, returning its lines without the blank ones
+// around them.
+func marshalTOMLLines(raw rawManifest) ([]string, error) {
+	b, err := toml.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to marshal the manifest to a TOML string")
+	}
+	return trimBlankLines(strings.Split(string(b), "\n")), nil
+}
+
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestEditManifestKeepsUnchanged(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	orig := h.GetTestFileString("manifest/commented.toml")
+	got, err := EditManifest([]byte(orig), func(m *Manifest) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != orig {
+		t.Errorf("Manifest without changes was not kept as it was:\n\t(GOT): %s\n\t(WNT): %s", got, orig)
+	}
+}
+
+func TestEditManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/commented_edited.toml"
+	got, err := EditManifest([]byte(h.GetTestFileString("manifest/commented.toml")), func(m *Manifest) {
+		v1, _ := gps.NewSemverConstraint("^1.0.0")
+		v2, _ := gps.NewSemverConstraint("~2.1.0")
+		m.Constraints["github.com/sdboyer/deptest"] = gps.ProjectProperties{Constraint: v1}
+		m.Constraints["github.com/sdboyer/deptesttres"] = gps.ProjectProperties{Constraint: v2}
+		delete(m.Constraints, "github.com/babble/brook")
+		m.Ignored = append(m.Ignored, "github.com/foo/baz")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := h.GetTestFileString(golden)
+	if string(got) != want {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(golden, string(got)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			t.Errorf("Manifest was not edited as expected:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+		}
+	}
+}
+
+func TestEditManifestAddsTables(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	orig := "# Our dependencies.\n"
+	got, err := EditManifest([]byte(orig), func(m *Manifest) {
+		m.Required = []string{"github.com/golang/lint/golint"}
+		m.Ovr["github.com/sdboyer/deptest"] = gps.ProjectProperties{Constraint: gps.NewBranch("master")}
+		m.PruneOptions.DefaultOptions = gps.PruneUnusedPackages
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Our dependencies.
+
+required = ["github.com/golang/lint/golint"]
+
+[[override]]
+  branch = "master"
+  name = "github.com/sdboyer/deptest"
+
+[prune]
+  unused-packages = true
+`
+	if string(got) != want {
+		t.Errorf("Manifest was not edited as expected:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+}
+
+func TestEditManifestPrerelease(t *testing.T) {
+	orig := `[[constraint]]
+  name = "github.com/sdboyer/deptest"
+  version = "1.0.0" # until 2.0 is out
+`
+	got, err := EditManifest([]byte(orig), func(m *Manifest) {
+		c, _ := gps.NewSemverConstraintIC(">=2.0.0-rc1")
+		m.Constraints["github.com/sdboyer/deptest"] = gps.ProjectProperties{Constraint: gps.WithPrereleases(c)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[[constraint]]
+  name = "github.com/sdboyer/deptest"
+  version = ">=2.0.0-rc1"
+  prerelease = true
+`
+	if string(got) != want {
+		t.Errorf("Manifest was not edited as expected:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+}
@@ -6,11 +6,13 @@ package dep
 
 import (
 	"errors"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -96,6 +98,442 @@ func TestWriteManifest(t *testing.T) {
 	}
 }
 
+func TestManifestMetadataRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/metadata.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	wantMeta := map[string]interface{}{
+		"imported-from": "glide",
+		"imported-at":   "2017-09-01T12:00:00Z",
+	}
+	if !reflect.DeepEqual(m.Meta, wantMeta) {
+		t.Errorf("Valid manifest's metadata did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", m.Meta, wantMeta)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+
+	want := h.GetTestFileString(golden)
+	if string(got) != want {
+		t.Errorf("Manifest metadata did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), want)
+	}
+}
+
+func TestManifestPruneOptionsRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/prune.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	wantOpts := gps.CascadingPruneOptions{
+		DefaultOptions: gps.PruneUnusedPackages | gps.PruneGoTestFiles,
+		PerProjectOptions: map[gps.ProjectRoot]gps.PruneOptionSet{
+			"github.com/sdboyer/deptest": {
+				Overridden: gps.PruneUnusedPackages | gps.PruneNonGoFiles,
+				Options:    gps.PruneNonGoFiles,
+			},
+		},
+	}
+	if !reflect.DeepEqual(m.PruneOptions, wantOpts) {
+		t.Errorf("Valid manifest's prune options did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", m.PruneOptions, wantOpts)
+	}
+	if got, want := m.PruneOptions.PruneOptionsFor("github.com/sdboyer/deptest"), gps.PruneNonGoFiles|gps.PruneGoTestFiles; got != want {
+		t.Errorf("Unexpected prune options for the overriding project: %s, want %s", got, want)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+
+	want := h.GetTestFileString(golden)
+	if string(got) != want {
+		t.Errorf("Manifest prune options did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), want)
+	}
+}
+
+func TestManifestNoVerifyRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/noverify.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	want := map[gps.ProjectRoot]bool{"github.com/sdboyer/deptest": true}
+	if got := m.NoVerifyProjects(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Valid manifest's noverify did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest noverify did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestSolveRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/solve.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+	if !m.PreferOldest {
+		t.Error("Expected the manifest to prefer the oldest versions")
+	}
+
+	p := &Project{AbsRoot: "/src/proj", Manifest: m}
+	if !p.MakeParams().Downgrade {
+		t.Error("Expected the solve parameters to downgrade")
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest solve options did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestBuildRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/build.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+	want := pkgtree.BuildMatrix{GOOS: []string{"linux", "darwin"}, Tags: []string{"!appengine"}}
+	if !reflect.DeepEqual(m.Build, want) {
+		t.Errorf("Expected the build matrix %+v, got %+v", want, m.Build)
+	}
+
+	p := &Project{AbsRoot: "/src/proj", Manifest: m}
+	if got := p.MakeParams().BuildMatrix; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the solve parameters to have the build matrix %+v, got %+v", want, got)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest build matrix did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestAnalysisRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/analysis.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+	wantExclude, wantInclude := []string{"legacy/", "services/billing"}, []string{"legacy/shared"}
+	if !reflect.DeepEqual(m.ExcludeDirs, wantExclude) {
+		t.Errorf("Expected the excluded dirs %v, got %v", wantExclude, m.ExcludeDirs)
+	}
+	if !reflect.DeepEqual(m.IncludeDirs, wantInclude) {
+		t.Errorf("Expected the included dirs %v, got %v", wantInclude, m.IncludeDirs)
+	}
+
+	p := &Project{AbsRoot: "/src/proj", Manifest: m}
+	params := p.MakeParams()
+	if !reflect.DeepEqual(params.RootExcludeDirs, wantExclude) || !reflect.DeepEqual(params.RootIncludeDirs, wantInclude) {
+		t.Errorf("Expected the solve parameters to have the dirs %v and %v, got %v and %v", wantExclude, wantInclude, params.RootExcludeDirs, params.RootIncludeDirs)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest analysis did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestTestsRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/tests.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+	if !m.ExcludeTests {
+		t.Error("Expected the manifest to exclude tests")
+	}
+	if want := map[gps.ProjectRoot]bool{"github.com/sdboyer/deptest": true}; !reflect.DeepEqual(m.TestOnly, want) {
+		t.Errorf("Valid manifest's test-only constraints did not parse as expected:\n\t(GOT): %v\n\t(WNT): %v", m.TestOnly, want)
+	}
+
+	p := &Project{AbsRoot: "/src/proj", Manifest: m}
+	if !p.MakeParams().ExcludeTests {
+		t.Error("Expected the solve parameters to exclude tests")
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest tests options did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestRootRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/root.toml"
+	mf := h.GetTestFile(golden)
+	defer mf.Close()
+	m, _, err := readManifest(mf)
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	if m.Root != "github.com/org/proj" {
+		t.Errorf("Valid manifest's root did not parse as expected, got %q", m.Root)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest root did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestUnionRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/union.toml"
+	m, _, err := readManifest(strings.NewReader(`
+[[constraint]]
+  name = "github.com/sdboyer/deptest"
+  version = ">=1.2.0, <2.0.0 || >=3.1.0"
+`))
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	c := m.Constraints["github.com/sdboyer/deptest"].Constraint
+	for v, want := range map[string]bool{"1.5.0": true, "2.5.0": false, "3.1.0": true, "1.1.0": false} {
+		if got := c.Matches(gps.NewVersion(v)); got != want {
+			t.Errorf("Union constraint %s matching %s = %v, want %v", c, v, got, want)
+		}
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest union constraint did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestExclusionRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/exclusion.toml"
+	m, _, err := readManifest(strings.NewReader(`
+[[constraint]]
+  name = "github.com/sdboyer/deptest"
+  version = "1.4.0, !=1.4.2"
+`))
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	c := m.Constraints["github.com/sdboyer/deptest"].Constraint
+	for v, want := range map[string]bool{"1.4.0": true, "1.4.2": false, "1.4.3": true, "2.0.0": false} {
+		if got := c.Matches(gps.NewVersion(v)); got != want {
+			t.Errorf("Constraint %s matching %s = %v, want %v", c, v, got, want)
+		}
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest exclusion did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestPrereleaseRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/prerelease.toml"
+	m, _, err := readManifest(h.GetTestFile(golden))
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	c := m.Constraints["github.com/sdboyer/deptest"].Constraint
+	if !gps.AllowsPrereleases(c) {
+		t.Fatalf("Expected the constraint %s to allow prereleases", c)
+	}
+	if !c.Matches(gps.NewVersion("2.1.0-rc1")) {
+		t.Errorf("Expected the constraint %s to match 2.1.0-rc1", c)
+	}
+	if gps.AllowsPrereleases(m.Constraints["github.com/sdboyer/deptestdos"].Constraint) {
+		t.Error("Expected only the constraint which opted in to allow prereleases")
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest prerelease did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestMirrorsRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/mirrors.toml"
+	m, warns, err := readManifest(h.GetTestFile(golden))
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	want := gps.SourceMirrors{
+		"github.com/":   "https://git.example.com/github/",
+		"golang.org/x/": "https://git.example.com/golang/",
+	}
+	if !reflect.DeepEqual(m.Mirrors, want) {
+		t.Errorf("Expected mirrors %v, got %v", want, m.Mirrors)
+	}
+
+	// The source of the constraint on deptest is more specific than the
+	// mirror of github.com, but deptestdos has none of its own.
+	if len(warns) != 1 || !strings.Contains(warns[0].Error(), "github.com/sdboyer/deptest is used rather than its mirror") {
+		t.Errorf("Expected a warning about the source of deptest, got %v", warns)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest sources did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
+func TestManifestGopkginConflicts(t *testing.T) {
+	m, warns, err := readManifest(strings.NewReader(`
+[[constraint]]
+  name = "gopkg.in/yaml.v2"
+  version = "^2.1.0"
+
+[[constraint]]
+  name = "gopkg.in/check.v1"
+  branch = "v1"
+
+[[constraint]]
+  name = "gopkg.in/sdboyer/gps.v3"
+  version = "^2.0.0"
+
+[[override]]
+  name = "gopkg.in/inf.v0"
+  version = "1.0.0"
+`))
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+	if len(m.Constraints) != 3 {
+		t.Fatalf("Expected 3 constraints, got %d", len(m.Constraints))
+	}
+
+	want := []string{
+		"the constraint ^2.0.0 on gopkg.in/sdboyer/gps.v3 allows none of the versions ^3.0.0 which its import path restricts it to",
+		"the override ^1.0.0 on gopkg.in/inf.v0 allows none of the versions <1.0.0 which its import path restricts it to",
+	}
+	if len(warns) != len(want) {
+		t.Fatalf("Expected %d warnings, got %v", len(want), warns)
+	}
+	for i, w := range warns {
+		if w.Error() != want[i] {
+			t.Errorf("Expected the warning %q, got %q", want[i], w)
+		}
+	}
+}
+
+func TestManifestSourceEnvRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	os.Setenv("DEP_TEST_HOST", "git.example.com")
+	defer os.Unsetenv("DEP_TEST_HOST")
+
+	golden := "manifest/env.toml"
+	m, _, err := readManifest(h.GetTestFile(golden))
+	if err != nil {
+		t.Fatalf("Should have read Manifest correctly, but got err %q", err)
+	}
+
+	// The source is kept unexpanded, for it to be locked and written so.
+	want := "https://${DEP_TEST_HOST}/sdboyer/deptest.git"
+	if got := m.Constraints["github.com/sdboyer/deptest"].Source; got != want {
+		t.Errorf("Expected the source %q, got %q", want, got)
+	}
+
+	got, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid manifest to TOML: %q", err)
+	}
+	if string(got) != h.GetTestFileString(golden) {
+		t.Errorf("Manifest source did not survive a rewrite:\n\t(GOT): %s\n\t(WNT): %s", string(got), h.GetTestFileString(golden))
+	}
+}
+
 func TestReadManifestErrors(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -108,6 +546,15 @@ func TestReadManifestErrors(t *testing.T) {
 		{"multiple constraints", "manifest/error1.toml"},
 		{"multiple dependencies", "manifest/error2.toml"},
 		{"multiple overrides", "manifest/error3.toml"},
+		{"invalid ignored path", "manifest/error4.toml"},
+		{"invalid required package", "manifest/error5.toml"},
+		{"multiple prune options", "manifest/error6.toml"},
+		{"invalid version constraint", "manifest/error7.toml"},
+		{"prerelease without version range", "manifest/error8.toml"},
+		{"multiple sources", "manifest/error9.toml"},
+		{"unset environment variable DEP_TEST_UNSET", "manifest/error10.toml"},
+		{"both required and ignored", "manifest/error11.toml"},
+		{"invalid root", "manifest/error12.toml"},
 	}
 
 	for _, tst := range tests {
@@ -122,6 +569,112 @@ func TestReadManifestErrors(t *testing.T) {
 	}
 }
 
+func TestReadManifestTypos(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	mf := h.GetTestFile("manifest/typos.toml")
+	defer mf.Close()
+	_, warns, err := readManifest(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`line 2: unknown field "ignord" in manifest, did you mean "ignored"?`,
+		`line 4: unknown field "constriant" in manifest, did you mean "constraint"?`,
+		`line 10: invalid key "revison" in "constraint", did you mean "revision"?`,
+		`line 14: invalid key "vesrion" in "override", did you mean "version"?`,
+		`line 17: invalid key "unused-package" in "prune", did you mean "unused-packages"?`,
+		`line 21: invalid key "go-test" in "prune.project", did you mean "go-tests"?`,
+	}
+	var got []string
+	for _, warn := range warns {
+		got = append(got, warn.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected warnings:\n\t(GOT) %q\n\t(WNT) %q", got, want)
+	}
+}
+
+func TestValidateManifestInconsistencies(t *testing.T) {
+	cases := []struct {
+		tomlString string
+		wantError  string
+	}{
+		{
+			tomlString: `
+			[[constraint]]
+			  name = "github.com/foo/bar"
+			  branch = "master"
+			  version = "1.0.0"
+			`,
+			wantError: "line 2: multiple constraints specified for github.com/foo/bar, can only specify one",
+		},
+		{
+			tomlString: `
+			[[constraint]]
+			  name = "github.com/foo/bar"
+			  version = "1.0.0"
+
+			[[constraint]]
+			  name = "github.com/foo/bar"
+			  branch = "master"
+			`,
+			wantError: "line 6: multiple dependencies specified for github.com/foo/bar, can only specify one (also on line 2)",
+		},
+		{
+			tomlString: `
+			[[override]]
+			  name = "github.com/foo/bar"
+
+			[[override]]
+			  name = "github.com/foo/bar"
+			`,
+			wantError: "line 5: multiple overrides specified for github.com/foo/bar, can only specify one (also on line 2)",
+		},
+		{
+			tomlString: `
+			ignored = ["github.com/foo/bar"]
+			required = ["github.com/foo/bar"]
+			`,
+			wantError: "line 3: \"github.com/foo/bar\" is both required and ignored, can only be one",
+		},
+		{
+			tomlString: `
+			ignored = ["github.com/foo/*"]
+			required = ["github.com/foo/bar/cmd/bar"]
+			`,
+			wantError: "line 3: \"github.com/foo/bar/cmd/bar\" is both required and ignored, can only be one",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := validateManifest(c.tomlString)
+		if err == nil {
+			t.Errorf("Expected an error validating %s", c.tomlString)
+		} else if err.Error() != c.wantError {
+			t.Errorf("Unexpected error:\n\t(GOT) %s\n\t(WNT) %s", err, c.wantError)
+		}
+	}
+}
+
+func TestValidateRequired(t *testing.T) {
+	for req, valid := range map[string]bool{
+		"github.com/foo/bar":              true,
+		"golang.org/x/tools/cmd/stringer": true,
+		"":                                false,
+		"github.com/foo/bar/...":          false,
+		"github.com/foo/*":                false,
+		"github.com/foo/bar/":             false,
+		"./cmd/tool":                      false,
+	} {
+		if err := validateRequired(req); (err == nil) != valid {
+			t.Errorf("validateRequired(%q) = %v, want valid: %v", req, err, valid)
+		}
+	}
+}
+
 func TestValidateManifest(t *testing.T) {
 	cases := []struct {
 		tomlString string
@@ -164,6 +717,20 @@ func TestValidateManifest(t *testing.T) {
 			wantWarn:  []error{},
 			wantError: errInvalidRequired,
 		},
+		{
+			tomlString: `
+			noverify = "github.com/foo/bar"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidNoVerify,
+		},
+		{
+			tomlString: `
+			noverify = ["github.com/foo/bar"]
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
 		{
 			tomlString: `
 			ignored = ["foo"]
@@ -222,9 +789,9 @@ func TestValidateManifest(t *testing.T) {
 			  version = ""
 			`,
 			wantWarn: []error{
-				errors.New("Unknown field in manifest: foo"),
-				errors.New("Unknown field in manifest: bar"),
-				errors.New("Unknown field in manifest: version"),
+				errors.New("line 2: unknown field \"foo\" in manifest, did you mean \"root\"?"),
+				errors.New("line 3: unknown field \"version\" in manifest"),
+				errors.New("line 5: unknown field \"bar\" in manifest"),
 			},
 			wantError: nil,
 		},
@@ -235,7 +802,7 @@ func TestValidateManifest(t *testing.T) {
 			[[constraint]]
 			  name = "github.com/foo/bar"
 			`,
-			wantWarn:  []error{errors.New("metadata should be a TOML table")},
+			wantWarn:  []error{errors.New("line 2: metadata should be a TOML table")},
 			wantError: nil,
 		},
 		{
@@ -308,10 +875,10 @@ func TestValidateManifest(t *testing.T) {
 			  nick = "foo"
 			`,
 			wantWarn: []error{
-				errors.New("Invalid key \"location\" in \"constraint\""),
-				errors.New("Invalid key \"link\" in \"constraint\""),
-				errors.New("Invalid key \"nick\" in \"override\""),
-				errors.New("metadata in \"constraint\" should be a TOML table"),
+				errors.New("line 4: invalid key \"location\" in \"constraint\""),
+				errors.New("line 5: invalid key \"link\" in \"constraint\""),
+				errors.New("line 6: metadata in \"constraint\" should be a TOML table"),
+				errors.New("line 9: invalid key \"nick\" in \"override\""),
 			},
 			wantError: nil,
 		},
@@ -332,7 +899,7 @@ func TestValidateManifest(t *testing.T) {
 			  name = "github.com/foo/bar"
 			  revision = "b86ad16"
 			`,
-			wantWarn:  []error{errors.New("revision \"b86ad16\" should not be in abbreviated form")},
+			wantWarn:  []error{errors.New("line 4: revision \"b86ad16\" should not be in abbreviated form")},
 			wantError: nil,
 		},
 		{
@@ -341,9 +908,189 @@ func TestValidateManifest(t *testing.T) {
 			  name = "foobar.com/hg"
 			  revision = "8d43f8c0b836"
 			`,
-			wantWarn:  []error{errors.New("revision \"8d43f8c0b836\" should not be in abbreviated form")},
+			wantWarn:  []error{errors.New("line 4: revision \"8d43f8c0b836\" should not be in abbreviated form")},
+			wantError: nil,
+		},
+		{
+			tomlString: `
+			[prune]
+			  go-tests = true
+			  vcs = true
+
+			  [[prune.project]]
+			    name = "github.com/foo/bar"
+			    non-go = false
+			    tests = true
+			`,
+			wantWarn: []error{
+				errors.New("line 4: invalid key \"vcs\" in \"prune\""),
+				errors.New("line 9: invalid key \"tests\" in \"prune.project\""),
+			},
+			wantError: nil,
+		},
+		{
+			tomlString: `
+			prune = "all"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidPrune,
+		},
+		{
+			tomlString: `
+			[[source]]
+			  prefix = "github.com/"
+			  url = "https://git.example.com/github/"
+			  vcs = "git"
+			`,
+			wantWarn: []error{
+				errors.New("line 5: invalid key \"vcs\" in \"source\""),
+			},
+			wantError: nil,
+		},
+		{
+			tomlString: `
+			source = "https://git.example.com/"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidSource,
+		},
+		{
+			tomlString: `
+			[solve]
+			  prefer = "newest"
+			  perfer = "oldest"
+			`,
+			wantWarn: []error{
+				errors.New("line 4: invalid key \"perfer\" in \"solve\", did you mean \"prefer\"?"),
+			},
+			wantError: nil,
+		},
+		{
+			tomlString: `
+			[solve]
+			  prefer = "latest"
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 3, msg: "\"prefer\" in \"solve\" must be \"newest\" or \"oldest\""},
+		},
+		{
+			tomlString: `
+			solve = "oldest"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidSolve,
+		},
+		{
+			tomlString: `
+			[build]
+			  goos = ["linux"]
+			  arch = ["amd64"]
+			`,
+			wantWarn: []error{
+				errors.New("line 4: invalid key \"arch\" in \"build\", did you mean \"goarch\"?"),
+			},
 			wantError: nil,
 		},
+		{
+			tomlString: `
+			[build]
+			  goos = "linux"
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 3, msg: "\"goos\" in \"build\" must be a TOML list of strings"},
+		},
+		{
+			tomlString: `
+			[build]
+			  goos = ["!windows"]
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 3, msg: "invalid \"!windows\" in \"goos\" in \"build\""},
+		},
+		{
+			tomlString: `
+			[build]
+			  tags = ["appengine,cgo"]
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 3, msg: "invalid \"appengine,cgo\" in \"tags\" in \"build\""},
+		},
+		{
+			tomlString: `
+			build = ["linux"]
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidBuild,
+		},
+		{
+			tomlString: `
+			[analysis]
+			  exclude-dir = ["legacy/"]
+			`,
+			wantWarn: []error{
+				errors.New("line 3: invalid key \"exclude-dir\" in \"analysis\", did you mean \"exclude-dirs\"?"),
+			},
+			wantError: nil,
+		},
+		{
+			tomlString: `
+			[analysis]
+			  exclude-dirs = "legacy/"
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 3, msg: "\"exclude-dirs\" in \"analysis\" must be a TOML list of strings"},
+		},
+		{
+			tomlString: `
+			[analysis]
+			  exclude-dirs = ["legacy/"]
+			  include-dirs = ["../shared"]
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 4, msg: "invalid \"../shared\" in \"include-dirs\" in \"analysis\", must be a dir within the project"},
+		},
+		{
+			tomlString: `
+			[analysis]
+			  exclude-dirs = ["./"]
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 3, msg: "invalid \"./\" in \"exclude-dirs\" in \"analysis\", must be a dir within the project"},
+		},
+		{
+			tomlString: `
+			analysis = ["legacy/"]
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidAnalysis,
+		},
+		{
+			tomlString: `
+			tests = "no"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidTests,
+		},
+		{
+			tomlString: `
+			[[override]]
+			  name = "github.com/foo/bar"
+			  test-only = true
+			`,
+			wantWarn: []error{
+				errors.New("line 4: \"test-only\" only applies to constraints"),
+			},
+			wantError: nil,
+		},
+		{
+			tomlString: `
+			[[constraint]]
+			  name = "github.com/foo/bar"
+			  test-only = "yes"
+			`,
+			wantWarn:  []error{},
+			wantError: manifestProblem{line: 4, msg: "\"test-only\" in \"constraint\" must be a boolean"},
+		},
 	}
 
 	// contains for error
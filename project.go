@@ -11,6 +11,7 @@ import (
 
 	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 )
 
 var (
@@ -75,6 +76,12 @@ func (p *Project) MakeParams() gps.SolveParameters {
 
 	if p.Manifest != nil {
 		params.Manifest = p.Manifest
+		params.SourceMirrors = p.Manifest.Mirrors
+		params.Downgrade = p.Manifest.PreferOldest
+		params.ExcludeTests = p.Manifest.ExcludeTests
+		params.BuildMatrix = p.Manifest.Build
+		params.RootExcludeDirs = p.Manifest.ExcludeDirs
+		params.RootIncludeDirs = p.Manifest.IncludeDirs
 	}
 
 	if p.Lock != nil {
@@ -84,6 +91,23 @@ func (p *Project) MakeParams() gps.SolveParameters {
 	return params
 }
 
+// ParseRootPackageTree analyzes the packages of the project, for the
+// RootPackageTree of the gps.SolveParameters made by MakeParams. Every command
+// that hashes the inputs to the solver parses the tree this way, so that they
+// all agree on whether the lock is in sync. The imports of files the manifest's
+// build matrix rules out are left out of it, as are the dirs it excludes from
+// analysis.
+func (p *Project) ParseRootPackageTree() (pkgtree.PackageTree, error) {
+	if p.Manifest == nil {
+		return pkgtree.ListPackages(p.ResolvedAbsRoot, string(p.ImportRoot))
+	}
+	ptree, err := pkgtree.ListPackagesExcluding(p.ResolvedAbsRoot, string(p.ImportRoot), p.Manifest.ExcludeDirs, p.Manifest.IncludeDirs)
+	if err != nil {
+		return ptree, err
+	}
+	return ptree.Constrain(p.Manifest.Build), nil
+}
+
 // BackupVendor looks for existing vendor directory and if it's not empty,
 // creates a backup of it to a new directory with the provided suffix.
 func BackupVendor(vpath, suffix string) (string, error) {
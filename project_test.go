@@ -80,6 +80,64 @@ func TestProjectMakeParams(t *testing.T) {
 	}
 }
 
+func TestProjectParseRootPackageTree(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src/example.com/root")
+	h.TempFile("src/example.com/root/root.go", "package root\n\nimport _ \"github.com/pkg/errors\"\n")
+	h.TempFile("src/example.com/root/sub/sub.go", "package sub\n")
+
+	p := Project{ImportRoot: "example.com/root"}
+	if err := p.SetRoot(h.Path("src/example.com/root")); err != nil {
+		t.Fatal(err)
+	}
+
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the root package tree: %s", err)
+	}
+	if ptree.ImportRoot != "example.com/root" {
+		t.Errorf("Expected the import root example.com/root, got %s", ptree.ImportRoot)
+	}
+	for _, ip := range []string{"example.com/root", "example.com/root/sub"} {
+		if _, has := ptree.Packages[ip]; !has {
+			t.Errorf("Expected the package %s in the tree", ip)
+		}
+	}
+}
+
+func TestProjectParseRootPackageTreeExcluding(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src/example.com/root")
+	h.TempFile("src/example.com/root/root.go", "package root\n")
+	h.TempFile("src/example.com/root/legacy/legacy.go", "package legacy\n\nimport _ \"github.com/legacy/dep\"\n")
+	h.TempFile("src/example.com/root/legacy/shared/shared.go", "package shared\n")
+
+	p := Project{
+		ImportRoot: "example.com/root",
+		Manifest:   &Manifest{ExcludeDirs: []string{"legacy/"}, IncludeDirs: []string{"legacy/shared"}},
+	}
+	if err := p.SetRoot(h.Path("src/example.com/root")); err != nil {
+		t.Fatal(err)
+	}
+
+	ptree, err := p.ParseRootPackageTree()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the root package tree: %s", err)
+	}
+	if _, has := ptree.Packages["example.com/root/legacy"]; has {
+		t.Error("Expected the excluded package example.com/root/legacy not to be in the tree")
+	}
+	for _, ip := range []string{"example.com/root", "example.com/root/legacy/shared"} {
+		if _, has := ptree.Packages[ip]; !has {
+			t.Errorf("Expected the package %s in the tree", ip)
+		}
+	}
+}
+
 func TestBackupVendor(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
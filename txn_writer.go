@@ -11,6 +11,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
@@ -57,10 +58,41 @@ var lockFileComment = []byte(`# This file is autogenerated, do not edit; changes
 // It is not impervious to errors (writing to disk is hard), but it should
 // guard against non-arcane failure conditions.
 type SafeWriter struct {
-	Manifest    *Manifest
+	Manifest *Manifest
+
+	// ExportWorkers is the number of projects exported to vendor/ at once; if
+	// it's less than one, it's the number of CPUs.
+	ExportWorkers int
+
+	// ExportProgress, if set, is called to export each of the n projects
+	// which are written to vendor/, e.g. so that the export can be timed and
+	// reported. It must call export and return its error. It's called
+	// concurrently, by up to ExportWorkers goroutines.
+	ExportProgress func(n int, pr gps.ProjectRoot, export func() error) error
+
+	// KeepModified leaves the projects which were modified in vendor/ since
+	// dep wrote them as they are, rather than exporting them again.
+	// Otherwise, unless OverwriteModified is set or vendor is VendorForce,
+	// Write returns a *ModifiedVendorError without writing anything.
+	KeepModified      bool
+	OverwriteModified bool
+
+	// NoVerify holds the roots of the projects which aren't verified in
+	// vendor/. Those of them which were modified since dep wrote them are left
+	// as they are, as with KeepModified, and passed to Skipped, if it's set.
+	NoVerify map[gps.ProjectRoot]bool
+	Skipped  func(pr gps.ProjectRoot)
+
+	// ImportComments, if set, is passed the packages exported to vendor/ whose
+	// import comments disagree with the paths they're vendored under, should
+	// there be any. If it returns an error, Write returns it without writing
+	// anything.
+	ImportComments func([]ImportCommentMismatch) error
+
 	lock        *Lock
 	lockDiff    *gps.LockDiff
 	writeVendor bool
+	forceVendor bool
 	writeLock   bool
 }
 
@@ -73,25 +105,38 @@ type SafeWriter struct {
 // - If newLock is provided, it will be written to the standard lock file
 // name beneath root.
 //
-// - If vendor is VendorAlways, or is VendorOnChanged and the locks are different,
-// the vendor directory will be written beneath root based on newLock.
+// - If vendor is VendorAlways or VendorForce, or is VendorOnChanged and the
+// locks are different, the vendor directory will be written beneath root based
+// on newLock, with each project pruned as newLock records. Unless vendor is
+// VendorForce, projects whose recorded digests show them to be unchanged are
+// not exported again. See KeepModified for projects which were modified in
+// vendor/.
 //
 // - If oldLock is provided without newLock, error.
 //
-// - If vendor is VendorAlways without a newLock, error.
+// - If vendor is VendorAlways or VendorForce without a newLock, error.
 func NewSafeWriter(manifest *Manifest, oldLock, newLock *Lock, vendor VendorBehavior) (*SafeWriter, error) {
 	sw := &SafeWriter{
 		Manifest: manifest,
 		lock:     newLock,
 	}
 
+	// Projects pruned differently have to be written out again, even if they
+	// are locked to the same revisions.
+	var pruneChanged bool
 	if oldLock != nil {
 		if newLock == nil {
 			return nil, errors.New("must provide newLock when oldLock is specified")
 		}
 
+		// Digests of projects which are unchanged still hold for what's in
+		// vendor/, whether or not it's written again.
+		newLock.carryDigests(oldLock)
+		newLock.carryOrigins(oldLock)
+
 		sw.lockDiff = gps.DiffLocks(oldLock, newLock)
-		if sw.lockDiff != nil {
+		pruneChanged = !samePruneOptions(oldLock, newLock)
+		if sw.lockDiff != nil || pruneChanged {
 			sw.writeLock = true
 		}
 	} else if newLock != nil {
@@ -101,8 +146,11 @@ func NewSafeWriter(manifest *Manifest, oldLock, newLock *Lock, vendor VendorBeha
 	switch vendor {
 	case VendorAlways:
 		sw.writeVendor = true
+	case VendorForce:
+		sw.writeVendor = true
+		sw.forceVendor = true
 	case VendorOnChanged:
-		sw.writeVendor = sw.lockDiff != nil || (newLock != nil && oldLock == nil)
+		sw.writeVendor = sw.lockDiff != nil || pruneChanged || (newLock != nil && oldLock == nil)
 	}
 
 	if sw.writeVendor && newLock == nil {
@@ -132,12 +180,15 @@ func (diff rawStringDiff) MarshalTOML() ([]byte, error) {
 }
 
 type rawLockedProjectDiff struct {
-	Name     gps.ProjectRoot `toml:"name"`
-	Source   *rawStringDiff  `toml:"source,omitempty"`
-	Version  *rawStringDiff  `toml:"version,omitempty"`
-	Branch   *rawStringDiff  `toml:"branch,omitempty"`
-	Revision *rawStringDiff  `toml:"revision,omitempty"`
-	Packages []rawStringDiff `toml:"packages,omitempty"`
+	Name          gps.ProjectRoot `toml:"name"`
+	Source        *rawStringDiff  `toml:"source,omitempty"`
+	Version       *rawStringDiff  `toml:"version,omitempty"`
+	Branch        *rawStringDiff  `toml:"branch,omitempty"`
+	Revision      *rawStringDiff  `toml:"revision,omitempty"`
+	Packages      []rawStringDiff `toml:"packages,omitempty"`
+	VCS           *rawStringDiff  `toml:"vcs,omitempty"`
+	URL           *rawStringDiff  `toml:"url,omitempty"`
+	DefaultBranch *rawStringDiff  `toml:"default-branch,omitempty"`
 }
 
 func toRawLockedProjectDiff(diff gps.LockedProjectDiff) rawLockedProjectDiff {
@@ -155,6 +206,15 @@ func toRawLockedProjectDiff(diff gps.LockedProjectDiff) rawLockedProjectDiff {
 	if diff.Revision != nil {
 		raw.Revision = &rawStringDiff{diff.Revision}
 	}
+	if diff.VCS != nil {
+		raw.VCS = &rawStringDiff{diff.VCS}
+	}
+	if diff.URL != nil {
+		raw.URL = &rawStringDiff{diff.URL}
+	}
+	if diff.DefaultBranch != nil {
+		raw.DefaultBranch = &rawStringDiff{diff.DefaultBranch}
+	}
 	raw.Packages = make([]rawStringDiff, len(diff.Packages))
 	for i := 0; i < len(diff.Packages); i++ {
 		raw.Packages[i] = rawStringDiff{&diff.Packages[i]}
@@ -233,6 +293,9 @@ const (
 	VendorAlways
 	// VendorNever indicates the vendor directory should never be written.
 	VendorNever
+	// VendorForce forces the vendor directory to always be written, exporting
+	// every project again even if its recorded digest shows it to be unchanged.
+	VendorForce
 )
 
 func (sw SafeWriter) validate(root string, sm gps.SourceManager) error {
@@ -267,14 +330,50 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 		return err
 	}
 
-	if !sw.HasManifest() && !sw.writeLock && !sw.writeVendor {
+	mpath := filepath.Join(root, ManifestName)
+	lpath := filepath.Join(root, LockName)
+	vpath := filepath.Join(root, "vendor")
+
+	// Projects which are still in vendor/ at their locked revision, just as
+	// they were written, are carried over rather than exported again, as are
+	// those modified since with KeepModified. If that's all of them, vendor/
+	// is left alone.
+	writeVendor, writeLock := sw.writeVendor, sw.writeLock
+	carried := make(VendorDigests)
+	if is, _ := fs.IsDir(vpath); is && writeVendor {
+		var modified VendorDigests
+		carried, modified = sw.carriedVendorProjects(vpath)
+		if len(modified) > 0 && !sw.forceVendor && !sw.OverwriteModified {
+			return newModifiedVendorError(modified)
+		}
+
+		allCarried := true
+		for _, lp := range sw.lock.Projects() {
+			if _, has := carried[lp.Ident().ProjectRoot]; !has {
+				allCarried = false
+				break
+			}
+		}
+		if allCarried && !hasExtraneousVendor(vpath, sw.lock) {
+			writeVendor = false
+			if sw.recordDigests(carried) {
+				writeLock = true
+			}
+		}
+	}
+
+	if !sw.HasManifest() && !writeLock && !writeVendor {
 		// nothing to do
 		return nil
 	}
 
-	mpath := filepath.Join(root, ManifestName)
-	lpath := filepath.Join(root, LockName)
-	vpath := filepath.Join(root, "vendor")
+	// Projects which would collide in vendor/ are caught before anything is
+	// written.
+	if writeVendor {
+		if err := checkCaseCollisions(sw.lock); err != nil {
+			return err
+		}
+	}
 
 	td, err := ioutil.TempDir(os.TempDir(), "dep")
 	if err != nil {
@@ -283,47 +382,89 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 	defer os.RemoveAll(td)
 
 	if sw.HasManifest() {
-		// Always write the example text to the bottom of the TOML file.
-		tb, err := sw.Manifest.MarshalTOML()
-		if err != nil {
-			return errors.Wrap(err, "failed to marshal manifest to TOML")
-		}
-
-		var initOutput []byte
+		var tb []byte
+		if orig, err := ioutil.ReadFile(mpath); err == nil {
+			// An existing manifest is edited rather than written anew, so
+			// that its comments and the layout of what's unchanged are kept.
+			tb, err = updateManifestTOML(orig, sw.Manifest)
+			if err != nil {
+				return errors.Wrap(err, "failed to edit manifest")
+			}
+		} else {
+			// Always write the example text to the bottom of the TOML file.
+			tb, err = sw.Manifest.MarshalTOML()
+			if err != nil {
+				return errors.Wrap(err, "failed to marshal manifest to TOML")
+			}
 
-		// If examples are enabled, use the example text
-		if examples {
-			initOutput = exampleTOML
+			// If examples are enabled, use the example text
+			if examples {
+				tb = append(exampleTOML, tb...)
+			}
 		}
 
-		if err = ioutil.WriteFile(filepath.Join(td, ManifestName), append(initOutput, tb...), 0666); err != nil {
+		if err = ioutil.WriteFile(filepath.Join(td, ManifestName), tb, 0666); err != nil {
 			return errors.Wrap(err, "failed to write manifest file to temp dir")
 		}
 	}
 
-	if sw.writeLock {
-		l, err := sw.lock.MarshalTOML()
+	var vstage string
+	if writeVendor {
+		// Staging and backup dirs are only left behind by runs which were
+		// killed, so they're never worth keeping.
+		removeStaleVendorDirs(root)
+
+		// The new vendor/ is staged next to the old one, rather than in the
+		// temp dir, so that it can be moved into place by renaming it instead
+		// of copying it across filesystems. If writing it out is interrupted,
+		// e.g. because the SourceManager is released on a signal, the staging
+		// dir is removed.
+		vstage, err = ioutil.TempDir(root, vendorStagingPrefix)
 		if err != nil {
-			return errors.Wrap(err, "failed to marshal lock to TOML")
+			return errors.Wrap(err, "error while creating a staging dir for vendor")
 		}
+		defer os.RemoveAll(vstage)
 
-		if err = ioutil.WriteFile(filepath.Join(td, LockName), append(lockFileComment, l...), 0666); err != nil {
-			return errors.Wrap(err, "failed to write lock file to temp dir")
+		vd, err := writeVendorTree(vstage, vpath, sw.lock, sm, carried, sw.ExportWorkers, sw.ExportProgress)
+		if err != nil {
+			return errors.Wrap(err, "error while writing out vendor tree")
+		}
+
+		// The import comments are checked in the staged vendor/, before
+		// it's moved into place.
+		if sw.ImportComments != nil {
+			mismatches, err := importCommentMismatches(vstage, sw.lock, carried)
+			if err != nil {
+				return err
+			}
+			if len(mismatches) > 0 {
+				if err := sw.ImportComments(mismatches); err != nil {
+					return err
+				}
+			}
+		}
+
+		if sw.recordDigests(vd) {
+			writeLock = true
+		}
+
+		// Ensure vendor/.git is preserved if present
+		if hasDotGit(vpath) {
+			err = fs.RenameWithFallback(filepath.Join(vpath, ".git"), filepath.Join(vstage, ".git"))
+			if _, ok := err.(*os.LinkError); ok {
+				return errors.Wrap(err, "failed to preserve vendor/.git")
+			}
 		}
 	}
 
-	if sw.writeVendor {
-		err = gps.WriteDepTree(filepath.Join(td, "vendor"), sw.lock, sm, true)
+	if writeLock {
+		l, err := sw.lock.MarshalTOML()
 		if err != nil {
-			return errors.Wrap(err, "error while writing out vendor tree")
+			return errors.Wrap(err, "failed to marshal lock to TOML")
 		}
-	}
 
-	// Ensure vendor/.git is preserved if present
-	if hasDotGit(vpath) {
-		err = fs.RenameWithFallback(filepath.Join(vpath, ".git"), filepath.Join(td, "vendor/.git"))
-		if _, ok := err.(*os.LinkError); ok {
-			return errors.Wrap(err, "failed to preserve vendor/.git")
+		if err = ioutil.WriteFile(filepath.Join(td, LockName), append(lockFileComment, l...), 0666); err != nil {
+			return errors.Wrap(err, "failed to write lock file to temp dir")
 		}
 	}
 
@@ -354,7 +495,7 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 		}
 	}
 
-	if sw.writeLock {
+	if writeLock {
 		if _, err := os.Stat(lpath); err == nil {
 			// Move out the old one.
 			tmploc := filepath.Join(td, LockName+".orig")
@@ -373,27 +514,11 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 		}
 	}
 
-	if sw.writeVendor {
-		if _, err := os.Stat(vpath); err == nil {
-			// Move out the old vendor dir. just do it into an adjacent dir, to
-			// try to mitigate the possibility of a pointless cross-filesystem
-			// move with a temp directory.
-			vendorbak = vpath + ".orig"
-			if _, err := os.Stat(vendorbak); err == nil {
-				// If the adjacent dir already exists, bite the bullet and move
-				// to a proper tempdir.
-				vendorbak = filepath.Join(td, "vendor.orig")
-			}
-
-			failerr = fs.RenameWithFallback(vpath, vendorbak)
-			if failerr != nil {
-				goto fail
-			}
+	if writeVendor {
+		vendorbak, failerr = swapVendor(vpath, vstage)
+		if vendorbak != "" {
 			restore = append(restore, pathpair{from: vendorbak, to: vpath})
 		}
-
-		// Move in the new one.
-		failerr = fs.RenameWithFallback(filepath.Join(td, "vendor"), vpath)
 		if failerr != nil {
 			goto fail
 		}
@@ -401,9 +526,11 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 
 	// Renames all went smoothly. The deferred os.RemoveAll will get the temp
 	// dir, but if we wrote vendor, we have to clean that up directly
-	if sw.writeVendor {
+	if writeVendor {
 		// Nothing we can really do about an error at this point, so ignore it
-		os.RemoveAll(vendorbak)
+		if vendorbak != "" {
+			os.RemoveAll(vendorbak)
+		}
 	}
 
 	return nil
@@ -417,6 +544,114 @@ fail:
 	return failerr
 }
 
+const (
+	// vendorStagingPrefix prefixes the dirs beside vendor/ in which its
+	// replacement is written.
+	vendorStagingPrefix = ".vendor-new-"
+	// vendorBackupPrefix prefixes the dirs beside vendor/ to which it is moved
+	// aside while its replacement is moved in.
+	vendorBackupPrefix = ".vendor-old-"
+)
+
+// swapVendor moves the staged vendor dir into place at vpath. Renaming a dir
+// over one which isn't empty fails, so if that's what's in the way, it's
+// renamed aside first; its new path is returned so the caller can move it
+// back on failure, or remove it once the write is complete.
+func swapVendor(vpath, staged string) (string, error) {
+	err := os.Rename(staged, vpath)
+	if err == nil {
+		return "", nil
+	}
+	if _, serr := os.Stat(vpath); serr != nil {
+		// Nothing was in the way, so the rename failed for another reason,
+		// e.g. because vendor/ is on another filesystem.
+		return "", fs.RenameWithFallback(staged, vpath)
+	}
+
+	backup := filepath.Join(filepath.Dir(vpath), vendorBackupPrefix+strings.TrimPrefix(filepath.Base(staged), vendorStagingPrefix))
+	if err := fs.RenameWithFallback(vpath, backup); err != nil {
+		return "", err
+	}
+	return backup, fs.RenameWithFallback(staged, vpath)
+}
+
+// removeStaleVendorDirs removes the vendor staging and backup dirs in root
+// which were left behind by runs that were killed while writing vendor/.
+func removeStaleVendorDirs(root string) {
+	for _, prefix := range []string{vendorStagingPrefix, vendorBackupPrefix} {
+		stale, _ := filepath.Glob(filepath.Join(root, prefix+"*"))
+		for _, dir := range stale {
+			// Nothing useful can be done about an error here; the dir will be
+			// tried again on the next run.
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// carriedVendorProjects returns the digests of the projects in the vendor dir
+// vpath which are carried over rather than exported again: those which are
+// unchanged, unless vendor/ is forced, and those modified since they were
+// written which are kept with KeepModified or NoVerify. The projects which were
+// modified and would be overwritten are returned as well.
+func (sw *SafeWriter) carriedVendorProjects(vpath string) (carried, modified VendorDigests) {
+	carried = make(VendorDigests)
+	if !sw.forceVendor {
+		carried = unchangedVendorProjects(vpath, sw.lock)
+	}
+
+	modified = modifiedVendorProjects(vpath)
+	for pr, d := range modified {
+		if sw.NoVerify[pr] || sw.KeepModified {
+			carried[pr] = d
+			delete(modified, pr)
+			if sw.NoVerify[pr] && sw.Skipped != nil {
+				sw.Skipped(pr)
+			}
+		}
+	}
+	return carried, modified
+}
+
+// VendorProjectsToWrite returns the projects which Write would export to the
+// vendor dir beneath root, leaving out those it carries over as they are.
+func (sw *SafeWriter) VendorProjectsToWrite(root string) []gps.ProjectRoot {
+	if !sw.writeVendor {
+		return nil
+	}
+
+	vpath := filepath.Join(root, "vendor")
+	carried := make(VendorDigests)
+	if is, _ := fs.IsDir(vpath); is {
+		carried, _ = sw.carriedVendorProjects(vpath)
+	}
+
+	var roots []gps.ProjectRoot
+	for _, lp := range sw.lock.Projects() {
+		if _, has := carried[lp.Ident().ProjectRoot]; !has {
+			roots = append(roots, lp.Ident().ProjectRoot)
+		}
+	}
+	return roots
+}
+
+// recordDigests records in the lock the digests of the projects as vd says
+// they are in vendor/, so that it can be checked against the lock, and reports
+// whether that changed the lock.
+func (sw *SafeWriter) recordDigests(vd VendorDigests) bool {
+	changed := len(vd) != len(sw.lock.Digests)
+	digests := make(map[gps.ProjectRoot]string, len(vd))
+	for pr, d := range vd {
+		digests[pr] = d.Digest
+		if sw.lock.Digests[pr] != d.Digest {
+			changed = true
+		}
+	}
+	if changed {
+		sw.lock.Digests = digests
+	}
+	return changed
+}
+
 // PrintPreparedActions logs the actions a call to Write would perform.
 func (sw *SafeWriter) PrintPreparedActions(output *log.Logger) error {
 	if sw.HasManifest() {
@@ -8,9 +8,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/test"
 	"github.com/pkg/errors"
 )
@@ -526,6 +529,177 @@ func TestSafeWriter_DiffLocks(t *testing.T) {
 	}
 }
 
+func TestSafeWriter_PruneOptionsChanged(t *testing.T) {
+	oldLock := &Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.Revision("rev1"), []string{"."}),
+		},
+	}
+	newLock := new(Lock)
+	*newLock = *oldLock
+	newLock.SetPruneOptions(gps.CascadingPruneOptions{DefaultOptions: gps.PruneGoTestFiles})
+
+	sw, err := NewSafeWriter(nil, oldLock, newLock, VendorOnChanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sw.lockDiff != nil {
+		t.Fatal("Did not expect locks differing only in prune options to be diffed")
+	}
+	if !sw.writeLock {
+		t.Fatal("Expected that the writer should plan to write the lock")
+	}
+	if !sw.writeVendor {
+		t.Fatal("Expected that the writer should plan to write the vendor directory")
+	}
+}
+
+func TestSafeWriter_ModifiedVendor(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("cache")
+	h.TempFile("project/vendor/github.com/sdboyer/deptest/deptest.go", "package deptest")
+	root := h.Path("project")
+	vpath := filepath.Join(root, "vendor")
+	dir := filepath.Join(vpath, "github.com", "sdboyer", "deptest")
+
+	sm, err := gps.NewSourceManager(h.Path("cache"))
+	h.Must(err)
+	defer sm.Release()
+
+	rev := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	l := &Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v0.8.0").Pair(rev), []string{"."}),
+	}}
+	digest, err := fs.DigestTree(dir)
+	h.Must(err)
+	recorded := VendorDigests{"github.com/sdboyer/deptest": {Revision: rev, Digest: digest}}
+	h.Must(recorded.write(vpath))
+
+	// Patch the vendored project by hand.
+	patched := "package deptest // patched"
+	h.TempFile("project/vendor/github.com/sdboyer/deptest/deptest.go", patched)
+
+	sw, _ := NewSafeWriter(nil, nil, l, VendorAlways)
+	err = sw.Write(root, sm, false)
+	merr, ok := err.(*ModifiedVendorError)
+	if !ok {
+		t.Fatalf("expected a *ModifiedVendorError, got %v", err)
+	}
+	if len(merr.Projects) != 1 || merr.Projects[0] != "github.com/sdboyer/deptest" {
+		t.Fatalf("expected github.com/sdboyer/deptest to be modified, got %v", merr.Projects)
+	}
+	if _, err := os.Stat(filepath.Join(root, LockName)); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be written when vendor/ is modified")
+	}
+
+	// With KeepModified, the patch is left alone, and is still recorded as a
+	// modification.
+	sw.KeepModified = true
+	h.Must(errors.Wrap(sw.Write(root, sm, false), "SafeWriter.Write failed"))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "deptest.go"))
+	h.Must(err)
+	if strings.TrimSpace(string(b)) != patched {
+		t.Fatalf("expected the patched file to be kept, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(root, LockName)); err != nil {
+		t.Fatalf("expected the lock to be written: %s", err)
+	}
+	got, err := ReadVendorDigests(vpath)
+	h.Must(err)
+	if got["github.com/sdboyer/deptest"] != recorded["github.com/sdboyer/deptest"] {
+		t.Fatalf("expected the digest dep wrote to still be recorded, got %v", got)
+	}
+}
+
+// fixtureSourceManager exports every project from the same fixture dir.
+type fixtureSourceManager struct {
+	gps.SourceManager
+	dir string
+}
+
+func (sm fixtureSourceManager) ExportProject(id gps.ProjectIdentifier, v gps.Version, to string) error {
+	return fs.CopyDir(sm.dir, to)
+}
+
+func TestSafeWriter_CaseCollisions(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("project")
+	root := h.Path("project")
+
+	l := &Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/Sirupsen/logrus"}, gps.Revision("rev1"), []string{"."}),
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sirupsen/logrus"}, gps.Revision("rev2"), []string{"."}),
+	}}
+	sw, _ := NewSafeWriter(nil, nil, l, VendorAlways)
+	err := sw.Write(root, fixtureSourceManager{}, false)
+	if err == nil || !strings.Contains(err.Error(), "github.com/Sirupsen/logrus and github.com/sirupsen/logrus differ only in case") {
+		t.Fatalf("expected the projects to collide, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be written when projects collide")
+	}
+
+	// Packages of a single project can collide too.
+	l = &Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar"}, gps.Revision("rev1"), []string{".", "Baz", "qux"}),
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/bar/baz"}, gps.Revision("rev2"), []string{"."}),
+	}}
+	err = checkCaseCollisions(l)
+	if err == nil || !strings.Contains(err.Error(), "github.com/foo/bar/Baz and github.com/foo/bar/baz differ only in case") {
+		t.Fatalf("expected the packages to collide, got %v", err)
+	}
+	l.P = l.P[:1]
+	if err = checkCaseCollisions(l); err != nil {
+		t.Fatalf("expected no collisions, got %s", err)
+	}
+}
+
+func TestSafeWriter_ImportComments(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("project")
+	root := h.Path("project")
+	dir, err := filepath.Abs(filepath.Join("testdata", "txn_writer", "importcomment"))
+	h.Must(err)
+	sm := fixtureSourceManager{dir: dir}
+
+	// The fixture's import comments name github.com/sirupsen/logrus.
+	l := &Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/Sirupsen/logrus"}, gps.Revision("rev1"), []string{".", "hooks", "writer"}),
+	}}
+	sw, _ := NewSafeWriter(nil, nil, l, VendorAlways)
+	var got []ImportCommentMismatch
+	sw.ImportComments = func(mismatches []ImportCommentMismatch) error {
+		got = mismatches
+		return errors.New("import comments disagree")
+	}
+	if err = sw.Write(root, sm, false); err == nil || err.Error() != "import comments disagree" {
+		t.Fatalf("expected the error ImportComments returned, got %v", err)
+	}
+	want := []ImportCommentMismatch{
+		{ImportPath: "github.com/Sirupsen/logrus", Comment: "github.com/sirupsen/logrus"},
+		{ImportPath: "github.com/Sirupsen/logrus/hooks", Comment: "github.com/sirupsen/logrus/hooks"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the mismatches %v, got %v", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be written when ImportComments fails")
+	}
+
+	// Vendored under the paths its comments name, nothing disagrees.
+	l.P[0] = gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sirupsen/logrus"}, gps.Revision("rev1"), []string{".", "hooks", "writer"})
+	sw, _ = NewSafeWriter(nil, nil, l, VendorAlways)
+	sw.ImportComments = func(mismatches []ImportCommentMismatch) error {
+		t.Errorf("expected no mismatches, got %v", mismatches)
+		return nil
+	}
+	h.Must(errors.Wrap(sw.Write(root, sm, false), "SafeWriter.Write failed"))
+	h.MustExist(filepath.Join(root, "vendor", "github.com", "sirupsen", "logrus", "hooks", "hooks.go"))
+}
+
 func TestHasDotGit(t *testing.T) {
 	// Create a tempdir with .git file
 	td, err := ioutil.TempDir(os.TempDir(), "dotGitFile")
@@ -591,3 +765,48 @@ func TestSafeWriter_VendorDotGitPreservedWithForceVendor(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSwapVendor(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join(vendorStagingPrefix+"1", "new"), "")
+	h.TempFile(filepath.Join("vendor", "old"), "")
+	root := h.Path(".")
+
+	backup, err := swapVendor(filepath.Join(root, "vendor"), filepath.Join(root, vendorStagingPrefix+"1"))
+	h.Must(errors.Wrap(err, "swapVendor failed"))
+
+	if want := filepath.Join(root, vendorBackupPrefix+"1"); backup != want {
+		t.Fatalf("Expected the old vendor dir to be moved aside to %s, got %s", want, backup)
+	}
+	h.MustExist(filepath.Join(root, "vendor", "new"))
+	h.MustNotExist(filepath.Join(root, "vendor", "old"))
+	h.MustNotExist(filepath.Join(root, vendorStagingPrefix+"1"))
+	h.MustExist(filepath.Join(root, vendorBackupPrefix+"1", "old"))
+
+	// Without a vendor dir in the way, the staged one is just renamed.
+	h.TempFile(filepath.Join(vendorStagingPrefix+"2", "new"), "")
+	backup, err = swapVendor(filepath.Join(root, "othervendor"), filepath.Join(root, vendorStagingPrefix+"2"))
+	h.Must(errors.Wrap(err, "swapVendor failed"))
+	if backup != "" {
+		t.Fatalf("Expected nothing to be moved aside, got %s", backup)
+	}
+	h.MustExist(filepath.Join(root, "othervendor", "new"))
+}
+
+func TestRemoveStaleVendorDirs(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join(vendorStagingPrefix+"123", "github.com", "sdboyer", "deptest", "deptest.go"), "")
+	h.TempDir(vendorBackupPrefix + "456")
+	h.TempFile(filepath.Join("vendor", "keep"), "")
+	root := h.Path(".")
+
+	removeStaleVendorDirs(root)
+
+	h.MustNotExist(filepath.Join(root, vendorStagingPrefix+"123"))
+	h.MustNotExist(filepath.Join(root, vendorBackupPrefix+"456"))
+	h.MustExist(filepath.Join(root, "vendor", "keep"))
+}
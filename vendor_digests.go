@@ -0,0 +1,416 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// VendorDigestsName is the name of the file in vendor/ which records the
+// revision and content digest of each project dep wrote there.
+const VendorDigestsName = ".dep-manifest"
+
+var vendorDigestsComment = []byte(`# This file is autogenerated by dep, do not edit. It records the revision and
+# content digest of each project written to vendor/.
+`)
+
+// VendorDigest is what dep recorded of a project it wrote to vendor/.
+type VendorDigest struct {
+	Revision  gps.Revision
+	PruneOpts gps.PruneOptions
+	Digest    string
+}
+
+// VendorDigests records, by project root, what dep wrote to vendor/.
+type VendorDigests map[gps.ProjectRoot]VendorDigest
+
+// ReadVendorDigests reads the digests recorded in the vendor dir vpath. A
+// vendor dir without any, e.g. because it was written by an older dep, has
+// none.
+func ReadVendorDigests(vpath string) (VendorDigests, error) {
+	vd := make(VendorDigests)
+	b, err := ioutil.ReadFile(filepath.Join(vpath, VendorDigestsName))
+	if os.IsNotExist(err) {
+		return vd, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s", VendorDigestsName)
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Projects which were pruned have their prune options recorded
+		// between the revision and the digest.
+		fields := strings.Fields(line)
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, errors.Errorf("invalid line in %s: %q", VendorDigestsName, line)
+		}
+		d := VendorDigest{Revision: gps.Revision(fields[1]), Digest: fields[len(fields)-1]}
+		if len(fields) == 4 {
+			if d.PruneOpts, err = gps.ParsePruneOptions(fields[2]); err != nil || d.PruneOpts == 0 {
+				return nil, errors.Errorf("invalid line in %s: %q", VendorDigestsName, line)
+			}
+		}
+		vd[gps.ProjectRoot(fields[0])] = d
+	}
+	return vd, nil
+}
+
+// write writes the digests to the vendor dir vpath.
+func (vd VendorDigests) write(vpath string) error {
+	roots := make([]string, 0, len(vd))
+	for pr := range vd {
+		roots = append(roots, string(pr))
+	}
+	sort.Strings(roots)
+
+	var buf bytes.Buffer
+	buf.Write(vendorDigestsComment)
+	for _, pr := range roots {
+		d := vd[gps.ProjectRoot(pr)]
+		if d.PruneOpts != 0 {
+			fmt.Fprintf(&buf, "%s %s %s %s\n", pr, d.Revision, d.PruneOpts, d.Digest)
+		} else {
+			fmt.Fprintf(&buf, "%s %s %s\n", pr, d.Revision, d.Digest)
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(vpath, VendorDigestsName), buf.Bytes(), 0666)
+}
+
+// lockedRevision returns the revision a locked project is at.
+func lockedRevision(lp gps.LockedProject) gps.Revision {
+	rev, _, _ := gps.VersionComponentStrings(lp.Version())
+	return gps.Revision(rev)
+}
+
+// unchangedVendorProjects returns the digests of the projects of l whose dirs
+// in the vendor dir vpath still hold what dep last wrote there, at the locked
+// revision and pruned as l records.
+func unchangedVendorProjects(vpath string, l *Lock) VendorDigests {
+	unchanged := make(VendorDigests)
+	recorded, err := ReadVendorDigests(vpath)
+	if err != nil {
+		// Digests which can't be read just mean everything is written again.
+		return unchanged
+	}
+
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		d, has := recorded[pr]
+		if !has || d.Revision != lockedRevision(lp) || d.PruneOpts != l.PruneOptionsFor(pr) {
+			continue
+		}
+		digest, err := fs.DigestTree(filepath.Join(vpath, filepath.FromSlash(string(pr))))
+		if err != nil || digest != d.Digest {
+			continue
+		}
+		unchanged[pr] = d
+	}
+	return unchanged
+}
+
+// modifiedVendorProjects returns the recorded digests of the projects whose
+// dirs in the vendor dir vpath no longer hold what dep wrote there, e.g.
+// because a file was patched by hand. Projects whose dirs are gone aren't
+// counted, as there's nothing left of them to lose.
+func modifiedVendorProjects(vpath string) VendorDigests {
+	modified := make(VendorDigests)
+	recorded, err := ReadVendorDigests(vpath)
+	if err != nil {
+		return modified
+	}
+
+	for pr, d := range recorded {
+		dir := filepath.Join(vpath, filepath.FromSlash(string(pr)))
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			continue
+		}
+		// A dir which can't be digested is taken to be modified, rather than
+		// risk overwriting changes.
+		if digest, err := fs.DigestTree(dir); err != nil || digest != d.Digest {
+			modified[pr] = d
+		}
+	}
+	return modified
+}
+
+// ModifiedVendorError is returned by SafeWriter.Write instead of overwriting
+// projects which were modified in vendor/ since dep wrote them.
+type ModifiedVendorError struct {
+	// The projects which were modified, sorted.
+	Projects []gps.ProjectRoot
+}
+
+func newModifiedVendorError(modified VendorDigests) *ModifiedVendorError {
+	roots := make([]string, 0, len(modified))
+	for pr := range modified {
+		roots = append(roots, string(pr))
+	}
+	sort.Strings(roots)
+
+	e := &ModifiedVendorError{Projects: make([]gps.ProjectRoot, len(roots))}
+	for i, pr := range roots {
+		e.Projects[i] = gps.ProjectRoot(pr)
+	}
+	return e
+}
+
+func (e *ModifiedVendorError) Error() string {
+	roots := make([]string, len(e.Projects))
+	for i, pr := range e.Projects {
+		roots[i] = string(pr)
+	}
+	return fmt.Sprintf("vendor/ has been modified since dep wrote it, in %s", strings.Join(roots, ", "))
+}
+
+// vendorPaths returns the paths under vendor/ of the packages of lp: its root,
+// and each of its packages beneath it.
+func vendorPaths(lp gps.LockedProject) []string {
+	pr := string(lp.Ident().ProjectRoot)
+	paths := []string{pr}
+	for _, pkg := range lp.Packages() {
+		if pkg != "." {
+			paths = append(paths, pr+"/"+pkg)
+		}
+	}
+	return paths
+}
+
+// checkCaseCollisions returns an error naming the first two projects or
+// packages of l which differ only in case, as one would be written over the
+// other in vendor/ on a case-insensitive filesystem, such as macOS's.
+func checkCaseCollisions(l *Lock) error {
+	seen := make(map[string]string)
+	for _, lp := range l.Projects() {
+		for _, path := range vendorPaths(lp) {
+			folded := strings.ToLower(path)
+			if other, has := seen[folded]; has && other != path {
+				return errors.Errorf("%s and %s differ only in case, and would collide in vendor/ on case-insensitive filesystems; make the project import only one of them", other, path)
+			}
+			seen[folded] = path
+		}
+	}
+	return nil
+}
+
+// ImportCommentMismatch is a package written to vendor/ whose import comment,
+// as in package foo // import "github.com/org/foo", names a path other than
+// the one it's vendored under, which suggests it's imported by the wrong path.
+type ImportCommentMismatch struct {
+	ImportPath string
+	Comment    string
+}
+
+// importCommentMismatches returns the packages of the projects of l written to
+// the vendor dir vdir, but for those in skip, whose import comments disagree
+// with their import paths, in order.
+func importCommentMismatches(vdir string, l *Lock, skip VendorDigests) ([]ImportCommentMismatch, error) {
+	var mismatches []ImportCommentMismatch
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if _, has := skip[pr]; has {
+			continue
+		}
+		ptree, err := pkgtree.ListPackages(filepath.Join(vdir, filepath.FromSlash(string(pr))), string(pr))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the packages of %s in vendor/", pr)
+		}
+		for _, ip := range vendorPaths(lp) {
+			poe, has := ptree.Packages[ip]
+			if !has || poe.Err != nil {
+				continue
+			}
+			if c := poe.P.CommentPath; c != "" && c != ip {
+				mismatches = append(mismatches, ImportCommentMismatch{ImportPath: ip, Comment: c})
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// hasExtraneousVendor reports whether the vendor dir vpath holds anything
+// other than the dirs of the projects of l, and what dep keeps alongside them.
+func hasExtraneousVendor(vpath string, l *Lock) bool {
+	return len(extraneousVendorPaths(vpath, l, true)) > 0
+}
+
+// extraneousVendorPaths returns the paths in the vendor dir vpath, relative to
+// it with forward slashes, of what isn't one of the dirs of the projects of l,
+// or what dep keeps alongside them. Dirs are returned rather than what they
+// hold. If first is true, it stops at the first one found.
+func extraneousVendorPaths(vpath string, l *Lock, first bool) []string {
+	roots := make(map[string]bool)
+	parents := make(map[string]bool)
+	for _, lp := range l.Projects() {
+		pr := string(lp.Ident().ProjectRoot)
+		roots[pr] = true
+		for dir := filepath.ToSlash(filepath.Dir(filepath.FromSlash(pr))); dir != "."; dir = filepath.ToSlash(filepath.Dir(filepath.FromSlash(dir))) {
+			parents[dir] = true
+		}
+	}
+
+	var extraneous []string
+	filepath.Walk(vpath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || (first && len(extraneous) > 0) {
+			return filepath.SkipDir
+		}
+		if path == vpath {
+			return nil
+		}
+		rel, _ := filepath.Rel(vpath, path)
+		rel = filepath.ToSlash(rel)
+		switch {
+		case rel == ".git" || rel == VendorDigestsName:
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		case roots[rel]:
+			return filepath.SkipDir
+		case parents[rel] && info.IsDir():
+		default:
+			extraneous = append(extraneous, rel)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return extraneous
+}
+
+// VendorStatus is how a project's dir in vendor/ compares to the digest the
+// lock records for it.
+type VendorStatus uint8
+
+const (
+	// VendorOK means the dir holds what the lock records.
+	VendorOK VendorStatus = iota
+	// VendorMissing means there's no dir for the project.
+	VendorMissing
+	// VendorModified means the dir no longer holds what the lock records.
+	VendorModified
+	// VendorUnverifiable means the lock records no digest for the project,
+	// e.g. because it was written by an older dep, so it can't be told.
+	VendorUnverifiable
+)
+
+func (s VendorStatus) String() string {
+	switch s {
+	case VendorOK:
+		return "ok"
+	case VendorMissing:
+		return "missing"
+	case VendorModified:
+		return "modified"
+	case VendorUnverifiable:
+		return "unverifiable"
+	}
+	return "unknown"
+}
+
+// VerifyVendor compares the dirs of the projects of l in the vendor dir vpath
+// against the digests l records for them, returning the status of each by
+// project root, and the paths in vpath, relative to it with forward slashes,
+// which don't belong to any locked project.
+func VerifyVendor(vpath string, l *Lock) (map[gps.ProjectRoot]VendorStatus, []string, error) {
+	statuses := make(map[gps.ProjectRoot]VendorStatus, len(l.Projects()))
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		dir := filepath.Join(vpath, filepath.FromSlash(string(pr)))
+		if is, err := fs.IsDir(dir); err != nil || !is {
+			statuses[pr] = VendorMissing
+			continue
+		}
+		want, has := l.Digests[pr]
+		if !has {
+			statuses[pr] = VendorUnverifiable
+			continue
+		}
+		digest, err := fs.DigestTree(dir)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to verify %s", pr)
+		}
+		if digest != want {
+			statuses[pr] = VendorModified
+		} else {
+			statuses[pr] = VendorOK
+		}
+	}
+
+	if is, _ := fs.IsDir(vpath); !is {
+		return statuses, nil, nil
+	}
+	return statuses, extraneousVendorPaths(vpath, l, false), nil
+}
+
+// writeVendorTree writes the projects of l to the vendor dir vdir, and records
+// their digests there, returning them. The projects in carried, which are
+// unchanged or are to be kept as they were modified, are copied from the
+// existing vendor dir vpath with their recorded digests; the others are
+// exported with sm, workers at once and pruned as l records, through progress
+// if it's non-nil.
+func writeVendorTree(vdir, vpath string, l *Lock, sm gps.SourceManager, carried VendorDigests, workers int, progress func(int, gps.ProjectRoot, func() error) error) (VendorDigests, error) {
+	for pr := range carried {
+		to := filepath.Join(vdir, filepath.FromSlash(string(pr)))
+		if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+			return nil, err
+		}
+		if err := fs.CopyDir(filepath.Join(vpath, filepath.FromSlash(string(pr))), to); err != nil {
+			return nil, errors.Wrapf(err, "error while copying %s from the existing vendor tree", pr)
+		}
+	}
+
+	var export gps.SimpleLock
+	for _, lp := range l.Projects() {
+		if _, has := carried[lp.Ident().ProjectRoot]; !has {
+			export = append(export, lp)
+		}
+	}
+
+	opts := gps.WriteDepTreeOptions{
+		StripVendor:  true,
+		Workers:      workers,
+		PruneOptions: l.PruneOptionsFor,
+	}
+	if progress != nil {
+		n := len(export)
+		opts.Export = func(lp gps.LockedProject, f func() error) error {
+			return progress(n, lp.Ident().ProjectRoot, f)
+		}
+	}
+	if err := gps.WriteDepTreeWithOptions(vdir, export, sm, opts); err != nil {
+		return nil, err
+	}
+
+	vd := make(VendorDigests, len(l.Projects()))
+	for pr, d := range carried {
+		vd[pr] = d
+	}
+	for _, lp := range export {
+		pr := lp.Ident().ProjectRoot
+		digest, err := fs.DigestTree(filepath.Join(vdir, filepath.FromSlash(string(pr))))
+		if err != nil {
+			return nil, err
+		}
+		vd[pr] = VendorDigest{Revision: lockedRevision(lp), PruneOpts: l.PruneOptionsFor(pr), Digest: digest}
+	}
+	return vd, vd.write(vdir)
+}
@@ -0,0 +1,191 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestVendorDigestsRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("vendor")
+	vpath := h.Path("vendor")
+
+	got, err := ReadVendorDigests(vpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no digests without %s, got %v", VendorDigestsName, got)
+	}
+
+	want := VendorDigests{
+		"github.com/sdboyer/deptest":    {Revision: "ff2948a2ac8f538c4ecd55962e919d1e13e74baf", Digest: "abc"},
+		"github.com/sdboyer/deptestdos": {Revision: "5c607206be5decd28e6263ffffdcee067266015e", PruneOpts: gps.PruneGoTestFiles, Digest: "def"},
+	}
+	if err := want.write(vpath); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadVendorDigests(vpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v to be read back, got %v", want, got)
+	}
+
+	h.TempFile(filepath.Join("vendor", VendorDigestsName), "github.com/sdboyer/deptest abc\n")
+	if _, err := ReadVendorDigests(vpath); err == nil {
+		t.Fatal("expected an error reading a malformed line")
+	}
+}
+
+func TestUnchangedVendorProjects(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("vendor/github.com/sdboyer/deptest/deptest.go", "package deptest")
+	h.TempFile("vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos")
+	h.TempFile("vendor/github.com/sdboyer/deptesttres/deptesttres.go", "package deptesttres")
+	vpath := h.Path("vendor")
+
+	lp := func(root, rev string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(root)}, gps.NewVersion("v1.0.0").Pair(gps.Revision(rev)), nil)
+	}
+	digest := func(root string) string {
+		d, err := fs.DigestTree(filepath.Join(vpath, filepath.FromSlash(root)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	l := &Lock{P: []gps.LockedProject{
+		lp("github.com/sdboyer/deptest", "rev1"),
+		lp("github.com/sdboyer/deptestdos", "rev2"),
+		lp("github.com/sdboyer/deptesttres", "rev3"),
+	}}
+	recorded := VendorDigests{
+		// Unchanged.
+		"github.com/sdboyer/deptest": {Revision: "rev1", Digest: digest("github.com/sdboyer/deptest")},
+		// Locked to another revision.
+		"github.com/sdboyer/deptestdos": {Revision: "old", Digest: digest("github.com/sdboyer/deptestdos")},
+		// Modified since it was written.
+		"github.com/sdboyer/deptesttres": {Revision: "rev3", Digest: "modified"},
+	}
+	if err := recorded.write(vpath); err != nil {
+		t.Fatal(err)
+	}
+
+	got := unchangedVendorProjects(vpath, l)
+	want := VendorDigests{"github.com/sdboyer/deptest": recorded["github.com/sdboyer/deptest"]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected unchanged projects %v, got %v", want, got)
+	}
+
+	if hasExtraneousVendor(vpath, l) {
+		t.Fatal("expected no extraneous files in vendor/")
+	}
+	h.TempFile("vendor/.git/HEAD", "ref: refs/heads/master")
+	if hasExtraneousVendor(vpath, l) {
+		t.Fatal("expected vendor/.git not to count as extraneous")
+	}
+	h.TempFile("vendor/github.com/sdboyer/README.md", "")
+	if !hasExtraneousVendor(vpath, l) {
+		t.Fatal("expected a file outside of the locked projects to be extraneous")
+	}
+}
+
+func TestModifiedVendorProjects(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("vendor/github.com/sdboyer/deptest/deptest.go", "package deptest")
+	h.TempFile("vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos")
+	vpath := h.Path("vendor")
+
+	digest, err := fs.DigestTree(filepath.Join(vpath, "github.com", "sdboyer", "deptest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := VendorDigests{
+		"github.com/sdboyer/deptest": {Revision: "rev1", Digest: digest},
+		// Patched by hand since it was written.
+		"github.com/sdboyer/deptestdos": {Revision: "rev2", Digest: "patched"},
+		// Removed since it was written.
+		"github.com/sdboyer/deptesttres": {Revision: "rev3", Digest: "removed"},
+	}
+	if err := recorded.write(vpath); err != nil {
+		t.Fatal(err)
+	}
+
+	got := modifiedVendorProjects(vpath)
+	want := VendorDigests{"github.com/sdboyer/deptestdos": recorded["github.com/sdboyer/deptestdos"]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected modified projects %v, got %v", want, got)
+	}
+
+	wantErr := "vendor/ has been modified since dep wrote it, in github.com/sdboyer/deptestdos"
+	if err := newModifiedVendorError(got); err.Error() != wantErr {
+		t.Fatalf("expected error %q, got %q", wantErr, err)
+	}
+}
+
+func TestVerifyVendor(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempFile("vendor/github.com/sdboyer/deptest/deptest.go", "package deptest")
+	h.TempFile("vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos")
+	h.TempFile("vendor/github.com/sdboyer/deptesttres/deptesttres.go", "package deptesttres")
+	h.TempFile("vendor/github.com/sdboyer/stray/stray.go", "package stray")
+	h.TempFile("vendor/github.com/README.md", "")
+	h.TempFile("vendor/.git/HEAD", "ref: refs/heads/master")
+	vpath := h.Path("vendor")
+
+	lp := func(root string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(root)}, gps.Revision("rev"), nil)
+	}
+	digest, err := fs.DigestTree(filepath.Join(vpath, "github.com", "sdboyer", "deptest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Lock{
+		P: []gps.LockedProject{
+			lp("github.com/sdboyer/deptest"),
+			lp("github.com/sdboyer/deptestdos"),
+			lp("github.com/sdboyer/deptesttres"),
+			lp("github.com/sdboyer/deptestquatro"),
+		},
+		Digests: map[gps.ProjectRoot]string{
+			"github.com/sdboyer/deptest":       digest,
+			"github.com/sdboyer/deptestdos":    "modified",
+			"github.com/sdboyer/deptestquatro": "missing",
+		},
+	}
+	statuses, extraneous, err := VerifyVendor(vpath, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatuses := map[gps.ProjectRoot]VendorStatus{
+		"github.com/sdboyer/deptest":       VendorOK,
+		"github.com/sdboyer/deptestdos":    VendorModified,
+		"github.com/sdboyer/deptesttres":   VendorUnverifiable,
+		"github.com/sdboyer/deptestquatro": VendorMissing,
+	}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Errorf("unexpected statuses:\n\t(GOT): %v\n\t(WNT): %v", statuses, wantStatuses)
+	}
+	wantExtraneous := []string{"github.com/README.md", "github.com/sdboyer/stray"}
+	if !reflect.DeepEqual(extraneous, wantExtraneous) {
+		t.Errorf("unexpected extraneous paths:\n\t(GOT): %v\n\t(WNT): %v", extraneous, wantExtraneous)
+	}
+}